@@ -6,11 +6,13 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 	"time"
 
 	"realtime-api/internal/config"
 	"realtime-api/internal/database"
+	"realtime-api/internal/email"
 	"realtime-api/internal/events"
 	"realtime-api/internal/handler"
 	"realtime-api/internal/health"
@@ -22,11 +24,14 @@ import (
 	"realtime-api/internal/redis"
 	"realtime-api/internal/repository"
 	"realtime-api/internal/service"
+	"realtime-api/internal/storage"
+	"realtime-api/internal/tracing"
 	"realtime-api/internal/websocket"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	echoMiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
@@ -47,6 +52,12 @@ func main() {
 		"port":        cfg.Server.Port,
 	}))
 
+	// Initialize tracing
+	shutdownTracing, err := tracing.Init(&cfg.OTEL)
+	if err != nil {
+		logger.Fatal("Failed to initialize tracing", logger.WithField("error", err.Error()))
+	}
+
 	// Initialize database
 	db, err := database.Init(&cfg.Database)
 	if err != nil {
@@ -54,24 +65,56 @@ func main() {
 	}
 	defer db.Close()
 
-	// Run database migrations
-	if err := db.Migrate(
-		&model.User{},
-		&model.UserProfile{},
-		&model.UserContact{},
-		&model.UserSession{},
-		&model.Room{},
-		&model.RoomMember{},
-		&model.RoomInvite{},
-		&model.Message{},
-		&model.MessageAttachment{},
-		&model.MessageReaction{},
-		&model.MessageRead{},
-		&model.MessageDraft{},
-		&model.Notification{},
-		&model.FileUpload{},
-	); err != nil {
-		logger.Fatal("Failed to run database migrations", logger.WithField("error", err.Error()))
+	// PostgreSQL databases are migrated by database.Init from the SQL files
+	// in migrations/. Other drivers are only used in development and get
+	// their schema from the models with AutoMigrate instead: it adds missing
+	// tables, columns and indexes but never drops or alters them and keeps no
+	// version, so these databases are recreated rather than upgraded when a
+	// migration changes existing columns. Models and migrations must be kept
+	// in step by hand.
+	if cfg.Database.Driver != "postgres" {
+		// Reactions are unique per user and emoji; older versions stored repeats
+		if err := db.DeleteDuplicates("message_reactions", "message_id", "user_id", "emoji"); err != nil {
+			logger.Fatal("Failed to clean up message reactions", logger.WithField("error", err.Error()))
+		}
+
+		// Run database migrations
+		if err := db.Migrate(
+			&model.User{},
+			&model.UserProfile{},
+			&model.UserContact{},
+			&model.UserSession{},
+			&model.DeviceToken{},
+			&model.UserBlock{},
+			&model.Room{},
+			&model.RoomMember{},
+			&model.RoomTag{},
+			&model.RoomInvite{},
+			&model.RoomJoinRequest{},
+			&model.RoomBan{},
+			&model.RoomWebhook{},
+			&model.Message{},
+			&model.MessageAttachment{},
+			&model.MessageReaction{},
+			&model.MessageRead{},
+			&model.MessageDelivery{},
+			&model.MessageHidden{},
+			&model.MessageEdit{},
+			&model.RoomPinnedMessage{},
+			&model.MessageDraft{},
+			&model.ScheduledMessage{},
+			&model.Notification{},
+			&model.FileUpload{},
+			&model.ActivityLog{},
+			&model.UserPreferences{},
+		); err != nil {
+			logger.Fatal("Failed to run database migrations", logger.WithField("error", err.Error()))
+		}
+
+		// Composite index backing cursor pagination of room history
+		if err := db.EnsureIndex("messages", "idx_messages_room_created_at_id", "room_id", "created_at", "id"); err != nil {
+			logger.Fatal("Failed to create database index", logger.WithField("error", err.Error()))
+		}
 	}
 
 	// Initialize Redis
@@ -81,8 +124,8 @@ func main() {
 	}
 	defer redisClient.Close()
 
-	// Initialize RabbitMQ
-	rabbitClient, err := rabbitmq.Init(&cfg.RabbitMQ)
+	// Initialize RabbitMQ, waiting for it to come up (1s, 2s, 4s, ...)
+	rabbitClient, err := rabbitmq.InitWithRetry(&cfg.RabbitMQ, 5, time.Second)
 	if err != nil {
 		logger.Fatal("Failed to initialize RabbitMQ", logger.WithField("error", err.Error()))
 	}
@@ -91,6 +134,52 @@ func main() {
 	// Initialize JWT service
 	jwt.Init(&cfg.JWT)
 
+	// Initialize repositories
+	userRepo := repository.NewCachedUserRepository(repository.NewUserRepository(), redisClient)
+	roomRepo := repository.NewRoomRepository()
+	messageRepo := repository.NewMessageRepository()
+	sessionRepo := repository.NewSessionRepository()
+	notificationRepo := repository.NewNotificationRepository()
+	fileRepo := repository.NewFileRepository()
+	activityLogRepo := repository.NewActivityLogRepository()
+	preferencesRepo := repository.NewUserPreferencesRepository()
+	deviceRepo := repository.NewDeviceTokenRepository()
+
+	fileStorage, err := storage.New(&cfg.Upload)
+	if err != nil {
+		logger.Fatal("Failed to initialize file storage", logger.WithField("error", err.Error()))
+	}
+
+	// Initialize services
+	// Without email, messages such as password reset tokens are logged
+	var mailer email.Sender = email.LogSender{}
+	if cfg.Email.Enabled {
+		mailer = email.NewSMTPSender(&cfg.Email)
+	}
+	userService := service.NewUserService(userRepo, sessionRepo, redisClient, mailer)
+	roomService := service.NewRoomService(roomRepo, userRepo, redisClient)
+	fileService := service.NewFileService(fileRepo, fileStorage, &cfg.Upload)
+	messageService := service.NewMessageService(messageRepo, roomRepo, userRepo, fileService, redisClient)
+	// Offline users get push notifications on the devices they registered
+	// and the devices of their sessions with an FCM token
+	var pushService service.PushNotificationService
+	if cfg.Push.Enabled {
+		pushService, err = service.NewPushNotificationService(&cfg.Push)
+		if err != nil {
+			logger.Fatal("Failed to initialize push notifications", logger.WithField("error", err.Error()))
+		}
+	}
+	// Notifications of offline users are queued for the email worker, which
+	// sends them as digests
+	var emailPublisher service.NotificationPublisher
+	if cfg.Email.Enabled {
+		emailPublisher = rabbitClient
+	}
+	notificationService := service.NewNotificationService(notificationRepo, roomRepo, sessionRepo, deviceRepo, userRepo, redisClient, pushService, emailPublisher)
+	activityService := service.NewActivityService(activityLogRepo, userRepo)
+	preferencesService := service.NewPreferencesService(preferencesRepo, redisClient)
+	service.SetActivityService(activityService)
+
 	// ===== Initialize Event System =====
 	logger.Info("Initializing event system...")
 
@@ -99,13 +188,32 @@ func main() {
 
 	// Initialize Event Router
 	eventRouter := events.NewEventRouter()
+	eventRouter.Use(events.EventLoggingMiddleware, events.EventMetricsMiddleware)
 
 	// Initialize WebSocket hub
 	websocket.Init(redisClient)
 	websocketHub := websocket.GetHub()
 
+	// The email worker consumes the queued notifications, acknowledging them
+	// once their digest is sent
+	var emailWorker *email.Worker
+	if cfg.Email.Enabled {
+		emailWorker = email.NewWorker(userRepo, mailer, email.WorkerConfig{
+			Window:          time.Duration(cfg.Email.DigestWindow) * time.Second,
+			OfflineAfter:    time.Duration(cfg.Email.OfflineAfter) * time.Minute,
+			QuietHoursStart: cfg.Email.QuietHoursStart,
+			QuietHoursEnd:   cfg.Email.QuietHoursEnd,
+		})
+		if err := rabbitClient.DeclareQueue(cfg.Email.Queue, "notification.*"); err != nil {
+			logger.Fatal("Failed to declare email queue", logger.WithField("error", err.Error()))
+		}
+		if err := rabbitClient.ConsumeMessagesAsync(cfg.Email.Queue, emailWorker.HandleMessage); err != nil {
+			logger.Fatal("Failed to start email worker", logger.WithField("error", err.Error()))
+		}
+	}
+
 	// Setup event handlers for real-time functionality
-	setupEventHandlers(eventRouter, websocketHub)
+	setupEventHandlers(eventRouter, websocketHub, notificationService, roomService)
 
 	// Start event processing in background
 	eventCtx, eventCancel := context.WithCancel(context.Background())
@@ -133,23 +241,46 @@ func main() {
 		}()
 	}()
 
-	// Initialize health checker
-	health.Init()
-
-	// Initialize repositories
-	userRepo := repository.NewUserRepository()
-	roomRepo := repository.NewRoomRepository()
-	messageRepo := repository.NewMessageRepository()
+	// Background jobs: expired upload cleanup, scheduled message delivery,
+	// message retention and delivery receipts collected by the WebSocket hub
+	jobCtx, jobCancel := context.WithCancel(context.Background())
+	defer jobCancel()
+	go runFileCleanup(jobCtx, fileService, fileCleanupInterval(&cfg.Upload))
+	go runScheduledMessageDispatcher(jobCtx, messageService, 5*time.Second)
+	go runMessageRetention(jobCtx, messageService, retentionInterval(&cfg.Room))
+	go runNotificationRetention(jobCtx, notificationService, notificationRetentionInterval)
+	websocketHub.StartDeliveryRecording(jobCtx, messageService.RecordDeliveries)
+	websocketHub.SetPostChecker(roomService.CanPost)
+	websocketHub.SetBlockLister(userService.BlockedUserIDs)
+	websocketHub.SetStatusSetter(func(ctx context.Context, userID uuid.UUID, status model.UserStatus) error {
+		_, err := userService.SetUserStatus(ctx, userID, status)
+		return err
+	})
+	websocketHub.SetRoomLister(func(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+		rooms, err := roomService.GetUserRooms(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		roomIDs := make([]uuid.UUID, len(rooms))
+		for i := range rooms {
+			roomIDs[i] = rooms[i].ID
+		}
+		return roomIDs, nil
+	})
 
-	// Initialize services
-	userService := service.NewUserService(userRepo)
-	roomService := service.NewRoomService(roomRepo, userRepo, redisClient)
-	messageService := service.NewMessageService(messageRepo, roomRepo, userRepo, redisClient)
+	// Initialize health checker and metrics
+	healthChecker := health.Init()
+	healthChecker.RegisterCheck("rabbitmq", health.RabbitMQCheck)
+	health.RegisterPrometheusMetrics()
 
 	// Initialize handlers
 	userHandler := handler.NewUserHandler(userService)
 	roomHandler := handler.NewRoomHandler(roomService)
 	messageHandler := handler.NewMessageHandler(messageService)
+	notificationHandler := handler.NewNotificationHandler(notificationService)
+	fileHandler := handler.NewFileHandler(fileService)
+	activityHandler := handler.NewActivityHandler(activityService)
+	preferencesHandler := handler.NewPreferencesHandler(preferencesService)
 	eventHandler := handler.NewEventHandler(redisClient)
 
 	// Initialize Echo server
@@ -164,11 +295,16 @@ func main() {
 
 	// Global middleware
 	e.Use(middleware.RecoveryMiddleware())
+	e.Use(middleware.MetricsMiddleware())
 	e.Use(middleware.LoggerMiddleware())
 	e.Use(middleware.CORSMiddleware())
 	e.Use(middleware.RequestIDMiddleware())
+	e.Use(middleware.TracingMiddleware())
 	e.Use(echoMiddleware.Secure())
-	e.Use(echoMiddleware.Gzip())
+	e.Use(echoMiddleware.GzipWithConfig(echoMiddleware.GzipConfig{
+		// Compressing would hold back the events of a stream
+		Skipper: func(c echo.Context) bool { return c.Path() == "/sse" },
+	}))
 
 	// Rate limiting (100 requests per minute)
 	e.Use(middleware.RateLimitMiddleware(100))
@@ -177,38 +313,120 @@ func main() {
 	e.GET("/health", echo.WrapHandler(http.HandlerFunc(health.HealthHandler)))
 	e.GET("/health/ready", echo.WrapHandler(http.HandlerFunc(health.ReadinessHandler)))
 	e.GET("/health/live", echo.WrapHandler(http.HandlerFunc(health.LivenessHandler)))
+	e.GET("/health/pools", echo.WrapHandler(http.HandlerFunc(health.PoolsHandler)))
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()), middleware.MetricsTokenMiddleware(cfg.Metrics.Token))
+
+	// Uploaded files, unless they are served by the S3 bucket
+	if cfg.Upload.StorageDriver != storage.DriverS3 {
+		e.Static("/uploads", cfg.Upload.StoragePath)
+	}
 
 	// API routes
 	api := e.Group("/api/v1")
 
+	// Admin routes, for system admins only
+	admin := api.Group("/admin", middleware.JWTMiddleware(), middleware.AdminMiddleware())
+	admin.GET("/users", userHandler.ListUsers)
+
+	adminUsers := api.Group("/users", middleware.JWTMiddleware(), middleware.AdminMiddleware())
+	adminUsers.POST("", userHandler.CreateUser)
+	adminUsers.DELETE("/:id", userHandler.DeleteUser)
+	adminUsers.PUT("/:id/activate", userHandler.ActivateUser)
+	adminUsers.PUT("/:id/deactivate", userHandler.DeactivateUser)
+
 	// User routes
 	users := api.Group("/users")
-	users.POST("", userHandler.CreateUser)
-	users.GET("", userHandler.ListUsers)
+	users.GET("/search", userHandler.SearchUsers, middleware.JWTMiddleware())
+	users.GET("/me/preferences", preferencesHandler.GetPreferences, middleware.JWTMiddleware())
+	users.PUT("/me/preferences", preferencesHandler.UpdatePreferences, middleware.JWTMiddleware())
+	users.GET("/me/unread-counts", messageHandler.GetUnreadCounts, middleware.JWTMiddleware())
+	users.GET("/me/mentions", messageHandler.GetMentions, middleware.JWTMiddleware())
+	users.GET("/me/blocks", userHandler.ListBlockedUsers, middleware.JWTMiddleware())
+	users.GET("/me/profile", userHandler.GetMyProfile, middleware.JWTMiddleware())
+	users.PUT("/me/profile", userHandler.UpdateMyProfile, middleware.JWTMiddleware())
+	users.GET("/me/settings", userHandler.GetMySettings, middleware.JWTMiddleware())
+	users.PUT("/me/settings", userHandler.UpdateMySettings, middleware.JWTMiddleware())
+	users.PUT("/me/status", userHandler.UpdateMyStatus, middleware.JWTMiddleware())
+	users.POST("/me/password", userHandler.ChangePassword, middleware.JWTMiddleware())
+	users.POST("/me/devices", notificationHandler.RegisterDevice, middleware.JWTMiddleware())
+	users.DELETE("/me/devices", notificationHandler.UnregisterDevice, middleware.JWTMiddleware())
+	users.POST("/:id/block", userHandler.BlockUser, middleware.JWTMiddleware())
+	users.DELETE("/:id/block", userHandler.UnblockUser, middleware.JWTMiddleware())
 	users.GET("/:id", userHandler.GetUser)
-	users.PUT("/:id", userHandler.UpdateUser)
-	users.DELETE("/:id", userHandler.DeleteUser)
+	users.PUT("/:id", userHandler.UpdateUser, middleware.JWTMiddleware())
+	users.GET("/:id/profile", userHandler.GetUserProfile, middleware.JWTMiddleware())
+	users.GET("/:id/activity", activityHandler.GetUserActivity, middleware.JWTMiddleware())
 
 	// Auth routes
 	auth := api.Group("/auth")
 	auth.POST("/login", userHandler.LoginUser)
 	auth.POST("/register", userHandler.RegisterUser)
 	auth.POST("/refresh", userHandler.RefreshToken)
+	auth.POST("/logout", userHandler.Logout, middleware.JWTMiddleware())
+	auth.POST("/forgot-password", userHandler.ForgotPassword)
+	auth.POST("/reset-password", userHandler.ResetPassword)
+	auth.POST("/2fa/validate", userHandler.ValidateTwoFactorLogin)
+	auth.POST("/2fa/enable", userHandler.EnableTOTP, middleware.JWTMiddleware())
+	auth.POST("/2fa/verify", userHandler.VerifyTOTP, middleware.JWTMiddleware())
+	auth.POST("/2fa/disable", userHandler.DisableTOTP, middleware.JWTMiddleware())
+	auth.GET("/sessions", userHandler.ListSessions, middleware.JWTMiddleware())
+	auth.DELETE("/sessions/:session_id", userHandler.RevokeSession, middleware.JWTMiddleware())
+	auth.POST("/fcm-token", userHandler.RegisterFCMToken, middleware.JWTMiddleware())
+
+	// Contact routes
+	contacts := api.Group("/contacts", middleware.JWTMiddleware())
+	contacts.POST("", userHandler.CreateContact)
+	contacts.GET("", userHandler.ListContacts)
+	contacts.GET("/pending", userHandler.GetPendingContactRequests)
+	contacts.POST("/request/:user_id", userHandler.SendContactRequest)
+	contacts.PUT("/:contact_id", userHandler.UpdateContact)
+	contacts.DELETE("/:contact_id", userHandler.RemoveContact)
+	contacts.PUT("/:contact_id/accept", userHandler.AcceptContactRequest)
+	contacts.PUT("/:contact_id/reject", userHandler.RejectContactRequest)
+	contacts.POST("/:contact_id/accept", userHandler.AcceptContactRequest)
+	contacts.POST("/:contact_id/reject", userHandler.RejectContactRequest)
 
 	// Room routes
 	rooms := api.Group("/rooms")
-	rooms.POST("", roomHandler.CreateRoom)
+	rooms.POST("", roomHandler.CreateRoom, handler.Idempotent)
 	rooms.GET("", roomHandler.ListRooms)
 	rooms.GET("/my-chats", roomHandler.ListUserChatRooms) // New endpoint for chat list
+	rooms.GET("/archived", roomHandler.ListArchivedRooms)
+	rooms.GET("/tags", roomHandler.ListRoomTags)
 	rooms.GET("/:id", roomHandler.GetRoom)
-	rooms.PUT("/:id", roomHandler.UpdateRoom)
-	rooms.DELETE("/:id", roomHandler.DeleteRoom)
+	rooms.PUT("/:id", roomHandler.UpdateRoom, middleware.JWTMiddleware(), middleware.RoomPermission(model.RoomRoleAdmin, roomService))
+	rooms.DELETE("/:id", roomHandler.DeleteRoom, middleware.JWTMiddleware(), middleware.RoomPermission(model.RoomRoleOwner, roomService))
 	rooms.POST("/:id/join", roomHandler.JoinRoom)
 	rooms.POST("/:id/leave", roomHandler.LeaveRoom)
+	rooms.POST("/:id/archive", roomHandler.ArchiveRoom)
+	rooms.POST("/:id/unarchive", roomHandler.UnarchiveRoom)
 	rooms.GET("/:id/members", roomHandler.GetRoomMembers)
+	rooms.GET("/:id/members/search", roomHandler.SearchMembers)
 	rooms.POST("/:id/members", roomHandler.AddMember)
 	rooms.DELETE("/:id/members/:user_id", roomHandler.RemoveMember)
+	rooms.PUT("/:id/members/:user_id/role", roomHandler.UpdateMemberRole)
+	rooms.POST("/:id/transfer", roomHandler.TransferOwnership)
+	rooms.PUT("/:id/members/:user_id/mute", roomHandler.MuteMember)
+	rooms.PUT("/:id/notification-settings", roomHandler.UpdateNotificationSettings)
+	rooms.PUT("/:id/members/me/notifications", roomHandler.UpdateNotificationSettings)
+	rooms.GET("/:id/stats", roomHandler.GetRoomStats)
+	rooms.GET("/:id/bans", roomHandler.GetRoomBans)
+	rooms.POST("/:id/bans", roomHandler.BanMember)
+	rooms.POST("/:id/bans/:user_id", roomHandler.BanMember)
+	rooms.DELETE("/:id/bans/:user_id", roomHandler.UnbanMember)
 	rooms.POST("/:id/invites", roomHandler.CreateInvite)
+	rooms.GET("/:id/invites", roomHandler.GetRoomInvites)
+	rooms.DELETE("/:id/invites/:invite_id", roomHandler.RevokeInvite)
+	rooms.POST("/:id/webhooks", roomHandler.CreateWebhook)
+	rooms.GET("/:id/webhooks", roomHandler.ListWebhooks)
+	rooms.DELETE("/:id/webhooks/:webhook_id", roomHandler.DeleteWebhook)
+	rooms.GET("/:id/requests", roomHandler.GetJoinRequests)
+	rooms.POST("/:id/requests/:user_id/approve", roomHandler.ApproveJoinRequest)
+	rooms.POST("/:id/requests/:user_id/reject", roomHandler.RejectJoinRequest)
+	rooms.POST("/:id/join-requests", roomHandler.JoinRoom)
+	rooms.GET("/:id/join-requests", roomHandler.GetJoinRequests)
+	rooms.POST("/:id/join-requests/:req_id/approve", roomHandler.ApproveJoinRequest)
+	rooms.POST("/:id/join-requests/:req_id/reject", roomHandler.RejectJoinRequest)
 	rooms.POST("/invites/:invite_code/accept", roomHandler.AcceptInvite)
 	rooms.POST("/invites/:invite_code/reject", roomHandler.RejectInvite)
 
@@ -217,28 +435,62 @@ func main() {
 
 	// Message routes
 	messages := api.Group("/messages")
-	messages.POST("", messageHandler.SendMessage)
+	messages.POST("", messageHandler.SendMessage, handler.Idempotent)
+	messages.POST("/delivered", messageHandler.MarkDelivered)
+	messages.DELETE("/scheduled/:id", messageHandler.CancelScheduledMessage)
+	messages.GET("/search", messageHandler.SearchMessages)
 	messages.GET("/:id", messageHandler.GetMessage)
+	messages.GET("/:id/history", messageHandler.GetMessageHistory)
+	messages.GET("/:id/thread", messageHandler.GetThreadMessages)
+	messages.POST("/:id/forward", messageHandler.ForwardMessage)
 	messages.PUT("/:id", messageHandler.EditMessage)
 	messages.DELETE("/:id", messageHandler.DeleteMessage)
-	messages.POST("/:id/reactions", messageHandler.ReactToMessage)
+	messages.GET("/:id/reactions", messageHandler.GetMessageReactions)
+	messages.POST("/:id/reactions", messageHandler.ReactToMessage, handler.Idempotent)
 	messages.DELETE("/:id/reactions", messageHandler.RemoveReaction)
 	messages.POST("/:id/read", messageHandler.MarkAsRead)
 
 	// Room-specific message routes
 	rooms.GET("/:room_id/messages", messageHandler.GetRoomMessages)
+	rooms.GET("/:room_id/messages/search", messageHandler.SearchRoomMessages)
 	rooms.POST("/:room_id/typing/start", messageHandler.StartTyping)
 	rooms.POST("/:room_id/typing/stop", messageHandler.StopTyping)
+	rooms.GET("/:id/pins", messageHandler.GetPinnedMessages)
+	rooms.GET("/:id/export", messageHandler.ExportRoom)
+	rooms.POST("/:id/pins/:message_id", messageHandler.PinMessage)
+	rooms.DELETE("/:id/pins/:message_id", messageHandler.UnpinMessage)
+	rooms.POST("/:id/read", messageHandler.MarkRoomAsRead)
+	rooms.GET("/:id/scheduled", messageHandler.GetScheduledMessages)
+	rooms.GET("/:id/draft", messageHandler.GetDraft)
+	rooms.PUT("/:id/draft", messageHandler.SaveDraft)
+	rooms.DELETE("/:id/draft", messageHandler.DeleteDraft)
+
+	// Notification routes
+	notifications := api.Group("/notifications")
+	notifications.GET("", notificationHandler.ListNotifications)
+	notifications.GET("/unread-count", notificationHandler.GetUnreadCount)
+	notifications.POST("/read-all", notificationHandler.MarkAllAsRead)
+	notifications.POST("/:id/read", notificationHandler.MarkAsRead)
+	notifications.DELETE("/:id", notificationHandler.DeleteNotification)
+
+	// File routes
+	files := api.Group("/files")
+	files.POST("", fileHandler.UploadFile)
+	files.POST("/upload", fileHandler.UploadFile)
+	files.GET("/:id", fileHandler.GetFile)
 
 	// Event system routes (for monitoring/debugging)
 	events := api.Group("/events")
 	events.GET("/metrics", eventHandler.GetEventMetrics)
 	events.POST("/system", eventHandler.PublishSystemEvent)
-	events.GET("/history", eventHandler.GetEventHistory)
+	events.GET("/history", eventHandler.GetEventHistory, middleware.JWTMiddleware(), middleware.AdminMiddleware())
 
 	// WebSocket route
 	e.GET("/ws", websocket.HandleWebSocket)
 
+	// Server-Sent Events route for clients that can't use WebSocket
+	e.GET("/sse", websocket.HandleSSE)
+
 	// Root route
 	e.GET("/", func(c echo.Context) error {
 		return c.JSON(http.StatusOK, map[string]interface{}{
@@ -249,6 +501,11 @@ func main() {
 		})
 	})
 
+	// The routes' request metrics are set up before serving
+	for _, route := range e.Routes() {
+		health.PrepareHTTPRoute(route.Method, route.Path)
+	}
+
 	// Start server in a goroutine
 	go func() {
 		address := fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port)
@@ -269,49 +526,244 @@ func main() {
 
 	logger.Info("Server shutting down...")
 
-	// Cancel event processing
+	// Cancel event processing and background jobs
 	eventCancel()
+	jobCancel()
 
 	// Graceful shutdown with timeout
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer shutdownCancel()
 
+	// Let WebSocket clients receive what is queued for them before the
+	// server stops; their connections aren't closed by e.Shutdown
+	if err := websocketHub.Shutdown(shutdownCtx); err != nil {
+		logger.Error("WebSocket connections forced to close", logger.WithField("error", err.Error()))
+	}
+
 	if err := e.Shutdown(shutdownCtx); err != nil {
 		logger.Error("Server forced to shutdown", logger.WithField("error", err.Error()))
 	}
 
+	// Send the pending email digests
+	if emailWorker != nil {
+		emailWorker.Stop()
+	}
+
+	// Flush the spans of the last requests
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("Failed to shut down tracing", logger.WithField("error", err.Error()))
+	}
+
 	logger.Info("Server shutdown complete")
 }
 
-// setupEventHandlers configures event routing to WebSocket for real-time functionality
-func setupEventHandlers(router *events.EventRouter, hub *websocket.Hub) {
+// fileCleanupInterval is how often expired uploads are removed, hourly unless
+// configured
+func fileCleanupInterval(cfg *config.UploadConfig) time.Duration {
+	if cfg.CleanupInterval <= 0 {
+		return time.Hour
+	}
+	return time.Duration(cfg.CleanupInterval) * time.Minute
+}
+
+// runFileCleanup deletes expired temporary uploads every interval until ctx is done
+func runFileCleanup(ctx context.Context, fileService service.FileService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			started := time.Now()
+			removed, err := fileService.CleanupExpiredFiles(ctx)
+			if err != nil {
+				logger.Error("Failed to clean up expired files", logger.WithFields(map[string]interface{}{
+					"removed": removed,
+					"error":   err.Error(),
+				}))
+				continue
+			}
+			logger.Info("Expired files cleaned up", logger.WithFields(map[string]interface{}{
+				"removed":  removed,
+				"duration": time.Since(started).String(),
+			}))
+		}
+	}
+}
+
+// runScheduledMessageDispatcher sends due scheduled messages every interval
+// until ctx is done
+func runScheduledMessageDispatcher(ctx context.Context, messageService service.MessageService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sent, err := messageService.DispatchScheduledMessages(ctx)
+			if err != nil {
+				logger.Error("Failed to dispatch scheduled messages", logger.WithField("error", err.Error()))
+				continue
+			}
+			if sent > 0 {
+				logger.Info("Scheduled messages sent", logger.WithField("sent", sent))
+			}
+		}
+	}
+}
+
+// retentionInterval is how often message retention runs, hourly unless
+// configured
+func retentionInterval(cfg *config.RoomConfig) time.Duration {
+	if cfg.RetentionInterval <= 0 {
+		return time.Hour
+	}
+	return time.Duration(cfg.RetentionInterval) * time.Minute
+}
+
+// runMessageRetention deletes messages past their room's retention period
+// every interval until ctx is done
+func runMessageRetention(ctx context.Context, messageService service.MessageService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			logger.Info("Enforcing message retention")
+			deleted, err := messageService.EnforceRetention(ctx)
+			if err != nil {
+				logger.Error("Failed to enforce message retention", logger.WithField("error", err.Error()))
+				continue
+			}
+			logger.Info("Message retention enforced", logger.WithField("deleted", deleted))
+		}
+	}
+}
+
+// notificationRetentionInterval is how often old read notifications are
+// deleted
+const notificationRetentionInterval = 24 * time.Hour
+
+// runNotificationRetention deletes old read notifications every interval
+// until ctx is done
+func runNotificationRetention(ctx context.Context, notificationService service.NotificationService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := notificationService.EnforceRetention(ctx)
+			if err != nil {
+				logger.Error("Failed to enforce notification retention", logger.WithField("error", err.Error()))
+				continue
+			}
+			logger.Info("Notification retention enforced", logger.WithField("deleted", deleted))
+		}
+	}
+}
+
+// setupEventHandlers configures event routing to WebSocket for real-time
+// functionality and records in-app notifications for the affected users
+func setupEventHandlers(router *events.EventRouter, hub *websocket.Hub, notificationService service.NotificationService, roomService service.RoomService) {
 	logger.Info("Setting up event handlers for real-time functionality...")
 
-	// User events - Online/Offline status
-	router.Register("event.user.online", func(event *events.Event) error {
-		logger.Debug("User online event", logger.WithFields(map[string]interface{}{
+	// Room webhooks receive the room and message events they subscribe to
+	router.Observe(func(event *events.Event) error {
+		if event.RoomID == nil || (event.Level != events.LevelRoom && event.Level != events.LevelMessage) {
+			return nil
+		}
+		return roomService.DeliverWebhooks(context.Background(), event)
+	})
+
+	// User events - Online/Offline status. The event carries the status the
+	// user's rooms may see, so invisible users show as offline.
+	broadcastPresence := func(event *events.Event) error {
+		logger.Debug("User presence event", logger.WithFields(map[string]interface{}{
 			"user_id": event.UserID,
+			"type":    event.Type,
 		}))
 
-		if event.UserID != nil {
-			hub.BroadcastToUser(*event.UserID, model.WSTypeUserStatusChange, map[string]interface{}{
-				"status":  "online",
-				"user_id": *event.UserID,
-				"data":    event.Data,
+		if event.UserID == nil {
+			return nil
+		}
+		return hub.BroadcastPresence(context.Background(), *event.UserID, map[string]interface{}{
+			"status":   event.Data["status"],
+			"username": event.Data["username"],
+		})
+	}
+	router.Register("event.user.online", broadcastPresence)
+	router.Register("event.user.offline", broadcastPresence)
+
+	// Contact events - requests notify the recipient
+	router.Register("event.user.contact.request", func(event *events.Event) error {
+		contactID, ok := eventUserID(event.Data, "contact_id")
+		if !ok || event.UserID == nil {
+			return nil
+		}
+
+		notifyUser(hub, notificationService, contactID, service.NotificationTypeContactRequest,
+			"Contact request", "You received a contact request", map[string]interface{}{
+				"user_id":    *event.UserID,
+				"request_id": event.Data["request_id"],
 			})
+		hub.BroadcastToUser(contactID, model.WSTypeNotification, map[string]interface{}{
+			"type":    "contact_request",
+			"user_id": *event.UserID,
+			"data":    event.Data,
+		})
+		return nil
+	})
+
+	// Profile changes refresh the cached display names of the user's contacts
+	router.Register("event.user.profile.update", func(event *events.Event) error {
+		if event.UserID == nil {
+			return nil
+		}
+
+		payload := map[string]interface{}{
+			"user_id":      *event.UserID,
+			"display_name": event.Data["display_name"],
+		}
+		hub.BroadcastToUser(*event.UserID, model.WSTypeUserProfileUpdate, payload)
+		for _, contactID := range eventUserIDs(event.Data, "contact_ids") {
+			hub.BroadcastToUser(contactID, model.WSTypeUserProfileUpdate, payload)
 		}
 		return nil
 	})
 
-	router.Register("event.user.offline", func(event *events.Event) error {
-		logger.Debug("User offline event", logger.WithFields(map[string]interface{}{
-			"user_id": event.UserID,
-		}))
+	// Accepted contacts get a direct room
+	router.Register("event.user.contact.accepted", func(event *events.Event) error {
+		if event.UserID == nil {
+			return nil
+		}
+		contactIDStr, ok := event.Data["contact_id"].(string)
+		if !ok {
+			return nil
+		}
+		contactID, err := uuid.Parse(contactIDStr)
+		if err != nil {
+			return nil
+		}
 
-		if event.UserID != nil {
-			hub.BroadcastToUser(*event.UserID, model.WSTypeUserStatusChange, map[string]interface{}{
-				"status":  "offline",
-				"user_id": *event.UserID,
+		room, err := roomService.CreateOrGetDirectRoom(context.Background(), contactID, *event.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to create direct room for contacts: %w", err)
+		}
+
+		for _, userID := range []uuid.UUID{*event.UserID, contactID} {
+			hub.BroadcastToUser(userID, model.WSTypeNotification, map[string]interface{}{
+				"type":    "contact_accepted",
+				"room_id": room.ID,
 				"data":    event.Data,
 			})
 		}
@@ -346,7 +798,7 @@ func setupEventHandlers(router *events.EventRouter, hub *websocket.Hub) {
 	// Room events - Join/Leave/Create real-time notifications
 	router.Register("event.room.create", func(event *events.Event) error {
 		if event.RoomID != nil {
-			hub.BroadcastToRoom(*event.RoomID, model.WSTypeNotification, map[string]interface{}{
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeNotification, map[string]interface{}{
 				"type":    "room_created",
 				"room_id": *event.RoomID,
 				"user_id": event.UserID,
@@ -358,7 +810,7 @@ func setupEventHandlers(router *events.EventRouter, hub *websocket.Hub) {
 
 	router.Register("event.room.join", func(event *events.Event) error {
 		if event.RoomID != nil {
-			hub.BroadcastToRoom(*event.RoomID, model.WSTypeUserJoin, map[string]interface{}{
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeUserJoin, map[string]interface{}{
 				"room_id": *event.RoomID,
 				"user_id": event.UserID,
 				"data":    event.Data,
@@ -369,7 +821,7 @@ func setupEventHandlers(router *events.EventRouter, hub *websocket.Hub) {
 
 	router.Register("event.room.leave", func(event *events.Event) error {
 		if event.RoomID != nil {
-			hub.BroadcastToRoom(*event.RoomID, model.WSTypeUserLeave, map[string]interface{}{
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeUserLeave, map[string]interface{}{
 				"room_id": *event.RoomID,
 				"user_id": event.UserID,
 				"data":    event.Data,
@@ -379,8 +831,13 @@ func setupEventHandlers(router *events.EventRouter, hub *websocket.Hub) {
 	})
 
 	router.Register("event.room.member.add", func(event *events.Event) error {
+		if userID, ok := eventUserID(event.Data, "user_id"); ok && event.RoomID != nil {
+			notifyUser(hub, notificationService, userID, service.NotificationTypeRoomJoin,
+				"Added to a room", "You were added to a room", map[string]interface{}{"room_id": *event.RoomID})
+		}
+
 		if event.RoomID != nil {
-			hub.BroadcastToRoom(*event.RoomID, model.WSTypeNotification, map[string]interface{}{
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeNotification, map[string]interface{}{
 				"type":    "member_added",
 				"room_id": *event.RoomID,
 				"data":    event.Data,
@@ -390,8 +847,13 @@ func setupEventHandlers(router *events.EventRouter, hub *websocket.Hub) {
 	})
 
 	router.Register("event.room.member.remove", func(event *events.Event) error {
+		if userID, ok := eventUserID(event.Data, "user_id"); ok && event.RoomID != nil {
+			notifyUser(hub, notificationService, userID, service.NotificationTypeRoomLeave,
+				"Removed from a room", "You were removed from a room", map[string]interface{}{"room_id": *event.RoomID})
+		}
+
 		if event.RoomID != nil {
-			hub.BroadcastToRoom(*event.RoomID, model.WSTypeNotification, map[string]interface{}{
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeNotification, map[string]interface{}{
 				"type":    "member_removed",
 				"room_id": *event.RoomID,
 				"data":    event.Data,
@@ -400,31 +862,199 @@ func setupEventHandlers(router *events.EventRouter, hub *websocket.Hub) {
 		return nil
 	})
 
+	router.Register("event.room.invite.create", func(event *events.Event) error {
+		if userID, ok := eventUserID(event.Data, "invitee_id"); ok && event.RoomID != nil {
+			notifyUser(hub, notificationService, userID, service.NotificationTypeRoomInvite,
+				"Room invitation", "You were invited to a room", map[string]interface{}{
+					"room_id":     *event.RoomID,
+					"invite_code": event.Data["invite_code"],
+				})
+		}
+		return nil
+	})
+
+	// Join request answers go to the requester only
+	router.Register("event.room.join.request.approve", func(event *events.Event) error {
+		return joinRequestAnswered(hub, notificationService, event, "join_request_approved",
+			"Join request approved", "Your request to join a room was approved")
+	})
+
+	router.Register("event.room.join.request.reject", func(event *events.Event) error {
+		return joinRequestAnswered(hub, notificationService, event, "join_request_rejected",
+			"Join request rejected", "Your request to join a room was rejected")
+	})
+
+	router.Register("event.room.update", func(event *events.Event) error {
+		if event.RoomID != nil {
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeNotification, map[string]interface{}{
+				"type":    "room_updated",
+				"room_id": *event.RoomID,
+				"user_id": event.UserID,
+				"data":    event.Data,
+			})
+		}
+		return nil
+	})
+
+	// Clients drop the messages removed by the room's retention policy
+	router.Register("event.room.messages.expire", func(event *events.Event) error {
+		if event.RoomID != nil {
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeNotification, map[string]interface{}{
+				"type":    "messages_expired",
+				"room_id": *event.RoomID,
+				"data":    event.Data,
+			})
+		}
+		return nil
+	})
+
+	router.Register("event.room.settings.update", func(event *events.Event) error {
+		if event.RoomID != nil {
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeNotification, map[string]interface{}{
+				"type":    "room_settings_updated",
+				"room_id": *event.RoomID,
+				"user_id": event.UserID,
+				"data":    event.Data,
+			})
+		}
+		return nil
+	})
+
+	router.Register("event.room.member.role.update", func(event *events.Event) error {
+		if event.RoomID != nil {
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeNotification, map[string]interface{}{
+				"type":    "member_role_updated",
+				"room_id": *event.RoomID,
+				"data":    event.Data,
+			})
+		}
+		return nil
+	})
+
+	router.Register("event.room.ownership.transfer", func(event *events.Event) error {
+		if event.RoomID != nil {
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeNotification, map[string]interface{}{
+				"type":    "ownership_transferred",
+				"room_id": *event.RoomID,
+				"user_id": event.UserID,
+				"data":    event.Data,
+			})
+		}
+		return nil
+	})
+
+	// Banned users are dropped from the hub room right away
+	router.Register("event.room.member.ban", func(event *events.Event) error {
+		if userID, ok := eventUserID(event.Data, "user_id"); ok && event.RoomID != nil {
+			hub.LeaveRoom(userID, *event.RoomID)
+			notifyUser(hub, notificationService, userID, service.NotificationTypeRoomLeave,
+				"Banned from a room", "You were banned from a room", map[string]interface{}{"room_id": *event.RoomID})
+		}
+
+		if event.RoomID != nil {
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeNotification, map[string]interface{}{
+				"type":    "member_banned",
+				"room_id": *event.RoomID,
+				"data":    event.Data,
+			})
+		}
+		return nil
+	})
+
+	router.Register("event.room.member.unban", func(event *events.Event) error {
+		if event.RoomID != nil {
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeNotification, map[string]interface{}{
+				"type":    "member_unbanned",
+				"room_id": *event.RoomID,
+				"data":    event.Data,
+			})
+		}
+		return nil
+	})
+
+	router.Register("event.room.member.mute.update", func(event *events.Event) error {
+		if event.RoomID != nil {
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeNotification, map[string]interface{}{
+				"type":    "member_mute_updated",
+				"room_id": *event.RoomID,
+				"data":    event.Data,
+			})
+		}
+		return nil
+	})
+
+	router.Register("event.room.message.pin", func(event *events.Event) error {
+		if event.RoomID != nil {
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeNotification, map[string]interface{}{
+				"type":    "message_pinned",
+				"room_id": *event.RoomID,
+				"user_id": event.UserID,
+				"data":    event.Data,
+			})
+		}
+		return nil
+	})
+
+	router.Register("event.room.message.unpin", func(event *events.Event) error {
+		if event.RoomID != nil {
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeNotification, map[string]interface{}{
+				"type":    "message_unpinned",
+				"room_id": *event.RoomID,
+				"user_id": event.UserID,
+				"data":    event.Data,
+			})
+		}
+		return nil
+	})
+
 	// Message events - Real-time message delivery
 	router.Register("event.message.send", func(event *events.Event) error {
 		if event.RoomID != nil {
-			hub.BroadcastToRoom(*event.RoomID, model.WSTypeMessage, event.Data)
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeMessage, event.Data)
+
+			content, _ := event.Data["content"].(string)
+			if content == "" {
+				content = "Sent an attachment"
+			}
+			metadata, _ := event.Data["metadata"].(string)
+			mentioned := service.MentionedUserIDs(metadata)
+			notifications, err := notificationService.NotifyRoomMembers(context.Background(), *event.RoomID, event.UserID,
+				mentioned, service.NotificationTypeMessage, "New message", content, map[string]interface{}{
+					"room_id":    *event.RoomID,
+					"message_id": event.Data["message_id"],
+				})
+			if err != nil {
+				logger.Warn("Failed to create message notifications", logger.WithField("error", err.Error()))
+				return nil
+			}
+
+			// Mentioned members see the message as a notification of its own
+			for i := range notifications {
+				if slices.Contains(mentioned, notifications[i].UserID) {
+					broadcastNotification(hub, &notifications[i])
+				}
+			}
 		}
 		return nil
 	})
 
 	router.Register("event.message.edit", func(event *events.Event) error {
 		if event.RoomID != nil {
-			hub.BroadcastToRoom(*event.RoomID, model.WSTypeMessageEdit, event.Data)
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeMessageEdit, event.Data)
 		}
 		return nil
 	})
 
 	router.Register("event.message.delete", func(event *events.Event) error {
 		if event.RoomID != nil {
-			hub.BroadcastToRoom(*event.RoomID, model.WSTypeMessageDelete, event.Data)
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeMessageDelete, event.Data)
 		}
 		return nil
 	})
 
 	router.Register("event.message.read", func(event *events.Event) error {
 		if event.RoomID != nil {
-			hub.BroadcastToRoom(*event.RoomID, model.WSTypeNotification, map[string]interface{}{
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeNotification, map[string]interface{}{
 				"type":    "message_read",
 				"room_id": *event.RoomID,
 				"user_id": event.UserID,
@@ -436,7 +1066,7 @@ func setupEventHandlers(router *events.EventRouter, hub *websocket.Hub) {
 
 	router.Register("event.message.reaction.add", func(event *events.Event) error {
 		if event.RoomID != nil {
-			hub.BroadcastToRoom(*event.RoomID, model.WSTypeMessageReaction, map[string]interface{}{
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeMessageReaction, map[string]interface{}{
 				"action":  "add",
 				"room_id": *event.RoomID,
 				"user_id": event.UserID,
@@ -448,7 +1078,7 @@ func setupEventHandlers(router *events.EventRouter, hub *websocket.Hub) {
 
 	router.Register("event.message.reaction.remove", func(event *events.Event) error {
 		if event.RoomID != nil {
-			hub.BroadcastToRoom(*event.RoomID, model.WSTypeMessageReaction, map[string]interface{}{
+			hub.BroadcastEventToRoom(*event.RoomID, event.ID, model.WSTypeMessageReaction, map[string]interface{}{
 				"action":  "remove",
 				"room_id": *event.RoomID,
 				"user_id": event.UserID,
@@ -476,7 +1106,79 @@ func setupEventHandlers(router *events.EventRouter, hub *websocket.Hub) {
 	})
 
 	logger.Info("Event handlers registered successfully", logger.WithFields(map[string]interface{}{
-		"handlers_count": "16",
+		"handlers_count": router.HandlerCount(),
 		"categories":     []string{"user", "typing", "room", "message", "system"},
 	}))
 }
+
+// joinRequestAnswered notifies the requester of an answered join request and
+// pushes it to their connected clients
+func joinRequestAnswered(hub *websocket.Hub, notificationService service.NotificationService, event *events.Event, wsType, title, message string) error {
+	userID, ok := eventUserID(event.Data, "user_id")
+	if !ok || event.RoomID == nil {
+		return nil
+	}
+
+	notifyUser(hub, notificationService, userID, service.NotificationTypeJoinRequest, title, message, map[string]interface{}{
+		"room_id":    *event.RoomID,
+		"request_id": event.Data["request_id"],
+	})
+	hub.BroadcastToUser(userID, model.WSTypeNotification, map[string]interface{}{
+		"type":    wsType,
+		"room_id": *event.RoomID,
+		"data":    event.Data,
+	})
+	return nil
+}
+
+// notifyUser records a notification for a single user and sends it to their
+// connections, logging failures so they never block real-time delivery
+func notifyUser(hub *websocket.Hub, notificationService service.NotificationService, userID uuid.UUID, notificationType, title, message string, data map[string]interface{}) {
+	notification, err := notificationService.CreateNotification(context.Background(), userID, notificationType, title, message, data)
+	if err != nil {
+		logger.Warn("Failed to create notification", logger.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"type":    notificationType,
+			"error":   err.Error(),
+		}))
+		return
+	}
+	broadcastNotification(hub, notification)
+}
+
+// broadcastNotification sends a new notification to the connections of its
+// user so notification badges update live
+func broadcastNotification(hub *websocket.Hub, notification *model.Notification) {
+	hub.BroadcastToUser(notification.UserID, model.WSTypeNotification, map[string]interface{}{
+		"type":         "notification_created",
+		"notification": notification,
+	})
+}
+
+// eventUserIDs reads a list of user IDs from event data, skipping invalid ones
+func eventUserIDs(data map[string]interface{}, key string) []uuid.UUID {
+	values, _ := data[key].([]interface{})
+	userIDs := make([]uuid.UUID, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			if userID, err := uuid.Parse(s); err == nil {
+				userIDs = append(userIDs, userID)
+			}
+		}
+	}
+	return userIDs
+}
+
+// eventUserID reads a user ID from event data, which holds it as a string
+// once the event has been through Redis
+func eventUserID(data map[string]interface{}, key string) (uuid.UUID, bool) {
+	value, ok := data[key].(string)
+	if !ok {
+		return uuid.Nil, false
+	}
+	userID, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return userID, true
+}
@@ -10,13 +10,20 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	RabbitMQ RabbitMQConfig `mapstructure:"rabbitmq"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	Logger   LoggerConfig   `mapstructure:"logger"`
-	Upload   UploadConfig   `mapstructure:"upload"`
+	Server    ServerConfig    `mapstructure:"server"`
+	Database  DatabaseConfig  `mapstructure:"database"`
+	Redis     RedisConfig     `mapstructure:"redis"`
+	RabbitMQ  RabbitMQConfig  `mapstructure:"rabbitmq"`
+	JWT       JWTConfig       `mapstructure:"jwt"`
+	Logger    LoggerConfig    `mapstructure:"logger"`
+	Upload    UploadConfig    `mapstructure:"upload"`
+	Room      RoomConfig      `mapstructure:"room"`
+	WebSocket WebSocketConfig `mapstructure:"websocket"`
+	Events    EventsConfig    `mapstructure:"events"`
+	OTEL      OTELConfig      `mapstructure:"otel"`
+	Email     EmailConfig     `mapstructure:"email"`
+	Push      PushConfig      `mapstructure:"push"`
+	Metrics   MetricsConfig   `mapstructure:"metrics"`
 }
 
 type ServerConfig struct {
@@ -35,6 +42,8 @@ type DatabaseConfig struct {
 	Password string `mapstructure:"password"`
 	Database string `mapstructure:"database"`
 	SSLMode  string `mapstructure:"ssl_mode"`
+	// QueryTimeout bounds a single read in seconds; writes get three times as long
+	QueryTimeout int `mapstructure:"query_timeout"`
 }
 
 type RedisConfig struct {
@@ -54,6 +63,13 @@ type RabbitMQConfig struct {
 	Exchange   string `mapstructure:"exchange"`
 	Queue      string `mapstructure:"queue"`
 	RoutingKey string `mapstructure:"routing_key"`
+
+	// Failed messages are retried MaxRetries times, RetryDelay milliseconds
+	// apart, before being parked in DeadLetterQueue
+	DeadLetterExchange string `mapstructure:"dead_letter_exchange"`
+	DeadLetterQueue    string `mapstructure:"dead_letter_queue"`
+	MaxRetries         int    `mapstructure:"max_retries"`
+	RetryDelay         int    `mapstructure:"retry_delay"`
 }
 
 type JWTConfig struct {
@@ -68,6 +84,107 @@ type UploadConfig struct {
 	StoragePath  string   `mapstructure:"storage_path"`
 	BaseURL      string   `mapstructure:"base_url"`
 	TempTTL      int      `mapstructure:"temp_ttl"` // in hours
+
+	// Expired and abandoned uploads are removed every CleanupInterval
+	// minutes. Uploads stuck in "uploading" are abandoned after
+	// StaleUploadTTL hours.
+	CleanupInterval int `mapstructure:"cleanup_interval"`
+	StaleUploadTTL  int `mapstructure:"stale_upload_ttl"`
+
+	// Image uploads get a thumbnail fitting these dimensions, in pixels
+	ThumbnailWidth  int `mapstructure:"thumbnail_width"`
+	ThumbnailHeight int `mapstructure:"thumbnail_height"`
+
+	// Where uploads are kept: local (StoragePath) or s3
+	StorageDriver string   `mapstructure:"storage_driver"`
+	S3            S3Config `mapstructure:"s3"`
+	// Attachments of private rooms get signed URLs valid this long, in minutes
+	SignedURLTTL int `mapstructure:"signed_url_ttl"`
+}
+
+// S3Config configures an S3 compatible bucket, like AWS S3 or MinIO
+type S3Config struct {
+	// Endpoint is the host:port of the server; objects are addressed
+	// path-style, endpoint/bucket/key
+	Endpoint        string `mapstructure:"endpoint"`
+	Region          string `mapstructure:"region"`
+	Bucket          string `mapstructure:"bucket"`
+	AccessKeyID     string `mapstructure:"access_key_id"`
+	SecretAccessKey string `mapstructure:"secret_access_key"`
+	UseSSL          bool   `mapstructure:"use_ssl"`
+	// PublicURL replaces endpoint/bucket in the public URLs of objects,
+	// e.g. for a CDN in front of the bucket
+	PublicURL string `mapstructure:"public_url"`
+}
+
+type RoomConfig struct {
+	MaxPinnedMessages int `mapstructure:"max_pinned_messages"`
+	// Distinct emojis one user can react with on a single message
+	MaxReactionsPerUser int `mapstructure:"max_reactions_per_user"`
+
+	// Message retention job: minutes between runs, messages removed per
+	// transaction, and whether expired messages are removed from the
+	// database rather than marked deleted
+	RetentionInterval   int  `mapstructure:"retention_interval"`
+	RetentionBatchSize  int  `mapstructure:"retention_batch_size"`
+	RetentionHardDelete bool `mapstructure:"retention_hard_delete"`
+}
+
+type WebSocketConfig struct {
+	// Connecting once more disconnects the user's oldest connection
+	MaxConnectionsPerUser int `mapstructure:"max_connections_per_user"`
+}
+
+type EventsConfig struct {
+	// Published events kept per channel for the event history
+	HistorySize int `mapstructure:"history_size"`
+}
+
+type MetricsConfig struct {
+	// Bearer token required to scrape /metrics; empty leaves it public
+	Token string `mapstructure:"token"`
+}
+
+type OTELConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	ServiceName string `mapstructure:"service_name"`
+	// OTLP gRPC collector address, host:port
+	Endpoint string `mapstructure:"endpoint"`
+	Insecure bool   `mapstructure:"insecure"`
+	// Share of new traces that are sampled, 0 to 1. Traces started
+	// upstream keep their sampling decision.
+	SamplingRatio float64 `mapstructure:"sampling_ratio"`
+}
+
+// EmailConfig configures the email digests sent to offline users
+type EmailConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	SMTPHost string `mapstructure:"smtp_host"`
+	SMTPPort string `mapstructure:"smtp_port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	From     string `mapstructure:"from"`
+	// Queue the notification events are consumed from
+	Queue string `mapstructure:"queue"`
+	// Notifications of a user within this many seconds go in one email
+	DigestWindow int `mapstructure:"digest_window"`
+	// Minutes since users were last seen before they get emails
+	OfflineAfter int `mapstructure:"offline_after"`
+	// Hours of the day in the user's timezone no emails are sent between;
+	// equal hours turn quiet hours off
+	QuietHoursStart int `mapstructure:"quiet_hours_start"`
+	QuietHoursEnd   int `mapstructure:"quiet_hours_end"`
+}
+
+// PushConfig configures the mobile push notifications sent to offline users
+// through Firebase Cloud Messaging
+type PushConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Service account key file of the Firebase project, as downloaded from
+	// the Firebase console
+	CredentialsFile string `mapstructure:"credentials_file"`
+	// Only validate messages with Firebase instead of delivering them
+	DryRun bool `mapstructure:"dry_run"`
 }
 
 type LoggerConfig struct {
@@ -142,6 +259,7 @@ func setDefaults() {
 	viper.SetDefault("database.password", "password")
 	viper.SetDefault("database.database", "realtime_db")
 	viper.SetDefault("database.ssl_mode", "disable")
+	viper.SetDefault("database.query_timeout", 10)
 
 	// Redis defaults
 	viper.SetDefault("redis.host", "localhost")
@@ -158,6 +276,10 @@ func setDefaults() {
 	viper.SetDefault("rabbitmq.exchange", "chat_exchange")
 	viper.SetDefault("rabbitmq.queue", "chat_queue")
 	viper.SetDefault("rabbitmq.routing_key", "chat")
+	viper.SetDefault("rabbitmq.dead_letter_exchange", "chat_dlx")
+	viper.SetDefault("rabbitmq.dead_letter_queue", "chat_dlq")
+	viper.SetDefault("rabbitmq.max_retries", 3)
+	viper.SetDefault("rabbitmq.retry_delay", 5000)
 
 	// JWT defaults
 	viper.SetDefault("jwt.secret_key", "your-secret-key-change-this-in-production")
@@ -166,10 +288,54 @@ func setDefaults() {
 
 	// Upload defaults
 	viper.SetDefault("upload.max_file_size", 10485760) // 10MB
-	viper.SetDefault("upload.allowed_types", []string{"image/jpeg", "image/png", "image/gif", "video/mp4", "audio/mpeg", "application/pdf"})
+	viper.SetDefault("upload.allowed_types", []string{"image/jpeg", "image/png", "image/gif", "image/webp", "video/mp4", "audio/mpeg", "application/pdf"})
 	viper.SetDefault("upload.storage_path", "./uploads")
 	viper.SetDefault("upload.base_url", "http://localhost:8080/uploads")
-	viper.SetDefault("upload.temp_ttl", 24) // 24 hours
+	viper.SetDefault("upload.temp_ttl", 24)         // 24 hours
+	viper.SetDefault("upload.cleanup_interval", 60) // 1 hour
+	viper.SetDefault("upload.stale_upload_ttl", 6)  // 6 hours
+	viper.SetDefault("upload.thumbnail_width", 320)
+	viper.SetDefault("upload.thumbnail_height", 320)
+	viper.SetDefault("upload.storage_driver", "local")
+	viper.SetDefault("upload.signed_url_ttl", 60) // 1 hour
+	viper.SetDefault("upload.s3.region", "us-east-1")
+	viper.SetDefault("upload.s3.use_ssl", true)
+
+	// Room defaults
+	viper.SetDefault("room.max_pinned_messages", 50)
+	viper.SetDefault("room.max_reactions_per_user", 20)
+	viper.SetDefault("room.retention_interval", 60) // 1 hour
+	viper.SetDefault("room.retention_batch_size", 1000)
+	viper.SetDefault("room.retention_hard_delete", false)
+
+	// WebSocket defaults
+	viper.SetDefault("websocket.max_connections_per_user", 5)
+	viper.SetDefault("events.history_size", 1000)
+
+	// Tracing defaults
+	viper.SetDefault("otel.enabled", false)
+	viper.SetDefault("otel.service_name", "realtime-api")
+	viper.SetDefault("otel.endpoint", "localhost:4317")
+	viper.SetDefault("otel.insecure", true)
+	viper.SetDefault("otel.sampling_ratio", 1.0)
+
+	// Email defaults
+	viper.SetDefault("email.enabled", false)
+	viper.SetDefault("email.smtp_host", "localhost")
+	viper.SetDefault("email.smtp_port", "25")
+	viper.SetDefault("email.from", "no-reply@localhost")
+	viper.SetDefault("email.queue", "email_notifications")
+	viper.SetDefault("email.digest_window", 300) // 5 minutes
+	viper.SetDefault("email.offline_after", 10)
+	viper.SetDefault("email.quiet_hours_start", 22)
+	viper.SetDefault("email.quiet_hours_end", 7)
+
+	// Push notification defaults
+	viper.SetDefault("push.enabled", false)
+	viper.SetDefault("push.dry_run", false)
+
+	// Metrics defaults
+	viper.SetDefault("metrics.token", "")
 
 	// Logger defaults
 	viper.SetDefault("logger.level", "info")
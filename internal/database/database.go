@@ -2,11 +2,17 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"strings"
 	"time"
 
 	"realtime-api/internal/config"
 	"realtime-api/internal/logger"
+	"realtime-api/internal/tracing"
+	"realtime-api/migrations"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
@@ -21,6 +27,24 @@ type Database struct {
 
 var DB *Database
 
+// writeTimeoutFactor is how much longer than reads writes may take; they often
+// touch several tables inside a transaction
+const writeTimeoutFactor = 3
+
+// queryTimeout bounds reads, see ReadContext
+var queryTimeout = 10 * time.Second
+
+// ReadContext derives the context a repository read runs under, bounded by
+// the configured query timeout
+func ReadContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, queryTimeout)
+}
+
+// WriteContext derives the context a repository write runs under
+func WriteContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, writeTimeoutFactor*queryTimeout)
+}
+
 func Init(cfg *config.DatabaseConfig) (*Database, error) {
 	var dialector gorm.Dialector
 	var dsn string
@@ -41,6 +65,10 @@ func Init(cfg *config.DatabaseConfig) (*Database, error) {
 		return nil, fmt.Errorf("unsupported database driver: %s", cfg.Driver)
 	}
 
+	if cfg.QueryTimeout > 0 {
+		queryTimeout = time.Duration(cfg.QueryTimeout) * time.Second
+	}
+
 	// Configure GORM logger to use our custom logger
 	gormConfig := &gorm.Config{
 		Logger: &GormLogger{},
@@ -51,6 +79,11 @@ func Init(cfg *config.DatabaseConfig) (*Database, error) {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	// Queries get a span under the span of their context
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		return nil, fmt.Errorf("failed to set up query tracing: %w", err)
+	}
+
 	// Configure connection pool
 	sqlDB, err := db.DB()
 	if err != nil {
@@ -71,9 +104,30 @@ func Init(cfg *config.DatabaseConfig) (*Database, error) {
 		"database": cfg.Database,
 	}))
 
+	// The SQL migrations target PostgreSQL; development databases on other
+	// drivers are created with Migrate instead
+	if cfg.Driver == "postgres" {
+		if err := MigrateUp(migrations.FS, postgresURL(cfg)); err != nil {
+			return nil, fmt.Errorf("failed to run migrations: %w", err)
+		}
+	}
+
 	return database, nil
 }
 
+// postgresURL is the connection URL of cfg in the form golang-migrate
+// expects
+func postgresURL(cfg *config.DatabaseConfig) string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.Username, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, cfg.Port),
+		Path:     cfg.Database,
+		RawQuery: url.Values{"sslmode": {cfg.SSLMode}}.Encode(),
+	}
+	return u.String()
+}
+
 func GetDB() *gorm.DB {
 	if DB == nil {
 		logger.Fatal("Database not initialized")
@@ -81,8 +135,29 @@ func GetDB() *gorm.DB {
 	return DB.DB
 }
 
+// sqliteDefaults translates the PostgreSQL default expressions used in the
+// model tags into SQLite equivalents
+var sqliteDefaults = map[string]string{
+	"gen_random_uuid()": "(lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || " +
+		"substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || " +
+		"substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6))))",
+	"now()": "CURRENT_TIMESTAMP",
+}
+
 func (db *Database) Migrate(models ...interface{}) error {
 	for _, model := range models {
+		if db.DB.Dialector.Name() == "sqlite" {
+			stmt := &gorm.Statement{DB: db.DB}
+			if err := stmt.Parse(model); err != nil {
+				return fmt.Errorf("failed to parse model %T: %w", model, err)
+			}
+			for _, field := range stmt.Schema.Fields {
+				if expr, ok := sqliteDefaults[field.DefaultValue]; ok {
+					field.DefaultValue = expr
+				}
+			}
+		}
+
 		if err := db.DB.AutoMigrate(model); err != nil {
 			return fmt.Errorf("failed to migrate model %T: %w", model, err)
 		}
@@ -91,6 +166,63 @@ func (db *Database) Migrate(models ...interface{}) error {
 	return nil
 }
 
+// EnsureIndex creates a named index on table if it does not exist yet. It
+// covers indexes that can't be expressed with struct tags, such as composite
+// indexes over columns of the embedded BaseModel.
+func (db *Database) EnsureIndex(table, name string, columns ...string) error {
+	if db.DB.Migrator().HasIndex(table, name) {
+		return nil
+	}
+
+	sql := fmt.Sprintf("CREATE INDEX %s ON %s (%s)", name, table, strings.Join(columns, ", "))
+	if err := db.DB.Exec(sql).Error; err != nil {
+		return fmt.Errorf("failed to create index %s: %w", name, err)
+	}
+
+	logger.Info("Database index created", logger.WithFields(map[string]interface{}{
+		"table": table,
+		"index": name,
+	}))
+	return nil
+}
+
+// DeleteDuplicates removes rows that would violate a unique index over
+// columns, keeping the oldest row of each group. Soft-deleted rows are purged
+// first since the index covers them as well.
+func (db *Database) DeleteDuplicates(table string, columns ...string) error {
+	migrator := db.DB.Migrator()
+	if !migrator.HasTable(table) {
+		return nil
+	}
+
+	if migrator.HasColumn(table, "deleted_at") {
+		if err := db.DB.Exec(fmt.Sprintf("DELETE FROM %s WHERE deleted_at IS NOT NULL", table)).Error; err != nil {
+			return fmt.Errorf("failed to purge deleted rows of %s: %w", table, err)
+		}
+	}
+
+	same := make([]string, 0, len(columns))
+	for _, column := range columns {
+		same = append(same, fmt.Sprintf("older.%[1]s = %[2]s.%[1]s", column, table))
+	}
+	sql := fmt.Sprintf(
+		"DELETE FROM %[1]s WHERE EXISTS (SELECT 1 FROM %[1]s older WHERE %[2]s AND (older.created_at < %[1]s.created_at OR (older.created_at = %[1]s.created_at AND older.id < %[1]s.id)))",
+		table, strings.Join(same, " AND "),
+	)
+	result := db.DB.Exec(sql)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete duplicates of %s: %w", table, result.Error)
+	}
+
+	if result.RowsAffected > 0 {
+		logger.Info("Duplicate rows deleted", logger.WithFields(map[string]interface{}{
+			"table": table,
+			"rows":  result.RowsAffected,
+		}))
+	}
+	return nil
+}
+
 func (db *Database) Health() error {
 	sqlDB, err := db.DB.DB()
 	if err != nil {
@@ -136,7 +268,10 @@ func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (stri
 		"sql":     sql,
 	}
 
-	if err != nil {
+	// Drivers don't all wrap the context error, so the context is checked too
+	if err != nil && (errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded)) {
+		logger.Warn("Database query timed out", logger.WithFields(fields))
+	} else if err != nil {
 		logger.Error("Database query failed", logger.WithFields(fields))
 	} else if elapsed > 200*time.Millisecond {
 		logger.Warn("Slow database query", logger.WithFields(fields))
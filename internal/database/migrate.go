@@ -0,0 +1,50 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"realtime-api/internal/logger"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// MigrateUp applies the up migrations in fsys that are newer than the
+// version of the database at databaseURL, in order, each in its own
+// transaction. It uses golang-migrate and its schema_migrations table, so
+// it and the migrate CLI of the Makefile agree on the state of a database.
+// A migration that fails leaves the database marked dirty and later runs
+// refuse to continue until the schema was repaired and the version forced
+// with `migrate force`.
+func MigrateUp(fsys fs.FS, databaseURL string) error {
+	source, err := iofs.New(fsys, ".")
+	if err != nil {
+		return fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", source, databaseURL)
+	if err != nil {
+		source.Close()
+		return fmt.Errorf("failed to prepare migrations: %w", err)
+	}
+	defer m.Close()
+
+	err = m.Up()
+	version, dirty, _ := m.Version()
+	switch {
+	case errors.Is(err, migrate.ErrNoChange):
+		logger.Info("Database schema is up to date", logger.WithField("version", version))
+		return nil
+	case err != nil && dirty:
+		return fmt.Errorf("database is dirty at migration version %d, fix it and force the version: %w", version, err)
+	case err != nil:
+		return fmt.Errorf("failed to apply migrations: %w", err)
+	}
+
+	logger.Info("Database migrations applied", logger.WithField("version", version))
+	return nil
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"realtime-api/internal/config"
+	"realtime-api/internal/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateUp(t *testing.T) {
+	logger.Init("fatal", "json", "stdout", "")
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Init(&config.DatabaseConfig{Driver: "sqlite", Database: path})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	databaseURL := "sqlite3://" + path
+
+	migrationVersion := func() (version uint64, dirty bool) {
+		row := db.DB.Raw("SELECT version, dirty FROM schema_migrations").Row()
+		require.NoError(t, row.Scan(&version, &dirty))
+		return version, dirty
+	}
+
+	fsys := fstest.MapFS{
+		"001_create_notes.up.sql":   {Data: []byte("CREATE TABLE notes (id integer PRIMARY KEY, body text);")},
+		"001_create_notes.down.sql": {Data: []byte("DROP TABLE notes;")},
+		"002_add_title.up.sql":      {Data: []byte("ALTER TABLE notes ADD COLUMN title text; CREATE INDEX idx_notes_title ON notes (title);")},
+		"002_add_title.down.sql":    {Data: []byte("DROP INDEX idx_notes_title; ALTER TABLE notes DROP COLUMN title;")},
+	}
+	require.NoError(t, MigrateUp(fsys, databaseURL))
+
+	version, dirty := migrationVersion()
+	assert.Equal(t, uint64(2), version)
+	assert.False(t, dirty)
+	assert.True(t, db.DB.Migrator().HasColumn("notes", "title"))
+	assert.True(t, db.DB.Migrator().HasIndex("notes", "idx_notes_title"))
+
+	// Applied migrations are skipped
+	require.NoError(t, MigrateUp(fsys, databaseURL))
+
+	// A failing migration is rolled back, marks the database dirty and
+	// blocks later runs
+	fsys["003_broken.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE tags (id integer PRIMARY KEY); ALTER TABLE missing ADD COLUMN x text;")}
+	assert.Error(t, MigrateUp(fsys, databaseURL))
+	version, dirty = migrationVersion()
+	assert.Equal(t, uint64(3), version)
+	assert.True(t, dirty)
+	assert.False(t, db.DB.Migrator().HasTable("tags"))
+
+	fsys["003_broken.up.sql"] = &fstest.MapFile{Data: []byte("ALTER TABLE notes ADD COLUMN x text;")}
+	assert.ErrorContains(t, MigrateUp(fsys, databaseURL), "dirty")
+}
+
+func TestMigrateUpRejectsDuplicateVersions(t *testing.T) {
+	logger.Init("fatal", "json", "stdout", "")
+
+	err := MigrateUp(fstest.MapFS{
+		"001_a.up.sql":  {},
+		"0001_b.up.sql": {},
+	}, "sqlite3://"+filepath.Join(t.TempDir(), "test.db"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,65 @@
+package email
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"realtime-api/internal/config"
+	"realtime-api/internal/logger"
+)
+
+// Sender delivers a plain text email
+type Sender interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPSender sends email through the SMTP server of an EmailConfig
+type SMTPSender struct {
+	config *config.EmailConfig
+}
+
+func NewSMTPSender(cfg *config.EmailConfig) *SMTPSender {
+	return &SMTPSender{config: cfg}
+}
+
+func (s *SMTPSender) Send(to, subject, body string) error {
+	address := net.JoinHostPort(s.config.SMTPHost, s.config.SMTPPort)
+
+	var auth smtp.Auth
+	if s.config.Username != "" {
+		auth = smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.SMTPHost)
+	}
+
+	if err := smtp.SendMail(address, auth, s.config.From, []string{to}, buildMessage(s.config.From, to, subject, body)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// LogSender writes emails to the log instead of sending them. It stands in
+// for SMTPSender in development, when email is disabled.
+type LogSender struct{}
+
+func (LogSender) Send(to, subject, body string) error {
+	logger.Info("Email not sent, email is disabled", logger.WithFields(map[string]interface{}{
+		"to":      to,
+		"subject": subject,
+		"body":    body,
+	}))
+	return nil
+}
+
+// buildMessage formats a plain text RFC 5322 message
+func buildMessage(from, to, subject, body string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
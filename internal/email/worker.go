@@ -0,0 +1,286 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+	"realtime-api/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// errWorkerStopped fails the events that arrive after Stop
+var errWorkerStopped = errors.New("email worker is stopped")
+
+// notificationEvent is the body of a rabbitmq notification event
+type notificationEvent struct {
+	UserID       uuid.UUID          `json:"user_id"`
+	Notification model.Notification `json:"notification"`
+	Timestamp    time.Time          `json:"timestamp"`
+}
+
+// digest collects the notifications of one user until it is sent
+type digest struct {
+	notifications []model.Notification
+	// done acknowledges the events of the notifications once the digest is
+	// sent
+	done  []func(err error)
+	timer *time.Timer
+	// deferred digests wait for the user's quiet hours to end; their events
+	// were acknowledged already
+	deferred bool
+}
+
+// WorkerConfig configures when a Worker sends digests
+type WorkerConfig struct {
+	// Window is how long notifications of a user are collected after the
+	// first one before they are sent together
+	Window time.Duration
+	// OfflineAfter is how long users must have been away to get emails
+	OfflineAfter time.Duration
+	// QuietHoursStart and QuietHoursEnd are the hours of the day, in the
+	// timezone of each user, digests are held back between. Equal hours turn
+	// quiet hours off.
+	QuietHoursStart int
+	QuietHoursEnd   int
+}
+
+// Worker turns the notification events of offline users into email digests.
+// Notifications for the same user are collected for a window after the first
+// one and sent together, so a busy room doesn't send an email per message.
+// Events are acknowledged once their digest is sent, so failed digests are
+// retried by rabbitmq. Digests due in the user's quiet hours are held until
+// the quiet hours end; holding their events that long would run into the
+// broker's acknowledgement timeout, so those are acknowledged right away.
+// Pending digests live in memory and are sent on Stop, quiet hours or not.
+type Worker struct {
+	userRepo repository.UserRepository
+	sender   Sender
+	config   WorkerConfig
+	now      func() time.Time
+
+	mu      sync.Mutex
+	pending map[uuid.UUID]*digest
+	wg      sync.WaitGroup
+	stopped bool
+}
+
+func NewWorker(userRepo repository.UserRepository, sender Sender, config WorkerConfig) *Worker {
+	return &Worker{
+		userRepo: userRepo,
+		sender:   sender,
+		config:   config,
+		now:      time.Now,
+		pending:  make(map[uuid.UUID]*digest),
+	}
+}
+
+// HandleMessage queues the notification of a rabbitmq notification event and
+// reports it done once its digest is sent
+func (w *Worker) HandleMessage(body []byte, done func(err error)) {
+	var event notificationEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		// Malformed events would fail the same way on every retry
+		logger.Warn("Dropping invalid notification event", logger.WithField("error", err.Error()))
+		done(nil)
+		return
+	}
+	if event.UserID == uuid.Nil {
+		done(nil)
+		return
+	}
+
+	w.add(event.UserID, event.Notification, done)
+}
+
+func (w *Worker) add(userID uuid.UUID, notification model.Notification, done func(err error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stopped {
+		// Left for rabbitmq to deliver again after the restart
+		done(errWorkerStopped)
+		return
+	}
+
+	if d, ok := w.pending[userID]; ok {
+		d.notifications = append(d.notifications, notification)
+		if d.deferred {
+			done(nil)
+		} else {
+			d.done = append(d.done, done)
+		}
+		return
+	}
+
+	w.schedule(userID, &digest{notifications: []model.Notification{notification}, done: []func(error){done}}, w.config.Window)
+}
+
+// schedule sends d after wait; w.mu must be held
+func (w *Worker) schedule(userID uuid.UUID, d *digest, wait time.Duration) {
+	w.wg.Add(1)
+	d.timer = time.AfterFunc(wait, func() {
+		defer w.wg.Done()
+		w.flush(userID)
+	})
+	w.pending[userID] = d
+}
+
+// flush sends the pending digest of a user and reports its events done
+func (w *Worker) flush(userID uuid.UUID) {
+	w.mu.Lock()
+	d, ok := w.pending[userID]
+	delete(w.pending, userID)
+	w.mu.Unlock()
+
+	if !ok || len(d.notifications) == 0 {
+		return
+	}
+
+	err := w.deliver(userID, d)
+	if err != nil {
+		logger.Error("Failed to send notification digest", logger.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"count":   len(d.notifications),
+			"error":   err.Error(),
+		}))
+	}
+	for _, done := range d.done {
+		done(err)
+	}
+}
+
+// deliver sends a digest to users who want email and are away, unless it
+// falls in their quiet hours, in which case it is deferred
+func (w *Worker) deliver(userID uuid.UUID, d *digest) error {
+	user, err := w.userRepo.GetByID(context.Background(), userID)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.Email == "" || !user.EmailNotifications {
+		return nil
+	}
+
+	now := w.now()
+	if user.LastSeen != nil && now.Sub(*user.LastSeen) < w.config.OfflineAfter {
+		return nil
+	}
+
+	if wait := w.quietHoursLeft(user, now); wait > 0 && w.postpone(userID, d, wait) {
+		return nil
+	}
+
+	subject, body := formatDigest(user, d.notifications)
+	if err := w.sender.Send(user.Email, subject, body); err != nil {
+		return err
+	}
+
+	logger.Info("Notification digest sent", logger.WithFields(map[string]interface{}{
+		"user_id": userID,
+		"count":   len(d.notifications),
+	}))
+	return nil
+}
+
+// postpone holds a digest back for wait, merging it with the notifications
+// that came in since it was taken off the pending digests. It reports false
+// once the worker is stopping and the digest should be sent now.
+func (w *Worker) postpone(userID uuid.UUID, d *digest, wait time.Duration) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stopped {
+		return false
+	}
+
+	deferred := &digest{notifications: d.notifications, deferred: true}
+	if next, ok := w.pending[userID]; ok {
+		// The events of the newer digest are acknowledged now as well
+		next.timer.Stop()
+		w.wg.Done()
+		deferred.notifications = append(deferred.notifications, next.notifications...)
+		for _, done := range next.done {
+			done(nil)
+		}
+	}
+	w.schedule(userID, deferred, wait)
+	return true
+}
+
+// quietHoursLeft returns how long the quiet hours of the user's timezone last
+// from now, zero outside of them
+func (w *Worker) quietHoursLeft(user *model.User, now time.Time) time.Duration {
+	start, end := w.config.QuietHoursStart, w.config.QuietHoursEnd
+	if start == end {
+		return 0
+	}
+
+	location, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	local := now.In(location)
+
+	hour := local.Hour()
+	quiet := hour >= start && hour < end
+	if start > end {
+		quiet = hour >= start || hour < end
+	}
+	if !quiet {
+		return 0
+	}
+
+	ends := time.Date(local.Year(), local.Month(), local.Day(), end, 0, 0, 0, location)
+	if !ends.After(local) {
+		ends = ends.AddDate(0, 0, 1)
+	}
+	return ends.Sub(local)
+}
+
+// Stop sends the pending digests right away and leaves later events to be
+// delivered again
+func (w *Worker) Stop() {
+	w.mu.Lock()
+	w.stopped = true
+	var userIDs []uuid.UUID
+	for userID, d := range w.pending {
+		if d.timer.Stop() {
+			w.wg.Done()
+			userIDs = append(userIDs, userID)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, userID := range userIDs {
+		w.flush(userID)
+	}
+	w.wg.Wait()
+}
+
+// formatDigest writes the subject and body of a digest email
+func formatDigest(user *model.User, notifications []model.Notification) (string, string) {
+	subject := notifications[0].Title
+	if len(notifications) > 1 {
+		subject = fmt.Sprintf("You have %d new notifications", len(notifications))
+	}
+
+	var b strings.Builder
+	name := user.FirstName
+	if name == "" {
+		name = user.Username
+	}
+	fmt.Fprintf(&b, "Hi %s,\n\nHere is what you missed while you were away:\n\n", name)
+	for _, notification := range notifications {
+		fmt.Fprintf(&b, "- %s: %s\n", notification.Title, notification.Message)
+	}
+	b.WriteString("\nYou can turn these emails off in your settings.\n")
+
+	return subject, b.String()
+}
@@ -0,0 +1,225 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"realtime-api/internal/config"
+	"realtime-api/internal/database"
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+	"realtime-api/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sentEmail struct {
+	to, subject, body string
+}
+
+// fakeSender records the emails instead of sending them, failing with err
+// when it is set
+type fakeSender struct {
+	mu   sync.Mutex
+	sent []sentEmail
+	err  error
+}
+
+func (s *fakeSender) Send(to, subject, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.sent = append(s.sent, sentEmail{to: to, subject: subject, body: body})
+	return nil
+}
+
+func (s *fakeSender) emails() []sentEmail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sentEmail(nil), s.sent...)
+}
+
+// acks records how the events handed to a worker were reported done
+type acks struct {
+	mu      sync.Mutex
+	results []error
+}
+
+func (a *acks) done(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.results = append(a.results, err)
+}
+
+func (a *acks) get() []error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]error(nil), a.results...)
+}
+
+func newTestUserRepository(t *testing.T) repository.UserRepository {
+	t.Helper()
+	logger.Init("fatal", "json", "stdout", "")
+
+	db, err := database.Init(&config.DatabaseConfig{
+		Driver:   "sqlite",
+		Database: filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=5000",
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	require.NoError(t, db.Migrate(&model.User{}))
+	return repository.NewUserRepository()
+}
+
+func createUser(t *testing.T, userRepo repository.UserRepository, username string, emailNotifications bool) *model.User {
+	t.Helper()
+
+	user := &model.User{Username: username, Email: username + "@example.com", Password: "hashed", FirstName: username}
+	require.NoError(t, userRepo.Create(context.Background(), user))
+	require.NoError(t, database.DB.DB.Model(user).Update("email_notifications", emailNotifications).Error)
+	return user
+}
+
+func newNotificationEvent(t *testing.T, userID uuid.UUID, title, message string) []byte {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]interface{}{
+		"user_id":      userID.String(),
+		"notification": model.Notification{UserID: userID, Title: title, Message: message},
+		"timestamp":    time.Now(),
+	})
+	require.NoError(t, err)
+	return body
+}
+
+func TestWorkerSendsOneDigestPerUser(t *testing.T) {
+	userRepo := newTestUserRepository(t)
+	alice := createUser(t, userRepo, "alice", true)
+	bob := createUser(t, userRepo, "bob", false)
+
+	sender := &fakeSender{}
+	worker := NewWorker(userRepo, sender, WorkerConfig{Window: 50 * time.Millisecond})
+	acks := &acks{}
+
+	for _, message := range []string{"hello", "are you there?", "ping"} {
+		worker.HandleMessage(newNotificationEvent(t, alice.ID, "New message", message), acks.done)
+	}
+	worker.HandleMessage(newNotificationEvent(t, bob.ID, "New message", "hi bob"), acks.done)
+	// Malformed events are dropped rather than retried
+	worker.HandleMessage([]byte("not json"), acks.done)
+	assert.Equal(t, []error{nil}, acks.get())
+
+	require.Eventually(t, func() bool { return len(acks.get()) == 5 }, time.Second, 10*time.Millisecond)
+	worker.Stop()
+
+	// Bob turned email notifications off
+	emails := sender.emails()
+	require.Len(t, emails, 1)
+	assert.Equal(t, alice.Email, emails[0].to)
+	assert.Equal(t, "You have 3 new notifications", emails[0].subject)
+	assert.Contains(t, emails[0].body, "Hi alice")
+	assert.Contains(t, emails[0].body, "- New message: are you there?")
+	assert.Equal(t, []error{nil, nil, nil, nil, nil}, acks.get())
+}
+
+func TestWorkerRetriesFailedDigests(t *testing.T) {
+	userRepo := newTestUserRepository(t)
+	alice := createUser(t, userRepo, "alice", true)
+
+	sender := &fakeSender{err: errors.New("smtp down")}
+	worker := NewWorker(userRepo, sender, WorkerConfig{Window: time.Millisecond})
+	acks := &acks{}
+
+	worker.HandleMessage(newNotificationEvent(t, alice.ID, "New message", "hello"), acks.done)
+	worker.HandleMessage(newNotificationEvent(t, alice.ID, "New message", "again"), acks.done)
+	require.Eventually(t, func() bool { return len(acks.get()) == 2 }, time.Second, 10*time.Millisecond)
+	for _, err := range acks.get() {
+		assert.ErrorIs(t, err, sender.err)
+	}
+	worker.Stop()
+}
+
+func TestWorkerSkipsUsersSeenRecently(t *testing.T) {
+	userRepo := newTestUserRepository(t)
+	alice := createUser(t, userRepo, "alice", true)
+	require.NoError(t, userRepo.UpdateLastSeen(context.Background(), alice.ID))
+
+	sender := &fakeSender{}
+	worker := NewWorker(userRepo, sender, WorkerConfig{Window: time.Millisecond, OfflineAfter: time.Hour})
+	acks := &acks{}
+
+	worker.HandleMessage(newNotificationEvent(t, alice.ID, "New message", "hello"), acks.done)
+	require.Eventually(t, func() bool { return len(acks.get()) == 1 }, time.Second, 10*time.Millisecond)
+	worker.Stop()
+
+	assert.Equal(t, []error{nil}, acks.get())
+	assert.Empty(t, sender.emails())
+}
+
+func TestWorkerHoldsDigestsInQuietHours(t *testing.T) {
+	userRepo := newTestUserRepository(t)
+	alice := createUser(t, userRepo, "alice", true)
+	bob := createUser(t, userRepo, "bob", true)
+	// 23:30 UTC is 08:30 in Tokyo, after bob's quiet hours
+	require.NoError(t, database.DB.DB.Model(bob).Update("timezone", "Asia/Tokyo").Error)
+
+	sender := &fakeSender{}
+	worker := NewWorker(userRepo, sender, WorkerConfig{Window: time.Millisecond, QuietHoursStart: 22, QuietHoursEnd: 7})
+	worker.now = func() time.Time { return time.Date(2024, 5, 1, 23, 30, 0, 0, time.UTC) }
+	acks := &acks{}
+
+	worker.HandleMessage(newNotificationEvent(t, alice.ID, "New message", "hello"), acks.done)
+	worker.HandleMessage(newNotificationEvent(t, bob.ID, "New message", "hello"), acks.done)
+	require.Eventually(t, func() bool { return len(acks.get()) == 2 }, time.Second, 10*time.Millisecond)
+
+	emails := sender.emails()
+	require.Len(t, emails, 1)
+	assert.Equal(t, bob.Email, emails[0].to)
+
+	// Alice's digest waits for 07:00, with what comes in meanwhile
+	assert.Equal(t, 7*time.Hour+30*time.Minute, worker.quietHoursLeft(alice, worker.now()))
+	worker.HandleMessage(newNotificationEvent(t, alice.ID, "New message", "still there?"), acks.done)
+	assert.Len(t, acks.get(), 3)
+	assert.Len(t, sender.emails(), 1)
+
+	worker.Stop()
+	emails = sender.emails()
+	require.Len(t, emails, 2)
+	assert.Equal(t, alice.Email, emails[1].to)
+	assert.Equal(t, "You have 2 new notifications", emails[1].subject)
+	assert.Equal(t, []error{nil, nil, nil}, acks.get())
+}
+
+func TestWorkerStopSendsPendingDigests(t *testing.T) {
+	userRepo := newTestUserRepository(t)
+	alice := createUser(t, userRepo, "alice", true)
+
+	sender := &fakeSender{}
+	worker := NewWorker(userRepo, sender, WorkerConfig{Window: time.Hour})
+	acks := &acks{}
+
+	worker.HandleMessage(newNotificationEvent(t, alice.ID, "New message", "hello"), acks.done)
+	assert.Empty(t, sender.emails())
+	assert.Empty(t, acks.get())
+
+	worker.Stop()
+	emails := sender.emails()
+	require.Len(t, emails, 1)
+	assert.Equal(t, "New message", emails[0].subject)
+	assert.Equal(t, []error{nil}, acks.get())
+
+	// Events after Stop are left for redelivery
+	worker.HandleMessage(newNotificationEvent(t, alice.ID, "New message", "too late"), acks.done)
+	assert.Len(t, sender.emails(), 1)
+	assert.ErrorIs(t, acks.get()[1], errWorkerStopped)
+}
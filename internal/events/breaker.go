@@ -0,0 +1,88 @@
+package events
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// Publishing stops for publishCooldown after publishFailureThreshold
+// consecutive failures to publish to Redis
+const (
+	publishFailureThreshold = 5
+	publishCooldown         = 30 * time.Second
+)
+
+// circuitBreaker stops calls to a failing dependency. After threshold
+// consecutive failures it opens and refuses calls for cooldown, then lets a
+// single probe through: the circuit closes if it succeeds and opens again if
+// it fails.
+type circuitBreaker struct {
+	threshold int64
+	cooldown  time.Duration
+	now       func() time.Time
+
+	failures atomic.Int64
+	// openedAt is when the circuit opened, in Unix nanoseconds, zero while
+	// closed
+	openedAt atomic.Int64
+	probing  atomic.Bool
+}
+
+func newCircuitBreaker(threshold int64, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// publishBreaker guards the Redis publishes of every EventPublisher, as they
+// share one Redis
+var publishBreaker = newCircuitBreaker(publishFailureThreshold, publishCooldown)
+
+// allow reports whether a call may go through. Once the cooldown is over only
+// the first caller is let through, as the probe.
+func (b *circuitBreaker) allow() bool {
+	switch b.state() {
+	case CircuitClosed:
+		return true
+	case CircuitOpen:
+		return false
+	default:
+		return b.probing.CompareAndSwap(false, true)
+	}
+}
+
+func (b *circuitBreaker) state() string {
+	openedAt := b.openedAt.Load()
+	switch {
+	case openedAt == 0:
+		return CircuitClosed
+	case b.now().Sub(time.Unix(0, openedAt)) < b.cooldown:
+		return CircuitOpen
+	default:
+		return CircuitHalfOpen
+	}
+}
+
+// success closes the circuit
+func (b *circuitBreaker) success() {
+	b.failures.Store(0)
+	b.openedAt.Store(0)
+	b.probing.Store(false)
+}
+
+// failure counts a failed call, reporting whether it opened the circuit
+func (b *circuitBreaker) failure() bool {
+	if b.probing.CompareAndSwap(true, false) {
+		b.openedAt.Store(b.now().UnixNano())
+		return true
+	}
+	if b.failures.Add(1) >= b.threshold {
+		return b.openedAt.CompareAndSwap(0, b.now().UnixNano())
+	}
+	return false
+}
@@ -4,8 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
+	"realtime-api/internal/config"
+	"realtime-api/internal/health"
+	"realtime-api/internal/logger"
 	"realtime-api/internal/redis"
 
 	"github.com/google/uuid"
@@ -21,27 +25,39 @@ const (
 
 // User events
 const (
-	UserOnline        = "event.user.online"
-	UserOffline       = "event.user.offline"
-	UserTypingStart   = "event.user.typing.start"
-	UserTypingStop    = "event.user.typing.stop"
-	UserStatusChange  = "event.user.status.change"
-	UserProfileUpdate = "event.user.profile.update"
+	UserOnline          = "event.user.online"
+	UserOffline         = "event.user.offline"
+	UserTypingStart     = "event.user.typing.start"
+	UserTypingStop      = "event.user.typing.stop"
+	UserStatusChange    = "event.user.status.change"
+	UserProfileUpdate   = "event.user.profile.update"
+	UserContactRequest  = "event.user.contact.request"
+	UserContactAccepted = "event.user.contact.accepted"
 )
 
 // Room events
 const (
-	RoomCreate           = "event.room.create"
-	RoomUpdate           = "event.room.update"
-	RoomDelete           = "event.room.delete"
-	RoomJoin             = "event.room.join"
-	RoomLeave            = "event.room.leave"
-	RoomMemberAdd        = "event.room.member.add"
-	RoomMemberRemove     = "event.room.member.remove"
-	RoomMemberRoleUpdate = "event.room.member.role.update"
-	RoomInviteCreate     = "event.room.invite.create"
-	RoomInviteAccept     = "event.room.invite.accept"
-	RoomInviteReject     = "event.room.invite.reject"
+	RoomCreate             = "event.room.create"
+	RoomUpdate             = "event.room.update"
+	RoomSettingsUpdate     = "event.room.settings.update"
+	RoomDelete             = "event.room.delete"
+	RoomJoin               = "event.room.join"
+	RoomLeave              = "event.room.leave"
+	RoomMemberAdd          = "event.room.member.add"
+	RoomMemberRemove       = "event.room.member.remove"
+	RoomMemberRoleUpdate   = "event.room.member.role.update"
+	RoomOwnershipTransfer  = "event.room.ownership.transfer"
+	RoomMemberMuteUpdate   = "event.room.member.mute.update"
+	RoomMemberBan          = "event.room.member.ban"
+	RoomMemberUnban        = "event.room.member.unban"
+	RoomInviteCreate       = "event.room.invite.create"
+	RoomInviteAccept       = "event.room.invite.accept"
+	RoomInviteReject       = "event.room.invite.reject"
+	RoomJoinRequestApprove = "event.room.join.request.approve"
+	RoomJoinRequestReject  = "event.room.join.request.reject"
+	RoomMessagePin         = "event.room.message.pin"
+	RoomMessageUnpin       = "event.room.message.unpin"
+	RoomMessagesExpire     = "event.room.messages.expire"
 )
 
 // Message events
@@ -61,6 +77,20 @@ const (
 	SystemBroadcast   = "event.system.broadcast"
 )
 
+// Room event history kept for clients replaying what they missed while
+// disconnected
+const (
+	roomHistorySize = 500
+	roomHistoryTTL  = 24 * time.Hour
+)
+
+// Event history kept per channel for monitoring. Channels idle for a week
+// are dropped, so the histories of users who left don't pile up.
+const (
+	defaultHistorySize = 1000
+	historyTTL         = 7 * 24 * time.Hour
+)
+
 // Event represents a structured event with metadata
 type Event struct {
 	ID        string                 `json:"id"`
@@ -246,7 +276,92 @@ func (ep *EventPublisher) publishEvent(ctx context.Context, channel string, even
 		return fmt.Errorf("failed to marshal event: %w", err)
 	}
 
-	return ep.redis.PublishRoomMessage(ctx, channel, string(eventData))
+	// While Redis is failing events are dropped rather than failing every
+	// caller
+	if !publishBreaker.allow() {
+		health.EventsDropped.Inc()
+		countDropped(event.Type)
+		return nil
+	}
+
+	start := time.Now()
+	if err := ep.redis.PublishRoomMessage(ctx, channel, string(eventData)); err != nil {
+		if publishBreaker.failure() {
+			logger.Error("Publishing events suspended after Redis failures", logger.WithFields(map[string]interface{}{
+				"cooldown": publishCooldown.String(),
+				"error":    err.Error(),
+			}))
+		}
+		return err
+	}
+	publishBreaker.success()
+	health.RedisPublishDuration.Observe(time.Since(start).Seconds())
+
+	if event.Type != UserTypingStart && event.Type != UserTypingStop {
+		if err := ep.redis.AddChannelEvent(ctx, channel, event.Timestamp, string(eventData), historySize(), historyTTL); err != nil {
+			logger.Warn("Failed to record event history", logger.WithFields(map[string]interface{}{
+				"event_id": event.ID,
+				"channel":  channel,
+				"error":    err.Error(),
+			}))
+		}
+	}
+
+	if isRoomHistoryEvent(channel, event) {
+		if err := ep.redis.AddRoomEvent(ctx, event.RoomID.String(), event.ID, event.Timestamp, string(eventData), roomHistorySize, roomHistoryTTL); err != nil {
+			logger.Warn("Failed to record room event history", logger.WithFields(map[string]interface{}{
+				"event_id": event.ID,
+				"room_id":  event.RoomID.String(),
+				"error":    err.Error(),
+			}))
+		}
+	}
+
+	health.EventsPublished.WithLabelValues(event.Type).Inc()
+	countPublished(event.Type)
+	return nil
+}
+
+// History returns the events published to channel at or after since, newest
+// first, only those of eventType when it is set. A limit of zero returns all
+// of them.
+func (ep *EventPublisher) History(ctx context.Context, channel, eventType string, since time.Time, limit int) ([]Event, error) {
+	entries, err := ep.redis.GetChannelEvents(ctx, channel, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event history: %w", err)
+	}
+
+	history := make([]Event, 0, len(entries))
+	for _, entry := range entries {
+		var event Event
+		if err := json.Unmarshal([]byte(entry), &event); err != nil {
+			continue
+		}
+		if eventType != "" && event.Type != eventType {
+			continue
+		}
+		history = append(history, event)
+		if limit > 0 && len(history) == limit {
+			break
+		}
+	}
+	return history, nil
+}
+
+func historySize() int64 {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Events.HistorySize > 0 {
+		return int64(cfg.Events.HistorySize)
+	}
+	return defaultHistorySize
+}
+
+// isRoomHistoryEvent reports whether an event is kept for replay. Typing
+// indicators are transient and not worth replaying.
+func isRoomHistoryEvent(channel string, event *Event) bool {
+	if event.RoomID == nil || !strings.HasPrefix(channel, "room:") {
+		return false
+	}
+	return event.Type != UserTypingStart && event.Type != UserTypingStop
 }
 
 // extractLevel extracts level from event type (event.level.action)
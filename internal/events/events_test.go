@@ -0,0 +1,162 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"realtime-api/internal/logger"
+	"realtime-api/internal/redis"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/rueidis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init("fatal", "json", "stdout", "")
+	os.Exit(m.Run())
+}
+
+func newTestRedis(t *testing.T) *redis.Redis {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client, err := rueidis.NewClient(rueidis.ClientOption{
+		InitAddress:  []string{server.Addr()},
+		DisableCache: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	return redis.New(client)
+}
+
+func TestEventHistory(t *testing.T) {
+	publisher := NewEventPublisher(newTestRedis(t))
+	ctx := context.Background()
+	roomID, userID := uuid.New(), uuid.New()
+	channel := "room:" + roomID.String()
+
+	start := time.Now()
+	require.NoError(t, publisher.PublishRoomEvent(ctx, RoomJoin, roomID, nil, &userID))
+	require.NoError(t, publisher.PublishTypingEvent(ctx, roomID, userID, true))
+	time.Sleep(2 * time.Millisecond)
+	since := time.Now()
+	require.NoError(t, publisher.PublishMessageEvent(ctx, MessageSend, roomID, uuid.New(), nil, &userID))
+	require.NoError(t, publisher.PublishMessageEvent(ctx, MessageSend, roomID, uuid.New(), nil, &userID))
+
+	// Typing indicators are not recorded, the newest event comes first
+	history, err := publisher.History(ctx, channel, "", start, 0)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, []string{MessageSend, MessageSend, RoomJoin}, []string{history[0].Type, history[1].Type, history[2].Type})
+
+	history, err = publisher.History(ctx, channel, RoomJoin, time.Time{}, 0)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, roomID, *history[0].RoomID)
+
+	history, err = publisher.History(ctx, channel, "", since, 0)
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	history, err = publisher.History(ctx, channel, "", time.Time{}, 1)
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+
+	history, err = publisher.History(ctx, "room:"+uuid.NewString(), "", time.Time{}, 0)
+	require.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func TestEventMetrics(t *testing.T) {
+	publisher := NewEventPublisher(newTestRedis(t))
+	ctx := context.Background()
+	eventType := "event.system.test." + uuid.NewString()
+	before := Metrics()
+
+	failed := errors.New("failed")
+	router := NewEventRouter()
+	router.Register(eventType, func(event *Event) error {
+		if event.Data["fail"] == true {
+			return failed
+		}
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, publisher.PublishSystemEvent(ctx, eventType, nil))
+			router.Route(&Event{Type: eventType, Data: map[string]interface{}{"fail": i%5 == 0}})
+		}()
+	}
+	wg.Wait()
+
+	after := Metrics()
+	assert.Equal(t, EventCounts{Published: 10, Consumed: 10, Errored: 2}, after.ByType[eventType])
+	assert.GreaterOrEqual(t, after.Published-before.Published, int64(10))
+	assert.GreaterOrEqual(t, after.Errored-before.Errored, int64(2))
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	breaker := newCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	assert.True(t, breaker.allow())
+	assert.False(t, breaker.failure())
+	breaker.success()
+
+	// Only consecutive failures open the circuit
+	assert.False(t, breaker.failure())
+	assert.True(t, breaker.failure())
+	assert.Equal(t, CircuitOpen, breaker.state())
+	assert.False(t, breaker.allow())
+
+	// After the cooldown a single probe goes through, reopening on failure
+	now = now.Add(time.Minute)
+	assert.Equal(t, CircuitHalfOpen, breaker.state())
+	assert.True(t, breaker.allow())
+	assert.False(t, breaker.allow())
+	assert.True(t, breaker.failure())
+	assert.Equal(t, CircuitOpen, breaker.state())
+
+	now = now.Add(time.Minute)
+	assert.True(t, breaker.allow())
+	breaker.success()
+	assert.Equal(t, CircuitClosed, breaker.state())
+	assert.True(t, breaker.allow())
+}
+
+func TestPublishingStopsWhileRedisFails(t *testing.T) {
+	server := miniredis.RunT(t)
+	client, err := rueidis.NewClient(rueidis.ClientOption{
+		InitAddress:  []string{server.Addr()},
+		DisableCache: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	t.Cleanup(publishBreaker.success)
+
+	publisher := NewEventPublisher(redis.New(client))
+	ctx := context.Background()
+	eventType := "event.system.test." + uuid.NewString()
+	server.SetError("LOADING Redis is loading the dataset in memory")
+
+	for i := 0; i < publishFailureThreshold; i++ {
+		assert.Error(t, publisher.PublishSystemEvent(ctx, eventType, nil))
+	}
+	assert.Equal(t, CircuitOpen, Metrics().CircuitState)
+
+	// Events are dropped without reaching Redis
+	assert.NoError(t, publisher.PublishSystemEvent(ctx, eventType, nil))
+	assert.Equal(t, EventCounts{Dropped: 1}, Metrics().ByType[eventType])
+}
@@ -0,0 +1,91 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// eventCounters counts the events of one type, or of all types
+type eventCounters struct {
+	published atomic.Int64
+	consumed  atomic.Int64
+	errored   atomic.Int64
+	dropped   atomic.Int64
+}
+
+// EventCounts is a snapshot of eventCounters
+type EventCounts struct {
+	Published int64 `json:"published"`
+	Consumed  int64 `json:"consumed"`
+	Errored   int64 `json:"errored"`
+	// Dropped counts the events not published while the circuit was open
+	Dropped int64 `json:"dropped"`
+}
+
+func (c *eventCounters) snapshot() EventCounts {
+	return EventCounts{
+		Published: c.published.Load(),
+		Consumed:  c.consumed.Load(),
+		Errored:   c.errored.Load(),
+		Dropped:   c.dropped.Load(),
+	}
+}
+
+// MetricsSnapshot holds the event counts of this process since it started
+type MetricsSnapshot struct {
+	EventCounts
+	ByType map[string]EventCounts `json:"by_type"`
+	// CircuitState is the state of the circuit breaker of publishing
+	CircuitState string `json:"circuit_state"`
+}
+
+// metrics counts the events published by every EventPublisher and routed by
+// every EventRouter of the process. Counting is lock free once an event type
+// has been seen.
+var metrics struct {
+	total  eventCounters
+	byType sync.Map // event type -> *eventCounters
+}
+
+func countersFor(eventType string) *eventCounters {
+	if counters, ok := metrics.byType.Load(eventType); ok {
+		return counters.(*eventCounters)
+	}
+	counters, _ := metrics.byType.LoadOrStore(eventType, &eventCounters{})
+	return counters.(*eventCounters)
+}
+
+func countPublished(eventType string) {
+	metrics.total.published.Add(1)
+	countersFor(eventType).published.Add(1)
+}
+
+func countDropped(eventType string) {
+	metrics.total.dropped.Add(1)
+	countersFor(eventType).dropped.Add(1)
+}
+
+// countConsumed counts a routed event, as errored when its handling failed
+func countConsumed(eventType string, err error) {
+	counters := countersFor(eventType)
+	metrics.total.consumed.Add(1)
+	counters.consumed.Add(1)
+	if err != nil {
+		metrics.total.errored.Add(1)
+		counters.errored.Add(1)
+	}
+}
+
+// Metrics returns the counts of the events published and routed so far
+func Metrics() MetricsSnapshot {
+	snapshot := MetricsSnapshot{
+		EventCounts:  metrics.total.snapshot(),
+		ByType:       make(map[string]EventCounts),
+		CircuitState: publishBreaker.state(),
+	}
+	metrics.byType.Range(func(eventType, counters interface{}) bool {
+		snapshot.ByType[eventType.(string)] = counters.(*eventCounters).snapshot()
+		return true
+	})
+	return snapshot
+}
@@ -3,9 +3,15 @@ package events
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"time"
 
+	"realtime-api/internal/health"
+	"realtime-api/internal/logger"
 	"realtime-api/internal/redis"
 
 	"github.com/redis/rueidis"
@@ -26,34 +32,152 @@ func NewEventSubscriber(redis *redis.Redis) *EventSubscriber {
 // EventHandler is a function type for handling events
 type EventHandler func(event *Event) error
 
-// EventRouter routes events to appropriate handlers
+// EventMiddleware wraps the handling of an event. It calls next to pass the
+// event on, or returns without calling it to drop the event.
+type EventMiddleware func(event *Event, next EventHandler) error
+
+// EventRouter routes events to appropriate handlers. Handlers are registered
+// for an exact event type or for a prefix pattern ending in "*", such as
+// "event.message.*"; the pattern "*" matches every event.
 type EventRouter struct {
-	handlers map[string]EventHandler
+	handlers       map[string]EventHandler
+	prefixHandlers map[string]EventHandler
+	// prefixes lists the keys of prefixHandlers, longest first
+	prefixes   []string
+	observers  []EventHandler
+	middleware []EventMiddleware
 }
 
 // NewEventRouter creates a new event router
 func NewEventRouter() *EventRouter {
 	return &EventRouter{
-		handlers: make(map[string]EventHandler),
+		handlers:       make(map[string]EventHandler),
+		prefixHandlers: make(map[string]EventHandler),
 	}
 }
 
-// Register registers an event handler for a specific event type
+// Register registers an event handler for an event type or, when eventType
+// ends in "*", for every event type starting with what precedes it.
+// Registering the same type or pattern again replaces its handler.
 func (er *EventRouter) Register(eventType string, handler EventHandler) {
-	er.handlers[eventType] = handler
+	prefix, ok := strings.CutSuffix(eventType, "*")
+	if !ok {
+		er.handlers[eventType] = handler
+		return
+	}
+
+	if _, exists := er.prefixHandlers[prefix]; !exists {
+		er.prefixes = append(er.prefixes, prefix)
+		sort.SliceStable(er.prefixes, func(i, j int) bool {
+			return len(er.prefixes[i]) > len(er.prefixes[j])
+		})
+	}
+	er.prefixHandlers[prefix] = handler
 }
 
-// Route routes an event to the appropriate handler
+// HandlerCount returns the number of registered event types and patterns
+func (er *EventRouter) HandlerCount() int {
+	return len(er.handlers) + len(er.prefixHandlers)
+}
+
+// Observe registers a handler called for every routed event, before the
+// handler of its type
+func (er *EventRouter) Observe(handler EventHandler) {
+	er.observers = append(er.observers, handler)
+}
+
+// Use adds middleware wrapping the handling of every routed event, observers
+// included. Middleware runs in the order it was added, the first outermost.
+func (er *EventRouter) Use(middleware ...EventMiddleware) {
+	er.middleware = append(er.middleware, middleware...)
+}
+
+// Route passes an event through the middleware, then to every matching
+// handler: the handler of its exact type first, then prefix handlers from the
+// most to the least specific. All matching handlers run; their errors are
+// joined. Every routed event is counted in Metrics.
 func (er *EventRouter) Route(event *Event) error {
+	next := er.dispatch
+	for i := len(er.middleware) - 1; i >= 0; i-- {
+		middleware, handler := er.middleware[i], next
+		next = func(event *Event) error {
+			return middleware(event, handler)
+		}
+	}
+	err := next(event)
+	countConsumed(event.Type, err)
+	return err
+}
+
+// dispatch calls the observers and handlers matching an event
+func (er *EventRouter) dispatch(event *Event) error {
+	for _, observe := range er.observers {
+		if err := observe(event); err != nil {
+			log.Printf("Error observing event %s: %v", event.Type, err)
+		}
+	}
+
+	var errs []error
+	handled := false
 	if handler, exists := er.handlers[event.Type]; exists {
-		return handler(event)
+		handled = true
+		if err := handler(event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, prefix := range er.prefixes {
+		if !strings.HasPrefix(event.Type, prefix) {
+			continue
+		}
+		handled = true
+		if err := er.prefixHandlers[prefix](event); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	// Log unhandled events for debugging
-	log.Printf("Unhandled event type: %s", event.Type)
+	if !handled {
+		// Log unhandled events for debugging
+		log.Printf("Unhandled event type: %s", event.Type)
+	}
+	return errors.Join(errs...)
+}
+
+// EventLoggingMiddleware logs how long handling each event took and whether
+// its handlers failed
+func EventLoggingMiddleware(event *Event, next EventHandler) error {
+	start := time.Now()
+	err := next(event)
+
+	fields := map[string]interface{}{
+		"event_id":    event.ID,
+		"event_type":  event.Type,
+		"duration_ms": time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+		logger.Warn("Event handling failed", logger.WithFields(fields))
+		return err
+	}
+	logger.Debug("Event handled", logger.WithFields(fields))
 	return nil
 }
 
+// EventMetricsMiddleware counts the handled events and times their handling,
+// by event type
+func EventMetricsMiddleware(event *Event, next EventHandler) error {
+	start := time.Now()
+	err := next(event)
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	health.EventsHandled.WithLabelValues(event.Type, status).Inc()
+	health.EventHandlingDuration.WithLabelValues(event.Type).Observe(time.Since(start).Seconds())
+	return err
+}
+
 // SubscribeToChannel subscribes to a specific Redis channel
 func (es *EventSubscriber) SubscribeToChannel(ctx context.Context, channel string, router *EventRouter) error {
 	// Subscribe to channel using Redis Subscribe method
@@ -0,0 +1,106 @@
+package events
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventRouterPrefixHandlers(t *testing.T) {
+	router := NewEventRouter()
+
+	var calls []string
+	record := func(name string) EventHandler {
+		return func(event *Event) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+
+	router.Register("*", record("all"))
+	router.Register("event.message.*", record("message"))
+	router.Register("event.message.reaction.*", record("reaction"))
+	router.Register(MessageSend, record("sent"))
+	router.Register(MessageSend, record("sent"))
+	assert.Equal(t, 4, router.HandlerCount())
+
+	tests := []struct {
+		eventType string
+		want      []string
+	}{
+		{MessageSend, []string{"sent", "message", "all"}},
+		{MessageReactionAdd, []string{"reaction", "message", "all"}},
+		{MessageDelete, []string{"message", "all"}},
+		{RoomCreate, []string{"all"}},
+	}
+
+	for _, tt := range tests {
+		calls = nil
+		assert.NoError(t, router.Route(&Event{Type: tt.eventType}))
+		assert.Equal(t, tt.want, calls, tt.eventType)
+	}
+
+	// Registering a pattern again replaces its handler
+	router.Register("event.message.*", record("message again"))
+	calls = nil
+	assert.NoError(t, router.Route(&Event{Type: MessageDelete}))
+	assert.Equal(t, []string{"message again", "all"}, calls)
+}
+
+func TestEventRouterJoinsHandlerErrors(t *testing.T) {
+	router := NewEventRouter()
+
+	failed := errors.New("failed")
+	audited := false
+	router.Register(MessageSend, func(event *Event) error { return failed })
+	router.Register("*", func(event *Event) error {
+		audited = true
+		return nil
+	})
+
+	// A failing handler doesn't keep the others from running
+	assert.ErrorIs(t, router.Route(&Event{Type: MessageSend}), failed)
+	assert.True(t, audited)
+}
+
+func TestEventRouterMiddleware(t *testing.T) {
+	router := NewEventRouter()
+
+	var calls []string
+	trace := func(name string) EventMiddleware {
+		return func(event *Event, next EventHandler) error {
+			calls = append(calls, name+" before")
+			err := next(event)
+			calls = append(calls, name+" after")
+			return err
+		}
+	}
+	dropTyping := func(event *Event, next EventHandler) error {
+		if event.Type == UserTypingStart {
+			return nil
+		}
+		return next(event)
+	}
+
+	failed := errors.New("failed")
+	router.Use(trace("outer"), trace("inner"))
+	router.Use(dropTyping, EventLoggingMiddleware, EventMetricsMiddleware)
+	router.Observe(func(event *Event) error {
+		calls = append(calls, "observer")
+		return nil
+	})
+	router.Register("*", func(event *Event) error {
+		calls = append(calls, "handler")
+		return failed
+	})
+
+	// The handler error is passed back through every middleware
+	assert.ErrorIs(t, router.Route(&Event{Type: MessageSend}), failed)
+	assert.Equal(t, []string{"outer before", "inner before", "observer", "handler", "inner after", "outer after"}, calls)
+
+	// Middleware not calling next drops the event
+	calls = nil
+	assert.NoError(t, router.Route(&Event{Type: UserTypingStart}))
+	assert.Equal(t, []string{"outer before", "inner before", "inner after", "outer after"}, calls)
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+	"realtime-api/internal/service"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type ActivityHandler struct {
+	activityService service.ActivityService
+}
+
+func NewActivityHandler(activityService service.ActivityService) *ActivityHandler {
+	return &ActivityHandler{
+		activityService: activityService,
+	}
+}
+
+// GetUserActivity returns the activity log of a user, newest first, for
+// admins. ?type= filters by activity type.
+func (h *ActivityHandler) GetUserActivity(c echo.Context) error {
+	adminID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid user ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	page := 1
+	limit := 20
+
+	if pageParam := c.QueryParam("page"); pageParam != "" {
+		if p, err := strconv.Atoi(pageParam); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	if limitParam := c.QueryParam("limit"); limitParam != "" {
+		if l, err := strconv.Atoi(limitParam); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	logs, meta, err := h.activityService.GetUserActivity(c.Request().Context(), adminID, userID, c.QueryParam("type"), page, limit)
+	if err != nil {
+		logger.Error("Failed to get user activity", logger.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to get user activity",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.PaginatedResponse{
+		APIResponse: model.APIResponse{
+			Success: true,
+			Message: "User activity retrieved successfully",
+			Data:    logs,
+		},
+		Meta: *meta,
+	})
+}
@@ -2,11 +2,15 @@ package handler
 
 import (
 	"net/http"
+	"strconv"
+	"time"
 
 	"realtime-api/internal/events"
+	"realtime-api/internal/health"
 	"realtime-api/internal/logger"
 	"realtime-api/internal/model"
 	"realtime-api/internal/redis"
+	"realtime-api/internal/websocket"
 
 	"github.com/labstack/echo/v4"
 )
@@ -156,16 +160,30 @@ func registerEventHandlers(router *events.EventRouter) {
 	})
 }
 
-// GetEventMetrics returns event system metrics
+// GetEventMetrics returns the counts of the events published and handled by
+// this server, its connections and its uptime
 func (h *EventHandler) GetEventMetrics(c echo.Context) error {
-	// Get basic system metrics
+	counts := events.Metrics()
 	metrics := map[string]interface{}{
-		"events_published":      0,  // TODO: Implement event counting
-		"events_consumed":       0,  // TODO: Implement event counting
-		"active_handlers":       16, // We have 16 registered handlers
-		"websocket_connections": 0,  // TODO: Get from WebSocket hub
-		"system_status":         "healthy",
-		"uptime_seconds":        0, // TODO: Implement uptime tracking
+		"events_published": counts.Published,
+		"events_consumed":  counts.Consumed,
+		"events_errored":   counts.Errored,
+		"events_dropped":   counts.Dropped,
+		"events_by_type":   counts.ByType,
+		"publish_circuit":  counts.CircuitState,
+		"system_status":    "healthy",
+		"uptime_seconds":   int64(health.Uptime().Seconds()),
+	}
+	if counts.CircuitState != events.CircuitClosed {
+		metrics["system_status"] = "degraded"
+	}
+
+	if hub := websocket.GetHub(); hub != nil {
+		stats := hub.Stats()
+		metrics["websocket_connections"] = stats.Connections
+		metrics["sse_connections"] = stats.SSEConnections
+		metrics["room_clients"] = stats.RoomClients
+		metrics["max_connections_per_user"] = hub.MaxConnectionsPerUser()
 	}
 
 	return c.JSON(http.StatusOK, model.APIResponse{
@@ -186,16 +204,20 @@ func (h *EventHandler) PublishSystemEvent(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid request body",
-			Error:   err.Error(),
+			Error:   errorResponse(http.StatusBadRequest, err),
 		})
 	}
 
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
 	if err := h.eventPublisher.PublishSystemEvent(c.Request().Context(), req.Type, req.Data); err != nil {
 		logger.Error("Failed to publish system event", logger.WithField("error", err.Error()))
 		return c.JSON(http.StatusInternalServerError, model.APIResponse{
 			Success: false,
 			Message: "Failed to publish event",
-			Error:   err.Error(),
+			Error:   errorResponse(http.StatusInternalServerError, err),
 		})
 	}
 
@@ -205,25 +227,51 @@ func (h *EventHandler) PublishSystemEvent(c echo.Context) error {
 	})
 }
 
-// GetEventHistory returns recent event history (for debugging/monitoring)
+const (
+	defaultEventHistoryLimit = 100
+	maxEventHistoryLimit     = 1000
+)
+
+// GetEventHistory returns the events recently published to a channel, newest
+// first, optionally only those of a type or published since a time
 func (h *EventHandler) GetEventHistory(c echo.Context) error {
-	// Basic event history implementation
-	// In a production system, this would query a dedicated event store
-	history := []map[string]interface{}{
-		{
-			"event_id":  "sample-event-1",
-			"type":      "event.system.status",
-			"timestamp": "2024-01-01T12:00:00Z",
-			"level":     "system",
-			"message":   "System started successfully",
-		},
-		{
-			"event_id":  "sample-event-2",
-			"type":      "event.user.online",
-			"timestamp": "2024-01-01T12:01:00Z",
-			"level":     "user",
-			"message":   "User came online",
-		},
+	channel := c.QueryParam("channel")
+	if channel == "" {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "channel parameter is required",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidRequest, "channel is required"),
+		})
+	}
+
+	var since time.Time
+	if sinceParam := c.QueryParam("since"); sinceParam != "" {
+		parsed, err := time.Parse(time.RFC3339, sinceParam)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, model.APIResponse{
+				Success: false,
+				Message: "Invalid since parameter",
+				Error:   errorResponse(http.StatusBadRequest, err),
+			})
+		}
+		since = parsed
+	}
+
+	limit := defaultEventHistoryLimit
+	if limitParam := c.QueryParam("limit"); limitParam != "" {
+		if l, err := strconv.Atoi(limitParam); err == nil && l > 0 {
+			limit = min(l, maxEventHistoryLimit)
+		}
+	}
+
+	history, err := h.eventPublisher.History(c.Request().Context(), channel, c.QueryParam("type"), since, limit)
+	if err != nil {
+		logger.Error("Failed to get event history", logger.WithField("error", err.Error()))
+		return c.JSON(http.StatusInternalServerError, model.APIResponse{
+			Success: false,
+			Message: "Failed to get event history",
+			Error:   errorResponse(http.StatusInternalServerError, err),
+		})
 	}
 
 	return c.JSON(http.StatusOK, model.APIResponse{
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+	"realtime-api/internal/service"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type FileHandler struct {
+	fileService service.FileService
+}
+
+func NewFileHandler(fileService service.FileService) *FileHandler {
+	return &FileHandler{
+		fileService: fileService,
+	}
+}
+
+// UploadFile stores the multipart "file" field. Uploads are temporary unless
+// is_temporary=false is sent along.
+func (h *FileHandler) UploadFile(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "A file is required",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	temporary := true
+	if value := c.FormValue("is_temporary"); value != "" {
+		temporary, err = strconv.ParseBool(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, model.APIResponse{
+				Success: false,
+				Message: "is_temporary must be true or false",
+				Error:   errorResponse(http.StatusBadRequest, err),
+			})
+		}
+	}
+
+	upload, err := h.fileService.UploadFile(c.Request().Context(), userID, file, temporary)
+	if err != nil {
+		logger.Error("Failed to upload file", logger.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to upload file",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusCreated, model.APIResponse{
+		Success: true,
+		Message: "File uploaded successfully",
+		Data:    upload,
+	})
+}
+
+// GetFile returns the metadata of an upload
+func (h *FileHandler) GetFile(c echo.Context) error {
+	if _, httpErr := RequireAuth(c); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid file ID",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, "Invalid file ID format"),
+		})
+	}
+
+	upload, err := h.fileService.GetFile(c.Request().Context(), fileID)
+	if err != nil {
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to get file",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "File retrieved successfully",
+		Data:    upload,
+	})
+}
@@ -1,8 +1,14 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
 	"realtime-api/internal/logger"
 	"realtime-api/internal/model"
@@ -28,22 +34,56 @@ func (h *MessageHandler) SendMessage(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid request body",
-			Error:   err.Error(),
+			Error:   errorResponse(http.StatusBadRequest, err),
 		})
 	}
 
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
 	userID, httpErr := RequireAuth(c)
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
+	// Messages for later are held back until the dispatcher sends them
+	if req.ScheduledAt != nil && req.ScheduledAt.After(time.Now()) {
+		scheduled, err := h.messageService.ScheduleMessage(c.Request().Context(), &req, userID)
+		if err != nil {
+			logger.Error("Failed to schedule message", logger.WithField("error", err.Error()))
+			return c.JSON(statusForError(err), model.APIResponse{
+				Success: false,
+				Message: "Failed to schedule message",
+				Error:   errorResponse(statusForError(err), err),
+			})
+		}
+
+		return c.JSON(http.StatusAccepted, model.APIResponse{
+			Success: true,
+			Message: "Message scheduled successfully",
+			Data:    scheduled,
+		})
+	}
+
 	message, err := h.messageService.SendMessage(c.Request().Context(), &req, userID)
+	var rateLimited *service.RateLimitError
+	if errors.As(err, &rateLimited) {
+		retryAfter := int(math.Ceil(rateLimited.RetryAfter.Seconds()))
+		c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		return c.JSON(http.StatusTooManyRequests, model.APIResponse{
+			Success: false,
+			Message: "Slow mode is enabled in this room",
+			Data:    map[string]interface{}{"retry_after": retryAfter},
+			Error:   errorResponse(http.StatusTooManyRequests, err).WithDetail("retry_after", retryAfter),
+		})
+	}
 	if err != nil {
 		logger.Error("Failed to send message", logger.WithField("error", err.Error()))
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
 			Message: "Failed to send message",
-			Error:   err.Error(),
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
@@ -61,7 +101,7 @@ func (h *MessageHandler) GetMessage(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid message ID format",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
@@ -76,9 +116,10 @@ func (h *MessageHandler) GetMessage(c echo.Context) error {
 			"message_id": messageID,
 			"error":      err.Error(),
 		}))
-		return c.JSON(http.StatusNotFound, model.APIResponse{
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
-			Message: "Message not found",
+			Message: "Failed to get message",
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
@@ -89,6 +130,137 @@ func (h *MessageHandler) GetMessage(c echo.Context) error {
 	})
 }
 
+// GetMessageHistory returns the previous versions of an edited message
+func (h *MessageHandler) GetMessageHistory(c echo.Context) error {
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid message ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	edits, err := h.messageService.GetMessageHistory(c.Request().Context(), messageID, userID)
+	if err != nil {
+		logger.Error("Failed to get message history", logger.WithFields(map[string]interface{}{
+			"message_id": messageID,
+			"error":      err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to get message history",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Message history retrieved successfully",
+		Data:    edits,
+	})
+}
+
+// ForwardMessage copies a message into other rooms and reports the outcome per room
+func (h *MessageHandler) ForwardMessage(c echo.Context) error {
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid message ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	var req model.ForwardMessageRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	roomIDs := req.RoomIDs
+	if req.RoomID != nil {
+		roomIDs = append(roomIDs, *req.RoomID)
+	}
+
+	results, err := h.messageService.ForwardMessage(c.Request().Context(), messageID, roomIDs, userID)
+	if err != nil {
+		logger.Error("Failed to forward message", logger.WithFields(map[string]interface{}{
+			"message_id": messageID,
+			"error":      err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to forward message",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Message forwarded",
+		Data:    results,
+	})
+}
+
+// GetThreadMessages returns the replies to a message
+func (h *MessageHandler) GetThreadMessages(c echo.Context) error {
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid message ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	page, limit := parsePageParams(c)
+
+	replies, meta, err := h.messageService.GetThreadMessages(c.Request().Context(), messageID, userID, page, limit)
+	if err != nil {
+		logger.Error("Failed to get thread messages", logger.WithFields(map[string]interface{}{
+			"message_id": messageID,
+			"error":      err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to get thread messages",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.PaginatedResponse{
+		APIResponse: model.APIResponse{
+			Success: true,
+			Message: "Thread messages retrieved successfully",
+			Data:    replies,
+		},
+		Meta: *meta,
+	})
+}
+
 func (h *MessageHandler) GetRoomMessages(c echo.Context) error {
 	roomIDStr := c.Param("room_id")
 	roomID, err := uuid.Parse(roomIDStr)
@@ -96,7 +268,7 @@ func (h *MessageHandler) GetRoomMessages(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid room ID format",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
@@ -123,13 +295,60 @@ func (h *MessageHandler) GetRoomMessages(c echo.Context) error {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	messages, meta, err := h.messageService.GetMessages(c.Request().Context(), roomID, userID, page, limit)
+	// Deleted messages are left out unless requested as tombstones
+	deleted := model.DeletedMessagesExclude
+	switch mode := model.DeletedMessageMode(c.QueryParam("include_deleted")); mode {
+	case "", model.DeletedMessagesExclude:
+	case model.DeletedMessagesTombstone:
+		deleted = mode
+	default:
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "include_deleted must be tombstone or exclude",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidRequest, "include_deleted must be tombstone or exclude"),
+		})
+	}
+
+	// Individual reactions with their users are only loaded on request,
+	// responses otherwise carry per-emoji counts
+	reactionDetails := c.QueryParam("reaction_details") == "true"
+
+	// Cursor mode: ?before=<message_id|timestamp>, with an empty before or
+	// ?cursor=latest fetching the first page
+	if _, ok := c.QueryParams()["before"]; ok || c.QueryParam("cursor") == "latest" {
+		messages, meta, err := h.messageService.GetMessagesBefore(c.Request().Context(), roomID, userID, c.QueryParam("before"), limit, deleted)
+		if err == nil && reactionDetails {
+			err = h.messageService.LoadReactionDetails(c.Request().Context(), messages)
+		}
+		if err != nil {
+			logger.Error("Failed to get room messages", logger.WithField("error", err.Error()))
+			return c.JSON(statusForError(err), model.APIResponse{
+				Success: false,
+				Message: "Failed to retrieve messages",
+				Error:   errorResponse(statusForError(err), err),
+			})
+		}
+
+		return c.JSON(http.StatusOK, model.CursorPaginatedResponse{
+			APIResponse: model.APIResponse{
+				Success: true,
+				Message: "Messages retrieved successfully",
+				Data:    messages,
+			},
+			Meta: *meta,
+		})
+	}
+
+	messages, meta, err := h.messageService.GetMessages(c.Request().Context(), roomID, userID, page, limit, deleted)
+	if err == nil && reactionDetails {
+		err = h.messageService.LoadReactionDetails(c.Request().Context(), messages)
+	}
 	if err != nil {
 		logger.Error("Failed to get room messages", logger.WithField("error", err.Error()))
 		return c.JSON(http.StatusInternalServerError, model.APIResponse{
 			Success: false,
 			Message: "Failed to retrieve messages",
-			Error:   err.Error(),
+			Error:   errorResponse(http.StatusInternalServerError, err),
 		})
 	}
 
@@ -145,6 +364,124 @@ func (h *MessageHandler) GetRoomMessages(c echo.Context) error {
 	return c.JSON(http.StatusOK, response)
 }
 
+// SearchRoomMessages searches messages within a single room
+func (h *MessageHandler) SearchRoomMessages(c echo.Context) error {
+	roomIDStr := c.Param("room_id")
+	roomID, err := uuid.Parse(roomIDStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	page, limit := parsePageParams(c)
+
+	messages, meta, err := h.messageService.SearchRoomMessages(c.Request().Context(), roomID, userID, c.QueryParam("q"), page, limit)
+	if err != nil {
+		logger.Error("Failed to search room messages", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to search messages",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.PaginatedResponse{
+		APIResponse: model.APIResponse{
+			Success: true,
+			Message: "Messages retrieved successfully",
+			Data:    messages,
+		},
+		Meta: *meta,
+	})
+}
+
+// SearchMessages searches messages across all rooms the user belongs to
+func (h *MessageHandler) SearchMessages(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	page, limit := parsePageParams(c)
+
+	messages, meta, err := h.messageService.SearchUserMessages(c.Request().Context(), userID, c.QueryParam("q"), page, limit)
+	if err != nil {
+		logger.Error("Failed to search messages", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to search messages",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.PaginatedResponse{
+		APIResponse: model.APIResponse{
+			Success: true,
+			Message: "Messages retrieved successfully",
+			Data:    messages,
+		},
+		Meta: *meta,
+	})
+}
+
+// GetMentions lists messages mentioning the current user
+func (h *MessageHandler) GetMentions(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	page, limit := parsePageParams(c)
+
+	messages, meta, err := h.messageService.GetMentions(c.Request().Context(), userID, page, limit)
+	if err != nil {
+		logger.Error("Failed to get mentions", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to get mentions",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.PaginatedResponse{
+		APIResponse: model.APIResponse{
+			Success: true,
+			Message: "Mentions retrieved successfully",
+			Data:    messages,
+		},
+		Meta: *meta,
+	})
+}
+
+// parsePageParams reads the page and limit query parameters; search
+// queries themselves are validated by the service
+func parsePageParams(c echo.Context) (int, int) {
+	page := 1
+	limit := 20
+
+	if pageStr := c.QueryParam("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	if limitStr := c.QueryParam("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	return page, limit
+}
+
 func (h *MessageHandler) EditMessage(c echo.Context) error {
 	messageIDStr := c.Param("id")
 	messageID, err := uuid.Parse(messageIDStr)
@@ -152,7 +489,7 @@ func (h *MessageHandler) EditMessage(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid message ID format",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
@@ -161,10 +498,14 @@ func (h *MessageHandler) EditMessage(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid request body",
-			Error:   err.Error(),
+			Error:   errorResponse(http.StatusBadRequest, err),
 		})
 	}
 
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
 	userID, httpErr := RequireAuth(c)
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
@@ -173,10 +514,10 @@ func (h *MessageHandler) EditMessage(c echo.Context) error {
 	message, err := h.messageService.EditMessage(c.Request().Context(), messageID, &req, userID)
 	if err != nil {
 		logger.Error("Failed to edit message", logger.WithField("error", err.Error()))
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
 			Message: "Failed to edit message",
-			Error:   err.Error(),
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
@@ -194,7 +535,7 @@ func (h *MessageHandler) DeleteMessage(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid message ID format",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
@@ -203,12 +544,18 @@ func (h *MessageHandler) DeleteMessage(c echo.Context) error {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	if err := h.messageService.DeleteMessage(c.Request().Context(), messageID, userID); err != nil {
+	// ?mode=for_me hides the message for the caller only
+	mode := model.DeleteForEveryone
+	if modeParam := c.QueryParam("mode"); modeParam != "" {
+		mode = model.DeleteMessageMode(modeParam)
+	}
+
+	if err := h.messageService.DeleteMessage(c.Request().Context(), messageID, userID, mode); err != nil {
 		logger.Error("Failed to delete message", logger.WithField("error", err.Error()))
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
 			Message: "Failed to delete message",
-			Error:   err.Error(),
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
@@ -225,7 +572,7 @@ func (h *MessageHandler) ReactToMessage(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid message ID format",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
@@ -234,27 +581,90 @@ func (h *MessageHandler) ReactToMessage(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid request body",
-			Error:   err.Error(),
+			Error:   errorResponse(http.StatusBadRequest, err),
 		})
 	}
 
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
 	userID, httpErr := RequireAuth(c)
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	if err := h.messageService.ReactToMessage(c.Request().Context(), messageID, &req, userID); err != nil {
+	result, err := h.messageService.ReactToMessage(c.Request().Context(), messageID, &req, userID)
+	if err != nil {
 		logger.Error("Failed to add reaction", logger.WithField("error", err.Error()))
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
 			Message: "Failed to add reaction",
-			Error:   err.Error(),
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
-	return c.JSON(http.StatusCreated, model.APIResponse{
-		Success: true,
-		Message: "Reaction added successfully",
+	switch {
+	case result.Changed && result.Reacted:
+		return c.JSON(http.StatusCreated, model.APIResponse{
+			Success: true,
+			Message: "Reaction added successfully",
+			Data:    result,
+		})
+	case result.Changed:
+		return c.JSON(http.StatusOK, model.APIResponse{
+			Success: true,
+			Message: "Reaction removed successfully",
+			Data:    result,
+		})
+	default:
+		return c.JSON(http.StatusOK, model.APIResponse{
+			Success: true,
+			Message: "Reaction already added",
+			Data:    result,
+		})
+	}
+}
+
+// GetMessageReactions lists who reacted to a message, optionally filtered
+// with ?emoji=
+func (h *MessageHandler) GetMessageReactions(c echo.Context) error {
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid message ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	page, limit := parsePageParams(c)
+
+	reactions, meta, err := h.messageService.GetMessageReactions(c.Request().Context(), messageID, userID, c.QueryParam("emoji"), page, limit)
+	if err != nil {
+		logger.Error("Failed to get message reactions", logger.WithFields(map[string]interface{}{
+			"message_id": messageID,
+			"error":      err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to get message reactions",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.PaginatedResponse{
+		APIResponse: model.APIResponse{
+			Success: true,
+			Message: "Reactions retrieved successfully",
+			Data:    reactions,
+		},
+		Meta: *meta,
 	})
 }
 
@@ -265,7 +675,7 @@ func (h *MessageHandler) RemoveReaction(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid message ID format",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
@@ -274,6 +684,7 @@ func (h *MessageHandler) RemoveReaction(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Emoji parameter is required",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidRequest, "emoji is required"),
 		})
 	}
 
@@ -284,10 +695,10 @@ func (h *MessageHandler) RemoveReaction(c echo.Context) error {
 
 	if err := h.messageService.RemoveReaction(c.Request().Context(), messageID, emoji, userID); err != nil {
 		logger.Error("Failed to remove reaction", logger.WithField("error", err.Error()))
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
 			Message: "Failed to remove reaction",
-			Error:   err.Error(),
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
@@ -304,7 +715,7 @@ func (h *MessageHandler) MarkAsRead(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid message ID format",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
@@ -315,10 +726,10 @@ func (h *MessageHandler) MarkAsRead(c echo.Context) error {
 
 	if err := h.messageService.MarkAsRead(c.Request().Context(), messageID, userID); err != nil {
 		logger.Error("Failed to mark message as read", logger.WithField("error", err.Error()))
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
 			Message: "Failed to mark message as read",
-			Error:   err.Error(),
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
@@ -328,28 +739,142 @@ func (h *MessageHandler) MarkAsRead(c echo.Context) error {
 	})
 }
 
-func (h *MessageHandler) StartTyping(c echo.Context) error {
-	roomIDStr := c.Param("room_id")
-	roomID, err := uuid.Parse(roomIDStr)
-	if err != nil {
+// MarkDelivered acknowledges messages a client received over HTTP
+func (h *MessageHandler) MarkDelivered(c echo.Context) error {
+	var req model.MarkDeliveredRequest
+	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
-			Message: "Invalid room ID format",
-			Error:   err.Error(),
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
 		})
 	}
 
-	userID, httpErr := RequireAuth(c)
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.messageService.MarkDelivered(c.Request().Context(), userID, req.MessageIDs); err != nil {
+		logger.Error("Failed to mark messages as delivered", logger.WithFields(map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": userID,
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to mark messages as delivered",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Messages marked as delivered",
+	})
+}
+
+// MarkRoomAsRead marks every message of a room up to a point as read
+func (h *MessageHandler) MarkRoomAsRead(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	var req model.MarkRoomReadRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	readAt, err := h.messageService.MarkRoomAsRead(c.Request().Context(), roomID, userID, req.UpToMessageID)
+	if err != nil {
+		logger.Error("Failed to mark room as read", logger.WithFields(map[string]interface{}{
+			"error":   err.Error(),
+			"room_id": roomID,
+			"user_id": userID,
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to mark room as read",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Room marked as read",
+		Data: map[string]interface{}{
+			"room_id":    roomID,
+			"read_up_to": readAt,
+		},
+	})
+}
+
+// GetUnreadCounts returns the unread count of every room of the current user
+func (h *MessageHandler) GetUnreadCounts(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	counts, err := h.messageService.GetAllUnreadCounts(c.Request().Context(), userID)
+	if err != nil {
+		logger.Error("Failed to get unread counts", logger.WithFields(map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": userID,
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to get unread counts",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Unread counts retrieved successfully",
+		Data:    counts,
+	})
+}
+
+func (h *MessageHandler) StartTyping(c echo.Context) error {
+	roomIDStr := c.Param("room_id")
+	roomID, err := uuid.Parse(roomIDStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
 	if err := h.messageService.StartTyping(c.Request().Context(), roomID, userID); err != nil {
 		logger.Error("Failed to start typing", logger.WithField("error", err.Error()))
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
 			Message: "Failed to start typing",
-			Error:   err.Error(),
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
@@ -366,7 +891,7 @@ func (h *MessageHandler) StopTyping(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid room ID format",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
@@ -380,7 +905,7 @@ func (h *MessageHandler) StopTyping(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Failed to stop typing",
-			Error:   err.Error(),
+			Error:   errorResponse(http.StatusBadRequest, err),
 		})
 	}
 
@@ -389,3 +914,393 @@ func (h *MessageHandler) StopTyping(c echo.Context) error {
 		Message: "Typing stopped",
 	})
 }
+
+// PinMessage pins a message to the top of a room
+func (h *MessageHandler) PinMessage(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	messageID, err := uuid.Parse(c.Param("message_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid message ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	pin, err := h.messageService.PinMessage(c.Request().Context(), roomID, messageID, userID)
+	if err != nil {
+		logger.Error("Failed to pin message", logger.WithFields(map[string]interface{}{
+			"room_id": roomID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to pin message",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Message pinned successfully",
+		Data:    pin,
+	})
+}
+
+// UnpinMessage removes a pinned message from a room
+func (h *MessageHandler) UnpinMessage(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	messageID, err := uuid.Parse(c.Param("message_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid message ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	err = h.messageService.UnpinMessage(c.Request().Context(), roomID, messageID, userID)
+	if err != nil {
+		logger.Error("Failed to unpin message", logger.WithFields(map[string]interface{}{
+			"room_id": roomID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to unpin message",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Message unpinned successfully",
+	})
+}
+
+// GetPinnedMessages returns the pinned messages of a room
+func (h *MessageHandler) GetPinnedMessages(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	pins, err := h.messageService.GetPinnedMessages(c.Request().Context(), roomID, userID)
+	if err != nil {
+		logger.Error("Failed to get pinned messages", logger.WithFields(map[string]interface{}{
+			"room_id": roomID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to get pinned messages",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Pinned messages retrieved successfully",
+		Data:    pins,
+	})
+}
+
+// ExportRoom streams the messages of a room as a JSON or CSV download
+func (h *MessageHandler) ExportRoom(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	format := strings.ToLower(c.QueryParam("format"))
+	if format == "" {
+		format = service.ExportFormatJSON
+	}
+
+	ctx := c.Request().Context()
+	room, err := h.messageService.PrepareRoomExport(ctx, roomID, userID, format)
+	var rateLimited *service.RateLimitError
+	if errors.As(err, &rateLimited) {
+		retryAfter := int(math.Ceil(rateLimited.RetryAfter.Seconds()))
+		c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		return c.JSON(http.StatusTooManyRequests, model.APIResponse{
+			Success: false,
+			Message: "This room was exported recently",
+			Data:    map[string]interface{}{"retry_after": retryAfter},
+			Error:   errorResponse(http.StatusTooManyRequests, err).WithDetail("retry_after", retryAfter),
+		})
+	}
+	if err != nil {
+		logger.Error("Failed to export room", logger.WithFields(map[string]interface{}{
+			"room_id": roomID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to export room",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	contentType := echo.MIMEApplicationJSONCharsetUTF8
+	if format == service.ExportFormatCSV {
+		contentType = "text/csv; charset=utf-8"
+	}
+	filename := fmt.Sprintf("room-%s-%s.%s", exportFileName(room), time.Now().Format("2006-01-02"), format)
+	c.Response().Header().Set(echo.HeaderContentType, contentType)
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	c.Response().WriteHeader(http.StatusOK)
+
+	// The status is already sent, so a failure can only cut the download short
+	if err := h.messageService.ExportRoom(ctx, room, userID, format, c.Response()); err != nil {
+		logger.Error("Failed to stream room export", logger.WithFields(map[string]interface{}{
+			"room_id": roomID,
+			"error":   err.Error(),
+		}))
+	}
+	return nil
+}
+
+// exportFileName reduces a room name to something safe for a file name,
+// falling back to the room ID for unnamed rooms
+func exportFileName(room *model.Room) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(room.Name) {
+		if r <= unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	name := strings.TrimSuffix(b.String(), "-")
+	if name == "" {
+		return room.ID.String()
+	}
+	return name
+}
+
+// GetDraft returns the current user's draft for a room
+func (h *MessageHandler) GetDraft(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	draft, err := h.messageService.GetDraft(c.Request().Context(), roomID, userID)
+	if err != nil {
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to get draft",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Draft retrieved successfully",
+		Data:    draft,
+	})
+}
+
+// SaveDraft creates or replaces the current user's draft for a room
+func (h *MessageHandler) SaveDraft(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	var req model.SaveDraftRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	draft, err := h.messageService.SaveDraft(c.Request().Context(), roomID, &req, userID)
+	if err != nil {
+		logger.Error("Failed to save draft", logger.WithFields(map[string]interface{}{
+			"room_id": roomID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to save draft",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Draft saved successfully",
+		Data:    draft,
+	})
+}
+
+// DeleteDraft discards the current user's draft for a room
+func (h *MessageHandler) DeleteDraft(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.messageService.DeleteDraft(c.Request().Context(), roomID, userID); err != nil {
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to delete draft",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Draft deleted successfully",
+	})
+}
+
+// GetScheduledMessages lists the current user's pending messages for a room
+func (h *MessageHandler) GetScheduledMessages(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	scheduled, err := h.messageService.GetScheduledMessages(c.Request().Context(), roomID, userID)
+	if err != nil {
+		logger.Error("Failed to get scheduled messages", logger.WithFields(map[string]interface{}{
+			"room_id": roomID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to get scheduled messages",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Scheduled messages retrieved successfully",
+		Data:    scheduled,
+	})
+}
+
+// CancelScheduledMessage cancels a pending message of the current user
+func (h *MessageHandler) CancelScheduledMessage(c echo.Context) error {
+	scheduledID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid scheduled message ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.messageService.CancelScheduledMessage(c.Request().Context(), scheduledID, userID); err != nil {
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to cancel scheduled message",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Scheduled message cancelled",
+	})
+}
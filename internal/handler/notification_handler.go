@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+	"realtime-api/internal/service"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type NotificationHandler struct {
+	notificationService service.NotificationService
+}
+
+func NewNotificationHandler(notificationService service.NotificationService) *NotificationHandler {
+	return &NotificationHandler{
+		notificationService: notificationService,
+	}
+}
+
+// ListNotifications returns the current user's notifications, newest first,
+// optionally only the read or unread ones
+func (h *NotificationHandler) ListNotifications(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	page := 1
+	limit := 20
+
+	if pageParam := c.QueryParam("page"); pageParam != "" {
+		if p, err := strconv.Atoi(pageParam); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	if limitParam := c.QueryParam("limit"); limitParam != "" {
+		if l, err := strconv.Atoi(limitParam); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	var isRead *bool
+	if isReadParam := c.QueryParam("is_read"); isReadParam != "" {
+		parsed, err := strconv.ParseBool(isReadParam)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, model.APIResponse{
+				Success: false,
+				Message: "Invalid is_read parameter",
+				Error:   errorResponse(http.StatusBadRequest, err),
+			})
+		}
+		isRead = &parsed
+	}
+
+	notifications, meta, err := h.notificationService.GetNotifications(c.Request().Context(), userID, isRead, page, limit)
+	if err != nil {
+		logger.Error("Failed to get notifications", logger.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to get notifications",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.PaginatedResponse{
+		APIResponse: model.APIResponse{
+			Success: true,
+			Message: "Notifications retrieved successfully",
+			Data:    notifications,
+		},
+		Meta: *meta,
+	})
+}
+
+// GetUnreadCount returns the number of unread notifications of the current
+// user
+func (h *NotificationHandler) GetUnreadCount(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	count, err := h.notificationService.GetUnreadCount(c.Request().Context(), userID)
+	if err != nil {
+		logger.Error("Failed to count unread notifications", logger.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to count unread notifications",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Unread notification count retrieved successfully",
+		Data:    map[string]int64{"unread_count": count},
+	})
+}
+
+// MarkAsRead marks a single notification as read
+func (h *NotificationHandler) MarkAsRead(c echo.Context) error {
+	notificationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid notification ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.notificationService.MarkAsRead(c.Request().Context(), notificationID, userID); err != nil {
+		logger.Error("Failed to mark notification as read", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to mark notification as read",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Notification marked as read",
+	})
+}
+
+// MarkAllAsRead marks every notification of the current user as read
+func (h *NotificationHandler) MarkAllAsRead(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.notificationService.MarkAllAsRead(c.Request().Context(), userID); err != nil {
+		logger.Error("Failed to mark notifications as read", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to mark notifications as read",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "All notifications marked as read",
+	})
+}
+
+// DeleteNotification removes a notification of the current user
+func (h *NotificationHandler) DeleteNotification(c echo.Context) error {
+	notificationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid notification ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.notificationService.DeleteNotification(c.Request().Context(), notificationID, userID); err != nil {
+		logger.Error("Failed to delete notification", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to delete notification",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Notification deleted successfully",
+	})
+}
+
+// RegisterDevice registers a push notification token of a device of the
+// current user
+func (h *NotificationHandler) RegisterDevice(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	var req model.RegisterDeviceRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	device, err := h.notificationService.RegisterDevice(c.Request().Context(), userID, &req)
+	if err != nil {
+		logger.Error("Failed to register device", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to register device",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Device registered successfully",
+		Data:    device,
+	})
+}
+
+// UnregisterDevice stops push notifications to a device of the current user
+func (h *NotificationHandler) UnregisterDevice(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	var req model.UnregisterDeviceRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.notificationService.UnregisterDevice(c.Request().Context(), userID, req.Token); err != nil {
+		logger.Error("Failed to unregister device", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to unregister device",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Device unregistered successfully",
+	})
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"net/http"
+
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+	"realtime-api/internal/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+type PreferencesHandler struct {
+	preferencesService service.PreferencesService
+}
+
+func NewPreferencesHandler(preferencesService service.PreferencesService) *PreferencesHandler {
+	return &PreferencesHandler{
+		preferencesService: preferencesService,
+	}
+}
+
+// GetPreferences returns the preferences of the current user
+func (h *PreferencesHandler) GetPreferences(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	prefs, err := h.preferencesService.GetPreferences(c.Request().Context(), userID)
+	if err != nil {
+		logger.Error("Failed to get preferences", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to get preferences",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Preferences retrieved successfully",
+		Data:    prefs,
+	})
+}
+
+// UpdatePreferences changes the given preferences of the current user
+func (h *PreferencesHandler) UpdatePreferences(c echo.Context) error {
+	var req model.UpdatePreferencesRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	prefs, err := h.preferencesService.UpdatePreferences(c.Request().Context(), userID, &req)
+	if err != nil {
+		logger.Error("Failed to update preferences", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to update preferences",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Preferences updated successfully",
+		Data:    prefs,
+	})
+}
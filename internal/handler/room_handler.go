@@ -1,8 +1,10 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"realtime-api/internal/logger"
 	"realtime-api/internal/model"
@@ -29,10 +31,14 @@ func (h *RoomHandler) CreateRoom(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid request body",
-			Error:   err.Error(),
+			Error:   errorResponse(http.StatusBadRequest, err),
 		})
 	}
 
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
 	userID, httpErr := RequireAuth(c)
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
@@ -44,7 +50,7 @@ func (h *RoomHandler) CreateRoom(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Failed to create room",
-			Error:   err.Error(),
+			Error:   errorResponse(http.StatusBadRequest, err),
 		})
 	}
 
@@ -62,7 +68,7 @@ func (h *RoomHandler) GetRoom(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid room ID format",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
@@ -77,9 +83,10 @@ func (h *RoomHandler) GetRoom(c echo.Context) error {
 			"room_id": roomID,
 			"error":   err.Error(),
 		}))
-		return c.JSON(http.StatusNotFound, model.APIResponse{
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
-			Message: "Room not found",
+			Message: "Failed to get room",
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
@@ -119,7 +126,16 @@ func (h *RoomHandler) ListRooms(c echo.Context) error {
 	var meta *model.PaginationMeta
 	var err error
 
-	if roomType == "public" || roomType == "" {
+	query := c.QueryParam("q")
+	var tags []string
+	if tagsParam := c.QueryParam("tags"); tagsParam != "" {
+		tags = strings.Split(tagsParam, ",")
+	}
+
+	if (roomType == "public" || roomType == "") && (query != "" || len(tags) > 0) {
+		// Search public rooms by name and comma separated tags
+		rooms, meta, err = h.roomService.SearchRooms(c.Request().Context(), query, tags, page, limit)
+	} else if roomType == "public" || roomType == "" {
 		// List public rooms
 		rooms, meta, err = h.roomService.GetPublicRooms(c.Request().Context(), page, limit)
 	} else {
@@ -138,10 +154,10 @@ func (h *RoomHandler) ListRooms(c echo.Context) error {
 
 	if err != nil {
 		logger.Error("Failed to list rooms", logger.WithField("error", err.Error()))
-		return c.JSON(http.StatusInternalServerError, model.APIResponse{
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
 			Message: "Failed to retrieve rooms",
-			Error:   err.Error(),
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
@@ -157,6 +173,30 @@ func (h *RoomHandler) ListRooms(c echo.Context) error {
 	return c.JSON(http.StatusOK, response)
 }
 
+// ListRoomTags returns the tags of public rooms with their room counts, for
+// browsing rooms by topic
+func (h *RoomHandler) ListRoomTags(c echo.Context) error {
+	if _, httpErr := RequireAuth(c); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	tags, err := h.roomService.ListRoomTags(c.Request().Context())
+	if err != nil {
+		logger.Error("Failed to list room tags", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to list room tags",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Room tags retrieved successfully",
+		Data:    tags,
+	})
+}
+
 func (h *RoomHandler) UpdateRoom(c echo.Context) error {
 	roomIDStr := c.Param("id")
 	roomID, err := uuid.Parse(roomIDStr)
@@ -164,7 +204,7 @@ func (h *RoomHandler) UpdateRoom(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid room ID format",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
@@ -173,10 +213,14 @@ func (h *RoomHandler) UpdateRoom(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid request body",
-			Error:   err.Error(),
+			Error:   errorResponse(http.StatusBadRequest, err),
 		})
 	}
 
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
 	userID, httpErr := RequireAuth(c)
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
@@ -185,10 +229,10 @@ func (h *RoomHandler) UpdateRoom(c echo.Context) error {
 	room, err := h.roomService.UpdateRoom(c.Request().Context(), roomID, &req, userID)
 	if err != nil {
 		logger.Error("Failed to update room", logger.WithField("error", err.Error()))
-		return c.JSON(http.StatusInternalServerError, model.APIResponse{
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
 			Message: "Failed to update room",
-			Error:   err.Error(),
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
@@ -206,7 +250,7 @@ func (h *RoomHandler) DeleteRoom(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid room ID format",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
@@ -217,10 +261,10 @@ func (h *RoomHandler) DeleteRoom(c echo.Context) error {
 
 	if err := h.roomService.DeleteRoom(c.Request().Context(), roomID, userID); err != nil {
 		logger.Error("Failed to delete room", logger.WithField("error", err.Error()))
-		return c.JSON(http.StatusInternalServerError, model.APIResponse{
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
 			Message: "Failed to delete room",
-			Error:   err.Error(),
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
@@ -237,7 +281,7 @@ func (h *RoomHandler) JoinRoom(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid room ID format",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
@@ -246,16 +290,25 @@ func (h *RoomHandler) JoinRoom(c echo.Context) error {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	if err := h.roomService.JoinRoom(c.Request().Context(), roomID, userID); err != nil {
+	request, err := h.roomService.JoinRoom(c.Request().Context(), roomID, userID)
+	if err != nil {
 		logger.Error("Failed to join room", logger.WithFields(map[string]interface{}{
 			"room_id": roomID,
 			"user_id": userID,
 			"error":   err.Error(),
 		}))
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
 			Message: "Failed to join room",
-			Error:   err.Error(),
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	if request != nil {
+		return c.JSON(http.StatusAccepted, model.APIResponse{
+			Success: true,
+			Message: "Join request sent, waiting for approval",
+			Data:    request,
 		})
 	}
 
@@ -268,6 +321,161 @@ func (h *RoomHandler) JoinRoom(c echo.Context) error {
 	})
 }
 
+// GetJoinRequests lists the pending join requests of a room
+func (h *RoomHandler) GetJoinRequests(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	requests, err := h.roomService.GetJoinRequests(c.Request().Context(), roomID, userID)
+	if err != nil {
+		logger.Error("Failed to get join requests", logger.WithFields(map[string]interface{}{
+			"room_id": roomID,
+			"user_id": userID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to get join requests",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Join requests retrieved successfully",
+		Data:    requests,
+	})
+}
+
+// joinRequester returns the user whose join request is answered, named
+// either by the user_id or the req_id route parameter
+func (h *RoomHandler) joinRequester(c echo.Context, roomID, adminID uuid.UUID) (uuid.UUID, *echo.HTTPError) {
+	if c.Param("req_id") == "" {
+		userID, err := uuid.Parse(c.Param("user_id"))
+		if err != nil {
+			return uuid.Nil, echo.NewHTTPError(http.StatusBadRequest, model.APIResponse{
+				Success: false,
+				Message: "Invalid user ID format",
+				Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+			})
+		}
+		return userID, nil
+	}
+
+	requestID, err := uuid.Parse(c.Param("req_id"))
+	if err != nil {
+		return uuid.Nil, echo.NewHTTPError(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid join request ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	request, err := h.roomService.GetJoinRequest(c.Request().Context(), roomID, requestID, adminID)
+	if err != nil {
+		return uuid.Nil, echo.NewHTTPError(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to get join request",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+	return request.UserID, nil
+}
+
+// ApproveJoinRequest adds a user who asked to join the room
+func (h *RoomHandler) ApproveJoinRequest(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	adminID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	requesterID, httpErr := h.joinRequester(c, roomID, adminID)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.roomService.ApproveJoinRequest(c.Request().Context(), roomID, requesterID, adminID); err != nil {
+		logger.Error("Failed to approve join request", logger.WithFields(map[string]interface{}{
+			"room_id": roomID,
+			"user_id": requesterID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to approve join request",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	// Join WebSocket room
+	websocket.GetHub().JoinRoom(requesterID, roomID)
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Join request approved successfully",
+	})
+}
+
+// RejectJoinRequest declines a user's request to join the room
+func (h *RoomHandler) RejectJoinRequest(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	adminID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	requesterID, httpErr := h.joinRequester(c, roomID, adminID)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.roomService.RejectJoinRequest(c.Request().Context(), roomID, requesterID, adminID); err != nil {
+		logger.Error("Failed to reject join request", logger.WithFields(map[string]interface{}{
+			"room_id": roomID,
+			"user_id": requesterID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to reject join request",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Join request rejected successfully",
+	})
+}
+
 func (h *RoomHandler) LeaveRoom(c echo.Context) error {
 	roomIDStr := c.Param("id")
 	roomID, err := uuid.Parse(roomIDStr)
@@ -275,7 +483,7 @@ func (h *RoomHandler) LeaveRoom(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid room ID format",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
@@ -293,7 +501,7 @@ func (h *RoomHandler) LeaveRoom(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Failed to leave room",
-			Error:   err.Error(),
+			Error:   errorResponse(http.StatusBadRequest, err),
 		})
 	}
 
@@ -313,24 +521,68 @@ func (h *RoomHandler) GetRoomMembers(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid room ID format",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
-	members, err := h.roomService.GetRoomMembers(c.Request().Context(), roomID)
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	page, limit := parsePageParams(c)
+
+	members, meta, err := h.roomService.GetRoomMembers(c.Request().Context(), roomID, userID, c.QueryParam("role"), c.QueryParam("search"), page, limit)
 	if err != nil {
 		logger.Error("Failed to get room members", logger.WithField("error", err.Error()))
-		return c.JSON(http.StatusInternalServerError, model.APIResponse{
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
 			Message: "Failed to retrieve room members",
-			Error:   err.Error(),
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.PaginatedResponse{
+		APIResponse: model.APIResponse{
+			Success: true,
+			Message: "Room members retrieved successfully",
+			Data:    members,
+		},
+		Meta: *meta,
+	})
+}
+
+// SearchMembers suggests the members of a room whose username starts with
+// the q prefix, for mention autocompletion
+func (h *RoomHandler) SearchMembers(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	suggestions, err := h.roomService.SuggestMembers(c.Request().Context(), roomID, userID, c.QueryParam("q"))
+	if err != nil {
+		logger.Error("Failed to search room members", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to search room members",
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
 	return c.JSON(http.StatusOK, model.APIResponse{
 		Success: true,
 		Message: "Room members retrieved successfully",
-		Data:    members,
+		Data:    suggestions,
 	})
 }
 
@@ -341,7 +593,7 @@ func (h *RoomHandler) AddMember(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid room ID format",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
@@ -352,10 +604,14 @@ func (h *RoomHandler) AddMember(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid request body",
-			Error:   err.Error(),
+			Error:   errorResponse(http.StatusBadRequest, err),
 		})
 	}
 
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
 	inviterUserID, httpErr := RequireAuth(c)
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
@@ -363,10 +619,14 @@ func (h *RoomHandler) AddMember(c echo.Context) error {
 
 	if err := h.roomService.AddMember(c.Request().Context(), roomID, req.UserID, inviterUserID); err != nil {
 		logger.Error("Failed to add room member", logger.WithField("error", err.Error()))
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrRoomFull) {
+			status = http.StatusConflict
+		}
+		return c.JSON(status, model.APIResponse{
 			Success: false,
 			Message: "Failed to add member to room",
-			Error:   err.Error(),
+			Error:   errorResponse(status, err),
 		})
 	}
 
@@ -386,7 +646,7 @@ func (h *RoomHandler) RemoveMember(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid room ID format",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
@@ -396,7 +656,7 @@ func (h *RoomHandler) RemoveMember(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid user ID format",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
@@ -405,12 +665,26 @@ func (h *RoomHandler) RemoveMember(c echo.Context) error {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	if err := h.roomService.RemoveMember(c.Request().Context(), roomID, userID, removerUserID); err != nil {
+	// banned=true also keeps the user from joining again
+	if c.QueryParam("banned") == "true" {
+		req := &model.BanMemberRequest{Reason: c.QueryParam("reason")}
+		if httpErr := ValidateRequest(c, req); httpErr != nil {
+			return c.JSON(httpErr.Code, httpErr.Message)
+		}
+		if _, err := h.roomService.BanMember(c.Request().Context(), roomID, userID, removerUserID, req); err != nil {
+			logger.Error("Failed to ban room member", logger.WithField("error", err.Error()))
+			return c.JSON(statusForError(err), model.APIResponse{
+				Success: false,
+				Message: "Failed to remove member from room",
+				Error:   errorResponse(statusForError(err), err),
+			})
+		}
+	} else if err := h.roomService.RemoveMember(c.Request().Context(), roomID, userID, removerUserID); err != nil {
 		logger.Error("Failed to remove room member", logger.WithField("error", err.Error()))
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
 			Message: "Failed to remove member from room",
-			Error:   err.Error(),
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
@@ -423,134 +697,747 @@ func (h *RoomHandler) RemoveMember(c echo.Context) error {
 	})
 }
 
-func (h *RoomHandler) CreateInvite(c echo.Context) error {
-	roomIDStr := c.Param("id")
-	roomID, err := uuid.Parse(roomIDStr)
+// GetRoomBans lists the active bans of a room for its admins
+func (h *RoomHandler) GetRoomBans(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid room ID format",
-			Error:   err.Error(),
-		})
-	}
-
-	var req model.CreateInviteRequest
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
-			Success: false,
-			Message: "Invalid request body",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
-	inviterUserID, httpErr := RequireAuth(c)
+	adminID, httpErr := RequireAuth(c)
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	invite, err := h.roomService.CreateInvite(c.Request().Context(), roomID, inviterUserID, &req)
+	bans, err := h.roomService.GetRoomBans(c.Request().Context(), roomID, adminID)
 	if err != nil {
-		logger.Error("Failed to create room invite", logger.WithField("error", err.Error()))
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
+		logger.Error("Failed to get room bans", logger.WithFields(map[string]interface{}{
+			"room_id": roomID,
+			"user_id": adminID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
-			Message: "Failed to create invite",
-			Error:   err.Error(),
+			Message: "Failed to get room bans",
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
-	return c.JSON(http.StatusCreated, model.APIResponse{
+	return c.JSON(http.StatusOK, model.APIResponse{
 		Success: true,
-		Message: "Room invite created successfully",
-		Data:    invite,
+		Message: "Room bans retrieved successfully",
+		Data:    bans,
 	})
 }
 
-func (h *RoomHandler) AcceptInvite(c echo.Context) error {
-	inviteCodeStr := c.Param("invite_code")
+// GetRoomStats returns message, member and reaction statistics of a room
+// for its admins
+func (h *RoomHandler) GetRoomStats(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
 
-	userID, httpErr := RequireAuth(c)
+	adminID, httpErr := RequireAuth(c)
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	room, err := h.roomService.AcceptInvite(c.Request().Context(), inviteCodeStr, userID)
+	stats, err := h.roomService.GetRoomStats(c.Request().Context(), roomID, adminID)
 	if err != nil {
-		logger.Error("Failed to accept room invite", logger.WithField("error", err.Error()))
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
+		logger.Error("Failed to get room stats", logger.WithFields(map[string]interface{}{
+			"room_id": roomID,
+			"user_id": adminID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
-			Message: "Failed to accept invite",
-			Error:   err.Error(),
+			Message: "Failed to get room stats",
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
-	// Join WebSocket room
-	websocket.GetHub().JoinRoom(userID, room.ID)
-
 	return c.JSON(http.StatusOK, model.APIResponse{
 		Success: true,
-		Message: "Invite accepted successfully",
-		Data: map[string]interface{}{
-			"room": room,
-		},
+		Message: "Room stats retrieved successfully",
+		Data:    stats,
 	})
 }
 
-func (h *RoomHandler) RejectInvite(c echo.Context) error {
-	inviteCodeStr := c.Param("invite_code")
+// BanMember bans a user from the room, removing them if they are a member
+func (h *RoomHandler) BanMember(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
 
-	userID, httpErr := RequireAuth(c)
+	adminID, httpErr := RequireAuth(c)
 	if httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	if err := h.roomService.RejectInvite(c.Request().Context(), inviteCodeStr, userID); err != nil {
-		logger.Error("Failed to reject room invite", logger.WithField("error", err.Error()))
+	var req model.BanMemberRequest
+	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
-			Message: "Failed to reject invite",
-			Error:   err.Error(),
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
 		})
 	}
 
-	return c.JSON(http.StatusOK, model.APIResponse{
-		Success: true,
-		Message: "Invite rejected successfully",
-	})
-}
-
-// ListUserChatRooms returns paginated list of user's chat rooms for chat list display
-func (h *RoomHandler) ListUserChatRooms(c echo.Context) error {
-	userID, httpErr := RequireAuth(c)
-	if httpErr != nil {
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
 		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	// Get pagination parameters
-	page := 1
-	limit := 20
-
-	if pageParam := c.QueryParam("page"); pageParam != "" {
-		if p, err := strconv.Atoi(pageParam); err == nil && p > 0 {
-			page = p
+	// The banned user is given in the path or, on POST /bans, in the body
+	userID := req.UserID
+	if param := c.Param("user_id"); param != "" {
+		userID, err = uuid.Parse(param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, model.APIResponse{
+				Success: false,
+				Message: "Invalid user ID format",
+				Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+			})
 		}
 	}
-
-	if limitParam := c.QueryParam("limit"); limitParam != "" {
-		if l, err := strconv.Atoi(limitParam); err == nil && l > 0 && l <= 100 {
-			limit = l
-		}
+	if userID == uuid.Nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "User ID is required",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidRequest, "user_id is required"),
+		})
 	}
 
-	rooms, meta, err := h.roomService.ListUserChatRooms(c.Request().Context(), userID, page, limit)
+	ban, err := h.roomService.BanMember(c.Request().Context(), roomID, userID, adminID, &req)
 	if err != nil {
-		logger.Error("Failed to get user chat rooms", logger.WithFields(map[string]interface{}{
-			"user_id": userID,
-			"error":   err.Error(),
-		}))
-		return c.JSON(http.StatusInternalServerError, model.APIResponse{
+		logger.Error("Failed to ban room member", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
-			Message: "Failed to get chat rooms",
-			Error:   err.Error(),
+			Message: "Failed to ban member",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Member banned successfully",
+		Data:    ban,
+	})
+}
+
+// UnbanMember lifts the ban of a user
+func (h *RoomHandler) UnbanMember(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid user ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	adminID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.roomService.UnbanMember(c.Request().Context(), roomID, userID, adminID); err != nil {
+		logger.Error("Failed to unban room member", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to unban member",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Member unbanned successfully",
+	})
+}
+
+// UpdateMemberRole changes the role of a room member
+func (h *RoomHandler) UpdateMemberRole(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid user ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	updaterID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	var req model.UpdateMemberRoleRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.roomService.UpdateMemberRole(c.Request().Context(), roomID, userID, updaterID, req.Role); err != nil {
+		logger.Error("Failed to update member role", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to update member role",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Member role updated successfully",
+	})
+}
+
+// MuteMember lets room admins mute or unmute a member, optionally for a
+// number of seconds
+func (h *RoomHandler) MuteMember(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid user ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	adminID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	var req model.MuteMemberRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	member, err := h.roomService.MuteMember(c.Request().Context(), roomID, userID, adminID, &req)
+	if err != nil {
+		logger.Error("Failed to update member mute state", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to update member mute state",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	message := "Member unmuted successfully"
+	if member.IsMuted {
+		message = "Member muted successfully"
+	}
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: message,
+		Data:    member,
+	})
+}
+
+// UpdateNotificationSettings sets which messages of the room notify the
+// current user
+func (h *RoomHandler) UpdateNotificationSettings(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	var req model.UpdateNotificationSettingsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.roomService.UpdateNotificationLevel(c.Request().Context(), roomID, userID, req.NotificationLevel); err != nil {
+		logger.Error("Failed to update notification settings", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to update notification settings",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Notification settings updated successfully",
+		Data: map[string]interface{}{
+			"room_id":            roomID,
+			"notification_level": req.NotificationLevel,
+		},
+	})
+}
+
+// TransferOwnership hands the room over to another member
+func (h *RoomHandler) TransferOwnership(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	var req model.TransferOwnershipRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.roomService.TransferOwnership(c.Request().Context(), roomID, userID, req.UserID); err != nil {
+		logger.Error("Failed to transfer room ownership", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to transfer room ownership",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Room ownership transferred successfully",
+		Data: map[string]interface{}{
+			"room_id":  roomID,
+			"owner_id": req.UserID,
+		},
+	})
+}
+
+func (h *RoomHandler) CreateInvite(c echo.Context) error {
+	roomIDStr := c.Param("id")
+	roomID, err := uuid.Parse(roomIDStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	var req model.CreateInviteRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	inviterUserID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	invite, err := h.roomService.CreateInvite(c.Request().Context(), roomID, inviterUserID, &req)
+	if err != nil {
+		logger.Error("Failed to create room invite", logger.WithField("error", err.Error()))
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Failed to create invite",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	return c.JSON(http.StatusCreated, model.APIResponse{
+		Success: true,
+		Message: "Room invite created successfully",
+		Data:    invite,
+	})
+}
+
+func (h *RoomHandler) AcceptInvite(c echo.Context) error {
+	inviteCodeStr := c.Param("invite_code")
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	room, err := h.roomService.AcceptInvite(c.Request().Context(), inviteCodeStr, userID)
+	if err != nil {
+		logger.Error("Failed to accept room invite", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to accept invite",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	// Join WebSocket room
+	websocket.GetHub().JoinRoom(userID, room.ID)
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Invite accepted successfully",
+		Data: map[string]interface{}{
+			"room": room,
+		},
+	})
+}
+
+func (h *RoomHandler) RejectInvite(c echo.Context) error {
+	inviteCodeStr := c.Param("invite_code")
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.roomService.RejectInvite(c.Request().Context(), inviteCodeStr, userID); err != nil {
+		logger.Error("Failed to reject room invite", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to reject invite",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Invite rejected successfully",
+	})
+}
+
+// GetRoomInvites lists the invites of a room for its admins
+func (h *RoomHandler) GetRoomInvites(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	adminID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	invites, err := h.roomService.GetRoomInvites(c.Request().Context(), roomID, adminID)
+	if err != nil {
+		logger.Error("Failed to get room invites", logger.WithFields(map[string]interface{}{
+			"room_id": roomID,
+			"user_id": adminID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to get room invites",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Room invites retrieved successfully",
+		Data:    invites,
+	})
+}
+
+// RevokeInvite expires an invite so its code can no longer be used
+func (h *RoomHandler) RevokeInvite(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	inviteID, err := uuid.Parse(c.Param("invite_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid invite ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	adminID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.roomService.RevokeInvite(c.Request().Context(), roomID, inviteID, adminID); err != nil {
+		logger.Error("Failed to revoke room invite", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to revoke invite",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Invite revoked successfully",
+	})
+}
+
+// CreateWebhook registers a webhook for a room. The response holds the
+// webhook secret, which isn't shown again.
+func (h *RoomHandler) CreateWebhook(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	var req model.CreateWebhookRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	adminID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	webhook, err := h.roomService.CreateWebhook(c.Request().Context(), roomID, adminID, &req)
+	if err != nil {
+		logger.Error("Failed to create room webhook", logger.WithFields(map[string]interface{}{
+			"room_id": roomID,
+			"user_id": adminID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to create webhook",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusCreated, model.APIResponse{
+		Success: true,
+		Message: "Room webhook created successfully",
+		Data:    webhook,
+	})
+}
+
+// ListWebhooks lists the webhooks of a room for its admins
+func (h *RoomHandler) ListWebhooks(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	adminID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	webhooks, err := h.roomService.ListWebhooks(c.Request().Context(), roomID, adminID)
+	if err != nil {
+		logger.Error("Failed to list room webhooks", logger.WithFields(map[string]interface{}{
+			"room_id": roomID,
+			"user_id": adminID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to list webhooks",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Room webhooks retrieved successfully",
+		Data:    webhooks,
+	})
+}
+
+// DeleteWebhook removes a webhook of a room
+func (h *RoomHandler) DeleteWebhook(c echo.Context) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	webhookID, err := uuid.Parse(c.Param("webhook_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid webhook ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	adminID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.roomService.DeleteWebhook(c.Request().Context(), roomID, webhookID, adminID); err != nil {
+		logger.Error("Failed to delete room webhook", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to delete webhook",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Room webhook deleted successfully",
+	})
+}
+
+// ListUserChatRooms returns paginated list of user's chat rooms for chat list display
+func (h *RoomHandler) ListUserChatRooms(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	// Get pagination parameters
+	page := 1
+	limit := 20
+
+	if pageParam := c.QueryParam("page"); pageParam != "" {
+		if p, err := strconv.Atoi(pageParam); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	if limitParam := c.QueryParam("limit"); limitParam != "" {
+		if l, err := strconv.Atoi(limitParam); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	includeArchived := false
+	if includeArchivedParam := c.QueryParam("include_archived"); includeArchivedParam != "" {
+		parsed, err := strconv.ParseBool(includeArchivedParam)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, model.APIResponse{
+				Success: false,
+				Message: "Invalid include_archived parameter",
+				Error:   errorResponse(http.StatusBadRequest, err),
+			})
+		}
+		includeArchived = parsed
+	}
+
+	rooms, meta, err := h.roomService.ListUserChatRooms(c.Request().Context(), userID, includeArchived, page, limit)
+	if err != nil {
+		logger.Error("Failed to get user chat rooms", logger.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(http.StatusInternalServerError, model.APIResponse{
+			Success: false,
+			Message: "Failed to get chat rooms",
+			Error:   errorResponse(http.StatusInternalServerError, err),
 		})
 	}
 
@@ -564,6 +1451,107 @@ func (h *RoomHandler) ListUserChatRooms(c echo.Context) error {
 	})
 }
 
+// ListArchivedRooms returns paginated list of the rooms the user archived
+func (h *RoomHandler) ListArchivedRooms(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	// Get pagination parameters
+	page := 1
+	limit := 20
+
+	if pageParam := c.QueryParam("page"); pageParam != "" {
+		if p, err := strconv.Atoi(pageParam); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	if limitParam := c.QueryParam("limit"); limitParam != "" {
+		if l, err := strconv.Atoi(limitParam); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	rooms, meta, err := h.roomService.ListArchivedRooms(c.Request().Context(), userID, page, limit)
+	if err != nil {
+		logger.Error("Failed to get archived rooms", logger.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(http.StatusInternalServerError, model.APIResponse{
+			Success: false,
+			Message: "Failed to get archived rooms",
+			Error:   errorResponse(http.StatusInternalServerError, err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Archived rooms retrieved successfully",
+		Data: map[string]interface{}{
+			"rooms": rooms,
+			"meta":  meta,
+		},
+	})
+}
+
+// ArchiveRoom hides a room from the current user's chat list, or makes it
+// read-only for everyone with ?mode=for_everyone
+func (h *RoomHandler) ArchiveRoom(c echo.Context) error {
+	return h.setRoomArchived(c, true)
+}
+
+// UnarchiveRoom moves a room back to the current user's chat list
+func (h *RoomHandler) UnarchiveRoom(c echo.Context) error {
+	return h.setRoomArchived(c, false)
+}
+
+func (h *RoomHandler) setRoomArchived(c echo.Context, archived bool) error {
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid room ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	// ?mode=for_everyone archives the room itself instead of the caller's view
+	mode := model.ArchiveForMe
+	if modeParam := c.QueryParam("mode"); modeParam != "" {
+		mode = model.ArchiveRoomMode(modeParam)
+	}
+
+	message := "Room unarchived successfully"
+	if archived {
+		message = "Room archived successfully"
+		err = h.roomService.ArchiveRoom(c.Request().Context(), roomID, userID, mode)
+	} else {
+		err = h.roomService.UnarchiveRoom(c.Request().Context(), roomID, userID, mode)
+	}
+
+	if err != nil {
+		logger.Error("Failed to update room archive state", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to update room archive state",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: message,
+	})
+}
+
 // CreateOrGetDirectRoom creates or gets an existing direct room between two users
 func (h *RoomHandler) CreateOrGetDirectRoom(c echo.Context) error {
 	userID, httpErr := RequireAuth(c)
@@ -577,6 +1565,7 @@ func (h *RoomHandler) CreateOrGetDirectRoom(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid user ID",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
@@ -585,6 +1574,7 @@ func (h *RoomHandler) CreateOrGetDirectRoom(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Cannot create direct room with yourself",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidRequest, "cannot create a direct room with yourself"),
 		})
 	}
 
@@ -595,10 +1585,10 @@ func (h *RoomHandler) CreateOrGetDirectRoom(c echo.Context) error {
 			"other_user_id":   otherUserID,
 			"error":           err.Error(),
 		}))
-		return c.JSON(http.StatusInternalServerError, model.APIResponse{
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
 			Message: "Failed to create or get direct room",
-			Error:   err.Error(),
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
@@ -1,6 +1,9 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"math"
 	"net/http"
 	"strconv"
 
@@ -29,54 +32,12 @@ func (h *UserHandler) RegisterUser(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid request body",
-			Error:   err.Error(),
+			Error:   errorResponse(http.StatusBadRequest, err),
 		})
 	}
 
-	// Validate required fields
-	if req.Username == "" {
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
-			Success: false,
-			Message: "Username is required",
-		})
-	}
-	if req.Email == "" {
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
-			Success: false,
-			Message: "Email is required",
-		})
-	}
-	if req.Password == "" {
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
-			Success: false,
-			Message: "Password is required",
-		})
-	}
-	if req.FirstName == "" {
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
-			Success: false,
-			Message: "First name is required",
-		})
-	}
-	if req.LastName == "" {
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
-			Success: false,
-			Message: "Last name is required",
-		})
-	}
-
-	// Additional validation
-	if len(req.Username) < 3 {
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
-			Success: false,
-			Message: "Username must be at least 3 characters long",
-		})
-	}
-	if len(req.Password) < 6 {
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
-			Success: false,
-			Message: "Password must be at least 6 characters long",
-		})
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
 	// Create user
@@ -89,19 +50,21 @@ func (h *UserHandler) RegisterUser(c echo.Context) error {
 			return c.JSON(http.StatusConflict, model.APIResponse{
 				Success: false,
 				Message: "Email address is already registered",
+				Error:   model.NewErrorResponse(model.ErrCodeEmailTaken, err.Error()),
 			})
 		}
 		if err.Error() == "username "+req.Username+" already taken" {
 			return c.JSON(http.StatusConflict, model.APIResponse{
 				Success: false,
 				Message: "Username is already taken",
+				Error:   model.NewErrorResponse(model.ErrCodeUsernameTaken, err.Error()),
 			})
 		}
 
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Failed to register user",
-			Error:   "Registration failed, please try again",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidRequest, "Registration failed, please try again"),
 		})
 	}
 
@@ -162,28 +125,12 @@ func (h *UserHandler) CreateUser(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid request body",
-			Error:   err.Error(),
+			Error:   errorResponse(http.StatusBadRequest, err),
 		})
 	}
 
-	// TODO: Add validation here
-	if req.Username == "" {
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
-			Success: false,
-			Message: "Username is required",
-		})
-	}
-	if req.Password == "" {
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
-			Success: false,
-			Message: "Password is required",
-		})
-	}
-	if req.Email == "" {
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
-			Success: false,
-			Message: "Email is required",
-		})
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
 	user, err := h.userService.CreateUser(c.Request().Context(), &req)
@@ -192,7 +139,7 @@ func (h *UserHandler) CreateUser(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Failed to create user",
-			Error:   err.Error(),
+			Error:   errorResponse(http.StatusBadRequest, err),
 		})
 	}
 
@@ -213,7 +160,7 @@ func (h *UserHandler) GetUser(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid user ID format",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
@@ -226,11 +173,13 @@ func (h *UserHandler) GetUser(c echo.Context) error {
 		return c.JSON(http.StatusNotFound, model.APIResponse{
 			Success: false,
 			Message: "User not found",
+			Error:   model.NewErrorResponse(model.ErrCodeUserNotFound, err.Error()),
 		})
 	}
 
 	// Remove password from response
 	user.Password = ""
+	user.Status = user.VisibleStatus()
 
 	return c.JSON(http.StatusOK, model.APIResponse{
 		Success: true,
@@ -239,272 +188,869 @@ func (h *UserHandler) GetUser(c echo.Context) error {
 	})
 }
 
-func (h *UserHandler) ListUsers(c echo.Context) error {
-	pageStr := c.QueryParam("page")
-	limitStr := c.QueryParam("limit")
-
-	page := 1
-	limit := 10
-
-	if pageStr != "" {
-		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-			page = p
-		}
-	}
-
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
-		}
+// GetMyProfile returns the full profile of the current user
+func (h *UserHandler) GetMyProfile(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	users, meta, err := h.userService.ListUsers(c.Request().Context(), page, limit)
+	profile, err := h.userService.GetUserProfile(c.Request().Context(), userID)
 	if err != nil {
-		logger.Error("Failed to list users", logger.WithField("error", err.Error()))
-		return c.JSON(http.StatusInternalServerError, model.APIResponse{
+		logger.Error("Failed to get profile", logger.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
-			Message: "Failed to retrieve users",
-			Error:   err.Error(),
+			Message: "Failed to get profile",
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
-	// Remove passwords from response
-	for _, user := range users {
-		user.Password = ""
-	}
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Profile retrieved successfully",
+		Data:    profile,
+	})
+}
 
-	response := model.PaginatedResponse{
-		APIResponse: model.APIResponse{
-			Success: true,
-			Message: "Users retrieved successfully",
-			Data:    users,
-		},
-		Meta: *meta,
+// UpdateMyProfile changes the profile of the current user
+func (h *UserHandler) UpdateMyProfile(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	return c.JSON(http.StatusOK, response)
-}
-
-func (h *UserHandler) LoginUser(c echo.Context) error {
-	var req model.LoginRequest
+	var req model.UpdateProfileRequest
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid request body",
-			Error:   err.Error(),
+			Error:   errorResponse(http.StatusBadRequest, err),
 		})
 	}
 
-	user, err := h.userService.AuthenticateUser(c.Request().Context(), &req)
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	profile, err := h.userService.UpdateUserProfile(c.Request().Context(), userID, &req)
 	if err != nil {
-		return c.JSON(http.StatusUnauthorized, model.APIResponse{
+		logger.Error("Failed to update profile", logger.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
-			Message: "Authentication failed",
-			Error:   "Invalid credentials",
+			Message: "Failed to update profile",
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
-	// Remove password from response
-	user.Password = ""
-
-	// Generate JWT token with session
-	sessionID := uuid.New()
-	deviceID := c.Request().Header.Get("User-Agent") // Use User-Agent as device identifier
-	if deviceID == "" {
-		deviceID = "unknown-device"
-	}
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Profile updated successfully",
+		Data:    profile,
+	})
+}
 
-	jwtService := jwt.GetService()
-	if jwtService == nil {
-		logger.Error("JWT service not initialized")
-		return c.JSON(http.StatusInternalServerError, model.APIResponse{
-			Success: false,
-			Message: "Authentication service unavailable",
-		})
+// GetMySettings returns the account settings of the current user
+func (h *UserHandler) GetMySettings(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	accessToken, refreshToken, expiresAt, err := jwtService.GenerateTokens(user, sessionID, deviceID)
+	settings, err := h.userService.GetUserSettings(c.Request().Context(), userID)
 	if err != nil {
-		logger.Error("Failed to generate JWT tokens", logger.WithField("error", err.Error()))
-		return c.JSON(http.StatusInternalServerError, model.APIResponse{
+		logger.Error("Failed to get settings", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
-			Message: "Failed to generate authentication tokens",
+			Message: "Failed to get settings",
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
 	return c.JSON(http.StatusOK, model.APIResponse{
 		Success: true,
-		Message: "Login successful",
-		Data: map[string]interface{}{
-			"user":          user,
-			"access_token":  accessToken,
-			"refresh_token": refreshToken,
-			"expires_at":    expiresAt,
-			"session_id":    sessionID,
-		},
+		Message: "Settings retrieved successfully",
+		Data:    settings,
 	})
 }
 
-func (h *UserHandler) RefreshToken(c echo.Context) error {
-	// Get refresh token from Authorization header
-	authHeader := c.Request().Header.Get("Authorization")
-	if authHeader == "" {
+// UpdateMySettings changes the given account settings of the current user
+func (h *UserHandler) UpdateMySettings(c echo.Context) error {
+	var req model.UpdateUserSettingsRequest
+	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
-			Message: "Authorization header is required",
-			Error:   "Missing Authorization header",
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
 		})
 	}
 
-	// Extract token from "Bearer <token>" format
-	var refreshToken string
-	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-		refreshToken = authHeader[7:]
-	} else {
-		// Try to get token directly if not in Bearer format
-		refreshToken = authHeader
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	if refreshToken == "" {
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
-			Success: false,
-			Message: "Invalid authorization header format",
-			Error:   "Expected 'Bearer <token>' format",
-		})
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	// Validate and refresh the token
-	jwtService := jwt.GetService()
-	if jwtService == nil {
-		logger.Error("JWT service not initialized")
-		return c.JSON(http.StatusInternalServerError, model.APIResponse{
+	settings, err := h.userService.UpdateUserSettings(c.Request().Context(), userID, &req)
+	if err != nil {
+		logger.Error("Failed to update settings", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
-			Message: "Authentication service unavailable",
+			Message: "Failed to update settings",
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
-	// Generate new access token using refresh token
-	newAccessToken, expiresAt, err := jwtService.RefreshAccessToken(refreshToken)
-	if err != nil {
-		logger.Warn("Invalid refresh token attempt", logger.WithFields(map[string]interface{}{
-			"error": err.Error(),
-			"ip":    c.RealIP(),
-		}))
-		return c.JSON(http.StatusUnauthorized, model.APIResponse{
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Settings updated successfully",
+		Data:    settings,
+	})
+}
+
+// UpdateMyStatus changes the status of the current user. Invisible users
+// keep receiving messages but appear offline to everyone else.
+func (h *UserHandler) UpdateMyStatus(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	var req model.WSUserStatusRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
-			Message: "Invalid or expired refresh token",
-			Error:   "Token refresh failed",
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
 		})
 	}
 
-	// Get user info from the original refresh token claims for response
-	claims, err := jwtService.ValidateToken(refreshToken)
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	user, err := h.userService.SetUserStatus(c.Request().Context(), userID, model.UserStatus(req.Status))
 	if err != nil {
-		logger.Error("Failed to validate refresh token claims", logger.WithField("error", err.Error()))
-		return c.JSON(http.StatusUnauthorized, model.APIResponse{
+		logger.Error("Failed to update status", logger.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
-			Message: "Invalid refresh token",
+			Message: "Failed to update status",
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
-	logger.Info("Token refreshed successfully", logger.WithFields(map[string]interface{}{
-		"user_id":    claims.UserID,
-		"session_id": claims.SessionID,
-		"ip":         c.RealIP(),
-	}))
-
 	return c.JSON(http.StatusOK, model.APIResponse{
 		Success: true,
-		Message: "Token refreshed successfully",
+		Message: "Status updated successfully",
 		Data: map[string]interface{}{
-			"access_token": newAccessToken,
-			"expires_at":   expiresAt,
-			"token_type":   "Bearer",
-			"user_id":      claims.UserID,
-			"session_id":   claims.SessionID,
+			"status":         user.Status,
+			"visible_status": user.VisibleStatus(),
 		},
 	})
 }
 
-func (h *UserHandler) UpdateUser(c echo.Context) error {
-	idStr := c.Param("id")
-	id, err := uuid.Parse(idStr)
+// GetUserProfile returns the public part of another user's profile
+func (h *UserHandler) GetUserProfile(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, model.APIResponse{
 			Success: false,
 			Message: "Invalid user ID format",
-			Error:   err.Error(),
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
 		})
 	}
 
-	// Get existing user
-	user, err := h.userService.GetUserByID(c.Request().Context(), id)
-	if err != nil {
-		return c.JSON(http.StatusNotFound, model.APIResponse{
-			Success: false,
-			Message: "User not found",
-			Error:   err.Error(),
-		})
+	viewerID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	// Bind updates (partial update)
-	var updates map[string]interface{}
-	if err := c.Bind(&updates); err != nil {
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
+	profile, err := h.userService.GetPublicProfile(c.Request().Context(), viewerID, id)
+	if err != nil {
+		logger.Error("Failed to get user profile", logger.WithFields(map[string]interface{}{
+			"user_id": id,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
 			Success: false,
-			Message: "Invalid request body",
-			Error:   err.Error(),
+			Message: "Failed to get user profile",
+			Error:   errorResponse(statusForError(err), err),
 		})
 	}
 
-	// Apply updates (simplified - in real app, you'd want proper validation)
-	if username, ok := updates["username"].(string); ok {
-		user.Username = username
-	}
-	if email, ok := updates["email"].(string); ok {
-		user.Email = email
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "User profile retrieved successfully",
+		Data:    profile,
+	})
+}
+
+func (h *UserHandler) ListUsers(c echo.Context) error {
+	pageStr := c.QueryParam("page")
+	limitStr := c.QueryParam("limit")
+
+	page := 1
+	limit := 10
+
+	if pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
 	}
-	if isActive, ok := updates["is_active"].(bool); ok {
-		user.IsActive = isActive
+
+	if limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
 	}
 
-	if err := h.userService.UpdateUser(c.Request().Context(), user); err != nil {
-		logger.Error("Failed to update user", logger.WithField("error", err.Error()))
+	users, meta, err := h.userService.ListUsers(c.Request().Context(), page, limit)
+	if err != nil {
+		logger.Error("Failed to list users", logger.WithField("error", err.Error()))
 		return c.JSON(http.StatusInternalServerError, model.APIResponse{
 			Success: false,
-			Message: "Failed to update user",
-			Error:   err.Error(),
+			Message: "Failed to retrieve users",
+			Error:   errorResponse(http.StatusInternalServerError, err),
 		})
 	}
 
-	// Remove password from response
-	user.Password = ""
+	// Remove passwords from response
+	for _, user := range users {
+		user.Password = ""
+	}
 
-	return c.JSON(http.StatusOK, model.APIResponse{
-		Success: true,
-		Message: "User updated successfully",
-		Data:    user,
-	})
+	response := model.PaginatedResponse{
+		APIResponse: model.APIResponse{
+			Success: true,
+			Message: "Users retrieved successfully",
+			Data:    users,
+		},
+		Meta: *meta,
+	}
+
+	return c.JSON(http.StatusOK, response)
 }
 
-func (h *UserHandler) DeleteUser(c echo.Context) error {
-	idStr := c.Param("id")
-	id, err := uuid.Parse(idStr)
-	if err != nil {
-		return c.JSON(http.StatusBadRequest, model.APIResponse{
-			Success: false,
-			Message: "Invalid user ID format",
-			Error:   err.Error(),
-		})
+// SearchUsers searches users by username, name or email with optional filters
+func (h *UserHandler) SearchUsers(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
 	}
 
-	if err := h.userService.DeleteUser(c.Request().Context(), id); err != nil {
-		logger.Error("Failed to delete user", logger.WithField("error", err.Error()))
-		return c.JSON(http.StatusInternalServerError, model.APIResponse{
-			Success: false,
-			Message: "Failed to delete user",
-			Error:   err.Error(),
-		})
+	page := 1
+	limit := 10
+
+	if pageStr := c.QueryParam("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	if limitStr := c.QueryParam("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	filters := model.UserSearchFilter{
+		RequesterID: userID,
+		Status:      c.QueryParam("status"),
+	}
+
+	if isActiveStr := c.QueryParam("is_active"); isActiveStr != "" {
+		isActive, err := strconv.ParseBool(isActiveStr)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, model.APIResponse{
+				Success: false,
+				Message: "Invalid is_active parameter",
+				Error:   errorResponse(http.StatusBadRequest, err),
+			})
+		}
+		filters.IsActive = &isActive
+	}
+
+	if hasContactStr := c.QueryParam("has_contact"); hasContactStr != "" {
+		hasContact, err := strconv.ParseBool(hasContactStr)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, model.APIResponse{
+				Success: false,
+				Message: "Invalid has_contact parameter",
+				Error:   errorResponse(http.StatusBadRequest, err),
+			})
+		}
+		filters.HasContact = &hasContact
+	}
+
+	users, meta, err := h.userService.SearchUsers(c.Request().Context(), c.QueryParam("q"), filters, page, limit)
+	if err != nil {
+		logger.Error("Failed to search users", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to search users",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	// Remove passwords from response
+	for _, user := range users {
+		user.Password = ""
+	}
+
+	response := model.PaginatedResponse{
+		APIResponse: model.APIResponse{
+			Success: true,
+			Message: "Users retrieved successfully",
+			Data:    users,
+		},
+		Meta: *meta,
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+func (h *UserHandler) LoginUser(c echo.Context) error {
+	var req model.LoginRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	// Fall back to the User-Agent when the client doesn't identify its device
+	req.IPAddress = c.RealIP()
+	req.UserAgent = c.Request().Header.Get("User-Agent")
+	if req.DeviceID == "" {
+		req.DeviceID = req.UserAgent
+	}
+	if req.DeviceID == "" {
+		req.DeviceID = "unknown-device"
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	login, err := h.userService.AuthenticateUser(c.Request().Context(), &req)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, model.APIResponse{
+			Success: false,
+			Message: "Authentication failed",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidCredentials, "Invalid credentials"),
+		})
+	}
+
+	// Remove password from response
+	login.User.Password = ""
+
+	message := "Login successful"
+	if login.Requires2FA {
+		message = "Two-factor code required"
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: message,
+		Data:    login,
+	})
+}
+
+// ValidateTwoFactorLogin completes a login that requires a two-factor code
+func (h *UserHandler) ValidateTwoFactorLogin(c echo.Context) error {
+	var req model.TwoFactorLoginRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	login, err := h.userService.ValidateTwoFactorLogin(c.Request().Context(), &req)
+	if err != nil {
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Authentication failed",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	login.User.Password = ""
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Login successful",
+		Data:    login,
+	})
+}
+
+// EnableTOTP starts setting up two-factor authentication for the current
+// user, returning the secret to add to an authenticator app
+func (h *UserHandler) EnableTOTP(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	setup, err := h.userService.EnableTOTP(c.Request().Context(), userID)
+	if err != nil {
+		logger.Error("Failed to enable two-factor authentication", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to enable two-factor authentication",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Add the secret to your authenticator app and verify a code to finish",
+		Data:    setup,
+	})
+}
+
+// VerifyTOTP checks a code of the current user's authenticator app, which
+// finishes enabling two-factor authentication
+func (h *UserHandler) VerifyTOTP(c echo.Context) error {
+	return h.totpCode(c, h.userService.VerifyTOTP, "Two-factor code verified")
+}
+
+// DisableTOTP turns two-factor authentication off for the current user
+func (h *UserHandler) DisableTOTP(c echo.Context) error {
+	return h.totpCode(c, h.userService.DisableTOTP, "Two-factor authentication disabled")
+}
+
+// totpCode handles the two-factor requests that take a code of the current
+// user's authenticator app
+func (h *UserHandler) totpCode(c echo.Context, action func(ctx context.Context, userID uuid.UUID, code string) error, message string) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	var req model.TOTPCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := action(c.Request().Context(), userID, req.Code); err != nil {
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Invalid two-factor code",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: message,
+	})
+}
+
+func (h *UserHandler) RefreshToken(c echo.Context) error {
+	// Get refresh token from Authorization header
+	authHeader := c.Request().Header.Get("Authorization")
+	if authHeader == "" {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Authorization header is required",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidRequest, "Missing Authorization header"),
+		})
+	}
+
+	// Extract token from "Bearer <token>" format
+	var refreshToken string
+	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
+		refreshToken = authHeader[7:]
+	} else {
+		// Try to get token directly if not in Bearer format
+		refreshToken = authHeader
+	}
+
+	if refreshToken == "" {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid authorization header format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidRequest, "Expected 'Bearer <token>' format"),
+		})
+	}
+
+	// Validate and refresh the token for a session that is still active
+	newAccessToken, expiresAt, claims, err := h.userService.RefreshSession(c.Request().Context(), refreshToken)
+	if err != nil {
+		logger.Warn("Invalid refresh token attempt", logger.WithFields(map[string]interface{}{
+			"error": err.Error(),
+			"ip":    c.RealIP(),
+		}))
+		if statusForError(err) == http.StatusInternalServerError {
+			return c.JSON(http.StatusInternalServerError, model.APIResponse{
+				Success: false,
+				Message: "Failed to refresh token",
+				Error:   errorResponse(http.StatusInternalServerError, err),
+			})
+		}
+		return c.JSON(http.StatusUnauthorized, model.APIResponse{
+			Success: false,
+			Message: "Invalid or expired refresh token",
+			Error:   model.NewErrorResponse(model.ErrCodeUnauthorized, "Token refresh failed"),
+		})
+	}
+
+	logger.Info("Token refreshed successfully", logger.WithFields(map[string]interface{}{
+		"user_id":    claims.UserID,
+		"session_id": claims.SessionID,
+		"ip":         c.RealIP(),
+	}))
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Token refreshed successfully",
+		Data: map[string]interface{}{
+			"access_token": newAccessToken,
+			"expires_at":   expiresAt,
+			"token_type":   "Bearer",
+			"user_id":      claims.UserID,
+			"session_id":   claims.SessionID,
+		},
+	})
+}
+
+// ListSessions lists the active sessions of the current user
+func (h *UserHandler) ListSessions(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	sessions, err := h.userService.ListSessions(c.Request().Context(), userID)
+	if err != nil {
+		logger.Error("Failed to list sessions", logger.WithField("error", err.Error()))
+		return c.JSON(http.StatusInternalServerError, model.APIResponse{
+			Success: false,
+			Message: "Failed to retrieve sessions",
+			Error:   errorResponse(http.StatusInternalServerError, err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Sessions retrieved successfully",
+		Data:    sessions,
+	})
+}
+
+// RegisterFCMToken stores the push notification token of the current
+// session's device
+func (h *UserHandler) RegisterFCMToken(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+	sessionID, err := GetSessionIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, model.APIResponse{
+			Success: false,
+			Message: "Invalid token",
+			Error:   model.NewErrorResponse(model.ErrCodeUnauthorized, err.Error()),
+		})
+	}
+
+	var req model.RegisterFCMTokenRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.userService.RegisterFCMToken(c.Request().Context(), userID, sessionID, req.FCMToken); err != nil {
+		logger.Error("Failed to register FCM token", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to register FCM token",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "FCM token registered successfully",
+	})
+}
+
+// RevokeSession signs one of the current user's devices out
+func (h *UserHandler) RevokeSession(c echo.Context) error {
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid session ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.userService.RevokeSession(c.Request().Context(), userID, sessionID); err != nil {
+		logger.Error("Failed to revoke session", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to revoke session",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Session revoked successfully",
+	})
+}
+
+// Logout revokes the session of the presented access token
+func (h *UserHandler) Logout(c echo.Context) error {
+	token, err := extractTokenFromHeader(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, model.APIResponse{
+			Success: false,
+			Message: "Authentication required",
+			Error:   errorResponse(http.StatusUnauthorized, err),
+		})
+	}
+
+	if err := h.userService.Logout(c.Request().Context(), token); err != nil {
+		logger.Error("Failed to log out", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to log out",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Logged out successfully",
+	})
+}
+
+// ChangePassword replaces the password of the current user and signs out
+// their other sessions
+func (h *UserHandler) ChangePassword(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+	sessionID, err := GetSessionIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, model.APIResponse{
+			Success: false,
+			Message: "Invalid token",
+			Error:   model.NewErrorResponse(model.ErrCodeUnauthorized, err.Error()),
+		})
+	}
+
+	var req model.ChangePasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.userService.ChangePassword(c.Request().Context(), userID, sessionID, &req); err != nil {
+		logger.Error("Failed to change password", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to change password",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Password changed successfully",
+	})
+}
+
+// ForgotPassword sends a password reset token to the user with the email.
+// It answers the same whether or not the email belongs to an account.
+func (h *UserHandler) ForgotPassword(c echo.Context) error {
+	var req model.ForgotPasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	err := h.userService.ForgotPassword(c.Request().Context(), req.Email, c.RealIP())
+	var rateLimited *service.RateLimitError
+	if errors.As(err, &rateLimited) {
+		retryAfter := int(math.Ceil(rateLimited.RetryAfter.Seconds()))
+		c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		return c.JSON(http.StatusTooManyRequests, model.APIResponse{
+			Success: false,
+			Message: "Too many password reset requests",
+			Data:    map[string]interface{}{"retry_after": retryAfter},
+			Error:   errorResponse(http.StatusTooManyRequests, err).WithDetail("retry_after", retryAfter),
+		})
+	}
+	if err != nil {
+		logger.Error("Failed to request password reset", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to request password reset",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "If the email belongs to an account, a password reset link has been sent",
+	})
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword
+func (h *UserHandler) ResetPassword(c echo.Context) error {
+	var req model.ResetPasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.userService.ResetPassword(c.Request().Context(), req.Token, req.NewPassword); err != nil {
+		logger.Error("Failed to reset password", logger.WithField("error", err.Error()))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to reset password",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Password reset successfully",
+	})
+}
+
+// UpdateUser changes the account of the user in the path, which has to be
+// the current user unless they are an admin
+func (h *UserHandler) UpdateUser(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid user ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	actorID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	var req model.UpdateUserRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	user, err := h.userService.UpdateUser(c.Request().Context(), actorID, id, &req)
+	if err != nil {
+		logger.Error("Failed to update user", logger.WithFields(map[string]interface{}{
+			"user_id":  id,
+			"actor_id": actorID,
+			"error":    err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to update user",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "User updated successfully",
+		Data:    user,
+	})
+}
+
+func (h *UserHandler) DeleteUser(c echo.Context) error {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid user ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	if err := h.userService.DeleteUser(c.Request().Context(), id); err != nil {
+		logger.Error("Failed to delete user", logger.WithField("error", err.Error()))
+		return c.JSON(http.StatusInternalServerError, model.APIResponse{
+			Success: false,
+			Message: "Failed to delete user",
+			Error:   errorResponse(http.StatusInternalServerError, err),
+		})
 	}
 
 	return c.JSON(http.StatusOK, model.APIResponse{
@@ -512,3 +1058,428 @@ func (h *UserHandler) DeleteUser(c echo.Context) error {
 		Message: "User deleted successfully",
 	})
 }
+
+// ActivateUser lets a deactivated user log in again
+func (h *UserHandler) ActivateUser(c echo.Context) error {
+	return h.setUserActive(c, true)
+}
+
+// DeactivateUser blocks a user from logging in and ends their sessions
+func (h *UserHandler) DeactivateUser(c echo.Context) error {
+	return h.setUserActive(c, false)
+}
+
+func (h *UserHandler) setUserActive(c echo.Context, active bool) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid user ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	if err := h.userService.SetUserActive(c.Request().Context(), id, active); err != nil {
+		logger.Error("Failed to change user active state", logger.WithFields(map[string]interface{}{
+			"user_id": id,
+			"error":   err.Error(),
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to update user",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	message := "User deactivated successfully"
+	if active {
+		message = "User activated successfully"
+	}
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: message,
+	})
+}
+
+// SendContactRequest asks another user to become a contact
+func (h *UserHandler) SendContactRequest(c echo.Context) error {
+	contactID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid user ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	return h.sendContactRequest(c, contactID)
+}
+
+// CreateContact asks the user given in the request body to become a contact
+func (h *UserHandler) CreateContact(c echo.Context) error {
+	var req model.CreateContactRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	return h.sendContactRequest(c, req.ContactID)
+}
+
+func (h *UserHandler) sendContactRequest(c echo.Context, contactID uuid.UUID) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	contact, err := h.userService.SendContactRequest(c.Request().Context(), userID, contactID)
+	if err != nil {
+		logger.Error("Failed to send contact request", logger.WithFields(map[string]interface{}{
+			"error":      err.Error(),
+			"user_id":    userID,
+			"contact_id": contactID,
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to send contact request",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusCreated, model.APIResponse{
+		Success: true,
+		Message: "Contact request sent successfully",
+		Data:    contact,
+	})
+}
+
+// AcceptContactRequest accepts a contact request sent to the current user
+func (h *UserHandler) AcceptContactRequest(c echo.Context) error {
+	requestID, err := uuid.Parse(c.Param("contact_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid contact request ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	contact, err := h.userService.AcceptContactRequest(c.Request().Context(), userID, requestID)
+	if err != nil {
+		logger.Error("Failed to accept contact request", logger.WithFields(map[string]interface{}{
+			"error":      err.Error(),
+			"user_id":    userID,
+			"request_id": requestID,
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to accept contact request",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Contact request accepted successfully",
+		Data:    contact,
+	})
+}
+
+// RejectContactRequest declines a contact request sent to the current user
+func (h *UserHandler) RejectContactRequest(c echo.Context) error {
+	requestID, err := uuid.Parse(c.Param("contact_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid contact request ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.userService.RejectContactRequest(c.Request().Context(), userID, requestID); err != nil {
+		logger.Error("Failed to reject contact request", logger.WithFields(map[string]interface{}{
+			"error":      err.Error(),
+			"user_id":    userID,
+			"request_id": requestID,
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to reject contact request",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Contact request rejected successfully",
+	})
+}
+
+// GetPendingContactRequests lists the contact requests awaiting the current user
+func (h *UserHandler) GetPendingContactRequests(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	requests, err := h.userService.GetPendingRequests(c.Request().Context(), userID)
+	if err != nil {
+		logger.Error("Failed to get pending contact requests", logger.WithFields(map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": userID,
+		}))
+		return c.JSON(http.StatusInternalServerError, model.APIResponse{
+			Success: false,
+			Message: "Failed to get pending contact requests",
+			Error:   errorResponse(http.StatusInternalServerError, err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Pending contact requests retrieved successfully",
+		Data:    requests,
+	})
+}
+
+// ListContacts lists the current user's contacts, optionally filtered by the
+// status query parameter
+func (h *UserHandler) ListContacts(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	contacts, err := h.userService.ListContacts(c.Request().Context(), userID, model.ContactStatus(c.QueryParam("status")))
+	if err != nil {
+		logger.Error("Failed to list contacts", logger.WithFields(map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": userID,
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to list contacts",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Contacts retrieved successfully",
+		Data:    contacts,
+	})
+}
+
+// UpdateContact sets the nickname and notes of one of the current user's contacts
+func (h *UserHandler) UpdateContact(c echo.Context) error {
+	contactID, err := uuid.Parse(c.Param("contact_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid contact ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	var req model.UpdateContactRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	contact, err := h.userService.UpdateContact(c.Request().Context(), userID, contactID, &req)
+	if err != nil {
+		logger.Error("Failed to update contact", logger.WithFields(map[string]interface{}{
+			"error":      err.Error(),
+			"user_id":    userID,
+			"contact_id": contactID,
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to update contact",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Contact updated successfully",
+		Data:    contact,
+	})
+}
+
+// RemoveContact deletes one of the current user's contacts
+func (h *UserHandler) RemoveContact(c echo.Context) error {
+	contactID, err := uuid.Parse(c.Param("contact_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid contact ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.userService.RemoveContact(c.Request().Context(), userID, contactID); err != nil {
+		logger.Error("Failed to remove contact", logger.WithFields(map[string]interface{}{
+			"error":      err.Error(),
+			"user_id":    userID,
+			"contact_id": contactID,
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to remove contact",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Contact removed successfully",
+	})
+}
+
+// BlockUser blocks another user for the current user
+func (h *UserHandler) BlockUser(c echo.Context) error {
+	blockedID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid user ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	var req model.BlockUserRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   errorResponse(http.StatusBadRequest, err),
+		})
+	}
+
+	if httpErr := ValidateRequest(c, &req); httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	block, err := h.userService.BlockUser(c.Request().Context(), userID, blockedID, req.Reason)
+	if err != nil {
+		logger.Error("Failed to block user", logger.WithFields(map[string]interface{}{
+			"error":      err.Error(),
+			"user_id":    userID,
+			"blocked_id": blockedID,
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to block user",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "User blocked successfully",
+		Data:    block,
+	})
+}
+
+// UnblockUser lifts a block the current user put on another user
+func (h *UserHandler) UnblockUser(c echo.Context) error {
+	blockedID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, model.APIResponse{
+			Success: false,
+			Message: "Invalid user ID format",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+		})
+	}
+
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	if err := h.userService.UnblockUser(c.Request().Context(), userID, blockedID); err != nil {
+		logger.Error("Failed to unblock user", logger.WithFields(map[string]interface{}{
+			"error":      err.Error(),
+			"user_id":    userID,
+			"blocked_id": blockedID,
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to unblock user",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "User unblocked successfully",
+	})
+}
+
+// ListBlockedUsers lists the users the current user blocked
+func (h *UserHandler) ListBlockedUsers(c echo.Context) error {
+	userID, httpErr := RequireAuth(c)
+	if httpErr != nil {
+		return c.JSON(httpErr.Code, httpErr.Message)
+	}
+
+	blocks, err := h.userService.ListBlockedUsers(c.Request().Context(), userID)
+	if err != nil {
+		logger.Error("Failed to list blocked users", logger.WithFields(map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": userID,
+		}))
+		return c.JSON(statusForError(err), model.APIResponse{
+			Success: false,
+			Message: "Failed to list blocked users",
+			Error:   errorResponse(statusForError(err), err),
+		})
+	}
+
+	return c.JSON(http.StatusOK, model.APIResponse{
+		Success: true,
+		Message: "Blocked users retrieved successfully",
+		Data:    blocks,
+	})
+}
@@ -1,12 +1,19 @@
 package handler
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"realtime-api/internal/jwt"
 	"realtime-api/internal/model"
+	"realtime-api/internal/redis"
+	"realtime-api/internal/service"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -29,7 +36,7 @@ func extractTokenFromHeader(c echo.Context) (string, error) {
 }
 
 // validateTokenAndGetClaims validates JWT token and returns claims
-func validateTokenAndGetClaims(tokenString string) (*jwt.Claims, error) {
+func validateTokenAndGetClaims(ctx context.Context, tokenString string) (*jwt.Claims, error) {
 	jwtService := jwt.GetService()
 	if jwtService == nil {
 		return nil, fmt.Errorf("JWT service not initialized")
@@ -40,6 +47,15 @@ func validateTokenAndGetClaims(tokenString string) (*jwt.Claims, error) {
 		return nil, fmt.Errorf("invalid token: %w", err)
 	}
 
+	// Reject tokens of revoked sessions
+	revoked, err := redis.GetClient().IsTokenBlacklisted(ctx, claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check token blacklist: %w", err)
+	}
+	if revoked {
+		return nil, fmt.Errorf("token has been revoked")
+	}
+
 	return claims, nil
 }
 
@@ -50,7 +66,7 @@ func GetUserIDFromContext(c echo.Context) (uuid.UUID, error) {
 		return uuid.Nil, err
 	}
 
-	claims, err := validateTokenAndGetClaims(token)
+	claims, err := validateTokenAndGetClaims(c.Request().Context(), token)
 	if err != nil {
 		return uuid.Nil, err
 	}
@@ -65,12 +81,91 @@ func RequireAuth(c echo.Context) (uuid.UUID, *echo.HTTPError) {
 		return uuid.Nil, echo.NewHTTPError(http.StatusUnauthorized, model.APIResponse{
 			Success: false,
 			Message: "Authentication required",
-			Error:   err.Error(),
+			Error:   errorResponse(http.StatusUnauthorized, err),
 		})
 	}
 	return userID, nil
 }
 
+// statusForError maps a service error to an HTTP status code. Errors that
+// don't wrap one of the service sentinels are internal failures.
+func statusForError(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidArgument):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrRateLimited):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// errorCode maps an error to a machine readable code. Errors that don't wrap
+// one of the service sentinels get the code of the response status.
+func errorCode(status int, err error) string {
+	switch {
+	case errors.Is(err, service.ErrRoomNotFound):
+		return model.ErrCodeRoomNotFound
+	case errors.Is(err, service.ErrMessageNotFound):
+		return model.ErrCodeMessageNotFound
+	case errors.Is(err, service.ErrUserNotFound):
+		return model.ErrCodeUserNotFound
+	case errors.Is(err, service.ErrRoomFull):
+		return model.ErrCodeRoomFull
+	case errors.Is(err, service.ErrRoomArchived):
+		return model.ErrCodeRoomArchived
+	case errors.Is(err, service.ErrMessageTypeDisabled):
+		return model.ErrCodeMessageTypeDisabled
+	case errors.Is(err, service.ErrEmailTaken):
+		return model.ErrCodeEmailTaken
+	case errors.Is(err, service.ErrUsernameTaken):
+		return model.ErrCodeUsernameTaken
+	case errors.Is(err, service.ErrInvalidArgument):
+		return model.ErrCodeInvalidRequest
+	case errors.Is(err, service.ErrForbidden):
+		return model.ErrCodeAccessDenied
+	case errors.Is(err, service.ErrNotFound):
+		return model.ErrCodeNotFound
+	case errors.Is(err, service.ErrConflict):
+		return model.ErrCodeConflict
+	case errors.Is(err, service.ErrRateLimited):
+		return model.ErrCodeRateLimitExceeded
+	}
+
+	switch status {
+	case http.StatusBadRequest:
+		return model.ErrCodeInvalidRequest
+	case http.StatusUnauthorized:
+		return model.ErrCodeUnauthorized
+	case http.StatusForbidden:
+		return model.ErrCodeAccessDenied
+	case http.StatusNotFound:
+		return model.ErrCodeNotFound
+	case http.StatusConflict:
+		return model.ErrCodeConflict
+	case http.StatusTooManyRequests:
+		return model.ErrCodeRateLimitExceeded
+	case http.StatusServiceUnavailable:
+		return model.ErrCodeServiceUnavailable
+	default:
+		return model.ErrCodeInternal
+	}
+}
+
+// errorResponse describes err for the error field of a response sent with
+// status
+func errorResponse(status int, err error) *model.ErrorResponse {
+	return model.NewErrorResponse(errorCode(status, err), err.Error())
+}
+
 // GetUsernameFromContext extracts the username from the JWT token in Authorization header
 func GetUsernameFromContext(c echo.Context) (string, error) {
 	token, err := extractTokenFromHeader(c)
@@ -78,7 +173,7 @@ func GetUsernameFromContext(c echo.Context) (string, error) {
 		return "", err
 	}
 
-	claims, err := validateTokenAndGetClaims(token)
+	claims, err := validateTokenAndGetClaims(c.Request().Context(), token)
 	if err != nil {
 		return "", err
 	}
@@ -93,7 +188,7 @@ func GetDeviceIDFromContext(c echo.Context) (string, error) {
 		return "", err
 	}
 
-	claims, err := validateTokenAndGetClaims(token)
+	claims, err := validateTokenAndGetClaims(c.Request().Context(), token)
 	if err != nil {
 		return "", err
 	}
@@ -108,7 +203,7 @@ func GetSessionIDFromContext(c echo.Context) (uuid.UUID, error) {
 		return uuid.Nil, err
 	}
 
-	claims, err := validateTokenAndGetClaims(token)
+	claims, err := validateTokenAndGetClaims(c.Request().Context(), token)
 	if err != nil {
 		return uuid.Nil, err
 	}
@@ -123,7 +218,7 @@ func GetEmailFromContext(c echo.Context) (string, error) {
 		return "", err
 	}
 
-	claims, err := validateTokenAndGetClaims(token)
+	claims, err := validateTokenAndGetClaims(c.Request().Context(), token)
 	if err != nil {
 		return "", err
 	}
@@ -138,10 +233,139 @@ func GetAllClaimsFromContext(c echo.Context) (*jwt.Claims, error) {
 		return nil, err
 	}
 
-	claims, err := validateTokenAndGetClaims(token)
+	claims, err := validateTokenAndGetClaims(c.Request().Context(), token)
 	if err != nil {
 		return nil, err
 	}
 
 	return claims, nil
 }
+
+const (
+	// IdempotencyKeyHeader names the header clients set to make retries of a
+	// request safe
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// idempotencyTTL is how long the response of an idempotent request is
+	// replayed
+	idempotencyTTL = 24 * time.Hour
+)
+
+// idempotentResponse is the response of a request made with an idempotency
+// key. Status is zero while the request is still being handled.
+type idempotentResponse struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Status int             `json:"status,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// responseRecorder keeps a copy of the response body it writes
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Idempotent makes retries of a request with an Idempotency-Key header safe:
+// the first successful response for a user's key is kept for a day and
+// replayed to requests with the same key instead of handling them again.
+// Requests that fail can be retried with the same key. Requests without the
+// header, or without a valid token, are handled as usual.
+func Idempotent(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := c.Request().Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			return next(c)
+		}
+		if _, err := uuid.Parse(key); err != nil {
+			return c.JSON(http.StatusBadRequest, model.APIResponse{
+				Success: false,
+				Message: "Invalid Idempotency-Key header, it must be a UUID",
+				Error:   errorResponse(http.StatusBadRequest, err),
+			})
+		}
+
+		userID, err := GetUserIDFromContext(c)
+		if err != nil {
+			return next(c)
+		}
+
+		ctx := c.Request().Context()
+		redisClient := redis.GetClient()
+		redisKey := fmt.Sprintf("idempotent:%s:%s", userID, strings.ToLower(key))
+		request := idempotentResponse{Method: c.Request().Method, Path: c.Request().URL.Path}
+
+		pending, _ := json.Marshal(request)
+		reserved, err := redisClient.SetNX(ctx, redisKey, string(pending), idempotencyTTL)
+		if err != nil {
+			return c.JSON(http.StatusServiceUnavailable, model.APIResponse{
+				Success: false,
+				Message: "Failed to check Idempotency-Key",
+				Error:   errorResponse(http.StatusServiceUnavailable, err),
+			})
+		}
+		if !reserved {
+			return replayIdempotent(c, redisKey, request)
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+		c.Response().Writer = recorder
+		err = next(c)
+		c.Response().Writer = recorder.ResponseWriter
+
+		// Failed requests are left for the client to retry
+		status := c.Response().Status
+		if err != nil || status < 200 || status >= 300 || !json.Valid(recorder.body.Bytes()) {
+			redisClient.Del(context.WithoutCancel(ctx), redisKey)
+			return err
+		}
+
+		request.Status = status
+		request.Body = recorder.body.Bytes()
+		stored, _ := json.Marshal(request)
+		if err := redisClient.Set(context.WithoutCancel(ctx), redisKey, string(stored), idempotencyTTL); err != nil {
+			redisClient.Del(context.WithoutCancel(ctx), redisKey)
+		}
+		return nil
+	}
+}
+
+// replayIdempotent answers a request whose idempotency key was used before
+// with the response of the first request
+func replayIdempotent(c echo.Context, redisKey string, request idempotentResponse) error {
+	value, err := redis.GetClient().Get(c.Request().Context(), redisKey)
+	var first idempotentResponse
+	if err == nil {
+		err = json.Unmarshal([]byte(value), &first)
+	}
+	if err != nil {
+		// The first request failed and released the key in the meantime
+		return c.JSON(http.StatusConflict, model.APIResponse{
+			Success: false,
+			Message: "A request with this Idempotency-Key was just handled, retry it",
+			Error:   errorResponse(http.StatusConflict, err),
+		})
+	}
+
+	if first.Method != request.Method || first.Path != request.Path {
+		return c.JSON(http.StatusUnprocessableEntity, model.APIResponse{
+			Success: false,
+			Message: "Idempotency-Key was used for another request",
+			Error:   model.NewErrorResponse(model.ErrCodeInvalidRequest, "idempotency key reused"),
+		})
+	}
+	if first.Status == 0 {
+		return c.JSON(http.StatusConflict, model.APIResponse{
+			Success: false,
+			Message: "A request with this Idempotency-Key is still being handled",
+			Error:   model.NewErrorResponse(model.ErrCodeConflict, "request in progress"),
+		})
+	}
+
+	c.Response().Header().Set("Idempotent-Replayed", "true")
+	return c.JSONBlob(first.Status, first.Body)
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"realtime-api/internal/config"
+	"realtime-api/internal/jwt"
+	"realtime-api/internal/model"
+	"realtime-api/internal/redis"
+	"realtime-api/internal/service"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/redis/rueidis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		status int
+		err    error
+		code   string
+	}{
+		{http.StatusNotFound, service.ErrRoomNotFound, model.ErrCodeRoomNotFound},
+		{http.StatusBadRequest, fmt.Errorf("failed to join: %w", service.ErrRoomFull), model.ErrCodeRoomFull},
+		{http.StatusBadRequest, fmt.Errorf("%w: only admins can ban members", service.ErrForbidden), model.ErrCodeAccessDenied},
+		{http.StatusTooManyRequests, &service.RateLimitError{}, model.ErrCodeRateLimitExceeded},
+		{http.StatusBadRequest, errors.New("invalid character"), model.ErrCodeInvalidRequest},
+		{http.StatusUnauthorized, errors.New("token has been revoked"), model.ErrCodeUnauthorized},
+		{http.StatusInternalServerError, errors.New("connection refused"), model.ErrCodeInternal},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, errorCode(tt.status, tt.err), tt.err.Error())
+	}
+
+	response := errorResponse(http.StatusNotFound, service.ErrMessageNotFound)
+	assert.Equal(t, model.ErrCodeMessageNotFound, response.Code)
+	assert.Equal(t, "not found: message not found", response.Message)
+}
+
+func TestIdempotent(t *testing.T) {
+	server := miniredis.RunT(t)
+	client, err := rueidis.NewClient(rueidis.ClientOption{InitAddress: []string{server.Addr()}, DisableCache: true})
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	redis.Client = redis.New(client)
+
+	jwt.Init(&config.JWTConfig{SecretKey: "test-secret", AccessTokenTTL: 15, RefreshTokenTTL: 24})
+	token, _, _, err := jwt.GetService().GenerateTokens(&model.User{BaseModel: model.BaseModel{ID: uuid.New()}}, uuid.New(), "phone")
+	require.NoError(t, err)
+
+	calls := 0
+	fail := false
+	e := echo.New()
+	e.POST("/messages", func(c echo.Context) error {
+		calls++
+		if fail {
+			return c.JSON(http.StatusBadRequest, model.APIResponse{Success: false})
+		}
+		return c.JSON(http.StatusCreated, model.APIResponse{Success: true, Data: calls})
+	}, Idempotent)
+	e.POST("/rooms", func(c echo.Context) error {
+		calls++
+		return c.NoContent(http.StatusCreated)
+	}, Idempotent)
+
+	send := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	key := uuid.NewString()
+	first := send("/messages", key)
+	assert.Equal(t, http.StatusCreated, first.Code)
+
+	// Retries get the first response without handling the request again
+	retry := send("/messages", key)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.JSONEq(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 1, calls)
+
+	// The key belongs to the first request
+	assert.Equal(t, http.StatusUnprocessableEntity, send("/rooms", key).Code)
+	assert.Equal(t, http.StatusBadRequest, send("/messages", "not-a-uuid").Code)
+	assert.Equal(t, 1, calls)
+
+	// Requests without a key are handled every time
+	send("/messages", "")
+	send("/messages", "")
+	assert.Equal(t, 3, calls)
+
+	// Failed requests can be retried with the same key
+	fail = true
+	other := uuid.NewString()
+	assert.Equal(t, http.StatusBadRequest, send("/messages", other).Code)
+	fail = false
+	assert.Equal(t, http.StatusCreated, send("/messages", other).Code)
+	assert.Equal(t, 5, calls)
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"realtime-api/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateRequestListsEveryInvalidField(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+
+	httpErr := ValidateRequest(c, &model.CreateUserRequest{
+		Username:  "ab",
+		Email:     "not-an-email",
+		FirstName: "Test",
+	})
+	require.NotNil(t, httpErr)
+	assert.Equal(t, http.StatusBadRequest, httpErr.Code)
+
+	response, ok := httpErr.Message.(model.APIResponse)
+	require.True(t, ok)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, model.ErrCodeValidationFailed, response.Error.Code)
+	fields, ok := response.Error.Details["fields"].([]model.FieldError)
+	require.True(t, ok)
+
+	rules := map[string]string{}
+	for _, field := range fields {
+		rules[field.Field] = field.Rule
+	}
+	assert.Equal(t, map[string]string{
+		"username":  "min",
+		"email":     "email",
+		"password":  "required",
+		"last_name": "required",
+	}, rules)
+}
+
+func TestValidateRequestAcceptsValidRequest(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+
+	assert.Nil(t, ValidateRequest(c, &model.SendMessageRequest{
+		RoomID:  uuid.New(),
+		Content: "hello",
+	}))
+	assert.NotNil(t, ValidateRequest(c, &model.SendMessageRequest{Content: "hello"}))
+	assert.NotNil(t, ValidateRequest(c, &model.UpdateMemberRoleRequest{Role: "king"}))
+}
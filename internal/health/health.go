@@ -10,6 +10,7 @@ import (
 
 	"realtime-api/internal/database"
 	"realtime-api/internal/logger"
+	"realtime-api/internal/rabbitmq"
 	"realtime-api/internal/redis"
 )
 
@@ -63,11 +64,17 @@ func Init() *HealthChecker {
 	// Register default checks
 	hc.RegisterCheck("database", DatabaseCheck)
 	hc.RegisterCheck("redis", RedisCheck)
+	hc.RegisterCheck("connection_pool", ConnectionPoolCheck)
 
 	DefaultHealthChecker = hc
 	return hc
 }
 
+// Uptime returns how long the server has been running
+func Uptime() time.Duration {
+	return time.Since(startTime)
+}
+
 func (hc *HealthChecker) RegisterCheck(name string, check CheckFunc) {
 	hc.checks[name] = check
 }
@@ -77,7 +84,7 @@ func (hc *HealthChecker) Check(ctx context.Context) HealthStatus {
 		Status:    "healthy",
 		Timestamp: time.Now(),
 		Version:   version,
-		Uptime:    time.Since(startTime).String(),
+		Uptime:    Uptime().String(),
 		System:    getSystemInfo(),
 		Checks:    make(map[string]CheckResult),
 	}
@@ -158,6 +165,69 @@ func RedisCheck(ctx context.Context) CheckResult {
 	}
 }
 
+func RabbitMQCheck(ctx context.Context) CheckResult {
+	client := rabbitmq.GetClient()
+	if client == nil {
+		return CheckResult{
+			Status: "unhealthy",
+			Error:  "RabbitMQ client not initialized",
+		}
+	}
+
+	if err := client.Health(); err != nil {
+		return CheckResult{
+			Status: "unhealthy",
+			Error:  fmt.Sprintf("RabbitMQ connection failed: %v", err),
+		}
+	}
+
+	return CheckResult{
+		Status:  "healthy",
+		Message: "RabbitMQ connection is healthy",
+	}
+}
+
+// ConnectionPoolCheck reports the use of the database and Redis connection
+// pools. A saturated pool is reported in the message rather than as
+// unhealthy, so a busy instance isn't taken out of rotation.
+func ConnectionPoolCheck(ctx context.Context) CheckResult {
+	if database.DB == nil || redis.Client == nil {
+		return CheckResult{
+			Status: "unhealthy",
+			Error:  "Database or Redis client not initialized",
+		}
+	}
+
+	sqlDB, err := database.GetDB().DB()
+	if err != nil {
+		return CheckResult{
+			Status: "unhealthy",
+			Error:  fmt.Sprintf("Failed to get database pool: %v", err),
+		}
+	}
+
+	dbStats := sqlDB.Stats()
+	result := CheckResult{
+		Status:  "healthy",
+		Message: "Connection pools have capacity",
+		Data: map[string]interface{}{
+			"database": map[string]interface{}{
+				"max_open_connections": dbStats.MaxOpenConnections,
+				"open_connections":     dbStats.OpenConnections,
+				"in_use":               dbStats.InUse,
+				"idle":                 dbStats.Idle,
+				"wait_count":           dbStats.WaitCount,
+				"wait_duration":        dbStats.WaitDuration.String(),
+			},
+			"redis": redis.Client.PoolStats(),
+		},
+	}
+	if dbStats.MaxOpenConnections > 0 && dbStats.InUse >= dbStats.MaxOpenConnections {
+		result.Message = "Database connection pool exhausted"
+	}
+	return result
+}
+
 // HTTP Handler for health endpoint
 func HealthHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -178,20 +248,55 @@ func HealthHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Readiness check - simpler version for k8s readiness probe
+// Readiness check for k8s readiness probe - runs every check and reports 503
+// while any dependency is unhealthy, listing the failing ones
 func ReadinessHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	status := DefaultHealthChecker.Check(r.Context())
 
 	response := map[string]interface{}{
 		"status":    "ready",
 		"timestamp": time.Now(),
 	}
 
+	code := http.StatusOK
+	if status.Status != "healthy" {
+		code = http.StatusServiceUnavailable
+		failing := make(map[string]CheckResult)
+		for name, result := range status.Checks {
+			if result.Status != "healthy" {
+				failing[name] = result
+			}
+		}
+		response["status"] = "not_ready"
+		response["checks"] = failing
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 	json.NewEncoder(w).Encode(response)
 }
 
-// Liveness check - very basic check for k8s liveness probe
+// PoolsHandler reports the connection pools only, a cheaper alternative to
+// the full health status for frequent polling
+func PoolsHandler(w http.ResponseWriter, r *http.Request) {
+	result := ConnectionPoolCheck(r.Context())
+
+	code := http.StatusOK
+	if result.Status != "healthy" {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    result.Status,
+		"timestamp": time.Now(),
+		"pools":     result,
+	})
+}
+
+// Liveness check for k8s liveness probe - only reports that the process is
+// running, so an unavailable dependency doesn't get the pod restarted
 func LivenessHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
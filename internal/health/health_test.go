@@ -0,0 +1,124 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"realtime-api/internal/config"
+	"realtime-api/internal/database"
+	"realtime-api/internal/logger"
+	"realtime-api/internal/redis"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/rueidis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useChecks(t *testing.T, checks map[string]CheckFunc) {
+	t.Helper()
+
+	previous := DefaultHealthChecker
+	DefaultHealthChecker = &HealthChecker{checks: checks}
+	t.Cleanup(func() { DefaultHealthChecker = previous })
+}
+
+func healthy(ctx context.Context) CheckResult { return CheckResult{Status: "healthy"} }
+
+func TestReadinessReportsUnhealthyChecks(t *testing.T) {
+	useChecks(t, map[string]CheckFunc{"database": healthy, "rabbitmq": RabbitMQCheck})
+
+	rec := httptest.NewRecorder()
+	ReadinessHandler(rec, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var body struct {
+		Status string                 `json:"status"`
+		Checks map[string]CheckResult `json:"checks"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "not_ready", body.Status)
+	require.Contains(t, body.Checks, "rabbitmq")
+	assert.NotContains(t, body.Checks, "database")
+	assert.Equal(t, "RabbitMQ client not initialized", body.Checks["rabbitmq"].Error)
+
+	// Liveness doesn't depend on the checks
+	rec = httptest.NewRecorder()
+	LivenessHandler(rec, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestReadinessWhenHealthy(t *testing.T) {
+	useChecks(t, map[string]CheckFunc{"database": healthy})
+
+	rec := httptest.NewRecorder()
+	ReadinessHandler(rec, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"status":"ready"`)
+}
+
+func TestConnectionPools(t *testing.T) {
+	logger.Init("fatal", "json", "stdout", "")
+	previousDB, previousRedis := database.DB, redis.Client
+	t.Cleanup(func() { database.DB, redis.Client = previousDB, previousRedis })
+
+	database.DB, redis.Client = nil, nil
+	assert.Equal(t, "unhealthy", ConnectionPoolCheck(context.Background()).Status)
+
+	db, err := database.Init(&config.DatabaseConfig{
+		Driver:   "sqlite",
+		Database: filepath.Join(t.TempDir(), "test.db"),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	server := miniredis.RunT(t)
+	client, err := rueidis.NewClient(rueidis.ClientOption{
+		InitAddress:  []string{server.Addr()},
+		DisableCache: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	redis.Client = redis.New(client)
+	require.NoError(t, redis.Client.Health())
+
+	rec := httptest.NewRecorder()
+	PoolsHandler(rec, httptest.NewRequest(http.MethodGet, "/health/pools", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Status string `json:"status"`
+		Pools  struct {
+			Data struct {
+				Database map[string]interface{} `json:"database"`
+				Redis    redis.PoolStats        `json:"redis"`
+			} `json:"data"`
+		} `json:"pools"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "healthy", body.Status)
+	assert.EqualValues(t, 100, body.Pools.Data.Database["max_open_connections"])
+	assert.Contains(t, body.Pools.Data.Database, "wait_duration")
+	assert.Equal(t, int64(1), body.Pools.Data.Redis.Commands)
+	assert.Zero(t, body.Pools.Data.Redis.InFlight)
+	assert.NotContains(t, rec.Body.String(), "go_version")
+}
+
+func TestObserveHTTPRequest(t *testing.T) {
+	// Prepared routes are exported before their first request
+	PrepareHTTPRoute(http.MethodGet, "/api/v1/test/:id")
+	assert.Equal(t, 1, testutil.CollectAndCount(HTTPRequestDuration, "http_request_duration_seconds"))
+
+	ObserveHTTPRequest(http.MethodGet, "/api/v1/test/:id", http.StatusOK, time.Millisecond)
+	ObserveHTTPRequest(http.MethodGet, "/api/v1/test/:id", http.StatusNotFound, time.Millisecond)
+	ObserveHTTPRequest(http.MethodPost, "/api/v1/other", http.StatusCreated, time.Millisecond)
+
+	assert.Equal(t, 2, testutil.CollectAndCount(HTTPRequestDuration, "http_request_duration_seconds"))
+	assert.Equal(t, float64(1), testutil.ToFloat64(HTTPRequests.WithLabelValues(http.MethodGet, "/api/v1/test/:id", "404")))
+}
@@ -0,0 +1,155 @@
+package health
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"realtime-api/internal/database"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+// Prometheus collectors. They can be updated before RegisterPrometheusMetrics
+// is called, they are only exported once registered.
+var (
+	ActiveWebSocketConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "active_websocket_connections",
+		Help: "Number of connected WebSocket clients.",
+	})
+
+	ActiveRooms = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "active_websocket_rooms",
+		Help: "Number of rooms tracked by the WebSocket hub.",
+	})
+
+	// MessagesSent gives the messages sent per minute as
+	// rate(total_messages_sent[1m]) * 60
+	MessagesSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "total_messages_sent",
+		Help: "Number of chat messages sent.",
+	})
+
+	EventsPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_published_total",
+		Help: "Number of events published, by event type.",
+	}, []string{"event_type"})
+
+	EventsDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "dropped_events_total",
+		Help: "Number of events not published while Redis publishing was suspended.",
+	})
+
+	EventsHandled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_handled_total",
+		Help: "Number of events handled by subscribers, by event type and status.",
+	}, []string{"event_type", "status"})
+
+	EventHandlingDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "event_handling_duration_seconds",
+		Help:    "Event handling latency of subscribers, by event type.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"event_type"})
+
+	RedisPublishDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "redis_publish_duration_seconds",
+		Help:    "Latency of publishing events to Redis.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	})
+
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests, by method, route and status.",
+	}, []string{"method", "path", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency, by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "path"})
+
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Database query latency, by operation.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	registerMetricsOnce sync.Once
+)
+
+// RegisterPrometheusMetrics registers the collectors with the default
+// Prometheus registry and times the queries of the initialized database.
+// Calling it more than once has no effect.
+func RegisterPrometheusMetrics() {
+	registerMetricsOnce.Do(func() {
+		prometheus.MustRegister(
+			ActiveWebSocketConnections,
+			ActiveRooms,
+			MessagesSent,
+			EventsPublished,
+			EventsDropped,
+			EventsHandled,
+			EventHandlingDuration,
+			RedisPublishDuration,
+			HTTPRequests,
+			HTTPRequestDuration,
+			DBQueryDuration,
+		)
+
+		if database.DB != nil {
+			instrumentDatabase(database.DB.DB)
+		}
+	})
+}
+
+// httpDurations holds the request duration histograms of the routes
+// registered with PrepareHTTPRoute, keyed by method and path. It is filled
+// before the server starts, so requests read it without locking.
+var httpDurations = map[string]prometheus.Observer{}
+
+// PrepareHTTPRoute creates the label set of a route up front, so requests to
+// it don't look it up and the route is exported before its first request
+func PrepareHTTPRoute(method, path string) {
+	httpDurations[method+" "+path] = HTTPRequestDuration.WithLabelValues(method, path)
+}
+
+// ObserveHTTPRequest records a served request by route
+func ObserveHTTPRequest(method, path string, status int, duration time.Duration) {
+	observer, ok := httpDurations[method+" "+path]
+	if !ok {
+		observer = HTTPRequestDuration.WithLabelValues(method, path)
+	}
+	observer.Observe(duration.Seconds())
+	HTTPRequests.WithLabelValues(method, path, strconv.Itoa(status)).Inc()
+}
+
+const queryStartKey = "metrics:query_start"
+
+// instrumentDatabase times every GORM operation into DBQueryDuration
+func instrumentDatabase(db *gorm.DB) {
+	before := func(tx *gorm.DB) {
+		tx.InstanceSet(queryStartKey, time.Now())
+	}
+	after := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			if start, ok := tx.InstanceGet(queryStartKey); ok {
+				DBQueryDuration.WithLabelValues(operation).Observe(time.Since(start.(time.Time)).Seconds())
+			}
+		}
+	}
+
+	callbacks := db.Callback()
+	callbacks.Create().Before("gorm:create").Register("metrics:before_create", before)
+	callbacks.Create().After("gorm:create").Register("metrics:after_create", after("create"))
+	callbacks.Query().Before("gorm:query").Register("metrics:before_query", before)
+	callbacks.Query().After("gorm:query").Register("metrics:after_query", after("query"))
+	callbacks.Update().Before("gorm:update").Register("metrics:before_update", before)
+	callbacks.Update().After("gorm:update").Register("metrics:after_update", after("update"))
+	callbacks.Delete().Before("gorm:delete").Register("metrics:before_delete", before)
+	callbacks.Delete().After("gorm:delete").Register("metrics:after_delete", after("delete"))
+	callbacks.Row().Before("gorm:row").Register("metrics:before_row", before)
+	callbacks.Row().After("gorm:row").Register("metrics:after_row", after("row"))
+	callbacks.Raw().Before("gorm:raw").Register("metrics:before_raw", before)
+	callbacks.Raw().After("gorm:raw").Register("metrics:after_raw", after("raw"))
+}
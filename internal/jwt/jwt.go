@@ -135,6 +135,11 @@ func (j *JWTService) RefreshAccessToken(refreshToken string) (string, time.Time,
 	return accessTokenString, accessExpiry, nil
 }
 
+// RefreshTokenTTL is how long a refresh token, and so a session, stays valid
+func (j *JWTService) RefreshTokenTTL() time.Duration {
+	return time.Duration(j.config.RefreshTokenTTL) * time.Hour
+}
+
 func GetService() *JWTService {
 	return Service
 }
@@ -7,7 +7,10 @@ import (
 	"realtime-api/internal/jwt"
 	"realtime-api/internal/logger"
 	"realtime-api/internal/model"
+	"realtime-api/internal/redis"
+	"realtime-api/internal/repository"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
@@ -20,6 +23,7 @@ func JWTMiddleware() echo.MiddlewareFunc {
 				return c.JSON(http.StatusUnauthorized, model.APIResponse{
 					Success: false,
 					Message: "Missing authorization header",
+					Error:   model.NewErrorResponse(model.ErrCodeUnauthorized, "missing authorization header"),
 				})
 			}
 
@@ -28,6 +32,7 @@ func JWTMiddleware() echo.MiddlewareFunc {
 				return c.JSON(http.StatusUnauthorized, model.APIResponse{
 					Success: false,
 					Message: "Invalid authorization header format",
+					Error:   model.NewErrorResponse(model.ErrCodeUnauthorized, "invalid authorization header format"),
 				})
 			}
 
@@ -37,6 +42,7 @@ func JWTMiddleware() echo.MiddlewareFunc {
 				return c.JSON(http.StatusUnauthorized, model.APIResponse{
 					Success: false,
 					Message: "Missing token",
+					Error:   model.NewErrorResponse(model.ErrCodeUnauthorized, "missing token"),
 				})
 			}
 
@@ -50,6 +56,25 @@ func JWTMiddleware() echo.MiddlewareFunc {
 				return c.JSON(http.StatusUnauthorized, model.APIResponse{
 					Success: false,
 					Message: "Invalid token",
+					Error:   model.NewErrorResponse(model.ErrCodeUnauthorized, "invalid token"),
+				})
+			}
+
+			// Reject tokens of revoked sessions
+			revoked, err := redis.GetClient().IsTokenBlacklisted(c.Request().Context(), claims.ID)
+			if err != nil {
+				logger.Error("Failed to check token blacklist", logger.WithField("error", err.Error()))
+				return c.JSON(http.StatusServiceUnavailable, model.APIResponse{
+					Success: false,
+					Message: "Authentication service unavailable",
+					Error:   model.NewErrorResponse(model.ErrCodeServiceUnavailable, "authentication service unavailable"),
+				})
+			}
+			if revoked {
+				return c.JSON(http.StatusUnauthorized, model.APIResponse{
+					Success: false,
+					Message: "Token has been revoked",
+					Error:   model.NewErrorResponse(model.ErrCodeTokenRevoked, "token has been revoked"),
 				})
 			}
 
@@ -80,6 +105,12 @@ func OptionalJWTMiddleware() echo.MiddlewareFunc {
 					// Validate token
 					claims, err := jwt.GetService().ValidateToken(token)
 					if err == nil {
+						// Revoked tokens are treated like anonymous requests
+						revoked, err := redis.GetClient().IsTokenBlacklisted(c.Request().Context(), claims.ID)
+						if err != nil || revoked {
+							return next(c)
+						}
+
 						// Set user context if token is valid
 						c.Set("user_id", claims.UserID)
 						c.Set("username", claims.Username)
@@ -93,3 +124,44 @@ func OptionalJWTMiddleware() echo.MiddlewareFunc {
 		}
 	}
 }
+
+// AdminMiddleware lets only system admins through. It runs after
+// JWTMiddleware and checks the admin flag in the database rather than in the
+// token, so revoking admin rights takes effect right away.
+func AdminMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userID, ok := c.Get("user_id").(uuid.UUID)
+			if !ok {
+				return c.JSON(http.StatusUnauthorized, model.APIResponse{
+					Success: false,
+					Message: "Authentication required",
+					Error:   model.NewErrorResponse(model.ErrCodeUnauthorized, "authentication required"),
+				})
+			}
+
+			user, err := repository.NewUserRepository().GetByID(c.Request().Context(), userID)
+			if err != nil {
+				logger.Error("Failed to check admin rights", logger.WithField("error", err.Error()))
+				return c.JSON(http.StatusInternalServerError, model.APIResponse{
+					Success: false,
+					Message: "Failed to check admin rights",
+					Error:   model.NewErrorResponse(model.ErrCodeInternal, "failed to check admin rights"),
+				})
+			}
+			if user == nil || !user.IsActive || !user.IsAdmin {
+				logger.Warn("Non-admin denied access to admin route", logger.WithFields(map[string]interface{}{
+					"user_id": userID,
+					"path":    c.Path(),
+				}))
+				return c.JSON(http.StatusForbidden, model.APIResponse{
+					Success: false,
+					Message: "Admin access required",
+					Error:   model.NewErrorResponse(model.ErrCodeAccessDenied, "admin access required"),
+				})
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"realtime-api/internal/config"
+	"realtime-api/internal/database"
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminMiddleware(t *testing.T) {
+	logger.Init("fatal", "json", "stdout", "")
+
+	db, err := database.Init(&config.DatabaseConfig{
+		Driver:   "sqlite",
+		Database: filepath.Join(t.TempDir(), "test.db"),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, db.Migrate(&model.User{}))
+
+	admin := &model.User{Username: "admin", Email: "admin@example.com", Password: "hash", IsActive: true, IsAdmin: true}
+	member := &model.User{Username: "member", Email: "member@example.com", Password: "hash", IsActive: true}
+	require.NoError(t, db.DB.Create(admin).Error)
+	require.NoError(t, db.DB.Create(member).Error)
+
+	unknown := uuid.New()
+	tests := []struct {
+		name   string
+		userID *uuid.UUID
+		want   int
+	}{
+		{"admin", &admin.ID, http.StatusOK},
+		{"non-admin", &member.ID, http.StatusForbidden},
+		{"unknown user", &unknown, http.StatusForbidden},
+		{"unauthenticated", nil, http.StatusUnauthorized},
+	}
+
+	e := echo.New()
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/admin/users", nil), rec)
+			if tt.userID != nil {
+				c.Set("user_id", *tt.userID)
+			}
+
+			handler := AdminMiddleware()(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+			assert.NoError(t, handler(c))
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
@@ -1,9 +1,14 @@
 package middleware
 
 import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
 	"time"
 
+	"realtime-api/internal/health"
 	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
 
 	"github.com/labstack/echo/v4"
 )
@@ -50,6 +55,45 @@ func LoggerMiddleware() echo.MiddlewareFunc {
 	})
 }
 
+// MetricsMiddleware records the count and duration of requests by route
+// rather than raw path, to keep label cardinality bounded
+func MetricsMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			status := c.Response().Status
+			if httpErr, ok := err.(*echo.HTTPError); ok {
+				status = httpErr.Code
+			}
+			health.ObserveHTTPRequest(c.Request().Method, c.Path(), status, time.Since(start))
+			return err
+		}
+	}
+}
+
+// MetricsTokenMiddleware requires the bearer token to scrape metrics. An
+// empty token leaves them public.
+func MetricsTokenMiddleware(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if token == "" {
+				return next(c)
+			}
+			provided, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				return c.JSON(http.StatusUnauthorized, model.APIResponse{
+					Success: false,
+					Message: "Invalid metrics token",
+					Error:   model.NewErrorResponse(model.ErrCodeUnauthorized, "a valid metrics token is required"),
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
 // RecoveryMiddleware recovers from panics
 func RecoveryMiddleware() echo.MiddlewareFunc {
 	return echo.MiddlewareFunc(func(next echo.HandlerFunc) echo.HandlerFunc {
@@ -85,8 +129,8 @@ func CORSMiddleware() echo.MiddlewareFunc {
 			// Set CORS headers
 			c.Response().Header().Set("Access-Control-Allow-Origin", "*")
 			c.Response().Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			c.Response().Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
-			c.Response().Header().Set("Access-Control-Expose-Headers", "Content-Length")
+			c.Response().Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, Idempotency-Key, traceparent, tracestate")
+			c.Response().Header().Set("Access-Control-Expose-Headers", "Content-Length, Idempotent-Replayed")
 			c.Response().Header().Set("Access-Control-Allow-Credentials", "true")
 
 			// Handle preflight requests
@@ -168,10 +212,10 @@ func RateLimitMiddleware(requestsPerMinute int) echo.MiddlewareFunc {
 					"limit":    requestsPerMinute,
 				}))
 
-				return c.JSON(429, map[string]interface{}{
-					"success": false,
-					"message": "Rate limit exceeded",
-					"error":   "Too many requests",
+				return c.JSON(http.StatusTooManyRequests, model.APIResponse{
+					Success: false,
+					Message: "Rate limit exceeded",
+					Error:   model.NewErrorResponse(model.ErrCodeRateLimitExceeded, "too many requests"),
 				})
 			}
 
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+	"realtime-api/internal/service"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// RoomPermission lets only members of the room in the path holding
+// requiredRole, or a role ranked above it, through. It runs after
+// JWTMiddleware and reads the room from the room_id path parameter, or id
+// on the routes naming it so. The membership is passed on in the request
+// context, where the room service reuses it.
+func RoomPermission(requiredRole model.RoomRole, roomService service.RoomService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userID, ok := c.Get("user_id").(uuid.UUID)
+			if !ok {
+				return c.JSON(http.StatusUnauthorized, model.APIResponse{
+					Success: false,
+					Message: "Authentication required",
+					Error:   model.NewErrorResponse(model.ErrCodeUnauthorized, "authentication required"),
+				})
+			}
+
+			param := c.Param("room_id")
+			if param == "" {
+				param = c.Param("id")
+			}
+			roomID, err := uuid.Parse(param)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, model.APIResponse{
+					Success: false,
+					Message: "Invalid room ID format",
+					Error:   model.NewErrorResponse(model.ErrCodeInvalidID, err.Error()),
+				})
+			}
+
+			ctx := c.Request().Context()
+			member, err := roomService.GetMember(ctx, roomID, userID)
+			switch {
+			case errors.Is(err, service.ErrRoomNotFound):
+				return c.JSON(http.StatusNotFound, model.APIResponse{
+					Success: false,
+					Message: "Room not found",
+					Error:   model.NewErrorResponse(model.ErrCodeRoomNotFound, err.Error()),
+				})
+			case err != nil && !errors.Is(err, service.ErrForbidden):
+				logger.Error("Failed to check room permission", logger.WithField("error", err.Error()))
+				return c.JSON(http.StatusInternalServerError, model.APIResponse{
+					Success: false,
+					Message: "Failed to check room permission",
+					Error:   model.NewErrorResponse(model.ErrCodeInternal, "failed to check room permission"),
+				})
+			}
+			if !member.HasRole(requiredRole) {
+				return c.JSON(http.StatusForbidden, model.APIResponse{
+					Success: false,
+					Message: "Insufficient room permissions",
+					Error:   model.NewErrorResponse(model.ErrCodeAccessDenied, fmt.Sprintf("the %s role is required in this room", requiredRole)),
+				})
+			}
+
+			c.SetRequest(c.Request().WithContext(service.WithRoomMember(ctx, member)))
+			return next(c)
+		}
+	}
+}
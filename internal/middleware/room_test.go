@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+	"realtime-api/internal/service"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubRoomService serves the memberships of one room
+type stubRoomService struct {
+	service.RoomService
+	roomID  uuid.UUID
+	members map[uuid.UUID]string
+}
+
+func (s *stubRoomService) GetMember(ctx context.Context, roomID, userID uuid.UUID) (*model.RoomMember, error) {
+	if roomID != s.roomID {
+		return nil, service.ErrRoomNotFound
+	}
+	role, ok := s.members[userID]
+	if !ok {
+		return nil, service.ErrForbidden
+	}
+	if role == "" {
+		return nil, errors.New("connection refused")
+	}
+	return &model.RoomMember{RoomID: roomID, UserID: userID, Role: role}, nil
+}
+
+func TestRoomPermission(t *testing.T) {
+	logger.Init("fatal", "json", "stdout", "")
+
+	owner, admin, member, outsider, broken := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	roomService := &stubRoomService{
+		roomID: uuid.New(),
+		members: map[uuid.UUID]string{
+			owner:  "owner",
+			admin:  "admin",
+			member: "member",
+			broken: "",
+		},
+	}
+
+	tests := []struct {
+		name   string
+		userID *uuid.UUID
+		roomID string
+		want   int
+	}{
+		{"owner", &owner, roomService.roomID.String(), http.StatusOK},
+		{"admin", &admin, roomService.roomID.String(), http.StatusOK},
+		{"member", &member, roomService.roomID.String(), http.StatusForbidden},
+		{"non-member", &outsider, roomService.roomID.String(), http.StatusForbidden},
+		{"missing room", &owner, uuid.NewString(), http.StatusNotFound},
+		{"invalid room ID", &owner, "general", http.StatusBadRequest},
+		{"unauthenticated", nil, roomService.roomID.String(), http.StatusUnauthorized},
+		{"lookup failure", &broken, roomService.roomID.String(), http.StatusInternalServerError},
+	}
+
+	e := echo.New()
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodPut, "/", nil), rec)
+			c.SetParamNames("id")
+			c.SetParamValues(tt.roomID)
+			if tt.userID != nil {
+				c.Set("user_id", *tt.userID)
+			}
+
+			handler := RoomPermission(model.RoomRoleAdmin, roomService)(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+			assert.NoError(t, handler(c))
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package model
+
+// Error codes sent in ErrorResponse.Code so clients can tell failures apart
+// without matching on messages
+const (
+	ErrCodeInvalidRequest      = "INVALID_REQUEST"
+	ErrCodeInvalidID           = "INVALID_ID"
+	ErrCodeValidationFailed    = "VALIDATION_FAILED"
+	ErrCodeUnauthorized        = "UNAUTHORIZED"
+	ErrCodeInvalidCredentials  = "INVALID_CREDENTIALS"
+	ErrCodeTokenRevoked        = "TOKEN_REVOKED"
+	ErrCodeAccessDenied        = "ACCESS_DENIED"
+	ErrCodeNotFound            = "NOT_FOUND"
+	ErrCodeRoomNotFound        = "ROOM_NOT_FOUND"
+	ErrCodeMessageNotFound     = "MESSAGE_NOT_FOUND"
+	ErrCodeUserNotFound        = "USER_NOT_FOUND"
+	ErrCodeConflict            = "CONFLICT"
+	ErrCodeEmailTaken          = "EMAIL_TAKEN"
+	ErrCodeUsernameTaken       = "USERNAME_TAKEN"
+	ErrCodeRoomFull            = "ROOM_FULL"
+	ErrCodeRoomArchived        = "ROOM_ARCHIVED"
+	ErrCodeMessageTypeDisabled = "MESSAGE_TYPE_DISABLED"
+	ErrCodeRateLimitExceeded   = "RATE_LIMIT_EXCEEDED"
+	ErrCodeServiceUnavailable  = "SERVICE_UNAVAILABLE"
+	ErrCodeInternal            = "INTERNAL_ERROR"
+)
+
+// ErrorResponse is the error of a failed APIResponse
+type ErrorResponse struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// NewErrorResponse returns an error with the given code and message
+func NewErrorResponse(code, message string) *ErrorResponse {
+	return &ErrorResponse{Code: code, Message: message}
+}
+
+// WithDetail adds a detail to the error and returns it
+func (e *ErrorResponse) WithDetail(key string, value interface{}) *ErrorResponse {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = value
+	return e
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -35,6 +36,43 @@ const (
 	ContactStatusRejected ContactStatus = "rejected"
 )
 
+// DeletedMessageMode controls how soft-deleted messages appear in room history
+type DeletedMessageMode string
+
+const (
+	DeletedMessagesExclude   DeletedMessageMode = "exclude"
+	DeletedMessagesTombstone DeletedMessageMode = "tombstone"
+)
+
+// DeleteMessageMode chooses who a deleted message disappears for
+type DeleteMessageMode string
+
+const (
+	DeleteForEveryone DeleteMessageMode = "for_everyone"
+	DeleteForMe       DeleteMessageMode = "for_me"
+)
+
+// ArchiveRoomMode chooses who an archived room is archived for
+type ArchiveRoomMode string
+
+const (
+	ArchiveForMe       ArchiveRoomMode = "for_me"
+	ArchiveForEveryone ArchiveRoomMode = "for_everyone"
+)
+
+// NotificationLevel chooses which messages of a room notify a member
+type NotificationLevel string
+
+const (
+	NotificationLevelAll      NotificationLevel = "all"
+	NotificationLevelMentions NotificationLevel = "mentions"
+	NotificationLevelNone     NotificationLevel = "none"
+
+	// Aliases accepted when setting the level, stored as the levels above
+	NotificationLevelMentionsOnly NotificationLevel = "mentions_only"
+	NotificationLevelNothing      NotificationLevel = "nothing"
+)
+
 // UserProfile model for additional user information
 type UserProfile struct {
 	BaseModel
@@ -83,6 +121,14 @@ type User struct {
 	LastSeen    *time.Time `json:"last_seen"`
 	IsActive    bool       `json:"is_active" gorm:"default:true"`
 	IsVerified  bool       `json:"is_verified" gorm:"default:false"`
+	IsAdmin     bool       `json:"is_admin" gorm:"default:false"` // System admin, e.g. can view user activity
+
+	// Two-factor authentication, enabled once a code of the secret is verified
+	TOTPSecret  string `json:"-" gorm:"size:64"`
+	TOTPEnabled bool   `json:"totp_enabled" gorm:"default:false"`
+	// TOTPLastStep is the time step of the last accepted code, so codes
+	// can't be replayed
+	TOTPLastStep int64 `json:"-" gorm:"default:0"`
 
 	// User Settings (embedded)
 	Language            string `json:"language" gorm:"size:10;default:'en'"`
@@ -111,15 +157,35 @@ type UserSession struct {
 	DeviceType   string    `json:"device_type" gorm:"size:50"` // web, mobile, desktop
 	IPAddress    string    `json:"ip_address" gorm:"size:45"`
 	UserAgent    string    `json:"user_agent" gorm:"size:500"`
-	AccessToken  string    `json:"access_token" gorm:"size:500;not null;index"`
-	RefreshToken string    `json:"refresh_token" gorm:"size:500;not null"`
+	AccessToken  string    `json:"-" gorm:"size:500;not null;index"`
+	RefreshToken string    `json:"-" gorm:"size:500;not null"`
 	ExpiresAt    time.Time `json:"expires_at" gorm:"not null;index"`
 	IsActive     bool      `json:"is_active" gorm:"default:true"`
+	// Firebase Cloud Messaging token of the device, for push notifications
+	FCMToken string `json:"-" gorm:"column:fcm_token;size:255;index"`
 
 	// Relationships
 	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
 }
 
+// Platforms of the devices push notifications are sent to
+const (
+	DevicePlatformAndroid = "android"
+	DevicePlatformIOS     = "ios"
+	DevicePlatformWeb     = "web"
+)
+
+// DeviceToken is a push notification token a device of a user registered.
+// Unlike the FCM token of a session it outlives the session, so users keep
+// getting pushes on devices that stay signed in for long.
+type DeviceToken struct {
+	BaseModel
+	UserID   uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
+	Platform string    `json:"platform" gorm:"size:20;not null"`
+	Token    string    `json:"-" gorm:"size:255;not null;uniqueIndex"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
 // Room model for chat rooms/channels
 type Room struct {
 	BaseModel
@@ -138,8 +204,20 @@ type Room struct {
 	RequireApproval      bool `json:"require_approval" gorm:"default:false"`
 	MuteAllMembers       bool `json:"mute_all_members" gorm:"default:false"`
 	OnlyAdminCanPost     bool `json:"only_admin_can_post" gorm:"default:false"`
+	SlowModeSeconds      int  `json:"slow_mode_seconds" gorm:"default:0"`     // 0 = disabled
+	IsArchived           bool `json:"is_archived" gorm:"default:false;index"` // Read-only for everyone, hidden from chat lists
 
 	CreatedBy uuid.UUID `json:"created_by" gorm:"type:uuid;not null;index"`
+	DirectKey *string   `json:"-" gorm:"size:80;uniqueIndex"` // sorted "user1:user2" pair, direct rooms only
+
+	// Notification level of the requesting member, filled in by chat list queries
+	NotificationLevel NotificationLevel `json:"notification_level,omitempty" gorm:"-"`
+
+	// Number of members, filled in when a single room is fetched
+	MemberCount int64 `json:"member_count,omitempty" gorm:"-"`
+
+	// Topics the room is listed under, loaded from room_tags
+	Tags []string `json:"tags,omitempty" gorm:"-"`
 
 	// Relationships
 	CreatedByUser User         `json:"created_by_user,omitempty" gorm:"foreignKey:CreatedBy"`
@@ -148,17 +226,34 @@ type Room struct {
 	Invites       []RoomInvite `json:"invites,omitempty" gorm:"foreignKey:RoomID"`
 }
 
+// RoomTag is a topic a room is listed under, so public rooms can be browsed
+// by tag
+type RoomTag struct {
+	BaseModel
+	RoomID uuid.UUID `json:"room_id" gorm:"type:uuid;not null;uniqueIndex:idx_room_tags_room_tag"`
+	Tag    string    `json:"tag" gorm:"size:50;not null;uniqueIndex:idx_room_tags_room_tag;index"`
+}
+
+// RoomTagCount is a tag with the number of public rooms using it
+type RoomTagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
 // RoomMember model for room membership
 type RoomMember struct {
 	BaseModel
-	RoomID     uuid.UUID  `json:"room_id" gorm:"type:uuid;not null;index"`
-	UserID     uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
-	Role       string     `json:"role" gorm:"size:20;default:'member'"` // owner, admin, moderator, member
-	JoinedAt   time.Time  `json:"joined_at" gorm:"default:now()"`
-	LastReadAt *time.Time `json:"last_read_at"`
-	IsMuted    bool       `json:"is_muted" gorm:"default:false"`
-	IsActive   bool       `json:"is_active" gorm:"default:true"`
-	InvitedBy  *uuid.UUID `json:"invited_by" gorm:"type:uuid;index"` // Who invited this user
+	RoomID            uuid.UUID         `json:"room_id" gorm:"type:uuid;not null;index"`
+	UserID            uuid.UUID         `json:"user_id" gorm:"type:uuid;not null;index"`
+	Role              string            `json:"role" gorm:"size:20;default:'member'"` // owner, admin, moderator, member
+	JoinedAt          time.Time         `json:"joined_at" gorm:"default:now()"`
+	LastReadAt        *time.Time        `json:"last_read_at"`
+	IsMuted           bool              `json:"is_muted" gorm:"default:false"`
+	MutedUntil        *time.Time        `json:"muted_until,omitempty"`            // nil while muted means until unmuted
+	IsArchived        bool              `json:"is_archived" gorm:"default:false"` // Hidden from this member's chat list
+	NotificationLevel NotificationLevel `json:"notification_level" gorm:"size:20;default:'all'"`
+	IsActive          bool              `json:"is_active" gorm:"default:true"`
+	InvitedBy         *uuid.UUID        `json:"invited_by" gorm:"type:uuid;index"` // Who invited this user
 
 	// Relationships
 	Room          Room  `json:"room,omitempty" gorm:"foreignKey:RoomID"`
@@ -166,6 +261,33 @@ type RoomMember struct {
 	InvitedByUser *User `json:"invited_by_user,omitempty" gorm:"foreignKey:InvitedBy"`
 }
 
+// RoomRole is the role of a member in a room
+type RoomRole string
+
+// Room member roles
+const (
+	RoomRoleOwner     RoomRole = "owner"
+	RoomRoleAdmin     RoomRole = "admin"
+	RoomRoleModerator RoomRole = "moderator"
+	RoomRoleMember    RoomRole = "member"
+)
+
+// roomRoleRanks orders the room roles, each role holding the rights of the
+// roles ranked below it
+var roomRoleRanks = map[RoomRole]int{
+	RoomRoleMember:    1,
+	RoomRoleModerator: 2,
+	RoomRoleAdmin:     3,
+	RoomRoleOwner:     4,
+}
+
+// HasRole reports whether the member's role is role or ranks above it. No
+// member holds a role outside the hierarchy.
+func (m *RoomMember) HasRole(role RoomRole) bool {
+	required, ok := roomRoleRanks[role]
+	return m != nil && ok && roomRoleRanks[RoomRole(m.Role)] >= required
+}
+
 // Message model for chat messages
 type Message struct {
 	BaseModel
@@ -188,6 +310,10 @@ type Message struct {
 	Reads       []MessageRead       `json:"reads,omitempty" gorm:"foreignKey:MessageID"`
 }
 
+// RetentionDeletedContent replaces the content of messages removed by a
+// room's retention policy
+const RetentionDeletedContent = "[message deleted by retention policy]"
+
 // MessageAttachment model for file attachments
 type MessageAttachment struct {
 	BaseModel
@@ -209,9 +335,9 @@ type MessageAttachment struct {
 // MessageReaction model for emoji reactions
 type MessageReaction struct {
 	BaseModel
-	MessageID uuid.UUID `json:"message_id" gorm:"type:uuid;not null;index"`
-	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
-	Emoji     string    `json:"emoji" gorm:"size:50;not null;index"`
+	MessageID uuid.UUID `json:"message_id" gorm:"type:uuid;not null;uniqueIndex:idx_message_reactions_message_user_emoji"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_message_reactions_message_user_emoji;index"`
+	Emoji     string    `json:"emoji" gorm:"size:50;not null;uniqueIndex:idx_message_reactions_message_user_emoji;index"`
 
 	// Relationships
 	Message Message `json:"message,omitempty" gorm:"foreignKey:MessageID"`
@@ -230,6 +356,45 @@ type MessageRead struct {
 	User    User    `json:"user,omitempty" gorm:"foreignKey:UserID"`
 }
 
+// MessageDelivery records that a message reached one of the user's devices
+type MessageDelivery struct {
+	BaseModel
+	MessageID   uuid.UUID `json:"message_id" gorm:"type:uuid;not null;uniqueIndex:idx_message_deliveries_message_user"`
+	UserID      uuid.UUID `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_message_deliveries_message_user;index"`
+	DeliveredAt time.Time `json:"delivered_at" gorm:"not null"`
+}
+
+// MessageEdit keeps the content a message had before an edit. Revision is
+// the number of the revision the edit produced, starting at 1.
+type MessageEdit struct {
+	BaseModel
+	MessageID        uuid.UUID `json:"message_id" gorm:"type:uuid;not null;uniqueIndex:idx_message_edits_message_revision"`
+	Revision         int       `json:"revision" gorm:"not null;uniqueIndex:idx_message_edits_message_revision"`
+	PreviousContent  string    `json:"previous_content" gorm:"type:text"`
+	PreviousMetadata string    `json:"previous_metadata" gorm:"type:text"`
+	EditedBy         uuid.UUID `json:"edited_by" gorm:"type:uuid;not null"`
+	EditedAt         time.Time `json:"edited_at" gorm:"not null"`
+}
+
+// MessageHidden records a message a user deleted for themselves only
+type MessageHidden struct {
+	BaseModel
+	MessageID uuid.UUID `json:"message_id" gorm:"type:uuid;not null;uniqueIndex:idx_message_hidden_message_user"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_message_hidden_message_user;index"`
+}
+
+// RoomPinnedMessage is a message pinned to the top of a room
+type RoomPinnedMessage struct {
+	BaseModel
+	RoomID    uuid.UUID `json:"room_id" gorm:"type:uuid;not null;uniqueIndex:idx_room_pinned_room_message"`
+	MessageID uuid.UUID `json:"message_id" gorm:"type:uuid;not null;uniqueIndex:idx_room_pinned_room_message"`
+	PinnedBy  uuid.UUID `json:"pinned_by" gorm:"type:uuid;not null"`
+	PinnedAt  time.Time `json:"pinned_at" gorm:"not null"`
+
+	// Relationships
+	Message Message `json:"message" gorm:"foreignKey:MessageID"`
+}
+
 // Notification model for user notifications
 type Notification struct {
 	BaseModel
@@ -261,7 +426,7 @@ type UserBlock struct {
 type ActivityLog struct {
 	BaseModel
 	UserID       *uuid.UUID `json:"user_id" gorm:"type:uuid;index"`
-	ActivityType string     `json:"activity_type" gorm:"size:50;not null;index"` // login, logout, message_sent, room_join, room_leave, room_create, file_upload, user_block, user_unblock
+	ActivityType string     `json:"activity_type" gorm:"size:50;not null;index"` // login, logout, message_sent, room_join, room_leave, room_create, file_upload, user_block, user_unblock, password_change, password_reset
 	Description  string     `json:"description" gorm:"type:text"`
 	Metadata     string     `json:"metadata" gorm:"type:jsonb"` // activity specific data
 	IPAddress    string     `json:"ip_address" gorm:"size:45"`
@@ -271,6 +436,15 @@ type ActivityLog struct {
 	User *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
 }
 
+// Room invite statuses. Shareable invites stay pending until they expire or
+// are revoked; direct invites are accepted or rejected by their invitee.
+const (
+	InviteStatusPending  = "pending"
+	InviteStatusAccepted = "accepted"
+	InviteStatusRejected = "rejected"
+	InviteStatusExpired  = "expired"
+)
+
 // RoomInvite model for room invitations
 type RoomInvite struct {
 	BaseModel
@@ -291,11 +465,84 @@ type RoomInvite struct {
 	Invitee *User `json:"invitee,omitempty" gorm:"foreignKey:InviteeID"`
 }
 
+// Room join request statuses
+const (
+	JoinRequestPending  = "pending"
+	JoinRequestApproved = "approved"
+	JoinRequestRejected = "rejected"
+)
+
+// RoomJoinRequest is a request to join a room that requires approval
+type RoomJoinRequest struct {
+	BaseModel
+	RoomID      uuid.UUID  `json:"room_id" gorm:"type:uuid;not null;uniqueIndex:idx_room_join_requests_room_user"`
+	UserID      uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_room_join_requests_room_user;index"`
+	Status      string     `json:"status" gorm:"size:20;not null;default:'pending';index"`
+	RequestedAt time.Time  `json:"requested_at" gorm:"not null"`
+	RespondedAt *time.Time `json:"responded_at"`
+	RespondedBy *uuid.UUID `json:"responded_by" gorm:"type:uuid"`
+
+	// Relationships
+	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// RoomBan keeps a user out of a room until it expires. Bans without an
+// expiry are permanent.
+type RoomBan struct {
+	BaseModel
+	RoomID    uuid.UUID  `json:"room_id" gorm:"type:uuid;not null;uniqueIndex:idx_room_bans_room_user"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_room_bans_room_user;index"`
+	BannedBy  uuid.UUID  `json:"banned_by" gorm:"type:uuid;not null"`
+	Reason    string     `json:"reason,omitempty" gorm:"size:500"`
+	ExpiresAt *time.Time `json:"expires_at"`
+
+	// Relationships
+	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// RoomWebhook is an external endpoint receiving the events of a room as
+// signed POST requests. Events lists the event types it subscribes to, "*"
+// standing for every room and message event.
+type RoomWebhook struct {
+	BaseModel
+	RoomID    uuid.UUID `json:"room_id" gorm:"type:uuid;not null;index"`
+	URL       string    `json:"url" gorm:"size:2048;not null"`
+	Secret    string    `json:"secret,omitempty" gorm:"size:128;not null"` // Only returned on creation
+	Events    []string  `json:"events" gorm:"type:jsonb;serializer:json"`
+	IsActive  bool      `json:"is_active" gorm:"default:true"`
+	CreatedBy uuid.UUID `json:"created_by" gorm:"type:uuid;not null"`
+}
+
+// Scheduled message statuses
+const (
+	ScheduledMessagePending   = "pending"
+	ScheduledMessageSending   = "sending"
+	ScheduledMessageSent      = "sent"
+	ScheduledMessageCancelled = "cancelled"
+	ScheduledMessageFailed    = "failed"
+)
+
+// ScheduledMessage is a message waiting to be sent at ScheduledAt
+type ScheduledMessage struct {
+	BaseModel
+	RoomID      uuid.UUID  `json:"room_id" gorm:"type:uuid;not null;index"`
+	SenderID    uuid.UUID  `json:"sender_id" gorm:"type:uuid;not null;index"`
+	ReplyToID   *uuid.UUID `json:"reply_to_id" gorm:"type:uuid"`
+	Type        string     `json:"type" gorm:"size:20;not null"`
+	Content     string     `json:"content" gorm:"type:text"`
+	Metadata    string     `json:"metadata" gorm:"type:text"`
+	FileIDs     string     `json:"-" gorm:"type:text"` // JSON array of uploads to attach
+	ScheduledAt time.Time  `json:"scheduled_at" gorm:"not null;index"`
+	Status      string     `json:"status" gorm:"size:20;not null;default:'pending';index"`
+	MessageID   *uuid.UUID `json:"message_id,omitempty" gorm:"type:uuid"` // set once sent
+	Error       string     `json:"error,omitempty" gorm:"type:text"`
+}
+
 // MessageDraft model for message drafts
 type MessageDraft struct {
 	BaseModel
-	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
-	RoomID    uuid.UUID  `json:"room_id" gorm:"type:uuid;not null;index"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_message_drafts_user_room"`
+	RoomID    uuid.UUID  `json:"room_id" gorm:"type:uuid;not null;uniqueIndex:idx_message_drafts_user_room;index"`
 	Content   string     `json:"content" gorm:"type:text;not null"`
 	ReplyToID *uuid.UUID `json:"reply_to_id" gorm:"type:uuid"`
 
@@ -320,16 +567,22 @@ type TypingIndicator struct {
 // FileUpload model for file uploads
 type FileUpload struct {
 	BaseModel
-	UserID       uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
-	OriginalName string     `json:"original_name" gorm:"size:255;not null"`
-	FileName     string     `json:"file_name" gorm:"size:255;not null;index"`
-	FilePath     string     `json:"file_path" gorm:"size:500;not null"`
-	FileSize     int64      `json:"file_size" gorm:"not null"`
-	FileType     string     `json:"file_type" gorm:"size:100;not null;index"`
-	MimeType     string     `json:"mime_type" gorm:"size:100;not null"`
-	UploadStatus string     `json:"upload_status" gorm:"size:20;default:'uploading';index"` // uploading, completed, failed, deleted
-	IsTemporary  bool       `json:"is_temporary" gorm:"default:true;index"`
-	ExpiresAt    *time.Time `json:"expires_at" gorm:"index"`
+	UserID        uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	OriginalName  string     `json:"original_name" gorm:"size:255;not null"`
+	FileName      string     `json:"file_name" gorm:"size:255;not null;index"`
+	FilePath      string     `json:"file_path" gorm:"size:500;not null"`
+	FileSize      int64      `json:"file_size" gorm:"not null"`
+	FileType      string     `json:"file_type" gorm:"size:100;not null;index"`
+	MimeType      string     `json:"mime_type" gorm:"size:100;not null"`
+	ThumbnailPath string     `json:"thumbnail_path,omitempty" gorm:"size:500"`
+	UploadStatus  string     `json:"upload_status" gorm:"size:20;default:'uploading';index"` // uploading, completed, failed, deleted
+	IsTemporary   bool       `json:"is_temporary" gorm:"default:true;index"`
+	ExpiresAt     *time.Time `json:"expires_at" gorm:"index"`
+
+	// Media dimensions, when known
+	Width    int `json:"width,omitempty"`    // images, in pixels
+	Height   int `json:"height,omitempty"`   // images, in pixels
+	Duration int `json:"duration,omitempty"` // audio/video in seconds
 
 	// Relationships
 	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
@@ -352,6 +605,21 @@ type UserPreferences struct {
 	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
 }
 
+// DefaultUserPreferences returns the preferences of a user who hasn't changed
+// any
+func DefaultUserPreferences(userID uuid.UUID) *UserPreferences {
+	return &UserPreferences{
+		UserID:               userID,
+		Theme:                "light",
+		FontSize:             "medium",
+		AutoDownloadMedia:    true,
+		CompressImages:       true,
+		KeyboardShortcuts:    true,
+		ShowTypingIndicators: true,
+		GroupNotifications:   true,
+	}
+}
+
 // ServerStats model for server statistics
 type ServerStats struct {
 	BaseModel
@@ -366,17 +634,27 @@ type ServerStats struct {
 
 // Response structures
 type APIResponse struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   interface{} `json:"error,omitempty"`
+	Success bool           `json:"success"`
+	Message string         `json:"message"`
+	Data    interface{}    `json:"data,omitempty"`
+	Error   *ErrorResponse `json:"error,omitempty"`
+}
+
+// FieldError describes a request field that failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
 }
 
+// PaginationMeta describes a page of an offset paginated listing. Total and
+// TotalPages are -1 when the total wasn't computed for the page.
 type PaginationMeta struct {
-	Page       int `json:"page"`
-	Limit      int `json:"limit"`
-	Total      int `json:"total"`
-	TotalPages int `json:"total_pages"`
+	Page       int  `json:"page"`
+	Limit      int  `json:"limit"`
+	Total      int  `json:"total"`
+	TotalPages int  `json:"total_pages"`
+	HasMore    bool `json:"has_more"`
 }
 
 type PaginatedResponse struct {
@@ -384,6 +662,18 @@ type PaginatedResponse struct {
 	Meta PaginationMeta `json:"meta"`
 }
 
+// CursorPaginationMeta describes a page fetched with keyset (cursor) pagination
+type CursorPaginationMeta struct {
+	Limit      int    `json:"limit"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type CursorPaginatedResponse struct {
+	APIResponse
+	Meta CursorPaginationMeta `json:"meta"`
+}
+
 // Request structures for User Management
 type CreateUserRequest struct {
 	Username    string `json:"username" validate:"required,min=3,max=50"`
@@ -400,24 +690,128 @@ type LoginRequest struct {
 	Password   string `json:"password" validate:"required"`
 	DeviceID   string `json:"device_id" validate:"required"`
 	DeviceType string `json:"device_type,omitempty"` // web, mobile, desktop
+
+	// Filled in from the HTTP request
+	IPAddress string `json:"-"`
+	UserAgent string `json:"-"`
 }
 
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" validate:"required"`
 }
 
+// ChangePasswordRequest replaces the password of the current user
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=6"`
+}
+
+// RegisterFCMTokenRequest sets the push notification token of the device of
+// the current session
+type RegisterFCMTokenRequest struct {
+	FCMToken string `json:"fcm_token" validate:"required,max=255"`
+}
+
+// RegisterDeviceRequest registers a push notification token of a device of
+// the current user
+type RegisterDeviceRequest struct {
+	Token    string `json:"token" validate:"required,max=255"`
+	Platform string `json:"platform" validate:"required,oneof=android ios web"`
+}
+
+// UnregisterDeviceRequest removes a push notification token of the current user
+type UnregisterDeviceRequest struct {
+	Token string `json:"token" validate:"required,max=255"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=6"`
+}
+
+// TOTPCodeRequest carries a code of the user's authenticator app
+type TOTPCodeRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// TwoFactorLoginRequest completes a login that requires a two-factor code
+type TwoFactorLoginRequest struct {
+	TwoFactorToken string `json:"two_factor_token" validate:"required"`
+	Code           string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// UpdateUserRequest changes the account fields that are set. IsActive can
+// only be changed by admins.
 type UpdateUserRequest struct {
-	FirstName   string `json:"first_name,omitempty"`
-	LastName    string `json:"last_name,omitempty"`
-	Bio         string `json:"bio,omitempty"`
-	Avatar      string `json:"avatar,omitempty"`
-	PhoneNumber string `json:"phone_number,omitempty"`
-	Status      string `json:"status,omitempty"`
+	Username    *string `json:"username,omitempty" validate:"omitempty,min=3,max=50"`
+	Email       *string `json:"email,omitempty" validate:"omitempty,email,max=255"`
+	FirstName   *string `json:"first_name,omitempty" validate:"omitempty,max=100"`
+	LastName    *string `json:"last_name,omitempty" validate:"omitempty,max=100"`
+	Bio         *string `json:"bio,omitempty" validate:"omitempty,max=2000"`
+	Avatar      *string `json:"avatar,omitempty" validate:"omitempty,max=500"`
+	PhoneNumber *string `json:"phone_number,omitempty" validate:"omitempty,max=20"`
+	IsActive    *bool   `json:"is_active,omitempty"`
+}
+
+// UpdateProfileRequest changes the profile of the current user. Fields left
+// out are kept; empty strings clear them.
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"display_name,omitempty" validate:"omitempty,max=200"`
+	Bio         *string `json:"bio,omitempty" validate:"omitempty,max=2000"`
+	Location    *string `json:"location,omitempty" validate:"omitempty,max=255"`
+	Website     *string `json:"website,omitempty" validate:"omitempty,max=500,len=0|url"`
+	Company     *string `json:"company,omitempty" validate:"omitempty,max=255"`
+	JobTitle    *string `json:"job_title,omitempty" validate:"omitempty,max=255"`
+	DateOfBirth *string `json:"date_of_birth,omitempty" validate:"omitempty,len=0|datetime=2006-01-02"`
+	Gender      *string `json:"gender,omitempty" validate:"omitempty,len=0|oneof=male female other prefer_not_to_say"`
 }
 
+// PublicUserProfile is the part of a profile other users can see
+type PublicUserProfile struct {
+	UserID      uuid.UUID `json:"user_id"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	Location    string    `json:"location"`
+	Website     string    `json:"website"`
+	Company     string    `json:"company"`
+	JobTitle    string    `json:"job_title"`
+}
+
+// CreateContactRequest sends a contact request to another user
+type CreateContactRequest struct {
+	ContactID uuid.UUID `json:"contact_id" validate:"required"`
+}
+
+// UpdateContactRequest changes the private details kept about a contact.
+// Fields left out are unchanged.
+type UpdateContactRequest struct {
+	NickName *string `json:"nickname,omitempty" validate:"omitempty,max=255"`
+	Notes    *string `json:"notes,omitempty" validate:"omitempty,max=2000"`
+}
+
+// BlockUserRequest optionally records why a user was blocked
+type BlockUserRequest struct {
+	Reason string `json:"reason,omitempty" validate:"omitempty,max=500"`
+}
+
+// UserSearchFilter narrows down user search results. RequesterID is the user
+// performing the search; it is excluded from the results together with users
+// who blocked them, and is the owner of the contact list used by HasContact.
+type UserSearchFilter struct {
+	RequesterID uuid.UUID
+	IsActive    *bool
+	Status      string
+	HasContact  *bool
+}
+
+// UpdateUserSettingsRequest changes the account settings that are set
 type UpdateUserSettingsRequest struct {
-	Language            string `json:"language,omitempty"`
-	Timezone            string `json:"timezone,omitempty"`
+	Language            string `json:"language,omitempty" validate:"omitempty,max=10,bcp47_language_tag"`
+	Timezone            string `json:"timezone,omitempty" validate:"omitempty,max=50,timezone"`
 	NotificationSound   *bool  `json:"notification_sound,omitempty"`
 	EmailNotifications  *bool  `json:"email_notifications,omitempty"`
 	PushNotifications   *bool  `json:"push_notifications,omitempty"`
@@ -427,28 +821,137 @@ type UpdateUserSettingsRequest struct {
 	AutoJoinPublicRooms *bool  `json:"auto_join_public_rooms,omitempty"`
 }
 
+// UserSettings are the account settings kept on User
+type UserSettings struct {
+	Language            string `json:"language"`
+	Timezone            string `json:"timezone"`
+	NotificationSound   bool   `json:"notification_sound"`
+	EmailNotifications  bool   `json:"email_notifications"`
+	PushNotifications   bool   `json:"push_notifications"`
+	ShowOnlineStatus    bool   `json:"show_online_status"`
+	ShowReadReceipts    bool   `json:"show_read_receipts"`
+	AllowDirectMessages bool   `json:"allow_direct_messages"`
+	AutoJoinPublicRooms bool   `json:"auto_join_public_rooms"`
+}
+
+// Settings returns the account settings of the user
+func (u *User) Settings() *UserSettings {
+	return &UserSettings{
+		Language:            u.Language,
+		Timezone:            u.Timezone,
+		NotificationSound:   u.NotificationSound,
+		EmailNotifications:  u.EmailNotifications,
+		PushNotifications:   u.PushNotifications,
+		ShowOnlineStatus:    u.ShowOnlineStatus,
+		ShowReadReceipts:    u.ShowReadReceipts,
+		AllowDirectMessages: u.AllowDirectMessages,
+		AutoJoinPublicRooms: u.AutoJoinPublicRooms,
+	}
+}
+
+// VisibleStatus is the status other users see. Invisible users and users
+// who hide their online status appear offline.
+func (u *User) VisibleStatus() string {
+	if u.Status == string(UserStatusInvisible) || !u.ShowOnlineStatus {
+		return string(UserStatusOffline)
+	}
+	return u.Status
+}
+
+// UpdatePreferencesRequest changes the fields that are set
+type UpdatePreferencesRequest struct {
+	Theme                string  `json:"theme,omitempty" validate:"omitempty,oneof=light dark auto"`
+	FontSize             string  `json:"font_size,omitempty" validate:"omitempty,oneof=small medium large"`
+	ChatWallpaper        *string `json:"chat_wallpaper,omitempty" validate:"omitempty,max=500"`
+	AutoDownloadMedia    *bool   `json:"auto_download_media,omitempty"`
+	CompressImages       *bool   `json:"compress_images,omitempty"`
+	KeyboardShortcuts    *bool   `json:"keyboard_shortcuts,omitempty"`
+	ShowTypingIndicators *bool   `json:"show_typing_indicators,omitempty"`
+	GroupNotifications   *bool   `json:"group_notifications,omitempty"`
+}
+
 // Request structures for Room Management
 type CreateRoomRequest struct {
-	Name            string `json:"name" validate:"required,max=255"`
-	Description     string `json:"description,omitempty"`
-	Type            string `json:"type" validate:"required,oneof=direct group public broadcast"`
-	Avatar          string `json:"avatar,omitempty"`
-	IsPublic        *bool  `json:"is_public,omitempty"`
-	MaxMembers      int    `json:"max_members,omitempty"`
-	RequireApproval bool   `json:"require_approval,omitempty"`
+	Name            string   `json:"name" validate:"required,max=255"`
+	Description     string   `json:"description,omitempty"`
+	Type            string   `json:"type" validate:"required,oneof=direct group public broadcast"`
+	Avatar          string   `json:"avatar,omitempty"`
+	IsPublic        *bool    `json:"is_public,omitempty"`
+	MaxMembers      int      `json:"max_members,omitempty"`
+	RequireApproval bool     `json:"require_approval,omitempty"`
+	Tags            []string `json:"tags,omitempty" validate:"omitempty,max=10,dive,max=50"`
 }
 
+// UpdateRoomRequest changes the fields that are set, so an empty description
+// clears it
 type UpdateRoomRequest struct {
-	Name        string `json:"name,omitempty"`
-	Description string `json:"description,omitempty"`
-	Avatar      string `json:"avatar,omitempty"`
-	IsPublic    *bool  `json:"is_public,omitempty"`
-	MaxMembers  int    `json:"max_members,omitempty"`
+	Name        *string `json:"name,omitempty" validate:"omitempty,max=255"`
+	Description *string `json:"description,omitempty"`
+	Avatar      string  `json:"avatar,omitempty"`
+	IsPublic    *bool   `json:"is_public,omitempty"`
+	MaxMembers  int     `json:"max_members,omitempty"`
+
+	// Replaces the tags of the room when set, an empty list clears them
+	Tags []string `json:"tags,omitempty" validate:"omitempty,max=10,dive,max=50"`
+
+	// Seconds members wait between messages, 0 disables slow mode
+	SlowModeSeconds *int `json:"slow_mode_seconds,omitempty" validate:"omitempty,min=0,max=21600"`
+
+	// Message types members may send
+	AllowFileUpload    *bool `json:"allow_file_upload,omitempty"`
+	AllowVoiceMessages *bool `json:"allow_voice_messages,omitempty"`
+	AllowVideoMessages *bool `json:"allow_video_messages,omitempty"`
+
+	// Days messages are kept, 0 keeps them forever
+	MessageRetentionDays *int  `json:"message_retention_days,omitempty" validate:"omitempty,min=0,max=3650"`
+	RequireApproval      *bool `json:"require_approval,omitempty"`
+	MuteAllMembers       *bool `json:"mute_all_members,omitempty"`
+	OnlyAdminCanPost     *bool `json:"only_admin_can_post,omitempty"`
 }
 
 type CreateInviteRequest struct {
-	ExpiresIn int `json:"expires_in,omitempty"` // seconds
-	MaxUses   int `json:"max_uses,omitempty"`   // 0 = unlimited
+	ExpiresIn int        `json:"expires_in,omitempty"` // seconds
+	MaxUses   int        `json:"max_uses,omitempty"`   // 0 = unlimited
+	InviteeID *uuid.UUID `json:"invitee_id,omitempty"` // Optional - notifies the invited user
+}
+
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=owner admin moderator member"`
+}
+
+// MuteMemberRequest mutes or unmutes a member, optionally for a number of
+// seconds only
+type MuteMemberRequest struct {
+	Muted    bool `json:"muted"`
+	Duration int  `json:"duration,omitempty" validate:"omitempty,min=1"`
+}
+
+// UpdateNotificationSettingsRequest sets which messages of a room notify the
+// caller
+type UpdateNotificationSettingsRequest struct {
+	NotificationLevel NotificationLevel `json:"notification_level" validate:"required,oneof=all mentions none mentions_only nothing"`
+}
+
+// TransferOwnershipRequest hands a room over to another member
+type TransferOwnershipRequest struct {
+	UserID uuid.UUID `json:"user_id" validate:"required"`
+}
+
+// BanMemberRequest bans a user from a room, optionally for a number of
+// seconds only
+type BanMemberRequest struct {
+	// UserID is only read when the user isn't given in the path
+	UserID   uuid.UUID `json:"user_id,omitempty"`
+	Reason   string    `json:"reason,omitempty" validate:"max=500"`
+	Duration int       `json:"duration,omitempty" validate:"omitempty,min=1"`
+}
+
+// CreateWebhookRequest registers a webhook for a room. A secret is
+// generated when none is given.
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" validate:"required,url,max=2048"`
+	Secret string   `json:"secret,omitempty" validate:"omitempty,min=16,max=128"`
+	Events []string `json:"events" validate:"required,min=1,max=50"`
 }
 
 type JoinRoomRequest struct {
@@ -464,11 +967,16 @@ type InviteToRoomRequest struct {
 
 // Request structures for Messaging
 type SendMessageRequest struct {
-	RoomID    uuid.UUID  `json:"room_id" validate:"required"`
-	Content   string     `json:"content" validate:"required"`
-	Type      string     `json:"type,omitempty" validate:"oneof=text image video audio file location system sticker voice_note"`
-	ReplyToID *uuid.UUID `json:"reply_to_id,omitempty"`
-	Metadata  string     `json:"metadata,omitempty"`
+	RoomID    uuid.UUID   `json:"room_id" validate:"required"`
+	Content   string      `json:"content" validate:"required"`
+	Type      string      `json:"type,omitempty" validate:"omitempty,oneof=text image video audio file location system sticker voice_note"`
+	ReplyToID *uuid.UUID  `json:"reply_to_id,omitempty"`
+	Metadata  string      `json:"metadata,omitempty"`
+	FileIDs   []uuid.UUID `json:"file_ids,omitempty" validate:"omitempty,max=10,dive,required"` // uploads to attach
+	// AttachmentIDs are uploads to attach as well, merged with FileIDs
+	AttachmentIDs []uuid.UUID `json:"attachment_ids,omitempty" validate:"omitempty,max=10,dive,required"`
+	// ScheduledAt delays sending until the given time when it is in the future
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
 }
 
 type EditMessageRequest struct {
@@ -476,14 +984,54 @@ type EditMessageRequest struct {
 	Metadata string `json:"metadata,omitempty"`
 }
 
+// ForwardMessageRequest names the target rooms, either as a list or as a
+// single room_id
+type ForwardMessageRequest struct {
+	RoomID  *uuid.UUID  `json:"room_id,omitempty"`
+	RoomIDs []uuid.UUID `json:"room_ids" validate:"required_without=RoomID,max=20,dive,required"`
+}
+
+// ForwardResult reports the outcome of forwarding a message into one room
+type ForwardResult struct {
+	RoomID    uuid.UUID  `json:"room_id"`
+	MessageID *uuid.UUID `json:"message_id,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+type SaveDraftRequest struct {
+	Content   string     `json:"content" validate:"required"`
+	ReplyToID *uuid.UUID `json:"reply_to_id,omitempty"`
+}
+
+// ReactToMessageRequest adds a reaction. Reacting again with the same emoji
+// changes nothing, unless Toggle is set, in which case it removes it.
 type ReactToMessageRequest struct {
-	Emoji string `json:"emoji" validate:"required"`
+	Emoji  string `json:"emoji" validate:"required"`
+	Toggle bool   `json:"toggle,omitempty"`
+}
+
+// ReactionResult reports the state of a reaction after a request
+type ReactionResult struct {
+	Emoji   string `json:"emoji"`
+	Reacted bool   `json:"reacted"`
+	Changed bool   `json:"changed"`
 }
 
 type MarkAsReadRequest struct {
 	MessageID uuid.UUID `json:"message_id" validate:"required"`
 }
 
+// MarkDeliveredRequest acknowledges messages fetched outside the WebSocket
+type MarkDeliveredRequest struct {
+	MessageIDs []uuid.UUID `json:"message_ids" validate:"required,min=1,max=100,dive,required"`
+}
+
+// MarkRoomReadRequest marks a room read up to a message, or entirely when
+// UpToMessageID is omitted
+type MarkRoomReadRequest struct {
+	UpToMessageID *uuid.UUID `json:"up_to_message_id,omitempty"`
+}
+
 // Request structures for File Upload
 type FileUploadRequest struct {
 	FileName    string `json:"file_name" validate:"required"`
@@ -493,26 +1041,36 @@ type FileUploadRequest struct {
 	IsTemporary bool   `json:"is_temporary,omitempty"`
 }
 
+// FileUploadResponse is a stored upload with the URL it is served from
+type FileUploadResponse struct {
+	FileUpload
+	URL string `json:"url"`
+}
+
 // WebSocket Message Types
 type WSMessageType string
 
 const (
-	WSTypePing             WSMessageType = "ping"
-	WSTypePong             WSMessageType = "pong"
-	WSTypeAuth             WSMessageType = "auth"
-	WSTypeMessage          WSMessageType = "message"
-	WSTypeMessageEdit      WSMessageType = "message_edit"
-	WSTypeMessageDelete    WSMessageType = "message_delete"
-	WSTypeMessageReaction  WSMessageType = "message_reaction"
-	WSTypeTypingStart      WSMessageType = "typing_start"
-	WSTypeTypingStop       WSMessageType = "typing_stop"
-	WSTypeUserJoin         WSMessageType = "user_join"
-	WSTypeUserLeave        WSMessageType = "user_leave"
-	WSTypeUserStatusChange WSMessageType = "user_status_change"
-	WSTypeRoomJoin         WSMessageType = "room_join"
-	WSTypeRoomLeave        WSMessageType = "room_leave"
-	WSTypeNotification     WSMessageType = "notification"
-	WSTypeError            WSMessageType = "error"
+	WSTypePing              WSMessageType = "ping"
+	WSTypePong              WSMessageType = "pong"
+	WSTypeAuth              WSMessageType = "auth"
+	WSTypeMessage           WSMessageType = "message"
+	WSTypeMessageEdit       WSMessageType = "message_edit"
+	WSTypeMessageDelete     WSMessageType = "message_delete"
+	WSTypeMessageReaction   WSMessageType = "message_reaction"
+	WSTypeTypingStart       WSMessageType = "typing_start"
+	WSTypeTypingStop        WSMessageType = "typing_stop"
+	WSTypeUserJoin          WSMessageType = "user_join"
+	WSTypeUserLeave         WSMessageType = "user_leave"
+	WSTypeUserStatusChange  WSMessageType = "user_status_change"
+	WSTypeUserProfileUpdate WSMessageType = "user_profile_update"
+	WSTypeRoomJoin          WSMessageType = "room_join"
+	WSTypeRoomLeave         WSMessageType = "room_leave"
+	WSTypeNotification      WSMessageType = "notification"
+	WSTypeError             WSMessageType = "error"
+	WSTypeReplay            WSMessageType = "replay"
+	WSTypeAck               WSMessageType = "ack"
+	WSTypePendingMessages   WSMessageType = "pending_messages"
 )
 
 // WebSocket Message Structure
@@ -541,9 +1099,23 @@ type WSUserStatusRequest struct {
 // Response structures for Authentication
 type LoginResponse struct {
 	User         User      `json:"user"`
-	AccessToken  string    `json:"access_token"`
-	RefreshToken string    `json:"refresh_token"`
+	AccessToken  string    `json:"access_token,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
 	ExpiresAt    time.Time `json:"expires_at"`
+	SessionID    uuid.UUID `json:"session_id"`
+
+	// Set instead of the tokens when the login is completed with a
+	// two-factor code, sent along with the token
+	Requires2FA    bool   `json:"requires_2fa,omitempty"`
+	TwoFactorToken string `json:"two_factor_token,omitempty"`
+}
+
+// TOTPSetupResponse holds the secret to add to an authenticator app, as
+// text, URI and QR code
+type TOTPSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+	QRCode          string `json:"qr_code"` // PNG data URL
 }
 
 // Response structures for Rooms
@@ -560,13 +1132,102 @@ type RoomMemberResponse struct {
 	UnreadCount int `json:"unread_count"`
 }
 
+// MemberSuggestion is a room member offered while typing a mention
+type MemberSuggestion struct {
+	UserID      uuid.UUID `json:"user_id"`
+	Username    string    `json:"username"`
+	Avatar      string    `json:"avatar"`
+	DisplayName string    `json:"display_name"`
+}
+
+// RoomMessageCounts counts the messages of a room over time windows, and the
+// members who sent one in the last 7 days
+type RoomMessageCounts struct {
+	Total           int64 `json:"total"`
+	Last24h         int64 `json:"last_24h"`
+	Last7d          int64 `json:"last_7d"`
+	Last30d         int64 `json:"last_30d"`
+	ActiveSenders7d int64 `json:"active_senders_7d"`
+}
+
+// ReactionCount is how often an emoji was used to react in a room
+type ReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int64  `json:"count"`
+}
+
+// RoomStatsResponse summarizes the activity of a room for its admins
+type RoomStatsResponse struct {
+	RoomID          uuid.UUID         `json:"room_id"`
+	Messages        RoomMessageCounts `json:"messages"`
+	MembersByRole   map[string]int64  `json:"members_by_role"`
+	PeakConnections int64             `json:"peak_connections"`
+	TopReactions    []ReactionCount   `json:"top_reactions"`
+}
+
 // Response structures for Messages
 type MessageResponse struct {
 	Message
 	SenderName    string         `json:"sender_name"`
 	SenderAvatar  string         `json:"sender_avatar"`
 	ReactionCount map[string]int `json:"reaction_count,omitempty"`
+	MyReactions   []string       `json:"my_reactions,omitempty"`
+	ReplyCount    int            `json:"reply_count,omitempty"`
 	IsRead        bool           `json:"is_read"`
+
+	// Receipt counts, only set on the viewer's own messages
+	DeliveredCount *int `json:"delivered_count,omitempty"`
+	ReadCount      *int `json:"read_count,omitempty"`
+
+	// The original of a forwarded message, while it still exists
+	ForwardedFrom *MessageResponse `json:"forwarded_from,omitempty"`
+}
+
+// ExportedMessage is a message as written to a room export
+type ExportedMessage struct {
+	ID             uuid.UUID          `json:"id"`
+	Type           string             `json:"type"`
+	Content        string             `json:"content"`
+	SenderID       uuid.UUID          `json:"sender_id"`
+	SenderUsername string             `json:"sender_username"`
+	SenderName     string             `json:"sender_name"`
+	ReplyToID      *uuid.UUID         `json:"reply_to_id,omitempty"`
+	CreatedAt      time.Time          `json:"created_at"`
+	EditedAt       *time.Time         `json:"edited_at,omitempty"`
+	Reactions      []ExportedReaction `json:"reactions,omitempty"`
+}
+
+// ExportedReaction is a reaction of an exported message
+type ExportedReaction struct {
+	Emoji    string    `json:"emoji"`
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+}
+
+// MessageTombstone is what remains visible of a deleted message
+type MessageTombstone struct {
+	ID        uuid.UUID `json:"id"`
+	RoomID    uuid.UUID `json:"room_id"`
+	SenderID  uuid.UUID `json:"sender_id"`
+	IsDeleted bool      `json:"is_deleted"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MarshalJSON serializes deleted messages as tombstones so their content,
+// metadata, attachments and reactions never leave the server
+func (m MessageResponse) MarshalJSON() ([]byte, error) {
+	if m.IsDeleted {
+		return json.Marshal(MessageTombstone{
+			ID:        m.ID,
+			RoomID:    m.RoomID,
+			SenderID:  m.SenderID,
+			IsDeleted: true,
+			CreatedAt: m.CreatedAt,
+		})
+	}
+
+	type messageResponse MessageResponse
+	return json.Marshal(messageResponse(m))
 }
 
 // Notification Response
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"realtime-api/internal/config"
@@ -12,17 +13,86 @@ import (
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+// healthCheckInterval is how often the connection is polled so a dropped
+// channel is noticed even when the connection itself didn't report closing
+const healthCheckInterval = 10 * time.Second
+
+// maxReconnectDelay caps the backoff between reconnection attempts
+const maxReconnectDelay = 30 * time.Second
+
 type RabbitMQ struct {
+	mu         sync.RWMutex
 	connection *amqp.Connection
 	channel    *amqp.Channel
 	config     *config.RabbitMQConfig
+	consumers  map[string]AsyncMessageHandler
+	done       chan struct{}
+	closeOnce  sync.Once
 }
 
 type MessageHandler func(body []byte) error
 
+// AsyncMessageHandler handles a message in its own time and calls done once
+// it is handled. The message is acknowledged when done gets a nil error and
+// retried otherwise, exactly like the result of a MessageHandler.
+type AsyncMessageHandler func(body []byte, done func(err error))
+
 var Client *RabbitMQ
 
 func Init(cfg *config.RabbitMQConfig) (*RabbitMQ, error) {
+	return InitWithRetry(cfg, 0, 0)
+}
+
+// InitWithRetry connects to RabbitMQ, retrying up to maxRetries times with an
+// exponential backoff starting at baseDelay (1s, 2s, 4s, ...). Once connected
+// the connection is watched and re-established in the background if it drops.
+func InitWithRetry(cfg *config.RabbitMQConfig, maxRetries int, baseDelay time.Duration) (*RabbitMQ, error) {
+	var conn *amqp.Connection
+	var ch *amqp.Channel
+	var err error
+
+	delay := baseDelay
+	for attempt := 0; ; attempt++ {
+		conn, ch, err = connect(cfg)
+		if err == nil {
+			break
+		}
+		if attempt >= maxRetries {
+			return nil, err
+		}
+
+		logger.Warn("RabbitMQ connection failed, retrying", logger.WithFields(map[string]interface{}{
+			"attempt": attempt + 1,
+			"delay":   delay.String(),
+			"error":   err.Error(),
+		}))
+		time.Sleep(delay)
+		delay *= 2
+	}
+
+	rabbitMQ := &RabbitMQ{
+		connection: conn,
+		channel:    ch,
+		config:     cfg,
+		consumers:  make(map[string]AsyncMessageHandler),
+		done:       make(chan struct{}),
+	}
+
+	Client = rabbitMQ
+	go rabbitMQ.watch()
+
+	logger.Info("RabbitMQ connected successfully", logger.WithFields(map[string]interface{}{
+		"host":     cfg.Host,
+		"port":     cfg.Port,
+		"exchange": cfg.Exchange,
+		"queue":    cfg.Queue,
+	}))
+
+	return rabbitMQ, nil
+}
+
+// connect dials RabbitMQ and declares the exchange, queue and binding
+func connect(cfg *config.RabbitMQConfig) (*amqp.Connection, *amqp.Channel, error) {
 	var url string
 	if cfg.URL != "" {
 		url = cfg.URL
@@ -33,13 +103,13 @@ func Init(cfg *config.RabbitMQConfig) (*RabbitMQ, error) {
 
 	conn, err := amqp.Dial(url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+		return nil, nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
 	}
 
 	ch, err := conn.Channel()
 	if err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("failed to open channel: %w", err)
+		return nil, nil, fmt.Errorf("failed to open channel: %w", err)
 	}
 
 	// Declare exchange
@@ -55,22 +125,30 @@ func Init(cfg *config.RabbitMQConfig) (*RabbitMQ, error) {
 	if err != nil {
 		ch.Close()
 		conn.Close()
-		return nil, fmt.Errorf("failed to declare exchange: %w", err)
+		return nil, nil, fmt.Errorf("failed to declare exchange: %w", err)
+	}
+
+	if err := declareDeadLettering(ch, cfg); err != nil {
+		ch.Close()
+		conn.Close()
+		return nil, nil, err
 	}
 
-	// Declare queue
+	// Declare queue; rejected messages go to the dead letter exchange
 	_, err = ch.QueueDeclare(
 		cfg.Queue, // name
 		true,      // durable
 		false,     // delete when unused
 		false,     // exclusive
 		false,     // no-wait
-		nil,       // arguments
+		amqp.Table{
+			"x-dead-letter-exchange": cfg.DeadLetterExchange,
+		},
 	)
 	if err != nil {
 		ch.Close()
 		conn.Close()
-		return nil, fmt.Errorf("failed to declare queue: %w", err)
+		return nil, nil, fmt.Errorf("failed to declare queue: %w", err)
 	}
 
 	// Bind queue to exchange
@@ -84,25 +162,194 @@ func Init(cfg *config.RabbitMQConfig) (*RabbitMQ, error) {
 	if err != nil {
 		ch.Close()
 		conn.Close()
-		return nil, fmt.Errorf("failed to bind queue: %w", err)
+		return nil, nil, fmt.Errorf("failed to bind queue: %w", err)
 	}
 
-	rabbitMQ := &RabbitMQ{
-		connection: conn,
-		channel:    ch,
-		config:     cfg,
+	return conn, ch, nil
+}
+
+// DeclareQueue declares a durable queue bound to the exchange with the given
+// routing key. Rejected messages are dead lettered like the main queue's.
+func (r *RabbitMQ) DeclareQueue(queueName, routingKey string) error {
+	r.mu.RLock()
+	channel := r.channel
+	r.mu.RUnlock()
+
+	if _, err := channel.QueueDeclare(queueName, true, false, false, false, amqp.Table{
+		"x-dead-letter-exchange": r.config.DeadLetterExchange,
+	}); err != nil {
+		return fmt.Errorf("failed to declare queue: %w", err)
 	}
 
-	Client = rabbitMQ
+	if err := channel.QueueBind(queueName, routingKey, r.config.Exchange, false, nil); err != nil {
+		return fmt.Errorf("failed to bind queue: %w", err)
+	}
+	return nil
+}
 
-	logger.Info("RabbitMQ connected successfully", logger.WithFields(map[string]interface{}{
-		"host":     cfg.Host,
-		"port":     cfg.Port,
-		"exchange": cfg.Exchange,
-		"queue":    cfg.Queue,
-	}))
+// retryQueueName is the queue rejected messages wait in before going back to
+// the main queue
+func retryQueueName(cfg *config.RabbitMQConfig) string {
+	return cfg.Queue + ".retry"
+}
 
-	return rabbitMQ, nil
+// declareDeadLettering sets up the retry and dead letter topology. Messages
+// rejected from the main queue are routed by the dead letter exchange to a
+// retry queue, which sends them back to the main exchange once RetryDelay has
+// passed. Each round trip adds to the x-death count the consumer checks
+// before giving up and parking the message in the dead letter queue.
+func declareDeadLettering(ch *amqp.Channel, cfg *config.RabbitMQConfig) error {
+	if err := ch.ExchangeDeclare(cfg.DeadLetterExchange, "topic", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare dead letter exchange: %w", err)
+	}
+
+	retryQueue := retryQueueName(cfg)
+	if _, err := ch.QueueDeclare(retryQueue, true, false, false, false, amqp.Table{
+		"x-message-ttl":          int32(cfg.RetryDelay),
+		"x-dead-letter-exchange": cfg.Exchange,
+	}); err != nil {
+		return fmt.Errorf("failed to declare retry queue: %w", err)
+	}
+
+	if err := ch.QueueBind(retryQueue, "#", cfg.DeadLetterExchange, false, nil); err != nil {
+		return fmt.Errorf("failed to bind retry queue: %w", err)
+	}
+
+	// Exhausted messages are published straight to the dead letter queue
+	if _, err := ch.QueueDeclare(cfg.DeadLetterQueue, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare dead letter queue: %w", err)
+	}
+
+	return nil
+}
+
+// deathCount returns how often a message was rejected from the queue
+func deathCount(headers amqp.Table, queue string) int64 {
+	deaths, ok := headers["x-death"].([]interface{})
+	if !ok {
+		return 0
+	}
+
+	var count int64
+	for _, death := range deaths {
+		table, ok := death.(amqp.Table)
+		if !ok || table["queue"] != queue || table["reason"] != "rejected" {
+			continue
+		}
+		if n, ok := table["count"].(int64); ok {
+			count += n
+		}
+	}
+	return count
+}
+
+// watch reconnects when the connection reports closing or the periodic
+// health check fails, until Close is called
+func (r *RabbitMQ) watch() {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		r.mu.RLock()
+		closed := r.connection.NotifyClose(make(chan *amqp.Error, 1))
+		r.mu.RUnlock()
+
+		if !r.waitForFailure(closed, ticker.C) || !r.reconnect() {
+			return
+		}
+	}
+}
+
+// waitForFailure blocks until the connection closes or fails a health check.
+// It returns false once the client is closed.
+func (r *RabbitMQ) waitForFailure(closed <-chan *amqp.Error, tick <-chan time.Time) bool {
+	for {
+		select {
+		case <-r.done:
+			return false
+		case amqpErr := <-closed:
+			fields := map[string]interface{}{}
+			if amqpErr != nil {
+				fields["error"] = amqpErr.Error()
+			}
+			logger.Warn("RabbitMQ connection closed", logger.WithFields(fields))
+			return true
+		case <-tick:
+			if err := r.Health(); err != nil {
+				logger.Warn("RabbitMQ health check failed", logger.WithField("error", err.Error()))
+				return true
+			}
+		}
+	}
+}
+
+// reconnect replaces the connection and channel, backing off exponentially
+// between attempts. It returns false if the client was closed meanwhile.
+func (r *RabbitMQ) reconnect() bool {
+	delay := time.Second
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-r.done:
+			return false
+		default:
+		}
+
+		conn, ch, err := connect(r.config)
+		if err == nil {
+			r.mu.Lock()
+			select {
+			case <-r.done:
+				// Closed while connecting
+				r.mu.Unlock()
+				conn.Close()
+				return false
+			default:
+			}
+
+			oldConn := r.connection
+			r.connection = conn
+			r.channel = ch
+			consumers := make(map[string]AsyncMessageHandler, len(r.consumers))
+			for queue, handler := range r.consumers {
+				consumers[queue] = handler
+			}
+			r.mu.Unlock()
+
+			if oldConn != nil && !oldConn.IsClosed() {
+				oldConn.Close()
+			}
+
+			// Consumers were bound to the old channel
+			for queue, handler := range consumers {
+				if err := r.consume(queue, handler); err != nil {
+					logger.Error("Failed to restore RabbitMQ consumer", logger.WithFields(map[string]interface{}{
+						"queue": queue,
+						"error": err.Error(),
+					}))
+				}
+			}
+
+			logger.Info("RabbitMQ reconnected", logger.WithField("attempts", attempt))
+			return true
+		}
+
+		logger.Warn("RabbitMQ reconnection failed", logger.WithFields(map[string]interface{}{
+			"attempt": attempt,
+			"delay":   delay.String(),
+			"error":   err.Error(),
+		}))
+
+		select {
+		case <-r.done:
+			return false
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
 }
 
 func (r *RabbitMQ) PublishMessage(routingKey string, message interface{}) error {
@@ -114,7 +361,11 @@ func (r *RabbitMQ) PublishMessage(routingKey string, message interface{}) error
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err = r.channel.PublishWithContext(
+	r.mu.RLock()
+	channel := r.channel
+	r.mu.RUnlock()
+
+	err = channel.PublishWithContext(
 		ctx,
 		r.config.Exchange, // exchange
 		routingKey,        // routing key
@@ -140,8 +391,34 @@ func (r *RabbitMQ) PublishMessage(routingKey string, message interface{}) error
 	return nil
 }
 
+// ConsumeMessages registers a consumer; it is registered again after a reconnect
 func (r *RabbitMQ) ConsumeMessages(queueName string, handler MessageHandler) error {
-	msgs, err := r.channel.Consume(
+	return r.ConsumeMessagesAsync(queueName, func(body []byte, done func(err error)) {
+		done(handler(body))
+	})
+}
+
+// ConsumeMessagesAsync registers a consumer that acknowledges messages once
+// handler reports them done, so a handler can hold on to messages while it
+// batches them. The broker keeps delivering in the meantime; handlers must
+// finish messages before the broker's delivery acknowledgement timeout.
+func (r *RabbitMQ) ConsumeMessagesAsync(queueName string, handler AsyncMessageHandler) error {
+	if err := r.consume(queueName, handler); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.consumers[queueName] = handler
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *RabbitMQ) consume(queueName string, handler AsyncMessageHandler) error {
+	r.mu.RLock()
+	channel := r.channel
+	r.mu.RUnlock()
+
+	msgs, err := channel.Consume(
 		queueName, // queue
 		"",        // consumer
 		false,     // auto-ack
@@ -156,16 +433,10 @@ func (r *RabbitMQ) ConsumeMessages(queueName string, handler MessageHandler) err
 
 	go func() {
 		for d := range msgs {
-			err := handler(d.Body)
-			if err != nil {
-				logger.Error("Failed to handle message", logger.WithFields(map[string]interface{}{
-					"error":   err.Error(),
-					"message": string(d.Body),
-				}))
-				d.Nack(false, true) // negative acknowledge and requeue
-			} else {
-				d.Ack(false) // acknowledge
-			}
+			d := d
+			handler(d.Body, func(err error) {
+				r.settle(queueName, d, err)
+			})
 		}
 	}()
 
@@ -173,6 +444,71 @@ func (r *RabbitMQ) ConsumeMessages(queueName string, handler MessageHandler) err
 	return nil
 }
 
+// settle acknowledges a handled message, or sends a failed one to the retry
+// queue until it runs out of retries and is dead lettered
+func (r *RabbitMQ) settle(queueName string, d amqp.Delivery, err error) {
+	if err == nil {
+		d.Ack(false) // acknowledge
+		return
+	}
+
+	attempts := deathCount(d.Headers, queueName) + 1
+	logger.Error("Failed to handle message", logger.WithFields(map[string]interface{}{
+		"error":    err.Error(),
+		"message":  string(d.Body),
+		"attempts": attempts,
+	}))
+
+	// Dead letters have nowhere further to go
+	if queueName == r.config.DeadLetterQueue {
+		d.Nack(false, true)
+		return
+	}
+
+	if attempts <= int64(r.config.MaxRetries) {
+		d.Nack(false, false) // dead letter it to the retry queue
+		return
+	}
+
+	if err := r.publishDeadLetter(d); err != nil {
+		logger.Error("Failed to dead letter message", logger.WithField("error", err.Error()))
+		d.Nack(false, true) // keep it rather than lose it
+		return
+	}
+	d.Ack(false)
+}
+
+// publishDeadLetter parks a message that ran out of retries in the dead letter queue
+func (r *RabbitMQ) publishDeadLetter(d amqp.Delivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r.mu.RLock()
+	channel := r.channel
+	r.mu.RUnlock()
+
+	return channel.PublishWithContext(
+		ctx,
+		"",                       // default exchange
+		r.config.DeadLetterQueue, // routing key
+		false,                    // mandatory
+		false,                    // immediate
+		amqp.Publishing{
+			Headers:      d.Headers,
+			ContentType:  d.ContentType,
+			Body:         d.Body,
+			DeliveryMode: amqp.Persistent,
+			Timestamp:    time.Now(),
+		},
+	)
+}
+
+// ConsumeDeadLetters consumes the messages that ran out of retries, for
+// monitoring or manual replay
+func (r *RabbitMQ) ConsumeDeadLetters(handler MessageHandler) error {
+	return r.ConsumeMessages(r.config.DeadLetterQueue, handler)
+}
+
 func (r *RabbitMQ) PublishUserEvent(userID string, eventType string, data interface{}) error {
 	event := map[string]interface{}{
 		"user_id":    userID,
@@ -226,6 +562,9 @@ func (r *RabbitMQ) PublishNotificationEvent(userID string, notification interfac
 }
 
 func (r *RabbitMQ) Health() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	if r.connection == nil || r.connection.IsClosed() {
 		return fmt.Errorf("RabbitMQ connection is closed")
 	}
@@ -236,6 +575,11 @@ func (r *RabbitMQ) Health() error {
 }
 
 func (r *RabbitMQ) Close() error {
+	r.closeOnce.Do(func() { close(r.done) })
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	var err error
 	if r.channel != nil {
 		err = r.channel.Close()
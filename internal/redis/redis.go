@@ -14,6 +14,8 @@ import (
 
 type Redis struct {
 	client rueidis.Client
+	// stats is client, counting its commands for PoolStats
+	stats *statsClient
 }
 
 type PubSubMessage struct {
@@ -39,7 +41,7 @@ func Init(cfg *config.RedisConfig) (*Redis, error) {
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
-	redisClient := &Redis{client: client}
+	redisClient := New(client)
 	Client = redisClient
 
 	// Test connection
@@ -61,6 +63,13 @@ func Init(cfg *config.RedisConfig) (*Redis, error) {
 	return redisClient, nil
 }
 
+// New wraps an already configured rueidis client. Unlike Init it does not
+// replace the global Client.
+func New(client rueidis.Client) *Redis {
+	stats := newStatsClient(client)
+	return &Redis{client: stats, stats: stats}
+}
+
 func GetClient() *Redis {
 	if Client == nil {
 		logger.Fatal("Redis client not initialized")
@@ -96,6 +105,20 @@ func (r *Redis) Get(ctx context.Context, key string) (string, error) {
 	return resp.ToString()
 }
 
+// GetEx returns the value of key and resets its expiry, or false when key
+// doesn't exist
+func (r *Redis) GetEx(ctx context.Context, key string, expiration time.Duration) (string, bool, error) {
+	cmd := r.client.B().Getex().Key(key).ExSeconds(int64(expiration.Seconds())).Build()
+	value, err := r.client.Do(ctx, cmd).ToString()
+	if rueidis.IsRedisNil(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
 func (r *Redis) Del(ctx context.Context, keys ...string) (int64, error) {
 	cmd := r.client.B().Del().Key(keys...).Build()
 	resp := r.client.Do(ctx, cmd)
@@ -115,6 +138,27 @@ func (r *Redis) Exists(ctx context.Context, key string) (bool, error) {
 	return count > 0, err
 }
 
+// SetNX sets key only if it doesn't exist yet and reports whether it did
+func (r *Redis) SetNX(ctx context.Context, key, value string, expiration time.Duration) (bool, error) {
+	cmd := r.client.B().Set().Key(key).Value(value).Nx().ExSeconds(int64(expiration.Seconds())).Build()
+	err := r.client.Do(ctx, cmd).Error()
+	if rueidis.IsRedisNil(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// TTL returns the time left before key expires, or a negative duration when
+// it has no expiry or doesn't exist
+func (r *Redis) TTL(ctx context.Context, key string) (time.Duration, error) {
+	cmd := r.client.B().Ttl().Key(key).Build()
+	seconds, err := r.client.Do(ctx, cmd).ToInt64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
 func (r *Redis) Incr(ctx context.Context, key string) (int64, error) {
 	cmd := r.client.B().Incr().Key(key).Build()
 	resp := r.client.Do(ctx, cmd)
@@ -172,6 +216,15 @@ func (r *Redis) RPop(ctx context.Context, key string) (string, error) {
 	return resp.ToString()
 }
 
+// Pipeline sends cmds in one round trip and returns their results in the
+// same order
+func (r *Redis) Pipeline(ctx context.Context, cmds []rueidis.Completed) []rueidis.RedisResult {
+	if len(cmds) == 0 {
+		return nil
+	}
+	return r.client.DoMulti(ctx, cmds...)
+}
+
 func (r *Redis) Health() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -285,6 +338,17 @@ func (r *Redis) AddUserToRoom(ctx context.Context, roomID, userID string) error
 	return r.client.Do(ctx, cmd).Error()
 }
 
+// AddUsersToRoom adds several members to the cached membership of a room
+// with a single command
+func (r *Redis) AddUsersToRoom(ctx context.Context, roomID string, userIDs []string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	key := fmt.Sprintf("room_members:%s", roomID)
+	cmd := r.client.B().Sadd().Key(key).Member(userIDs...).Build()
+	return r.client.Do(ctx, cmd).Error()
+}
+
 func (r *Redis) RemoveUserFromRoom(ctx context.Context, roomID, userID string) error {
 	key := fmt.Sprintf("room_members:%s", roomID)
 	cmd := r.client.B().Srem().Key(key).Member(userID).Build()
@@ -301,6 +365,25 @@ func (r *Redis) GetRoomMembers(ctx context.Context, roomID string) ([]string, er
 	return result.AsStrSlice()
 }
 
+// GetRoomsMembers returns the cached members of several rooms by room ID in
+// one round trip. Rooms without cached members map to an empty slice.
+func (r *Redis) GetRoomsMembers(ctx context.Context, roomIDs []string) (map[string][]string, error) {
+	cmds := make([]rueidis.Completed, len(roomIDs))
+	for i, roomID := range roomIDs {
+		cmds[i] = r.client.B().Smembers().Key(fmt.Sprintf("room_members:%s", roomID)).Build()
+	}
+
+	members := make(map[string][]string, len(roomIDs))
+	for i, resp := range r.Pipeline(ctx, cmds) {
+		userIDs, err := resp.AsStrSlice()
+		if err != nil {
+			return nil, err
+		}
+		members[roomIDs[i]] = userIDs
+	}
+	return members, nil
+}
+
 func (r *Redis) IsUserInRoom(ctx context.Context, roomID, userID string) (bool, error) {
 	key := fmt.Sprintf("room_members:%s", roomID)
 	cmd := r.client.B().Sismember().Key(key).Member(userID).Build()
@@ -310,3 +393,342 @@ func (r *Redis) IsUserInRoom(ctx context.Context, roomID, userID string) (bool,
 	}
 	return result.AsBool()
 }
+
+// Room event history, a sorted set per room scored by publish time in
+// milliseconds so reconnecting clients can catch up on what they missed
+func (r *Redis) AddRoomEvent(ctx context.Context, roomID, eventID string, at time.Time, event string, maxEvents int64, ttl time.Duration) error {
+	key := fmt.Sprintf("room_events:%s", roomID)
+	score := float64(at.UnixMilli())
+	cmds := rueidis.Commands{
+		r.client.B().Zadd().Key(key).ScoreMember().ScoreMember(score, event).Build(),
+		r.client.B().Zremrangebyrank().Key(key).Start(0).Stop(-maxEvents - 1).Build(),
+		r.client.B().Expire().Key(key).Seconds(int64(ttl.Seconds())).Build(),
+		r.client.B().Set().Key(fmt.Sprintf("event_time:%s", eventID)).Value(fmt.Sprint(at.UnixMilli())).ExSeconds(int64(ttl.Seconds())).Build(),
+	}
+	for _, resp := range r.client.DoMulti(ctx, cmds...) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetEventTime returns when a recorded room event was published, or false
+// when it is unknown or has expired from the history
+func (r *Redis) GetEventTime(ctx context.Context, eventID string) (time.Time, bool, error) {
+	cmd := r.client.B().Get().Key(fmt.Sprintf("event_time:%s", eventID)).Build()
+	ms, err := r.client.Do(ctx, cmd).AsInt64()
+	if rueidis.IsRedisNil(err) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return time.UnixMilli(ms), true, nil
+}
+
+// GetRoomEventsSince returns up to limit events of a room published at or
+// after since, oldest first
+func (r *Redis) GetRoomEventsSince(ctx context.Context, roomID string, since time.Time, limit int64) ([]string, error) {
+	key := fmt.Sprintf("room_events:%s", roomID)
+	cmd := r.client.B().Zrangebyscore().Key(key).Min(fmt.Sprint(since.UnixMilli())).Max("+inf").Limit(0, limit).Build()
+	result := r.client.Do(ctx, cmd)
+	if err := result.Error(); err != nil {
+		return nil, err
+	}
+	return result.AsStrSlice()
+}
+
+// Event history, a capped sorted set per pub/sub channel scored by publish
+// time in milliseconds, for monitoring what was published
+func (r *Redis) AddChannelEvent(ctx context.Context, channel string, at time.Time, event string, maxEvents int64, ttl time.Duration) error {
+	key := fmt.Sprintf("event_history:%s", channel)
+	cmds := rueidis.Commands{
+		r.client.B().Zadd().Key(key).ScoreMember().ScoreMember(float64(at.UnixMilli()), event).Build(),
+		r.client.B().Zremrangebyrank().Key(key).Start(0).Stop(-maxEvents - 1).Build(),
+		r.client.B().Expire().Key(key).Seconds(int64(ttl.Seconds())).Build(),
+	}
+	for _, resp := range r.client.DoMulti(ctx, cmds...) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetChannelEvents returns the events of a channel published at or after
+// since, newest first
+func (r *Redis) GetChannelEvents(ctx context.Context, channel string, since time.Time) ([]string, error) {
+	key := fmt.Sprintf("event_history:%s", channel)
+	cmd := r.client.B().Zrevrangebyscore().Key(key).Max("+inf").Min(fmt.Sprint(since.UnixMilli())).Build()
+	result := r.client.Do(ctx, cmd)
+	if err := result.Error(); err != nil {
+		return nil, err
+	}
+	return result.AsStrSlice()
+}
+
+// Peak concurrent connections per room, kept as the scores of a sorted set
+// that only ever grow
+func (r *Redis) RecordRoomConnections(ctx context.Context, roomID string, connections int64) error {
+	cmd := r.client.B().Zadd().Key("room_connection_peaks").Gt().ScoreMember().ScoreMember(float64(connections), roomID).Build()
+	return r.client.Do(ctx, cmd).Error()
+}
+
+func (r *Redis) GetRoomConnectionPeak(ctx context.Context, roomID string) (int64, error) {
+	cmd := r.client.B().Zscore().Key("room_connection_peaks").Member(roomID).Build()
+	peak, err := r.client.Do(ctx, cmd).AsFloat64()
+	if rueidis.IsRedisNil(err) {
+		return 0, nil
+	}
+	return int64(peak), err
+}
+
+// Token blacklist for revoked sessions, keyed by the token ID (jti)
+func (r *Redis) BlacklistToken(ctx context.Context, tokenID string, ttl time.Duration) error {
+	key := fmt.Sprintf("token_blacklist:%s", tokenID)
+	return r.Set(ctx, key, "1", ttl)
+}
+
+func (r *Redis) IsTokenBlacklisted(ctx context.Context, tokenID string) (bool, error) {
+	key := fmt.Sprintf("token_blacklist:%s", tokenID)
+	return r.Exists(ctx, key)
+}
+
+// Password reset tokens, holding the hash of the one outstanding token of a
+// user. Issuing a new token replaces the previous one.
+func (r *Redis) SetPasswordResetToken(ctx context.Context, userID, tokenHash string, ttl time.Duration) error {
+	key := fmt.Sprintf("password_reset:%s", userID)
+	return r.Set(ctx, key, tokenHash, ttl)
+}
+
+// GetPasswordResetToken returns the token hash of a user, "" when they have
+// none or it expired
+func (r *Redis) GetPasswordResetToken(ctx context.Context, userID string) (string, error) {
+	key := fmt.Sprintf("password_reset:%s", userID)
+	tokenHash, err := r.client.Do(ctx, r.client.B().Get().Key(key).Build()).ToString()
+	if rueidis.IsRedisNil(err) {
+		return "", nil
+	}
+	return tokenHash, err
+}
+
+// DeletePasswordResetToken removes the token of a user, reporting whether
+// there was one. Only one of several concurrent callers sees true, which
+// makes tokens single-use.
+func (r *Redis) DeletePasswordResetToken(ctx context.Context, userID string) (bool, error) {
+	deleted, err := r.Del(ctx, fmt.Sprintf("password_reset:%s", userID))
+	return deleted > 0, err
+}
+
+// AddPasswordResetRequest counts a password reset request under key, such as
+// an email or IP address, returning the requests within the window so far
+// and the time until the window ends
+func (r *Redis) AddPasswordResetRequest(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	key = fmt.Sprintf("password_reset_requests:%s", key)
+	count, err := r.Incr(ctx, key)
+	if err != nil {
+		return 0, 0, err
+	}
+	if count == 1 {
+		if err := r.Expire(ctx, key, window); err != nil {
+			return 0, 0, err
+		}
+		return count, window, nil
+	}
+	ttl, err := r.TTL(ctx, key)
+	if err != nil {
+		return 0, 0, err
+	}
+	if ttl < 0 {
+		// The expiry was lost, e.g. when the first request failed to set it
+		if err := r.Expire(ctx, key, window); err != nil {
+			return 0, 0, err
+		}
+		ttl = window
+	}
+	return count, ttl, nil
+}
+
+// Two-factor login challenges, holding the login awaiting its code as JSON
+func (r *Redis) SetTwoFactorChallenge(ctx context.Context, token, login string, ttl time.Duration) error {
+	key := fmt.Sprintf("2fa_challenge:%s", token)
+	return r.Set(ctx, key, login, ttl)
+}
+
+// GetTwoFactorChallenge returns the login of a challenge, "" when unknown or
+// expired
+func (r *Redis) GetTwoFactorChallenge(ctx context.Context, token string) (string, error) {
+	key := fmt.Sprintf("2fa_challenge:%s", token)
+	login, err := r.client.Do(ctx, r.client.B().Get().Key(key).Build()).ToString()
+	if rueidis.IsRedisNil(err) {
+		return "", nil
+	}
+	return login, err
+}
+
+// AddTwoFactorAttempt counts a failed code for a challenge, returning the
+// failures so far
+func (r *Redis) AddTwoFactorAttempt(ctx context.Context, token string, ttl time.Duration) (int64, error) {
+	key := fmt.Sprintf("2fa_attempts:%s", token)
+	resps := r.client.DoMulti(ctx,
+		r.client.B().Incr().Key(key).Build(),
+		r.client.B().Expire().Key(key).Seconds(int64(ttl.Seconds())).Build(),
+	)
+	return resps[0].AsInt64()
+}
+
+// DeleteTwoFactorChallenge ends a challenge, so its token can't be used again
+func (r *Redis) DeleteTwoFactorChallenge(ctx context.Context, token string) error {
+	for _, resp := range r.client.DoMulti(ctx,
+		r.client.B().Del().Key(fmt.Sprintf("2fa_challenge:%s", token)).Build(),
+		r.client.B().Del().Key(fmt.Sprintf("2fa_attempts:%s", token)).Build(),
+	) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// User preferences cache, holding the preferences of a user as JSON
+func (r *Redis) SetUserPreferences(ctx context.Context, userID, preferences string, ttl time.Duration) error {
+	key := fmt.Sprintf("prefs:%s", userID)
+	cmd := r.client.B().Setex().Key(key).Seconds(int64(ttl.Seconds())).Value(preferences).Build()
+	return r.client.Do(ctx, cmd).Error()
+}
+
+// GetUserPreferences returns the cached preferences of a user, "" when they
+// aren't cached
+func (r *Redis) GetUserPreferences(ctx context.Context, userID string) (string, error) {
+	key := fmt.Sprintf("prefs:%s", userID)
+	preferences, err := r.client.Do(ctx, r.client.B().Get().Key(key).Build()).ToString()
+	if rueidis.IsRedisNil(err) {
+		return "", nil
+	}
+	return preferences, err
+}
+
+// Unread counts cache, holding the unread count of each room of a user as
+// JSON
+func (r *Redis) SetUnreadCounts(ctx context.Context, userID, counts string, ttl time.Duration) error {
+	key := fmt.Sprintf("unread_counts:%s", userID)
+	cmd := r.client.B().Setex().Key(key).Seconds(int64(ttl.Seconds())).Value(counts).Build()
+	return r.client.Do(ctx, cmd).Error()
+}
+
+// GetUnreadCounts returns the cached unread counts of a user, "" when they
+// aren't cached
+func (r *Redis) GetUnreadCounts(ctx context.Context, userID string) (string, error) {
+	key := fmt.Sprintf("unread_counts:%s", userID)
+	counts, err := r.client.Do(ctx, r.client.B().Get().Key(key).Build()).ToString()
+	if rueidis.IsRedisNil(err) {
+		return "", nil
+	}
+	return counts, err
+}
+
+// DeleteUnreadCounts drops the cached unread counts of a user
+func (r *Redis) DeleteUnreadCounts(ctx context.Context, userID string) error {
+	key := fmt.Sprintf("unread_counts:%s", userID)
+	return r.client.Do(ctx, r.client.B().Del().Key(key).Build()).Error()
+}
+
+// SetBlockSet caches the IDs of the users a user blocked or was blocked by,
+// encoded by the caller
+func (r *Redis) SetBlockSet(ctx context.Context, userID, userIDs string, ttl time.Duration) error {
+	key := fmt.Sprintf("blocks:%s", userID)
+	cmd := r.client.B().Setex().Key(key).Seconds(int64(ttl.Seconds())).Value(userIDs).Build()
+	return r.client.Do(ctx, cmd).Error()
+}
+
+// GetBlockSet returns the cached block set of a user, "" when it isn't cached
+func (r *Redis) GetBlockSet(ctx context.Context, userID string) (string, error) {
+	key := fmt.Sprintf("blocks:%s", userID)
+	userIDs, err := r.client.Do(ctx, r.client.B().Get().Key(key).Build()).ToString()
+	if rueidis.IsRedisNil(err) {
+		return "", nil
+	}
+	return userIDs, err
+}
+
+// DeleteBlockSets drops the cached block sets of the given users
+func (r *Redis) DeleteBlockSets(ctx context.Context, userIDs ...string) error {
+	cmds := make(rueidis.Commands, 0, len(userIDs))
+	for _, userID := range userIDs {
+		cmds = append(cmds, r.client.B().Del().Key(fmt.Sprintf("blocks:%s", userID)).Build())
+	}
+	for _, resp := range r.client.DoMulti(ctx, cmds...) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Chat messages pushed to a user's WebSocket connections: pending:<user_id>
+// maps the ID of each message not yet acknowledged to its payload, and
+// acked:<user_id> is the set of acknowledged message IDs
+func (r *Redis) AddPendingMessages(ctx context.Context, userID string, messages map[string]string, ttl time.Duration) error {
+	key := fmt.Sprintf("pending:%s", userID)
+	fields := r.client.B().Hset().Key(key).FieldValue()
+	for messageID, payload := range messages {
+		fields = fields.FieldValue(messageID, payload)
+	}
+	cmds := rueidis.Commands{
+		fields.Build(),
+		r.client.B().Expire().Key(key).Seconds(int64(ttl.Seconds())).Build(),
+	}
+	for _, resp := range r.client.DoMulti(ctx, cmds...) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AckMessage records that the user acknowledged a message, which is then no
+// longer pending
+func (r *Redis) AckMessage(ctx context.Context, userID, messageID string, ttl time.Duration) error {
+	ackedKey := fmt.Sprintf("acked:%s", userID)
+	cmds := rueidis.Commands{
+		r.client.B().Sadd().Key(ackedKey).Member(messageID).Build(),
+		r.client.B().Expire().Key(ackedKey).Seconds(int64(ttl.Seconds())).Build(),
+		r.client.B().Hdel().Key(fmt.Sprintf("pending:%s", userID)).Field(messageID).Build(),
+	}
+	for _, resp := range r.client.DoMulti(ctx, cmds...) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPendingMessages returns the payloads of the messages the user hasn't
+// acknowledged, by message ID. Messages acknowledged before they were
+// recorded as pending are dropped.
+func (r *Redis) GetPendingMessages(ctx context.Context, userID string) (map[string]string, error) {
+	pendingKey := fmt.Sprintf("pending:%s", userID)
+	pending, err := r.client.Do(ctx, r.client.B().Hgetall().Key(pendingKey).Build()).AsStrMap()
+	if err != nil || len(pending) == 0 {
+		return nil, err
+	}
+
+	acked, err := r.client.Do(ctx, r.client.B().Smembers().Key(fmt.Sprintf("acked:%s", userID)).Build()).AsStrSlice()
+	if err != nil {
+		return nil, err
+	}
+	var stale []string
+	for _, messageID := range acked {
+		if _, ok := pending[messageID]; ok {
+			delete(pending, messageID)
+			stale = append(stale, messageID)
+		}
+	}
+	if len(stale) > 0 {
+		if err := r.client.Do(ctx, r.client.B().Hdel().Key(pendingKey).Field(stale...).Build()).Error(); err != nil {
+			return nil, err
+		}
+	}
+	return pending, nil
+}
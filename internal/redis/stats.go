@@ -0,0 +1,114 @@
+package redis
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// PoolStats describes the use of the Redis connections. rueidis doesn't
+// report pool statistics, so they are counted by the client wrapper.
+type PoolStats struct {
+	// Nodes is the number of Redis nodes connected to
+	Nodes int `json:"nodes"`
+	// InFlight is the number of commands waiting for their reply
+	InFlight int64 `json:"in_flight"`
+	// Dedicated is the number of connections reserved for one caller, such
+	// as subscriptions and transactions
+	Dedicated int64 `json:"dedicated"`
+	Commands  int64 `json:"commands"`
+	Errors    int64 `json:"errors"`
+}
+
+// statsClient is a rueidis.Client counting the commands it sends
+type statsClient struct {
+	rueidis.Client
+	inFlight  atomic.Int64
+	dedicated atomic.Int64
+	commands  atomic.Int64
+	errors    atomic.Int64
+}
+
+func newStatsClient(client rueidis.Client) *statsClient {
+	return &statsClient{Client: client}
+}
+
+func (c *statsClient) start(commands int) {
+	c.commands.Add(int64(commands))
+	c.inFlight.Add(int64(commands))
+}
+
+// done counts the replies to commands, a missing key isn't an error
+func (c *statsClient) done(results ...rueidis.RedisResult) {
+	c.inFlight.Add(-int64(len(results)))
+	for _, result := range results {
+		if err := result.Error(); err != nil && !rueidis.IsRedisNil(err) {
+			c.errors.Add(1)
+		}
+	}
+}
+
+func (c *statsClient) Do(ctx context.Context, cmd rueidis.Completed) rueidis.RedisResult {
+	c.start(1)
+	result := c.Client.Do(ctx, cmd)
+	c.done(result)
+	return result
+}
+
+func (c *statsClient) DoMulti(ctx context.Context, multi ...rueidis.Completed) []rueidis.RedisResult {
+	c.start(len(multi))
+	results := c.Client.DoMulti(ctx, multi...)
+	c.done(results...)
+	return results
+}
+
+func (c *statsClient) DoCache(ctx context.Context, cmd rueidis.Cacheable, ttl time.Duration) rueidis.RedisResult {
+	c.start(1)
+	result := c.Client.DoCache(ctx, cmd, ttl)
+	c.done(result)
+	return result
+}
+
+func (c *statsClient) DoMultiCache(ctx context.Context, multi ...rueidis.CacheableTTL) []rueidis.RedisResult {
+	c.start(len(multi))
+	results := c.Client.DoMultiCache(ctx, multi...)
+	c.done(results...)
+	return results
+}
+
+func (c *statsClient) Receive(ctx context.Context, subscribe rueidis.Completed, fn func(msg rueidis.PubSubMessage)) error {
+	c.dedicated.Add(1)
+	defer c.dedicated.Add(-1)
+	return c.Client.Receive(ctx, subscribe, fn)
+}
+
+func (c *statsClient) Dedicated(fn func(rueidis.DedicatedClient) error) error {
+	c.dedicated.Add(1)
+	defer c.dedicated.Add(-1)
+	return c.Client.Dedicated(fn)
+}
+
+func (c *statsClient) Dedicate() (rueidis.DedicatedClient, func()) {
+	client, cancel := c.Client.Dedicate()
+	c.dedicated.Add(1)
+	var released atomic.Bool
+	return client, func() {
+		if released.CompareAndSwap(false, true) {
+			c.dedicated.Add(-1)
+		}
+		cancel()
+	}
+}
+
+// PoolStats returns the current use of the Redis connections
+func (r *Redis) PoolStats() PoolStats {
+	return PoolStats{
+		Nodes:     len(r.stats.Nodes()),
+		InFlight:  r.stats.inFlight.Load(),
+		Dedicated: r.stats.dedicated.Load(),
+		Commands:  r.stats.commands.Load(),
+		Errors:    r.stats.errors.Load(),
+	}
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"realtime-api/internal/database"
+	"realtime-api/internal/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ActivityLogRepository interface {
+	Create(ctx context.Context, log *model.ActivityLog) error
+	GetByUserID(ctx context.Context, userID uuid.UUID, activityType string, offset, limit int) ([]model.ActivityLog, int64, error)
+}
+
+type activityLogRepository struct {
+	db *gorm.DB
+}
+
+func NewActivityLogRepository() ActivityLogRepository {
+	return &activityLogRepository{
+		db: database.GetDB(),
+	}
+}
+
+func (r *activityLogRepository) Create(ctx context.Context, log *model.ActivityLog) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Create(log).Error; err != nil {
+		return fmt.Errorf("failed to create activity log: %w", err)
+	}
+	return nil
+}
+
+// GetByUserID returns the activity of a user, newest first. An empty
+// activityType returns every type.
+func (r *activityLogRepository) GetByUserID(ctx context.Context, userID uuid.UUID, activityType string, offset, limit int) ([]model.ActivityLog, int64, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var logs []model.ActivityLog
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&model.ActivityLog{}).Where("user_id = ?", userID)
+	if activityType != "" {
+		query = query.Where("activity_type = ?", activityType)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count activity logs: %w", err)
+	}
+
+	if err := query.
+		Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&logs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get activity logs: %w", err)
+	}
+
+	return logs, total, nil
+}
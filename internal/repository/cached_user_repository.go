@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+	"realtime-api/internal/redis"
+
+	"github.com/google/uuid"
+)
+
+// userCacheTTL is how long a looked up user stays cached after its last read
+const userCacheTTL = 5 * time.Minute
+
+// cachedUserRepository is a read-through Redis cache in front of a
+// UserRepository. Users are cached by ID; lookups by email and username
+// cache the ID they resolve to. Every write to a user drops its entry.
+// Only the user's JSON is cached, so cached users have no password hash or
+// two-factor secret; reads needing them go through Uncached.
+type cachedUserRepository struct {
+	UserRepository
+	redis *redis.Redis
+}
+
+// NewCachedUserRepository wraps users so single user lookups are served
+// from Redis
+func NewCachedUserRepository(users UserRepository, redis *redis.Redis) UserRepository {
+	return &cachedUserRepository{
+		UserRepository: users,
+		redis:          redis,
+	}
+}
+
+// Uncached returns the repository behind a cache, for the reads that need a
+// user's password hash or two-factor secret
+func Uncached(users UserRepository) UserRepository {
+	if cached, ok := users.(*cachedUserRepository); ok {
+		return cached.UserRepository
+	}
+	return users
+}
+
+func userCacheKey(id uuid.UUID) string {
+	return fmt.Sprintf("user:%s", id)
+}
+
+func userEmailCacheKey(email string) string {
+	return fmt.Sprintf("user:email:%s", email)
+}
+
+func userUsernameCacheKey(username string) string {
+	return fmt.Sprintf("user:username:%s", username)
+}
+
+func (r *cachedUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	value, ok, err := r.redis.GetEx(ctx, userCacheKey(id), userCacheTTL)
+	if err != nil {
+		logger.Warn("Failed to read cached user", logger.WithFields(map[string]interface{}{
+			"user_id": id,
+			"error":   err.Error(),
+		}))
+	}
+	if ok {
+		var user model.User
+		if err := json.Unmarshal([]byte(value), &user); err == nil {
+			return &user, nil
+		}
+	}
+
+	user, err := r.UserRepository.GetByID(ctx, id)
+	if err != nil || user == nil {
+		return user, err
+	}
+	r.store(ctx, user)
+	return user, nil
+}
+
+func (r *cachedUserRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	return r.getByAlias(ctx, userEmailCacheKey(email), func(user *model.User) bool {
+		return user.Email == email
+	}, func() (*model.User, error) {
+		return r.UserRepository.GetByEmail(ctx, email)
+	})
+}
+
+func (r *cachedUserRepository) GetByUsername(ctx context.Context, username string) (*model.User, error) {
+	return r.getByAlias(ctx, userUsernameCacheKey(username), func(user *model.User) bool {
+		return user.Username == username
+	}, func() (*model.User, error) {
+		return r.UserRepository.GetByUsername(ctx, username)
+	})
+}
+
+// getByAlias looks a user up by the ID cached under key. The alias may be
+// stale after the user changed their email or username, so the cached user
+// must still match; otherwise the lookup goes to the database.
+func (r *cachedUserRepository) getByAlias(ctx context.Context, key string, matches func(*model.User) bool, lookup func() (*model.User, error)) (*model.User, error) {
+	value, ok, err := r.redis.GetEx(ctx, key, userCacheTTL)
+	if err != nil {
+		logger.Warn("Failed to read cached user", logger.WithFields(map[string]interface{}{
+			"key":   key,
+			"error": err.Error(),
+		}))
+	}
+	if ok {
+		if id, err := uuid.Parse(value); err == nil {
+			user, err := r.GetByID(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if user != nil && matches(user) {
+				return user, nil
+			}
+		}
+	}
+
+	user, err := lookup()
+	if err != nil || user == nil {
+		return user, err
+	}
+	if err := r.redis.Set(ctx, key, user.ID.String(), userCacheTTL); err != nil {
+		logger.Warn("Failed to cache user", logger.WithFields(map[string]interface{}{
+			"key":   key,
+			"error": err.Error(),
+		}))
+	}
+	r.store(ctx, user)
+	return user, nil
+}
+
+// store caches user by ID, logging failures as the database stays the source
+// of truth. The password hash and two-factor secret are left out of the
+// user's JSON, so they never reach Redis.
+func (r *cachedUserRepository) store(ctx context.Context, user *model.User) {
+	value, err := json.Marshal(user)
+	if err == nil {
+		err = r.redis.Set(ctx, userCacheKey(user.ID), string(value), userCacheTTL)
+	}
+	if err != nil {
+		logger.Warn("Failed to cache user", logger.WithFields(map[string]interface{}{
+			"user_id": user.ID,
+			"error":   err.Error(),
+		}))
+	}
+}
+
+// invalidate drops the cached user after a write. The email and username
+// aliases are checked against the user on read, so they can stay.
+func (r *cachedUserRepository) invalidate(ctx context.Context, id uuid.UUID, err error) error {
+	if _, delErr := r.redis.Del(ctx, userCacheKey(id)); delErr != nil {
+		logger.Warn("Failed to drop cached user", logger.WithFields(map[string]interface{}{
+			"user_id": id,
+			"error":   delErr.Error(),
+		}))
+	}
+	return err
+}
+
+func (r *cachedUserRepository) Update(ctx context.Context, user *model.User) error {
+	return r.invalidate(ctx, user.ID, r.UserRepository.Update(ctx, user))
+}
+
+func (r *cachedUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return r.invalidate(ctx, id, r.UserRepository.Delete(ctx, id))
+}
+
+func (r *cachedUserRepository) UpdateLastSeen(ctx context.Context, userID uuid.UUID) error {
+	return r.invalidate(ctx, userID, r.UserRepository.UpdateLastSeen(ctx, userID))
+}
+
+func (r *cachedUserRepository) UpdateStatus(ctx context.Context, userID uuid.UUID, status model.UserStatus) error {
+	return r.invalidate(ctx, userID, r.UserRepository.UpdateStatus(ctx, userID, status))
+}
+
+func (r *cachedUserRepository) UpdatePassword(ctx context.Context, userID uuid.UUID, hashedPassword string) error {
+	return r.invalidate(ctx, userID, r.UserRepository.UpdatePassword(ctx, userID, hashedPassword))
+}
+
+func (r *cachedUserRepository) UpdateActive(ctx context.Context, userID uuid.UUID, active bool) error {
+	return r.invalidate(ctx, userID, r.UserRepository.UpdateActive(ctx, userID, active))
+}
+
+func (r *cachedUserRepository) UpdateSettings(ctx context.Context, userID uuid.UUID, settings *model.UserSettings) error {
+	return r.invalidate(ctx, userID, r.UserRepository.UpdateSettings(ctx, userID, settings))
+}
+
+func (r *cachedUserRepository) UpdateTOTP(ctx context.Context, userID uuid.UUID, secret string, enabled bool) error {
+	return r.invalidate(ctx, userID, r.UserRepository.UpdateTOTP(ctx, userID, secret, enabled))
+}
+
+func (r *cachedUserRepository) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	used, err := r.UserRepository.UseTOTPStep(ctx, userID, step)
+	return used, r.invalidate(ctx, userID, err)
+}
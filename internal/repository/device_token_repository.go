@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"realtime-api/internal/database"
+	"realtime-api/internal/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DeviceTokenRepository interface {
+	Save(ctx context.Context, device *model.DeviceToken) error
+	GetByUserID(ctx context.Context, userID uuid.UUID) ([]model.DeviceToken, error)
+	Delete(ctx context.Context, userID uuid.UUID, token string) (bool, error)
+	DeleteByToken(ctx context.Context, token string) error
+}
+
+type deviceTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewDeviceTokenRepository() DeviceTokenRepository {
+	return &deviceTokenRepository{
+		db: database.GetDB(),
+	}
+}
+
+// Save registers a device token. A token registered before, possibly by
+// another user who signed in on the same device, moves to the user of device,
+// which is then reloaded with the ID of the existing row.
+func (r *deviceTokenRepository) Save(ctx context.Context, device *model.DeviceToken) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	db := r.db.WithContext(ctx)
+	if err := db.
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "token"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"user_id":    device.UserID,
+				"platform":   device.Platform,
+				"last_seen":  device.LastSeen,
+				"updated_at": device.LastSeen,
+			}),
+		}).
+		Create(device).Error; err != nil {
+		return fmt.Errorf("failed to save device token: %w", err)
+	}
+	var saved model.DeviceToken
+	if err := db.First(&saved, "token = ?", device.Token).Error; err != nil {
+		return fmt.Errorf("failed to get device token: %w", err)
+	}
+	*device = saved
+	return nil
+}
+
+func (r *deviceTokenRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]model.DeviceToken, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var devices []model.DeviceToken
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to get device tokens: %w", err)
+	}
+	return devices, nil
+}
+
+// Delete removes a token of a user and reports whether the user had it
+func (r *deviceTokenRepository) Delete(ctx context.Context, userID uuid.UUID, token string) (bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	result := r.db.WithContext(ctx).Unscoped().
+		Where("user_id = ? AND token = ?", userID, token).
+		Delete(&model.DeviceToken{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to delete device token: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DeleteByToken removes a token the push service no longer accepts
+func (r *deviceTokenRepository) DeleteByToken(ctx context.Context, token string) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Unscoped().
+		Where("token = ?", token).
+		Delete(&model.DeviceToken{}).Error; err != nil {
+		return fmt.Errorf("failed to delete device token: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"realtime-api/internal/database"
+	"realtime-api/internal/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type FileRepository interface {
+	Create(ctx context.Context, file *model.FileUpload) error
+	GetByID(ctx context.Context, id uuid.UUID) (*model.FileUpload, error)
+	GetExpired(ctx context.Context, now, staleBefore time.Time, limit int) ([]model.FileUpload, error)
+	GetByIDs(ctx context.Context, ids []uuid.UUID) ([]model.FileUpload, error)
+	MarkPermanent(ctx context.Context, ids []uuid.UUID) error
+	SetThumbnail(ctx context.Context, id uuid.UUID, thumbnailPath, fileURL, thumbnailURL string) error
+	MarkDeleted(ctx context.Context, id uuid.UUID) error
+	MarkDeletedByFileNames(ctx context.Context, fileNames []string) error
+}
+
+type fileRepository struct {
+	db *gorm.DB
+}
+
+func NewFileRepository() FileRepository {
+	return &fileRepository{
+		db: database.GetDB(),
+	}
+}
+
+func (r *fileRepository) Create(ctx context.Context, file *model.FileUpload) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Create(file).Error; err != nil {
+		return fmt.Errorf("failed to create file upload: %w", err)
+	}
+	return nil
+}
+
+func (r *fileRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.FileUpload, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var file model.FileUpload
+	if err := r.db.WithContext(ctx).First(&file, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get file upload by ID: %w", err)
+	}
+	return &file, nil
+}
+
+func (r *fileRepository) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]model.FileUpload, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var files []model.FileUpload
+	if err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&files).Error; err != nil {
+		return nil, fmt.Errorf("failed to get file uploads: %w", err)
+	}
+	return files, nil
+}
+
+// MarkPermanent keeps the uploads from being removed by the expiry cleanup
+func (r *fileRepository) MarkPermanent(ctx context.Context, ids []uuid.UUID) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Model(&model.FileUpload{}).
+		Where("id IN ?", ids).
+		Updates(map[string]interface{}{
+			"is_temporary": false,
+			"expires_at":   nil,
+		}).Error; err != nil {
+		return fmt.Errorf("failed to mark file uploads as permanent: %w", err)
+	}
+	return nil
+}
+
+// SetThumbnail records the thumbnail of an upload and fills it in on the
+// attachments already pointing at the file
+func (r *fileRepository) SetThumbnail(ctx context.Context, id uuid.UUID, thumbnailPath, fileURL, thumbnailURL string) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.FileUpload{}).Where("id = ?", id).Update("thumbnail_path", thumbnailPath).Error; err != nil {
+			return fmt.Errorf("failed to set file thumbnail: %w", err)
+		}
+		if err := tx.Model(&model.MessageAttachment{}).
+			Where("url = ? AND (thumbnail_url IS NULL OR thumbnail_url = '')", fileURL).
+			Update("thumbnail_url", thumbnailURL).Error; err != nil {
+			return fmt.Errorf("failed to set attachment thumbnails: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetExpired returns temporary uploads whose expiry has passed and uploads
+// still uploading since before staleBefore, oldest first
+func (r *fileRepository) GetExpired(ctx context.Context, now, staleBefore time.Time, limit int) ([]model.FileUpload, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var files []model.FileUpload
+	if err := r.db.WithContext(ctx).
+		Where("(is_temporary = ? AND expires_at <= ? AND upload_status <> ?) OR (upload_status = ? AND created_at <= ?)",
+			true, now, "deleted", "uploading", staleBefore).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&files).Error; err != nil {
+		return nil, fmt.Errorf("failed to get expired file uploads: %w", err)
+	}
+	return files, nil
+}
+
+// MarkDeleted flags the upload as deleted and soft deletes the record
+func (r *fileRepository) MarkDeleted(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.FileUpload{}).Where("id = ?", id).Update("upload_status", "deleted").Error; err != nil {
+			return fmt.Errorf("failed to mark file upload as deleted: %w", err)
+		}
+		if err := tx.Delete(&model.FileUpload{}, "id = ?", id).Error; err != nil {
+			return fmt.Errorf("failed to delete file upload: %w", err)
+		}
+		return nil
+	})
+}
+
+// MarkDeletedByFileNames deletes the upload records of stored files
+func (r *fileRepository) MarkDeletedByFileNames(ctx context.Context, fileNames []string) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if len(fileNames) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.FileUpload{}).Where("file_name IN ?", fileNames).Update("upload_status", "deleted").Error; err != nil {
+			return fmt.Errorf("failed to mark file uploads as deleted: %w", err)
+		}
+		if err := tx.Delete(&model.FileUpload{}, "file_name IN ?", fileNames).Error; err != nil {
+			return fmt.Errorf("failed to delete file uploads: %w", err)
+		}
+		return nil
+	})
+}
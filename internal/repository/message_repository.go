@@ -10,18 +10,33 @@ import (
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type MessageRepository interface {
 	Create(ctx context.Context, message *model.Message) error
 	GetByID(ctx context.Context, id uuid.UUID) (*model.Message, error)
+	GetByIDs(ctx context.Context, ids []uuid.UUID) ([]model.Message, error)
 	Update(ctx context.Context, message *model.Message) error
+	UpdateWithEdit(ctx context.Context, message *model.Message, edit *model.MessageEdit) error
+	GetMessageEdits(ctx context.Context, messageID uuid.UUID) ([]model.MessageEdit, error)
 	Delete(ctx context.Context, id uuid.UUID) error
-	GetRoomMessages(ctx context.Context, roomID uuid.UUID, offset, limit int) ([]model.Message, int64, error)
+	ExpireMessages(ctx context.Context, roomID uuid.UUID, cutoff time.Time, limit int, hard bool) (int64, []model.MessageAttachment, error)
+	GetRoomMessages(ctx context.Context, roomID, viewerID uuid.UUID, offset, limit int, deleted model.DeletedMessageMode) ([]model.Message, error)
+	CountRoomMessages(ctx context.Context, roomID, viewerID uuid.UUID, deleted model.DeletedMessageMode) (int64, error)
+	GetRoomMessagesBefore(ctx context.Context, roomID, viewerID uuid.UUID, cursor *MessageCursor, limit int, deleted model.DeletedMessageMode) ([]model.Message, error)
+	GetRoomMessagesAfter(ctx context.Context, roomID, viewerID uuid.UUID, cursor *MessageCursor, limit int) ([]model.Message, error)
 	GetMessagesSince(ctx context.Context, roomID uuid.UUID, since time.Time) ([]model.Message, error)
 	SearchMessages(ctx context.Context, roomID uuid.UUID, query string, offset, limit int) ([]model.Message, int64, error)
+	SearchUserMessages(ctx context.Context, userID uuid.UUID, query string, offset, limit int) ([]model.Message, int64, error)
+	GetMentions(ctx context.Context, userID uuid.UUID, offset, limit int) ([]model.Message, int64, error)
+	GetReadMessageIDs(ctx context.Context, userID uuid.UUID, messageIDs []uuid.UUID) (map[uuid.UUID]bool, error)
 	MarkAsRead(ctx context.Context, messageID, userID uuid.UUID) error
 	GetUnreadCount(ctx context.Context, roomID, userID uuid.UUID) (int64, error)
+	GetUnreadCounts(ctx context.Context, userID uuid.UUID) (map[uuid.UUID]int64, error)
+	RecordDeliveries(ctx context.Context, deliveries []model.MessageDelivery) error
+	GetReceiptCounts(ctx context.Context, messageIDs []uuid.UUID) (delivered, read map[uuid.UUID]int, err error)
+	HideMessage(ctx context.Context, messageID, userID uuid.UUID) error
 
 	// Message Attachments
 	AddAttachment(ctx context.Context, attachment *model.MessageAttachment) error
@@ -29,12 +44,43 @@ type MessageRepository interface {
 	DeleteAttachment(ctx context.Context, attachmentID uuid.UUID) error
 
 	// Message Reactions
-	AddReaction(ctx context.Context, reaction *model.MessageReaction) error
-	RemoveReaction(ctx context.Context, messageID, userID uuid.UUID, emoji string) error
-	GetMessageReactions(ctx context.Context, messageID uuid.UUID) ([]model.MessageReaction, error)
+	AddReaction(ctx context.Context, reaction *model.MessageReaction) (bool, error)
+	RemoveReaction(ctx context.Context, messageID, userID uuid.UUID, emoji string) (bool, error)
+	GetUserReactionEmojis(ctx context.Context, messageID, userID uuid.UUID) ([]string, error)
+	GetMessageReactions(ctx context.Context, messageID uuid.UUID, emoji string, offset, limit int) ([]model.MessageReaction, int64, error)
+	GetReactionsWithUsers(ctx context.Context, messageIDs []uuid.UUID) ([]model.MessageReaction, error)
+	GetReactionSummaries(ctx context.Context, messageIDs []uuid.UUID, userID uuid.UUID) (map[uuid.UUID]map[string]int, map[uuid.UUID][]string, error)
 
 	// Message Threading
 	GetThreadMessages(ctx context.Context, parentMessageID uuid.UUID, offset, limit int) ([]model.Message, int64, error)
+	GetReplyCounts(ctx context.Context, messageIDs []uuid.UUID) (map[uuid.UUID]int, error)
+
+	// Drafts
+	GetDraft(ctx context.Context, userID, roomID uuid.UUID) (*model.MessageDraft, error)
+	SaveDraft(ctx context.Context, draft *model.MessageDraft) error
+	DeleteDraft(ctx context.Context, userID, roomID uuid.UUID) (bool, error)
+
+	// Scheduled Messages
+	CreateScheduled(ctx context.Context, scheduled *model.ScheduledMessage) error
+	GetScheduledByID(ctx context.Context, id uuid.UUID) (*model.ScheduledMessage, error)
+	GetPendingScheduled(ctx context.Context, roomID, senderID uuid.UUID) ([]model.ScheduledMessage, error)
+	GetDueScheduled(ctx context.Context, now time.Time, limit int) ([]model.ScheduledMessage, error)
+	UpdateScheduledStatus(ctx context.Context, id uuid.UUID, from, to string, fields map[string]interface{}) (bool, error)
+
+	// Pinned Messages
+	PinMessage(ctx context.Context, pin *model.RoomPinnedMessage) error
+	UnpinMessage(ctx context.Context, roomID, messageID uuid.UUID) (bool, error)
+	IsMessagePinned(ctx context.Context, roomID, messageID uuid.UUID) (bool, error)
+	CountPinnedMessages(ctx context.Context, roomID uuid.UUID) (int64, error)
+	GetPinnedMessages(ctx context.Context, roomID uuid.UUID) ([]model.RoomPinnedMessage, error)
+}
+
+// MessageCursor marks the position to page backwards from. MessageID breaks
+// ties between messages created at the same instant; it is nil when paging
+// from a bare timestamp.
+type MessageCursor struct {
+	CreatedAt time.Time
+	MessageID *uuid.UUID
 }
 
 type messageRepository struct {
@@ -48,6 +94,9 @@ func NewMessageRepository() MessageRepository {
 }
 
 func (r *messageRepository) Create(ctx context.Context, message *model.Message) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
 	if err := r.db.WithContext(ctx).Create(message).Error; err != nil {
 		return fmt.Errorf("failed to create message: %w", err)
 	}
@@ -55,6 +104,9 @@ func (r *messageRepository) Create(ctx context.Context, message *model.Message)
 }
 
 func (r *messageRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Message, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var message model.Message
 	if err := r.db.WithContext(ctx).
 		Preload("Sender").
@@ -70,48 +122,263 @@ func (r *messageRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.M
 	return &message, nil
 }
 
+func (r *messageRepository) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]model.Message, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var messages []model.Message
+	if err := r.db.WithContext(ctx).Preload("Sender").Where("id IN ?", ids).Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+	return messages, nil
+}
+
 func (r *messageRepository) Update(ctx context.Context, message *model.Message) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
 	if err := r.db.WithContext(ctx).Save(message).Error; err != nil {
 		return fmt.Errorf("failed to update message: %w", err)
 	}
 	return nil
 }
 
+// UpdateWithEdit saves an edited message together with the record of its
+// previous content. The edit gets the next revision number of the message.
+func (r *messageRepository) UpdateWithEdit(ctx context.Context, message *model.Message, edit *model.MessageEdit) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var revisions int64
+		if err := tx.Model(&model.MessageEdit{}).Where("message_id = ?", message.ID).Count(&revisions).Error; err != nil {
+			return err
+		}
+
+		edit.MessageID = message.ID
+		edit.Revision = int(revisions) + 1
+		if err := tx.Create(edit).Error; err != nil {
+			return err
+		}
+
+		return tx.Save(message).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update message: %w", err)
+	}
+	return nil
+}
+
+func (r *messageRepository) GetMessageEdits(ctx context.Context, messageID uuid.UUID) ([]model.MessageEdit, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var edits []model.MessageEdit
+	if err := r.db.WithContext(ctx).
+		Where("message_id = ?", messageID).
+		Order("revision ASC").
+		Find(&edits).Error; err != nil {
+		return nil, fmt.Errorf("failed to get message edits: %w", err)
+	}
+	return edits, nil
+}
+
 func (r *messageRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
 	if err := r.db.WithContext(ctx).Delete(&model.Message{}, "id = ?", id).Error; err != nil {
 		return fmt.Errorf("failed to delete message: %w", err)
 	}
 	return nil
 }
 
-func (r *messageRepository) GetRoomMessages(ctx context.Context, roomID uuid.UUID, offset, limit int) ([]model.Message, int64, error) {
+// ExpireMessages removes up to limit messages of a room sent before cutoff,
+// along with their reads, reactions and attachments, in one transaction. Hard
+// deletes remove the messages and everything referring to them; otherwise
+// they are marked deleted and their content cleared. It returns how many
+// messages were removed and their attachments, whose files are left to the
+// caller.
+func (r *messageRepository) ExpireMessages(ctx context.Context, roomID uuid.UUID, cutoff time.Time, limit int, hard bool) (int64, []model.MessageAttachment, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	var ids []uuid.UUID
+	query := r.db.WithContext(ctx).Model(&model.Message{}).
+		Where("room_id = ? AND created_at < ?", roomID, cutoff)
+	if hard {
+		query = query.Unscoped()
+	} else {
+		query = query.Where("is_deleted = ?", false)
+	}
+	if err := query.Order("created_at").Limit(limit).Pluck("id", &ids).Error; err != nil {
+		return 0, nil, fmt.Errorf("failed to get expired messages: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil, nil
+	}
+
+	var attachments []model.MessageAttachment
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("message_id IN ?", ids).Find(&attachments).Error; err != nil {
+			return fmt.Errorf("failed to get expired attachments: %w", err)
+		}
+
+		related := []interface{}{&model.MessageRead{}, &model.MessageReaction{}, &model.MessageAttachment{}}
+		if hard {
+			related = append(related, &model.MessageDelivery{}, &model.MessageEdit{}, &model.MessageHidden{}, &model.RoomPinnedMessage{})
+		}
+		for _, value := range related {
+			if err := tx.Unscoped().Where("message_id IN ?", ids).Delete(value).Error; err != nil {
+				return fmt.Errorf("failed to delete expired message data: %w", err)
+			}
+		}
+
+		if !hard {
+			if err := tx.Model(&model.Message{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+				"is_deleted": true,
+				"content":    model.RetentionDeletedContent,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to delete old messages: %w", err)
+			}
+			return nil
+		}
+
+		// Replies outlive the messages they answered
+		if err := tx.Unscoped().Model(&model.Message{}).Where("reply_to_id IN ?", ids).Update("reply_to_id", nil).Error; err != nil {
+			return fmt.Errorf("failed to detach replies: %w", err)
+		}
+		if err := tx.Unscoped().Where("id IN ?", ids).Delete(&model.Message{}).Error; err != nil {
+			return fmt.Errorf("failed to delete old messages: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return int64(len(ids)), attachments, nil
+}
+
+func (r *messageRepository) GetRoomMessages(ctx context.Context, roomID, viewerID uuid.UUID, offset, limit int, deleted model.DeletedMessageMode) ([]model.Message, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var messages []model.Message
+
+	if err := r.roomHistoryQuery(ctx, roomID, viewerID, deleted).
+		Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to get room messages: %w", err)
+	}
+
+	return stripDeletedMessages(messages), nil
+}
+
+func (r *messageRepository) CountRoomMessages(ctx context.Context, roomID, viewerID uuid.UUID, deleted model.DeletedMessageMode) (int64, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var total int64
+	if err := r.visibleRoomMessages(ctx, roomID, viewerID, deleted).Model(&model.Message{}).Count(&total).Error; err != nil {
+		return 0, fmt.Errorf("failed to count room messages: %w", err)
+	}
+	return total, nil
+}
 
-	query := r.db.WithContext(ctx).Where("room_id = ?", roomID)
+func (r *messageRepository) GetRoomMessagesBefore(ctx context.Context, roomID, viewerID uuid.UUID, cursor *MessageCursor, limit int, deleted model.DeletedMessageMode) ([]model.Message, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
 
-	// Count total records
-	if err := query.Model(&model.Message{}).Count(&total).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to count room messages: %w", err)
+	var messages []model.Message
+
+	query := r.roomHistoryQuery(ctx, roomID, viewerID, deleted)
+
+	// A nil cursor starts from the most recent message
+	if cursor != nil && cursor.MessageID != nil {
+		query = query.Where("(created_at < ? OR (created_at = ? AND id < ?))",
+			cursor.CreatedAt, cursor.CreatedAt, *cursor.MessageID)
+	} else if cursor != nil {
+		query = query.Where("created_at < ?", cursor.CreatedAt)
 	}
 
-	// Get paginated results
 	if err := query.
-		Preload("Sender").
-		Preload("Attachments").
-		Preload("Reactions").
-		Preload("Reactions.User").
 		Order("created_at DESC").
-		Offset(offset).
+		Order("id DESC").
 		Limit(limit).
 		Find(&messages).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to get room messages: %w", err)
+		return nil, fmt.Errorf("failed to get room messages before cursor: %w", err)
 	}
 
-	return messages, total, nil
+	return stripDeletedMessages(messages), nil
+}
+
+// GetRoomMessagesAfter returns the messages following cursor, oldest first.
+// A nil cursor starts from the first message; deleted messages are left out.
+func (r *messageRepository) GetRoomMessagesAfter(ctx context.Context, roomID, viewerID uuid.UUID, cursor *MessageCursor, limit int) ([]model.Message, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var messages []model.Message
+
+	query := r.roomHistoryQuery(ctx, roomID, viewerID, model.DeletedMessagesExclude)
+	if cursor != nil && cursor.MessageID != nil {
+		query = query.Where("(created_at > ? OR (created_at = ? AND id > ?))",
+			cursor.CreatedAt, cursor.CreatedAt, *cursor.MessageID)
+	} else if cursor != nil {
+		query = query.Where("created_at > ?", cursor.CreatedAt)
+	}
+
+	if err := query.
+		Order("created_at ASC").
+		Order("id ASC").
+		Limit(limit).
+		Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to get room messages after cursor: %w", err)
+	}
+
+	return messages, nil
+}
+
+// visibleRoomMessages selects the messages of a room the viewer can see:
+// messages they hid for themselves are always left out, deleted messages
+// unless they are requested as tombstones
+func (r *messageRepository) visibleRoomMessages(ctx context.Context, roomID, viewerID uuid.UUID, deleted model.DeletedMessageMode) *gorm.DB {
+	query := r.db.WithContext(ctx).
+		Where("room_id = ?", roomID).
+		Where("id NOT IN (?)", r.db.Model(&model.MessageHidden{}).Select("message_id").Where("user_id = ?", viewerID))
+	if deleted != model.DeletedMessagesTombstone {
+		query = query.Where("is_deleted = ?", false)
+	}
+	return query
+}
+
+// roomHistoryQuery is visibleRoomMessages with the relationships preloaded
+func (r *messageRepository) roomHistoryQuery(ctx context.Context, roomID, viewerID uuid.UUID, deleted model.DeletedMessageMode) *gorm.DB {
+	return r.visibleRoomMessages(ctx, roomID, viewerID, deleted).
+		Preload("Sender").
+		Preload("Attachments")
+}
+
+// stripDeletedMessages reduces deleted messages to tombstones, dropping their
+// content, attachments and reactions
+func stripDeletedMessages(messages []model.Message) []model.Message {
+	for i := range messages {
+		if messages[i].IsDeleted {
+			messages[i].Content = ""
+			messages[i].Metadata = ""
+			messages[i].Attachments = nil
+			messages[i].Reactions = nil
+		}
+	}
+	return messages
 }
 
 func (r *messageRepository) GetMessagesSince(ctx context.Context, roomID uuid.UUID, since time.Time) ([]model.Message, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var messages []model.Message
 	if err := r.db.WithContext(ctx).
 		Where("room_id = ? AND created_at > ?", roomID, since).
@@ -127,11 +394,14 @@ func (r *messageRepository) GetMessagesSince(ctx context.Context, roomID uuid.UU
 }
 
 func (r *messageRepository) SearchMessages(ctx context.Context, roomID uuid.UUID, query string, offset, limit int) ([]model.Message, int64, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var messages []model.Message
 	var total int64
 
 	searchQuery := r.db.WithContext(ctx).
-		Where("room_id = ? AND content ILIKE ?", roomID, "%"+query+"%")
+		Where("room_id = ? AND content ILIKE ? AND is_deleted = ?", roomID, "%"+query+"%", false)
 
 	// Count total records
 	if err := searchQuery.Model(&model.Message{}).Count(&total).Error; err != nil {
@@ -152,7 +422,96 @@ func (r *messageRepository) SearchMessages(ctx context.Context, roomID uuid.UUID
 	return messages, total, nil
 }
 
+func (r *messageRepository) SearchUserMessages(ctx context.Context, userID uuid.UUID, query string, offset, limit int) ([]model.Message, int64, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var messages []model.Message
+	var total int64
+
+	searchQuery := r.db.WithContext(ctx).
+		Model(&model.Message{}).
+		Joins("JOIN room_members ON room_members.room_id = messages.room_id AND room_members.user_id = ? AND room_members.deleted_at IS NULL", userID).
+		Where("messages.content ILIKE ? AND messages.is_deleted = ?", "%"+query+"%", false)
+
+	// Count total records
+	if err := searchQuery.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count search messages: %w", err)
+	}
+
+	// Get paginated results
+	if err := searchQuery.
+		Preload("Sender").
+		Preload("Attachments").
+		Order("messages.created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&messages).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to search user messages: %w", err)
+	}
+
+	return messages, total, nil
+}
+
+// GetMentions returns messages mentioning the user in rooms they belong to,
+// newest first. Mentions are looked up in the mentioned_users entry of the
+// message metadata.
+func (r *messageRepository) GetMentions(ctx context.Context, userID uuid.UUID, offset, limit int) ([]model.Message, int64, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var messages []model.Message
+	var total int64
+
+	mentionQuery := r.db.WithContext(ctx).
+		Model(&model.Message{}).
+		Joins("JOIN room_members ON room_members.room_id = messages.room_id AND room_members.user_id = ? AND room_members.deleted_at IS NULL", userID).
+		Where("messages.metadata -> 'mentioned_users' @> ?::jsonb AND messages.is_deleted = ?", fmt.Sprintf("[%q]", userID.String()), false)
+
+	if err := mentionQuery.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count mentions: %w", err)
+	}
+
+	if err := mentionQuery.
+		Preload("Sender").
+		Preload("Attachments").
+		Order("messages.created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&messages).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get mentions: %w", err)
+	}
+
+	return messages, total, nil
+}
+
+func (r *messageRepository) GetReadMessageIDs(ctx context.Context, userID uuid.UUID, messageIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	read := make(map[uuid.UUID]bool)
+	if len(messageIDs) == 0 {
+		return read, nil
+	}
+
+	var ids []uuid.UUID
+	if err := r.db.WithContext(ctx).
+		Model(&model.MessageRead{}).
+		Where("user_id = ? AND message_id IN ?", userID, messageIDs).
+		Pluck("message_id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to get read messages: %w", err)
+	}
+
+	for _, id := range ids {
+		read[id] = true
+	}
+	return read, nil
+}
+
 func (r *messageRepository) MarkAsRead(ctx context.Context, messageID, userID uuid.UUID) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
 	// Check if read receipt already exists
 	var existing model.MessageRead
 	err := r.db.WithContext(ctx).
@@ -183,18 +542,19 @@ func (r *messageRepository) MarkAsRead(ctx context.Context, messageID, userID uu
 	return nil
 }
 
+// GetUnreadCount counts the messages of others posted after the member's
+// read cursor
 func (r *messageRepository) GetUnreadCount(ctx context.Context, roomID, userID uuid.UUID) (int64, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var count int64
 
-	// Count messages in room that don't have read receipts for this user
 	if err := r.db.WithContext(ctx).
 		Model(&model.Message{}).
-		Where("room_id = ? AND sender_id != ?", roomID, userID).
-		Where("id NOT IN (?)",
-			r.db.Select("message_id").
-				Table("message_reads").
-				Where("user_id = ?", userID),
-		).
+		Joins("JOIN room_members ON room_members.room_id = messages.room_id AND room_members.user_id = ? AND room_members.deleted_at IS NULL", userID).
+		Where("messages.room_id = ? AND messages.sender_id <> ?", roomID, userID).
+		Where("room_members.last_read_at IS NULL OR messages.created_at > room_members.last_read_at").
 		Count(&count).Error; err != nil {
 		return 0, fmt.Errorf("failed to get unread count: %w", err)
 	}
@@ -202,7 +562,109 @@ func (r *messageRepository) GetUnreadCount(ctx context.Context, roomID, userID u
 	return count, nil
 }
 
+// GetUnreadCounts counts the unread messages of every room the user is a
+// member of in one grouped query, rooms without unread messages counting 0
+func (r *messageRepository) GetUnreadCounts(ctx context.Context, userID uuid.UUID) (map[uuid.UUID]int64, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var rows []struct {
+		RoomID uuid.UUID
+		Count  int64
+	}
+
+	if err := r.db.WithContext(ctx).
+		Model(&model.RoomMember{}).
+		Select("room_members.room_id, COUNT(messages.id) AS count").
+		Joins("LEFT JOIN messages ON messages.room_id = room_members.room_id AND messages.deleted_at IS NULL AND messages.sender_id <> room_members.user_id AND (room_members.last_read_at IS NULL OR messages.created_at > room_members.last_read_at)").
+		Where("room_members.user_id = ?", userID).
+		Group("room_members.room_id").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get unread counts: %w", err)
+	}
+
+	counts := make(map[uuid.UUID]int64, len(rows))
+	for _, row := range rows {
+		counts[row.RoomID] = row.Count
+	}
+	return counts, nil
+}
+
+// RecordDeliveries stores delivery receipts, ignoring ones already recorded
+func (r *messageRepository) RecordDeliveries(ctx context.Context, deliveries []model.MessageDelivery) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		CreateInBatches(deliveries, 500).Error; err != nil {
+		return fmt.Errorf("failed to record message deliveries: %w", err)
+	}
+	return nil
+}
+
+// GetReceiptCounts counts, per message, the members it was delivered to and
+// the members whose read cursor has passed it. A message that was read
+// counts as delivered even when the reader never acknowledged the delivery.
+func (r *messageRepository) GetReceiptCounts(ctx context.Context, messageIDs []uuid.UUID) (map[uuid.UUID]int, map[uuid.UUID]int, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	delivered := make(map[uuid.UUID]int)
+	read := make(map[uuid.UUID]int)
+	if len(messageIDs) == 0 {
+		return delivered, read, nil
+	}
+
+	var rows []struct {
+		MessageID         uuid.UUID
+		DeliveredReceipts int
+		ReadReceipts      int
+	}
+	if err := r.db.WithContext(ctx).
+		Model(&model.Message{}).
+		Select(`messages.id AS message_id,
+			COUNT(CASE WHEN room_members.last_read_at >= messages.created_at OR EXISTS (?) THEN 1 END) AS delivered_receipts,
+			COUNT(CASE WHEN room_members.last_read_at >= messages.created_at THEN 1 END) AS read_receipts`,
+			r.db.Table("message_deliveries").
+				Select("1").
+				Where("message_deliveries.message_id = messages.id AND message_deliveries.user_id = room_members.user_id AND message_deliveries.deleted_at IS NULL"),
+		).
+		Joins("JOIN room_members ON room_members.room_id = messages.room_id AND room_members.user_id <> messages.sender_id AND room_members.deleted_at IS NULL").
+		Where("messages.id IN ?", messageIDs).
+		Group("messages.id").
+		Scan(&rows).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to count message receipts: %w", err)
+	}
+
+	for _, row := range rows {
+		delivered[row.MessageID] = row.DeliveredReceipts
+		read[row.MessageID] = row.ReadReceipts
+	}
+	return delivered, read, nil
+}
+
+// HideMessage hides a message from one user's history; hiding it twice is a no-op
+func (r *messageRepository) HideMessage(ctx context.Context, messageID, userID uuid.UUID) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	hidden := &model.MessageHidden{MessageID: messageID, UserID: userID}
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(hidden).Error; err != nil {
+		return fmt.Errorf("failed to hide message: %w", err)
+	}
+	return nil
+}
+
 func (r *messageRepository) AddAttachment(ctx context.Context, attachment *model.MessageAttachment) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
 	if err := r.db.WithContext(ctx).Create(attachment).Error; err != nil {
 		return fmt.Errorf("failed to add attachment: %w", err)
 	}
@@ -210,6 +672,9 @@ func (r *messageRepository) AddAttachment(ctx context.Context, attachment *model
 }
 
 func (r *messageRepository) GetMessageAttachments(ctx context.Context, messageID uuid.UUID) ([]model.MessageAttachment, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var attachments []model.MessageAttachment
 	if err := r.db.WithContext(ctx).
 		Where("message_id = ?", messageID).
@@ -220,46 +685,160 @@ func (r *messageRepository) GetMessageAttachments(ctx context.Context, messageID
 }
 
 func (r *messageRepository) DeleteAttachment(ctx context.Context, attachmentID uuid.UUID) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
 	if err := r.db.WithContext(ctx).Delete(&model.MessageAttachment{}, "id = ?", attachmentID).Error; err != nil {
 		return fmt.Errorf("failed to delete attachment: %w", err)
 	}
 	return nil
 }
 
-func (r *messageRepository) AddReaction(ctx context.Context, reaction *model.MessageReaction) error {
-	if err := r.db.WithContext(ctx).Create(reaction).Error; err != nil {
-		return fmt.Errorf("failed to add reaction: %w", err)
+// AddReaction reports whether the reaction was new
+func (r *messageRepository) AddReaction(ctx context.Context, reaction *model.MessageReaction) (bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(reaction)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to add reaction: %w", result.Error)
 	}
-	return nil
+	return result.RowsAffected > 0, nil
+}
+
+// RemoveReaction reports whether the reaction existed. Rows are deleted for
+// good so the unique index doesn't block reacting again.
+func (r *messageRepository) RemoveReaction(ctx context.Context, messageID, userID uuid.UUID, emoji string) (bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	result := r.db.WithContext(ctx).
+		Unscoped().
+		Delete(&model.MessageReaction{}, "message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to remove reaction: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
 }
 
-func (r *messageRepository) RemoveReaction(ctx context.Context, messageID, userID uuid.UUID, emoji string) error {
+// GetUserReactionEmojis returns the emojis a user reacted with on a message
+func (r *messageRepository) GetUserReactionEmojis(ctx context.Context, messageID, userID uuid.UUID) ([]string, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var emojis []string
 	if err := r.db.WithContext(ctx).
-		Delete(&model.MessageReaction{}, "message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji).Error; err != nil {
-		return fmt.Errorf("failed to remove reaction: %w", err)
+		Model(&model.MessageReaction{}).
+		Where("message_id = ? AND user_id = ?", messageID, userID).
+		Pluck("emoji", &emojis).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user reactions: %w", err)
 	}
-	return nil
+	return emojis, nil
 }
 
-func (r *messageRepository) GetMessageReactions(ctx context.Context, messageID uuid.UUID) ([]model.MessageReaction, error) {
+// GetMessageReactions pages through who reacted to a message, optionally
+// with a single emoji, oldest reaction first
+func (r *messageRepository) GetMessageReactions(ctx context.Context, messageID uuid.UUID, emoji string, offset, limit int) ([]model.MessageReaction, int64, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var reactions []model.MessageReaction
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&model.MessageReaction{}).Where("message_id = ?", messageID)
+	if emoji != "" {
+		query = query.Where("emoji = ?", emoji)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count message reactions: %w", err)
+	}
+
+	if err := query.
+		Preload("User").
+		Order("created_at ASC").
+		Offset(offset).
+		Limit(limit).
+		Find(&reactions).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get message reactions: %w", err)
+	}
+	return reactions, total, nil
+}
+
+// GetReactionsWithUsers loads every reaction of the messages together with
+// the reacting users
+func (r *messageRepository) GetReactionsWithUsers(ctx context.Context, messageIDs []uuid.UUID) ([]model.MessageReaction, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var reactions []model.MessageReaction
+	if len(messageIDs) == 0 {
+		return reactions, nil
+	}
 	if err := r.db.WithContext(ctx).
 		Preload("User").
-		Where("message_id = ?", messageID).
+		Where("message_id IN ?", messageIDs).
+		Order("created_at ASC").
 		Find(&reactions).Error; err != nil {
 		return nil, fmt.Errorf("failed to get message reactions: %w", err)
 	}
 	return reactions, nil
 }
 
+// GetReactionSummaries counts the reactions of each message per emoji in one
+// grouped query, and lists the emojis userID reacted with
+func (r *messageRepository) GetReactionSummaries(ctx context.Context, messageIDs []uuid.UUID, userID uuid.UUID) (map[uuid.UUID]map[string]int, map[uuid.UUID][]string, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	counts := make(map[uuid.UUID]map[string]int)
+	mine := make(map[uuid.UUID][]string)
+	if len(messageIDs) == 0 {
+		return counts, mine, nil
+	}
+
+	var rows []struct {
+		MessageID uuid.UUID
+		Emoji     string
+		Reactions int
+		Mine      int
+	}
+	if err := r.db.WithContext(ctx).
+		Model(&model.MessageReaction{}).
+		Select("message_id, emoji, COUNT(*) AS reactions, MAX(CASE WHEN user_id = ? THEN 1 ELSE 0 END) AS mine", userID).
+		Where("message_id IN ?", messageIDs).
+		Group("message_id, emoji").
+		Order("emoji").
+		Scan(&rows).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to count reactions: %w", err)
+	}
+
+	for _, row := range rows {
+		if counts[row.MessageID] == nil {
+			counts[row.MessageID] = make(map[string]int)
+		}
+		counts[row.MessageID][row.Emoji] = row.Reactions
+		if row.Mine == 1 {
+			mine[row.MessageID] = append(mine[row.MessageID], row.Emoji)
+		}
+	}
+	return counts, mine, nil
+}
+
 func (r *messageRepository) GetThreadMessages(ctx context.Context, parentMessageID uuid.UUID, offset, limit int) ([]model.Message, int64, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var messages []model.Message
 	var total int64
 
-	query := r.db.WithContext(ctx).Where("parent_message_id = ?", parentMessageID)
+	query := r.db.WithContext(ctx).Model(&model.Message{}).
+		Where("reply_to_id = ? AND is_deleted = ?", parentMessageID, false)
 
 	// Count total records
-	if err := query.Model(&model.Message{}).Count(&total).Error; err != nil {
+	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, fmt.Errorf("failed to count thread messages: %w", err)
 	}
 
@@ -267,8 +846,6 @@ func (r *messageRepository) GetThreadMessages(ctx context.Context, parentMessage
 	if err := query.
 		Preload("Sender").
 		Preload("Attachments").
-		Preload("Reactions").
-		Preload("Reactions.User").
 		Order("created_at ASC").
 		Offset(offset).
 		Limit(limit).
@@ -278,3 +855,227 @@ func (r *messageRepository) GetThreadMessages(ctx context.Context, parentMessage
 
 	return messages, total, nil
 }
+
+// GetReplyCounts counts the replies of each message in one grouped query;
+// messages without replies are missing from the result
+func (r *messageRepository) GetReplyCounts(ctx context.Context, messageIDs []uuid.UUID) (map[uuid.UUID]int, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	counts := make(map[uuid.UUID]int)
+	if len(messageIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		ReplyToID uuid.UUID
+		Replies   int
+	}
+	if err := r.db.WithContext(ctx).
+		Model(&model.Message{}).
+		Select("reply_to_id, COUNT(*) AS replies").
+		Where("reply_to_id IN ? AND is_deleted = ?", messageIDs, false).
+		Group("reply_to_id").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count replies: %w", err)
+	}
+
+	for _, row := range rows {
+		counts[row.ReplyToID] = row.Replies
+	}
+	return counts, nil
+}
+
+func (r *messageRepository) PinMessage(ctx context.Context, pin *model.RoomPinnedMessage) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(pin).Error; err != nil {
+		return fmt.Errorf("failed to pin message: %w", err)
+	}
+	return nil
+}
+
+// UnpinMessage reports whether the message was pinned
+func (r *messageRepository) UnpinMessage(ctx context.Context, roomID, messageID uuid.UUID) (bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	result := r.db.WithContext(ctx).
+		Unscoped().
+		Where("room_id = ? AND message_id = ?", roomID, messageID).
+		Delete(&model.RoomPinnedMessage{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to unpin message: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *messageRepository) IsMessagePinned(ctx context.Context, roomID, messageID uuid.UUID) (bool, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var count int64
+	if err := r.db.WithContext(ctx).
+		Model(&model.RoomPinnedMessage{}).
+		Where("room_id = ? AND message_id = ?", roomID, messageID).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check pinned message: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (r *messageRepository) CountPinnedMessages(ctx context.Context, roomID uuid.UUID) (int64, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var count int64
+	if err := r.db.WithContext(ctx).
+		Model(&model.RoomPinnedMessage{}).
+		Where("room_id = ?", roomID).
+		Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count pinned messages: %w", err)
+	}
+	return count, nil
+}
+
+// GetPinnedMessages returns the pins of a room, most recently pinned first
+func (r *messageRepository) GetPinnedMessages(ctx context.Context, roomID uuid.UUID) ([]model.RoomPinnedMessage, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var pins []model.RoomPinnedMessage
+	if err := r.db.WithContext(ctx).
+		Preload("Message").
+		Preload("Message.Sender").
+		Preload("Message.Attachments").
+		Where("room_id = ?", roomID).
+		Order("pinned_at DESC").
+		Find(&pins).Error; err != nil {
+		return nil, fmt.Errorf("failed to get pinned messages: %w", err)
+	}
+	return pins, nil
+}
+
+func (r *messageRepository) GetDraft(ctx context.Context, userID, roomID uuid.UUID) (*model.MessageDraft, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var draft model.MessageDraft
+	if err := r.db.WithContext(ctx).
+		First(&draft, "user_id = ? AND room_id = ?", userID, roomID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get message draft: %w", err)
+	}
+	return &draft, nil
+}
+
+// SaveDraft inserts the draft or replaces the user's existing draft for the room
+func (r *messageRepository) SaveDraft(ctx context.Context, draft *model.MessageDraft) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "room_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"content", "reply_to_id", "updated_at"}),
+		}).
+		Create(draft).Error; err != nil {
+		return fmt.Errorf("failed to save message draft: %w", err)
+	}
+	return nil
+}
+
+// DeleteDraft reports whether the user had a draft for the room
+func (r *messageRepository) DeleteDraft(ctx context.Context, userID, roomID uuid.UUID) (bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	result := r.db.WithContext(ctx).
+		Unscoped().
+		Delete(&model.MessageDraft{}, "user_id = ? AND room_id = ?", userID, roomID)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to delete message draft: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *messageRepository) CreateScheduled(ctx context.Context, scheduled *model.ScheduledMessage) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Create(scheduled).Error; err != nil {
+		return fmt.Errorf("failed to create scheduled message: %w", err)
+	}
+	return nil
+}
+
+func (r *messageRepository) GetScheduledByID(ctx context.Context, id uuid.UUID) (*model.ScheduledMessage, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var scheduled model.ScheduledMessage
+	if err := r.db.WithContext(ctx).First(&scheduled, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get scheduled message by ID: %w", err)
+	}
+	return &scheduled, nil
+}
+
+// GetPendingScheduled returns the messages a user scheduled in a room, soonest first
+func (r *messageRepository) GetPendingScheduled(ctx context.Context, roomID, senderID uuid.UUID) ([]model.ScheduledMessage, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var scheduled []model.ScheduledMessage
+	if err := r.db.WithContext(ctx).
+		Where("room_id = ? AND sender_id = ? AND status = ?", roomID, senderID, model.ScheduledMessagePending).
+		Order("scheduled_at ASC").
+		Find(&scheduled).Error; err != nil {
+		return nil, fmt.Errorf("failed to get scheduled messages: %w", err)
+	}
+	return scheduled, nil
+}
+
+// GetDueScheduled returns pending messages whose time has come, oldest first
+func (r *messageRepository) GetDueScheduled(ctx context.Context, now time.Time, limit int) ([]model.ScheduledMessage, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var scheduled []model.ScheduledMessage
+	if err := r.db.WithContext(ctx).
+		Where("status = ? AND scheduled_at <= ?", model.ScheduledMessagePending, now).
+		Order("scheduled_at ASC").
+		Limit(limit).
+		Find(&scheduled).Error; err != nil {
+		return nil, fmt.Errorf("failed to get due scheduled messages: %w", err)
+	}
+	return scheduled, nil
+}
+
+// UpdateScheduledStatus moves a scheduled message from one status to another
+// and reports whether it was still in the from status. Concurrent dispatchers
+// use it to claim a message.
+func (r *messageRepository) UpdateScheduledStatus(ctx context.Context, id uuid.UUID, from, to string, fields map[string]interface{}) (bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	updates := map[string]interface{}{"status": to}
+	for column, value := range fields {
+		updates[column] = value
+	}
+
+	result := r.db.WithContext(ctx).Model(&model.ScheduledMessage{}).
+		Where("id = ? AND status = ?", id, from).
+		Updates(updates)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update scheduled message: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
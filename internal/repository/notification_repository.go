@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"realtime-api/internal/database"
+	"realtime-api/internal/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type NotificationRepository interface {
+	Create(ctx context.Context, notification *model.Notification) error
+	CreateBatch(ctx context.Context, notifications []model.Notification) error
+	GetByUserID(ctx context.Context, userID uuid.UUID, isRead *bool, offset, limit int) ([]model.Notification, int64, error)
+	CountUnread(ctx context.Context, userID uuid.UUID) (int64, error)
+	MarkAsRead(ctx context.Context, id, userID uuid.UUID) (bool, error)
+	MarkAllAsRead(ctx context.Context, userID uuid.UUID) error
+	DeleteByID(ctx context.Context, id, userID uuid.UUID) (bool, error)
+	DeleteReadBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type notificationRepository struct {
+	db *gorm.DB
+}
+
+func NewNotificationRepository() NotificationRepository {
+	return &notificationRepository{
+		db: database.GetDB(),
+	}
+}
+
+func (r *notificationRepository) Create(ctx context.Context, notification *model.Notification) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Create(notification).Error; err != nil {
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+	return nil
+}
+
+func (r *notificationRepository) CreateBatch(ctx context.Context, notifications []model.Notification) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if len(notifications) == 0 {
+		return nil
+	}
+	if err := r.db.WithContext(ctx).CreateInBatches(notifications, 100).Error; err != nil {
+		return fmt.Errorf("failed to create notifications: %w", err)
+	}
+	return nil
+}
+
+// GetByUserID returns the notifications of the user, newest first. When
+// isRead is set only read or unread notifications are returned.
+func (r *notificationRepository) GetByUserID(ctx context.Context, userID uuid.UUID, isRead *bool, offset, limit int) ([]model.Notification, int64, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var notifications []model.Notification
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&model.Notification{}).Where("user_id = ?", userID)
+	if isRead != nil {
+		query = query.Where("is_read = ?", *isRead)
+	}
+
+	// Count total records
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count notifications: %w", err)
+	}
+
+	// Get paginated results
+	if err := query.
+		Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&notifications).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get notifications: %w", err)
+	}
+
+	return notifications, total, nil
+}
+
+// CountUnread returns the number of unread notifications of the user
+func (r *notificationRepository) CountUnread(ctx context.Context, userID uuid.UUID) (int64, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&model.Notification{}).
+		Where("user_id = ? AND is_read = ?", userID, false).
+		Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+// MarkAsRead marks a notification of the user as read and reports whether it exists
+func (r *notificationRepository) MarkAsRead(ctx context.Context, id, userID uuid.UUID) (bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	var notification model.Notification
+	if err := r.db.WithContext(ctx).First(&notification, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get notification: %w", err)
+	}
+
+	if notification.IsRead {
+		return true, nil
+	}
+
+	if err := r.db.WithContext(ctx).Model(&notification).Updates(map[string]interface{}{
+		"is_read": true,
+		"read_at": time.Now(),
+	}).Error; err != nil {
+		return false, fmt.Errorf("failed to mark notification as read: %w", err)
+	}
+	return true, nil
+}
+
+func (r *notificationRepository) MarkAllAsRead(ctx context.Context, userID uuid.UUID) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Model(&model.Notification{}).
+		Where("user_id = ? AND is_read = ?", userID, false).
+		Updates(map[string]interface{}{
+			"is_read": true,
+			"read_at": time.Now(),
+		}).Error; err != nil {
+		return fmt.Errorf("failed to mark notifications as read: %w", err)
+	}
+	return nil
+}
+
+// DeleteByID deletes a notification of the user and reports whether it existed
+func (r *notificationRepository) DeleteByID(ctx context.Context, id, userID uuid.UUID) (bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	result := r.db.WithContext(ctx).Delete(&model.Notification{}, "id = ? AND user_id = ?", id, userID)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to delete notification: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DeleteReadBefore permanently deletes the notifications read before the
+// given time and returns how many were deleted
+func (r *notificationRepository) DeleteReadBefore(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	result := r.db.WithContext(ctx).Unscoped().
+		Where("is_read = ? AND read_at < ?", true, before).
+		Delete(&model.Notification{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete read notifications: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
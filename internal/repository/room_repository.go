@@ -2,7 +2,9 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"realtime-api/internal/database"
@@ -10,29 +12,76 @@ import (
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrRoomFull is returned when adding a member would exceed the MaxMembers
+// limit of the room
+var ErrRoomFull = errors.New("room is full")
+
 type RoomRepository interface {
 	Create(ctx context.Context, room *model.Room) error
 	GetByID(ctx context.Context, id uuid.UUID) (*model.Room, error)
 	Update(ctx context.Context, room *model.Room) error
 	Delete(ctx context.Context, id uuid.UUID) error
-	GetUserRooms(ctx context.Context, userID uuid.UUID) ([]model.Room, error)
+	GetUserRooms(ctx context.Context, userID uuid.UUID, archived *bool) ([]model.Room, error)
 	GetPublicRooms(ctx context.Context, offset, limit int) ([]model.Room, int64, error)
-	SearchRooms(ctx context.Context, query string, offset, limit int) ([]model.Room, int64, error)
+	GetRoomsWithRetention(ctx context.Context) ([]model.Room, error)
+	SearchRooms(ctx context.Context, query string, tags []string, offset, limit int) ([]model.Room, int64, error)
+	GetTags(ctx context.Context, roomID uuid.UUID) ([]string, error)
+	SetTags(ctx context.Context, roomID uuid.UUID, tags []string) error
+	ListTags(ctx context.Context) ([]model.RoomTagCount, error)
+	GetDirectRoomBetween(ctx context.Context, user1ID, user2ID uuid.UUID) (*model.Room, error)
+	CreateDirectRoom(ctx context.Context, room *model.Room, members []model.RoomMember) (*model.Room, bool, error)
 
 	// Room Member management
 	AddMember(ctx context.Context, member *model.RoomMember) error
 	RemoveMember(ctx context.Context, roomID, userID uuid.UUID) error
 	GetRoomMembers(ctx context.Context, roomID uuid.UUID) ([]model.RoomMember, error)
+	ListRoomMembers(ctx context.Context, roomID uuid.UUID, role, search string, offset, limit int) ([]model.RoomMember, int64, error)
+	SearchMembersByUsername(ctx context.Context, roomID uuid.UUID, prefix string, limit int) ([]model.RoomMember, error)
+	GetMember(ctx context.Context, roomID, userID uuid.UUID) (*model.RoomMember, error)
+	CountMembers(ctx context.Context, roomID uuid.UUID) (int64, error)
 	UpdateMemberRole(ctx context.Context, roomID, userID uuid.UUID, role string) error
+	TransferOwnership(ctx context.Context, roomID, oldOwnerID, newOwnerID uuid.UUID) error
+	SetMemberArchived(ctx context.Context, roomID, userID uuid.UUID, archived bool) error
+	SetRoomArchived(ctx context.Context, roomID uuid.UUID, archived bool) error
+	SetMemberNotificationLevel(ctx context.Context, roomID, userID uuid.UUID, level model.NotificationLevel) error
+	SetMemberMuted(ctx context.Context, roomID, userID uuid.UUID, muted bool, until *time.Time) error
 	IsUserInRoom(ctx context.Context, roomID, userID uuid.UUID) (bool, error)
+	AdvanceReadCursor(ctx context.Context, roomID, userID uuid.UUID, readAt time.Time) (bool, error)
 
 	// Room Invites
 	CreateInvite(ctx context.Context, invite *model.RoomInvite) error
 	GetInviteByCode(ctx context.Context, code string) (*model.RoomInvite, error)
-	AcceptInvite(ctx context.Context, inviteID uuid.UUID) error
-	RejectInvite(ctx context.Context, inviteID uuid.UUID) error
+	GetRoomInvites(ctx context.Context, roomID uuid.UUID) ([]model.RoomInvite, error)
+	AcceptInvite(ctx context.Context, invite *model.RoomInvite, member *model.RoomMember) (bool, error)
+	RejectInvite(ctx context.Context, inviteID uuid.UUID) (bool, error)
+	RevokeInvite(ctx context.Context, roomID, inviteID uuid.UUID) (bool, error)
+
+	// Room Join Requests
+	GetJoinRequest(ctx context.Context, roomID, userID uuid.UUID) (*model.RoomJoinRequest, error)
+	GetJoinRequestByID(ctx context.Context, id uuid.UUID) (*model.RoomJoinRequest, error)
+	SaveJoinRequest(ctx context.Context, request *model.RoomJoinRequest) error
+	GetPendingJoinRequests(ctx context.Context, roomID uuid.UUID) ([]model.RoomJoinRequest, error)
+	ApproveJoinRequest(ctx context.Context, request *model.RoomJoinRequest, respondedBy uuid.UUID, member *model.RoomMember) (bool, error)
+	RejectJoinRequest(ctx context.Context, request *model.RoomJoinRequest, respondedBy uuid.UUID) (bool, error)
+
+	// Room Bans
+	BanUser(ctx context.Context, ban *model.RoomBan) error
+	UnbanUser(ctx context.Context, roomID, userID uuid.UUID) (bool, error)
+	GetActiveBan(ctx context.Context, roomID, userID uuid.UUID) (*model.RoomBan, error)
+	GetActiveBans(ctx context.Context, roomID uuid.UUID) ([]model.RoomBan, error)
+
+	// Room Webhooks
+	CreateWebhook(ctx context.Context, webhook *model.RoomWebhook) error
+	DeleteWebhook(ctx context.Context, roomID, webhookID uuid.UUID) (bool, error)
+	GetWebhooks(ctx context.Context, roomID uuid.UUID, activeOnly bool) ([]model.RoomWebhook, error)
+
+	// Room Stats
+	GetMessageCounts(ctx context.Context, roomID uuid.UUID, now time.Time) (*model.RoomMessageCounts, error)
+	CountMembersByRole(ctx context.Context, roomID uuid.UUID) (map[string]int64, error)
+	GetTopReactions(ctx context.Context, roomID uuid.UUID, limit int) ([]model.ReactionCount, error)
 }
 
 type roomRepository struct {
@@ -46,28 +95,44 @@ func NewRoomRepository() RoomRepository {
 }
 
 func (r *roomRepository) Create(ctx context.Context, room *model.Room) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
 	if err := r.db.WithContext(ctx).Create(room).Error; err != nil {
 		return fmt.Errorf("failed to create room: %w", err)
 	}
 	return nil
 }
 
+// GetByID returns the room with its member count. Members aren't loaded, as
+// large rooms have too many of them; they are listed page by page with
+// ListRoomMembers.
 func (r *roomRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Room, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var room model.Room
 	if err := r.db.WithContext(ctx).
 		Preload("CreatedByUser").
-		Preload("Members").
-		Preload("Members.User").
 		First(&room, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
 		return nil, fmt.Errorf("failed to get room by ID: %w", err)
 	}
+
+	count, err := r.CountMembers(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	room.MemberCount = count
 	return &room, nil
 }
 
 func (r *roomRepository) Update(ctx context.Context, room *model.Room) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
 	if err := r.db.WithContext(ctx).Save(room).Error; err != nil {
 		return fmt.Errorf("failed to update room: %w", err)
 	}
@@ -75,25 +140,86 @@ func (r *roomRepository) Update(ctx context.Context, room *model.Room) error {
 }
 
 func (r *roomRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	if err := r.db.WithContext(ctx).Delete(&model.Room{}, "id = ?", id).Error; err != nil {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Release the pair key so the two users can open a new direct room
+		if err := tx.Model(&model.Room{}).Where("id = ?", id).Update("direct_key", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.Room{}, "id = ?", id).Error
+	})
+	if err != nil {
 		return fmt.Errorf("failed to delete room: %w", err)
 	}
 	return nil
 }
 
-func (r *roomRepository) GetUserRooms(ctx context.Context, userID uuid.UUID) ([]model.Room, error) {
+// GetUserRooms returns the rooms the user belongs to. When archived is set
+// only rooms that are (or aren't) archived, by the user or for everyone, are
+// returned.
+func (r *roomRepository) GetUserRooms(ctx context.Context, userID uuid.UUID, archived *bool) ([]model.Room, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var rooms []model.Room
-	if err := r.db.WithContext(ctx).
+	query := r.db.WithContext(ctx).
 		Joins("JOIN room_members ON rooms.id = room_members.room_id").
-		Where("room_members.user_id = ? AND room_members.deleted_at IS NULL", userID).
+		Where("room_members.user_id = ? AND room_members.deleted_at IS NULL", userID)
+
+	if archived != nil {
+		if *archived {
+			query = query.Where("room_members.is_archived = ? OR rooms.is_archived = ?", true, true)
+		} else {
+			query = query.Where("room_members.is_archived = ? AND rooms.is_archived = ?", false, false)
+		}
+	}
+
+	if err := query.
 		Preload("CreatedByUser").
 		Find(&rooms).Error; err != nil {
 		return nil, fmt.Errorf("failed to get user rooms: %w", err)
 	}
+
+	var levels []struct {
+		RoomID            uuid.UUID
+		NotificationLevel model.NotificationLevel
+	}
+	if err := r.db.WithContext(ctx).Model(&model.RoomMember{}).
+		Select("room_id, notification_level").
+		Where("user_id = ?", userID).
+		Scan(&levels).Error; err != nil {
+		return nil, fmt.Errorf("failed to get member notification levels: %w", err)
+	}
+	levelByRoom := make(map[uuid.UUID]model.NotificationLevel, len(levels))
+	for _, level := range levels {
+		levelByRoom[level.RoomID] = level.NotificationLevel
+	}
+	for i := range rooms {
+		rooms[i].NotificationLevel = levelByRoom[rooms[i].ID]
+	}
+	return rooms, nil
+}
+
+// GetRoomsWithRetention returns the rooms whose messages expire
+func (r *roomRepository) GetRoomsWithRetention(ctx context.Context) ([]model.Room, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var rooms []model.Room
+	if err := r.db.WithContext(ctx).
+		Where("message_retention_days > ?", 0).
+		Find(&rooms).Error; err != nil {
+		return nil, fmt.Errorf("failed to get rooms with retention: %w", err)
+	}
 	return rooms, nil
 }
 
 func (r *roomRepository) GetPublicRooms(ctx context.Context, offset, limit int) ([]model.Room, int64, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var rooms []model.Room
 	var total int64
 
@@ -108,16 +234,32 @@ func (r *roomRepository) GetPublicRooms(ctx context.Context, offset, limit int)
 	if err := query.Preload("CreatedByUser").Offset(offset).Limit(limit).Find(&rooms).Error; err != nil {
 		return nil, 0, fmt.Errorf("failed to list public rooms: %w", err)
 	}
+	if err := r.loadTags(ctx, rooms); err != nil {
+		return nil, 0, err
+	}
 
 	return rooms, total, nil
 }
 
-func (r *roomRepository) SearchRooms(ctx context.Context, query string, offset, limit int) ([]model.Room, int64, error) {
+// SearchRooms returns the public rooms whose name or description contains
+// query and, when tags are given, that have at least one of them
+func (r *roomRepository) SearchRooms(ctx context.Context, query string, tags []string, offset, limit int) ([]model.Room, int64, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var rooms []model.Room
 	var total int64
 
-	searchQuery := r.db.WithContext(ctx).Where("is_public = ? AND (name ILIKE ? OR description ILIKE ?)",
-		true, "%"+query+"%", "%"+query+"%")
+	searchQuery := r.db.WithContext(ctx).Where("rooms.is_public = ?", true)
+	if query != "" {
+		searchQuery = searchQuery.Where("(rooms.name ILIKE ? OR rooms.description ILIKE ?)", "%"+query+"%", "%"+query+"%")
+	}
+	if len(tags) > 0 {
+		tagged := r.db.Table("room_tags").
+			Select("1").
+			Where("room_tags.room_id = rooms.id AND room_tags.tag IN ? AND room_tags.deleted_at IS NULL", tags)
+		searchQuery = searchQuery.Where("EXISTS (?)", tagged)
+	}
 
 	// Count total records
 	if err := searchQuery.Model(&model.Room{}).Count(&total).Error; err != nil {
@@ -128,26 +270,258 @@ func (r *roomRepository) SearchRooms(ctx context.Context, query string, offset,
 	if err := searchQuery.Preload("CreatedByUser").Offset(offset).Limit(limit).Find(&rooms).Error; err != nil {
 		return nil, 0, fmt.Errorf("failed to search rooms: %w", err)
 	}
+	if err := r.loadTags(ctx, rooms); err != nil {
+		return nil, 0, err
+	}
 
 	return rooms, total, nil
 }
 
-func (r *roomRepository) AddMember(ctx context.Context, member *model.RoomMember) error {
-	if err := r.db.WithContext(ctx).Create(member).Error; err != nil {
-		return fmt.Errorf("failed to add room member: %w", err)
+// GetTags returns the tags of a room in alphabetical order
+func (r *roomRepository) GetTags(ctx context.Context, roomID uuid.UUID) ([]string, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var tags []string
+	if err := r.db.WithContext(ctx).Model(&model.RoomTag{}).
+		Where("room_id = ?", roomID).
+		Order("tag").
+		Pluck("tag", &tags).Error; err != nil {
+		return nil, fmt.Errorf("failed to get room tags: %w", err)
+	}
+	return tags, nil
+}
+
+// SetTags replaces the tags of a room
+func (r *roomRepository) SetTags(ctx context.Context, roomID uuid.UUID, tags []string) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Removed tags are deleted for good so they can be added again
+		if err := tx.Unscoped().Where("room_id = ?", roomID).Delete(&model.RoomTag{}).Error; err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			return nil
+		}
+
+		roomTags := make([]model.RoomTag, len(tags))
+		for i, tag := range tags {
+			roomTags[i] = model.RoomTag{RoomID: roomID, Tag: tag}
+		}
+		return tx.Create(&roomTags).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set room tags: %w", err)
 	}
 	return nil
 }
 
-func (r *roomRepository) RemoveMember(ctx context.Context, roomID, userID uuid.UUID) error {
+// ListTags returns the tags of public rooms with the number of rooms using
+// each, most used first
+func (r *roomRepository) ListTags(ctx context.Context) ([]model.RoomTagCount, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var counts []model.RoomTagCount
+	if err := r.db.WithContext(ctx).Model(&model.RoomTag{}).
+		Select("room_tags.tag, COUNT(*) AS count").
+		Joins("JOIN rooms ON rooms.id = room_tags.room_id AND rooms.deleted_at IS NULL").
+		Where("rooms.is_public = ?", true).
+		Group("room_tags.tag").
+		Order("count DESC, room_tags.tag").
+		Scan(&counts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list room tags: %w", err)
+	}
+	return counts, nil
+}
+
+// loadTags fills in the tags of rooms with a single query
+func (r *roomRepository) loadTags(ctx context.Context, rooms []model.Room) error {
+	if len(rooms) == 0 {
+		return nil
+	}
+
+	roomIDs := make([]uuid.UUID, len(rooms))
+	for i := range rooms {
+		roomIDs[i] = rooms[i].ID
+	}
+
+	var roomTags []model.RoomTag
 	if err := r.db.WithContext(ctx).
-		Delete(&model.RoomMember{}, "room_id = ? AND user_id = ?", roomID, userID).Error; err != nil {
-		return fmt.Errorf("failed to remove room member: %w", err)
+		Where("room_id IN ?", roomIDs).
+		Order("tag").
+		Find(&roomTags).Error; err != nil {
+		return fmt.Errorf("failed to get room tags: %w", err)
+	}
+
+	byRoom := make(map[uuid.UUID][]string, len(rooms))
+	for _, roomTag := range roomTags {
+		byRoom[roomTag.RoomID] = append(byRoom[roomTag.RoomID], roomTag.Tag)
+	}
+	for i := range rooms {
+		rooms[i].Tags = byRoom[rooms[i].ID]
 	}
 	return nil
 }
 
+func (r *roomRepository) GetDirectRoomBetween(ctx context.Context, user1ID, user2ID uuid.UUID) (*model.Room, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var room model.Room
+	if err := r.db.WithContext(ctx).
+		Joins("JOIN room_members m1 ON m1.room_id = rooms.id AND m1.user_id = ? AND m1.deleted_at IS NULL", user1ID).
+		Joins("JOIN room_members m2 ON m2.room_id = rooms.id AND m2.user_id = ? AND m2.deleted_at IS NULL", user2ID).
+		Where("rooms.type = ?", "direct").
+		Order("rooms.created_at ASC").
+		First(&room).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get direct room: %w", err)
+	}
+	return &room, nil
+}
+
+// CreateDirectRoom inserts a direct room and its members in one transaction.
+// The unique direct_key index makes concurrent creations converge: the loser
+// gets the already existing room back with created set to false, with any
+// member who has since left the room added back.
+func (r *roomRepository) CreateDirectRoom(ctx context.Context, room *model.Room, members []model.RoomMember) (*model.Room, bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	created := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "direct_key"}},
+			DoNothing: true,
+		}).Create(room)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		for i := range members {
+			members[i].RoomID = room.ID
+			if err := tx.Create(&members[i]).Error; err != nil {
+				return err
+			}
+		}
+		created = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create direct room: %w", err)
+	}
+	if created {
+		return room, true, nil
+	}
+
+	var existing model.Room
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("direct_key = ?", room.DirectKey).First(&existing).Error; err != nil {
+			return err
+		}
+		for _, member := range members {
+			if err := restoreMember(tx, existing.ID, member); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get existing direct room: %w", err)
+	}
+	return &existing, false, nil
+}
+
+// restoreMember makes sure member belongs to the room, reviving a membership
+// that was soft deleted when the user left
+func restoreMember(tx *gorm.DB, roomID uuid.UUID, member model.RoomMember) error {
+	var current model.RoomMember
+	err := tx.Unscoped().
+		Where("room_id = ? AND user_id = ?", roomID, member.UserID).
+		Order("created_at DESC").
+		First(&current).Error
+	if err == gorm.ErrRecordNotFound {
+		member.ID = uuid.Nil
+		member.RoomID = roomID
+		return tx.Create(&member).Error
+	}
+	if err != nil {
+		return err
+	}
+	if !current.DeletedAt.Valid {
+		return nil
+	}
+	return tx.Unscoped().Model(&current).Updates(map[string]interface{}{
+		"deleted_at": nil,
+		"joined_at":  member.JoinedAt,
+	}).Error
+}
+
+// AddMember adds the member unless the room has reached its MaxMembers
+// limit, in which case ErrRoomFull is returned
+func (r *roomRepository) AddMember(ctx context.Context, member *model.RoomMember) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return addMemberWithinLimit(tx, member)
+	})
+}
+
+// addMemberWithinLimit locks the room row before counting its members so
+// concurrent joins are serialized and cannot push the room past its limit
+func addMemberWithinLimit(tx *gorm.DB, member *model.RoomMember) error {
+	var room model.Room
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "max_members").
+		First(&room, "id = ?", member.RoomID).Error; err != nil {
+		return fmt.Errorf("failed to lock room: %w", err)
+	}
+
+	if room.MaxMembers > 0 {
+		var count int64
+		if err := tx.Model(&model.RoomMember{}).Where("room_id = ?", member.RoomID).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to count room members: %w", err)
+		}
+		if count >= int64(room.MaxMembers) {
+			return ErrRoomFull
+		}
+	}
+
+	if err := tx.Create(member).Error; err != nil {
+		return fmt.Errorf("failed to add room member: %w", err)
+	}
+	return nil
+}
+
+// RemoveMember removes the member along with their draft for the room
+func (r *roomRepository) RemoveMember(ctx context.Context, roomID, userID uuid.UUID) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&model.RoomMember{}, "room_id = ? AND user_id = ?", roomID, userID).Error; err != nil {
+			return fmt.Errorf("failed to remove room member: %w", err)
+		}
+		if err := tx.Unscoped().Delete(&model.MessageDraft{}, "room_id = ? AND user_id = ?", roomID, userID).Error; err != nil {
+			return fmt.Errorf("failed to delete message draft: %w", err)
+		}
+		return nil
+	})
+}
+
 func (r *roomRepository) GetRoomMembers(ctx context.Context, roomID uuid.UUID) ([]model.RoomMember, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var members []model.RoomMember
 	if err := r.db.WithContext(ctx).
 		Preload("User").
@@ -158,7 +532,99 @@ func (r *roomRepository) GetRoomMembers(ctx context.Context, roomID uuid.UUID) (
 	return members, nil
 }
 
+// ListRoomMembers returns a page of the members of a room in join order,
+// optionally only those with a role or whose username contains search, and
+// the total number of matching members
+func (r *roomRepository) ListRoomMembers(ctx context.Context, roomID uuid.UUID, role, search string, offset, limit int) ([]model.RoomMember, int64, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	query := r.db.WithContext(ctx).Model(&model.RoomMember{}).Where("room_members.room_id = ?", roomID)
+	if role != "" {
+		query = query.Where("room_members.role = ?", role)
+	}
+	if search != "" {
+		query = query.
+			Joins("JOIN users ON users.id = room_members.user_id").
+			Where("users.username ILIKE ?", "%"+search+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count room members: %w", err)
+	}
+
+	var members []model.RoomMember
+	if err := query.
+		Preload("User").
+		Order("room_members.joined_at ASC, room_members.id ASC").
+		Offset(offset).
+		Limit(limit).
+		Find(&members).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list room members: %w", err)
+	}
+	return members, total, nil
+}
+
+// SearchMembersByUsername returns the members of a room whose username
+// starts with prefix, ignoring case, in username order with their profiles
+func (r *roomRepository) SearchMembersByUsername(ctx context.Context, roomID uuid.UUID, prefix string, limit int) ([]model.RoomMember, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(prefix))
+
+	var members []model.RoomMember
+	if err := r.db.WithContext(ctx).
+		Joins("JOIN users ON users.id = room_members.user_id").
+		Where("room_members.room_id = ?", roomID).
+		Where(`LOWER(users.username) LIKE ? ESCAPE '\'`, escaped+"%").
+		Preload("User.Profile").
+		Order("LOWER(users.username) ASC").
+		Limit(limit).
+		Find(&members).Error; err != nil {
+		return nil, fmt.Errorf("failed to search room members: %w", err)
+	}
+	return members, nil
+}
+
+// CountMembers counts the members of a room
+func (r *roomRepository) CountMembers(ctx context.Context, roomID uuid.UUID) (int64, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&model.RoomMember{}).
+		Where("room_id = ?", roomID).
+		Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count room members: %w", err)
+	}
+	return count, nil
+}
+
+// GetMember returns the membership of a user in a room, nil if they aren't a
+// member
+func (r *roomRepository) GetMember(ctx context.Context, roomID, userID uuid.UUID) (*model.RoomMember, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var member model.RoomMember
+	if err := r.db.WithContext(ctx).
+		Preload("User").
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		First(&member).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get room member: %w", err)
+	}
+	return &member, nil
+}
+
 func (r *roomRepository) UpdateMemberRole(ctx context.Context, roomID, userID uuid.UUID, role string) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
 	if err := r.db.WithContext(ctx).Model(&model.RoomMember{}).
 		Where("room_id = ? AND user_id = ?", roomID, userID).
 		Update("role", role).Error; err != nil {
@@ -167,7 +633,82 @@ func (r *roomRepository) UpdateMemberRole(ctx context.Context, roomID, userID uu
 	return nil
 }
 
+// TransferOwnership makes newOwnerID the creator and owner of the room and
+// demotes the old owner to admin
+func (r *roomRepository) TransferOwnership(ctx context.Context, roomID, oldOwnerID, newOwnerID uuid.UUID) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Room{}).Where("id = ?", roomID).Update("created_by", newOwnerID).Error; err != nil {
+			return fmt.Errorf("failed to update room owner: %w", err)
+		}
+		if err := tx.Model(&model.RoomMember{}).
+			Where("room_id = ? AND user_id = ?", roomID, oldOwnerID).
+			Update("role", "admin").Error; err != nil {
+			return fmt.Errorf("failed to demote old owner: %w", err)
+		}
+		if err := tx.Model(&model.RoomMember{}).
+			Where("room_id = ? AND user_id = ?", roomID, newOwnerID).
+			Update("role", "owner").Error; err != nil {
+			return fmt.Errorf("failed to promote new owner: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *roomRepository) SetMemberArchived(ctx context.Context, roomID, userID uuid.UUID, archived bool) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Model(&model.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Update("is_archived", archived).Error; err != nil {
+		return fmt.Errorf("failed to update member archive state: %w", err)
+	}
+	return nil
+}
+
+func (r *roomRepository) SetRoomArchived(ctx context.Context, roomID uuid.UUID, archived bool) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Model(&model.Room{}).
+		Where("id = ?", roomID).
+		Update("is_archived", archived).Error; err != nil {
+		return fmt.Errorf("failed to update room archive state: %w", err)
+	}
+	return nil
+}
+
+func (r *roomRepository) SetMemberNotificationLevel(ctx context.Context, roomID, userID uuid.UUID, level model.NotificationLevel) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Model(&model.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Update("notification_level", level).Error; err != nil {
+		return fmt.Errorf("failed to update member notification level: %w", err)
+	}
+	return nil
+}
+
+func (r *roomRepository) SetMemberMuted(ctx context.Context, roomID, userID uuid.UUID, muted bool, until *time.Time) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Model(&model.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Updates(map[string]interface{}{"is_muted": muted, "muted_until": until}).Error; err != nil {
+		return fmt.Errorf("failed to update member mute state: %w", err)
+	}
+	return nil
+}
+
 func (r *roomRepository) IsUserInRoom(ctx context.Context, roomID, userID uuid.UUID) (bool, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var count int64
 	if err := r.db.WithContext(ctx).Model(&model.RoomMember{}).
 		Where("room_id = ? AND user_id = ?", roomID, userID).
@@ -177,7 +718,26 @@ func (r *roomRepository) IsUserInRoom(ctx context.Context, roomID, userID uuid.U
 	return count > 0, nil
 }
 
+// AdvanceReadCursor moves the member's last read position forward to readAt.
+// It never moves the cursor back and reports whether it changed.
+func (r *roomRepository) AdvanceReadCursor(ctx context.Context, roomID, userID uuid.UUID, readAt time.Time) (bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	result := r.db.WithContext(ctx).Model(&model.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Where("last_read_at IS NULL OR last_read_at < ?", readAt).
+		Update("last_read_at", readAt)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update read cursor: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
 func (r *roomRepository) CreateInvite(ctx context.Context, invite *model.RoomInvite) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
 	if err := r.db.WithContext(ctx).Create(invite).Error; err != nil {
 		return fmt.Errorf("failed to create room invite: %w", err)
 	}
@@ -185,6 +745,9 @@ func (r *roomRepository) CreateInvite(ctx context.Context, invite *model.RoomInv
 }
 
 func (r *roomRepository) GetInviteByCode(ctx context.Context, code string) (*model.RoomInvite, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var invite model.RoomInvite
 	if err := r.db.WithContext(ctx).
 		Preload("Room").
@@ -199,20 +762,390 @@ func (r *roomRepository) GetInviteByCode(ctx context.Context, code string) (*mod
 	return &invite, nil
 }
 
-func (r *roomRepository) AcceptInvite(ctx context.Context, inviteID uuid.UUID) error {
-	if err := r.db.WithContext(ctx).Model(&model.RoomInvite{}).
-		Where("id = ?", inviteID).
-		Update("status", "accepted").Error; err != nil {
-		return fmt.Errorf("failed to accept invite: %w", err)
+// GetRoomInvites returns the invites of a room, newest first
+func (r *roomRepository) GetRoomInvites(ctx context.Context, roomID uuid.UUID) ([]model.RoomInvite, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var invites []model.RoomInvite
+	if err := r.db.WithContext(ctx).
+		Preload("Inviter").
+		Preload("Invitee").
+		Where("room_id = ?", roomID).
+		Order("created_at DESC").
+		Find(&invites).Error; err != nil {
+		return nil, fmt.Errorf("failed to get room invites: %w", err)
+	}
+	return invites, nil
+}
+
+// AcceptInvite uses up the invite and adds the member in one transaction.
+// It reports false when the invite was revoked, answered or used up in the
+// meantime. Direct invites are marked accepted, shareable ones stay pending.
+func (r *roomRepository) AcceptInvite(ctx context.Context, invite *model.RoomInvite, member *model.RoomMember) (bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	status := model.InviteStatusPending
+	if invite.InviteeID != nil {
+		status = model.InviteStatusAccepted
+	}
+
+	accepted := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.RoomInvite{}).
+			Where("id = ? AND status = ? AND (max_uses = 0 OR used_count < max_uses)", invite.ID, model.InviteStatusPending).
+			Updates(map[string]interface{}{
+				"used_count":   gorm.Expr("used_count + 1"),
+				"status":       status,
+				"responded_at": time.Now(),
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to use invite: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		if err := addMemberWithinLimit(tx, member); err != nil {
+			return err
+		}
+		accepted = true
+		return nil
+	})
+	return accepted, err
+}
+
+// RejectInvite marks a pending invite rejected. It reports false when the
+// invite was no longer pending.
+func (r *roomRepository) RejectInvite(ctx context.Context, inviteID uuid.UUID) (bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	result := r.db.WithContext(ctx).Model(&model.RoomInvite{}).
+		Where("id = ? AND status = ?", inviteID, model.InviteStatusPending).
+		Updates(map[string]interface{}{
+			"status":       model.InviteStatusRejected,
+			"responded_at": time.Now(),
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to reject invite: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// RevokeInvite expires a pending invite of the room. It reports false when
+// there was no such invite.
+func (r *roomRepository) RevokeInvite(ctx context.Context, roomID, inviteID uuid.UUID) (bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	result := r.db.WithContext(ctx).Model(&model.RoomInvite{}).
+		Where("id = ? AND room_id = ? AND status = ?", inviteID, roomID, model.InviteStatusPending).
+		Update("status", model.InviteStatusExpired)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to revoke invite: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *roomRepository) GetJoinRequest(ctx context.Context, roomID, userID uuid.UUID) (*model.RoomJoinRequest, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var request model.RoomJoinRequest
+	if err := r.db.WithContext(ctx).First(&request, "room_id = ? AND user_id = ?", roomID, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get join request: %w", err)
+	}
+	return &request, nil
+}
+
+func (r *roomRepository) GetJoinRequestByID(ctx context.Context, id uuid.UUID) (*model.RoomJoinRequest, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var request model.RoomJoinRequest
+	if err := r.db.WithContext(ctx).First(&request, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get join request: %w", err)
+	}
+	return &request, nil
+}
+
+// SaveJoinRequest creates a pending join request, reopening an earlier
+// request of the same user for the room
+func (r *roomRepository) SaveJoinRequest(ctx context.Context, request *model.RoomJoinRequest) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "room_id"}, {Name: "user_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"status":       request.Status,
+				"requested_at": request.RequestedAt,
+				"responded_at": nil,
+				"responded_by": nil,
+				"updated_at":   time.Now(),
+			}),
+		}).
+		Create(request).Error; err != nil {
+		return fmt.Errorf("failed to save join request: %w", err)
 	}
 	return nil
 }
 
-func (r *roomRepository) RejectInvite(ctx context.Context, inviteID uuid.UUID) error {
-	if err := r.db.WithContext(ctx).Model(&model.RoomInvite{}).
-		Where("id = ?", inviteID).
-		Update("status", "rejected").Error; err != nil {
-		return fmt.Errorf("failed to reject invite: %w", err)
+// GetPendingJoinRequests returns the unanswered requests of a room, oldest first
+func (r *roomRepository) GetPendingJoinRequests(ctx context.Context, roomID uuid.UUID) ([]model.RoomJoinRequest, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var requests []model.RoomJoinRequest
+	if err := r.db.WithContext(ctx).
+		Preload("User").
+		Where("room_id = ? AND status = ?", roomID, model.JoinRequestPending).
+		Order("requested_at ASC").
+		Find(&requests).Error; err != nil {
+		return nil, fmt.Errorf("failed to get join requests: %w", err)
+	}
+	return requests, nil
+}
+
+// ApproveJoinRequest marks a pending request approved and adds the member in
+// one transaction. It reports false when the request was no longer pending
+// and leaves the request pending when the room is full.
+func (r *roomRepository) ApproveJoinRequest(ctx context.Context, request *model.RoomJoinRequest, respondedBy uuid.UUID, member *model.RoomMember) (bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	approved := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		ok, err := respondToJoinRequest(tx, request, model.JoinRequestApproved, respondedBy)
+		if err != nil || !ok {
+			return err
+		}
+		if err := addMemberWithinLimit(tx, member); err != nil {
+			return err
+		}
+		approved = true
+		return nil
+	})
+	return approved, err
+}
+
+// RejectJoinRequest marks a pending request rejected. It reports false when
+// the request was no longer pending.
+func (r *roomRepository) RejectJoinRequest(ctx context.Context, request *model.RoomJoinRequest, respondedBy uuid.UUID) (bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	return respondToJoinRequest(r.db.WithContext(ctx), request, model.JoinRequestRejected, respondedBy)
+}
+
+func respondToJoinRequest(db *gorm.DB, request *model.RoomJoinRequest, status string, respondedBy uuid.UUID) (bool, error) {
+	now := time.Now()
+	result := db.Model(&model.RoomJoinRequest{}).
+		Where("id = ? AND status = ?", request.ID, model.JoinRequestPending).
+		Updates(map[string]interface{}{
+			"status":       status,
+			"responded_at": now,
+			"responded_by": respondedBy,
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update join request: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	request.Status = status
+	request.RespondedAt = &now
+	request.RespondedBy = &respondedBy
+	return true, nil
+}
+
+// BanUser removes the user from the room and records the ban in one
+// transaction. Banning an already banned user replaces the earlier ban.
+func (r *roomRepository) BanUser(ctx context.Context, ban *model.RoomBan) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&model.RoomMember{}, "room_id = ? AND user_id = ?", ban.RoomID, ban.UserID).Error; err != nil {
+			return fmt.Errorf("failed to remove room member: %w", err)
+		}
+		if err := tx.Unscoped().Delete(&model.MessageDraft{}, "room_id = ? AND user_id = ?", ban.RoomID, ban.UserID).Error; err != nil {
+			return fmt.Errorf("failed to delete message draft: %w", err)
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "room_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"banned_by", "reason", "expires_at", "updated_at"}),
+		}).Create(ban).Error; err != nil {
+			return fmt.Errorf("failed to ban user: %w", err)
+		}
+		return nil
+	})
+}
+
+// UnbanUser lifts the ban of the user. It reports false when there was none.
+func (r *roomRepository) UnbanUser(ctx context.Context, roomID, userID uuid.UUID) (bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	result := r.db.WithContext(ctx).Unscoped().Delete(&model.RoomBan{}, "room_id = ? AND user_id = ?", roomID, userID)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to unban user: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetActiveBan returns the ban of the user, ignoring expired bans
+func (r *roomRepository) GetActiveBan(ctx context.Context, roomID, userID uuid.UUID) (*model.RoomBan, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var ban model.RoomBan
+	if err := r.db.WithContext(ctx).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		First(&ban).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get room ban: %w", err)
+	}
+	return &ban, nil
+}
+
+// GetActiveBans lists the bans of a room that have not expired
+func (r *roomRepository) GetActiveBans(ctx context.Context, roomID uuid.UUID) ([]model.RoomBan, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var bans []model.RoomBan
+	if err := r.db.WithContext(ctx).
+		Preload("User").
+		Where("room_id = ?", roomID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("created_at DESC").
+		Find(&bans).Error; err != nil {
+		return nil, fmt.Errorf("failed to get room bans: %w", err)
+	}
+	return bans, nil
+}
+
+func (r *roomRepository) CreateWebhook(ctx context.Context, webhook *model.RoomWebhook) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Create(webhook).Error; err != nil {
+		return fmt.Errorf("failed to create room webhook: %w", err)
 	}
 	return nil
 }
+
+// DeleteWebhook removes a webhook of a room, reporting whether it existed
+func (r *roomRepository) DeleteWebhook(ctx context.Context, roomID, webhookID uuid.UUID) (bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	result := r.db.WithContext(ctx).
+		Where("id = ? AND room_id = ?", webhookID, roomID).
+		Delete(&model.RoomWebhook{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to delete room webhook: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetWebhooks lists the webhooks of a room, oldest first
+func (r *roomRepository) GetWebhooks(ctx context.Context, roomID uuid.UUID, activeOnly bool) ([]model.RoomWebhook, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	query := r.db.WithContext(ctx).Where("room_id = ?", roomID)
+	if activeOnly {
+		query = query.Where("is_active = ?", true)
+	}
+
+	var webhooks []model.RoomWebhook
+	if err := query.Order("created_at ASC").Find(&webhooks).Error; err != nil {
+		return nil, fmt.Errorf("failed to get room webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// GetMessageCounts counts the messages of a room, in total and sent within
+// the last 24 hours, 7 days and 30 days before now, and the distinct senders
+// of the last 7 days. Deleted messages are not counted.
+func (r *roomRepository) GetMessageCounts(ctx context.Context, roomID uuid.UUID, now time.Time) (*model.RoomMessageCounts, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	day, week, month := now.Add(-24*time.Hour), now.Add(-7*24*time.Hour), now.Add(-30*24*time.Hour)
+
+	var counts model.RoomMessageCounts
+	if err := r.db.WithContext(ctx).
+		Model(&model.Message{}).
+		Select(`COUNT(*) AS total,
+			COUNT(CASE WHEN created_at >= ? THEN 1 END) AS last24h,
+			COUNT(CASE WHEN created_at >= ? THEN 1 END) AS last7d,
+			COUNT(CASE WHEN created_at >= ? THEN 1 END) AS last30d,
+			COUNT(DISTINCT CASE WHEN created_at >= ? THEN sender_id END) AS active_senders7d`,
+			day, week, month, week).
+		Where("room_id = ? AND is_deleted = ?", roomID, false).
+		Scan(&counts).Error; err != nil {
+		return nil, fmt.Errorf("failed to count room messages: %w", err)
+	}
+	return &counts, nil
+}
+
+// CountMembersByRole counts the members of a room per role
+func (r *roomRepository) CountMembersByRole(ctx context.Context, roomID uuid.UUID) (map[string]int64, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var rows []struct {
+		Role    string
+		Members int64
+	}
+	if err := r.db.WithContext(ctx).
+		Model(&model.RoomMember{}).
+		Select("role, COUNT(*) AS members").
+		Where("room_id = ?", roomID).
+		Group("role").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count room members: %w", err)
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Role] = row.Members
+	}
+	return counts, nil
+}
+
+// GetTopReactions returns the emoji most used to react to the messages of a
+// room, most used first
+func (r *roomRepository) GetTopReactions(ctx context.Context, roomID uuid.UUID, limit int) ([]model.ReactionCount, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var reactions []model.ReactionCount
+	if err := r.db.WithContext(ctx).
+		Model(&model.MessageReaction{}).
+		Select("message_reactions.emoji AS emoji, COUNT(*) AS count").
+		Joins("JOIN messages ON messages.id = message_reactions.message_id AND messages.deleted_at IS NULL").
+		Where("messages.room_id = ?", roomID).
+		Group("message_reactions.emoji").
+		Order("count DESC, emoji").
+		Limit(limit).
+		Scan(&reactions).Error; err != nil {
+		return nil, fmt.Errorf("failed to count room reactions: %w", err)
+	}
+	return reactions, nil
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"realtime-api/internal/database"
+	"realtime-api/internal/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *model.UserSession) error
+	GetByID(ctx context.Context, id uuid.UUID) (*model.UserSession, error)
+	GetActiveByUserID(ctx context.Context, userID uuid.UUID) ([]model.UserSession, error)
+	UpdateAccessToken(ctx context.Context, id uuid.UUID, accessToken string) error
+	Deactivate(ctx context.Context, id uuid.UUID) error
+	UpdateFCMToken(ctx context.Context, id uuid.UUID, token string) error
+	ClearFCMToken(ctx context.Context, token string) error
+}
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository() SessionRepository {
+	return &sessionRepository{
+		db: database.GetDB(),
+	}
+}
+
+func (r *sessionRepository) Create(ctx context.Context, session *model.UserSession) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Create(session).Error; err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+func (r *sessionRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.UserSession, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var session model.UserSession
+	if err := r.db.WithContext(ctx).First(&session, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get session by ID: %w", err)
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) GetActiveByUserID(ctx context.Context, userID uuid.UUID) ([]model.UserSession, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var sessions []model.UserSession
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ? AND is_active = ? AND expires_at > ?", userID, true, time.Now()).
+		Order("created_at DESC").
+		Find(&sessions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get active sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+func (r *sessionRepository) UpdateAccessToken(ctx context.Context, id uuid.UUID, accessToken string) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Model(&model.UserSession{}).
+		Where("id = ?", id).
+		Update("access_token", accessToken).Error; err != nil {
+		return fmt.Errorf("failed to update session access token: %w", err)
+	}
+	return nil
+}
+
+func (r *sessionRepository) Deactivate(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	// The device stops receiving push notifications with the session
+	if err := r.db.WithContext(ctx).Model(&model.UserSession{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"is_active": false, "fcm_token": ""}).Error; err != nil {
+		return fmt.Errorf("failed to deactivate session: %w", err)
+	}
+	return nil
+}
+
+// UpdateFCMToken sets the push notification token of a session. A device
+// has one token, so it is removed from the device's older sessions.
+func (r *sessionRepository) UpdateFCMToken(ctx context.Context, id uuid.UUID, token string) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.UserSession{}).
+			Where("fcm_token = ? AND id <> ?", token, id).
+			Update("fcm_token", "").Error; err != nil {
+			return fmt.Errorf("failed to clear FCM token: %w", err)
+		}
+		if err := tx.Model(&model.UserSession{}).
+			Where("id = ?", id).
+			Update("fcm_token", token).Error; err != nil {
+			return fmt.Errorf("failed to update FCM token: %w", err)
+		}
+		return nil
+	})
+}
+
+// ClearFCMToken removes a token Firebase no longer accepts
+func (r *sessionRepository) ClearFCMToken(ctx context.Context, token string) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Model(&model.UserSession{}).
+		Where("fcm_token = ?", token).
+		Update("fcm_token", "").Error; err != nil {
+		return fmt.Errorf("failed to clear FCM token: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"realtime-api/internal/database"
+	"realtime-api/internal/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type UserPreferencesRepository interface {
+	GetOrCreate(ctx context.Context, userID uuid.UUID) (*model.UserPreferences, error)
+	Update(ctx context.Context, prefs *model.UserPreferences) error
+}
+
+type userPreferencesRepository struct {
+	db *gorm.DB
+}
+
+func NewUserPreferencesRepository() UserPreferencesRepository {
+	return &userPreferencesRepository{
+		db: database.GetDB(),
+	}
+}
+
+// GetOrCreate returns the preferences of a user, storing the defaults the
+// first time
+func (r *userPreferencesRepository) GetOrCreate(ctx context.Context, userID uuid.UUID) (*model.UserPreferences, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	prefs, err := r.getByUserID(ctx, userID)
+	if err != nil || prefs != nil {
+		return prefs, err
+	}
+
+	// Another request may create them first
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "user_id"}}, DoNothing: true}).
+		Create(model.DefaultUserPreferences(userID)).Error; err != nil {
+		return nil, fmt.Errorf("failed to create user preferences: %w", err)
+	}
+
+	prefs, err = r.getByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if prefs == nil {
+		return nil, fmt.Errorf("failed to create user preferences")
+	}
+	return prefs, nil
+}
+
+// Update saves every field of prefs, including false and empty values
+func (r *userPreferencesRepository) Update(ctx context.Context, prefs *model.UserPreferences) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Omit("User").Save(prefs).Error; err != nil {
+		return fmt.Errorf("failed to update user preferences: %w", err)
+	}
+	return nil
+}
+
+func (r *userPreferencesRepository) getByUserID(ctx context.Context, userID uuid.UUID) (*model.UserPreferences, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var prefs model.UserPreferences
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&prefs).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user preferences: %w", err)
+	}
+	return &prefs, nil
+}
@@ -17,17 +17,34 @@ type UserRepository interface {
 	GetByID(ctx context.Context, id uuid.UUID) (*model.User, error)
 	GetByEmail(ctx context.Context, email string) (*model.User, error)
 	GetByUsername(ctx context.Context, username string) (*model.User, error)
+	GetByUsernames(ctx context.Context, usernames []string) ([]model.User, error)
+	GetByIDs(ctx context.Context, ids []uuid.UUID) ([]model.User, error)
 	Update(ctx context.Context, user *model.User) error
 	Delete(ctx context.Context, id uuid.UUID) error
 	List(ctx context.Context, offset, limit int) ([]*model.User, int64, error)
+	Search(ctx context.Context, query string, filters model.UserSearchFilter, offset, limit int) ([]*model.User, int64, error)
 	UpdateLastSeen(ctx context.Context, userID uuid.UUID) error
 	UpdateStatus(ctx context.Context, userID uuid.UUID, status model.UserStatus) error
+	UpdatePassword(ctx context.Context, userID uuid.UUID, hashedPassword string) error
+	UpdateActive(ctx context.Context, userID uuid.UUID, active bool) error
+	UpdateSettings(ctx context.Context, userID uuid.UUID, settings *model.UserSettings) error
+	UpdateTOTP(ctx context.Context, userID uuid.UUID, secret string, enabled bool) error
+	UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error)
 	GetUserProfile(ctx context.Context, userID uuid.UUID) (*model.UserProfile, error)
 	CreateOrUpdateProfile(ctx context.Context, profile *model.UserProfile) error
-	GetUserContacts(ctx context.Context, userID uuid.UUID) ([]model.UserContact, error)
+	GetUserContacts(ctx context.Context, userID uuid.UUID, status model.ContactStatus) ([]model.UserContact, error)
 	AddContact(ctx context.Context, contact *model.UserContact) error
 	RemoveContact(ctx context.Context, userID, contactID uuid.UUID) error
 	UpdateContactStatus(ctx context.Context, userID, contactID uuid.UUID, status model.ContactStatus) error
+	UpdateContactDetails(ctx context.Context, id uuid.UUID, fields map[string]interface{}) error
+	GetContact(ctx context.Context, userID, contactID uuid.UUID) (*model.UserContact, error)
+	GetContactByID(ctx context.Context, id uuid.UUID) (*model.UserContact, error)
+	GetPendingContactRequests(ctx context.Context, userID uuid.UUID) ([]model.UserContact, error)
+	AcceptContact(ctx context.Context, contact *model.UserContact) error
+	CreateBlock(ctx context.Context, block *model.UserBlock) (bool, error)
+	DeleteBlock(ctx context.Context, blockerID, blockedID uuid.UUID) (bool, error)
+	GetBlocks(ctx context.Context, blockerID uuid.UUID) ([]model.UserBlock, error)
+	GetBlockedUserIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
 }
 
 type userRepository struct {
@@ -41,6 +58,9 @@ func NewUserRepository() UserRepository {
 }
 
 func (r *userRepository) Create(ctx context.Context, user *model.User) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
 	if err := r.db.WithContext(ctx).Create(user).Error; err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
 	}
@@ -48,6 +68,9 @@ func (r *userRepository) Create(ctx context.Context, user *model.User) error {
 }
 
 func (r *userRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var user model.User
 	if err := r.db.WithContext(ctx).First(&user, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -59,6 +82,9 @@ func (r *userRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User
 }
 
 func (r *userRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var user model.User
 	if err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -70,6 +96,9 @@ func (r *userRepository) GetByEmail(ctx context.Context, email string) (*model.U
 }
 
 func (r *userRepository) GetByUsername(ctx context.Context, username string) (*model.User, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var user model.User
 	if err := r.db.WithContext(ctx).Where("username = ?", username).First(&user).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -80,14 +109,56 @@ func (r *userRepository) GetByUsername(ctx context.Context, username string) (*m
 	return &user, nil
 }
 
+func (r *userRepository) GetByUsernames(ctx context.Context, usernames []string) ([]model.User, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var users []model.User
+	if len(usernames) == 0 {
+		return users, nil
+	}
+
+	if err := r.db.WithContext(ctx).Where("username IN ?", usernames).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to get users by username: %w", err)
+	}
+	return users, nil
+}
+
+func (r *userRepository) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]model.User, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var users []model.User
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	if err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to get users by ID: %w", err)
+	}
+	return users, nil
+}
+
+// Update writes the account fields of user. Password, two-factor secret and
+// settings have their own methods, so a stale copy of the user can't
+// overwrite them.
 func (r *userRepository) Update(ctx context.Context, user *model.User) error {
-	if err := r.db.WithContext(ctx).Save(user).Error; err != nil {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	err := r.db.WithContext(ctx).Model(user).
+		Select("username", "email", "first_name", "last_name", "avatar", "phone_number", "bio", "is_active", "is_verified").
+		Updates(user).Error
+	if err != nil {
 		return fmt.Errorf("failed to update user: %w", err)
 	}
 	return nil
 }
 
 func (r *userRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
 	if err := r.db.WithContext(ctx).Delete(&model.User{}, "id = ?", id).Error; err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
@@ -95,6 +166,9 @@ func (r *userRepository) Delete(ctx context.Context, id uuid.UUID) error {
 }
 
 func (r *userRepository) List(ctx context.Context, offset, limit int) ([]*model.User, int64, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var users []*model.User
 	var total int64
 
@@ -111,7 +185,70 @@ func (r *userRepository) List(ctx context.Context, offset, limit int) ([]*model.
 	return users, total, nil
 }
 
+func (r *userRepository) Search(ctx context.Context, query string, filters model.UserSearchFilter, offset, limit int) ([]*model.User, int64, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var users []*model.User
+	var total int64
+
+	pattern := "%" + query + "%"
+	searchQuery := r.db.WithContext(ctx).Model(&model.User{}).
+		Where("(username ILIKE ? OR first_name ILIKE ? OR last_name ILIKE ? OR email ILIKE ?)",
+			pattern, pattern, pattern, pattern).
+		Where("users.id != ?", filters.RequesterID).
+		Where("NOT EXISTS (?)",
+			r.db.Table("user_blocks").
+				Select("1").
+				Where("user_blocks.blocker_id = users.id AND user_blocks.blocked_id = ? AND user_blocks.deleted_at IS NULL", filters.RequesterID),
+		).
+		Where("NOT EXISTS (?)",
+			r.db.Table("user_contacts").
+				Select("1").
+				Where("user_contacts.user_id = users.id AND user_contacts.contact_id = ? AND user_contacts.status = ? AND user_contacts.deleted_at IS NULL",
+					filters.RequesterID, model.ContactStatusBlocked),
+		)
+
+	if filters.IsActive != nil {
+		searchQuery = searchQuery.Where("is_active = ?", *filters.IsActive)
+	}
+	if filters.Status == string(model.UserStatusOffline) {
+		// Invisible users and users hiding their status appear offline to
+		// everyone else
+		searchQuery = searchQuery.Where("(status IN ? OR show_online_status = ?)",
+			[]string{string(model.UserStatusOffline), string(model.UserStatusInvisible)}, false)
+	} else if filters.Status != "" {
+		searchQuery = searchQuery.Where("status = ? AND show_online_status = ?", filters.Status, true)
+	}
+	if filters.HasContact != nil {
+		contacts := r.db.Table("user_contacts").
+			Select("1").
+			Where("user_contacts.user_id = ? AND user_contacts.contact_id = users.id AND user_contacts.status = ? AND user_contacts.deleted_at IS NULL",
+				filters.RequesterID, model.ContactStatusAccepted)
+		if *filters.HasContact {
+			searchQuery = searchQuery.Where("EXISTS (?)", contacts)
+		} else {
+			searchQuery = searchQuery.Where("NOT EXISTS (?)", contacts)
+		}
+	}
+
+	// Count total records
+	if err := searchQuery.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count search users: %w", err)
+	}
+
+	// Get paginated results
+	if err := searchQuery.Order("username ASC").Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to search users: %w", err)
+	}
+
+	return users, total, nil
+}
+
 func (r *userRepository) UpdateLastSeen(ctx context.Context, userID uuid.UUID) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
 	if err := r.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", userID).Update("last_seen", time.Now()).Error; err != nil {
 		return fmt.Errorf("failed to update last seen: %w", err)
 	}
@@ -119,13 +256,95 @@ func (r *userRepository) UpdateLastSeen(ctx context.Context, userID uuid.UUID) e
 }
 
 func (r *userRepository) UpdateStatus(ctx context.Context, userID uuid.UUID, status model.UserStatus) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
 	if err := r.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", userID).Update("status", status).Error; err != nil {
 		return fmt.Errorf("failed to update status: %w", err)
 	}
 	return nil
 }
 
+func (r *userRepository) UpdateActive(ctx context.Context, userID uuid.UUID, active bool) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", userID).Update("is_active", active).Error; err != nil {
+		return fmt.Errorf("failed to update active state: %w", err)
+	}
+	return nil
+}
+
+// UpdateSettings writes only the settings columns, leaving the rest of the
+// user row alone
+func (r *userRepository) UpdateSettings(ctx context.Context, userID uuid.UUID, settings *model.UserSettings) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	err := r.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"language":               settings.Language,
+		"timezone":               settings.Timezone,
+		"notification_sound":     settings.NotificationSound,
+		"email_notifications":    settings.EmailNotifications,
+		"push_notifications":     settings.PushNotifications,
+		"show_online_status":     settings.ShowOnlineStatus,
+		"show_read_receipts":     settings.ShowReadReceipts,
+		"allow_direct_messages":  settings.AllowDirectMessages,
+		"auto_join_public_rooms": settings.AutoJoinPublicRooms,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update settings: %w", err)
+	}
+	return nil
+}
+
+func (r *userRepository) UpdatePassword(ctx context.Context, userID uuid.UUID, hashedPassword string) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", userID).Update("password", hashedPassword).Error; err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	return nil
+}
+
+func (r *userRepository) UpdateTOTP(ctx context.Context, userID uuid.UUID, secret string, enabled bool) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	// Codes of a new secret may share the step of the last code accepted
+	// for the old one
+	err := r.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_enabled":   enabled,
+		"totp_last_step": gorm.Expr("CASE WHEN totp_secret = ? THEN totp_last_step ELSE 0 END", secret),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update two-factor settings: %w", err)
+	}
+	return nil
+}
+
+// UseTOTPStep records step as the time step of the user's last accepted
+// two-factor code, reporting false when a code of the same or a later step
+// was already accepted
+func (r *userRepository) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	result := r.db.WithContext(ctx).Model(&model.User{}).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to record two-factor code: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
 func (r *userRepository) GetUserProfile(ctx context.Context, userID uuid.UUID) (*model.UserProfile, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var profile model.UserProfile
 	if err := r.db.WithContext(ctx).First(&profile, "user_id = ?", userID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -137,21 +356,36 @@ func (r *userRepository) GetUserProfile(ctx context.Context, userID uuid.UUID) (
 }
 
 func (r *userRepository) CreateOrUpdateProfile(ctx context.Context, profile *model.UserProfile) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
 	if err := r.db.WithContext(ctx).Save(profile).Error; err != nil {
 		return fmt.Errorf("failed to save user profile: %w", err)
 	}
 	return nil
 }
 
-func (r *userRepository) GetUserContacts(ctx context.Context, userID uuid.UUID) ([]model.UserContact, error) {
+// GetUserContacts lists the contacts of userID, optionally only those with
+// the given status
+func (r *userRepository) GetUserContacts(ctx context.Context, userID uuid.UUID, status model.ContactStatus) ([]model.UserContact, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
 	var contacts []model.UserContact
-	if err := r.db.WithContext(ctx).Preload("Contact").Where("user_id = ?", userID).Find(&contacts).Error; err != nil {
+	query := r.db.WithContext(ctx).Preload("Contact").Where("user_id = ?", userID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Order("created_at DESC").Find(&contacts).Error; err != nil {
 		return nil, fmt.Errorf("failed to get user contacts: %w", err)
 	}
 	return contacts, nil
 }
 
 func (r *userRepository) AddContact(ctx context.Context, contact *model.UserContact) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
 	if err := r.db.WithContext(ctx).Create(contact).Error; err != nil {
 		return fmt.Errorf("failed to add contact: %w", err)
 	}
@@ -159,6 +393,9 @@ func (r *userRepository) AddContact(ctx context.Context, contact *model.UserCont
 }
 
 func (r *userRepository) RemoveContact(ctx context.Context, userID, contactID uuid.UUID) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
 	if err := r.db.WithContext(ctx).Delete(&model.UserContact{}, "user_id = ? AND contact_id = ?", userID, contactID).Error; err != nil {
 		return fmt.Errorf("failed to remove contact: %w", err)
 	}
@@ -166,6 +403,9 @@ func (r *userRepository) RemoveContact(ctx context.Context, userID, contactID uu
 }
 
 func (r *userRepository) UpdateContactStatus(ctx context.Context, userID, contactID uuid.UUID, status model.ContactStatus) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
 	if err := r.db.WithContext(ctx).Model(&model.UserContact{}).
 		Where("user_id = ? AND contact_id = ?", userID, contactID).
 		Update("status", status).Error; err != nil {
@@ -173,3 +413,169 @@ func (r *userRepository) UpdateContactStatus(ctx context.Context, userID, contac
 	}
 	return nil
 }
+
+func (r *userRepository) UpdateContactDetails(ctx context.Context, id uuid.UUID, fields map[string]interface{}) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	if err := r.db.WithContext(ctx).Model(&model.UserContact{}).Where("id = ?", id).Updates(fields).Error; err != nil {
+		return fmt.Errorf("failed to update contact: %w", err)
+	}
+	return nil
+}
+
+func (r *userRepository) GetContact(ctx context.Context, userID, contactID uuid.UUID) (*model.UserContact, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var contact model.UserContact
+	if err := r.db.WithContext(ctx).First(&contact, "user_id = ? AND contact_id = ?", userID, contactID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get contact: %w", err)
+	}
+	return &contact, nil
+}
+
+func (r *userRepository) GetContactByID(ctx context.Context, id uuid.UUID) (*model.UserContact, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var contact model.UserContact
+	if err := r.db.WithContext(ctx).First(&contact, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get contact by ID: %w", err)
+	}
+	return &contact, nil
+}
+
+// GetPendingContactRequests returns the requests other users sent to userID
+// that are still awaiting an answer, newest first
+func (r *userRepository) GetPendingContactRequests(ctx context.Context, userID uuid.UUID) ([]model.UserContact, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var requests []model.UserContact
+	if err := r.db.WithContext(ctx).
+		Preload("User").
+		Where("contact_id = ? AND status = ?", userID, model.ContactStatusPending).
+		Order("created_at DESC").
+		Find(&requests).Error; err != nil {
+		return nil, fmt.Errorf("failed to get pending contact requests: %w", err)
+	}
+	return requests, nil
+}
+
+// AcceptContact accepts a pending request and records the contact on the
+// accepting side as well, so both users list each other
+func (r *userRepository) AcceptContact(ctx context.Context, contact *model.UserContact) error {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.UserContact{}).Where("id = ?", contact.ID).
+			Update("status", model.ContactStatusAccepted).Error; err != nil {
+			return fmt.Errorf("failed to accept contact: %w", err)
+		}
+
+		var reverse model.UserContact
+		err := tx.Where("user_id = ? AND contact_id = ?", contact.ContactID, contact.UserID).First(&reverse).Error
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			reverse = model.UserContact{
+				UserID:    contact.ContactID,
+				ContactID: contact.UserID,
+				Status:    model.ContactStatusAccepted,
+			}
+			if err := tx.Create(&reverse).Error; err != nil {
+				return fmt.Errorf("failed to add contact: %w", err)
+			}
+		case err != nil:
+			return fmt.Errorf("failed to get contact: %w", err)
+		default:
+			if err := tx.Model(&reverse).Update("status", model.ContactStatusAccepted).Error; err != nil {
+				return fmt.Errorf("failed to accept contact: %w", err)
+			}
+		}
+
+		contact.Status = model.ContactStatusAccepted
+		return nil
+	})
+}
+
+// CreateBlock records that BlockerID blocked BlockedID. It reports false and
+// leaves block untouched when the block already exists.
+func (r *userRepository) CreateBlock(ctx context.Context, block *model.UserBlock) (bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	var existing model.UserBlock
+	err := r.db.WithContext(ctx).First(&existing, "blocker_id = ? AND blocked_id = ?", block.BlockerID, block.BlockedID).Error
+	if err == nil {
+		*block = existing
+		return false, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return false, fmt.Errorf("failed to get block: %w", err)
+	}
+
+	if err := r.db.WithContext(ctx).Create(block).Error; err != nil {
+		return false, fmt.Errorf("failed to create block: %w", err)
+	}
+	return true, nil
+}
+
+func (r *userRepository) DeleteBlock(ctx context.Context, blockerID, blockedID uuid.UUID) (bool, error) {
+	ctx, cancel := database.WriteContext(ctx)
+	defer cancel()
+
+	result := r.db.WithContext(ctx).Delete(&model.UserBlock{}, "blocker_id = ? AND blocked_id = ?", blockerID, blockedID)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to delete block: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetBlocks lists the users blockerID blocked, newest first
+func (r *userRepository) GetBlocks(ctx context.Context, blockerID uuid.UUID) ([]model.UserBlock, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var blocks []model.UserBlock
+	if err := r.db.WithContext(ctx).
+		Preload("Blocked").
+		Where("blocker_id = ?", blockerID).
+		Order("created_at DESC").
+		Find(&blocks).Error; err != nil {
+		return nil, fmt.Errorf("failed to get blocks: %w", err)
+	}
+	return blocks, nil
+}
+
+// GetBlockedUserIDs returns the users userID blocked together with the users
+// who blocked userID
+func (r *userRepository) GetBlockedUserIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	ctx, cancel := database.ReadContext(ctx)
+	defer cancel()
+
+	var blocks []model.UserBlock
+	if err := r.db.WithContext(ctx).
+		Select("blocker_id", "blocked_id").
+		Where("blocker_id = ? OR blocked_id = ?", userID, userID).
+		Find(&blocks).Error; err != nil {
+		return nil, fmt.Errorf("failed to get blocked users: %w", err)
+	}
+
+	userIDs := make([]uuid.UUID, 0, len(blocks))
+	for _, block := range blocks {
+		if block.BlockerID == userID {
+			userIDs = append(userIDs, block.BlockedID)
+		} else {
+			userIDs = append(userIDs, block.BlockerID)
+		}
+	}
+	return userIDs, nil
+}
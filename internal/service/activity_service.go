@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+	"realtime-api/internal/repository"
+	"realtime-api/internal/tracing"
+
+	"github.com/google/uuid"
+)
+
+// Activity types
+const (
+	ActivityLogin          = "login"
+	ActivityLogout         = "logout"
+	ActivityMessageSent    = "message_sent"
+	ActivityRoomJoin       = "room_join"
+	ActivityRoomLeave      = "room_leave"
+	ActivityUserBlock      = "user_block"
+	ActivityUserUnblock    = "user_unblock"
+	ActivityPasswordChange = "password_change"
+	ActivityPasswordReset  = "password_reset"
+)
+
+type ActivityService interface {
+	// Record stores an activity log in the background
+	Record(log *model.ActivityLog)
+	GetUserActivity(ctx context.Context, adminID, userID uuid.UUID, activityType string, page, limit int) ([]model.ActivityLog, *model.PaginationMeta, error)
+}
+
+type activityService struct {
+	activityRepo repository.ActivityLogRepository
+	userRepo     repository.UserRepository
+
+	// writes tracks the logs still being stored
+	writes sync.WaitGroup
+}
+
+func NewActivityService(activityRepo repository.ActivityLogRepository, userRepo repository.UserRepository) ActivityService {
+	return &activityService{
+		activityRepo: activityRepo,
+		userRepo:     userRepo,
+	}
+}
+
+// activity records the activity of the other services. It is nil until
+// SetActivityService is called, and then nothing is recorded.
+var activity ActivityService
+
+// SetActivityService makes the services record user activity to svc
+func SetActivityService(svc ActivityService) {
+	activity = svc
+}
+
+// recordActivity fills in the metadata of log and stores it without making
+// the caller wait for it
+func recordActivity(log *model.ActivityLog, metadata map[string]interface{}) {
+	if activity == nil {
+		return
+	}
+
+	log.Metadata = "{}"
+	if metadata != nil {
+		if encoded, err := json.Marshal(metadata); err == nil {
+			log.Metadata = string(encoded)
+		}
+	}
+	activity.Record(log)
+}
+
+func (s *activityService) Record(log *model.ActivityLog) {
+	s.writes.Add(1)
+	go func() {
+		defer s.writes.Done()
+		if err := s.activityRepo.Create(context.Background(), log); err != nil {
+			logger.Warn("Failed to record activity", logger.WithFields(map[string]interface{}{
+				"activity_type": log.ActivityType,
+				"error":         err.Error(),
+			}))
+		}
+	}()
+}
+
+// GetUserActivity lists the activity of a user for a system admin
+func (s *activityService) GetUserActivity(ctx context.Context, adminID, userID uuid.UUID, activityType string, page, limit int) (_ []model.ActivityLog, _ *model.PaginationMeta, err error) {
+	ctx, span := tracing.Start(ctx, "service.activity.GetUserActivity", tracing.ID("admin_id", adminID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	admin, err := s.userRepo.GetByID(ctx, adminID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if admin == nil || !admin.IsAdmin {
+		return nil, nil, fmt.Errorf("%w: only admins can view user activity", ErrForbidden)
+	}
+
+	page, limit = normalizePage(page, limit)
+	offset := (page - 1) * limit
+
+	logs, total, err := s.activityRepo.GetByUserID(ctx, userID, activityType, offset, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return logs, newPaginationMeta(page, limit, total), nil
+}
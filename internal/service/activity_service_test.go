@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"realtime-api/internal/model"
+	"realtime-api/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomActivityIsRecorded(t *testing.T) {
+	roomSvc, roomRepo, db := newTestRoomService(t)
+	require.NoError(t, db.Migrate(&model.ActivityLog{}))
+	ctx := context.Background()
+
+	activitySvc := NewActivityService(repository.NewActivityLogRepository(), repository.NewUserRepository())
+	SetActivityService(activitySvc)
+	t.Cleanup(func() { SetActivityService(nil) })
+
+	admin := &model.User{Username: "admin", Email: "admin@example.com", Password: "hashed", IsAdmin: true}
+	require.NoError(t, db.DB.Create(admin).Error)
+
+	userID := uuid.New()
+	room := &model.Room{Name: "general", Type: "public", CreatedBy: admin.ID}
+	require.NoError(t, roomRepo.Create(ctx, room))
+
+	_, err := roomSvc.JoinRoom(ctx, room.ID, userID)
+	require.NoError(t, err)
+	require.NoError(t, roomSvc.LeaveRoom(ctx, room.ID, userID))
+	activitySvc.(*activityService).writes.Wait()
+
+	// Only system admins can look at the log
+	_, _, err = activitySvc.GetUserActivity(ctx, userID, userID, "", 1, 20)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	logs, meta, err := activitySvc.GetUserActivity(ctx, admin.ID, userID, "", 1, 20)
+	require.NoError(t, err)
+	assert.Equal(t, 2, meta.Total)
+	require.Len(t, logs, 2)
+
+	logs, meta, err = activitySvc.GetUserActivity(ctx, admin.ID, userID, ActivityRoomJoin, 1, 20)
+	require.NoError(t, err)
+	assert.Equal(t, 1, meta.Total)
+	require.Len(t, logs, 1)
+	assert.Equal(t, ActivityRoomJoin, logs[0].ActivityType)
+	assert.Contains(t, logs[0].Metadata, room.ID.String())
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"realtime-api/internal/logger"
+	"realtime-api/internal/redis"
+	"realtime-api/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// blockSetCacheTTL is how long the block set of a user stays cached; blocking
+// and unblocking drop the cached sets of both users right away
+const blockSetCacheTTL = 10 * time.Minute
+
+// blockedUserIDs returns the users userID blocked or was blocked by. The set
+// is cached in Redis so it can be checked for every message.
+func blockedUserIDs(ctx context.Context, userRepo repository.UserRepository, cache *redis.Redis, userID uuid.UUID) ([]uuid.UUID, error) {
+	cached, err := cache.GetBlockSet(ctx, userID.String())
+	if err != nil {
+		logger.Warn("Failed to get cached block set", logger.WithField("error", err.Error()))
+	} else if cached != "" {
+		var userIDs []uuid.UUID
+		if err := json.Unmarshal([]byte(cached), &userIDs); err == nil {
+			return userIDs, nil
+		}
+	}
+
+	userIDs, err := userRepo.GetBlockedUserIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if encoded, err := json.Marshal(userIDs); err == nil {
+		if err := cache.SetBlockSet(ctx, userID.String(), string(encoded), blockSetCacheTTL); err != nil {
+			logger.Warn("Failed to cache block set", logger.WithField("error", err.Error()))
+		}
+	}
+	return userIDs, nil
+}
+
+// isBlockedBetween reports whether either user blocked the other
+func isBlockedBetween(ctx context.Context, userRepo repository.UserRepository, cache *redis.Redis, userID, otherID uuid.UUID) (bool, error) {
+	userIDs, err := blockedUserIDs(ctx, userRepo, cache, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range userIDs {
+		if id == otherID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// invalidateBlockSets drops the cached block sets of users whose blocks changed
+func invalidateBlockSets(ctx context.Context, cache *redis.Redis, userIDs ...uuid.UUID) {
+	keys := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		keys[i] = userID.String()
+	}
+	if err := cache.DeleteBlockSets(ctx, keys...); err != nil {
+		logger.Warn("Failed to invalidate block sets", logger.WithField("error", err.Error()))
+	}
+}
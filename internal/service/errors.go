@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Sentinel errors wrapped by the services so callers can tell bad input and
+// permission problems apart from internal failures
+var (
+	ErrInvalidArgument = errors.New("invalid argument")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrForbidden       = errors.New("access denied")
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	ErrRateLimited     = errors.New("rate limited")
+
+	// ErrRoomFull is a conflict returned when a room has reached its
+	// MaxMembers limit
+	ErrRoomFull = fmt.Errorf("%w: room is full", ErrConflict)
+
+	// ErrRoomArchived is returned when posting or typing into a room that
+	// was archived for everyone
+	ErrRoomArchived = fmt.Errorf("%w: room is archived", ErrForbidden)
+
+	// ErrMessageTypeDisabled is returned when sending files, voice or video
+	// to a room whose settings turned them off
+	ErrMessageTypeDisabled = fmt.Errorf("%w: message type is disabled in this room", ErrForbidden)
+
+	// ErrUserUnavailable is returned when a block between two users stops an
+	// interaction. It is worded so the blocked user can't tell they were
+	// blocked.
+	ErrUserUnavailable = fmt.Errorf("%w: this user is not available", ErrForbidden)
+
+	// ErrEmailTaken and ErrUsernameTaken are conflicts returned when another
+	// account already uses the email or username
+	ErrEmailTaken    = fmt.Errorf("%w: email is already in use", ErrConflict)
+	ErrUsernameTaken = fmt.Errorf("%w: username is already taken", ErrConflict)
+
+	// Not found errors of the main resources, so clients can tell them apart
+	ErrRoomNotFound    = fmt.Errorf("%w: room not found", ErrNotFound)
+	ErrMessageNotFound = fmt.Errorf("%w: message not found", ErrNotFound)
+	ErrUserNotFound    = fmt.Errorf("%w: user not found", ErrNotFound)
+)
+
+// RateLimitError wraps ErrRateLimited with the time until the action is
+// allowed again
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s: retry after %s", ErrRateLimited, e.RetryAfter)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"realtime-api/internal/model"
+	"realtime-api/internal/repository"
+	"realtime-api/internal/tracing"
+
+	"github.com/google/uuid"
+)
+
+// Export formats accepted by ExportRoom
+const (
+	ExportFormatJSON = "json"
+	ExportFormatCSV  = "csv"
+)
+
+const (
+	// exportBatchSize is how many messages are read and written at a time
+	exportBatchSize = 100
+	// exportCooldown is how often a user may export the same room
+	exportCooldown = time.Hour
+)
+
+// flusher is implemented by writers that buffer, such as HTTP responses
+type flusher interface {
+	Flush()
+}
+
+// PrepareRoomExport checks that userID may export the room in format and
+// starts their export cooldown, failing with a RateLimitError while one is
+// running. It returns the room to name the download after.
+func (s *messageService) PrepareRoomExport(ctx context.Context, roomID, userID uuid.UUID, format string) (_ *model.Room, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.PrepareRoomExport", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	if format != ExportFormatJSON && format != ExportFormatCSV {
+		return nil, fmt.Errorf("%w: export format must be json or csv", ErrInvalidArgument)
+	}
+
+	room, err := s.roomRepo.GetByID(ctx, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room: %w", err)
+	}
+	if room == nil {
+		return nil, ErrRoomNotFound
+	}
+
+	isMember, err := s.roomRepo.IsUserInRoom(ctx, roomID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check room membership: %w", err)
+	}
+	if !isMember {
+		return nil, fmt.Errorf("%w: user is not a member of this room", ErrForbidden)
+	}
+
+	key := fmt.Sprintf("export:%s:%s", roomID, userID)
+	started, err := s.redis.SetNX(ctx, key, "1", exportCooldown)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check export limit: %w", err)
+	}
+	if !started {
+		retryAfter, err := s.redis.TTL(ctx, key)
+		if err != nil || retryAfter <= 0 {
+			retryAfter = exportCooldown
+		}
+		return nil, &RateLimitError{RetryAfter: retryAfter}
+	}
+
+	return room, nil
+}
+
+// ExportRoom writes the messages of a room to w, oldest first, in batches so
+// the whole history is never held in memory. Callers check access with
+// PrepareRoomExport first.
+func (s *messageService) ExportRoom(ctx context.Context, room *model.Room, userID uuid.UUID, format string, w io.Writer) (err error) {
+	ctx, span := tracing.Start(ctx, "service.message.ExportRoom", tracing.ID("room_id", room.ID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	var exporter roomExporter
+	switch format {
+	case ExportFormatJSON:
+		exporter = &jsonRoomExporter{w: w, encoder: json.NewEncoder(w)}
+	case ExportFormatCSV:
+		exporter = &csvRoomExporter{w: csv.NewWriter(w)}
+	default:
+		return fmt.Errorf("%w: export format must be json or csv", ErrInvalidArgument)
+	}
+
+	if err := exporter.begin(room, time.Now()); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+
+	var cursor *repository.MessageCursor
+	for {
+		messages, err := s.messageRepo.GetRoomMessagesAfter(ctx, room.ID, userID, cursor, exportBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			break
+		}
+
+		exported, err := s.exportedMessages(ctx, messages)
+		if err != nil {
+			return err
+		}
+		for i := range exported {
+			if err := exporter.write(&exported[i]); err != nil {
+				return fmt.Errorf("failed to write export: %w", err)
+			}
+		}
+		if err := exporter.flush(); err != nil {
+			return fmt.Errorf("failed to write export: %w", err)
+		}
+		if f, ok := w.(flusher); ok {
+			f.Flush()
+		}
+
+		if len(messages) < exportBatchSize {
+			break
+		}
+		last := messages[len(messages)-1]
+		cursor = &repository.MessageCursor{CreatedAt: last.CreatedAt, MessageID: &last.ID}
+	}
+
+	if err := exporter.end(); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return nil
+}
+
+// exportedMessages converts a batch of messages, loading their reactions
+func (s *messageService) exportedMessages(ctx context.Context, messages []model.Message) ([]model.ExportedMessage, error) {
+	messageIDs := make([]uuid.UUID, len(messages))
+	for i, message := range messages {
+		messageIDs[i] = message.ID
+	}
+
+	reactions, err := s.messageRepo.GetReactionsWithUsers(ctx, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	byMessage := make(map[uuid.UUID][]model.ExportedReaction)
+	for _, reaction := range reactions {
+		byMessage[reaction.MessageID] = append(byMessage[reaction.MessageID], model.ExportedReaction{
+			Emoji:    reaction.Emoji,
+			UserID:   reaction.UserID,
+			Username: reaction.User.Username,
+		})
+	}
+
+	exported := make([]model.ExportedMessage, len(messages))
+	for i, message := range messages {
+		exported[i] = model.ExportedMessage{
+			ID:             message.ID,
+			Type:           message.Type,
+			Content:        message.Content,
+			SenderID:       message.SenderID,
+			SenderUsername: message.Sender.Username,
+			SenderName:     senderDisplayName(&message.Sender),
+			ReplyToID:      message.ReplyToID,
+			CreatedAt:      message.CreatedAt,
+			EditedAt:       message.EditedAt,
+			Reactions:      byMessage[message.ID],
+		}
+	}
+	return exported, nil
+}
+
+// roomExporter writes a room export in one format
+type roomExporter interface {
+	begin(room *model.Room, exportedAt time.Time) error
+	write(message *model.ExportedMessage) error
+	flush() error
+	end() error
+}
+
+// jsonRoomExporter writes the export as one JSON document whose messages
+// array is encoded a message at a time
+type jsonRoomExporter struct {
+	w       io.Writer
+	encoder *json.Encoder
+	count   int
+}
+
+func (e *jsonRoomExporter) begin(room *model.Room, exportedAt time.Time) error {
+	header, err := json.Marshal(map[string]interface{}{
+		"id":   room.ID,
+		"name": room.Name,
+		"type": room.Type,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.w, `{"room":%s,"exported_at":%q,"messages":[`, header, exportedAt.UTC().Format(time.RFC3339))
+	return err
+}
+
+func (e *jsonRoomExporter) write(message *model.ExportedMessage) error {
+	if e.count > 0 {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+	return e.encoder.Encode(message)
+}
+
+func (e *jsonRoomExporter) flush() error { return nil }
+
+func (e *jsonRoomExporter) end() error {
+	_, err := io.WriteString(e.w, "]}\n")
+	return err
+}
+
+// csvRoomExporter writes the export as CSV, one row per message with the
+// reactions folded into a single column
+type csvRoomExporter struct {
+	w *csv.Writer
+}
+
+func (e *csvRoomExporter) begin(room *model.Room, exportedAt time.Time) error {
+	return e.w.Write([]string{"id", "created_at", "sender_id", "sender_username", "sender_name", "type", "content", "reply_to_id", "edited_at", "reactions"})
+}
+
+func (e *csvRoomExporter) write(message *model.ExportedMessage) error {
+	var replyToID, editedAt string
+	if message.ReplyToID != nil {
+		replyToID = message.ReplyToID.String()
+	}
+	if message.EditedAt != nil {
+		editedAt = message.EditedAt.UTC().Format(time.RFC3339)
+	}
+
+	reactions := make([]string, len(message.Reactions))
+	for i, reaction := range message.Reactions {
+		reactions[i] = reaction.Emoji + ":" + reaction.Username
+	}
+
+	return e.w.Write([]string{
+		message.ID.String(),
+		message.CreatedAt.UTC().Format(time.RFC3339),
+		message.SenderID.String(),
+		message.SenderUsername,
+		message.SenderName,
+		message.Type,
+		message.Content,
+		replyToID,
+		editedAt,
+		strings.Join(reactions, " "),
+	})
+}
+
+func (e *csvRoomExporter) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvRoomExporter) end() error {
+	return e.flush()
+}
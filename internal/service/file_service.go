@@ -0,0 +1,535 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"realtime-api/internal/config"
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+	"realtime-api/internal/repository"
+	"realtime-api/internal/storage"
+	"realtime-api/internal/tracing"
+
+	"github.com/disintegration/imaging"
+	"github.com/google/uuid"
+	_ "golang.org/x/image/webp"
+)
+
+// sniffLength is how much of a file http.DetectContentType looks at
+const sniffLength = 512
+
+// expiredFilesBatch is how many expired uploads one cleanup pass removes
+const expiredFilesBatch = 100
+
+// defaultStaleUploadTTL is how long an upload can stay in "uploading" when
+// no TTL is configured
+const defaultStaleUploadTTL = 6 * time.Hour
+
+// defaultThumbnailSize bounds thumbnails when no dimensions are configured
+const defaultThumbnailSize = 320
+
+// thumbnailWait bounds how long attaching files waits for their thumbnails
+const thumbnailWait = 5 * time.Second
+
+// defaultSignedURLTTL is how long signed URLs last when no TTL is configured
+const defaultSignedURLTTL = time.Hour
+
+// thumbnailDir is the storage key prefix of thumbnails
+const thumbnailDir = "thumbs"
+
+// thumbnailTypes are the image types thumbnails are generated for
+var thumbnailTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+type FileService interface {
+	UploadFile(ctx context.Context, userID uuid.UUID, file *multipart.FileHeader, temporary bool) (*model.FileUploadResponse, error)
+	GetFile(ctx context.Context, fileID uuid.UUID) (*model.FileUploadResponse, error)
+	Attachments(ctx context.Context, userID uuid.UUID, fileIDs []uuid.UUID) ([]model.MessageAttachment, error)
+	SignAttachments(ctx context.Context, attachments []model.MessageAttachment)
+	KeepFiles(ctx context.Context, fileIDs []uuid.UUID) error
+	DeleteAttachmentFiles(ctx context.Context, attachments []model.MessageAttachment) error
+	CleanupExpiredFiles(ctx context.Context) (int, error)
+}
+
+type fileService struct {
+	fileRepo repository.FileRepository
+	storage  storage.Storage
+	config   *config.UploadConfig
+
+	// thumbnails tracks thumbnail generation running in the background
+	thumbnails sync.WaitGroup
+	// pending maps uploads whose thumbnail is being generated to a channel
+	// closed when it is done
+	pending sync.Map
+}
+
+func NewFileService(fileRepo repository.FileRepository, store storage.Storage, cfg *config.UploadConfig) FileService {
+	return &fileService{
+		fileRepo: fileRepo,
+		storage:  store,
+		config:   cfg,
+	}
+}
+
+// UploadFile stores an uploaded file under a generated name. The MIME type is
+// detected from the file content, the client supplied type is ignored.
+func (s *fileService) UploadFile(ctx context.Context, userID uuid.UUID, file *multipart.FileHeader, temporary bool) (_ *model.FileUploadResponse, err error) {
+	ctx, span := tracing.Start(ctx, "service.file.UploadFile", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	if file.Size <= 0 {
+		return nil, fmt.Errorf("%w: file is empty", ErrInvalidArgument)
+	}
+	if file.Size > s.config.MaxFileSize {
+		return nil, fmt.Errorf("%w: file exceeds the maximum size of %d bytes", ErrInvalidArgument, s.config.MaxFileSize)
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer src.Close()
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read uploaded file: %w", err)
+	}
+	head = head[:n]
+
+	mimeType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil || !s.isAllowedType(mimeType) {
+		return nil, fmt.Errorf("%w: file type %s is not allowed", ErrInvalidArgument, mimeType)
+	}
+
+	fileID := uuid.New()
+	fileName := fileID.String() + fileExtension(file.Filename, mimeType)
+
+	// The declared size may be smaller than the content
+	body := &sizeLimitReader{r: io.MultiReader(bytes.NewReader(head), src), max: s.config.MaxFileSize}
+	if err := s.storage.Put(ctx, fileName, body, mimeType); err != nil {
+		if body.exceeded() {
+			return nil, fmt.Errorf("%w: file exceeds the maximum size of %d bytes", ErrInvalidArgument, s.config.MaxFileSize)
+		}
+		return nil, err
+	}
+	size := body.read
+
+	upload := &model.FileUpload{
+		BaseModel:    model.BaseModel{ID: fileID},
+		UserID:       userID,
+		OriginalName: filepath.Base(file.Filename),
+		FileName:     fileName,
+		FilePath:     s.storage.Location(fileName),
+		FileSize:     size,
+		FileType:     strings.SplitN(mimeType, "/", 2)[0],
+		MimeType:     mimeType,
+		UploadStatus: "completed",
+		IsTemporary:  temporary,
+	}
+	if thumbnailTypes[mimeType] {
+		upload.Width, upload.Height = imageSize(file)
+	}
+	if temporary {
+		expiresAt := time.Now().Add(time.Duration(s.config.TempTTL) * time.Hour)
+		upload.ExpiresAt = &expiresAt
+	}
+
+	if err := s.fileRepo.Create(ctx, upload); err != nil {
+		s.storage.Delete(ctx, fileName)
+		return nil, err
+	}
+
+	if thumbnailTypes[mimeType] {
+		done := make(chan struct{})
+		s.pending.Store(upload.ID, done)
+		s.thumbnails.Add(1)
+		go func(upload model.FileUpload) {
+			defer s.thumbnails.Done()
+			defer func() {
+				s.pending.Delete(upload.ID)
+				close(done)
+			}()
+			s.generateThumbnail(&upload)
+		}(*upload)
+	}
+
+	logger.Info("File uploaded successfully", logger.WithFields(map[string]interface{}{
+		"file_id":   upload.ID,
+		"user_id":   userID,
+		"mime_type": mimeType,
+		"size":      size,
+	}))
+
+	return &model.FileUploadResponse{
+		FileUpload: *upload,
+		URL:        s.fileURL(fileName),
+	}, nil
+}
+
+// GetFile returns the metadata and public URL of an upload
+func (s *fileService) GetFile(ctx context.Context, fileID uuid.UUID) (_ *model.FileUploadResponse, err error) {
+	ctx, span := tracing.Start(ctx, "service.file.GetFile", tracing.ID("file_id", fileID))
+	defer func() { tracing.End(span, err) }()
+
+	upload, err := s.fileRepo.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if upload == nil || upload.UploadStatus != "completed" {
+		return nil, fmt.Errorf("%w: file not found", ErrNotFound)
+	}
+
+	return &model.FileUploadResponse{
+		FileUpload: *upload,
+		URL:        s.fileURL(upload.FileName),
+	}, nil
+}
+
+// generateThumbnail stores a thumbnail of an image upload under the thumbs
+// prefix. It runs after the upload request has returned, so failures, like
+// corrupt images, are only logged.
+func (s *fileService) generateThumbnail(upload *model.FileUpload) {
+	ctx := context.Background()
+	fields := map[string]interface{}{"file_id": upload.ID}
+
+	img, err := s.openImage(ctx, upload.FileName)
+	if err != nil {
+		fields["error"] = err.Error()
+		logger.Warn("Failed to open image for thumbnail", logger.WithFields(fields))
+		return
+	}
+
+	thumbnailKey := thumbnailKey(upload.FileName)
+	format, err := imaging.FormatFromFilename(thumbnailKey)
+	if err != nil {
+		fields["error"] = err.Error()
+		logger.Warn("Failed to pick thumbnail format", logger.WithFields(fields))
+		return
+	}
+
+	width, height := s.config.ThumbnailWidth, s.config.ThumbnailHeight
+	if width <= 0 || height <= 0 {
+		width, height = defaultThumbnailSize, defaultThumbnailSize
+	}
+	var encoded bytes.Buffer
+	thumbnail := imaging.Fit(img, width, height, imaging.Lanczos)
+	if err := imaging.Encode(&encoded, thumbnail, format); err != nil {
+		fields["error"] = err.Error()
+		logger.Warn("Failed to encode thumbnail", logger.WithFields(fields))
+		return
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(thumbnailKey))
+	if err := s.storage.Put(ctx, thumbnailKey, &encoded, contentType); err != nil {
+		fields["error"] = err.Error()
+		logger.Warn("Failed to save thumbnail", logger.WithFields(fields))
+		return
+	}
+
+	if err := s.fileRepo.SetThumbnail(ctx, upload.ID, s.storage.Location(thumbnailKey),
+		s.fileURL(upload.FileName), s.thumbnailURL(upload.FileName)); err != nil {
+		s.storage.Delete(ctx, thumbnailKey)
+		fields["error"] = err.Error()
+		logger.Warn("Failed to record thumbnail", logger.WithFields(fields))
+	}
+}
+
+// Attachments turns uploads of the user into message attachments
+func (s *fileService) Attachments(ctx context.Context, userID uuid.UUID, fileIDs []uuid.UUID) (_ []model.MessageAttachment, err error) {
+	ctx, span := tracing.Start(ctx, "service.file.Attachments", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	// Attachments of files uploaded a moment ago come with their thumbnails
+	s.waitForThumbnails(ctx, fileIDs)
+
+	files, err := s.fileRepo.GetByIDs(ctx, fileIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uuid.UUID]model.FileUpload, len(files))
+	for _, file := range files {
+		byID[file.ID] = file
+	}
+
+	attachments := make([]model.MessageAttachment, 0, len(fileIDs))
+	for _, id := range fileIDs {
+		file, ok := byID[id]
+		if !ok || file.UserID != userID || file.UploadStatus != "completed" {
+			return nil, fmt.Errorf("%w: file %s not found", ErrInvalidArgument, id)
+		}
+
+		attachment := model.MessageAttachment{
+			FileName: file.OriginalName,
+			FileSize: file.FileSize,
+			FileType: file.FileType,
+			MimeType: file.MimeType,
+			URL:      s.fileURL(file.FileName),
+			Width:    file.Width,
+			Height:   file.Height,
+			Duration: file.Duration,
+		}
+		if file.ThumbnailPath != "" {
+			attachment.ThumbnailURL = s.thumbnailURL(file.FileName)
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, nil
+}
+
+// SignAttachments replaces the URLs of stored attachments with signed URLs,
+// for attachments that shouldn't be reachable through their public URL. URLs
+// pointing elsewhere are left alone.
+func (s *fileService) SignAttachments(ctx context.Context, attachments []model.MessageAttachment) {
+	ttl := time.Duration(s.config.SignedURLTTL) * time.Minute
+	if ttl <= 0 {
+		ttl = defaultSignedURLTTL
+	}
+
+	for i := range attachments {
+		attachments[i].URL = s.signedURL(ctx, attachments[i].URL, ttl)
+		if attachments[i].ThumbnailURL != "" {
+			attachments[i].ThumbnailURL = s.signedURL(ctx, attachments[i].ThumbnailURL, ttl)
+		}
+	}
+}
+
+func (s *fileService) signedURL(ctx context.Context, url string, ttl time.Duration) string {
+	prefix := s.storage.URL("")
+	if !strings.HasPrefix(url, prefix) {
+		return url
+	}
+
+	signed, err := s.storage.SignedURL(ctx, strings.TrimPrefix(url, prefix), ttl)
+	if err != nil {
+		logger.Warn("Failed to sign attachment URL", logger.WithField("error", err.Error()))
+		return url
+	}
+	return signed
+}
+
+// KeepFiles stops attached uploads from expiring
+func (s *fileService) KeepFiles(ctx context.Context, fileIDs []uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.file.KeepFiles")
+	defer func() { tracing.End(span, err) }()
+
+	return s.fileRepo.MarkPermanent(ctx, fileIDs)
+}
+
+// DeleteAttachmentFiles removes the stored files and thumbnails of
+// attachments whose messages are gone, along with their upload records.
+// Attachments pointing outside storage are skipped.
+func (s *fileService) DeleteAttachmentFiles(ctx context.Context, attachments []model.MessageAttachment) (err error) {
+	ctx, span := tracing.Start(ctx, "service.file.DeleteAttachmentFiles")
+	defer func() { tracing.End(span, err) }()
+
+	prefix := s.storage.URL("")
+	var fileNames []string
+	for _, attachment := range attachments {
+		if !strings.HasPrefix(attachment.URL, prefix) {
+			continue
+		}
+		fileName := strings.TrimPrefix(attachment.URL, prefix)
+
+		if strings.HasPrefix(attachment.ThumbnailURL, prefix) {
+			if err := s.storage.Delete(ctx, strings.TrimPrefix(attachment.ThumbnailURL, prefix)); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				logger.Warn("Failed to remove attachment thumbnail", logger.WithField("file_name", fileName))
+			}
+		}
+		if err := s.storage.Delete(ctx, fileName); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			logger.Warn("Failed to remove attachment file", logger.WithFields(map[string]interface{}{
+				"file_name": fileName,
+				"error":     err.Error(),
+			}))
+			continue
+		}
+		fileNames = append(fileNames, fileName)
+	}
+
+	return s.fileRepo.MarkDeletedByFileNames(ctx, fileNames)
+}
+
+func (s *fileService) fileURL(fileName string) string {
+	return s.storage.URL(fileName)
+}
+
+func (s *fileService) thumbnailURL(fileName string) string {
+	return s.storage.URL(thumbnailKey(fileName))
+}
+
+// thumbnailKey is where the thumbnail of an upload is stored. Thumbnails of
+// WebP images are PNG, as WebP can only be decoded.
+func thumbnailKey(fileName string) string {
+	if ext := filepath.Ext(fileName); strings.EqualFold(ext, ".webp") {
+		fileName = strings.TrimSuffix(fileName, ext) + ".png"
+	}
+	return thumbnailDir + "/" + fileName
+}
+
+// waitForThumbnails waits, up to thumbnailWait, for the thumbnails of the
+// files still being generated
+func (s *fileService) waitForThumbnails(ctx context.Context, fileIDs []uuid.UUID) {
+	timeout := time.NewTimer(thumbnailWait)
+	defer timeout.Stop()
+
+	for _, id := range fileIDs {
+		done, ok := s.pending.Load(id)
+		if !ok {
+			continue
+		}
+		select {
+		case <-done.(chan struct{}):
+		case <-timeout.C:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *fileService) openImage(ctx context.Context, key string) (image.Image, error) {
+	r, err := s.storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return imaging.Decode(r, imaging.AutoOrientation(true))
+}
+
+// CleanupExpiredFiles deletes temporary uploads past their expiry and
+// uploads abandoned while uploading, and returns how many were removed.
+// Files already missing from storage don't stop their records being removed.
+func (s *fileService) CleanupExpiredFiles(ctx context.Context) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "service.file.CleanupExpiredFiles")
+	defer func() { tracing.End(span, err) }()
+
+	staleTTL := time.Duration(s.config.StaleUploadTTL) * time.Hour
+	if staleTTL <= 0 {
+		staleTTL = defaultStaleUploadTTL
+	}
+
+	removed := 0
+	for {
+		now := time.Now()
+		files, err := s.fileRepo.GetExpired(ctx, now, now.Add(-staleTTL), expiredFilesBatch)
+		if err != nil {
+			return removed, err
+		}
+
+		batchRemoved := 0
+		for _, file := range files {
+			if err := s.removeStoredFile(ctx, &file); err != nil {
+				logger.Warn("Failed to remove expired file", logger.WithFields(map[string]interface{}{
+					"file_id": file.ID,
+					"error":   err.Error(),
+				}))
+				continue
+			}
+
+			if err := s.fileRepo.MarkDeleted(ctx, file.ID); err != nil {
+				return removed, err
+			}
+			batchRemoved++
+		}
+		removed += batchRemoved
+
+		// Files that failed to be removed come back in the next batch
+		if len(files) < expiredFilesBatch || batchRemoved == 0 {
+			return removed, nil
+		}
+	}
+}
+
+// removeStoredFile deletes an upload and its thumbnail from storage
+func (s *fileService) removeStoredFile(ctx context.Context, file *model.FileUpload) error {
+	if file.FileName == "" {
+		return nil
+	}
+
+	if file.ThumbnailPath != "" {
+		if err := s.storage.Delete(ctx, thumbnailKey(file.FileName)); err != nil {
+			logger.Warn("Failed to remove expired thumbnail", logger.WithField("file_id", file.ID))
+		}
+	}
+	return s.storage.Delete(ctx, file.FileName)
+}
+
+func (s *fileService) isAllowedType(mimeType string) bool {
+	for _, allowed := range s.config.AllowedTypes {
+		if strings.EqualFold(allowed, mimeType) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileExtension keeps the extension of the original name when it matches the
+// detected type, and otherwise picks one for the type
+func fileExtension(name, mimeType string) string {
+	extensions, _ := mime.ExtensionsByType(mimeType)
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, candidate := range extensions {
+		if candidate == ext {
+			return ext
+		}
+	}
+	if len(extensions) > 0 {
+		return extensions[0]
+	}
+	return ""
+}
+
+// imageSize reads the dimensions of an uploaded image, 0 when it can't be
+// decoded
+func imageSize(file *multipart.FileHeader) (int, int) {
+	f, err := file.Open()
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0
+	}
+	return config.Width, config.Height
+}
+
+// sizeLimitReader fails once more than max bytes have been read
+type sizeLimitReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.exceeded() {
+		return n, fmt.Errorf("%w: file exceeds the maximum size of %d bytes", ErrInvalidArgument, l.max)
+	}
+	return n, err
+}
+
+func (l *sizeLimitReader) exceeded() bool {
+	return l.read > l.max
+}
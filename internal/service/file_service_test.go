@@ -0,0 +1,259 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"realtime-api/internal/config"
+	"realtime-api/internal/model"
+	"realtime-api/internal/repository"
+	"realtime-api/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFileHeader builds the multipart header a handler would receive
+func newTestFileHeader(t *testing.T, name string, content []byte) *multipart.FileHeader {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", name)
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequest("POST", "/", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	require.NoError(t, req.ParseMultipartForm(1<<20))
+	return req.MultipartForm.File["file"][0]
+}
+
+func TestUploadFile(t *testing.T) {
+	db := newTestDatabase(t, &model.User{}, &model.FileUpload{})
+	ctx := context.Background()
+
+	cfg := &config.UploadConfig{
+		MaxFileSize:  1024,
+		AllowedTypes: []string{"image/png", "text/plain"},
+		StoragePath:  t.TempDir(),
+		BaseURL:      "http://localhost:8080/uploads/",
+		TempTTL:      24,
+	}
+	svc := NewFileService(repository.NewFileRepository(), storage.NewLocal(cfg.StoragePath, cfg.BaseURL), cfg)
+	userID := uuid.New()
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 32)...)
+	upload, err := svc.UploadFile(ctx, userID, newTestFileHeader(t, "photo.PNG", png), true)
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", upload.MimeType)
+	assert.Equal(t, "image", upload.FileType)
+	assert.Equal(t, "completed", upload.UploadStatus)
+	assert.Equal(t, upload.FileName, upload.ID.String()+".png")
+	assert.Equal(t, "http://localhost:8080/uploads/"+upload.FileName, upload.URL)
+	require.NotNil(t, upload.ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), *upload.ExpiresAt, time.Minute)
+
+	stored, err := os.ReadFile(upload.FilePath)
+	require.NoError(t, err)
+	assert.Equal(t, png, stored)
+
+	// The type comes from the content, not the file name
+	_, err = svc.UploadFile(ctx, userID, newTestFileHeader(t, "notes.png", []byte("%PDF-1.4 not really a png")), false)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	_, err = svc.UploadFile(ctx, userID, newTestFileHeader(t, "big.txt", bytes.Repeat([]byte("a"), 2048)), false)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	kept, err := svc.UploadFile(ctx, userID, newTestFileHeader(t, "notes.txt", []byte("hello")), false)
+	require.NoError(t, err)
+	assert.Nil(t, kept.ExpiresAt)
+
+	// Rejected uploads leave nothing behind
+	names, err := filepath.Glob(filepath.Join(cfg.StoragePath, "*.*"))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{upload.FilePath, kept.FilePath}, names)
+
+	found, err := svc.GetFile(ctx, kept.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "notes.txt", found.OriginalName)
+	assert.Equal(t, kept.URL, found.URL)
+
+	// Only expired temporary uploads are cleaned up
+	require.NoError(t, db.DB.Model(&model.FileUpload{}).Where("id = ?", upload.ID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+	removed, err := svc.CleanupExpiredFiles(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.NoFileExists(t, upload.FilePath)
+	assert.FileExists(t, kept.FilePath)
+
+	_, err = svc.GetFile(ctx, upload.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	removed, err = svc.CleanupExpiredFiles(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+
+	// Uploads stuck uploading are abandoned after the stale TTL, and records
+	// are removed even when their file is already gone
+	stale := &model.FileUpload{UserID: userID, FileName: "gone.txt", UploadStatus: "uploading"}
+	recent := &model.FileUpload{UserID: userID, FileName: "recent.txt", UploadStatus: "uploading"}
+	require.NoError(t, db.DB.Create(stale).Error)
+	require.NoError(t, db.DB.Create(recent).Error)
+	require.NoError(t, db.DB.Model(stale).Update("created_at", time.Now().Add(-7*time.Hour)).Error)
+
+	removed, err = svc.CleanupExpiredFiles(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	var remaining []model.FileUpload
+	require.NoError(t, db.DB.Where("upload_status = ?", "uploading").Find(&remaining).Error)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, recent.ID, remaining[0].ID)
+}
+
+func TestImageUploadThumbnailAndAttachment(t *testing.T) {
+	db := newTestDatabase(t, &model.User{}, &model.Room{}, &model.RoomMember{}, &model.FileUpload{},
+		&model.Message{}, &model.MessageAttachment{}, &model.MessageReaction{}, &model.MessageDraft{})
+	ctx := context.Background()
+
+	cfg := &config.UploadConfig{
+		MaxFileSize:     1 << 20,
+		AllowedTypes:    []string{"image/png"},
+		StoragePath:     t.TempDir(),
+		BaseURL:         "http://localhost:8080/uploads",
+		TempTTL:         24,
+		ThumbnailWidth:  100,
+		ThumbnailHeight: 100,
+	}
+	fileSvc := NewFileService(repository.NewFileRepository(), storage.NewLocal(cfg.StoragePath, cfg.BaseURL), cfg)
+
+	userID := uuid.New()
+	room := &model.Room{Name: "general", Type: "group", CreatedBy: userID}
+	require.NoError(t, db.DB.Create(room).Error)
+	require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: room.ID, UserID: userID, Role: "member"}).Error)
+
+	var encoded bytes.Buffer
+	require.NoError(t, png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 400, 200))))
+	upload, err := fileSvc.UploadFile(ctx, userID, newTestFileHeader(t, "wide.png", encoded.Bytes()), true)
+	require.NoError(t, err)
+
+	fileSvc.(*fileService).thumbnails.Wait()
+
+	var stored model.FileUpload
+	require.NoError(t, db.DB.First(&stored, "id = ?", upload.ID).Error)
+	require.NotEmpty(t, stored.ThumbnailPath)
+
+	thumbnail, err := os.Open(stored.ThumbnailPath)
+	require.NoError(t, err)
+	defer thumbnail.Close()
+	bounds, err := png.DecodeConfig(thumbnail)
+	require.NoError(t, err)
+	assert.Equal(t, 100, bounds.Width)
+	assert.Equal(t, 50, bounds.Height)
+
+	messageSvc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), nil, fileSvc, newTestRedis(t))
+
+	// Media messages need something attached
+	_, err = messageSvc.SendMessage(ctx, &model.SendMessageRequest{RoomID: room.ID, Type: "image", Content: "look"}, userID)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	message, err := messageSvc.SendMessage(ctx, &model.SendMessageRequest{
+		RoomID:        room.ID,
+		Type:          "image",
+		Content:       "look",
+		AttachmentIDs: []uuid.UUID{upload.ID},
+	}, userID)
+	require.NoError(t, err)
+	require.Len(t, message.Attachments, 1)
+	assert.Equal(t, upload.URL, message.Attachments[0].URL)
+	assert.Equal(t, 400, message.Attachments[0].Width)
+	assert.Equal(t, 200, message.Attachments[0].Height)
+	assert.Equal(t, "http://localhost:8080/uploads/thumbs/"+upload.FileName, message.Attachments[0].ThumbnailURL)
+
+	// Attached files no longer expire
+	var attached model.FileUpload
+	require.NoError(t, db.DB.First(&attached, "id = ?", upload.ID).Error)
+	assert.False(t, attached.IsTemporary)
+	assert.Nil(t, attached.ExpiresAt)
+
+	// Other users can't attach the upload
+	_, err = messageSvc.SendMessage(ctx, &model.SendMessageRequest{RoomID: room.ID, Content: "mine", FileIDs: []uuid.UUID{upload.ID}}, uuid.New())
+	assert.Error(t, err)
+}
+
+func TestWebPThumbnailIsReadyWhenAttached(t *testing.T) {
+	newTestDatabase(t, &model.User{}, &model.Room{}, &model.RoomMember{}, &model.FileUpload{},
+		&model.Message{}, &model.MessageAttachment{}, &model.MessageReaction{}, &model.MessageDraft{})
+	ctx := context.Background()
+
+	cfg := &config.UploadConfig{
+		MaxFileSize:  1 << 20,
+		AllowedTypes: []string{"image/webp"},
+		StoragePath:  t.TempDir(),
+		BaseURL:      "http://localhost:8080/uploads",
+	}
+	fileSvc := NewFileService(repository.NewFileRepository(), storage.NewLocal(cfg.StoragePath, cfg.BaseURL), cfg)
+	userID := uuid.New()
+
+	// A 1x1 lossless WebP image
+	webp := []byte("RIFF\x1a\x00\x00\x00WEBPVP8L\r\x00\x00\x00/\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07\x00")
+	upload, err := fileSvc.UploadFile(ctx, userID, newTestFileHeader(t, "dot.webp", webp), true)
+	require.NoError(t, err)
+	assert.Equal(t, "image/webp", upload.MimeType)
+	assert.Equal(t, 1, upload.Width)
+
+	// No waiting for the background generation; attaching does
+	attachments, err := fileSvc.Attachments(ctx, userID, []uuid.UUID{upload.ID})
+	require.NoError(t, err)
+	require.Len(t, attachments, 1)
+	assert.Equal(t, "http://localhost:8080/uploads/thumbs/"+upload.ID.String()+".png", attachments[0].ThumbnailURL)
+
+	thumbnail, err := os.Open(filepath.Join(cfg.StoragePath, "thumbs", upload.ID.String()+".png"))
+	require.NoError(t, err)
+	defer thumbnail.Close()
+	_, err = png.DecodeConfig(thumbnail)
+	assert.NoError(t, err)
+}
+
+func TestSignAttachments(t *testing.T) {
+	cfg := &config.UploadConfig{
+		SignedURLTTL: 10,
+		S3: config.S3Config{
+			Endpoint:        "s3.example.com",
+			Bucket:          "uploads",
+			AccessKeyID:     "access",
+			SecretAccessKey: "secret",
+			UseSSL:          true,
+		},
+	}
+	store, err := storage.NewS3(&cfg.S3)
+	require.NoError(t, err)
+	svc := NewFileService(repository.NewFileRepository(), store, cfg)
+
+	attachments := []model.MessageAttachment{
+		{URL: "https://s3.example.com/uploads/a.png", ThumbnailURL: "https://s3.example.com/uploads/thumbs/a.png"},
+		{URL: "https://elsewhere.example.com/b.pdf"},
+	}
+	svc.SignAttachments(context.Background(), attachments)
+
+	assert.True(t, strings.HasPrefix(attachments[0].URL, "https://s3.example.com/uploads/a.png?X-Amz-Algorithm="))
+	assert.Contains(t, attachments[0].URL, "X-Amz-Expires=600")
+	assert.True(t, strings.HasPrefix(attachments[0].ThumbnailURL, "https://s3.example.com/uploads/thumbs/a.png?"))
+	assert.Equal(t, "https://elsewhere.example.com/b.pdf", attachments[1].URL)
+	assert.Empty(t, attachments[1].ThumbnailURL)
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"realtime-api/internal/logger"
+)
+
+// maxMentions caps how many distinct users a single message can mention
+const maxMentions = 50
+
+// mentionPattern matches @username not preceded by a word character, so
+// email addresses are not taken for mentions. Dots and dashes are allowed
+// inside a username but not at its end, leaving trailing punctuation out.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@(\w+(?:[.-]\w+)*)`)
+
+// parseMentions returns the distinct usernames mentioned in content, in
+// order of appearance
+func parseMentions(content string) []string {
+	seen := map[string]bool{}
+	var usernames []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		username := match[1]
+		if seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+		if len(usernames) == maxMentions {
+			break
+		}
+	}
+	return usernames
+}
+
+// mentionMetadata stores the users mentioned in content as the
+// mentioned_users entry of metadata. Mentions supplied by the client are
+// replaced; usernames that don't exist are ignored.
+func (s *messageService) mentionMetadata(ctx context.Context, content, metadata string) (string, error) {
+	usernames := parseMentions(content)
+	if len(usernames) == 0 && metadata == "" {
+		return metadata, nil
+	}
+
+	fields := map[string]interface{}{}
+	if metadata != "" {
+		if err := json.Unmarshal([]byte(metadata), &fields); err != nil {
+			logger.Warn("Ignoring invalid message metadata", logger.WithField("error", err.Error()))
+			fields = map[string]interface{}{}
+		}
+	}
+	delete(fields, "mentioned_users")
+
+	if len(usernames) > 0 {
+		users, err := s.userRepo.GetByUsernames(ctx, usernames)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve mentions: %w", err)
+		}
+		if len(users) > 0 {
+			mentioned := make([]string, 0, len(users))
+			for _, user := range users {
+				mentioned = append(mentioned, user.ID.String())
+			}
+			fields["mentioned_users"] = mentioned
+		}
+	}
+
+	if len(fields) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode message metadata: %w", err)
+	}
+	return string(encoded), nil
+}
@@ -2,31 +2,76 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"realtime-api/internal/config"
 	"realtime-api/internal/events"
+	"realtime-api/internal/health"
 	"realtime-api/internal/logger"
 	"realtime-api/internal/model"
 	"realtime-api/internal/redis"
 	"realtime-api/internal/repository"
+	"realtime-api/internal/tracing"
 
 	"github.com/google/uuid"
 )
 
 type MessageService interface {
 	SendMessage(ctx context.Context, req *model.SendMessageRequest, senderID uuid.UUID) (*model.Message, error)
-	GetMessages(ctx context.Context, roomID uuid.UUID, userID uuid.UUID, page, limit int) ([]model.Message, *model.PaginationMeta, error)
+	GetMessages(ctx context.Context, roomID uuid.UUID, userID uuid.UUID, page, limit int, deleted model.DeletedMessageMode) ([]model.MessageResponse, *model.PaginationMeta, error)
+	GetMessagesBefore(ctx context.Context, roomID uuid.UUID, userID uuid.UUID, before string, limit int, deleted model.DeletedMessageMode) ([]model.MessageResponse, *model.CursorPaginationMeta, error)
 	GetMessageByID(ctx context.Context, messageID uuid.UUID, userID uuid.UUID) (*model.Message, error)
 	EditMessage(ctx context.Context, messageID uuid.UUID, req *model.EditMessageRequest, userID uuid.UUID) (*model.Message, error)
-	DeleteMessage(ctx context.Context, messageID uuid.UUID, userID uuid.UUID) error
+	DeleteMessage(ctx context.Context, messageID uuid.UUID, userID uuid.UUID, mode model.DeleteMessageMode) error
+	GetMessageHistory(ctx context.Context, messageID uuid.UUID, userID uuid.UUID) ([]model.MessageEdit, error)
+	GetThreadMessages(ctx context.Context, messageID uuid.UUID, userID uuid.UUID, page, limit int) ([]model.MessageResponse, *model.PaginationMeta, error)
+	ForwardMessage(ctx context.Context, messageID uuid.UUID, roomIDs []uuid.UUID, userID uuid.UUID) ([]model.ForwardResult, error)
+
+	// Drafts
+	GetDraft(ctx context.Context, roomID, userID uuid.UUID) (*model.MessageDraft, error)
+	SaveDraft(ctx context.Context, roomID uuid.UUID, req *model.SaveDraftRequest, userID uuid.UUID) (*model.MessageDraft, error)
+	DeleteDraft(ctx context.Context, roomID, userID uuid.UUID) error
+
+	// Scheduled Messages
+	ScheduleMessage(ctx context.Context, req *model.SendMessageRequest, senderID uuid.UUID) (*model.ScheduledMessage, error)
+	GetScheduledMessages(ctx context.Context, roomID, userID uuid.UUID) ([]model.ScheduledMessage, error)
+	CancelScheduledMessage(ctx context.Context, scheduledID, userID uuid.UUID) error
+	DispatchScheduledMessages(ctx context.Context) (int, error)
+
+	// Retention
+	EnforceRetention(ctx context.Context) (int64, error)
+
+	// Pinned Messages
+	PinMessage(ctx context.Context, roomID, messageID, userID uuid.UUID) (*model.RoomPinnedMessage, error)
+	UnpinMessage(ctx context.Context, roomID, messageID, userID uuid.UUID) error
+	GetPinnedMessages(ctx context.Context, roomID, userID uuid.UUID) ([]model.RoomPinnedMessage, error)
+
+	// Message Search
+	SearchRoomMessages(ctx context.Context, roomID uuid.UUID, userID uuid.UUID, query string, page, limit int) ([]model.MessageResponse, *model.PaginationMeta, error)
+	SearchUserMessages(ctx context.Context, userID uuid.UUID, query string, page, limit int) ([]model.MessageResponse, *model.PaginationMeta, error)
+	GetMentions(ctx context.Context, userID uuid.UUID, page, limit int) ([]model.MessageResponse, *model.PaginationMeta, error)
+
+	// Export
+	PrepareRoomExport(ctx context.Context, roomID, userID uuid.UUID, format string) (*model.Room, error)
+	ExportRoom(ctx context.Context, room *model.Room, userID uuid.UUID, format string, w io.Writer) error
 
 	// Message Reactions
-	ReactToMessage(ctx context.Context, messageID uuid.UUID, req *model.ReactToMessageRequest, userID uuid.UUID) error
+	ReactToMessage(ctx context.Context, messageID uuid.UUID, req *model.ReactToMessageRequest, userID uuid.UUID) (*model.ReactionResult, error)
 	RemoveReaction(ctx context.Context, messageID uuid.UUID, emoji string, userID uuid.UUID) error
 
 	// Message Read Status
 	MarkAsRead(ctx context.Context, messageID uuid.UUID, userID uuid.UUID) error
+	MarkRoomAsRead(ctx context.Context, roomID, userID uuid.UUID, upToMessageID *uuid.UUID) (time.Time, error)
+	GetAllUnreadCounts(ctx context.Context, userID uuid.UUID) (map[uuid.UUID]int64, error)
+	MarkDelivered(ctx context.Context, userID uuid.UUID, messageIDs []uuid.UUID) error
+	RecordDeliveries(ctx context.Context, deliveries []model.MessageDelivery) error
+	GetMessageReactions(ctx context.Context, messageID, userID uuid.UUID, emoji string, page, limit int) ([]model.MessageReaction, *model.PaginationMeta, error)
+	LoadReactionDetails(ctx context.Context, responses []model.MessageResponse) error
 
 	// Typing Indicators
 	StartTyping(ctx context.Context, roomID uuid.UUID, userID uuid.UUID) error
@@ -37,29 +82,25 @@ type messageService struct {
 	messageRepo    repository.MessageRepository
 	roomRepo       repository.RoomRepository
 	userRepo       repository.UserRepository
+	fileService    FileService
 	redis          *redis.Redis
 	eventPublisher *events.EventPublisher
 }
 
-func NewMessageService(messageRepo repository.MessageRepository, roomRepo repository.RoomRepository, userRepo repository.UserRepository, redis *redis.Redis) MessageService {
+func NewMessageService(messageRepo repository.MessageRepository, roomRepo repository.RoomRepository, userRepo repository.UserRepository, fileService FileService, redis *redis.Redis) MessageService {
 	return &messageService{
 		messageRepo:    messageRepo,
 		roomRepo:       roomRepo,
 		userRepo:       userRepo,
+		fileService:    fileService,
 		redis:          redis,
 		eventPublisher: events.NewEventPublisher(redis),
 	}
 }
 
-func (s *messageService) SendMessage(ctx context.Context, req *model.SendMessageRequest, senderID uuid.UUID) (*model.Message, error) {
-	// Validate sender is member of the room
-	isMember, err := s.roomRepo.IsUserInRoom(ctx, req.RoomID, senderID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check room membership: %w", err)
-	}
-	if !isMember {
-		return nil, fmt.Errorf("access denied: user is not a member of this room")
-	}
+func (s *messageService) SendMessage(ctx context.Context, req *model.SendMessageRequest, senderID uuid.UUID) (_ *model.Message, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.SendMessage", tracing.ID("room_id", req.RoomID), tracing.ID("sender_id", senderID))
+	defer func() { tracing.End(span, err) }()
 
 	// Get room to check settings
 	room, err := s.roomRepo.GetByID(ctx, req.RoomID)
@@ -67,26 +108,22 @@ func (s *messageService) SendMessage(ctx context.Context, req *model.SendMessage
 		return nil, fmt.Errorf("failed to get room: %w", err)
 	}
 	if room == nil {
-		return nil, fmt.Errorf("room not found")
+		return nil, ErrRoomNotFound
 	}
 
-	// Check if room allows posting from this user
-	if room.OnlyAdminCanPost {
-		members, err := s.roomRepo.GetRoomMembers(ctx, req.RoomID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get room members: %w", err)
-		}
+	// Check the sender is a member allowed to post in the room
+	if err := s.checkCanPost(ctx, room, senderID); err != nil {
+		return nil, err
+	}
 
-		isAdmin := false
-		for _, member := range members {
-			if member.UserID == senderID && (member.Role == "admin" || member.Role == "owner") {
-				isAdmin = true
-				break
-			}
+	// Replies must stay in the room of the message they answer
+	if req.ReplyToID != nil {
+		parent, err := s.messageRepo.GetByID(ctx, *req.ReplyToID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get replied message: %w", err)
 		}
-
-		if !isAdmin {
-			return nil, fmt.Errorf("access denied: only admins can post in this room")
+		if parent == nil || parent.RoomID != req.RoomID {
+			return nil, fmt.Errorf("%w: replied message not found in this room", ErrInvalidArgument)
 		}
 	}
 
@@ -94,20 +131,57 @@ func (s *messageService) SendMessage(ctx context.Context, req *model.SendMessage
 	if req.Type == "" {
 		req.Type = "text"
 	}
+	if err := normalizeAttachments(req); err != nil {
+		return nil, err
+	}
+
+	// Uploaded files are referenced by the attachments
+	var attachments []model.MessageAttachment
+	if len(req.FileIDs) > 0 {
+		if s.fileService == nil {
+			return nil, fmt.Errorf("%w: file attachments are not supported", ErrInvalidArgument)
+		}
+		attachments, err = s.fileService.Attachments(ctx, senderID, req.FileIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := checkMessageTypeAllowed(room, req.Type, attachments); err != nil {
+		return nil, err
+	}
+
+	metadata, err := s.mentionMetadata(ctx, req.Content, req.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	slowModeKey, err := s.checkSlowMode(ctx, room, senderID)
+	if err != nil {
+		return nil, err
+	}
 
 	// Create message
 	message := &model.Message{
-		RoomID:    req.RoomID,
-		SenderID:  senderID,
-		Type:      req.Type,
-		Content:   req.Content,
-		Metadata:  req.Metadata,
-		ReplyToID: req.ReplyToID,
+		RoomID:      req.RoomID,
+		SenderID:    senderID,
+		Type:        req.Type,
+		Content:     req.Content,
+		Metadata:    metadata,
+		ReplyToID:   req.ReplyToID,
+		Attachments: attachments,
 	}
 
 	if err := s.messageRepo.Create(ctx, message); err != nil {
+		s.clearSlowMode(ctx, slowModeKey)
 		return nil, fmt.Errorf("failed to create message: %w", err)
 	}
+	health.MessagesSent.Inc()
+
+	if len(req.FileIDs) > 0 {
+		if err := s.fileService.KeepFiles(ctx, req.FileIDs); err != nil {
+			logger.Warn("Failed to keep attached files", logger.WithField("error", err.Error()))
+		}
+	}
 
 	// Load message with relationships
 	messageWithDetails, err := s.messageRepo.GetByID(ctx, message.ID)
@@ -117,16 +191,17 @@ func (s *messageService) SendMessage(ctx context.Context, req *model.SendMessage
 	}
 
 	// Publish message to Redis for real-time delivery
-	eventData := events.MessageEventData(message.ID, message.RoomID, &message.SenderID, map[string]interface{}{
-		"type":        message.Type,
-		"content":     message.Content,
-		"metadata":    message.Metadata,
-		"reply_to_id": message.ReplyToID,
-		"created_at":  message.CreatedAt,
-	})
+	s.publishMessageSent(ctx, message)
 
-	if err := s.eventPublisher.PublishMessageEvent(ctx, events.MessageSend, message.RoomID, message.ID, eventData, &message.SenderID); err != nil {
-		logger.Warn("Failed to publish message to Redis", logger.WithField("error", err.Error()))
+	recordActivity(&model.ActivityLog{
+		UserID:       &senderID,
+		ActivityType: ActivityMessageSent,
+		Description:  "Sent a message",
+	}, map[string]interface{}{"room_id": message.RoomID, "message_id": message.ID, "type": message.Type})
+
+	// The draft for the room has been sent
+	if _, err := s.messageRepo.DeleteDraft(ctx, senderID, req.RoomID); err != nil {
+		logger.Warn("Failed to delete message draft", logger.WithField("error", err.Error()))
 	}
 
 	// Stop typing indicator for sender
@@ -141,285 +216,1812 @@ func (s *messageService) SendMessage(ctx context.Context, req *model.SendMessage
 		"type":       message.Type,
 	}))
 
+	if messageWithDetails != nil {
+		messageWithDetails.Attachments = s.signAttachments(ctx, room.ID, messageWithDetails.Attachments, nil)
+	}
 	return messageWithDetails, nil
 }
 
-func (s *messageService) GetMessages(ctx context.Context, roomID uuid.UUID, userID uuid.UUID, page, limit int) ([]model.Message, *model.PaginationMeta, error) {
-	// Check if user is member of the room
-	isMember, err := s.roomRepo.IsUserInRoom(ctx, roomID, userID)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to check room membership: %w", err)
+// signAttachments gives attachments of messages in private rooms signed URLs
+// that expire, so only members who were handed the URLs can fetch the files.
+// private caches which rooms are private across calls and may be nil.
+func (s *messageService) signAttachments(ctx context.Context, roomID uuid.UUID, attachments []model.MessageAttachment, private map[uuid.UUID]bool) []model.MessageAttachment {
+	if s.fileService == nil || len(attachments) == 0 {
+		return attachments
 	}
-	if !isMember {
-		return nil, nil, fmt.Errorf("access denied: user is not a member of this room")
+
+	isPrivate, ok := private[roomID]
+	if !ok {
+		room, err := s.roomRepo.GetByID(ctx, roomID)
+		if err != nil || room == nil {
+			logger.Warn("Failed to get room for attachment URLs", logger.WithField("room_id", roomID))
+			return attachments
+		}
+		isPrivate = !room.IsPublic
+		if private != nil {
+			private[roomID] = isPrivate
+		}
 	}
+	if !isPrivate {
+		return attachments
+	}
+
+	signed := append([]model.MessageAttachment(nil), attachments...)
+	s.fileService.SignAttachments(ctx, signed)
+	return signed
+}
+
+// maxAttachments is how many uploads one message can attach
+const maxAttachments = 10
 
-	if page < 1 {
-		page = 1
+// attachmentMessageTypes are the message types that must carry an attachment
+var attachmentMessageTypes = map[string]bool{
+	"image": true,
+	"video": true,
+	"file":  true,
+}
+
+// normalizeAttachments merges AttachmentIDs into FileIDs, dropping
+// duplicates, and checks media messages attach something
+func normalizeAttachments(req *model.SendMessageRequest) error {
+	seen := make(map[uuid.UUID]bool, len(req.FileIDs)+len(req.AttachmentIDs))
+	var fileIDs []uuid.UUID
+	for _, id := range append(req.FileIDs, req.AttachmentIDs...) {
+		if !seen[id] {
+			seen[id] = true
+			fileIDs = append(fileIDs, id)
+		}
 	}
-	if limit < 1 {
-		limit = 20
+	req.FileIDs, req.AttachmentIDs = fileIDs, nil
+
+	if len(req.FileIDs) > maxAttachments {
+		return fmt.Errorf("%w: a message can attach at most %d files", ErrInvalidArgument, maxAttachments)
 	}
-	if limit > 100 {
-		limit = 100
+	if attachmentMessageTypes[req.Type] && len(req.FileIDs) == 0 {
+		return fmt.Errorf("%w: %s messages need an attachment", ErrInvalidArgument, req.Type)
 	}
+	return nil
+}
 
-	offset := (page - 1) * limit
-	messages, total, err := s.messageRepo.GetRoomMessages(ctx, roomID, offset, limit)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get messages: %w", err)
+// checkMessageTypeAllowed applies the room settings turning off file uploads,
+// voice and video messages, going by the message type and the MIME types of
+// the attachments. Images are always allowed.
+func checkMessageTypeAllowed(room *model.Room, messageType string, attachments []model.MessageAttachment) error {
+	file := messageType == "file"
+	voice := messageType == "voice_note" || messageType == "audio"
+	video := messageType == "video"
+	for _, attachment := range attachments {
+		switch {
+		case strings.HasPrefix(attachment.MimeType, "video/"):
+			video = true
+		case strings.HasPrefix(attachment.MimeType, "audio/"):
+			voice = true
+		case strings.HasPrefix(attachment.MimeType, "image/"):
+		default:
+			file = true
+		}
 	}
 
-	totalPages := (int(total) + limit - 1) / limit
+	switch {
+	case file && !room.AllowFileUpload:
+		return fmt.Errorf("%w: file uploads are turned off", ErrMessageTypeDisabled)
+	case voice && !room.AllowVoiceMessages:
+		return fmt.Errorf("%w: voice messages are turned off", ErrMessageTypeDisabled)
+	case video && !room.AllowVideoMessages:
+		return fmt.Errorf("%w: video messages are turned off", ErrMessageTypeDisabled)
+	}
+	return nil
+}
 
-	meta := &model.PaginationMeta{
-		Page:       page,
-		Limit:      limit,
-		Total:      int(total),
-		TotalPages: totalPages,
+// checkCanPost rejects posts from regular members of rooms where only admins
+// can post, and posts to direct rooms where either user blocked the other
+func (s *messageService) checkCanPost(ctx context.Context, room *model.Room, userID uuid.UUID) error {
+	if err := canPost(ctx, s.roomRepo, room, userID); err != nil {
+		return err
 	}
 
-	return messages, meta, nil
+	if otherID, ok := directRoomPeer(room, userID); ok {
+		blocked, err := isBlockedBetween(ctx, s.userRepo, s.redis, userID, otherID)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return ErrUserUnavailable
+		}
+	}
+	return nil
 }
 
-func (s *messageService) GetMessageByID(ctx context.Context, messageID uuid.UUID, userID uuid.UUID) (*model.Message, error) {
-	message, err := s.messageRepo.GetByID(ctx, messageID)
+// checkSlowMode starts the sender's cooldown in rooms with slow mode, failing
+// with a RateLimitError while one is running. Owners and admins are exempt.
+// It returns the key of the started cooldown, if any.
+func (s *messageService) checkSlowMode(ctx context.Context, room *model.Room, userID uuid.UUID) (string, error) {
+	if room.SlowModeSeconds <= 0 {
+		return "", nil
+	}
+
+	member, err := s.roomRepo.GetMember(ctx, room.ID, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get message: %w", err)
+		return "", err
 	}
-	if message == nil {
-		return nil, fmt.Errorf("message not found")
+	if isAdminOrOwner(member) {
+		return "", nil
 	}
 
-	// Check if user is member of the room
-	isMember, err := s.roomRepo.IsUserInRoom(ctx, message.RoomID, userID)
+	key := fmt.Sprintf("slowmode:%s:%s", room.ID, userID)
+	cooldown := time.Duration(room.SlowModeSeconds) * time.Second
+	started, err := s.redis.SetNX(ctx, key, "1", cooldown)
 	if err != nil {
-		return nil, fmt.Errorf("failed to check room membership: %w", err)
+		return "", fmt.Errorf("failed to check slow mode: %w", err)
 	}
-	if !isMember {
-		return nil, fmt.Errorf("access denied: user is not a member of this room")
+	if started {
+		return key, nil
 	}
 
-	return message, nil
+	retryAfter, err := s.redis.TTL(ctx, key)
+	if err != nil || retryAfter <= 0 {
+		retryAfter = cooldown
+	}
+	return "", &RateLimitError{RetryAfter: retryAfter}
 }
 
-func (s *messageService) EditMessage(ctx context.Context, messageID uuid.UUID, req *model.EditMessageRequest, userID uuid.UUID) (*model.Message, error) {
-	message, err := s.messageRepo.GetByID(ctx, messageID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get message: %w", err)
+// clearSlowMode drops a cooldown started by checkSlowMode for a message that
+// wasn't sent; the cooldown only applies to messages that were
+func (s *messageService) clearSlowMode(ctx context.Context, key string) {
+	if key == "" {
+		return
 	}
-	if message == nil {
-		return nil, fmt.Errorf("message not found")
+	if _, err := s.redis.Del(ctx, key); err != nil {
+		logger.Warn("Failed to clear slow mode cooldown", logger.WithField("error", err.Error()))
 	}
+}
 
-	// Check if user is the sender
-	if message.SenderID != userID {
-		return nil, fmt.Errorf("access denied: only the sender can edit this message")
+// publishMessageSent broadcasts a new message to the live clients of its room
+func (s *messageService) publishMessageSent(ctx context.Context, message *model.Message) {
+	eventData := events.MessageEventData(message.ID, message.RoomID, &message.SenderID, map[string]interface{}{
+		"type":        message.Type,
+		"content":     message.Content,
+		"metadata":    message.Metadata,
+		"reply_to_id": message.ReplyToID,
+		"attachments": s.signAttachments(ctx, message.RoomID, message.Attachments, nil),
+		"created_at":  message.CreatedAt,
+	})
+
+	if err := s.eventPublisher.PublishMessageEvent(ctx, events.MessageSend, message.RoomID, message.ID, eventData, &message.SenderID); err != nil {
+		logger.Warn("Failed to publish message to Redis", logger.WithField("error", err.Error()))
 	}
+}
 
-	// Check if message is too old to edit (optional)
-	if time.Since(message.CreatedAt) > 24*time.Hour {
-		return nil, fmt.Errorf("message is too old to edit")
+// ForwardMessage copies a message into each of the given rooms. Rooms the
+// caller can't post in are reported in the results rather than failing the
+// whole request.
+func (s *messageService) ForwardMessage(ctx context.Context, messageID uuid.UUID, roomIDs []uuid.UUID, userID uuid.UUID) (_ []model.ForwardResult, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.ForwardMessage", tracing.ID("message_id", messageID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	source, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	if source == nil || source.IsDeleted {
+		return nil, ErrMessageNotFound
 	}
 
-	// Update message
-	message.Content = req.Content
-	message.Metadata = req.Metadata
-	message.IsEdited = true
-	message.EditedAt = &[]time.Time{time.Now()}[0]
+	isMember, err := s.roomRepo.IsUserInRoom(ctx, source.RoomID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check room membership: %w", err)
+	}
+	if !isMember {
+		return nil, fmt.Errorf("%w: user is not a member of this room", ErrForbidden)
+	}
 
-	if err := s.messageRepo.Update(ctx, message); err != nil {
-		return nil, fmt.Errorf("failed to update message: %w", err)
+	metadata, err := forwardedMetadata(source)
+	if err != nil {
+		return nil, err
 	}
 
-	// Publish message edit event
-	eventData := events.MessageEventData(message.ID, message.RoomID, &message.SenderID, map[string]interface{}{
-		"content":   message.Content,
-		"metadata":  message.Metadata,
-		"is_edited": message.IsEdited,
-		"edited_at": message.EditedAt,
-	})
+	results := make([]model.ForwardResult, 0, len(roomIDs))
+	seen := make(map[uuid.UUID]bool, len(roomIDs))
+	for _, roomID := range roomIDs {
+		if seen[roomID] {
+			continue
+		}
+		seen[roomID] = true
 
-	if err := s.eventPublisher.PublishMessageEvent(ctx, events.MessageEdit, message.RoomID, message.ID, eventData, &message.SenderID); err != nil {
-		logger.Warn("Failed to publish message edit event", logger.WithField("error", err.Error()))
+		result := model.ForwardResult{RoomID: roomID}
+		forwarded, err := s.forwardToRoom(ctx, source, roomID, metadata, userID)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.MessageID = &forwarded.ID
+		}
+		results = append(results, result)
 	}
 
-	logger.Info("Message edited successfully", logger.WithFields(map[string]interface{}{
-		"message_id": message.ID,
-		"room_id":    message.RoomID,
-		"sender_id":  message.SenderID,
+	logger.Info("Message forwarded", logger.WithFields(map[string]interface{}{
+		"message_id": source.ID,
+		"user_id":    userID,
+		"rooms":      len(results),
 	}))
 
-	return message, nil
+	return results, nil
 }
 
-func (s *messageService) DeleteMessage(ctx context.Context, messageID uuid.UUID, userID uuid.UUID) error {
-	message, err := s.messageRepo.GetByID(ctx, messageID)
+// forwardToRoom creates the copy of source in one room. Attachments point at
+// the already uploaded files.
+func (s *messageService) forwardToRoom(ctx context.Context, source *model.Message, roomID uuid.UUID, metadata string, userID uuid.UUID) (*model.Message, error) {
+	isMember, err := s.roomRepo.IsUserInRoom(ctx, roomID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to get message: %w", err)
+		return nil, fmt.Errorf("failed to check room membership: %w", err)
 	}
-	if message == nil {
-		return fmt.Errorf("message not found")
+	if !isMember {
+		return nil, fmt.Errorf("%w: user is not a member of this room", ErrForbidden)
 	}
 
-	// Check if user is the sender or admin
-	canDelete := message.SenderID == userID
+	room, err := s.roomRepo.GetByID(ctx, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room: %w", err)
+	}
+	if room == nil {
+		return nil, ErrRoomNotFound
+	}
 
-	if !canDelete {
-		// Check if user is admin in the room
-		members, err := s.roomRepo.GetRoomMembers(ctx, message.RoomID)
-		if err != nil {
-			return fmt.Errorf("failed to get room members: %w", err)
-		}
+	if err := s.checkCanPost(ctx, room, userID); err != nil {
+		return nil, err
+	}
+	if err := checkMessageTypeAllowed(room, source.Type, source.Attachments); err != nil {
+		return nil, err
+	}
+	slowModeKey, err := s.checkSlowMode(ctx, room, userID)
+	if err != nil {
+		return nil, err
+	}
 
-		for _, member := range members {
-			if member.UserID == userID && (member.Role == "admin" || member.Role == "owner") {
-				canDelete = true
-				break
-			}
-		}
+	message := &model.Message{
+		RoomID:   roomID,
+		SenderID: userID,
+		Type:     source.Type,
+		Content:  source.Content,
+		Metadata: metadata,
+	}
+	for _, attachment := range source.Attachments {
+		message.Attachments = append(message.Attachments, model.MessageAttachment{
+			FileName:     attachment.FileName,
+			FileSize:     attachment.FileSize,
+			FileType:     attachment.FileType,
+			MimeType:     attachment.MimeType,
+			URL:          attachment.URL,
+			ThumbnailURL: attachment.ThumbnailURL,
+			Width:        attachment.Width,
+			Height:       attachment.Height,
+			Duration:     attachment.Duration,
+		})
 	}
 
-	if !canDelete {
-		return fmt.Errorf("access denied: only the sender or room admin can delete this message")
+	if err := s.messageRepo.Create(ctx, message); err != nil {
+		s.clearSlowMode(ctx, slowModeKey)
+		return nil, fmt.Errorf("failed to create message: %w", err)
 	}
+	health.MessagesSent.Inc()
 
-	// Soft delete by marking as deleted
-	message.IsDeleted = true
-	message.Content = "This message was deleted"
-	message.Metadata = ""
+	s.publishMessageSent(ctx, message)
+	return message, nil
+}
 
-	if err := s.messageRepo.Update(ctx, message); err != nil {
-		return fmt.Errorf("failed to delete message: %w", err)
+// forwardedMetadata adds a forwarded_from entry to the metadata of source
+// and drops its mentions
+func forwardedMetadata(source *model.Message) (string, error) {
+	metadata := map[string]interface{}{}
+	if source.Metadata != "" {
+		if err := json.Unmarshal([]byte(source.Metadata), &metadata); err != nil {
+			logger.Warn("Ignoring invalid message metadata", logger.WithField("message_id", source.ID))
+			metadata = map[string]interface{}{}
+		}
 	}
+	delete(metadata, "mentioned_users")
 
-	// Publish message deletion event
-	eventData := events.MessageEventData(message.ID, message.RoomID, &userID, map[string]interface{}{
-		"is_deleted": message.IsDeleted,
-	})
+	metadata["forwarded_from"] = map[string]interface{}{
+		"message_id": source.ID,
+		"room_id":    source.RoomID,
+		"sender_id":  source.SenderID,
+	}
 
-	if err := s.eventPublisher.PublishMessageEvent(ctx, events.MessageDelete, message.RoomID, message.ID, eventData, &userID); err != nil {
-		logger.Warn("Failed to publish message deletion event", logger.WithField("error", err.Error()))
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode message metadata: %w", err)
 	}
+	return string(encoded), nil
+}
 
-	logger.Info("Message deleted successfully", logger.WithFields(map[string]interface{}{
-		"message_id": message.ID,
-		"room_id":    message.RoomID,
-		"deleted_by": userID,
-	}))
+// GetMessages returns a page of room history, newest first. Only the first
+// page carries the total count; later pages report Total = -1 and rely on
+// HasMore.
+func (s *messageService) GetMessages(ctx context.Context, roomID uuid.UUID, userID uuid.UUID, page, limit int, deleted model.DeletedMessageMode) (_ []model.MessageResponse, _ *model.PaginationMeta, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.GetMessages", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
 
-	return nil
-}
+	// Check if user is member of the room
+	isMember, err := s.roomRepo.IsUserInRoom(ctx, roomID, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to check room membership: %w", err)
+	}
+	if !isMember {
+		return nil, nil, fmt.Errorf("%w: user is not a member of this room", ErrForbidden)
+	}
 
-func (s *messageService) ReactToMessage(ctx context.Context, messageID uuid.UUID, req *model.ReactToMessageRequest, userID uuid.UUID) error {
-	message, err := s.messageRepo.GetByID(ctx, messageID)
+	page, limit = normalizePage(page, limit)
+
+	// Fetch one extra row to know whether another page exists
+	offset := (page - 1) * limit
+	messages, err := s.messageRepo.GetRoomMessages(ctx, roomID, userID, offset, limit+1, deleted)
 	if err != nil {
-		return fmt.Errorf("failed to get message: %w", err)
+		return nil, nil, fmt.Errorf("failed to get messages: %w", err)
 	}
-	if message == nil {
-		return fmt.Errorf("message not found")
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	responses, err := s.buildMessageResponses(ctx, messages, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Counting is expensive on large rooms, so it only happens for the first
+	// page, and only when the page itself doesn't already tell the total
+	if page > 1 {
+		return responses, &model.PaginationMeta{
+			Page:       page,
+			Limit:      limit,
+			Total:      -1,
+			TotalPages: -1,
+			HasMore:    hasMore,
+		}, nil
+	}
+
+	total := int64(len(messages))
+	if hasMore {
+		total, err = s.messageRepo.CountRoomMessages(ctx, roomID, userID, deleted)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to count messages: %w", err)
+		}
 	}
 
+	return responses, newPaginationMeta(page, limit, total), nil
+}
+
+// GetMessagesBefore pages backwards through room history starting at the
+// cursor, which is either a message ID or an RFC3339 timestamp. An empty
+// cursor starts from the most recent message.
+func (s *messageService) GetMessagesBefore(ctx context.Context, roomID uuid.UUID, userID uuid.UUID, before string, limit int, deleted model.DeletedMessageMode) (_ []model.MessageResponse, _ *model.CursorPaginationMeta, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.GetMessagesBefore", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
 	// Check if user is member of the room
-	isMember, err := s.roomRepo.IsUserInRoom(ctx, message.RoomID, userID)
+	isMember, err := s.roomRepo.IsUserInRoom(ctx, roomID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to check room membership: %w", err)
+		return nil, nil, fmt.Errorf("failed to check room membership: %w", err)
 	}
 	if !isMember {
-		return fmt.Errorf("access denied: user is not a member of this room")
+		return nil, nil, fmt.Errorf("%w: user is not a member of this room", ErrForbidden)
 	}
 
-	// Add or update reaction
-	reaction := &model.MessageReaction{
-		MessageID: messageID,
-		UserID:    userID,
-		Emoji:     req.Emoji,
+	cursor, err := s.parseMessageCursor(ctx, roomID, before)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if err := s.messageRepo.AddReaction(ctx, reaction); err != nil {
-		return fmt.Errorf("failed to add reaction: %w", err)
+	_, limit = normalizePage(1, limit)
+
+	// Fetch one extra row to know whether another page exists
+	messages, err := s.messageRepo.GetRoomMessagesBefore(ctx, roomID, userID, cursor, limit+1, deleted)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get messages: %w", err)
 	}
 
-	// Publish reaction event
-	eventData := events.MessageEventData(messageID, message.RoomID, &userID, map[string]interface{}{
-		"emoji": req.Emoji,
-	})
+	meta := &model.CursorPaginationMeta{Limit: limit}
+	if len(messages) > limit {
+		messages = messages[:limit]
+		meta.HasMore = true
+		meta.NextCursor = messages[len(messages)-1].ID.String()
+	}
 
-	if err := s.eventPublisher.PublishMessageEvent(ctx, events.MessageReactionAdd, message.RoomID, messageID, eventData, &userID); err != nil {
-		logger.Warn("Failed to publish reaction event", logger.WithField("error", err.Error()))
+	responses, err := s.buildMessageResponses(ctx, messages, userID)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return nil
+	return responses, meta, nil
 }
 
-func (s *messageService) RemoveReaction(ctx context.Context, messageID uuid.UUID, emoji string, userID uuid.UUID) error {
-	message, err := s.messageRepo.GetByID(ctx, messageID)
-	if err != nil {
-		return fmt.Errorf("failed to get message: %w", err)
-	}
-	if message == nil {
-		return fmt.Errorf("message not found")
+// parseMessageCursor resolves a before parameter into a repository cursor.
+// Message IDs must refer to an existing message in the room.
+func (s *messageService) parseMessageCursor(ctx context.Context, roomID uuid.UUID, before string) (*repository.MessageCursor, error) {
+	if before == "" {
+		return nil, nil
 	}
 
-	if err := s.messageRepo.RemoveReaction(ctx, messageID, userID, emoji); err != nil {
-		return fmt.Errorf("failed to remove reaction: %w", err)
+	if messageID, err := uuid.Parse(before); err == nil {
+		message, err := s.messageRepo.GetByID(ctx, messageID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cursor message: %w", err)
+		}
+		if message == nil || message.RoomID != roomID {
+			return nil, fmt.Errorf("%w: cursor message not found in this room", ErrNotFound)
+		}
+		return &repository.MessageCursor{CreatedAt: message.CreatedAt, MessageID: &message.ID}, nil
 	}
 
-	// Publish reaction removal event
-	eventData := events.MessageEventData(messageID, message.RoomID, &userID, map[string]interface{}{
-		"emoji": emoji,
-	})
-
-	if err := s.eventPublisher.PublishMessageEvent(ctx, events.MessageReactionRemove, message.RoomID, messageID, eventData, &userID); err != nil {
-		logger.Warn("Failed to publish reaction removal event", logger.WithField("error", err.Error()))
+	if timestamp, err := time.Parse(time.RFC3339Nano, before); err == nil {
+		return &repository.MessageCursor{CreatedAt: timestamp}, nil
 	}
 
-	return nil
+	return nil, fmt.Errorf("%w: cursor must be a message ID or RFC3339 timestamp", ErrInvalidArgument)
 }
 
-func (s *messageService) MarkAsRead(ctx context.Context, messageID uuid.UUID, userID uuid.UUID) error {
+func (s *messageService) GetMessageByID(ctx context.Context, messageID uuid.UUID, userID uuid.UUID) (_ *model.Message, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.GetMessageByID", tracing.ID("message_id", messageID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
 	message, err := s.messageRepo.GetByID(ctx, messageID)
 	if err != nil {
-		return fmt.Errorf("failed to get message: %w", err)
+		return nil, fmt.Errorf("failed to get message: %w", err)
 	}
 	if message == nil {
-		return fmt.Errorf("message not found")
+		return nil, ErrMessageNotFound
 	}
 
 	// Check if user is member of the room
 	isMember, err := s.roomRepo.IsUserInRoom(ctx, message.RoomID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to check room membership: %w", err)
+		return nil, fmt.Errorf("failed to check room membership: %w", err)
 	}
 	if !isMember {
-		return fmt.Errorf("access denied: user is not a member of this room")
-	}
-
-	// Mark message as read
-	if err := s.messageRepo.MarkAsRead(ctx, messageID, userID); err != nil {
-		return fmt.Errorf("failed to mark message as read: %w", err)
+		return nil, fmt.Errorf("%w: user is not a member of this room", ErrForbidden)
 	}
 
-	// Publish read event
-	eventData := events.MessageEventData(messageID, message.RoomID, &userID, map[string]interface{}{
-		"read_at": time.Now(),
-	})
+	return message, nil
+}
 
-	if err := s.eventPublisher.PublishMessageEvent(ctx, events.MessageRead, message.RoomID, messageID, eventData, &userID); err != nil {
-		logger.Warn("Failed to publish read event", logger.WithField("error", err.Error()))
-	}
+func (s *messageService) EditMessage(ctx context.Context, messageID uuid.UUID, req *model.EditMessageRequest, userID uuid.UUID) (_ *model.Message, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.EditMessage", tracing.ID("message_id", messageID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	if message == nil {
+		return nil, ErrMessageNotFound
+	}
+
+	// Check if user is the sender
+	if message.SenderID != userID {
+		return nil, fmt.Errorf("%w: only the sender can edit this message", ErrForbidden)
+	}
+
+	// Check if message is too old to edit (optional)
+	if time.Since(message.CreatedAt) > 24*time.Hour {
+		return nil, fmt.Errorf("%w: message is too old to edit", ErrForbidden)
+	}
+
+	metadata, err := s.mentionMetadata(ctx, req.Content, req.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the previous content before overwriting it
+	editedAt := time.Now()
+	edit := &model.MessageEdit{
+		PreviousContent:  message.Content,
+		PreviousMetadata: message.Metadata,
+		EditedBy:         userID,
+		EditedAt:         editedAt,
+	}
+
+	// Update message
+	message.Content = req.Content
+	message.Metadata = metadata
+	message.IsEdited = true
+	message.EditedAt = &editedAt
+
+	if err := s.messageRepo.UpdateWithEdit(ctx, message, edit); err != nil {
+		return nil, fmt.Errorf("failed to update message: %w", err)
+	}
+
+	// Publish message edit event; the revision lets clients notice missed edits
+	eventData := events.MessageEventData(message.ID, message.RoomID, &message.SenderID, map[string]interface{}{
+		"content":   message.Content,
+		"metadata":  message.Metadata,
+		"is_edited": message.IsEdited,
+		"edited_at": message.EditedAt,
+		"revision":  edit.Revision,
+	})
+
+	if err := s.eventPublisher.PublishMessageEvent(ctx, events.MessageEdit, message.RoomID, message.ID, eventData, &message.SenderID); err != nil {
+		logger.Warn("Failed to publish message edit event", logger.WithField("error", err.Error()))
+	}
+
+	logger.Info("Message edited successfully", logger.WithFields(map[string]interface{}{
+		"message_id": message.ID,
+		"room_id":    message.RoomID,
+		"sender_id":  message.SenderID,
+	}))
+
+	return message, nil
+}
+
+// GetThreadMessages returns the replies to a message, oldest first
+func (s *messageService) GetThreadMessages(ctx context.Context, messageID uuid.UUID, userID uuid.UUID, page, limit int) (_ []model.MessageResponse, _ *model.PaginationMeta, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.GetThreadMessages", tracing.ID("message_id", messageID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	parent, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	if parent == nil {
+		return nil, nil, ErrMessageNotFound
+	}
+
+	isMember, err := s.roomRepo.IsUserInRoom(ctx, parent.RoomID, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to check room membership: %w", err)
+	}
+	if !isMember {
+		return nil, nil, fmt.Errorf("%w: user is not a member of this room", ErrForbidden)
+	}
+
+	page, limit = normalizePage(page, limit)
+	offset := (page - 1) * limit
+
+	replies, total, err := s.messageRepo.GetThreadMessages(ctx, messageID, offset, limit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get thread messages: %w", err)
+	}
+
+	responses, err := s.buildMessageResponses(ctx, replies, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return responses, newPaginationMeta(page, limit, total), nil
+}
+
+// GetMessageHistory returns the earlier versions of a message, oldest first.
+// The history of a message deleted for everyone is gone with it.
+func (s *messageService) GetMessageHistory(ctx context.Context, messageID uuid.UUID, userID uuid.UUID) (_ []model.MessageEdit, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.GetMessageHistory", tracing.ID("message_id", messageID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	if message == nil || message.IsDeleted {
+		return nil, ErrMessageNotFound
+	}
+
+	isMember, err := s.roomRepo.IsUserInRoom(ctx, message.RoomID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check room membership: %w", err)
+	}
+	if !isMember {
+		return nil, fmt.Errorf("%w: user is not a member of this room", ErrForbidden)
+	}
+
+	edits, err := s.messageRepo.GetMessageEdits(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message history: %w", err)
+	}
+
+	return edits, nil
+}
+
+// deleteForEveryoneWindow is how long after sending a sender may still delete
+// a message for everyone; room admins are not limited
+const deleteForEveryoneWindow = time.Hour
+
+// DeleteMessage deletes a message for everyone in the room, or only hides it
+// from the user's own history
+func (s *messageService) DeleteMessage(ctx context.Context, messageID uuid.UUID, userID uuid.UUID, mode model.DeleteMessageMode) (err error) {
+	ctx, span := tracing.Start(ctx, "service.message.DeleteMessage", tracing.ID("message_id", messageID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to get message: %w", err)
+	}
+	if message == nil {
+		return ErrMessageNotFound
+	}
+
+	switch mode {
+	case model.DeleteForMe:
+		return s.hideMessage(ctx, message, userID)
+	case model.DeleteForEveryone:
+	default:
+		return fmt.Errorf("%w: unknown delete mode %q", ErrInvalidArgument, mode)
+	}
+
+	// Admins can always delete for everyone, senders only within the window
+	member, err := s.roomRepo.GetMember(ctx, message.RoomID, userID)
+	if err != nil {
+		return err
+	}
+
+	if !isAdminOrOwner(member) {
+		if message.SenderID != userID {
+			return fmt.Errorf("%w: only the sender or room admin can delete this message for everyone", ErrForbidden)
+		}
+		if time.Since(message.CreatedAt) > deleteForEveryoneWindow {
+			return fmt.Errorf("%w: message is too old to delete for everyone", ErrForbidden)
+		}
+	}
+
+	// Soft delete by marking as deleted
+	message.IsDeleted = true
+	message.Content = "This message was deleted"
+	message.Metadata = ""
+
+	if err := s.messageRepo.Update(ctx, message); err != nil {
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+
+	// Publish message deletion event
+	eventData := events.MessageEventData(message.ID, message.RoomID, &userID, map[string]interface{}{
+		"is_deleted": message.IsDeleted,
+	})
+
+	if err := s.eventPublisher.PublishMessageEvent(ctx, events.MessageDelete, message.RoomID, message.ID, eventData, &userID); err != nil {
+		logger.Warn("Failed to publish message deletion event", logger.WithField("error", err.Error()))
+	}
+
+	logger.Info("Message deleted successfully", logger.WithFields(map[string]interface{}{
+		"message_id": message.ID,
+		"room_id":    message.RoomID,
+		"deleted_by": userID,
+	}))
+
+	return nil
+}
+
+// hideMessage deletes a message for one member only. Nothing is broadcast
+// since the other members still see the message.
+func (s *messageService) hideMessage(ctx context.Context, message *model.Message, userID uuid.UUID) error {
+	isMember, err := s.roomRepo.IsUserInRoom(ctx, message.RoomID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check room membership: %w", err)
+	}
+	if !isMember {
+		return fmt.Errorf("%w: user is not a member of this room", ErrForbidden)
+	}
+
+	if err := s.messageRepo.HideMessage(ctx, message.ID, userID); err != nil {
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+
+	return nil
+}
+
+// GetDraft returns the user's unsent draft for the room
+func (s *messageService) GetDraft(ctx context.Context, roomID, userID uuid.UUID) (_ *model.MessageDraft, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.GetDraft", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkMembership(ctx, roomID, userID); err != nil {
+		return nil, err
+	}
+
+	draft, err := s.messageRepo.GetDraft(ctx, userID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if draft == nil {
+		return nil, fmt.Errorf("%w: no draft for this room", ErrNotFound)
+	}
+	return draft, nil
+}
+
+// SaveDraft stores the user's draft for the room, replacing any earlier one
+func (s *messageService) SaveDraft(ctx context.Context, roomID uuid.UUID, req *model.SaveDraftRequest, userID uuid.UUID) (_ *model.MessageDraft, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.SaveDraft", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkMembership(ctx, roomID, userID); err != nil {
+		return nil, err
+	}
+
+	if req.ReplyToID != nil {
+		parent, err := s.messageRepo.GetByID(ctx, *req.ReplyToID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get replied message: %w", err)
+		}
+		if parent == nil || parent.RoomID != roomID {
+			return nil, fmt.Errorf("%w: replied message not found in this room", ErrInvalidArgument)
+		}
+	}
+
+	draft := &model.MessageDraft{
+		UserID:    userID,
+		RoomID:    roomID,
+		Content:   req.Content,
+		ReplyToID: req.ReplyToID,
+	}
+	if err := s.messageRepo.SaveDraft(ctx, draft); err != nil {
+		return nil, err
+	}
+
+	return s.messageRepo.GetDraft(ctx, userID, roomID)
+}
+
+// DeleteDraft discards the user's draft for the room
+func (s *messageService) DeleteDraft(ctx context.Context, roomID, userID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.message.DeleteDraft", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkMembership(ctx, roomID, userID); err != nil {
+		return err
+	}
+
+	deleted, err := s.messageRepo.DeleteDraft(ctx, userID, roomID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("%w: no draft for this room", ErrNotFound)
+	}
+	return nil
+}
+
+func (s *messageService) checkMembership(ctx context.Context, roomID, userID uuid.UUID) error {
+	isMember, err := s.roomRepo.IsUserInRoom(ctx, roomID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check room membership: %w", err)
+	}
+	if !isMember {
+		return fmt.Errorf("%w: user is not a member of this room", ErrForbidden)
+	}
+	return nil
+}
+
+// scheduledDispatchBatch is how many due messages one dispatch pass sends
+const scheduledDispatchBatch = 100
+
+// ScheduleMessage stores a message to be sent at req.ScheduledAt. The checks
+// SendMessage makes are done now as well, so obvious mistakes surface to the
+// author right away; they are repeated when the message goes out.
+func (s *messageService) ScheduleMessage(ctx context.Context, req *model.SendMessageRequest, senderID uuid.UUID) (_ *model.ScheduledMessage, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.ScheduleMessage", tracing.ID("room_id", req.RoomID), tracing.ID("sender_id", senderID))
+	defer func() { tracing.End(span, err) }()
+
+	if req.ScheduledAt == nil || !req.ScheduledAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: scheduled_at must be in the future", ErrInvalidArgument)
+	}
+	if err := normalizeAttachments(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkMembership(ctx, req.RoomID, senderID); err != nil {
+		return nil, err
+	}
+
+	room, err := s.roomRepo.GetByID(ctx, req.RoomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room: %w", err)
+	}
+	if room == nil {
+		return nil, ErrRoomNotFound
+	}
+	if err := s.checkCanPost(ctx, room, senderID); err != nil {
+		return nil, err
+	}
+
+	if req.ReplyToID != nil {
+		parent, err := s.messageRepo.GetByID(ctx, *req.ReplyToID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get replied message: %w", err)
+		}
+		if parent == nil || parent.RoomID != req.RoomID {
+			return nil, fmt.Errorf("%w: replied message not found in this room", ErrInvalidArgument)
+		}
+	}
+
+	var fileIDs string
+	if len(req.FileIDs) > 0 {
+		if s.fileService == nil {
+			return nil, fmt.Errorf("%w: file attachments are not supported", ErrInvalidArgument)
+		}
+		if _, err := s.fileService.Attachments(ctx, senderID, req.FileIDs); err != nil {
+			return nil, err
+		}
+		// Attached files must still be there when the message goes out
+		if err := s.fileService.KeepFiles(ctx, req.FileIDs); err != nil {
+			return nil, err
+		}
+
+		encoded, err := json.Marshal(req.FileIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode file IDs: %w", err)
+		}
+		fileIDs = string(encoded)
+	}
+
+	messageType := req.Type
+	if messageType == "" {
+		messageType = "text"
+	}
+
+	scheduled := &model.ScheduledMessage{
+		RoomID:      req.RoomID,
+		SenderID:    senderID,
+		ReplyToID:   req.ReplyToID,
+		Type:        messageType,
+		Content:     req.Content,
+		Metadata:    req.Metadata,
+		FileIDs:     fileIDs,
+		ScheduledAt: *req.ScheduledAt,
+		Status:      model.ScheduledMessagePending,
+	}
+	if err := s.messageRepo.CreateScheduled(ctx, scheduled); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Message scheduled", logger.WithFields(map[string]interface{}{
+		"scheduled_id": scheduled.ID,
+		"room_id":      scheduled.RoomID,
+		"sender_id":    senderID,
+		"scheduled_at": scheduled.ScheduledAt,
+	}))
+
+	return scheduled, nil
+}
+
+// GetScheduledMessages returns the user's pending messages for a room
+func (s *messageService) GetScheduledMessages(ctx context.Context, roomID, userID uuid.UUID) (_ []model.ScheduledMessage, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.GetScheduledMessages", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkMembership(ctx, roomID, userID); err != nil {
+		return nil, err
+	}
+
+	return s.messageRepo.GetPendingScheduled(ctx, roomID, userID)
+}
+
+// CancelScheduledMessage cancels a pending message of the user
+func (s *messageService) CancelScheduledMessage(ctx context.Context, scheduledID, userID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.message.CancelScheduledMessage", tracing.ID("scheduled_id", scheduledID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	scheduled, err := s.messageRepo.GetScheduledByID(ctx, scheduledID)
+	if err != nil {
+		return err
+	}
+	if scheduled == nil || scheduled.SenderID != userID {
+		return fmt.Errorf("%w: scheduled message not found", ErrNotFound)
+	}
+
+	cancelled, err := s.messageRepo.UpdateScheduledStatus(ctx, scheduledID,
+		model.ScheduledMessagePending, model.ScheduledMessageCancelled, nil)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return fmt.Errorf("%w: scheduled message was already %s", ErrInvalidArgument, scheduled.Status)
+	}
+	return nil
+}
+
+// DispatchScheduledMessages sends the messages that are due through
+// SendMessage and returns how many were sent. Messages of authors who left
+// the room in the meantime are cancelled.
+func (s *messageService) DispatchScheduledMessages(ctx context.Context) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.DispatchScheduledMessages")
+	defer func() { tracing.End(span, err) }()
+
+	due, err := s.messageRepo.GetDueScheduled(ctx, time.Now(), scheduledDispatchBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, scheduled := range due {
+		claimed, err := s.messageRepo.UpdateScheduledStatus(ctx, scheduled.ID,
+			model.ScheduledMessagePending, model.ScheduledMessageSending, nil)
+		if err != nil {
+			return sent, err
+		}
+		if !claimed {
+			continue // cancelled or picked up by another instance
+		}
+
+		status, fields := s.dispatchScheduled(ctx, &scheduled)
+		if _, err := s.messageRepo.UpdateScheduledStatus(ctx, scheduled.ID,
+			model.ScheduledMessageSending, status, fields); err != nil {
+			return sent, err
+		}
+		if status == model.ScheduledMessageSent {
+			sent++
+		}
+	}
+
+	return sent, nil
+}
+
+// defaultRetentionBatchSize is how many expired messages are removed per
+// transaction when no batch size is configured
+const defaultRetentionBatchSize = 1000
+
+// retentionSettings returns the batch size of the retention job and whether
+// it removes expired messages from the database
+func retentionSettings() (int, bool) {
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return defaultRetentionBatchSize, false
+	}
+	batchSize := cfg.Room.RetentionBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultRetentionBatchSize
+	}
+	return batchSize, cfg.Room.RetentionHardDelete
+}
+
+// EnforceRetention deletes the messages that are older than the retention
+// period of their room, in batches, and returns how many were deleted. Rooms
+// keeping messages forever are skipped.
+func (s *messageService) EnforceRetention(ctx context.Context) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.EnforceRetention")
+	defer func() { tracing.End(span, err) }()
+
+	rooms, err := s.roomRepo.GetRoomsWithRetention(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	for _, room := range rooms {
+		if err := ctx.Err(); err != nil {
+			return deleted, err
+		}
+
+		count, err := s.expireRoomMessages(ctx, &room)
+		deleted += count
+		if err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
+
+// expireRoomMessages deletes the messages of a room past its retention
+// period, then tells the members which messages are gone
+func (s *messageService) expireRoomMessages(ctx context.Context, room *model.Room) (int64, error) {
+	batchSize, hard := retentionSettings()
+	cutoff := time.Now().AddDate(0, 0, -room.MessageRetentionDays)
+
+	var deleted int64
+	for {
+		count, attachments, err := s.messageRepo.ExpireMessages(ctx, room.ID, cutoff, batchSize, hard)
+		if err != nil {
+			return deleted, err
+		}
+		deleted += count
+
+		if len(attachments) > 0 && s.fileService != nil {
+			if err := s.fileService.DeleteAttachmentFiles(ctx, attachments); err != nil {
+				logger.Warn("Failed to remove expired attachments", logger.WithFields(map[string]interface{}{
+					"room_id": room.ID,
+					"error":   err.Error(),
+				}))
+			}
+		}
+
+		if count < int64(batchSize) {
+			break
+		}
+	}
+
+	if deleted == 0 {
+		return 0, nil
+	}
+
+	logger.Info("Expired room messages deleted", logger.WithFields(map[string]interface{}{
+		"room_id":        room.ID,
+		"retention_days": room.MessageRetentionDays,
+		"deleted":        deleted,
+	}))
+
+	// Clients drop the messages sent before the cutoff from their caches
+	eventData := events.RoomEventData(room.ID, nil, map[string]interface{}{
+		"before":         cutoff,
+		"deleted":        deleted,
+		"retention_days": room.MessageRetentionDays,
+		"hard_delete":    hard,
+	})
+	if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomMessagesExpire, room.ID, eventData, nil); err != nil {
+		logger.Warn("Failed to publish messages expired event", logger.WithField("error", err.Error()))
+	}
+
+	return deleted, nil
+}
+
+// dispatchScheduled sends one claimed message and returns its final status
+func (s *messageService) dispatchScheduled(ctx context.Context, scheduled *model.ScheduledMessage) (string, map[string]interface{}) {
+	isMember, err := s.roomRepo.IsUserInRoom(ctx, scheduled.RoomID, scheduled.SenderID)
+	if err != nil {
+		return model.ScheduledMessageFailed, map[string]interface{}{"error": err.Error()}
+	}
+	if !isMember {
+		return model.ScheduledMessageCancelled, map[string]interface{}{"error": "sender is no longer a member of the room"}
+	}
+
+	req := &model.SendMessageRequest{
+		RoomID:    scheduled.RoomID,
+		Content:   scheduled.Content,
+		Type:      scheduled.Type,
+		ReplyToID: scheduled.ReplyToID,
+		Metadata:  scheduled.Metadata,
+	}
+	if scheduled.FileIDs != "" {
+		if err := json.Unmarshal([]byte(scheduled.FileIDs), &req.FileIDs); err != nil {
+			return model.ScheduledMessageFailed, map[string]interface{}{"error": err.Error()}
+		}
+	}
+
+	message, err := s.SendMessage(ctx, req, scheduled.SenderID)
+	if err != nil {
+		logger.Warn("Failed to send scheduled message", logger.WithFields(map[string]interface{}{
+			"scheduled_id": scheduled.ID,
+			"error":        err.Error(),
+		}))
+		return model.ScheduledMessageFailed, map[string]interface{}{"error": err.Error()}
+	}
+
+	return model.ScheduledMessageSent, map[string]interface{}{"message_id": message.ID}
+}
+
+// defaultMaxPinnedMessages caps the pins of a room when no limit is configured
+const defaultMaxPinnedMessages = 50
+
+func maxPinnedMessages() int {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Room.MaxPinnedMessages > 0 {
+		return cfg.Room.MaxPinnedMessages
+	}
+	return defaultMaxPinnedMessages
+}
+
+// checkCanPin allows room owners, admins and moderators to manage pins
+func (s *messageService) checkCanPin(ctx context.Context, roomID, userID uuid.UUID) error {
+	member, err := s.roomRepo.GetMember(ctx, roomID, userID)
+	if err != nil {
+		return err
+	}
+	if isAdminOrOwner(member) || (member != nil && member.Role == "moderator") {
+		return nil
+	}
+
+	return fmt.Errorf("%w: only admins and moderators can pin messages", ErrForbidden)
+}
+
+// PinMessage pins a message of the room. Pinning an already pinned message
+// succeeds without counting against the limit.
+func (s *messageService) PinMessage(ctx context.Context, roomID, messageID, userID uuid.UUID) (_ *model.RoomPinnedMessage, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.PinMessage", tracing.ID("room_id", roomID), tracing.ID("message_id", messageID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkCanPin(ctx, roomID, userID); err != nil {
+		return nil, err
+	}
+
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	if message == nil || message.RoomID != roomID || message.IsDeleted {
+		return nil, fmt.Errorf("%w: message not found in this room", ErrInvalidArgument)
+	}
+
+	pinned, err := s.messageRepo.IsMessagePinned(ctx, roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if !pinned {
+		count, err := s.messageRepo.CountPinnedMessages(ctx, roomID)
+		if err != nil {
+			return nil, err
+		}
+		if limit := maxPinnedMessages(); count >= int64(limit) {
+			return nil, fmt.Errorf("%w: a room can have at most %d pinned messages", ErrInvalidArgument, limit)
+		}
+	}
+
+	pin := &model.RoomPinnedMessage{
+		RoomID:    roomID,
+		MessageID: messageID,
+		PinnedBy:  userID,
+		PinnedAt:  time.Now(),
+	}
+	if err := s.messageRepo.PinMessage(ctx, pin); err != nil {
+		return nil, err
+	}
+	pin.Message = *message
+
+	eventData := events.RoomEventData(roomID, &userID, map[string]interface{}{
+		"message_id": messageID,
+		"pinned_by":  userID,
+	})
+
+	if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomMessagePin, roomID, eventData, &userID); err != nil {
+		logger.Warn("Failed to publish message pin event", logger.WithField("error", err.Error()))
+	}
+
+	return pin, nil
+}
+
+// UnpinMessage removes a pin from the room
+func (s *messageService) UnpinMessage(ctx context.Context, roomID, messageID, userID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.message.UnpinMessage", tracing.ID("room_id", roomID), tracing.ID("message_id", messageID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkCanPin(ctx, roomID, userID); err != nil {
+		return err
+	}
+
+	removed, err := s.messageRepo.UnpinMessage(ctx, roomID, messageID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return fmt.Errorf("%w: message is not pinned in this room", ErrNotFound)
+	}
+
+	eventData := events.RoomEventData(roomID, &userID, map[string]interface{}{
+		"message_id":  messageID,
+		"unpinned_by": userID,
+	})
+
+	if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomMessageUnpin, roomID, eventData, &userID); err != nil {
+		logger.Warn("Failed to publish message unpin event", logger.WithField("error", err.Error()))
+	}
+
+	return nil
+}
+
+// GetPinnedMessages returns the pinned messages of a room with their
+// senders; pins of messages deleted since are left out
+func (s *messageService) GetPinnedMessages(ctx context.Context, roomID, userID uuid.UUID) (_ []model.RoomPinnedMessage, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.GetPinnedMessages", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	isMember, err := s.roomRepo.IsUserInRoom(ctx, roomID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check room membership: %w", err)
+	}
+	if !isMember {
+		return nil, fmt.Errorf("%w: user is not a member of this room", ErrForbidden)
+	}
+
+	pins, err := s.messageRepo.GetPinnedMessages(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make([]model.RoomPinnedMessage, 0, len(pins))
+	for _, pin := range pins {
+		if !pin.Message.IsDeleted {
+			visible = append(visible, pin)
+		}
+	}
+	return visible, nil
+}
+
+// minSearchQueryLength is the shortest query, in characters, accepted by message search
+const minSearchQueryLength = 2
+
+// normalizeSearchQuery trims the query and rejects queries that are too short
+func normalizeSearchQuery(query string) (string, error) {
+	query = strings.TrimSpace(query)
+	if utf8.RuneCountInString(query) < minSearchQueryLength {
+		return "", fmt.Errorf("%w: search query must be at least %d characters", ErrInvalidArgument, minSearchQueryLength)
+	}
+	return query, nil
+}
+
+func (s *messageService) SearchRoomMessages(ctx context.Context, roomID uuid.UUID, userID uuid.UUID, query string, page, limit int) (_ []model.MessageResponse, _ *model.PaginationMeta, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.SearchRoomMessages", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	query, err = normalizeSearchQuery(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Check if user is member of the room
+	isMember, err := s.roomRepo.IsUserInRoom(ctx, roomID, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to check room membership: %w", err)
+	}
+	if !isMember {
+		return nil, nil, fmt.Errorf("%w: user is not a member of this room", ErrForbidden)
+	}
+
+	page, limit = normalizePage(page, limit)
+
+	offset := (page - 1) * limit
+	messages, total, err := s.messageRepo.SearchMessages(ctx, roomID, query, offset, limit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+
+	responses, err := s.buildMessageResponses(ctx, messages, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return responses, newPaginationMeta(page, limit, total), nil
+}
+
+func (s *messageService) SearchUserMessages(ctx context.Context, userID uuid.UUID, query string, page, limit int) (_ []model.MessageResponse, _ *model.PaginationMeta, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.SearchUserMessages", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	query, err = normalizeSearchQuery(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page, limit = normalizePage(page, limit)
+
+	offset := (page - 1) * limit
+	messages, total, err := s.messageRepo.SearchUserMessages(ctx, userID, query, offset, limit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+
+	responses, err := s.buildMessageResponses(ctx, messages, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return responses, newPaginationMeta(page, limit, total), nil
+}
+
+// GetMentions returns the messages mentioning the user across their rooms
+func (s *messageService) GetMentions(ctx context.Context, userID uuid.UUID, page, limit int) (_ []model.MessageResponse, _ *model.PaginationMeta, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.GetMentions", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	page, limit = normalizePage(page, limit)
+
+	offset := (page - 1) * limit
+	messages, total, err := s.messageRepo.GetMentions(ctx, userID, offset, limit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get mentions: %w", err)
+	}
+
+	responses, err := s.buildMessageResponses(ctx, messages, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return responses, newPaginationMeta(page, limit, total), nil
+}
+
+// buildMessageResponses decorates messages with sender info, reaction counts
+// and the read state for the given user. The individual reactions are not
+// loaded, see LoadReactionDetails.
+func (s *messageService) buildMessageResponses(ctx context.Context, messages []model.Message, userID uuid.UUID) ([]model.MessageResponse, error) {
+	messageIDs := make([]uuid.UUID, 0, len(messages))
+	for _, message := range messages {
+		messageIDs = append(messageIDs, message.ID)
+	}
+
+	readIDs, err := s.messageRepo.GetReadMessageIDs(ctx, userID, messageIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get read receipts: %w", err)
+	}
+
+	replyCounts, err := s.messageRepo.GetReplyCounts(ctx, messageIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reply counts: %w", err)
+	}
+
+	reactionCounts, myReactions, err := s.messageRepo.GetReactionSummaries(ctx, messageIDs, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reaction counts: %w", err)
+	}
+
+	// Receipts are only shown to the sender
+	ownIDs := make([]uuid.UUID, 0, len(messages))
+	for _, message := range messages {
+		if message.SenderID == userID {
+			ownIDs = append(ownIDs, message.ID)
+		}
+	}
+	deliveredCounts, readCounts, err := s.messageRepo.GetReceiptCounts(ctx, ownIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get receipt counts: %w", err)
+	}
+
+	originals, err := s.getForwardedOriginals(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	privateRooms := make(map[uuid.UUID]bool)
+	responses := make([]model.MessageResponse, 0, len(messages))
+	for _, message := range messages {
+		message.Attachments = s.signAttachments(ctx, message.RoomID, message.Attachments, privateRooms)
+		response := model.MessageResponse{
+			Message:       message,
+			SenderName:    senderDisplayName(&message.Sender),
+			SenderAvatar:  message.Sender.Avatar,
+			ReactionCount: reactionCounts[message.ID],
+			MyReactions:   myReactions[message.ID],
+			ReplyCount:    replyCounts[message.ID],
+			IsRead:        message.SenderID == userID || readIDs[message.ID],
+		}
+		if message.SenderID == userID {
+			delivered, read := deliveredCounts[message.ID], readCounts[message.ID]
+			response.DeliveredCount = &delivered
+			response.ReadCount = &read
+		}
+		if original, ok := originals[forwardedFromID(message.Metadata)]; ok {
+			original.Attachments = s.signAttachments(ctx, original.RoomID, original.Attachments, privateRooms)
+			response.ForwardedFrom = &model.MessageResponse{
+				Message:      original,
+				SenderName:   senderDisplayName(&original.Sender),
+				SenderAvatar: original.Sender.Avatar,
+			}
+		}
+		responses = append(responses, response)
+	}
+
+	return responses, nil
+}
+
+// getForwardedOriginals loads the still existing originals of forwarded
+// messages, keyed by ID
+func (s *messageService) getForwardedOriginals(ctx context.Context, messages []model.Message) (map[uuid.UUID]model.Message, error) {
+	var ids []uuid.UUID
+	for _, message := range messages {
+		if id := forwardedFromID(message.Metadata); id != uuid.Nil {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	found, err := s.messageRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get forwarded messages: %w", err)
+	}
+
+	originals := make(map[uuid.UUID]model.Message, len(found))
+	for _, original := range found {
+		if !original.IsDeleted {
+			originals[original.ID] = original
+		}
+	}
+	return originals, nil
+}
+
+// forwardedFromID returns the original message ID recorded by
+// forwardedMetadata, or uuid.Nil for messages that weren't forwarded
+func forwardedFromID(metadata string) uuid.UUID {
+	if metadata == "" {
+		return uuid.Nil
+	}
+
+	var decoded struct {
+		ForwardedFrom struct {
+			MessageID uuid.UUID `json:"message_id"`
+		} `json:"forwarded_from"`
+	}
+	if err := json.Unmarshal([]byte(metadata), &decoded); err != nil {
+		return uuid.Nil
+	}
+	return decoded.ForwardedFrom.MessageID
+}
+
+// senderDisplayName returns the full name of a user, falling back to the username
+func senderDisplayName(user *model.User) string {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		return user.Username
+	}
+	return name
+}
+
+// defaultMaxReactionsPerUser caps the distinct emojis of one user on a
+// message when no limit is configured
+const defaultMaxReactionsPerUser = 20
+
+func maxReactionsPerUser() int {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Room.MaxReactionsPerUser > 0 {
+		return cfg.Room.MaxReactionsPerUser
+	}
+	return defaultMaxReactionsPerUser
+}
+
+// ReactToMessage adds a reaction. Repeating an existing reaction is a no-op,
+// or removes it when req.Toggle is set.
+func (s *messageService) ReactToMessage(ctx context.Context, messageID uuid.UUID, req *model.ReactToMessageRequest, userID uuid.UUID) (_ *model.ReactionResult, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.ReactToMessage", tracing.ID("message_id", messageID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	if message == nil || message.IsDeleted {
+		return nil, ErrMessageNotFound
+	}
+
+	if err := s.checkMembership(ctx, message.RoomID, userID); err != nil {
+		return nil, err
+	}
+
+	emojis, err := s.messageRepo.GetUserReactionEmojis(ctx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &model.ReactionResult{Emoji: req.Emoji}
+	for _, emoji := range emojis {
+		if emoji != req.Emoji {
+			continue
+		}
+		if !req.Toggle {
+			result.Reacted = true
+			return result, nil
+		}
+
+		removed, err := s.messageRepo.RemoveReaction(ctx, messageID, userID, req.Emoji)
+		if err != nil {
+			return nil, err
+		}
+		if removed {
+			result.Changed = true
+			s.publishReactionEvent(ctx, events.MessageReactionRemove, message, req.Emoji, userID)
+		}
+		return result, nil
+	}
+
+	if len(emojis) >= maxReactionsPerUser() {
+		return nil, fmt.Errorf("%w: at most %d reactions per message", ErrConflict, maxReactionsPerUser())
+	}
+
+	added, err := s.messageRepo.AddReaction(ctx, &model.MessageReaction{
+		MessageID: messageID,
+		UserID:    userID,
+		Emoji:     req.Emoji,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Reacted = true
+	if added {
+		result.Changed = true
+		s.publishReactionEvent(ctx, events.MessageReactionAdd, message, req.Emoji, userID)
+	}
+	return result, nil
+}
+
+func (s *messageService) publishReactionEvent(ctx context.Context, eventType string, message *model.Message, emoji string, userID uuid.UUID) {
+	eventData := events.MessageEventData(message.ID, message.RoomID, &userID, map[string]interface{}{
+		"emoji": emoji,
+	})
+
+	if err := s.eventPublisher.PublishMessageEvent(ctx, eventType, message.RoomID, message.ID, eventData, &userID); err != nil {
+		logger.Warn("Failed to publish reaction event", logger.WithField("error", err.Error()))
+	}
+}
+
+func (s *messageService) RemoveReaction(ctx context.Context, messageID uuid.UUID, emoji string, userID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.message.RemoveReaction", tracing.ID("message_id", messageID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to get message: %w", err)
+	}
+	if message == nil {
+		return ErrMessageNotFound
+	}
+
+	removed, err := s.messageRepo.RemoveReaction(ctx, messageID, userID, emoji)
+	if err != nil {
+		return fmt.Errorf("failed to remove reaction: %w", err)
+	}
+
+	if removed {
+		s.publishReactionEvent(ctx, events.MessageReactionRemove, message, emoji, userID)
+	}
 
 	return nil
 }
 
-func (s *messageService) StartTyping(ctx context.Context, roomID uuid.UUID, userID uuid.UUID) error {
+func (s *messageService) MarkAsRead(ctx context.Context, messageID uuid.UUID, userID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.message.MarkAsRead", tracing.ID("message_id", messageID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to get message: %w", err)
+	}
+	if message == nil {
+		return ErrMessageNotFound
+	}
+
 	// Check if user is member of the room
-	isMember, err := s.roomRepo.IsUserInRoom(ctx, roomID, userID)
+	isMember, err := s.roomRepo.IsUserInRoom(ctx, message.RoomID, userID)
 	if err != nil {
 		return fmt.Errorf("failed to check room membership: %w", err)
 	}
 	if !isMember {
-		return fmt.Errorf("access denied: user is not a member of this room")
+		return fmt.Errorf("%w: user is not a member of this room", ErrForbidden)
+	}
+
+	// Mark message as read
+	if err := s.messageRepo.MarkAsRead(ctx, messageID, userID); err != nil {
+		return fmt.Errorf("failed to mark message as read: %w", err)
+	}
+
+	// Unread counts follow the room cursor, so reading a newer message moves it
+	moved, err := s.roomRepo.AdvanceReadCursor(ctx, message.RoomID, userID, message.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if moved {
+		s.invalidateUnreadCounts(ctx, userID)
+	}
+
+	// Readers of broadcast rooms are too many to announce
+	if s.isBroadcastAudience(ctx, message.RoomID, userID) {
+		return nil
+	}
+
+	// Publish read event
+	eventData := events.MessageEventData(messageID, message.RoomID, &userID, map[string]interface{}{
+		"read_at": time.Now(),
+	})
+
+	if err := s.eventPublisher.PublishMessageEvent(ctx, events.MessageRead, message.RoomID, messageID, eventData, &userID); err != nil {
+		logger.Warn("Failed to publish read event", logger.WithField("error", err.Error()))
+	}
+
+	return nil
+}
+
+// MarkRoomAsRead moves the user's read cursor of a room up to a message, or
+// to now when no message is given, and announces the new position with a
+// single read event
+func (s *messageService) MarkRoomAsRead(ctx context.Context, roomID, userID uuid.UUID, upToMessageID *uuid.UUID) (_ time.Time, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.MarkRoomAsRead", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkMembership(ctx, roomID, userID); err != nil {
+		return time.Time{}, err
+	}
+
+	readAt := time.Now()
+	if upToMessageID != nil {
+		message, err := s.messageRepo.GetByID(ctx, *upToMessageID)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to get message: %w", err)
+		}
+		if message == nil || message.RoomID != roomID {
+			return time.Time{}, fmt.Errorf("%w: message not found in this room", ErrNotFound)
+		}
+		readAt = message.CreatedAt
+	}
+
+	moved, err := s.roomRepo.AdvanceReadCursor(ctx, roomID, userID, readAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !moved {
+		return readAt, nil
+	}
+	s.invalidateUnreadCounts(ctx, userID)
+	if s.isBroadcastAudience(ctx, roomID, userID) {
+		return readAt, nil
+	}
+
+	data := map[string]interface{}{"read_up_to": readAt}
+	if upToMessageID != nil {
+		data["up_to_message_id"] = *upToMessageID
+	}
+	eventData := events.RoomEventData(roomID, &userID, data)
+	if err := s.eventPublisher.PublishRoomEvent(ctx, events.MessageRead, roomID, eventData, &userID); err != nil {
+		logger.Warn("Failed to publish read event", logger.WithField("error", err.Error()))
+	}
+
+	return readAt, nil
+}
+
+// isBroadcastAudience reports whether the user is a plain member of a
+// broadcast room. Their typing and read events are not published, as
+// broadcast rooms are large enough for them to flood every member.
+func (s *messageService) isBroadcastAudience(ctx context.Context, roomID, userID uuid.UUID) bool {
+	room, err := s.roomRepo.GetByID(ctx, roomID)
+	if err != nil || room == nil || room.Type != "broadcast" {
+		return false
+	}
+	member, err := s.roomRepo.GetMember(ctx, roomID, userID)
+	if err != nil || member == nil {
+		return false
+	}
+	return !isAdminOrOwner(member)
+}
+
+// unreadCountsCacheTTL is how long the unread counts of a user stay cached.
+// Counts only grow stale when others post, so a short TTL is enough.
+const unreadCountsCacheTTL = 30 * time.Second
+
+// GetAllUnreadCounts returns the unread count of every room the user is a
+// member of, keyed by room ID
+func (s *messageService) GetAllUnreadCounts(ctx context.Context, userID uuid.UUID) (_ map[uuid.UUID]int64, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.GetAllUnreadCounts", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	cached, err := s.redis.GetUnreadCounts(ctx, userID.String())
+	if err != nil {
+		logger.Warn("Failed to get cached unread counts", logger.WithField("error", err.Error()))
+	} else if cached != "" {
+		var counts map[uuid.UUID]int64
+		if err := json.Unmarshal([]byte(cached), &counts); err == nil {
+			return counts, nil
+		}
+	}
+
+	counts, err := s.messageRepo.GetUnreadCounts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if encoded, err := json.Marshal(counts); err == nil {
+		if err := s.redis.SetUnreadCounts(ctx, userID.String(), string(encoded), unreadCountsCacheTTL); err != nil {
+			logger.Warn("Failed to cache unread counts", logger.WithField("error", err.Error()))
+		}
+	}
+
+	return counts, nil
+}
+
+// invalidateUnreadCounts drops the cached unread counts of a user whose read
+// cursor moved, so they see their own reads right away
+func (s *messageService) invalidateUnreadCounts(ctx context.Context, userID uuid.UUID) {
+	if err := s.redis.DeleteUnreadCounts(ctx, userID.String()); err != nil {
+		logger.Warn("Failed to invalidate unread counts", logger.WithField("error", err.Error()))
+	}
+}
+
+// MarkDelivered acknowledges messages the user fetched outside the
+// WebSocket, such as when catching up on history after being offline.
+// Messages of rooms the user isn't in and the user's own messages are skipped.
+func (s *messageService) MarkDelivered(ctx context.Context, userID uuid.UUID, messageIDs []uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.message.MarkDelivered", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	messages, err := s.messageRepo.GetByIDs(ctx, messageIDs)
+	if err != nil {
+		return err
+	}
+
+	membership := make(map[uuid.UUID]bool)
+	now := time.Now()
+	deliveries := make([]model.MessageDelivery, 0, len(messages))
+	for _, message := range messages {
+		if message.SenderID == userID {
+			continue
+		}
+
+		isMember, checked := membership[message.RoomID]
+		if !checked {
+			isMember, err = s.roomRepo.IsUserInRoom(ctx, message.RoomID, userID)
+			if err != nil {
+				return fmt.Errorf("failed to check room membership: %w", err)
+			}
+			membership[message.RoomID] = isMember
+		}
+		if !isMember {
+			continue
+		}
+
+		deliveries = append(deliveries, model.MessageDelivery{
+			MessageID:   message.ID,
+			UserID:      userID,
+			DeliveredAt: now,
+		})
+	}
+
+	return s.messageRepo.RecordDeliveries(ctx, deliveries)
+}
+
+// RecordDeliveries stores receipts the WebSocket hub collected for messages it
+// wrote to connected clients
+func (s *messageService) RecordDeliveries(ctx context.Context, deliveries []model.MessageDelivery) (err error) {
+	ctx, span := tracing.Start(ctx, "service.message.RecordDeliveries")
+	defer func() { tracing.End(span, err) }()
+
+	return s.messageRepo.RecordDeliveries(ctx, deliveries)
+}
+
+// GetMessageReactions pages through the users who reacted to a message,
+// optionally with one emoji only
+func (s *messageService) GetMessageReactions(ctx context.Context, messageID, userID uuid.UUID, emoji string, page, limit int) (_ []model.MessageReaction, _ *model.PaginationMeta, err error) {
+	ctx, span := tracing.Start(ctx, "service.message.GetMessageReactions", tracing.ID("message_id", messageID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	if message == nil || message.IsDeleted {
+		return nil, nil, ErrMessageNotFound
+	}
+	if err := s.checkMembership(ctx, message.RoomID, userID); err != nil {
+		return nil, nil, err
+	}
+
+	page, limit = normalizePage(page, limit)
+	reactions, total, err := s.messageRepo.GetMessageReactions(ctx, messageID, emoji, (page-1)*limit, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return reactions, newPaginationMeta(page, limit, total), nil
+}
+
+// LoadReactionDetails fills in the individual reactions, with the reacting
+// users, of messages built without them
+func (s *messageService) LoadReactionDetails(ctx context.Context, responses []model.MessageResponse) (err error) {
+	ctx, span := tracing.Start(ctx, "service.message.LoadReactionDetails")
+	defer func() { tracing.End(span, err) }()
+
+	messageIDs := make([]uuid.UUID, 0, len(responses))
+	for _, response := range responses {
+		if !response.IsDeleted {
+			messageIDs = append(messageIDs, response.ID)
+		}
+	}
+
+	reactions, err := s.messageRepo.GetReactionsWithUsers(ctx, messageIDs)
+	if err != nil {
+		return err
+	}
+
+	byMessage := make(map[uuid.UUID][]model.MessageReaction)
+	for _, reaction := range reactions {
+		byMessage[reaction.MessageID] = append(byMessage[reaction.MessageID], reaction)
+	}
+	for i := range responses {
+		responses[i].Reactions = byMessage[responses[i].ID]
+	}
+	return nil
+}
+
+func (s *messageService) StartTyping(ctx context.Context, roomID uuid.UUID, userID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.message.StartTyping", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	// Members who can't post can't type either
+	room, err := s.roomRepo.GetByID(ctx, roomID)
+	if err != nil {
+		return fmt.Errorf("failed to get room: %w", err)
+	}
+	if room == nil {
+		return ErrRoomNotFound
+	}
+	if err := s.checkCanPost(ctx, room, userID); err != nil {
+		return err
 	}
 
 	// Publish typing start event
@@ -430,7 +2032,15 @@ func (s *messageService) StartTyping(ctx context.Context, roomID uuid.UUID, user
 	return nil
 }
 
-func (s *messageService) StopTyping(ctx context.Context, roomID uuid.UUID, userID uuid.UUID) error {
+func (s *messageService) StopTyping(ctx context.Context, roomID uuid.UUID, userID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.message.StopTyping", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	// Members who can't start typing have nothing to stop
+	if s.isBroadcastAudience(ctx, roomID, userID) {
+		return nil
+	}
+
 	// Publish typing stop event
 	if err := s.eventPublisher.PublishTypingEvent(ctx, roomID, userID, false); err != nil {
 		return fmt.Errorf("failed to publish typing event: %w", err)
@@ -0,0 +1,1205 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"realtime-api/internal/config"
+	"realtime-api/internal/database"
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+	"realtime-api/internal/repository"
+	"realtime-api/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestMessageDatabase opens a test database with the message tables
+func newTestMessageDatabase(tb testing.TB) *database.Database {
+	tb.Helper()
+
+	return newTestDatabase(tb, &model.User{}, &model.Room{}, &model.RoomMember{}, &model.RoomTag{},
+		&model.Message{}, &model.MessageAttachment{}, &model.MessageReaction{}, &model.MessageRead{}, &model.MessageDelivery{}, &model.MessageHidden{}, &model.MessageEdit{}, &model.RoomPinnedMessage{}, &model.MessageDraft{}, &model.ScheduledMessage{})
+}
+
+func TestNormalizeSearchQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{name: "empty", query: "", wantErr: true},
+		{name: "single ascii character", query: "a", wantErr: true},
+		{name: "single multi-byte character", query: "é", wantErr: true},
+		{name: "single cjk character", query: "日", wantErr: true},
+		{name: "padded single character", query: "  a  ", wantErr: true},
+		{name: "two characters", query: "hi", want: "hi"},
+		{name: "two cjk characters", query: " 日本 ", want: "日本"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeSearchQuery(tt.query)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidArgument)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGetMessagesBeforePagesThroughHistory(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	roomID := uuid.New()
+	userID := uuid.New()
+	require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: roomID, UserID: userID, Role: "member"}).Error)
+
+	// Three of the messages share a timestamp so the ID tiebreaker is exercised
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	createdAt := []time.Time{base, base.Add(time.Second), base.Add(time.Second), base.Add(time.Second), base.Add(2 * time.Second)}
+	for i, at := range createdAt {
+		message := model.Message{RoomID: roomID, SenderID: userID, Type: "text", Content: fmt.Sprintf("message %d", i)}
+		message.CreatedAt = at
+		require.NoError(t, db.DB.Create(&message).Error)
+	}
+
+	svc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), nil, nil, newTestRedis(t))
+
+	seen := map[uuid.UUID]bool{}
+	before := ""
+	for pages := 0; pages < 5; pages++ {
+		messages, meta, err := svc.GetMessagesBefore(ctx, roomID, userID, before, 2, model.DeletedMessagesExclude)
+		require.NoError(t, err)
+		for _, message := range messages {
+			assert.False(t, seen[message.ID], "message %s returned twice", message.ID)
+			seen[message.ID] = true
+		}
+		if !meta.HasMore {
+			break
+		}
+		before = meta.NextCursor
+	}
+	assert.Len(t, seen, len(createdAt))
+
+	_, _, err := svc.GetMessagesBefore(ctx, roomID, userID, uuid.NewString(), 2, model.DeletedMessagesExclude)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, _, err = svc.GetMessagesBefore(ctx, roomID, userID, "yesterday", 2, model.DeletedMessagesExclude)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	_, _, err = svc.GetMessagesBefore(ctx, roomID, uuid.New(), "", 2, model.DeletedMessagesExclude)
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+// seedRoomMessages creates a room with one member and count messages in it
+func seedRoomMessages(tb testing.TB, db *database.Database, count int) (uuid.UUID, uuid.UUID) {
+	tb.Helper()
+
+	roomID := uuid.New()
+	userID := uuid.New()
+	require.NoError(tb, db.DB.Create(&model.RoomMember{RoomID: roomID, UserID: userID, Role: "member"}).Error)
+
+	base := time.Now().Add(-time.Duration(count) * time.Second)
+	messages := make([]model.Message, count)
+	for i := range messages {
+		messages[i] = model.Message{RoomID: roomID, SenderID: userID, Type: "text", Content: fmt.Sprintf("message %d", i)}
+		messages[i].CreatedAt = base.Add(time.Duration(i) * time.Second)
+	}
+	require.NoError(tb, db.DB.CreateInBatches(messages, 500).Error)
+
+	return roomID, userID
+}
+
+func TestGetMessagesCountsOnlyFirstPage(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	roomID, userID := seedRoomMessages(t, db, 25)
+	svc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), nil, nil, newTestRedis(t))
+
+	messages, meta, err := svc.GetMessages(ctx, roomID, userID, 1, 10, model.DeletedMessagesExclude)
+	require.NoError(t, err)
+	assert.Len(t, messages, 10)
+	assert.Equal(t, 25, meta.Total)
+	assert.Equal(t, 3, meta.TotalPages)
+	assert.True(t, meta.HasMore)
+
+	messages, meta, err = svc.GetMessages(ctx, roomID, userID, 2, 10, model.DeletedMessagesExclude)
+	require.NoError(t, err)
+	assert.Len(t, messages, 10)
+	assert.Equal(t, -1, meta.Total)
+	assert.True(t, meta.HasMore)
+
+	messages, meta, err = svc.GetMessages(ctx, roomID, userID, 3, 10, model.DeletedMessagesExclude)
+	require.NoError(t, err)
+	assert.Len(t, messages, 5)
+	assert.False(t, meta.HasMore)
+}
+
+func TestGetMessagesDeletedModes(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	roomID, userID := seedRoomMessages(t, db, 3)
+	svc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), nil, nil, newTestRedis(t))
+
+	var deleted model.Message
+	require.NoError(t, db.DB.Where("room_id = ?", roomID).Order("created_at").First(&deleted).Error)
+	require.NoError(t, db.DB.Create(&model.MessageAttachment{
+		MessageID: deleted.ID, FileName: "a.png", FileSize: 1, FileType: "image", MimeType: "image/png", URL: "https://example.com/a.png",
+	}).Error)
+	require.NoError(t, db.DB.Create(&model.MessageReaction{MessageID: deleted.ID, UserID: userID, Emoji: "👍"}).Error)
+	require.NoError(t, svc.DeleteMessage(ctx, deleted.ID, userID, model.DeleteForEveryone))
+
+	messages, meta, err := svc.GetMessages(ctx, roomID, userID, 1, 10, model.DeletedMessagesExclude)
+	require.NoError(t, err)
+	assert.Len(t, messages, 2)
+	assert.Equal(t, 2, meta.Total)
+	for _, message := range messages {
+		assert.NotEqual(t, deleted.ID, message.ID)
+	}
+
+	messages, _, err = svc.GetMessages(ctx, roomID, userID, 1, 10, model.DeletedMessagesTombstone)
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+
+	tombstone := messages[len(messages)-1]
+	assert.Equal(t, deleted.ID, tombstone.ID)
+	assert.Empty(t, tombstone.Content)
+	assert.Empty(t, tombstone.Attachments)
+	assert.Empty(t, tombstone.Reactions)
+
+	data, err := json.Marshal(tombstone)
+	require.NoError(t, err)
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &fields))
+	assert.ElementsMatch(t, []string{"id", "room_id", "sender_id", "is_deleted", "created_at"}, mapKeys(fields))
+
+	cursorMessages, _, err := svc.GetMessagesBefore(ctx, roomID, userID, "", 10, model.DeletedMessagesExclude)
+	require.NoError(t, err)
+	assert.Len(t, cursorMessages, 2)
+}
+
+func TestOnlyAdminCanPost(t *testing.T) {
+	logger.Init("fatal", "json", "stdout", "")
+	ctx := context.Background()
+
+	owner, admin, moderator, member := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	tests := []struct {
+		name    string
+		sender  uuid.UUID
+		allowed bool
+	}{
+		{"owner", owner, true},
+		{"admin", admin, true},
+		{"moderator", moderator, false},
+		{"member", member, false},
+		{"non-member", uuid.New(), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roomRepo, messageRepo := newMockRoomRepository(), newMockMessageRepository()
+			room := &model.Room{Name: "announcements", Type: "group", OnlyAdminCanPost: true}
+			roomRepo.addRoom(room, map[uuid.UUID]string{owner: "owner", admin: "admin", moderator: "moderator", member: "member"})
+			svc := NewMessageService(messageRepo, roomRepo, nil, nil, newTestRedis(t))
+
+			_, err := svc.SendMessage(ctx, &model.SendMessageRequest{RoomID: room.ID, Content: "hello"}, tt.sender)
+			if tt.allowed {
+				assert.NoError(t, err)
+				assert.Equal(t, 1, messageRepo.writes)
+			} else {
+				assert.ErrorIs(t, err, ErrForbidden)
+				assert.Zero(t, messageRepo.writes)
+			}
+		})
+	}
+}
+
+func TestDeleteMessageForEveryonePermissions(t *testing.T) {
+	logger.Init("fatal", "json", "stdout", "")
+	ctx := context.Background()
+
+	owner, admin, sender, member := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	tests := []struct {
+		name    string
+		caller  uuid.UUID
+		age     time.Duration
+		allowed bool
+	}{
+		{"sender", sender, time.Minute, true},
+		{"sender after the window", sender, 2 * deleteForEveryoneWindow, false},
+		{"owner", owner, 2 * deleteForEveryoneWindow, true},
+		{"admin", admin, 2 * deleteForEveryoneWindow, true},
+		{"other member", member, time.Minute, false},
+		{"non-member", uuid.New(), time.Minute, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roomRepo, messageRepo := newMockRoomRepository(), newMockMessageRepository()
+			room := &model.Room{Name: "general", Type: "group"}
+			roomRepo.addRoom(room, map[uuid.UUID]string{owner: "owner", admin: "admin", sender: "member", member: "member"})
+			message := &model.Message{RoomID: room.ID, SenderID: sender, Content: "hello"}
+			require.NoError(t, messageRepo.Create(ctx, message))
+			message.CreatedAt = time.Now().Add(-tt.age)
+			messageRepo.writes = 0
+			svc := NewMessageService(messageRepo, roomRepo, nil, nil, newTestRedis(t))
+
+			err := svc.DeleteMessage(ctx, message.ID, tt.caller, model.DeleteForEveryone)
+			if tt.allowed {
+				assert.NoError(t, err)
+				assert.True(t, message.IsDeleted)
+			} else {
+				assert.ErrorIs(t, err, ErrForbidden)
+				assert.Zero(t, messageRepo.writes)
+			}
+		})
+	}
+}
+
+func TestDeleteMessageModes(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	roomID, sender := seedRoomMessages(t, db, 3)
+	other := uuid.New()
+	admin := uuid.New()
+	require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: roomID, UserID: other, Role: "member"}).Error)
+	require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: roomID, UserID: admin, Role: "admin"}).Error)
+
+	svc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), nil, nil, newTestRedis(t))
+
+	var messages []model.Message
+	require.NoError(t, db.DB.Where("room_id = ?", roomID).Order("created_at").Find(&messages).Error)
+
+	// Delete for me only hides the message from the caller
+	require.NoError(t, svc.DeleteMessage(ctx, messages[0].ID, other, model.DeleteForMe))
+	require.NoError(t, svc.DeleteMessage(ctx, messages[0].ID, other, model.DeleteForMe))
+
+	history, meta, err := svc.GetMessages(ctx, roomID, other, 1, 10, model.DeletedMessagesExclude)
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, 2, meta.Total)
+
+	history, _, err = svc.GetMessages(ctx, roomID, sender, 1, 10, model.DeletedMessagesExclude)
+	require.NoError(t, err)
+	assert.Len(t, history, 3)
+
+	// Only the sender or an admin can delete for everyone
+	assert.ErrorIs(t, svc.DeleteMessage(ctx, messages[1].ID, other, model.DeleteForEveryone), ErrForbidden)
+	assert.ErrorIs(t, svc.DeleteMessage(ctx, messages[1].ID, uuid.New(), model.DeleteForMe), ErrForbidden)
+	assert.ErrorIs(t, svc.DeleteMessage(ctx, messages[1].ID, sender, "for_nobody"), ErrInvalidArgument)
+
+	// The sender's window closes, the admin's doesn't
+	require.NoError(t, db.DB.Model(&model.Message{}).Where("id = ?", messages[1].ID).
+		Update("created_at", time.Now().Add(-2*deleteForEveryoneWindow)).Error)
+	assert.ErrorIs(t, svc.DeleteMessage(ctx, messages[1].ID, sender, model.DeleteForEveryone), ErrForbidden)
+	require.NoError(t, svc.DeleteMessage(ctx, messages[1].ID, admin, model.DeleteForEveryone))
+
+	require.NoError(t, svc.DeleteMessage(ctx, messages[2].ID, sender, model.DeleteForEveryone))
+
+	history, _, err = svc.GetMessages(ctx, roomID, sender, 1, 10, model.DeletedMessagesExclude)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, messages[0].ID, history[0].ID)
+}
+
+func TestEditMessageKeepsHistory(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	roomID, sender := seedRoomMessages(t, db, 1)
+	svc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), nil, nil, newTestRedis(t))
+
+	var message model.Message
+	require.NoError(t, db.DB.Where("room_id = ?", roomID).First(&message).Error)
+	original := message.Content
+
+	for _, content := range []string{"first edit", "second edit"} {
+		_, err := svc.EditMessage(ctx, message.ID, &model.EditMessageRequest{Content: content}, sender)
+		require.NoError(t, err)
+	}
+
+	history, err := svc.GetMessageHistory(ctx, message.ID, sender)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, 1, history[0].Revision)
+	assert.Equal(t, original, history[0].PreviousContent)
+	assert.Equal(t, 2, history[1].Revision)
+	assert.Equal(t, "first edit", history[1].PreviousContent)
+	assert.Equal(t, sender, history[1].EditedBy)
+
+	_, err = svc.GetMessageHistory(ctx, message.ID, uuid.New())
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, err = svc.GetMessageHistory(ctx, uuid.New(), sender)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = svc.EditMessage(ctx, message.ID, &model.EditMessageRequest{Content: "not mine"}, uuid.New())
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = svc.EditMessage(ctx, uuid.New(), &model.EditMessageRequest{Content: "gone"}, sender)
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+	_, err = svc.GetMessageByID(ctx, message.ID, uuid.New())
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = svc.GetMessageByID(ctx, uuid.New(), sender)
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+}
+
+func TestThreadRepliesAndCounts(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	userID := uuid.New()
+	rooms := make([]*model.Room, 2)
+	for i, name := range []string{"general", "random"} {
+		rooms[i] = &model.Room{Name: name, Type: "group", CreatedBy: userID}
+		require.NoError(t, db.DB.Create(rooms[i]).Error)
+		require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: rooms[i].ID, UserID: userID, Role: "admin"}).Error)
+	}
+
+	svc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), nil, nil, newTestRedis(t))
+
+	parent, err := svc.SendMessage(ctx, &model.SendMessageRequest{RoomID: rooms[0].ID, Content: "question"}, userID)
+	require.NoError(t, err)
+	for _, content := range []string{"answer", "another answer"} {
+		_, err := svc.SendMessage(ctx, &model.SendMessageRequest{RoomID: rooms[0].ID, Content: content, ReplyToID: &parent.ID}, userID)
+		require.NoError(t, err)
+	}
+
+	// A reply can't point at a message of another room
+	_, err = svc.SendMessage(ctx, &model.SendMessageRequest{RoomID: rooms[1].ID, Content: "wrong room", ReplyToID: &parent.ID}, userID)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	replies, meta, err := svc.GetThreadMessages(ctx, parent.ID, userID, 1, 20)
+	require.NoError(t, err)
+	require.Len(t, replies, 2)
+	assert.Equal(t, 2, meta.Total)
+	assert.Equal(t, "answer", replies[0].Content)
+
+	_, _, err = svc.GetThreadMessages(ctx, parent.ID, uuid.New(), 1, 20)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	history, _, err := svc.GetMessages(ctx, rooms[0].ID, userID, 1, 20, model.DeletedMessagesExclude)
+	require.NoError(t, err)
+	replyCounts := map[uuid.UUID]int{}
+	for _, message := range history {
+		replyCounts[message.ID] = message.ReplyCount
+	}
+	assert.Equal(t, 2, replyCounts[parent.ID])
+	assert.Equal(t, 0, replyCounts[replies[0].ID])
+}
+
+func TestForwardMessage(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	userID := uuid.New()
+	rooms := make([]*model.Room, 3)
+	for i, name := range []string{"source", "target", "announcements"} {
+		rooms[i] = &model.Room{Name: name, Type: "group", CreatedBy: userID, OnlyAdminCanPost: name == "announcements"}
+		require.NoError(t, db.DB.Create(rooms[i]).Error)
+		require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: rooms[i].ID, UserID: userID, Role: "member"}).Error)
+	}
+	sender := uuid.New()
+	require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: rooms[0].ID, UserID: sender, Role: "member"}).Error)
+	notMember := &model.Room{Name: "private", Type: "group", CreatedBy: sender}
+	require.NoError(t, db.DB.Create(notMember).Error)
+
+	svc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), nil, nil, newTestRedis(t))
+
+	source := &model.Message{RoomID: rooms[0].ID, SenderID: sender, Type: "image", Content: "photo", Metadata: fmt.Sprintf(`{"caption":"sunset","mentioned_users":[%q]}`, userID)}
+	require.NoError(t, db.DB.Create(source).Error)
+	require.NoError(t, db.DB.Create(&model.MessageAttachment{MessageID: source.ID, FileName: "sunset.jpg", FileSize: 10, FileType: "image", MimeType: "image/jpeg", URL: "https://cdn.example.com/sunset.jpg"}).Error)
+
+	results, err := svc.ForwardMessage(ctx, source.ID, []uuid.UUID{rooms[1].ID, rooms[2].ID, notMember.ID, rooms[1].ID}, userID)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	require.NotNil(t, results[0].MessageID)
+	assert.Empty(t, results[0].Error)
+	assert.Nil(t, results[1].MessageID)
+	assert.Contains(t, results[1].Error, "only admins can post")
+	assert.Nil(t, results[2].MessageID)
+	assert.Contains(t, results[2].Error, "not a member")
+
+	var forwarded model.Message
+	require.NoError(t, db.DB.Preload("Attachments").First(&forwarded, "id = ?", *results[0].MessageID).Error)
+	assert.Equal(t, "image", forwarded.Type)
+	assert.Equal(t, "photo", forwarded.Content)
+	assert.Equal(t, userID, forwarded.SenderID)
+	require.Len(t, forwarded.Attachments, 1)
+	assert.Equal(t, "https://cdn.example.com/sunset.jpg", forwarded.Attachments[0].URL)
+
+	var metadata map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(forwarded.Metadata), &metadata))
+	assert.Equal(t, "sunset", metadata["caption"])
+	assert.NotContains(t, metadata, "mentioned_users")
+	assert.Empty(t, MentionedUserIDs(forwarded.Metadata))
+	assert.Equal(t, map[string]interface{}{
+		"message_id": source.ID.String(),
+		"room_id":    rooms[0].ID.String(),
+		"sender_id":  sender.String(),
+	}, metadata["forwarded_from"])
+
+	// History shows the original next to the copy
+	responses, _, err := svc.GetMessages(ctx, rooms[1].ID, userID, 1, 10, model.DeletedMessagesExclude)
+	require.NoError(t, err)
+	require.Len(t, responses, 1)
+	require.NotNil(t, responses[0].ForwardedFrom)
+	assert.Equal(t, source.ID, responses[0].ForwardedFrom.ID)
+	assert.Equal(t, rooms[0].ID, responses[0].ForwardedFrom.RoomID)
+
+	// Only members of the source room can forward from it
+	_, err = svc.ForwardMessage(ctx, source.ID, []uuid.UUID{rooms[1].ID}, uuid.New())
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestPinnedMessages(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	roomID, memberID := seedRoomMessages(t, db, 3)
+	require.NoError(t, db.DB.Create(&model.User{BaseModel: model.BaseModel{ID: memberID}, Username: "member", Email: "member@example.com", Password: "secret"}).Error)
+	moderatorID := uuid.New()
+	require.NoError(t, db.DB.Create(&model.Room{BaseModel: model.BaseModel{ID: roomID}, Name: "general", Type: "group", CreatedBy: moderatorID}).Error)
+	require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: roomID, UserID: moderatorID, Role: "moderator"}).Error)
+	otherRoomID, _ := seedRoomMessages(t, db, 1)
+
+	var messages, otherMessages []model.Message
+	require.NoError(t, db.DB.Where("room_id = ?", roomID).Order("created_at").Find(&messages).Error)
+	require.NoError(t, db.DB.Where("room_id = ?", otherRoomID).Find(&otherMessages).Error)
+
+	svc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), nil, nil, newTestRedis(t))
+
+	_, err := svc.PinMessage(ctx, roomID, messages[0].ID, memberID)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	// Messages of another room can't be pinned here
+	_, err = svc.PinMessage(ctx, roomID, otherMessages[0].ID, moderatorID)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	for _, message := range messages[:2] {
+		_, err := svc.PinMessage(ctx, roomID, message.ID, moderatorID)
+		require.NoError(t, err)
+	}
+	// Pinning twice is a no-op
+	_, err = svc.PinMessage(ctx, roomID, messages[0].ID, moderatorID)
+	require.NoError(t, err)
+
+	pins, err := svc.GetPinnedMessages(ctx, roomID, memberID)
+	require.NoError(t, err)
+	require.Len(t, pins, 2)
+	assert.Equal(t, memberID, pins[0].Message.Sender.ID)
+
+	require.NoError(t, svc.DeleteMessage(ctx, messages[2].ID, memberID, model.DeleteForEveryone))
+	_, err = svc.PinMessage(ctx, roomID, messages[2].ID, moderatorID)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	require.NoError(t, svc.UnpinMessage(ctx, roomID, messages[0].ID, moderatorID))
+	assert.ErrorIs(t, svc.UnpinMessage(ctx, roomID, messages[0].ID, moderatorID), ErrNotFound)
+
+	pins, err = svc.GetPinnedMessages(ctx, roomID, memberID)
+	require.NoError(t, err)
+	require.Len(t, pins, 1)
+	assert.Equal(t, messages[1].ID, pins[0].MessageID)
+}
+
+func TestMessageDrafts(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	roomID, userID := seedRoomMessages(t, db, 1)
+	require.NoError(t, db.DB.Create(&model.Room{BaseModel: model.BaseModel{ID: roomID}, Name: "general", Type: "group", CreatedBy: userID}).Error)
+
+	roomRepo := repository.NewRoomRepository()
+	svc := NewMessageService(repository.NewMessageRepository(), roomRepo, nil, nil, newTestRedis(t))
+
+	_, err := svc.GetDraft(ctx, roomID, userID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	draft, err := svc.SaveDraft(ctx, roomID, &model.SaveDraftRequest{Content: "first"}, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "first", draft.Content)
+
+	// Saving again replaces the draft instead of adding one
+	_, err = svc.SaveDraft(ctx, roomID, &model.SaveDraftRequest{Content: "second"}, userID)
+	require.NoError(t, err)
+	draft, err = svc.GetDraft(ctx, roomID, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "second", draft.Content)
+
+	var count int64
+	require.NoError(t, db.DB.Model(&model.MessageDraft{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	_, err = svc.SaveDraft(ctx, roomID, &model.SaveDraftRequest{Content: "hi"}, uuid.New())
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	// Sending a message clears the draft
+	_, err = svc.SendMessage(ctx, &model.SendMessageRequest{RoomID: roomID, Content: "second"}, userID)
+	require.NoError(t, err)
+	_, err = svc.GetDraft(ctx, roomID, userID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Leaving the room clears it too
+	_, err = svc.SaveDraft(ctx, roomID, &model.SaveDraftRequest{Content: "unsent"}, userID)
+	require.NoError(t, err)
+	require.NoError(t, roomRepo.RemoveMember(ctx, roomID, userID))
+	require.NoError(t, db.DB.Unscoped().Model(&model.MessageDraft{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestScheduledMessages(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	roomID, authorID := seedRoomMessages(t, db, 1)
+	require.NoError(t, db.DB.Create(&model.Room{BaseModel: model.BaseModel{ID: roomID}, Name: "general", Type: "group", CreatedBy: authorID}).Error)
+	leaverID := uuid.New()
+	require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: roomID, UserID: leaverID, Role: "member"}).Error)
+
+	roomRepo := repository.NewRoomRepository()
+	svc := NewMessageService(repository.NewMessageRepository(), roomRepo, nil, nil, newTestRedis(t))
+
+	past := time.Now().Add(-time.Minute)
+	_, err := svc.ScheduleMessage(ctx, &model.SendMessageRequest{RoomID: roomID, Content: "late", ScheduledAt: &past}, authorID)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	later := time.Now().Add(time.Hour)
+	schedule := func(userID uuid.UUID, content string) *model.ScheduledMessage {
+		scheduled, err := svc.ScheduleMessage(ctx, &model.SendMessageRequest{RoomID: roomID, Content: content, ScheduledAt: &later}, userID)
+		require.NoError(t, err)
+		return scheduled
+	}
+	kept := schedule(authorID, "good morning")
+	cancelled := schedule(authorID, "never mind")
+	orphaned := schedule(leaverID, "bye")
+
+	pending, err := svc.GetScheduledMessages(ctx, roomID, authorID)
+	require.NoError(t, err)
+	assert.Len(t, pending, 2)
+
+	// Only the author can cancel
+	assert.ErrorIs(t, svc.CancelScheduledMessage(ctx, cancelled.ID, leaverID), ErrNotFound)
+	require.NoError(t, svc.CancelScheduledMessage(ctx, cancelled.ID, authorID))
+	assert.ErrorIs(t, svc.CancelScheduledMessage(ctx, cancelled.ID, authorID), ErrInvalidArgument)
+
+	// Nothing is due yet
+	sent, err := svc.DispatchScheduledMessages(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, sent)
+
+	require.NoError(t, roomRepo.RemoveMember(ctx, roomID, leaverID))
+	require.NoError(t, db.DB.Model(&model.ScheduledMessage{}).Where("1 = 1").Update("scheduled_at", past).Error)
+
+	sent, err = svc.DispatchScheduledMessages(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+
+	statuses := map[uuid.UUID]model.ScheduledMessage{}
+	var all []model.ScheduledMessage
+	require.NoError(t, db.DB.Find(&all).Error)
+	for _, scheduled := range all {
+		statuses[scheduled.ID] = scheduled
+	}
+	assert.Equal(t, model.ScheduledMessageSent, statuses[kept.ID].Status)
+	require.NotNil(t, statuses[kept.ID].MessageID)
+	assert.Equal(t, model.ScheduledMessageCancelled, statuses[cancelled.ID].Status)
+	assert.Equal(t, model.ScheduledMessageCancelled, statuses[orphaned.ID].Status)
+
+	var message model.Message
+	require.NoError(t, db.DB.First(&message, "id = ?", *statuses[kept.ID].MessageID).Error)
+	assert.Equal(t, "good morning", message.Content)
+
+	var count int64
+	require.NoError(t, db.DB.Model(&model.Message{}).Where("content = ?", "bye").Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func mapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// BenchmarkGetMessagesDeepPage compares fetching a deep page of history with
+// a COUNT on every request against the first-page-only count
+func BenchmarkGetMessagesDeepPage(b *testing.B) {
+	db := newTestMessageDatabase(b)
+	ctx := context.Background()
+
+	roomID, userID := seedRoomMessages(b, db, 50000)
+	messageRepo := repository.NewMessageRepository()
+	svc := NewMessageService(messageRepo, repository.NewRoomRepository(), nil, nil, newTestRedis(b))
+
+	const page, limit = 200, 50
+
+	b.Run("count_every_page", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := messageRepo.CountRoomMessages(ctx, roomID, userID, model.DeletedMessagesExclude); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := messageRepo.GetRoomMessages(ctx, roomID, userID, (page-1)*limit, limit, model.DeletedMessagesExclude); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("count_first_page_only", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, _, err := svc.GetMessages(ctx, roomID, userID, page, limit, model.DeletedMessagesExclude); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestMarkRoomAsRead(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	roomID, senderID := seedRoomMessages(t, db, 10)
+	readerID := uuid.New()
+	require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: roomID, UserID: readerID, Role: "member"}).Error)
+
+	messageRepo := repository.NewMessageRepository()
+	svc := NewMessageService(messageRepo, repository.NewRoomRepository(), nil, nil, newTestRedis(t))
+
+	unread, err := messageRepo.GetUnreadCount(ctx, roomID, readerID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), unread)
+
+	var messages []model.Message
+	require.NoError(t, db.DB.Where("room_id = ?", roomID).Order("created_at ASC").Find(&messages).Error)
+
+	readAt, err := svc.MarkRoomAsRead(ctx, roomID, readerID, &messages[3].ID)
+	require.NoError(t, err)
+	assert.WithinDuration(t, messages[3].CreatedAt, readAt, time.Millisecond)
+
+	unread, err = messageRepo.GetUnreadCount(ctx, roomID, readerID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), unread)
+
+	// The cursor never moves back
+	_, err = svc.MarkRoomAsRead(ctx, roomID, readerID, &messages[1].ID)
+	require.NoError(t, err)
+	unread, err = messageRepo.GetUnreadCount(ctx, roomID, readerID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), unread)
+
+	// Reading a single newer message moves the cursor too
+	require.NoError(t, svc.MarkAsRead(ctx, messages[7].ID, readerID))
+	unread, err = messageRepo.GetUnreadCount(ctx, roomID, readerID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), unread)
+
+	_, err = svc.MarkRoomAsRead(ctx, roomID, readerID, nil)
+	require.NoError(t, err)
+	unread, err = messageRepo.GetUnreadCount(ctx, roomID, readerID)
+	require.NoError(t, err)
+	assert.Zero(t, unread)
+
+	// Own messages are never unread
+	unread, err = messageRepo.GetUnreadCount(ctx, roomID, senderID)
+	require.NoError(t, err)
+	assert.Zero(t, unread)
+
+	otherRoomID, _ := seedRoomMessages(t, db, 1)
+	var foreign model.Message
+	require.NoError(t, db.DB.First(&foreign, "room_id = ?", otherRoomID).Error)
+	_, err = svc.MarkRoomAsRead(ctx, roomID, readerID, &foreign.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = svc.MarkRoomAsRead(ctx, roomID, uuid.New(), nil)
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestGetAllUnreadCounts(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	busyRoomID, _ := seedRoomMessages(t, db, 5)
+	quietRoomID, _ := seedRoomMessages(t, db, 2)
+	emptyRoomID := uuid.New()
+	readerID := uuid.New()
+	for _, roomID := range []uuid.UUID{busyRoomID, quietRoomID, emptyRoomID} {
+		require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: roomID, UserID: readerID, Role: "member"}).Error)
+	}
+
+	svc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), nil, nil, newTestRedis(t))
+
+	counts, err := svc.GetAllUnreadCounts(ctx, readerID)
+	require.NoError(t, err)
+	assert.Equal(t, map[uuid.UUID]int64{busyRoomID: 5, quietRoomID: 2, emptyRoomID: 0}, counts)
+
+	// Reading a room drops the cached counts
+	_, err = svc.MarkRoomAsRead(ctx, quietRoomID, readerID, nil)
+	require.NoError(t, err)
+	counts, err = svc.GetAllUnreadCounts(ctx, readerID)
+	require.NoError(t, err)
+	assert.Equal(t, map[uuid.UUID]int64{busyRoomID: 5, quietRoomID: 0, emptyRoomID: 0}, counts)
+
+	counts, err = svc.GetAllUnreadCounts(ctx, uuid.New())
+	require.NoError(t, err)
+	assert.Empty(t, counts)
+}
+
+func TestDeliveryAndReadCounts(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	roomID, senderID := seedRoomMessages(t, db, 3)
+	alice, bob := uuid.New(), uuid.New()
+	for _, userID := range []uuid.UUID{alice, bob} {
+		require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: roomID, UserID: userID, Role: "member"}).Error)
+	}
+
+	svc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), nil, nil, newTestRedis(t))
+
+	var messages []model.Message
+	require.NoError(t, db.DB.Where("room_id = ?", roomID).Order("created_at ASC").Find(&messages).Error)
+	first, last := messages[0].ID, messages[2].ID
+
+	// Duplicates, own messages and messages of other rooms are ignored
+	otherRoomID, _ := seedRoomMessages(t, db, 1)
+	var foreign model.Message
+	require.NoError(t, db.DB.First(&foreign, "room_id = ?", otherRoomID).Error)
+	require.NoError(t, svc.MarkDelivered(ctx, alice, []uuid.UUID{first, last, foreign.ID}))
+	require.NoError(t, svc.MarkDelivered(ctx, alice, []uuid.UUID{first}))
+	require.NoError(t, svc.MarkDelivered(ctx, senderID, []uuid.UUID{first}))
+
+	var deliveries int64
+	require.NoError(t, db.DB.Model(&model.MessageDelivery{}).Count(&deliveries).Error)
+	assert.Equal(t, int64(2), deliveries)
+
+	// Bob read everything without acknowledging delivery
+	_, err := svc.MarkRoomAsRead(ctx, roomID, bob, &last)
+	require.NoError(t, err)
+
+	responses, _, err := svc.GetMessages(ctx, roomID, senderID, 1, 10, model.DeletedMessagesExclude)
+	require.NoError(t, err)
+	counts := map[uuid.UUID][2]int{}
+	for _, response := range responses {
+		require.NotNil(t, response.DeliveredCount)
+		require.NotNil(t, response.ReadCount)
+		counts[response.ID] = [2]int{*response.DeliveredCount, *response.ReadCount}
+	}
+	assert.Equal(t, [2]int{2, 1}, counts[first])
+	assert.Equal(t, [2]int{1, 1}, counts[messages[1].ID])
+	assert.Equal(t, [2]int{2, 1}, counts[last])
+
+	// Other members don't see receipts of messages they didn't send
+	responses, _, err = svc.GetMessages(ctx, roomID, alice, 1, 10, model.DeletedMessagesExclude)
+	require.NoError(t, err)
+	for _, response := range responses {
+		assert.Nil(t, response.DeliveredCount)
+		assert.Nil(t, response.ReadCount)
+	}
+}
+
+func TestReactionSummaries(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	roomID, senderID := seedRoomMessages(t, db, 2)
+	alice, outsider := uuid.New(), uuid.New()
+	require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: roomID, UserID: alice, Role: "member"}).Error)
+
+	svc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), nil, nil, newTestRedis(t))
+
+	var message model.Message
+	require.NoError(t, db.DB.Where("room_id = ?", roomID).Order("created_at ASC").First(&message).Error)
+
+	for _, reaction := range []struct {
+		emoji  string
+		userID uuid.UUID
+	}{{"👍", senderID}, {"👍", alice}, {"🎉", alice}} {
+		_, err := svc.ReactToMessage(ctx, message.ID, &model.ReactToMessageRequest{Emoji: reaction.emoji}, reaction.userID)
+		require.NoError(t, err)
+	}
+
+	responses, _, err := svc.GetMessages(ctx, roomID, senderID, 1, 10, model.DeletedMessagesExclude)
+	require.NoError(t, err)
+	require.Len(t, responses, 2)
+	for _, response := range responses {
+		assert.Empty(t, response.Reactions)
+		if response.ID == message.ID {
+			assert.Equal(t, map[string]int{"👍": 2, "🎉": 1}, response.ReactionCount)
+			assert.Equal(t, []string{"👍"}, response.MyReactions)
+		} else {
+			assert.Empty(t, response.ReactionCount)
+			assert.Empty(t, response.MyReactions)
+		}
+	}
+
+	require.NoError(t, svc.LoadReactionDetails(ctx, responses))
+	for _, response := range responses {
+		if response.ID == message.ID {
+			assert.Len(t, response.Reactions, 3)
+		}
+	}
+
+	reactions, meta, err := svc.GetMessageReactions(ctx, message.ID, alice, "👍", 1, 1)
+	require.NoError(t, err)
+	assert.Len(t, reactions, 1)
+	assert.Equal(t, 2, meta.Total)
+
+	_, _, err = svc.GetMessageReactions(ctx, message.ID, outsider, "", 1, 10)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, _, err = svc.GetMessageReactions(ctx, uuid.New(), alice, "", 1, 10)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestReactToMessageIsIdempotent(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	roomID, senderID := seedRoomMessages(t, db, 1)
+	svc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), nil, nil, newTestRedis(t))
+
+	var message model.Message
+	require.NoError(t, db.DB.First(&message, "room_id = ?", roomID).Error)
+	countReactions := func() int64 {
+		var count int64
+		require.NoError(t, db.DB.Model(&model.MessageReaction{}).Where("message_id = ?", message.ID).Count(&count).Error)
+		return count
+	}
+
+	result, err := svc.ReactToMessage(ctx, message.ID, &model.ReactToMessageRequest{Emoji: "👍"}, senderID)
+	require.NoError(t, err)
+	assert.Equal(t, model.ReactionResult{Emoji: "👍", Reacted: true, Changed: true}, *result)
+
+	// Repeating the reaction changes nothing
+	result, err = svc.ReactToMessage(ctx, message.ID, &model.ReactToMessageRequest{Emoji: "👍"}, senderID)
+	require.NoError(t, err)
+	assert.Equal(t, model.ReactionResult{Emoji: "👍", Reacted: true}, *result)
+	assert.Equal(t, int64(1), countReactions())
+
+	// Toggling removes it, and it can be added again afterwards
+	result, err = svc.ReactToMessage(ctx, message.ID, &model.ReactToMessageRequest{Emoji: "👍", Toggle: true}, senderID)
+	require.NoError(t, err)
+	assert.Equal(t, model.ReactionResult{Emoji: "👍", Changed: true}, *result)
+	assert.Equal(t, int64(0), countReactions())
+
+	result, err = svc.ReactToMessage(ctx, message.ID, &model.ReactToMessageRequest{Emoji: "👍", Toggle: true}, senderID)
+	require.NoError(t, err)
+	assert.True(t, result.Reacted)
+	assert.Equal(t, int64(1), countReactions())
+
+	// The store rejects duplicates on its own too
+	added, err := repository.NewMessageRepository().AddReaction(ctx, &model.MessageReaction{MessageID: message.ID, UserID: senderID, Emoji: "👍"})
+	require.NoError(t, err)
+	assert.False(t, added)
+
+	for i := 1; i < defaultMaxReactionsPerUser; i++ {
+		_, err := svc.ReactToMessage(ctx, message.ID, &model.ReactToMessageRequest{Emoji: fmt.Sprintf("e%d", i)}, senderID)
+		require.NoError(t, err)
+	}
+	_, err = svc.ReactToMessage(ctx, message.ID, &model.ReactToMessageRequest{Emoji: "🎉"}, senderID)
+	assert.ErrorIs(t, err, ErrConflict)
+
+	// Existing reactions stay idempotent at the limit
+	_, err = svc.ReactToMessage(ctx, message.ID, &model.ReactToMessageRequest{Emoji: "👍"}, senderID)
+	assert.NoError(t, err)
+}
+
+func TestSlowMode(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	memberID, adminID := uuid.New(), uuid.New()
+	room := &model.Room{Name: "slow", Type: "group", CreatedBy: adminID, SlowModeSeconds: 30}
+	require.NoError(t, db.DB.Create(room).Error)
+	require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: room.ID, UserID: memberID, Role: "member"}).Error)
+	require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: room.ID, UserID: adminID, Role: "admin"}).Error)
+
+	svc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), nil, nil, newTestRedis(t))
+	send := func(userID uuid.UUID) error {
+		_, err := svc.SendMessage(ctx, &model.SendMessageRequest{RoomID: room.ID, Content: "hi"}, userID)
+		return err
+	}
+
+	require.NoError(t, send(memberID))
+
+	err := send(memberID)
+	var rateLimited *RateLimitError
+	require.ErrorAs(t, err, &rateLimited)
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Greater(t, rateLimited.RetryAfter, time.Duration(0))
+	assert.LessOrEqual(t, rateLimited.RetryAfter, 30*time.Second)
+
+	// Admins are exempt
+	require.NoError(t, send(adminID))
+	require.NoError(t, send(adminID))
+
+	// Forwarding into the room is sending too
+	other := &model.Room{Name: "other", Type: "group", CreatedBy: adminID}
+	require.NoError(t, db.DB.Create(other).Error)
+	require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: other.ID, UserID: memberID, Role: "member"}).Error)
+	source, err := svc.SendMessage(ctx, &model.SendMessageRequest{RoomID: other.ID, Content: "look"}, memberID)
+	require.NoError(t, err)
+	results, err := svc.ForwardMessage(ctx, source.ID, []uuid.UUID{room.ID}, memberID)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Nil(t, results[0].MessageID)
+	assert.Contains(t, results[0].Error, ErrRateLimited.Error())
+
+	var count int64
+	require.NoError(t, db.DB.Model(&model.Message{}).Where("room_id = ?", room.ID).Count(&count).Error)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestRoomMessageTypeSettings(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	memberID, adminID := uuid.New(), uuid.New()
+	room := &model.Room{Name: "quiet", Type: "group", CreatedBy: adminID}
+	require.NoError(t, db.DB.Create(room).Error)
+	require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: room.ID, UserID: memberID, Role: "member"}).Error)
+	require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: room.ID, UserID: adminID, Role: "admin"}).Error)
+
+	redisClient := newTestRedis(t)
+	roomSvc := NewRoomService(repository.NewRoomRepository(), nil, redisClient)
+	svc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), nil, nil, redisClient)
+
+	off := false
+	updated, err := roomSvc.UpdateRoom(ctx, room.ID, &model.UpdateRoomRequest{AllowVoiceMessages: &off}, adminID)
+	require.NoError(t, err)
+	assert.False(t, updated.AllowVoiceMessages)
+	assert.True(t, updated.AllowFileUpload)
+
+	_, err = svc.SendMessage(ctx, &model.SendMessageRequest{RoomID: room.ID, Type: "voice_note", Content: "listen"}, memberID)
+	assert.ErrorIs(t, err, ErrMessageTypeDisabled)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, err = svc.SendMessage(ctx, &model.SendMessageRequest{RoomID: room.ID, Content: "typing instead"}, memberID)
+	require.NoError(t, err)
+
+	// Attachments count by their MIME type
+	room.AllowVoiceMessages, room.AllowVideoMessages, room.AllowFileUpload = true, false, false
+	assert.NoError(t, checkMessageTypeAllowed(room, "image", []model.MessageAttachment{{MimeType: "image/png"}}))
+	assert.NoError(t, checkMessageTypeAllowed(room, "text", []model.MessageAttachment{{MimeType: "audio/mpeg"}}))
+	assert.ErrorIs(t, checkMessageTypeAllowed(room, "text", []model.MessageAttachment{{MimeType: "video/mp4"}}), ErrMessageTypeDisabled)
+	assert.ErrorIs(t, checkMessageTypeAllowed(room, "image", []model.MessageAttachment{{MimeType: "application/pdf"}}), ErrMessageTypeDisabled)
+}
+
+func TestEnforceRetention(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	userID := uuid.New()
+	expiring := &model.Room{Name: "expiring", Type: "group", CreatedBy: userID, MessageRetentionDays: 7}
+	forever := &model.Room{Name: "forever", Type: "group", CreatedBy: userID}
+	require.NoError(t, db.DB.Create(expiring).Error)
+	require.NoError(t, db.DB.Create(forever).Error)
+
+	old := time.Now().AddDate(0, 0, -8)
+	messages := []model.Message{
+		{RoomID: expiring.ID, SenderID: userID, Type: "text", Content: "old"},
+		{RoomID: expiring.ID, SenderID: userID, Type: "text", Content: "recent"},
+		{RoomID: forever.ID, SenderID: userID, Type: "text", Content: "old but kept"},
+	}
+	messages[0].CreatedAt = old
+	messages[2].CreatedAt = old
+	for i := range messages {
+		require.NoError(t, db.DB.Create(&messages[i]).Error)
+	}
+
+	svc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), nil, nil, newTestRedis(t))
+
+	deleted, err := svc.EnforceRetention(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, deleted)
+
+	var stored []model.Message
+	require.NoError(t, db.DB.Find(&stored).Error)
+	contents := map[uuid.UUID]model.Message{}
+	for _, message := range stored {
+		contents[message.ID] = message
+	}
+	assert.True(t, contents[messages[0].ID].IsDeleted)
+	assert.Equal(t, model.RetentionDeletedContent, contents[messages[0].ID].Content)
+	assert.False(t, contents[messages[1].ID].IsDeleted)
+	assert.False(t, contents[messages[2].ID].IsDeleted)
+
+	// Already deleted messages aren't counted again
+	deleted, err = svc.EnforceRetention(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+}
+
+func TestEnforceRetentionHardDelete(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	require.NoError(t, db.Migrate(&model.FileUpload{}))
+	ctx := context.Background()
+
+	previous := config.AppConfig
+	config.AppConfig = &config.Config{Room: config.RoomConfig{RetentionBatchSize: 2, RetentionHardDelete: true}}
+	t.Cleanup(func() { config.AppConfig = previous })
+
+	uploadCfg := &config.UploadConfig{StoragePath: t.TempDir(), BaseURL: "http://localhost:8080/uploads"}
+	store := storage.NewLocal(uploadCfg.StoragePath, uploadCfg.BaseURL)
+	fileSvc := NewFileService(repository.NewFileRepository(), store, uploadCfg)
+
+	userID := uuid.New()
+	room := &model.Room{Name: "ephemeral", Type: "group", CreatedBy: userID, MessageRetentionDays: 1}
+	require.NoError(t, db.DB.Create(room).Error)
+
+	old := time.Now().AddDate(0, 0, -2)
+	var expired []model.Message
+	for i := 0; i < 3; i++ {
+		message := model.Message{RoomID: room.ID, SenderID: userID, Type: "text", Content: "old"}
+		message.CreatedAt = old
+		require.NoError(t, db.DB.Create(&message).Error)
+		require.NoError(t, db.DB.Create(&model.MessageRead{MessageID: message.ID, UserID: userID}).Error)
+		require.NoError(t, db.DB.Create(&model.MessageReaction{MessageID: message.ID, UserID: userID, Emoji: "👍"}).Error)
+		expired = append(expired, message)
+	}
+	reply := model.Message{RoomID: room.ID, SenderID: userID, Type: "text", Content: "recent", ReplyToID: &expired[0].ID}
+	require.NoError(t, db.DB.Create(&reply).Error)
+
+	require.NoError(t, store.Put(ctx, "photo.png", strings.NewReader("png"), "image/png"))
+	require.NoError(t, db.DB.Create(&model.FileUpload{UserID: userID, OriginalName: "photo.png", FileName: "photo.png", FilePath: "photo.png", UploadStatus: "completed"}).Error)
+	require.NoError(t, db.DB.Create(&model.MessageAttachment{MessageID: expired[1].ID, FileName: "photo.png", FileType: "image", MimeType: "image/png", URL: store.URL("photo.png")}).Error)
+
+	svc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), nil, fileSvc, newTestRedis(t))
+	deleted, err := svc.EnforceRetention(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, deleted)
+
+	var remaining []model.Message
+	require.NoError(t, db.DB.Unscoped().Find(&remaining).Error)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, reply.ID, remaining[0].ID)
+	assert.Nil(t, remaining[0].ReplyToID)
+
+	for _, value := range []interface{}{&model.MessageRead{}, &model.MessageReaction{}, &model.MessageAttachment{}, &model.FileUpload{}} {
+		var count int64
+		require.NoError(t, db.DB.Model(value).Count(&count).Error)
+		assert.Zero(t, count)
+	}
+	_, err = store.Get(ctx, "photo.png")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string
+	}{
+		{"hello", nil},
+		{"@alice hi", []string{"alice"}},
+		{"hi @alice, @bob.smith and @alice again.", []string{"alice", "bob.smith"}},
+		{"mail alice@example.com or @@bob", nil},
+		{"(@carol_1) @dave-x!", []string{"carol_1", "dave-x"}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, parseMentions(tt.content), tt.content)
+	}
+}
+
+func TestSendMessageStoresMentions(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	sender := uuid.New()
+	room := &model.Room{Name: "general", Type: "group", CreatedBy: sender}
+	require.NoError(t, db.DB.Create(room).Error)
+	require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: room.ID, UserID: sender, Role: "member"}).Error)
+	roomID := room.ID
+
+	alice := &model.User{Username: "alice", Email: "alice@example.com", Password: "x"}
+	bob := &model.User{Username: "bob", Email: "bob@example.com", Password: "x"}
+	require.NoError(t, db.DB.Create(alice).Error)
+	require.NoError(t, db.DB.Create(bob).Error)
+
+	svc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), repository.NewUserRepository(), nil, newTestRedis(t))
+
+	// Mentions come from the content, not from client supplied metadata
+	forged := `{"mentioned_users":["` + uuid.NewString() + `"],"location":"home"}`
+	message, err := svc.SendMessage(ctx, &model.SendMessageRequest{
+		RoomID:   roomID,
+		Content:  "@alice @bob @nobody see mail@bob.example",
+		Metadata: forged,
+	}, sender)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []uuid.UUID{alice.ID, bob.ID}, MentionedUserIDs(message.Metadata))
+	assert.Contains(t, message.Metadata, `"location":"home"`)
+
+	// Edits re-parse the mentions
+	message, err = svc.EditMessage(ctx, message.ID, &model.EditMessageRequest{Content: "only @bob"}, sender)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{bob.ID}, MentionedUserIDs(message.Metadata))
+
+	message, err = svc.SendMessage(ctx, &model.SendMessageRequest{RoomID: roomID, Content: "no mentions"}, sender)
+	require.NoError(t, err)
+	assert.Empty(t, message.Metadata)
+}
+
+func TestExportRoom(t *testing.T) {
+	db := newTestMessageDatabase(t)
+	ctx := context.Background()
+
+	// More than one batch, so the export has to page through the room
+	roomID, memberID := seedRoomMessages(t, db, exportBatchSize+5)
+	require.NoError(t, db.DB.Create(&model.User{BaseModel: model.BaseModel{ID: memberID}, Username: "member", Email: "member@example.com", Password: "secret"}).Error)
+	require.NoError(t, db.DB.Create(&model.Room{BaseModel: model.BaseModel{ID: roomID}, Name: "general", Type: "group", CreatedBy: memberID}).Error)
+
+	var first model.Message
+	require.NoError(t, db.DB.Where("room_id = ?", roomID).Order("created_at ASC").First(&first).Error)
+	require.NoError(t, db.DB.Create(&model.MessageReaction{MessageID: first.ID, UserID: memberID, Emoji: "👍"}).Error)
+
+	svc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), nil, nil, newTestRedis(t))
+
+	_, err := svc.PrepareRoomExport(ctx, roomID, memberID, "xml")
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+	_, err = svc.PrepareRoomExport(ctx, roomID, uuid.New(), ExportFormatJSON)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	room, err := svc.PrepareRoomExport(ctx, roomID, memberID, ExportFormatJSON)
+	require.NoError(t, err)
+
+	var out strings.Builder
+	require.NoError(t, svc.ExportRoom(ctx, room, memberID, ExportFormatJSON, &out))
+
+	var export struct {
+		Room     map[string]interface{}  `json:"room"`
+		Messages []model.ExportedMessage `json:"messages"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(out.String()), &export))
+	assert.Equal(t, "general", export.Room["name"])
+	require.Len(t, export.Messages, exportBatchSize+5)
+	assert.Equal(t, "message 0", export.Messages[0].Content)
+	assert.Equal(t, "member", export.Messages[0].SenderUsername)
+	assert.Equal(t, []model.ExportedReaction{{Emoji: "👍", UserID: memberID, Username: "member"}}, export.Messages[0].Reactions)
+	assert.Equal(t, fmt.Sprintf("message %d", exportBatchSize+4), export.Messages[exportBatchSize+4].Content)
+
+	// One export per room and user per hour
+	_, err = svc.PrepareRoomExport(ctx, roomID, memberID, ExportFormatCSV)
+	var rateLimited *RateLimitError
+	require.ErrorAs(t, err, &rateLimited)
+	assert.LessOrEqual(t, rateLimited.RetryAfter, exportCooldown)
+
+	out.Reset()
+	require.NoError(t, svc.ExportRoom(ctx, room, memberID, ExportFormatCSV, &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, exportBatchSize+6)
+	assert.True(t, strings.HasPrefix(lines[0], "id,created_at,sender_id"))
+	assert.True(t, strings.HasSuffix(lines[1], ",👍:member"))
+}
@@ -0,0 +1,432 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+	"realtime-api/internal/redis"
+	"realtime-api/internal/repository"
+	"realtime-api/internal/tracing"
+
+	"github.com/google/uuid"
+)
+
+// Notification types
+const (
+	NotificationTypeMessage        = "message"
+	NotificationTypeRoomInvite     = "room_invite"
+	NotificationTypeRoomJoin       = "room_join"
+	NotificationTypeRoomLeave      = "room_leave"
+	NotificationTypeJoinRequest    = "join_request"
+	NotificationTypeContactRequest = "contact_request"
+)
+
+type NotificationService interface {
+	CreateNotification(ctx context.Context, userID uuid.UUID, notificationType, title, message string, data map[string]interface{}) (*model.Notification, error)
+	NotifyRoomMembers(ctx context.Context, roomID uuid.UUID, excludeUserID *uuid.UUID, mentioned []uuid.UUID, notificationType, title, message string, data map[string]interface{}) ([]model.Notification, error)
+	GetNotifications(ctx context.Context, userID uuid.UUID, isRead *bool, page, limit int) ([]model.Notification, *model.PaginationMeta, error)
+	GetUnreadCount(ctx context.Context, userID uuid.UUID) (int64, error)
+	MarkAsRead(ctx context.Context, notificationID, userID uuid.UUID) error
+	MarkAllAsRead(ctx context.Context, userID uuid.UUID) error
+	DeleteNotification(ctx context.Context, notificationID, userID uuid.UUID) error
+	EnforceRetention(ctx context.Context) (int64, error)
+	RegisterDevice(ctx context.Context, userID uuid.UUID, req *model.RegisterDeviceRequest) (*model.DeviceToken, error)
+	UnregisterDevice(ctx context.Context, userID uuid.UUID, token string) error
+}
+
+const (
+	// pushTimeout bounds the push notifications of one notification
+	pushTimeout = 30 * time.Second
+	// notificationRetention is how long read notifications are kept
+	notificationRetention = 90 * 24 * time.Hour
+)
+
+type notificationService struct {
+	notificationRepo repository.NotificationRepository
+	roomRepo         repository.RoomRepository
+	sessionRepo      repository.SessionRepository
+	deviceRepo       repository.DeviceTokenRepository
+	userRepo         repository.UserRepository
+	redis            *redis.Redis
+	push             PushNotificationService
+	publisher        NotificationPublisher
+
+	// pushes tracks the push notifications still being sent
+	pushes sync.WaitGroup
+}
+
+// NotificationPublisher queues notifications for the email digests
+type NotificationPublisher interface {
+	PublishNotificationEvent(userID string, notification interface{}) error
+}
+
+// NewNotificationService creates the notification service. With a push
+// service, notifications of offline users are also pushed to their devices,
+// and with a publisher they are queued for the email digests; push and
+// publisher may be nil when those are disabled.
+func NewNotificationService(notificationRepo repository.NotificationRepository, roomRepo repository.RoomRepository, sessionRepo repository.SessionRepository, deviceRepo repository.DeviceTokenRepository, userRepo repository.UserRepository, redis *redis.Redis, push PushNotificationService, publisher NotificationPublisher) NotificationService {
+	return &notificationService{
+		notificationRepo: notificationRepo,
+		roomRepo:         roomRepo,
+		sessionRepo:      sessionRepo,
+		deviceRepo:       deviceRepo,
+		userRepo:         userRepo,
+		redis:            redis,
+		push:             push,
+		publisher:        publisher,
+	}
+}
+
+func (s *notificationService) CreateNotification(ctx context.Context, userID uuid.UUID, notificationType, title, message string, data map[string]interface{}) (_ *model.Notification, err error) {
+	ctx, span := tracing.Start(ctx, "service.notification.CreateNotification", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	notification, err := newNotification(userID, notificationType, title, message, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.notificationRepo.Create(ctx, notification); err != nil {
+		return nil, fmt.Errorf("failed to create notification: %w", err)
+	}
+
+	s.pushToOfflineUsers([]model.Notification{*notification})
+	s.queueOfflineEmails(ctx, []model.Notification{*notification})
+	return notification, nil
+}
+
+// NotifyRoomMembers creates the same notification for every member of a room,
+// skipping excludeUserID, usually the user who caused it. Members are notified
+// according to their notification level for the room: members on "mentions"
+// only when they are in mentioned, members on "none" never. It returns the
+// notifications created.
+func (s *notificationService) NotifyRoomMembers(ctx context.Context, roomID uuid.UUID, excludeUserID *uuid.UUID, mentioned []uuid.UUID, notificationType, title, message string, data map[string]interface{}) (_ []model.Notification, err error) {
+	ctx, span := tracing.Start(ctx, "service.notification.NotifyRoomMembers", tracing.ID("room_id", roomID))
+	defer func() { tracing.End(span, err) }()
+
+	members, err := s.roomRepo.GetRoomMembers(ctx, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room members: %w", err)
+	}
+
+	notifications := make([]model.Notification, 0, len(members))
+	for _, member := range members {
+		if excludeUserID != nil && member.UserID == *excludeUserID {
+			continue
+		}
+		if !wantsNotification(member, mentioned) {
+			continue
+		}
+
+		notification, err := newNotification(member.UserID, notificationType, title, message, data)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, *notification)
+	}
+
+	if err := s.notificationRepo.CreateBatch(ctx, notifications); err != nil {
+		return nil, fmt.Errorf("failed to create notifications: %w", err)
+	}
+
+	s.pushToOfflineUsers(notifications)
+	s.queueOfflineEmails(ctx, notifications)
+	return notifications, nil
+}
+
+// pushToOfflineUsers sends the notifications of users who are offline and
+// have push notifications enabled to their registered devices and the devices
+// of their active sessions, in the background. Tokens Firebase no longer
+// accepts are removed.
+func (s *notificationService) pushToOfflineUsers(notifications []model.Notification) {
+	if s.push == nil || len(notifications) == 0 {
+		return
+	}
+
+	s.pushes.Add(1)
+	go func() {
+		defer s.pushes.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), pushTimeout)
+		defer cancel()
+
+		for _, notification := range notifications {
+			if err := s.pushNotification(ctx, &notification); err != nil {
+				logger.Warn("Failed to push notification", logger.WithFields(map[string]interface{}{
+					"user_id": notification.UserID,
+					"error":   err.Error(),
+				}))
+			}
+		}
+	}()
+}
+
+func (s *notificationService) pushNotification(ctx context.Context, notification *model.Notification) error {
+	online, err := s.redis.IsUserOnline(ctx, notification.UserID.String())
+	if err != nil {
+		return fmt.Errorf("failed to check user presence: %w", err)
+	}
+	if online {
+		return nil
+	}
+
+	user, err := s.userRepo.GetByID(ctx, notification.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil || !user.PushNotifications {
+		return nil
+	}
+
+	tokens, err := s.deviceTokens(ctx, notification.UserID)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		"notification_id": notification.ID.String(),
+		"type":            notification.Type,
+		"data":            notification.Data,
+	}
+	for _, token := range tokens {
+		err := s.push.SendToDevice(ctx, token, notification.Title, notification.Message, data)
+		if errors.Is(err, ErrDeviceTokenInvalid) {
+			if err := s.sessionRepo.ClearFCMToken(ctx, token); err != nil {
+				return err
+			}
+			if err := s.deviceRepo.DeleteByToken(ctx, token); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deviceTokens returns the registered device tokens of a user together with
+// the FCM tokens of their active sessions, each token once
+func (s *notificationService) deviceTokens(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	devices, err := s.deviceRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := s.sessionRepo.GetActiveByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(devices)+len(sessions))
+	tokens := make([]string, 0, len(devices)+len(sessions))
+	add := func(token string) {
+		if token != "" && !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+	for _, device := range devices {
+		add(device.Token)
+	}
+	for _, session := range sessions {
+		add(session.FCMToken)
+	}
+	return tokens, nil
+}
+
+// RegisterDevice stores a push notification token of one of the user's
+// devices. Registering a token again refreshes when it was last seen.
+func (s *notificationService) RegisterDevice(ctx context.Context, userID uuid.UUID, req *model.RegisterDeviceRequest) (_ *model.DeviceToken, err error) {
+	ctx, span := tracing.Start(ctx, "service.notification.RegisterDevice", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	device := &model.DeviceToken{
+		UserID:   userID,
+		Platform: req.Platform,
+		Token:    req.Token,
+		LastSeen: time.Now(),
+	}
+	if err := s.deviceRepo.Save(ctx, device); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// UnregisterDevice stops push notifications to a device of the user
+func (s *notificationService) UnregisterDevice(ctx context.Context, userID uuid.UUID, token string) (err error) {
+	ctx, span := tracing.Start(ctx, "service.notification.UnregisterDevice", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	deleted, err := s.deviceRepo.Delete(ctx, userID, token)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("%w: device is not registered", ErrNotFound)
+	}
+	return nil
+}
+
+// queueOfflineEmails publishes the notifications of offline users for the
+// email digests. Failures are logged; the notifications exist either way.
+func (s *notificationService) queueOfflineEmails(ctx context.Context, notifications []model.Notification) {
+	if s.publisher == nil {
+		return
+	}
+
+	for _, notification := range notifications {
+		userID := notification.UserID.String()
+		online, err := s.redis.IsUserOnline(ctx, userID)
+		if err != nil {
+			logger.Warn("Failed to check user presence", logger.WithField("error", err.Error()))
+			continue
+		}
+		if online {
+			continue
+		}
+		if err := s.publisher.PublishNotificationEvent(userID, notification); err != nil {
+			logger.Warn("Failed to queue notification email", logger.WithFields(map[string]interface{}{
+				"user_id": notification.UserID,
+				"error":   err.Error(),
+			}))
+		}
+	}
+}
+
+// GetNotifications returns a page of the user's notifications, only the read
+// or unread ones when isRead is set
+func (s *notificationService) GetNotifications(ctx context.Context, userID uuid.UUID, isRead *bool, page, limit int) (_ []model.Notification, _ *model.PaginationMeta, err error) {
+	ctx, span := tracing.Start(ctx, "service.notification.GetNotifications", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	page, limit = normalizePage(page, limit)
+	offset := (page - 1) * limit
+
+	notifications, total, err := s.notificationRepo.GetByUserID(ctx, userID, isRead, offset, limit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get notifications: %w", err)
+	}
+
+	return notifications, newPaginationMeta(page, limit, total), nil
+}
+
+// GetUnreadCount returns the number of unread notifications, for badges
+func (s *notificationService) GetUnreadCount(ctx context.Context, userID uuid.UUID) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "service.notification.GetUnreadCount", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	return s.notificationRepo.CountUnread(ctx, userID)
+}
+
+func (s *notificationService) MarkAsRead(ctx context.Context, notificationID, userID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.notification.MarkAsRead", tracing.ID("notification_id", notificationID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	found, err := s.notificationRepo.MarkAsRead(ctx, notificationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification as read: %w", err)
+	}
+	if !found {
+		return fmt.Errorf("%w: notification not found", ErrNotFound)
+	}
+	return nil
+}
+
+func (s *notificationService) MarkAllAsRead(ctx context.Context, userID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.notification.MarkAllAsRead", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.notificationRepo.MarkAllAsRead(ctx, userID); err != nil {
+		return fmt.Errorf("failed to mark notifications as read: %w", err)
+	}
+	return nil
+}
+
+func (s *notificationService) DeleteNotification(ctx context.Context, notificationID, userID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.notification.DeleteNotification", tracing.ID("notification_id", notificationID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	found, err := s.notificationRepo.DeleteByID(ctx, notificationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete notification: %w", err)
+	}
+	if !found {
+		return fmt.Errorf("%w: notification not found", ErrNotFound)
+	}
+	return nil
+}
+
+// EnforceRetention deletes the notifications read more than
+// notificationRetention ago and returns how many were deleted. Unread
+// notifications are kept until they are read.
+func (s *notificationService) EnforceRetention(ctx context.Context) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "service.notification.EnforceRetention")
+	defer func() { tracing.End(span, err) }()
+
+	return s.notificationRepo.DeleteReadBefore(ctx, time.Now().Add(-notificationRetention))
+}
+
+// wantsNotification applies the notification level of a member
+func wantsNotification(member model.RoomMember, mentioned []uuid.UUID) bool {
+	switch member.NotificationLevel {
+	case model.NotificationLevelNone:
+		return false
+	case model.NotificationLevelMentions:
+		for _, userID := range mentioned {
+			if userID == member.UserID {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// MentionedUserIDs reads the mentioned_users entry of message metadata.
+// Invalid metadata or IDs are ignored.
+func MentionedUserIDs(metadata string) []uuid.UUID {
+	if metadata == "" {
+		return nil
+	}
+
+	var parsed struct {
+		MentionedUsers []string `json:"mentioned_users"`
+	}
+	if err := json.Unmarshal([]byte(metadata), &parsed); err != nil {
+		return nil
+	}
+
+	var userIDs []uuid.UUID
+	for _, value := range parsed.MentionedUsers {
+		if userID, err := uuid.Parse(value); err == nil {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs
+}
+
+func newNotification(userID uuid.UUID, notificationType, title, message string, data map[string]interface{}) (*model.Notification, error) {
+	notification := &model.Notification{
+		UserID:  userID,
+		Type:    notificationType,
+		Title:   title,
+		Message: message,
+		Data:    "{}",
+	}
+
+	if data != nil {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode notification data: %w", err)
+		}
+		notification.Data = string(encoded)
+	}
+
+	return notification, nil
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"realtime-api/internal/model"
+	"realtime-api/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationLifecycle(t *testing.T) {
+	db := newTestDatabase(t, &model.User{}, &model.Room{}, &model.RoomMember{}, &model.Notification{})
+	ctx := context.Background()
+
+	roomID := uuid.New()
+	sender := uuid.New()
+	recipients := []uuid.UUID{uuid.New(), uuid.New()}
+	for _, userID := range append([]uuid.UUID{sender}, recipients...) {
+		require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: roomID, UserID: userID, Role: "member"}).Error)
+	}
+
+	svc := NewNotificationService(repository.NewNotificationRepository(), repository.NewRoomRepository(), repository.NewSessionRepository(), repository.NewDeviceTokenRepository(), repository.NewUserRepository(), nil, nil, nil)
+
+	created, err := svc.NotifyRoomMembers(ctx, roomID, &sender, nil, NotificationTypeMessage, "New message", "hello",
+		map[string]interface{}{"room_id": roomID})
+	require.NoError(t, err)
+	assert.Len(t, created, len(recipients))
+
+	notifications, meta, err := svc.GetNotifications(ctx, sender, nil, 1, 20)
+	require.NoError(t, err)
+	assert.Empty(t, notifications)
+	assert.Equal(t, 0, meta.Total)
+
+	recipient := recipients[0]
+	_, err = svc.CreateNotification(ctx, recipient, NotificationTypeRoomJoin, "Added to a room", "You were added to a room", nil)
+	require.NoError(t, err)
+
+	notifications, meta, err = svc.GetNotifications(ctx, recipient, nil, 1, 20)
+	require.NoError(t, err)
+	require.Len(t, notifications, 2)
+	assert.Equal(t, 2, meta.Total)
+
+	// Another user can't touch the recipient's notifications
+	assert.ErrorIs(t, svc.MarkAsRead(ctx, notifications[0].ID, recipients[1]), ErrNotFound)
+	assert.ErrorIs(t, svc.DeleteNotification(ctx, notifications[0].ID, recipients[1]), ErrNotFound)
+
+	require.NoError(t, svc.MarkAsRead(ctx, notifications[0].ID, recipient))
+	unread, err := svc.GetUnreadCount(ctx, recipient)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), unread)
+	read := true
+	notifications, _, err = svc.GetNotifications(ctx, recipient, &read, 1, 20)
+	require.NoError(t, err)
+	assert.Len(t, notifications, 1)
+
+	require.NoError(t, svc.MarkAllAsRead(ctx, recipient))
+	unread, err = svc.GetUnreadCount(ctx, recipient)
+	require.NoError(t, err)
+	assert.Zero(t, unread)
+
+	notifications, _, err = svc.GetNotifications(ctx, recipient, nil, 1, 20)
+	require.NoError(t, err)
+	for _, notification := range notifications {
+		assert.True(t, notification.IsRead)
+		assert.NotNil(t, notification.ReadAt)
+	}
+
+	require.NoError(t, svc.DeleteNotification(ctx, notifications[0].ID, recipient))
+	notifications, _, err = svc.GetNotifications(ctx, recipient, nil, 1, 20)
+	require.NoError(t, err)
+	assert.Len(t, notifications, 1)
+
+	// The other recipient still has the untouched message notification
+	notifications, _, err = svc.GetNotifications(ctx, recipients[1], nil, 1, 20)
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.False(t, notifications[0].IsRead)
+}
+
+func TestNotifyRoomMembersHonoursNotificationLevel(t *testing.T) {
+	db := newTestDatabase(t, &model.User{}, &model.Room{}, &model.RoomMember{}, &model.Notification{})
+	ctx := context.Background()
+
+	roomID := uuid.New()
+	levels := map[uuid.UUID]model.NotificationLevel{
+		uuid.New(): model.NotificationLevelAll,
+		uuid.New(): model.NotificationLevelMentions,
+		uuid.New(): model.NotificationLevelNone,
+	}
+	var mentionsOnly uuid.UUID
+	for userID, level := range levels {
+		require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: roomID, UserID: userID, Role: "member", NotificationLevel: level}).Error)
+		if level == model.NotificationLevelMentions {
+			mentionsOnly = userID
+		}
+	}
+
+	svc := NewNotificationService(repository.NewNotificationRepository(), repository.NewRoomRepository(), repository.NewSessionRepository(), repository.NewDeviceTokenRepository(), repository.NewUserRepository(), nil, nil, nil)
+	_, err := svc.NotifyRoomMembers(ctx, roomID, nil, nil, NotificationTypeMessage, "New message", "hello", nil)
+	require.NoError(t, err)
+
+	mentioned := MentionedUserIDs(`{"mentioned_users":["` + mentionsOnly.String() + `","not-a-uuid"]}`)
+	require.Equal(t, []uuid.UUID{mentionsOnly}, mentioned)
+	_, err = svc.NotifyRoomMembers(ctx, roomID, nil, mentioned, NotificationTypeMessage, "New message", "hi @you", nil)
+	require.NoError(t, err)
+
+	want := map[model.NotificationLevel]int{
+		model.NotificationLevelAll:      2,
+		model.NotificationLevelMentions: 1,
+		model.NotificationLevelNone:     0,
+	}
+	for userID, level := range levels {
+		_, meta, err := svc.GetNotifications(ctx, userID, nil, 1, 20)
+		require.NoError(t, err)
+		assert.Equal(t, want[level], meta.Total, "level %s", level)
+	}
+}
+
+func TestNotificationRetention(t *testing.T) {
+	db := newTestDatabase(t, &model.User{}, &model.Room{}, &model.RoomMember{}, &model.Notification{})
+	ctx := context.Background()
+
+	svc := NewNotificationService(repository.NewNotificationRepository(), repository.NewRoomRepository(), repository.NewSessionRepository(), repository.NewDeviceTokenRepository(), repository.NewUserRepository(), nil, nil, nil)
+	userID := uuid.New()
+	for i := 0; i < 3; i++ {
+		_, err := svc.CreateNotification(ctx, userID, NotificationTypeRoomJoin, "Added to a room", "You were added to a room", nil)
+		require.NoError(t, err)
+	}
+	notifications, _, err := svc.GetNotifications(ctx, userID, nil, 1, 20)
+	require.NoError(t, err)
+
+	// Only notifications read long enough ago are deleted, unread ones stay
+	readAt := time.Now().Add(-notificationRetention - time.Hour)
+	require.NoError(t, db.DB.Model(&notifications[0]).Updates(map[string]interface{}{"is_read": true, "read_at": readAt}).Error)
+	require.NoError(t, db.DB.Model(&notifications[1]).Updates(map[string]interface{}{"is_read": true, "read_at": time.Now()}).Error)
+
+	deleted, err := svc.EnforceRetention(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	_, meta, err := svc.GetNotifications(ctx, userID, nil, 1, 20)
+	require.NoError(t, err)
+	assert.Equal(t, 2, meta.Total)
+	unread, err := svc.GetUnreadCount(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), unread)
+}
+
+// testPublisher records the notifications queued for email
+type testPublisher struct {
+	published []string
+}
+
+func (p *testPublisher) PublishNotificationEvent(userID string, notification interface{}) error {
+	p.published = append(p.published, userID)
+	return nil
+}
+
+func TestQueueOfflineEmails(t *testing.T) {
+	db := newTestDatabase(t, &model.User{}, &model.Room{}, &model.RoomMember{}, &model.Notification{})
+	redisClient := newTestRedis(t)
+	ctx := context.Background()
+
+	roomID := uuid.New()
+	online, offline := uuid.New(), uuid.New()
+	for _, userID := range []uuid.UUID{online, offline} {
+		require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: roomID, UserID: userID, Role: "member"}).Error)
+	}
+	require.NoError(t, redisClient.SetUserOnline(ctx, online.String()))
+
+	publisher := &testPublisher{}
+	svc := NewNotificationService(repository.NewNotificationRepository(), repository.NewRoomRepository(), repository.NewSessionRepository(), repository.NewDeviceTokenRepository(), repository.NewUserRepository(), redisClient, nil, publisher)
+
+	_, err := svc.NotifyRoomMembers(ctx, roomID, nil, nil, NotificationTypeMessage, "New message", "hello", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{offline.String()}, publisher.published)
+}
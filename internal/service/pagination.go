@@ -0,0 +1,27 @@
+package service
+
+import "realtime-api/internal/model"
+
+// normalizePage clamps pagination parameters to sane bounds
+func normalizePage(page, limit int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	return page, limit
+}
+
+func newPaginationMeta(page, limit int, total int64) *model.PaginationMeta {
+	return &model.PaginationMeta{
+		Page:       page,
+		Limit:      limit,
+		Total:      int(total),
+		TotalPages: (int(total) + limit - 1) / limit,
+		HasMore:    int64(page*limit) < total,
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+	"realtime-api/internal/redis"
+	"realtime-api/internal/repository"
+	"realtime-api/internal/tracing"
+
+	"github.com/google/uuid"
+)
+
+// preferencesCacheTTL is how long preferences stay cached in Redis
+const preferencesCacheTTL = 10 * time.Minute
+
+type PreferencesService interface {
+	GetPreferences(ctx context.Context, userID uuid.UUID) (*model.UserPreferences, error)
+	UpdatePreferences(ctx context.Context, userID uuid.UUID, req *model.UpdatePreferencesRequest) (*model.UserPreferences, error)
+}
+
+type preferencesService struct {
+	prefsRepo repository.UserPreferencesRepository
+	redis     *redis.Redis
+}
+
+func NewPreferencesService(prefsRepo repository.UserPreferencesRepository, redis *redis.Redis) PreferencesService {
+	return &preferencesService{
+		prefsRepo: prefsRepo,
+		redis:     redis,
+	}
+}
+
+// GetPreferences returns the preferences of a user, the defaults until they
+// change any
+func (s *preferencesService) GetPreferences(ctx context.Context, userID uuid.UUID) (_ *model.UserPreferences, err error) {
+	ctx, span := tracing.Start(ctx, "service.preferences.GetPreferences", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	if prefs := s.cachedPreferences(ctx, userID); prefs != nil {
+		return prefs, nil
+	}
+
+	prefs, err := s.prefsRepo.GetOrCreate(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cachePreferences(ctx, prefs)
+	return prefs, nil
+}
+
+// UpdatePreferences changes the preferences set in req
+func (s *preferencesService) UpdatePreferences(ctx context.Context, userID uuid.UUID, req *model.UpdatePreferencesRequest) (_ *model.UserPreferences, err error) {
+	ctx, span := tracing.Start(ctx, "service.preferences.UpdatePreferences", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	prefs, err := s.prefsRepo.GetOrCreate(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Theme != "" {
+		prefs.Theme = req.Theme
+	}
+	if req.FontSize != "" {
+		prefs.FontSize = req.FontSize
+	}
+	if req.ChatWallpaper != nil {
+		prefs.ChatWallpaper = *req.ChatWallpaper
+	}
+	if req.AutoDownloadMedia != nil {
+		prefs.AutoDownloadMedia = *req.AutoDownloadMedia
+	}
+	if req.CompressImages != nil {
+		prefs.CompressImages = *req.CompressImages
+	}
+	if req.KeyboardShortcuts != nil {
+		prefs.KeyboardShortcuts = *req.KeyboardShortcuts
+	}
+	if req.ShowTypingIndicators != nil {
+		prefs.ShowTypingIndicators = *req.ShowTypingIndicators
+	}
+	if req.GroupNotifications != nil {
+		prefs.GroupNotifications = *req.GroupNotifications
+	}
+
+	if err := s.prefsRepo.Update(ctx, prefs); err != nil {
+		return nil, err
+	}
+
+	s.cachePreferences(ctx, prefs)
+	return prefs, nil
+}
+
+// cachedPreferences returns the cached preferences of a user, nil when they
+// aren't cached or the cache can't be read
+func (s *preferencesService) cachedPreferences(ctx context.Context, userID uuid.UUID) *model.UserPreferences {
+	cached, err := s.redis.GetUserPreferences(ctx, userID.String())
+	if err != nil {
+		logger.Warn("Failed to get cached preferences", logger.WithField("error", err.Error()))
+		return nil
+	}
+	if cached == "" {
+		return nil
+	}
+
+	var prefs model.UserPreferences
+	if err := json.Unmarshal([]byte(cached), &prefs); err != nil {
+		return nil
+	}
+	return &prefs
+}
+
+func (s *preferencesService) cachePreferences(ctx context.Context, prefs *model.UserPreferences) {
+	encoded, err := json.Marshal(prefs)
+	if err != nil {
+		return
+	}
+	if err := s.redis.SetUserPreferences(ctx, prefs.UserID.String(), string(encoded), preferencesCacheTTL); err != nil {
+		logger.Warn("Failed to cache preferences", logger.WithField("error", err.Error()))
+	}
+}
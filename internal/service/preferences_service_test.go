@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"realtime-api/internal/model"
+	"realtime-api/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreferences(t *testing.T) {
+	db := newTestDatabase(t, &model.User{}, &model.UserPreferences{})
+	redisClient := newTestRedis(t)
+	svc := NewPreferencesService(repository.NewUserPreferencesRepository(), redisClient)
+	ctx := context.Background()
+	userID := uuid.New()
+
+	prefs, err := svc.GetPreferences(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "light", prefs.Theme)
+	assert.Equal(t, "medium", prefs.FontSize)
+	assert.True(t, prefs.AutoDownloadMedia)
+	assert.True(t, prefs.GroupNotifications)
+
+	cached, err := redisClient.GetUserPreferences(ctx, userID.String())
+	require.NoError(t, err)
+	assert.Contains(t, cached, `"theme":"light"`)
+
+	off := false
+	wallpaper := "https://example.com/wallpaper.png"
+	prefs, err = svc.UpdatePreferences(ctx, userID, &model.UpdatePreferencesRequest{
+		Theme:             "dark",
+		ChatWallpaper:     &wallpaper,
+		AutoDownloadMedia: &off,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "dark", prefs.Theme)
+	assert.Equal(t, "medium", prefs.FontSize)
+	assert.False(t, prefs.AutoDownloadMedia)
+
+	// The cache is refreshed, and turned off settings are stored as such
+	prefs, err = svc.GetPreferences(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "dark", prefs.Theme)
+	assert.Equal(t, wallpaper, prefs.ChatWallpaper)
+	assert.False(t, prefs.AutoDownloadMedia)
+
+	var stored model.UserPreferences
+	require.NoError(t, db.DB.First(&stored, "user_id = ?", userID).Error)
+	assert.False(t, stored.AutoDownloadMedia)
+	assert.True(t, stored.CompressImages)
+
+	var count int64
+	require.NoError(t, db.DB.Model(&model.UserPreferences{}).Where("user_id = ?", userID).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"realtime-api/internal/config"
+	"realtime-api/internal/tracing"
+
+	firebase "firebase.google.com/go/v4"
+	"firebase.google.com/go/v4/messaging"
+	"google.golang.org/api/option"
+)
+
+// ErrDeviceTokenInvalid is returned by SendToDevice when Firebase no longer
+// accepts a device token, usually because the app was uninstalled
+var ErrDeviceTokenInvalid = errors.New("device token is no longer valid")
+
+// fcmRequestTimeout bounds a send, including the retries of the Firebase
+// client
+const fcmRequestTimeout = 10 * time.Second
+
+// PushNotificationService sends push notifications to mobile devices
+type PushNotificationService interface {
+	SendToDevice(ctx context.Context, deviceToken, title, body string, data map[string]interface{}) error
+}
+
+// fcmService sends push notifications with the Firebase Admin SDK, signed in
+// as the service account of the credentials file
+type fcmService struct {
+	client *messaging.Client
+	// dryRun only validates the messages, Firebase delivers none of them
+	dryRun bool
+}
+
+// NewPushNotificationService creates the FCM client for the service account
+// key file of cfg
+func NewPushNotificationService(cfg *config.PushConfig) (PushNotificationService, error) {
+	service, err := newFCMService(context.Background(), nil, option.WithCredentialsFile(cfg.CredentialsFile))
+	if err != nil {
+		return nil, err
+	}
+	service.dryRun = cfg.DryRun
+	return service, nil
+}
+
+// newFCMService creates the messaging client; a nil conf takes the project
+// from the credentials
+func newFCMService(ctx context.Context, conf *firebase.Config, opts ...option.ClientOption) (*fcmService, error) {
+	app, err := firebase.NewApp(ctx, conf, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Firebase: %w", err)
+	}
+	client, err := app.Messaging(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Firebase messaging: %w", err)
+	}
+	return &fcmService{client: client}, nil
+}
+
+// SendToDevice sends a notification to one device. FCM only carries string
+// data, so other values of data are sent JSON encoded.
+func (s *fcmService) SendToDevice(ctx context.Context, deviceToken, title, body string, data map[string]interface{}) (err error) {
+	ctx, span := tracing.Start(ctx, "service.push.SendToDevice")
+	defer func() { tracing.End(span, err) }()
+
+	stringData := make(map[string]string, len(data))
+	for key, value := range data {
+		if str, ok := value.(string); ok {
+			stringData[key] = str
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode push data %s: %w", key, err)
+		}
+		stringData[key] = string(encoded)
+	}
+
+	message := &messaging.Message{
+		Token:        deviceToken,
+		Notification: &messaging.Notification{Title: title, Body: body},
+		Data:         stringData,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fcmRequestTimeout)
+	defer cancel()
+	if s.dryRun {
+		_, err = s.client.SendDryRun(ctx, message)
+	} else {
+		_, err = s.client.Send(ctx, message)
+	}
+	if messaging.IsUnregistered(err) {
+		return ErrDeviceTokenInvalid
+	}
+	if err != nil {
+		return fmt.Errorf("failed to send push notification: %w", err)
+	}
+	return nil
+}
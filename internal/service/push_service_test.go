@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"realtime-api/internal/model"
+	"realtime-api/internal/repository"
+
+	firebase "firebase.google.com/go/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+func TestFCMSendToDevice(t *testing.T) {
+	var sent []map[string]interface{}
+	var validateOnly []bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/projects/test-project/messages:send", r.URL.Path)
+
+		var body struct {
+			ValidateOnly bool                   `json:"validate_only"`
+			Message      map[string]interface{} `json:"message"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		if body.Message["token"] == "stale-token" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{
+				"status": "NOT_FOUND",
+				"details": []map[string]string{{
+					"@type":     "type.googleapis.com/google.firebase.fcm.v1.FcmError",
+					"errorCode": "UNREGISTERED",
+				}},
+			}})
+			return
+		}
+		sent = append(sent, body.Message)
+		validateOnly = append(validateOnly, body.ValidateOnly)
+		json.NewEncoder(w).Encode(map[string]string{"name": "projects/test-project/messages/1"})
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	svc, err := newFCMService(ctx, &firebase.Config{ProjectID: "test-project"}, option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	require.NoError(t, svc.SendToDevice(ctx, "device-token", "New message", "hello", map[string]interface{}{
+		"type":  "message",
+		"count": 2,
+	}))
+	require.Len(t, sent, 1)
+	assert.Equal(t, "device-token", sent[0]["token"])
+	assert.Equal(t, map[string]interface{}{"title": "New message", "body": "hello"}, sent[0]["notification"])
+	assert.Equal(t, map[string]interface{}{"type": "message", "count": "2"}, sent[0]["data"])
+
+	assert.ErrorIs(t, svc.SendToDevice(ctx, "stale-token", "New message", "hello", nil), ErrDeviceTokenInvalid)
+
+	// Dry runs only ask Firebase to validate the message
+	svc.dryRun = true
+	require.NoError(t, svc.SendToDevice(ctx, "device-token", "New message", "hello", nil))
+	assert.Equal(t, []bool{false, true}, validateOnly)
+}
+
+// testPushService records pushes and rejects the tokens in invalid
+type testPushService struct {
+	invalid map[string]bool
+	sent    chan string
+}
+
+func (p *testPushService) SendToDevice(ctx context.Context, deviceToken, title, body string, data map[string]interface{}) error {
+	if p.invalid[deviceToken] {
+		return ErrDeviceTokenInvalid
+	}
+	p.sent <- deviceToken
+	return nil
+}
+
+func TestPushToOfflineUsers(t *testing.T) {
+	db := newTestDatabase(t, &model.User{}, &model.Room{}, &model.RoomMember{}, &model.Notification{}, &model.UserSession{}, &model.DeviceToken{})
+	redisClient := newTestRedis(t)
+	ctx := context.Background()
+
+	users := createTestUsers(t, db, 3)
+	online, offline, disabled := users[0], users[1], users[2]
+	require.NoError(t, db.DB.Model(&model.User{}).Where("id = ?", disabled).Update("push_notifications", false).Error)
+
+	tokens := map[uuid.UUID][]string{
+		online:   {"online-token"},
+		offline:  {"phone-token", "stale-token", ""},
+		disabled: {"disabled-token"},
+	}
+	for userID, deviceTokens := range tokens {
+		for i, token := range deviceTokens {
+			require.NoError(t, db.DB.Create(&model.UserSession{
+				UserID:       userID,
+				DeviceID:     uuid.NewString(),
+				AccessToken:  uuid.NewString(),
+				RefreshToken: uuid.NewString(),
+				ExpiresAt:    time.Now().Add(time.Hour),
+				FCMToken:     token,
+			}).Error, "session %d", i)
+		}
+	}
+	require.NoError(t, redisClient.SetUserOnline(ctx, online.String()))
+
+	push := &testPushService{invalid: map[string]bool{"stale-token": true, "stale-device": true}, sent: make(chan string, 10)}
+	svc := NewNotificationService(repository.NewNotificationRepository(), repository.NewRoomRepository(), repository.NewSessionRepository(), repository.NewDeviceTokenRepository(), repository.NewUserRepository(), redisClient, push, nil)
+
+	// Registered devices get pushes too, tokens also set on a session only once
+	for _, token := range []string{"tablet-token", "phone-token", "stale-device"} {
+		_, err := svc.RegisterDevice(ctx, offline, &model.RegisterDeviceRequest{Token: token, Platform: model.DevicePlatformAndroid})
+		require.NoError(t, err)
+	}
+
+	for _, userID := range users {
+		_, err := svc.CreateNotification(ctx, userID, NotificationTypeContactRequest, "Contact request", "alice wants to connect", nil)
+		require.NoError(t, err)
+	}
+
+	svc.(*notificationService).pushes.Wait()
+	close(push.sent)
+	var sent []string
+	for token := range push.sent {
+		sent = append(sent, token)
+	}
+	assert.ElementsMatch(t, []string{"phone-token", "tablet-token"}, sent)
+
+	// The rejected tokens are removed
+	var count int64
+	require.NoError(t, db.DB.Model(&model.UserSession{}).Where("fcm_token = ?", "stale-token").Count(&count).Error)
+	assert.Zero(t, count)
+	require.NoError(t, db.DB.Model(&model.DeviceToken{}).Where("token = ?", "stale-device").Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestRegisterDevice(t *testing.T) {
+	db := newTestDatabase(t, &model.User{}, &model.DeviceToken{})
+	ctx := context.Background()
+
+	users := createTestUsers(t, db, 2)
+	svc := NewNotificationService(repository.NewNotificationRepository(), repository.NewRoomRepository(), repository.NewSessionRepository(), repository.NewDeviceTokenRepository(), repository.NewUserRepository(), nil, nil, nil)
+
+	first, err := svc.RegisterDevice(ctx, users[0], &model.RegisterDeviceRequest{Token: "token", Platform: model.DevicePlatformIOS})
+	require.NoError(t, err)
+
+	// Registering the token again, here after another user signed in on the
+	// device, keeps one row
+	second, err := svc.RegisterDevice(ctx, users[1], &model.RegisterDeviceRequest{Token: "token", Platform: model.DevicePlatformIOS})
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, second.ID)
+	assert.Equal(t, users[1], second.UserID)
+
+	assert.ErrorIs(t, svc.UnregisterDevice(ctx, users[0], "token"), ErrNotFound)
+	require.NoError(t, svc.UnregisterDevice(ctx, users[1], "token"))
+	assert.ErrorIs(t, svc.UnregisterDevice(ctx, users[1], "token"), ErrNotFound)
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"realtime-api/internal/model"
+	"realtime-api/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// mockRoomRepository keeps rooms and their members in memory. It implements
+// the methods behind the permission checks of the room and message services;
+// the others are left to the nil embedded interface and panic when called.
+type mockRoomRepository struct {
+	repository.RoomRepository
+	rooms   map[uuid.UUID]*model.Room
+	members map[uuid.UUID]map[uuid.UUID]*model.RoomMember
+	bans    map[uuid.UUID]*model.RoomBan
+	// writes counts the calls that changed a room or its members
+	writes int
+}
+
+func newMockRoomRepository() *mockRoomRepository {
+	return &mockRoomRepository{
+		rooms:   make(map[uuid.UUID]*model.Room),
+		members: make(map[uuid.UUID]map[uuid.UUID]*model.RoomMember),
+		bans:    make(map[uuid.UUID]*model.RoomBan),
+	}
+}
+
+// addRoom stores room with members holding the given roles
+func (r *mockRoomRepository) addRoom(room *model.Room, roles map[uuid.UUID]string) {
+	room.ID = uuid.New()
+	r.rooms[room.ID] = room
+	r.members[room.ID] = make(map[uuid.UUID]*model.RoomMember)
+	for userID, role := range roles {
+		r.members[room.ID][userID] = &model.RoomMember{RoomID: room.ID, UserID: userID, Role: role}
+	}
+	room.MemberCount = int64(len(roles))
+}
+
+func (r *mockRoomRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Room, error) {
+	return r.rooms[id], nil
+}
+
+func (r *mockRoomRepository) Update(ctx context.Context, room *model.Room) error {
+	r.writes++
+	r.rooms[room.ID] = room
+	return nil
+}
+
+func (r *mockRoomRepository) GetTags(ctx context.Context, roomID uuid.UUID) ([]string, error) {
+	return nil, nil
+}
+
+func (r *mockRoomRepository) GetMember(ctx context.Context, roomID, userID uuid.UUID) (*model.RoomMember, error) {
+	return r.members[roomID][userID], nil
+}
+
+func (r *mockRoomRepository) IsUserInRoom(ctx context.Context, roomID, userID uuid.UUID) (bool, error) {
+	_, ok := r.members[roomID][userID]
+	return ok, nil
+}
+
+func (r *mockRoomRepository) AddMember(ctx context.Context, member *model.RoomMember) error {
+	r.writes++
+	r.members[member.RoomID][member.UserID] = member
+	return nil
+}
+
+func (r *mockRoomRepository) RemoveMember(ctx context.Context, roomID, userID uuid.UUID) error {
+	r.writes++
+	delete(r.members[roomID], userID)
+	return nil
+}
+
+func (r *mockRoomRepository) UpdateMemberRole(ctx context.Context, roomID, userID uuid.UUID, role string) error {
+	r.writes++
+	r.members[roomID][userID].Role = role
+	return nil
+}
+
+func (r *mockRoomRepository) CountMembersByRole(ctx context.Context, roomID uuid.UUID) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	for _, member := range r.members[roomID] {
+		counts[member.Role]++
+	}
+	return counts, nil
+}
+
+func (r *mockRoomRepository) SetMemberMuted(ctx context.Context, roomID, userID uuid.UUID, muted bool, until *time.Time) error {
+	r.writes++
+	member := r.members[roomID][userID]
+	member.IsMuted, member.MutedUntil = muted, until
+	return nil
+}
+
+func (r *mockRoomRepository) BanUser(ctx context.Context, ban *model.RoomBan) error {
+	r.writes++
+	ban.ID = uuid.New()
+	r.bans[ban.UserID] = ban
+	delete(r.members[ban.RoomID], ban.UserID)
+	return nil
+}
+
+func (r *mockRoomRepository) GetActiveBan(ctx context.Context, roomID, userID uuid.UUID) (*model.RoomBan, error) {
+	return r.bans[userID], nil
+}
+
+// mockMessageRepository keeps messages in memory, see mockRoomRepository
+type mockMessageRepository struct {
+	repository.MessageRepository
+	messages map[uuid.UUID]*model.Message
+	// writes counts the calls that created or changed a message
+	writes int
+}
+
+func newMockMessageRepository() *mockMessageRepository {
+	return &mockMessageRepository{messages: make(map[uuid.UUID]*model.Message)}
+}
+
+func (r *mockMessageRepository) Create(ctx context.Context, message *model.Message) error {
+	r.writes++
+	message.ID = uuid.New()
+	message.CreatedAt = time.Now()
+	r.messages[message.ID] = message
+	return nil
+}
+
+func (r *mockMessageRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Message, error) {
+	return r.messages[id], nil
+}
+
+func (r *mockMessageRepository) Update(ctx context.Context, message *model.Message) error {
+	r.writes++
+	r.messages[message.ID] = message
+	return nil
+}
+
+func (r *mockMessageRepository) DeleteDraft(ctx context.Context, userID, roomID uuid.UUID) (bool, error) {
+	return false, nil
+}
@@ -2,8 +2,13 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	"realtime-api/internal/events"
@@ -11,6 +16,7 @@ import (
 	"realtime-api/internal/model"
 	"realtime-api/internal/redis"
 	"realtime-api/internal/repository"
+	"realtime-api/internal/tracing"
 
 	"github.com/google/uuid"
 )
@@ -21,22 +27,54 @@ type RoomService interface {
 	UpdateRoom(ctx context.Context, roomID uuid.UUID, req *model.UpdateRoomRequest, userID uuid.UUID) (*model.Room, error)
 	DeleteRoom(ctx context.Context, roomID uuid.UUID, userID uuid.UUID) error
 	GetUserRooms(ctx context.Context, userID uuid.UUID) ([]model.Room, error)
-	ListUserChatRooms(ctx context.Context, userID uuid.UUID, page, limit int) ([]model.Room, *model.PaginationMeta, error)
+	ListUserChatRooms(ctx context.Context, userID uuid.UUID, includeArchived bool, page, limit int) ([]model.Room, *model.PaginationMeta, error)
+	ListArchivedRooms(ctx context.Context, userID uuid.UUID, page, limit int) ([]model.Room, *model.PaginationMeta, error)
+	ArchiveRoom(ctx context.Context, roomID, userID uuid.UUID, mode model.ArchiveRoomMode) error
+	UnarchiveRoom(ctx context.Context, roomID, userID uuid.UUID, mode model.ArchiveRoomMode) error
 	GetPublicRooms(ctx context.Context, page, limit int) ([]model.Room, *model.PaginationMeta, error)
-	SearchRooms(ctx context.Context, query string, page, limit int) ([]model.Room, *model.PaginationMeta, error)
+	SearchRooms(ctx context.Context, query string, tags []string, page, limit int) ([]model.Room, *model.PaginationMeta, error)
+	ListRoomTags(ctx context.Context) ([]model.RoomTagCount, error)
 
 	// Room Member Management
-	JoinRoom(ctx context.Context, roomID, userID uuid.UUID) error
+	JoinRoom(ctx context.Context, roomID, userID uuid.UUID) (*model.RoomJoinRequest, error)
 	LeaveRoom(ctx context.Context, roomID, userID uuid.UUID) error
 	AddMember(ctx context.Context, roomID, userID, inviterID uuid.UUID) error
 	RemoveMember(ctx context.Context, roomID, userID, removerID uuid.UUID) error
-	GetRoomMembers(ctx context.Context, roomID uuid.UUID) ([]model.RoomMember, error)
+	GetRoomMembers(ctx context.Context, roomID, userID uuid.UUID, role, search string, page, limit int) ([]model.RoomMember, *model.PaginationMeta, error)
+	GetMember(ctx context.Context, roomID, userID uuid.UUID) (*model.RoomMember, error)
+	SuggestMembers(ctx context.Context, roomID, userID uuid.UUID, prefix string) ([]model.MemberSuggestion, error)
 	UpdateMemberRole(ctx context.Context, roomID, userID, updaterID uuid.UUID, role string) error
+	TransferOwnership(ctx context.Context, roomID, currentOwnerID, newOwnerID uuid.UUID) error
+	MuteMember(ctx context.Context, roomID, userID, adminID uuid.UUID, req *model.MuteMemberRequest) (*model.RoomMember, error)
+	UpdateNotificationLevel(ctx context.Context, roomID, userID uuid.UUID, level model.NotificationLevel) error
+	CanPost(ctx context.Context, roomID, userID uuid.UUID) error
 
 	// Room Invites
 	CreateInvite(ctx context.Context, roomID, inviterID uuid.UUID, req *model.CreateInviteRequest) (*model.RoomInvite, error)
 	AcceptInvite(ctx context.Context, inviteCode string, userID uuid.UUID) (*model.Room, error)
 	RejectInvite(ctx context.Context, inviteCode string, userID uuid.UUID) error
+	GetRoomInvites(ctx context.Context, roomID, adminID uuid.UUID) ([]model.RoomInvite, error)
+	RevokeInvite(ctx context.Context, roomID, inviteID, adminID uuid.UUID) error
+
+	// Room Join Requests
+	GetJoinRequests(ctx context.Context, roomID, adminID uuid.UUID) ([]model.RoomJoinRequest, error)
+	GetJoinRequest(ctx context.Context, roomID, requestID, adminID uuid.UUID) (*model.RoomJoinRequest, error)
+	ApproveJoinRequest(ctx context.Context, roomID, userID, adminID uuid.UUID) error
+	RejectJoinRequest(ctx context.Context, roomID, userID, adminID uuid.UUID) error
+
+	// Room Bans
+	BanMember(ctx context.Context, roomID, userID, adminID uuid.UUID, req *model.BanMemberRequest) (*model.RoomBan, error)
+	UnbanMember(ctx context.Context, roomID, userID, adminID uuid.UUID) error
+	GetRoomBans(ctx context.Context, roomID, adminID uuid.UUID) ([]model.RoomBan, error)
+
+	// Room Webhooks
+	CreateWebhook(ctx context.Context, roomID, adminID uuid.UUID, req *model.CreateWebhookRequest) (*model.RoomWebhook, error)
+	DeleteWebhook(ctx context.Context, roomID, webhookID, adminID uuid.UUID) error
+	ListWebhooks(ctx context.Context, roomID, adminID uuid.UUID) ([]model.RoomWebhook, error)
+	DeliverWebhooks(ctx context.Context, event *events.Event) error
+
+	// Room Stats
+	GetRoomStats(ctx context.Context, roomID, adminID uuid.UUID) (*model.RoomStatsResponse, error)
 
 	// Private Message Management
 	CreateOrGetDirectRoom(ctx context.Context, userID1, userID2 uuid.UUID) (*model.Room, error)
@@ -58,10 +96,17 @@ func NewRoomService(roomRepo repository.RoomRepository, userRepo repository.User
 	}
 }
 
-func (s *roomService) CreateRoom(ctx context.Context, req *model.CreateRoomRequest, creatorID uuid.UUID) (*model.Room, error) {
+func (s *roomService) CreateRoom(ctx context.Context, req *model.CreateRoomRequest, creatorID uuid.UUID) (_ *model.Room, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.CreateRoom", tracing.ID("creator_id", creatorID))
+	defer func() { tracing.End(span, err) }()
+
 	// Validate room type
 	if req.Type != "direct" && req.Type != "group" && req.Type != "public" && req.Type != "broadcast" {
-		return nil, fmt.Errorf("invalid room type")
+		return nil, fmt.Errorf("%w: invalid room type", ErrInvalidArgument)
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create room
@@ -81,7 +126,7 @@ func (s *roomService) CreateRoom(ctx context.Context, req *model.CreateRoomReque
 		MessageRetentionDays: 0,
 		RequireApproval:      req.RequireApproval,
 		MuteAllMembers:       false,
-		OnlyAdminCanPost:     false,
+		OnlyAdminCanPost:     req.Type == "broadcast", // only admins post in broadcast rooms
 	}
 
 	if err := s.roomRepo.Create(ctx, room); err != nil {
@@ -100,6 +145,13 @@ func (s *roomService) CreateRoom(ctx context.Context, req *model.CreateRoomReque
 		return nil, fmt.Errorf("failed to add creator as member: %w", err)
 	}
 
+	if len(tags) > 0 {
+		if err := s.roomRepo.SetTags(ctx, room.ID, tags); err != nil {
+			return nil, err
+		}
+		room.Tags = tags
+	}
+
 	// Cache room membership
 	if err := s.redis.AddUserToRoom(ctx, room.ID.String(), creatorID.String()); err != nil {
 		logger.Warn("Failed to cache room membership", logger.WithField("error", err.Error()))
@@ -125,13 +177,16 @@ func (s *roomService) CreateRoom(ctx context.Context, req *model.CreateRoomReque
 	return room, nil
 }
 
-func (s *roomService) GetRoomByID(ctx context.Context, roomID uuid.UUID, userID uuid.UUID) (*model.Room, error) {
+func (s *roomService) GetRoomByID(ctx context.Context, roomID uuid.UUID, userID uuid.UUID) (_ *model.Room, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.GetRoomByID", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
 	room, err := s.roomRepo.GetByID(ctx, roomID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get room: %w", err)
 	}
 	if room == nil {
-		return nil, fmt.Errorf("room not found")
+		return nil, ErrRoomNotFound
 	}
 
 	// Check if user has access to the room
@@ -141,46 +196,79 @@ func (s *roomService) GetRoomByID(ctx context.Context, roomID uuid.UUID, userID
 			return nil, fmt.Errorf("failed to check room membership: %w", err)
 		}
 		if !isMember {
-			return nil, fmt.Errorf("access denied: user is not a member of this room")
+			return nil, fmt.Errorf("%w: user is not a member of this room", ErrForbidden)
 		}
 	}
 
+	if room.Tags, err = s.roomRepo.GetTags(ctx, roomID); err != nil {
+		return nil, err
+	}
 	return room, nil
 }
 
-func (s *roomService) UpdateRoom(ctx context.Context, roomID uuid.UUID, req *model.UpdateRoomRequest, userID uuid.UUID) (*model.Room, error) {
+// maxMessageRetentionDays caps the message retention of a room at ten years
+const maxMessageRetentionDays = 3650
+
+const (
+	// maxRoomTags is how many tags a room can be listed under
+	maxRoomTags = 10
+	// maxRoomTagLength caps the length of a single tag
+	maxRoomTagLength = 50
+)
+
+// normalizeTags lowercases tags and drops the leading '#', blanks and
+// duplicates, so "#Go" and "go" list a room under the same tag
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxRoomTagLength {
+			return nil, fmt.Errorf("%w: tags can be at most %d characters", ErrInvalidArgument, maxRoomTagLength)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxRoomTags {
+		return nil, fmt.Errorf("%w: a room can have at most %d tags", ErrInvalidArgument, maxRoomTags)
+	}
+	return normalized, nil
+}
+
+func (s *roomService) UpdateRoom(ctx context.Context, roomID uuid.UUID, req *model.UpdateRoomRequest, userID uuid.UUID) (_ *model.Room, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.UpdateRoom", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
 	room, err := s.roomRepo.GetByID(ctx, roomID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get room: %w", err)
 	}
 	if room == nil {
-		return nil, fmt.Errorf("room not found")
+		return nil, ErrRoomNotFound
 	}
 
-	// Check if user is admin
-	members, err := s.roomRepo.GetRoomMembers(ctx, roomID)
+	// Only owners and admins change the room or its settings
+	member, err := s.getMember(ctx, roomID, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get room members: %w", err)
-	}
-
-	isAdmin := false
-	for _, member := range members {
-		if member.UserID == userID && (member.Role == "admin" || member.Role == "owner") {
-			isAdmin = true
-			break
-		}
+		return nil, err
 	}
-
-	if !isAdmin {
-		return nil, fmt.Errorf("access denied: only admins can update room")
+	if !isAdminOrOwner(member) {
+		return nil, fmt.Errorf("%w: only admins can update room", ErrForbidden)
 	}
 
 	// Update room fields
-	if req.Name != "" {
-		room.Name = req.Name
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return nil, fmt.Errorf("%w: room name can't be empty", ErrInvalidArgument)
+		}
+		room.Name = name
 	}
-	if req.Description != "" {
-		room.Description = req.Description
+	if req.Description != nil {
+		room.Description = *req.Description
 	}
 	if req.Avatar != "" {
 		room.Avatar = req.Avatar
@@ -189,16 +277,81 @@ func (s *roomService) UpdateRoom(ctx context.Context, roomID uuid.UUID, req *mod
 		room.IsPublic = *req.IsPublic
 	}
 	if req.MaxMembers > 0 {
+		if int64(req.MaxMembers) < room.MemberCount {
+			return nil, fmt.Errorf("%w: max_members cannot be below the current member count of %d", ErrInvalidArgument, room.MemberCount)
+		}
 		room.MaxMembers = req.MaxMembers
 	}
+	slowModeChanged := req.SlowModeSeconds != nil && *req.SlowModeSeconds != room.SlowModeSeconds
+	if slowModeChanged {
+		room.SlowModeSeconds = *req.SlowModeSeconds
+	}
+	if req.AllowFileUpload != nil {
+		room.AllowFileUpload = *req.AllowFileUpload
+	}
+	if req.AllowVoiceMessages != nil {
+		room.AllowVoiceMessages = *req.AllowVoiceMessages
+	}
+	if req.AllowVideoMessages != nil {
+		room.AllowVideoMessages = *req.AllowVideoMessages
+	}
+	if req.MessageRetentionDays != nil {
+		if days := *req.MessageRetentionDays; days < 0 || days > maxMessageRetentionDays {
+			return nil, fmt.Errorf("%w: message_retention_days must be between 0 and %d", ErrInvalidArgument, maxMessageRetentionDays)
+		}
+		room.MessageRetentionDays = *req.MessageRetentionDays
+	}
+	if req.RequireApproval != nil {
+		room.RequireApproval = *req.RequireApproval
+	}
+	if req.MuteAllMembers != nil {
+		room.MuteAllMembers = *req.MuteAllMembers
+	}
+	if req.OnlyAdminCanPost != nil {
+		if room.Type == "broadcast" && !*req.OnlyAdminCanPost {
+			return nil, fmt.Errorf("%w: only admins can post in broadcast rooms", ErrInvalidArgument)
+		}
+		room.OnlyAdminCanPost = *req.OnlyAdminCanPost
+	}
+
+	var tags []string
+	if req.Tags != nil {
+		if tags, err = normalizeTags(req.Tags); err != nil {
+			return nil, err
+		}
+	}
 
 	if err := s.roomRepo.Update(ctx, room); err != nil {
 		return nil, fmt.Errorf("failed to update room: %w", err)
 	}
+	if req.Tags != nil {
+		if err := s.roomRepo.SetTags(ctx, room.ID, tags); err != nil {
+			return nil, err
+		}
+		room.Tags = tags
+	} else if room.Tags, err = s.roomRepo.GetTags(ctx, room.ID); err != nil {
+		return nil, err
+	}
+
+	if slowModeChanged {
+		settingsData := events.RoomEventData(room.ID, &userID, map[string]interface{}{
+			"slow_mode_seconds": room.SlowModeSeconds,
+		})
+		if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomSettingsUpdate, room.ID, settingsData, &userID); err != nil {
+			logger.Warn("Failed to publish room settings event", logger.WithField("error", err.Error()))
+		}
+	}
 
-	// Publish room update event
+	// Publish room update event, with the settings clients adjust their
+	// composer to
 	eventData := events.RoomEventData(room.ID, &userID, map[string]interface{}{
-		"room_name": room.Name,
+		"room_name":            room.Name,
+		"allow_file_upload":    room.AllowFileUpload,
+		"allow_voice_messages": room.AllowVoiceMessages,
+		"allow_video_messages": room.AllowVideoMessages,
+		"require_approval":     room.RequireApproval,
+		"mute_all_members":     room.MuteAllMembers,
+		"only_admin_can_post":  room.OnlyAdminCanPost,
 	})
 
 	if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomUpdate, room.ID, eventData, &userID); err != nil {
@@ -213,18 +366,25 @@ func (s *roomService) UpdateRoom(ctx context.Context, roomID uuid.UUID, req *mod
 	return room, nil
 }
 
-func (s *roomService) DeleteRoom(ctx context.Context, roomID uuid.UUID, userID uuid.UUID) error {
+func (s *roomService) DeleteRoom(ctx context.Context, roomID uuid.UUID, userID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.room.DeleteRoom", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
 	room, err := s.roomRepo.GetByID(ctx, roomID)
 	if err != nil {
 		return fmt.Errorf("failed to get room: %w", err)
 	}
 	if room == nil {
-		return fmt.Errorf("room not found")
+		return ErrRoomNotFound
 	}
 
-	// Only room creator can delete
-	if room.CreatedBy != userID {
-		return fmt.Errorf("access denied: only room creator can delete room")
+	// Only the owner deletes the room
+	member, err := s.getMember(ctx, roomID, userID)
+	if err != nil {
+		return err
+	}
+	if !member.HasRole(model.RoomRoleOwner) {
+		return fmt.Errorf("%w: only the room owner can delete the room", ErrForbidden)
 	}
 
 	if err := s.roomRepo.Delete(ctx, roomID); err != nil {
@@ -248,16 +408,40 @@ func (s *roomService) DeleteRoom(ctx context.Context, roomID uuid.UUID, userID u
 	return nil
 }
 
-func (s *roomService) GetUserRooms(ctx context.Context, userID uuid.UUID) ([]model.Room, error) {
-	rooms, err := s.roomRepo.GetUserRooms(ctx, userID)
+func (s *roomService) GetUserRooms(ctx context.Context, userID uuid.UUID) (_ []model.Room, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.GetUserRooms", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	rooms, err := s.roomRepo.GetUserRooms(ctx, userID, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user rooms: %w", err)
 	}
 	return rooms, nil
 }
 
-// ListUserChatRooms returns paginated list of user's chat rooms with additional metadata
-func (s *roomService) ListUserChatRooms(ctx context.Context, userID uuid.UUID, page, limit int) ([]model.Room, *model.PaginationMeta, error) {
+// ListUserChatRooms returns paginated list of user's chat rooms with additional metadata.
+// Rooms the user archived are left out unless includeArchived is set.
+func (s *roomService) ListUserChatRooms(ctx context.Context, userID uuid.UUID, includeArchived bool, page, limit int) (_ []model.Room, _ *model.PaginationMeta, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.ListUserChatRooms", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	var archived *bool
+	if !includeArchived {
+		archived = new(bool)
+	}
+	return s.listChatRooms(ctx, userID, archived, page, limit)
+}
+
+// ListArchivedRooms returns paginated list of the rooms the user archived
+func (s *roomService) ListArchivedRooms(ctx context.Context, userID uuid.UUID, page, limit int) (_ []model.Room, _ *model.PaginationMeta, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.ListArchivedRooms", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	archived := true
+	return s.listChatRooms(ctx, userID, &archived, page, limit)
+}
+
+func (s *roomService) listChatRooms(ctx context.Context, userID uuid.UUID, archived *bool, page, limit int) ([]model.Room, *model.PaginationMeta, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -269,7 +453,7 @@ func (s *roomService) ListUserChatRooms(ctx context.Context, userID uuid.UUID, p
 	}
 
 	// Get all user's rooms first
-	allRooms, err := s.roomRepo.GetUserRooms(ctx, userID)
+	allRooms, err := s.roomRepo.GetUserRooms(ctx, userID, archived)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get user chat rooms: %w", err)
 	}
@@ -287,63 +471,105 @@ func (s *roomService) ListUserChatRooms(ctx context.Context, userID uuid.UUID, p
 	if offset < total {
 		rooms = allRooms[offset:end]
 	}
+	for i := range rooms {
+		if rooms[i].CreatedBy != userID && rooms[i].CreatedByUser.ID != uuid.Nil {
+			rooms[i].CreatedByUser.Status = rooms[i].CreatedByUser.VisibleStatus()
+		}
+	}
+
+	// Direct rooms are shown under the other member
+	if err := s.setDirectRoomDisplay(ctx, userID, rooms); err != nil {
+		logger.Warn("Failed to get the members of direct rooms", logger.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}))
+	}
+
+	return rooms, newPaginationMeta(page, limit, int64(total)), nil
+}
 
-	// Enrich rooms with additional metadata for chat list display
+// setDirectRoomDisplay names the direct rooms among rooms after the member
+// other than userID and borrows their avatar. The members come from the
+// Redis membership cache in one round trip; rooms missing from the cache are
+// read from the database and cached.
+func (s *roomService) setDirectRoomDisplay(ctx context.Context, userID uuid.UUID, rooms []model.Room) error {
+	var roomIDs []string
 	for i := range rooms {
-		// For direct rooms (2 members), get the other user's info for display
 		if rooms[i].Type == "direct" {
+			roomIDs = append(roomIDs, rooms[i].ID.String())
+		}
+	}
+	if len(roomIDs) == 0 {
+		return nil
+	}
+
+	cached, err := s.redis.GetRoomsMembers(ctx, roomIDs)
+	if err != nil {
+		logger.Warn("Failed to get cached room members", logger.WithField("error", err.Error()))
+		cached = nil
+	}
+
+	otherIDs := make(map[uuid.UUID]uuid.UUID, len(roomIDs))
+	var userIDs []uuid.UUID
+	for i := range rooms {
+		if rooms[i].Type != "direct" {
+			continue
+		}
+
+		memberIDs := cached[rooms[i].ID.String()]
+		if len(memberIDs) < 2 {
 			members, err := s.roomRepo.GetRoomMembers(ctx, rooms[i].ID)
 			if err != nil {
-				logger.Warn("Failed to get room members for direct room", logger.WithFields(map[string]interface{}{
-					"room_id": rooms[i].ID,
-					"error":   err.Error(),
-				}))
-				continue
+				return err
 			}
-
-			// Find the other user in direct room
-			for _, member := range members {
-				if member.UserID != userID {
-					otherUser, err := s.userRepo.GetByID(ctx, member.UserID)
-					if err == nil && otherUser != nil {
-						// Set room name to other user's name for display
-						if rooms[i].Name == "" {
-							rooms[i].Name = otherUser.Username
-						}
-						// Set avatar to other user's avatar if room doesn't have one
-						if rooms[i].Avatar == "" && otherUser.Avatar != "" {
-							rooms[i].Avatar = otherUser.Avatar
-						}
-					}
-					break
-				}
+			memberIDs = make([]string, len(members))
+			for j, member := range members {
+				memberIDs[j] = member.UserID.String()
+			}
+			if err := s.redis.AddUsersToRoom(ctx, rooms[i].ID.String(), memberIDs); err != nil {
+				logger.Warn("Failed to cache room membership", logger.WithField("error", err.Error()))
 			}
 		}
 
-		// Log member count for debugging
-		members, err := s.roomRepo.GetRoomMembers(ctx, rooms[i].ID)
-		if err == nil {
-			logger.Debug("Room member count", logger.WithFields(map[string]interface{}{
-				"room_id":      rooms[i].ID,
-				"member_count": len(members),
-				"room_type":    rooms[i].Type,
-			}))
+		for _, memberID := range memberIDs {
+			otherID, err := uuid.Parse(memberID)
+			if err != nil || otherID == userID {
+				continue
+			}
+			otherIDs[rooms[i].ID] = otherID
+			userIDs = append(userIDs, otherID)
+			break
 		}
 	}
 
-	totalPages := (total + limit - 1) / limit
-
-	meta := &model.PaginationMeta{
-		Page:       page,
-		Limit:      limit,
-		Total:      total,
-		TotalPages: totalPages,
+	users, err := s.userRepo.GetByIDs(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+	byID := make(map[uuid.UUID]*model.User, len(users))
+	for i := range users {
+		byID[users[i].ID] = &users[i]
 	}
 
-	return rooms, meta, nil
+	for i := range rooms {
+		otherUser := byID[otherIDs[rooms[i].ID]]
+		if otherUser == nil {
+			continue
+		}
+		if rooms[i].Name == "" {
+			rooms[i].Name = otherUser.Username
+		}
+		if rooms[i].Avatar == "" && otherUser.Avatar != "" {
+			rooms[i].Avatar = otherUser.Avatar
+		}
+	}
+	return nil
 }
 
-func (s *roomService) GetPublicRooms(ctx context.Context, page, limit int) ([]model.Room, *model.PaginationMeta, error) {
+func (s *roomService) GetPublicRooms(ctx context.Context, page, limit int) (_ []model.Room, _ *model.PaginationMeta, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.GetPublicRooms")
+	defer func() { tracing.End(span, err) }()
+
 	if page < 1 {
 		page = 1
 	}
@@ -360,19 +586,15 @@ func (s *roomService) GetPublicRooms(ctx context.Context, page, limit int) ([]mo
 		return nil, nil, fmt.Errorf("failed to get public rooms: %w", err)
 	}
 
-	totalPages := (int(total) + limit - 1) / limit
-
-	meta := &model.PaginationMeta{
-		Page:       page,
-		Limit:      limit,
-		Total:      int(total),
-		TotalPages: totalPages,
-	}
-
-	return rooms, meta, nil
+	return rooms, newPaginationMeta(page, limit, total), nil
 }
 
-func (s *roomService) SearchRooms(ctx context.Context, query string, page, limit int) ([]model.Room, *model.PaginationMeta, error) {
+// SearchRooms returns the public rooms matching query, limited to the rooms
+// with one of tags when any are given
+func (s *roomService) SearchRooms(ctx context.Context, query string, tags []string, page, limit int) (_ []model.Room, _ *model.PaginationMeta, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.SearchRooms")
+	defer func() { tracing.End(span, err) }()
+
 	if page < 1 {
 		page = 1
 	}
@@ -383,45 +605,59 @@ func (s *roomService) SearchRooms(ctx context.Context, query string, page, limit
 		limit = 100
 	}
 
+	tags, err = normalizeTags(tags)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	offset := (page - 1) * limit
-	rooms, total, err := s.roomRepo.SearchRooms(ctx, query, offset, limit)
+	rooms, total, err := s.roomRepo.SearchRooms(ctx, strings.TrimSpace(query), tags, offset, limit)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to search rooms: %w", err)
 	}
 
-	totalPages := (int(total) + limit - 1) / limit
+	return rooms, newPaginationMeta(page, limit, total), nil
+}
 
-	meta := &model.PaginationMeta{
-		Page:       page,
-		Limit:      limit,
-		Total:      int(total),
-		TotalPages: totalPages,
-	}
+// ListRoomTags returns the tags public rooms are listed under, with the
+// number of rooms for each
+func (s *roomService) ListRoomTags(ctx context.Context) (_ []model.RoomTagCount, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.ListRoomTags")
+	defer func() { tracing.End(span, err) }()
 
-	return rooms, meta, nil
+	return s.roomRepo.ListTags(ctx)
 }
 
-func (s *roomService) JoinRoom(ctx context.Context, roomID, userID uuid.UUID) error {
+// JoinRoom adds the user to the room. Rooms that require approval get a
+// pending join request instead, which is returned; it is nil when the user
+// joined right away.
+func (s *roomService) JoinRoom(ctx context.Context, roomID, userID uuid.UUID) (_ *model.RoomJoinRequest, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.JoinRoom", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
 	room, err := s.roomRepo.GetByID(ctx, roomID)
 	if err != nil {
-		return fmt.Errorf("failed to get room: %w", err)
+		return nil, fmt.Errorf("failed to get room: %w", err)
 	}
 	if room == nil {
-		return fmt.Errorf("room not found")
-	}
-
-	// Check if room is public or requires approval
-	if !room.IsPublic && room.RequireApproval {
-		return fmt.Errorf("room requires approval to join")
+		return nil, ErrRoomNotFound
 	}
 
 	// Check if user is already a member
 	isMember, err := s.roomRepo.IsUserInRoom(ctx, roomID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to check room membership: %w", err)
+		return nil, fmt.Errorf("failed to check room membership: %w", err)
 	}
 	if isMember {
-		return fmt.Errorf("user is already a member of this room")
+		return nil, fmt.Errorf("%w: user is already a member of this room", ErrInvalidArgument)
+	}
+
+	if err := s.checkNotBanned(ctx, roomID, userID); err != nil {
+		return nil, err
+	}
+
+	if room.RequireApproval {
+		return s.requestToJoin(ctx, roomID, userID)
 	}
 
 	// Add user as member
@@ -433,159 +669,542 @@ func (s *roomService) JoinRoom(ctx context.Context, roomID, userID uuid.UUID) er
 	}
 
 	if err := s.roomRepo.AddMember(ctx, member); err != nil {
-		return fmt.Errorf("failed to add member: %w", err)
+		return nil, addMemberError(err)
+	}
+
+	s.memberJoined(ctx, room, userID, map[string]interface{}{})
+	return nil, nil
+}
+
+// requestToJoin records a pending join request, reopening an earlier one
+func (s *roomService) requestToJoin(ctx context.Context, roomID, userID uuid.UUID) (*model.RoomJoinRequest, error) {
+	existing, err := s.roomRepo.GetJoinRequest(ctx, roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.Status == model.JoinRequestPending {
+		return existing, nil
+	}
+
+	if err := s.roomRepo.SaveJoinRequest(ctx, &model.RoomJoinRequest{
+		RoomID:      roomID,
+		UserID:      userID,
+		Status:      model.JoinRequestPending,
+		RequestedAt: time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+
+	// Reload so a reopened request keeps its original ID
+	request, err := s.roomRepo.GetJoinRequest(ctx, roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Room join requested", logger.WithFields(map[string]interface{}{
+		"room_id": roomID,
+		"user_id": userID,
+	}))
+
+	return request, nil
+}
+
+// addMemberError maps a failure to add a member to the service errors
+func addMemberError(err error) error {
+	if errors.Is(err, repository.ErrRoomFull) {
+		return ErrRoomFull
 	}
+	return fmt.Errorf("failed to add member: %w", err)
+}
 
+// memberJoined caches the new membership and announces the join
+func (s *roomService) memberJoined(ctx context.Context, room *model.Room, userID uuid.UUID, data map[string]interface{}) {
 	// Cache room membership
-	if err := s.redis.AddUserToRoom(ctx, roomID.String(), userID.String()); err != nil {
+	if err := s.redis.AddUserToRoom(ctx, room.ID.String(), userID.String()); err != nil {
 		logger.Warn("Failed to cache room membership", logger.WithField("error", err.Error()))
 	}
 
 	// Publish user join event
-	eventData := events.RoomEventData(roomID, &userID, map[string]interface{}{
-		"room_name": room.Name,
-	})
+	data["room_name"] = room.Name
+	eventData := events.RoomEventData(room.ID, &userID, data)
 
-	if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomJoin, roomID, eventData, &userID); err != nil {
+	if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomJoin, room.ID, eventData, &userID); err != nil {
 		logger.Warn("Failed to publish user join event", logger.WithField("error", err.Error()))
 	}
 
+	recordActivity(&model.ActivityLog{
+		UserID:       &userID,
+		ActivityType: ActivityRoomJoin,
+		Description:  "Joined a room",
+	}, map[string]interface{}{"room_id": room.ID, "room_name": room.Name})
+
 	logger.Info("User joined room successfully", logger.WithFields(map[string]interface{}{
-		"room_id": roomID,
+		"room_id": room.ID,
 		"user_id": userID,
 	}))
+}
 
-	return nil
+// GetJoinRequests lists the pending join requests of a room for its admins
+func (s *roomService) GetJoinRequests(ctx context.Context, roomID, adminID uuid.UUID) (_ []model.RoomJoinRequest, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.GetJoinRequests", tracing.ID("room_id", roomID), tracing.ID("admin_id", adminID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkRoomAdmin(ctx, roomID, adminID); err != nil {
+		return nil, err
+	}
+	return s.roomRepo.GetPendingJoinRequests(ctx, roomID)
 }
 
-func (s *roomService) LeaveRoom(ctx context.Context, roomID, userID uuid.UUID) error {
-	// Check if user is a member
-	isMember, err := s.roomRepo.IsUserInRoom(ctx, roomID, userID)
+// ApproveJoinRequest adds the requesting user to the room
+func (s *roomService) ApproveJoinRequest(ctx context.Context, roomID, userID, adminID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.room.ApproveJoinRequest", tracing.ID("room_id", roomID), tracing.ID("user_id", userID), tracing.ID("admin_id", adminID))
+	defer func() { tracing.End(span, err) }()
+
+	room, request, err := s.getPendingJoinRequest(ctx, roomID, userID, adminID)
 	if err != nil {
-		return fmt.Errorf("failed to check room membership: %w", err)
+		return err
 	}
-	if !isMember {
-		return fmt.Errorf("user is not a member of this room")
+	if err := s.checkNotBanned(ctx, roomID, userID); err != nil {
+		return err
 	}
 
-	if err := s.roomRepo.RemoveMember(ctx, roomID, userID); err != nil {
-		return fmt.Errorf("failed to remove member: %w", err)
+	member := &model.RoomMember{
+		RoomID:   roomID,
+		UserID:   userID,
+		Role:     "member",
+		JoinedAt: time.Now(),
 	}
-
-	// Remove from cache
-	if err := s.redis.RemoveUserFromRoom(ctx, roomID.String(), userID.String()); err != nil {
-		logger.Warn("Failed to remove user from room cache", logger.WithField("error", err.Error()))
+	approved, err := s.roomRepo.ApproveJoinRequest(ctx, request, adminID, member)
+	if err != nil {
+		return addMemberError(err)
 	}
-
-	// Publish user leave event
-	eventData := events.RoomEventData(roomID, &userID, map[string]interface{}{})
-
-	if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomLeave, roomID, eventData, &userID); err != nil {
-		logger.Warn("Failed to publish user leave event", logger.WithField("error", err.Error()))
+	if !approved {
+		return fmt.Errorf("%w: join request was already answered", ErrInvalidArgument)
 	}
 
-	logger.Info("User left room successfully", logger.WithFields(map[string]interface{}{
-		"room_id": roomID,
-		"user_id": userID,
-	}))
-
+	s.memberJoined(ctx, room, userID, map[string]interface{}{
+		"approved_by": adminID,
+	})
+	s.joinRequestAnswered(ctx, events.RoomJoinRequestApprove, room, request, adminID)
 	return nil
 }
 
-func (s *roomService) AddMember(ctx context.Context, roomID, userID, inviterID uuid.UUID) error {
-	// Check if inviter is admin
-	members, err := s.roomRepo.GetRoomMembers(ctx, roomID)
+// RejectJoinRequest declines the request of a user to join the room
+func (s *roomService) RejectJoinRequest(ctx context.Context, roomID, userID, adminID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.room.RejectJoinRequest", tracing.ID("room_id", roomID), tracing.ID("user_id", userID), tracing.ID("admin_id", adminID))
+	defer func() { tracing.End(span, err) }()
+
+	room, request, err := s.getPendingJoinRequest(ctx, roomID, userID, adminID)
 	if err != nil {
-		return fmt.Errorf("failed to get room members: %w", err)
+		return err
 	}
 
-	isAdmin := false
-	for _, member := range members {
-		if member.UserID == inviterID && (member.Role == "admin" || member.Role == "owner") {
-			isAdmin = true
-			break
-		}
+	rejected, err := s.roomRepo.RejectJoinRequest(ctx, request, adminID)
+	if err != nil {
+		return err
+	}
+	if !rejected {
+		return fmt.Errorf("%w: join request was already answered", ErrInvalidArgument)
 	}
+	s.joinRequestAnswered(ctx, events.RoomJoinRequestReject, room, request, adminID)
+
+	logger.Info("Room join request rejected", logger.WithFields(map[string]interface{}{
+		"room_id":     roomID,
+		"user_id":     userID,
+		"rejected_by": adminID,
+	}))
+	return nil
+}
 
-	if !isAdmin {
-		return fmt.Errorf("access denied: only admins can add members")
+// GetJoinRequest returns a join request of the room for its admins
+func (s *roomService) GetJoinRequest(ctx context.Context, roomID, requestID, adminID uuid.UUID) (_ *model.RoomJoinRequest, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.GetJoinRequest", tracing.ID("room_id", roomID), tracing.ID("request_id", requestID), tracing.ID("admin_id", adminID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkRoomAdmin(ctx, roomID, adminID); err != nil {
+		return nil, err
 	}
 
-	// Check if user is already a member
-	isMember, err := s.roomRepo.IsUserInRoom(ctx, roomID, userID)
+	request, err := s.roomRepo.GetJoinRequestByID(ctx, requestID)
 	if err != nil {
-		return fmt.Errorf("failed to check room membership: %w", err)
+		return nil, err
 	}
-	if isMember {
-		return fmt.Errorf("user is already a member of this room")
+	if request == nil || request.RoomID != roomID {
+		return nil, fmt.Errorf("%w: join request not found", ErrNotFound)
 	}
+	return request, nil
+}
 
-	// Add user as member
-	member := &model.RoomMember{
-		RoomID:    roomID,
-		UserID:    userID,
-		Role:      "member",
-		JoinedAt:  time.Now(),
-		InvitedBy: &inviterID,
+// joinRequestAnswered lets the requester know their join request was
+// approved or rejected
+func (s *roomService) joinRequestAnswered(ctx context.Context, eventType string, room *model.Room, request *model.RoomJoinRequest, adminID uuid.UUID) {
+	eventData := events.RoomEventData(room.ID, &request.UserID, map[string]interface{}{
+		"request_id":   request.ID,
+		"room_name":    room.Name,
+		"responded_by": adminID,
+	})
+	if err := s.eventPublisher.PublishRoomEvent(ctx, eventType, room.ID, eventData, &adminID); err != nil {
+		logger.Warn("Failed to publish join request event", logger.WithField("error", err.Error()))
 	}
+}
 
-	if err := s.roomRepo.AddMember(ctx, member); err != nil {
-		return fmt.Errorf("failed to add member: %w", err)
+// getPendingJoinRequest loads the room and the user's pending request after
+// checking that adminID may answer it
+func (s *roomService) getPendingJoinRequest(ctx context.Context, roomID, userID, adminID uuid.UUID) (*model.Room, *model.RoomJoinRequest, error) {
+	if err := s.checkRoomAdmin(ctx, roomID, adminID); err != nil {
+		return nil, nil, err
 	}
 
-	// Cache room membership
-	if err := s.redis.AddUserToRoom(ctx, roomID.String(), userID.String()); err != nil {
-		logger.Warn("Failed to cache room membership", logger.WithField("error", err.Error()))
+	room, err := s.roomRepo.GetByID(ctx, roomID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get room: %w", err)
+	}
+	if room == nil {
+		return nil, nil, ErrRoomNotFound
 	}
 
-	// Publish member add event
-	eventData := events.RoomEventData(roomID, &userID, map[string]interface{}{
-		"inviter_id": inviterID,
-	})
-
-	if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomMemberAdd, roomID, eventData, &inviterID); err != nil {
-		logger.Warn("Failed to publish member add event", logger.WithField("error", err.Error()))
+	request, err := s.roomRepo.GetJoinRequest(ctx, roomID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if request == nil || request.Status != model.JoinRequestPending {
+		return nil, nil, fmt.Errorf("%w: no pending join request for this user", ErrNotFound)
 	}
+	return room, request, nil
+}
 
+// checkRoomAdmin allows room owners and admins
+func (s *roomService) checkRoomAdmin(ctx context.Context, roomID, userID uuid.UUID) error {
+	member, err := s.roomRepo.GetMember(ctx, roomID, userID)
+	if err != nil {
+		return err
+	}
+	if !isAdminOrOwner(member) {
+		return fmt.Errorf("%w: only admins can manage this room", ErrForbidden)
+	}
 	return nil
 }
 
-func (s *roomService) RemoveMember(ctx context.Context, roomID, userID, removerID uuid.UUID) error {
-	// Get room to check type and properties
+// checkNotBanned rejects users with an active ban from the room
+func (s *roomService) checkNotBanned(ctx context.Context, roomID, userID uuid.UUID) error {
+	ban, err := s.roomRepo.GetActiveBan(ctx, roomID, userID)
+	if err != nil {
+		return err
+	}
+	if ban == nil {
+		return nil
+	}
+	if ban.ExpiresAt != nil {
+		return fmt.Errorf("%w: you are banned from this room until %s", ErrForbidden, ban.ExpiresAt.Format(time.RFC3339))
+	}
+	return fmt.Errorf("%w: you are banned from this room", ErrForbidden)
+}
+
+// CanPost reports, as an ErrForbidden error, why a user can't post or type
+// in a room
+func (s *roomService) CanPost(ctx context.Context, roomID, userID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.room.CanPost", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
 	room, err := s.roomRepo.GetByID(ctx, roomID)
 	if err != nil {
 		return fmt.Errorf("failed to get room: %w", err)
 	}
 	if room == nil {
-		return errors.New("room not found")
+		return ErrRoomNotFound
 	}
+	return canPost(ctx, s.roomRepo, room, userID)
+}
 
-	// Check if remover is admin
-	members, err := s.roomRepo.GetRoomMembers(ctx, roomID)
+// canPost checks the posting settings of a room and the mute state of the
+// member. Owners and admins can always post unless the room is archived.
+func canPost(ctx context.Context, roomRepo repository.RoomRepository, room *model.Room, userID uuid.UUID) error {
+	if room.IsArchived {
+		return ErrRoomArchived
+	}
+
+	member, err := roomRepo.GetMember(ctx, room.ID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to get room members: %w", err)
+		return err
+	}
+
+	switch {
+	case member == nil:
+		return fmt.Errorf("%w: user is not a member of this room", ErrForbidden)
+	case isAdminOrOwner(member):
+		return nil
+	case room.OnlyAdminCanPost:
+		return fmt.Errorf("%w: only admins can post in this room", ErrForbidden)
+	case room.MuteAllMembers:
+		return fmt.Errorf("%w: all members are muted in this room", ErrForbidden)
+	case member.IsMuted && member.MutedUntil == nil:
+		return fmt.Errorf("%w: you are muted in this room", ErrForbidden)
+	case member.IsMuted && member.MutedUntil.After(time.Now()):
+		return fmt.Errorf("%w: you are muted in this room until %s", ErrForbidden, member.MutedUntil.UTC().Format(time.RFC3339))
 	}
+	return nil
+}
 
-	// Business rule: Cannot remove members from private rooms (2 members only)
-	// Private messages (direct rooms with 2 members) should not allow member removal
-	if len(members) == 2 && (room.Type == "direct" || room.Type == "private") {
-		return errors.New("cannot remove members from private messages with only 2 participants")
+// LeaveRoom removes the user from the room. An owner leaving hands the room
+// over to the longest-standing admin; the last admin has to promote someone
+// before leaving a room that still has members.
+func (s *roomService) LeaveRoom(ctx context.Context, roomID, userID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.room.LeaveRoom", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	members, err := s.roomRepo.GetRoomMembers(ctx, roomID)
+	if err != nil {
+		return fmt.Errorf("failed to get room members: %w", err)
 	}
 
-	isAdmin := false
-	for _, member := range members {
-		if member.UserID == removerID && (member.Role == "admin" || member.Role == "owner") {
-			isAdmin = true
-			break
+	var leaving *model.RoomMember
+	var successor *model.RoomMember
+	hasOwner := false
+	for i, member := range members {
+		if member.UserID == userID {
+			leaving = &members[i]
+			continue
+		}
+		switch member.Role {
+		case "owner":
+			hasOwner = true
+		case "admin":
+			if successor == nil || member.JoinedAt.Before(successor.JoinedAt) {
+				successor = &members[i]
+			}
 		}
 	}
 
-	if !isAdmin {
-		return fmt.Errorf("access denied: only admins can remove members")
+	// Check if user is a member
+	if leaving == nil {
+		return fmt.Errorf("%w: user is not a member of this room", ErrNotFound)
 	}
 
-	if err := s.roomRepo.RemoveMember(ctx, roomID, userID); err != nil {
-		return fmt.Errorf("failed to remove member: %w", err)
+	// Keep someone in charge of a room that still has members
+	promote := leaving.Role == "owner" && !hasOwner && successor != nil
+	if isAdminOrOwner(leaving) {
+		if len(members) > 1 && !hasOwner && successor == nil {
+			return fmt.Errorf("%w: transfer ownership or promote an admin before leaving the room", ErrInvalidArgument)
+		}
+	}
+
+	if promote {
+		if err := s.roomRepo.UpdateMemberRole(ctx, roomID, successor.UserID, "owner"); err != nil {
+			return fmt.Errorf("failed to promote new owner: %w", err)
+		}
+
+		eventData := events.RoomEventData(roomID, &successor.UserID, map[string]interface{}{
+			"role":       "owner",
+			"old_role":   successor.Role,
+			"updater_id": userID,
+		})
+		if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomMemberRoleUpdate, roomID, eventData, &userID); err != nil {
+			logger.Warn("Failed to publish member role update event", logger.WithField("error", err.Error()))
+		}
+	}
+
+	if err := s.roomRepo.RemoveMember(ctx, roomID, userID); err != nil {
+		return fmt.Errorf("failed to remove member: %w", err)
+	}
+
+	// Remove from cache
+	if err := s.redis.RemoveUserFromRoom(ctx, roomID.String(), userID.String()); err != nil {
+		logger.Warn("Failed to remove user from room cache", logger.WithField("error", err.Error()))
+	}
+
+	// Publish user leave event
+	eventData := events.RoomEventData(roomID, &userID, map[string]interface{}{})
+
+	if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomLeave, roomID, eventData, &userID); err != nil {
+		logger.Warn("Failed to publish user leave event", logger.WithField("error", err.Error()))
+	}
+
+	recordActivity(&model.ActivityLog{
+		UserID:       &userID,
+		ActivityType: ActivityRoomLeave,
+		Description:  "Left a room",
+	}, map[string]interface{}{"room_id": roomID})
+
+	logger.Info("User left room successfully", logger.WithFields(map[string]interface{}{
+		"room_id": roomID,
+		"user_id": userID,
+	}))
+
+	return nil
+}
+
+// ArchiveRoom hides the room from the user's chat list without leaving it.
+// Archiving for everyone also makes the room read-only.
+func (s *roomService) ArchiveRoom(ctx context.Context, roomID, userID uuid.UUID, mode model.ArchiveRoomMode) (err error) {
+	ctx, span := tracing.Start(ctx, "service.room.ArchiveRoom", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	return s.setRoomArchived(ctx, roomID, userID, mode, true)
+}
+
+// UnarchiveRoom moves the room back to the user's chat list
+func (s *roomService) UnarchiveRoom(ctx context.Context, roomID, userID uuid.UUID, mode model.ArchiveRoomMode) (err error) {
+	ctx, span := tracing.Start(ctx, "service.room.UnarchiveRoom", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	return s.setRoomArchived(ctx, roomID, userID, mode, false)
+}
+
+func (s *roomService) setRoomArchived(ctx context.Context, roomID, userID uuid.UUID, mode model.ArchiveRoomMode, archived bool) error {
+	switch mode {
+	case model.ArchiveForMe:
+		return s.setMemberArchived(ctx, roomID, userID, archived)
+	case model.ArchiveForEveryone:
+	default:
+		return fmt.Errorf("%w: unknown archive mode %q", ErrInvalidArgument, mode)
+	}
+
+	room, err := s.roomRepo.GetByID(ctx, roomID)
+	if err != nil {
+		return fmt.Errorf("failed to get room: %w", err)
+	}
+	if room == nil {
+		return ErrRoomNotFound
+	}
+
+	// Only the creator or an owner can archive the room for everyone
+	if room.CreatedBy != userID {
+		member, err := s.roomRepo.GetMember(ctx, roomID, userID)
+		if err != nil {
+			return err
+		}
+		if member == nil || member.Role != "owner" {
+			return fmt.Errorf("%w: only the room creator or owner can archive the room for everyone", ErrForbidden)
+		}
+	}
+
+	if room.IsArchived == archived {
+		return nil
+	}
+	if err := s.roomRepo.SetRoomArchived(ctx, roomID, archived); err != nil {
+		return err
+	}
+
+	eventData := events.RoomEventData(roomID, &userID, map[string]interface{}{
+		"is_archived": archived,
+	})
+	if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomSettingsUpdate, roomID, eventData, &userID); err != nil {
+		logger.Warn("Failed to publish room settings event", logger.WithField("error", err.Error()))
+	}
+
+	logger.Info("Room archive state updated for everyone", logger.WithFields(map[string]interface{}{
+		"room_id":  roomID,
+		"user_id":  userID,
+		"archived": archived,
+	}))
+
+	return nil
+}
+
+func (s *roomService) setMemberArchived(ctx context.Context, roomID, userID uuid.UUID, archived bool) error {
+	isMember, err := s.roomRepo.IsUserInRoom(ctx, roomID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check room membership: %w", err)
+	}
+	if !isMember {
+		return fmt.Errorf("%w: user is not a member of this room", ErrForbidden)
+	}
+
+	if err := s.roomRepo.SetMemberArchived(ctx, roomID, userID, archived); err != nil {
+		return err
+	}
+
+	logger.Info("Room archive state updated", logger.WithFields(map[string]interface{}{
+		"room_id":  roomID,
+		"user_id":  userID,
+		"archived": archived,
+	}))
+
+	return nil
+}
+
+func (s *roomService) AddMember(ctx context.Context, roomID, userID, inviterID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.room.AddMember", tracing.ID("room_id", roomID), tracing.ID("user_id", userID), tracing.ID("inviter_id", inviterID))
+	defer func() { tracing.End(span, err) }()
+
+	// Check if inviter is admin
+	inviter, err := s.roomRepo.GetMember(ctx, roomID, inviterID)
+	if err != nil {
+		return err
+	}
+	if !isAdminOrOwner(inviter) {
+		return fmt.Errorf("%w: only admins can add members", ErrForbidden)
+	}
+
+	// Check if user is already a member
+	isMember, err := s.roomRepo.IsUserInRoom(ctx, roomID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check room membership: %w", err)
+	}
+	if isMember {
+		return fmt.Errorf("%w: user is already a member of this room", ErrConflict)
+	}
+
+	// Add user as member
+	member := &model.RoomMember{
+		RoomID:    roomID,
+		UserID:    userID,
+		Role:      "member",
+		JoinedAt:  time.Now(),
+		InvitedBy: &inviterID,
+	}
+
+	if err := s.roomRepo.AddMember(ctx, member); err != nil {
+		return addMemberError(err)
+	}
+
+	// Cache room membership
+	if err := s.redis.AddUserToRoom(ctx, roomID.String(), userID.String()); err != nil {
+		logger.Warn("Failed to cache room membership", logger.WithField("error", err.Error()))
+	}
+
+	// Publish member add event
+	eventData := events.RoomEventData(roomID, &userID, map[string]interface{}{
+		"inviter_id": inviterID,
+	})
+
+	if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomMemberAdd, roomID, eventData, &inviterID); err != nil {
+		logger.Warn("Failed to publish member add event", logger.WithField("error", err.Error()))
+	}
+
+	return nil
+}
+
+func (s *roomService) RemoveMember(ctx context.Context, roomID, userID, removerID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.room.RemoveMember", tracing.ID("room_id", roomID), tracing.ID("user_id", userID), tracing.ID("remover_id", removerID))
+	defer func() { tracing.End(span, err) }()
+
+	// Get room to check type and properties
+	room, err := s.roomRepo.GetByID(ctx, roomID)
+	if err != nil {
+		return fmt.Errorf("failed to get room: %w", err)
+	}
+	if room == nil {
+		return ErrRoomNotFound
+	}
+
+	// Business rule: Cannot remove members from private rooms (2 members only)
+	// Private messages (direct rooms with 2 members) should not allow member removal
+	if room.MemberCount == 2 && (room.Type == "direct" || room.Type == "private") {
+		return fmt.Errorf("%w: cannot remove members from private messages with only 2 participants", ErrInvalidArgument)
+	}
+
+	// Check if remover is admin
+	remover, err := s.roomRepo.GetMember(ctx, roomID, removerID)
+	if err != nil {
+		return err
+	}
+	if !isAdminOrOwner(remover) {
+		return fmt.Errorf("%w: only admins can remove members", ErrForbidden)
+	}
+
+	if err := s.roomRepo.RemoveMember(ctx, roomID, userID); err != nil {
+		return fmt.Errorf("failed to remove member: %w", err)
 	}
 
 	// Remove from cache
@@ -597,7 +1216,7 @@ func (s *roomService) RemoveMember(ctx context.Context, roomID, userID, removerI
 	eventData := events.RoomEventData(roomID, &userID, map[string]interface{}{
 		"remover_id":   removerID,
 		"room_type":    room.Type,
-		"member_count": len(members) - 1, // After removal
+		"member_count": room.MemberCount - 1, // After removal
 	})
 
 	if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomMemberRemove, roomID, eventData, &removerID); err != nil {
@@ -607,48 +1226,651 @@ func (s *roomService) RemoveMember(ctx context.Context, roomID, userID, removerI
 	return nil
 }
 
-func (s *roomService) GetRoomMembers(ctx context.Context, roomID uuid.UUID) ([]model.RoomMember, error) {
-	members, err := s.roomRepo.GetRoomMembers(ctx, roomID)
+// BanMember removes the user from the room and keeps them from joining it
+// again until the ban is lifted or expires
+func (s *roomService) BanMember(ctx context.Context, roomID, userID, adminID uuid.UUID, req *model.BanMemberRequest) (_ *model.RoomBan, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.BanMember", tracing.ID("room_id", roomID), tracing.ID("user_id", userID), tracing.ID("admin_id", adminID))
+	defer func() { tracing.End(span, err) }()
+
+	room, err := s.roomRepo.GetByID(ctx, roomID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get room members: %w", err)
+		return nil, fmt.Errorf("failed to get room: %w", err)
+	}
+	if room == nil {
+		return nil, ErrRoomNotFound
+	}
+	if room.Type == "direct" {
+		return nil, fmt.Errorf("%w: users can't be banned from direct rooms", ErrInvalidArgument)
+	}
+
+	admin, err := s.roomRepo.GetMember(ctx, roomID, adminID)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdminOrOwner(admin) {
+		return nil, fmt.Errorf("%w: only admins can ban members", ErrForbidden)
 	}
-	return members, nil
+	if userID == adminID {
+		return nil, fmt.Errorf("%w: you can't ban yourself", ErrInvalidArgument)
+	}
+	target, err := s.roomRepo.GetMember(ctx, roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if isAdminOrOwner(target) {
+		return nil, fmt.Errorf("%w: admins can't be banned", ErrInvalidArgument)
+	}
+
+	ban := &model.RoomBan{
+		RoomID:   roomID,
+		UserID:   userID,
+		BannedBy: adminID,
+		Reason:   req.Reason,
+	}
+	if req.Duration > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.Duration) * time.Second)
+		ban.ExpiresAt = &expiresAt
+	}
+
+	if err := s.roomRepo.BanUser(ctx, ban); err != nil {
+		return nil, err
+	}
+
+	// Reload so a replaced ban keeps its original ID
+	if stored, err := s.roomRepo.GetActiveBan(ctx, roomID, userID); err == nil && stored != nil {
+		ban = stored
+	}
+
+	if err := s.redis.RemoveUserFromRoom(ctx, roomID.String(), userID.String()); err != nil {
+		logger.Warn("Failed to remove user from room cache", logger.WithField("error", err.Error()))
+	}
+
+	eventData := events.RoomEventData(roomID, &userID, map[string]interface{}{
+		"banned_by":  adminID,
+		"reason":     ban.Reason,
+		"expires_at": ban.ExpiresAt,
+		"was_member": target != nil,
+	})
+	if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomMemberBan, roomID, eventData, &adminID); err != nil {
+		logger.Warn("Failed to publish member ban event", logger.WithField("error", err.Error()))
+	}
+
+	logger.Info("User banned from room", logger.WithFields(map[string]interface{}{
+		"room_id":   roomID,
+		"user_id":   userID,
+		"banned_by": adminID,
+	}))
+
+	return ban, nil
 }
 
-func (s *roomService) UpdateMemberRole(ctx context.Context, roomID, userID, updaterID uuid.UUID, role string) error {
-	// Check if updater is admin
-	members, err := s.roomRepo.GetRoomMembers(ctx, roomID)
+// UnbanMember lifts the ban of a user so they can join the room again
+func (s *roomService) UnbanMember(ctx context.Context, roomID, userID, adminID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.room.UnbanMember", tracing.ID("room_id", roomID), tracing.ID("user_id", userID), tracing.ID("admin_id", adminID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkRoomAdmin(ctx, roomID, adminID); err != nil {
+		return err
+	}
+
+	unbanned, err := s.roomRepo.UnbanUser(ctx, roomID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to get room members: %w", err)
+		return err
+	}
+	if !unbanned {
+		return fmt.Errorf("%w: user is not banned from this room", ErrNotFound)
+	}
+
+	eventData := events.RoomEventData(roomID, &userID, map[string]interface{}{
+		"unbanned_by": adminID,
+	})
+	if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomMemberUnban, roomID, eventData, &adminID); err != nil {
+		logger.Warn("Failed to publish member unban event", logger.WithField("error", err.Error()))
+	}
+
+	return nil
+}
+
+// GetRoomBans lists the active bans of a room for its admins
+func (s *roomService) GetRoomBans(ctx context.Context, roomID, adminID uuid.UUID) (_ []model.RoomBan, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.GetRoomBans", tracing.ID("room_id", roomID), tracing.ID("admin_id", adminID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkRoomAdmin(ctx, roomID, adminID); err != nil {
+		return nil, err
+	}
+	return s.roomRepo.GetActiveBans(ctx, roomID)
+}
+
+// CreateWebhook registers a webhook receiving the given events of a room
+func (s *roomService) CreateWebhook(ctx context.Context, roomID, adminID uuid.UUID, req *model.CreateWebhookRequest) (_ *model.RoomWebhook, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.CreateWebhook", tracing.ID("room_id", roomID), tracing.ID("admin_id", adminID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkRoomAdmin(ctx, roomID, adminID); err != nil {
+		return nil, err
+	}
+
+	if target, err := url.Parse(req.URL); err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("%w: webhook url must be an http or https url", ErrInvalidArgument)
+	}
+	for _, eventType := range req.Events {
+		if eventType != "*" && !strings.HasPrefix(eventType, "event.room.") && !strings.HasPrefix(eventType, "event.message.") {
+			return nil, fmt.Errorf("%w: webhooks can only subscribe to room and message events, not %q", ErrInvalidArgument, eventType)
+		}
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		secretBytes := make([]byte, 32)
+		if _, err := rand.Read(secretBytes); err != nil {
+			return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+		}
+		secret = hex.EncodeToString(secretBytes)
+	}
+
+	webhook := &model.RoomWebhook{
+		RoomID:    roomID,
+		URL:       req.URL,
+		Secret:    secret,
+		Events:    req.Events,
+		IsActive:  true,
+		CreatedBy: adminID,
+	}
+	if err := s.roomRepo.CreateWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// DeleteWebhook removes a webhook of a room
+func (s *roomService) DeleteWebhook(ctx context.Context, roomID, webhookID, adminID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.room.DeleteWebhook", tracing.ID("room_id", roomID), tracing.ID("webhook_id", webhookID), tracing.ID("admin_id", adminID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkRoomAdmin(ctx, roomID, adminID); err != nil {
+		return err
+	}
+
+	deleted, err := s.roomRepo.DeleteWebhook(ctx, roomID, webhookID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("%w: no webhook with this ID", ErrNotFound)
+	}
+	return nil
+}
+
+// ListWebhooks lists the webhooks of a room for its admins, without their
+// secrets
+func (s *roomService) ListWebhooks(ctx context.Context, roomID, adminID uuid.UUID) (_ []model.RoomWebhook, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.ListWebhooks", tracing.ID("room_id", roomID), tracing.ID("admin_id", adminID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkRoomAdmin(ctx, roomID, adminID); err != nil {
+		return nil, err
+	}
+
+	webhooks, err := s.roomRepo.GetWebhooks(ctx, roomID, false)
+	if err != nil {
+		return nil, err
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks, nil
+}
+
+// DeliverWebhooks sends a room event to the active webhooks of its room that
+// subscribe to it. Deliveries run in the background so slow endpoints don't
+// hold up event routing.
+func (s *roomService) DeliverWebhooks(ctx context.Context, event *events.Event) (err error) {
+	if event.RoomID == nil {
+		return nil
+	}
+
+	ctx, span := tracing.Start(ctx, "service.room.DeliverWebhooks", tracing.ID("room_id", *event.RoomID))
+	defer func() { tracing.End(span, err) }()
+
+	webhooks, err := s.roomRepo.GetWebhooks(ctx, *event.RoomID, true)
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	for _, webhook := range webhooks {
+		if !webhookSubscribes(&webhook, event.Type) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(event); err != nil {
+				return fmt.Errorf("failed to marshal webhook payload: %w", err)
+			}
+		}
+
+		go func(webhook model.RoomWebhook) {
+			if err := WebhookDelivery(context.Background(), webhook.URL, webhook.Secret, event.Type, payload); err != nil {
+				logger.Warn("Failed to deliver webhook", logger.WithFields(map[string]interface{}{
+					"webhook_id": webhook.ID,
+					"room_id":    webhook.RoomID,
+					"event_type": event.Type,
+					"error":      err.Error(),
+				}))
+			}
+		}(webhook)
+	}
+	return nil
+}
+
+// webhookSubscribes reports whether a webhook receives an event type
+func webhookSubscribes(webhook *model.RoomWebhook, eventType string) bool {
+	for _, subscribed := range webhook.Events {
+		if subscribed == "*" || subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// roomStatsCacheTTL is how long the message counts of a room are cached, as
+// counting them scans the room's history
+const roomStatsCacheTTL = 5 * time.Minute
+
+// roomStatsTopReactions is the number of most used reactions in room stats
+const roomStatsTopReactions = 10
+
+// GetRoomStats summarizes the activity of a room for its admins
+func (s *roomService) GetRoomStats(ctx context.Context, roomID, adminID uuid.UUID) (_ *model.RoomStatsResponse, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.GetRoomStats", tracing.ID("room_id", roomID), tracing.ID("admin_id", adminID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkRoomAdmin(ctx, roomID, adminID); err != nil {
+		return nil, err
+	}
+
+	counts, err := s.roomMessageCounts(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	membersByRole, err := s.roomRepo.CountMembersByRole(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	reactions, err := s.roomRepo.GetTopReactions(ctx, roomID, roomStatsTopReactions)
+	if err != nil {
+		return nil, err
+	}
+
+	peak, err := s.redis.GetRoomConnectionPeak(ctx, roomID.String())
+	if err != nil {
+		logger.Warn("Failed to get room connection peak", logger.WithField("error", err.Error()))
+	}
+
+	return &model.RoomStatsResponse{
+		RoomID:          roomID,
+		Messages:        *counts,
+		MembersByRole:   membersByRole,
+		PeakConnections: peak,
+		TopReactions:    reactions,
+	}, nil
+}
+
+// roomMessageCounts returns the message counts of a room, cached in Redis
+func (s *roomService) roomMessageCounts(ctx context.Context, roomID uuid.UUID) (*model.RoomMessageCounts, error) {
+	key := fmt.Sprintf("room_stats:%s", roomID)
+	if cached, err := s.redis.Get(ctx, key); err == nil {
+		var counts model.RoomMessageCounts
+		if err := json.Unmarshal([]byte(cached), &counts); err == nil {
+			return &counts, nil
+		}
+	}
+
+	counts, err := s.roomRepo.GetMessageCounts(ctx, roomID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if encoded, err := json.Marshal(counts); err == nil {
+		if err := s.redis.Set(ctx, key, string(encoded), roomStatsCacheTTL); err != nil {
+			logger.Warn("Failed to cache room message counts", logger.WithField("error", err.Error()))
+		}
+	}
+	return counts, nil
+}
+
+// GetRoomMembers returns a page of the members of a room, optionally only
+// those with a role or whose username matches search. Members of private
+// rooms are only listed to other members.
+func (s *roomService) GetRoomMembers(ctx context.Context, roomID, userID uuid.UUID, role, search string, page, limit int) (_ []model.RoomMember, _ *model.PaginationMeta, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.GetRoomMembers", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	room, err := s.roomRepo.GetByID(ctx, roomID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get room: %w", err)
+	}
+	if room == nil {
+		return nil, nil, ErrRoomNotFound
+	}
+	if !room.IsPublic {
+		member, err := s.roomRepo.GetMember(ctx, roomID, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if member == nil {
+			return nil, nil, fmt.Errorf("%w: user is not a member of this room", ErrForbidden)
+		}
+	}
+
+	page, limit = normalizePage(page, limit)
+	members, total, err := s.roomRepo.ListRoomMembers(ctx, roomID, role, strings.TrimSpace(search), (page-1)*limit, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range members {
+		if members[i].UserID != userID && members[i].User.ID != uuid.Nil {
+			members[i].User.Status = members[i].User.VisibleStatus()
+		}
+	}
+	return members, newPaginationMeta(page, limit, total), nil
+}
+
+const (
+	// memberSuggestionLimit is the number of members suggested for a mention
+	memberSuggestionLimit = 10
+	// memberSuggestionCacheTTL is how long the suggestions for a prefix are
+	// cached; busy rooms ask for the same prefixes over and over
+	memberSuggestionCacheTTL = time.Minute
+)
+
+// GetMember returns the membership of a user in a room, ErrForbidden when
+// they aren't a member
+func (s *roomService) GetMember(ctx context.Context, roomID, userID uuid.UUID) (_ *model.RoomMember, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.GetMember", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	room, err := s.roomRepo.GetByID(ctx, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room: %w", err)
+	}
+	if room == nil {
+		return nil, ErrRoomNotFound
 	}
 
-	isAdmin := false
+	member, err := s.roomRepo.GetMember(ctx, roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, fmt.Errorf("%w: you are not a member of this room", ErrForbidden)
+	}
+	return member, nil
+}
+
+// SuggestMembers returns the first members of a room whose username starts
+// with prefix, for mention autocompletion. Only members may ask.
+func (s *roomService) SuggestMembers(ctx context.Context, roomID, userID uuid.UUID, prefix string) (_ []model.MemberSuggestion, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.SuggestMembers", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	member, err := s.roomRepo.GetMember(ctx, roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, fmt.Errorf("%w: user is not a member of this room", ErrForbidden)
+	}
+
+	prefix = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(prefix), "@"))
+	key := fmt.Sprintf("member_suggestions:%s:%s", roomID, prefix)
+	if cached, err := s.redis.Get(ctx, key); err == nil {
+		var suggestions []model.MemberSuggestion
+		if err := json.Unmarshal([]byte(cached), &suggestions); err == nil {
+			return suggestions, nil
+		}
+	}
+
+	members, err := s.roomRepo.SearchMembersByUsername(ctx, roomID, prefix, memberSuggestionLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]model.MemberSuggestion, 0, len(members))
 	for _, member := range members {
-		if member.UserID == updaterID && (member.Role == "admin" || member.Role == "owner") {
-			isAdmin = true
-			break
+		displayName := senderDisplayName(&member.User)
+		if member.User.Profile != nil && member.User.Profile.DisplayName != "" {
+			displayName = member.User.Profile.DisplayName
 		}
+		suggestions = append(suggestions, model.MemberSuggestion{
+			UserID:      member.UserID,
+			Username:    member.User.Username,
+			Avatar:      member.User.Avatar,
+			DisplayName: displayName,
+		})
 	}
 
-	if !isAdmin {
-		return fmt.Errorf("access denied: only admins can update member roles")
+	if encoded, err := json.Marshal(suggestions); err == nil {
+		if err := s.redis.Set(ctx, key, string(encoded), memberSuggestionCacheTTL); err != nil {
+			logger.Warn("Failed to cache member suggestions", logger.WithField("error", err.Error()))
+		}
+	}
+	return suggestions, nil
+}
+
+type roomMemberKey struct{}
+
+// WithRoomMember returns a context carrying a membership already looked up,
+// by the room permission middleware, so the room service doesn't query it
+// again
+func WithRoomMember(ctx context.Context, member *model.RoomMember) context.Context {
+	return context.WithValue(ctx, roomMemberKey{}, member)
+}
+
+// getMember returns the membership of a user in a room, the one carried by
+// ctx when it matches
+func (s *roomService) getMember(ctx context.Context, roomID, userID uuid.UUID) (*model.RoomMember, error) {
+	if member, ok := ctx.Value(roomMemberKey{}).(*model.RoomMember); ok && member.RoomID == roomID && member.UserID == userID {
+		return member, nil
+	}
+	return s.roomRepo.GetMember(ctx, roomID, userID)
+}
+
+// isAdminOrOwner reports whether a member is an owner or admin of their room
+func isAdminOrOwner(member *model.RoomMember) bool {
+	return member.HasRole(model.RoomRoleAdmin)
+}
+
+// MuteMember mutes or unmutes a member. Timed mutes lift by themselves once
+// MutedUntil has passed.
+func (s *roomService) MuteMember(ctx context.Context, roomID, userID, adminID uuid.UUID, req *model.MuteMemberRequest) (_ *model.RoomMember, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.MuteMember", tracing.ID("room_id", roomID), tracing.ID("user_id", userID), tracing.ID("admin_id", adminID))
+	defer func() { tracing.End(span, err) }()
+
+	admin, err := s.roomRepo.GetMember(ctx, roomID, adminID)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdminOrOwner(admin) {
+		return nil, fmt.Errorf("%w: only admins can mute members", ErrForbidden)
+	}
+	target, err := s.roomRepo.GetMember(ctx, roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, fmt.Errorf("%w: user is not a member of this room", ErrNotFound)
+	}
+	if isAdminOrOwner(target) {
+		return nil, fmt.Errorf("%w: admins can't be muted", ErrInvalidArgument)
+	}
+
+	var until *time.Time
+	if req.Muted && req.Duration > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.Duration) * time.Second)
+		until = &expiresAt
+	}
+
+	if err := s.roomRepo.SetMemberMuted(ctx, roomID, userID, req.Muted, until); err != nil {
+		return nil, err
+	}
+	target.IsMuted = req.Muted
+	target.MutedUntil = until
+
+	eventData := events.RoomEventData(roomID, &userID, map[string]interface{}{
+		"is_muted":    req.Muted,
+		"muted_until": until,
+		"updater_id":  adminID,
+	})
+	if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomMemberMuteUpdate, roomID, eventData, &adminID); err != nil {
+		logger.Warn("Failed to publish member mute event", logger.WithField("error", err.Error()))
+	}
+
+	return target, nil
+}
+
+// UpdateNotificationLevel sets which messages of the room notify the user.
+// It doesn't affect whether the user can post.
+func (s *roomService) UpdateNotificationLevel(ctx context.Context, roomID, userID uuid.UUID, level model.NotificationLevel) (err error) {
+	ctx, span := tracing.Start(ctx, "service.room.UpdateNotificationLevel", tracing.ID("room_id", roomID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	switch level {
+	case model.NotificationLevelAll, model.NotificationLevelMentions, model.NotificationLevelNone:
+	case model.NotificationLevelMentionsOnly:
+		level = model.NotificationLevelMentions
+	case model.NotificationLevelNothing:
+		level = model.NotificationLevelNone
+	default:
+		return fmt.Errorf("%w: unknown notification level %q", ErrInvalidArgument, level)
+	}
+
+	isMember, err := s.roomRepo.IsUserInRoom(ctx, roomID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check room membership: %w", err)
+	}
+	if !isMember {
+		return fmt.Errorf("%w: user is not a member of this room", ErrForbidden)
+	}
+
+	return s.roomRepo.SetMemberNotificationLevel(ctx, roomID, userID, level)
+}
+
+func (s *roomService) UpdateMemberRole(ctx context.Context, roomID, userID, updaterID uuid.UUID, role string) (err error) {
+	ctx, span := tracing.Start(ctx, "service.room.UpdateMemberRole", tracing.ID("room_id", roomID), tracing.ID("user_id", userID), tracing.ID("updater_id", updaterID))
+	defer func() { tracing.End(span, err) }()
+
+	// Check if updater is admin
+	updater, err := s.roomRepo.GetMember(ctx, roomID, updaterID)
+	if err != nil {
+		return err
+	}
+	if !isAdminOrOwner(updater) {
+		return fmt.Errorf("%w: only admins can update member roles", ErrForbidden)
+	}
+	target, err := s.roomRepo.GetMember(ctx, roomID, userID)
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		return fmt.Errorf("%w: user is not a member of this room", ErrNotFound)
+	}
+
+	// A room must keep at least one admin or owner
+	if isAdminOrOwner(target) && role != "admin" && role != "owner" {
+		counts, err := s.roomRepo.CountMembersByRole(ctx, roomID)
+		if err != nil {
+			return err
+		}
+		if counts["admin"]+counts["owner"] <= 1 {
+			return fmt.Errorf("%w: cannot demote the last admin of the room", ErrInvalidArgument)
+		}
 	}
 
 	if err := s.roomRepo.UpdateMemberRole(ctx, roomID, userID, role); err != nil {
 		return fmt.Errorf("failed to update member role: %w", err)
 	}
 
+	// Publish role update event
+	eventData := events.RoomEventData(roomID, &userID, map[string]interface{}{
+		"role":       role,
+		"old_role":   target.Role,
+		"updater_id": updaterID,
+	})
+
+	if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomMemberRoleUpdate, roomID, eventData, &updaterID); err != nil {
+		logger.Warn("Failed to publish member role update event", logger.WithField("error", err.Error()))
+	}
+
 	return nil
 }
 
-func (s *roomService) CreateInvite(ctx context.Context, roomID, inviterID uuid.UUID, req *model.CreateInviteRequest) (*model.RoomInvite, error) {
+// TransferOwnership hands the room over to another member. The old owner
+// stays on as admin.
+func (s *roomService) TransferOwnership(ctx context.Context, roomID, currentOwnerID, newOwnerID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.room.TransferOwnership", tracing.ID("room_id", roomID), tracing.ID("user_id", currentOwnerID), tracing.ID("new_owner_id", newOwnerID))
+	defer func() { tracing.End(span, err) }()
+
+	room, err := s.roomRepo.GetByID(ctx, roomID)
+	if err != nil {
+		return fmt.Errorf("failed to get room: %w", err)
+	}
+	if room == nil {
+		return ErrRoomNotFound
+	}
+
+	if room.CreatedBy != currentOwnerID {
+		return fmt.Errorf("%w: only the room owner can transfer ownership", ErrForbidden)
+	}
+	if room.Type == "direct" {
+		return fmt.Errorf("%w: direct rooms have no owner to transfer", ErrInvalidArgument)
+	}
+	if newOwnerID == currentOwnerID {
+		return fmt.Errorf("%w: user already owns the room", ErrInvalidArgument)
+	}
+
+	isMember, err := s.roomRepo.IsUserInRoom(ctx, roomID, newOwnerID)
+	if err != nil {
+		return fmt.Errorf("failed to check room membership: %w", err)
+	}
+	if !isMember {
+		return fmt.Errorf("%w: new owner must be a member of the room", ErrInvalidArgument)
+	}
+
+	if err := s.roomRepo.TransferOwnership(ctx, roomID, currentOwnerID, newOwnerID); err != nil {
+		return err
+	}
+
+	eventData := events.RoomEventData(roomID, &newOwnerID, map[string]interface{}{
+		"old_owner_id": currentOwnerID,
+		"new_owner_id": newOwnerID,
+	})
+	if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomOwnershipTransfer, roomID, eventData, &currentOwnerID); err != nil {
+		logger.Warn("Failed to publish ownership transfer event", logger.WithField("error", err.Error()))
+	}
+
+	logger.Info("Room ownership transferred", logger.WithFields(map[string]interface{}{
+		"room_id":      roomID,
+		"old_owner_id": currentOwnerID,
+		"new_owner_id": newOwnerID,
+	}))
+
+	return nil
+}
+
+func (s *roomService) CreateInvite(ctx context.Context, roomID, inviterID uuid.UUID, req *model.CreateInviteRequest) (_ *model.RoomInvite, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.CreateInvite", tracing.ID("room_id", roomID), tracing.ID("inviter_id", inviterID))
+	defer func() { tracing.End(span, err) }()
+
 	// Check if inviter is member
 	isMember, err := s.roomRepo.IsUserInRoom(ctx, roomID, inviterID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check room membership: %w", err)
 	}
 	if !isMember {
-		return nil, fmt.Errorf("access denied: only members can create invites")
+		return nil, fmt.Errorf("%w: only members can create invites", ErrForbidden)
 	}
 
 	// Generate invite code
@@ -665,34 +1887,63 @@ func (s *roomService) CreateInvite(ctx context.Context, roomID, inviterID uuid.U
 		InviterID:  inviterID,
 		InviteCode: inviteCode,
 		ExpiresAt:  &expiresAt,
-		Status:     "pending",
+		Status:     model.InviteStatusPending,
 		MaxUses:    req.MaxUses,
 		UsedCount:  0,
+		InviteeID:  req.InviteeID,
 	}
 
 	if err := s.roomRepo.CreateInvite(ctx, invite); err != nil {
 		return nil, fmt.Errorf("failed to create invite: %w", err)
 	}
 
+	// Publish invite event so a direct invitee gets notified
+	if invite.InviteeID != nil {
+		eventData := events.RoomEventData(roomID, &inviterID, map[string]interface{}{
+			"invite_id":   invite.ID,
+			"invitee_id":  *invite.InviteeID,
+			"invite_code": invite.InviteCode,
+		})
+
+		if err := s.eventPublisher.PublishRoomEvent(ctx, events.RoomInviteCreate, roomID, eventData, &inviterID); err != nil {
+			logger.Warn("Failed to publish invite create event", logger.WithField("error", err.Error()))
+		}
+	}
+
 	return invite, nil
 }
 
-func (s *roomService) AcceptInvite(ctx context.Context, inviteCode string, userID uuid.UUID) (*model.Room, error) {
+func (s *roomService) AcceptInvite(ctx context.Context, inviteCode string, userID uuid.UUID) (_ *model.Room, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.AcceptInvite", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
 	invite, err := s.roomRepo.GetInviteByCode(ctx, inviteCode)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get invite: %w", err)
 	}
 	if invite == nil {
-		return nil, fmt.Errorf("invalid or expired invite")
+		return nil, fmt.Errorf("%w: invalid or expired invite", ErrNotFound)
 	}
 
 	// Check if invite is still valid
 	if invite.ExpiresAt.Before(time.Now()) {
-		return nil, fmt.Errorf("invite has expired")
+		return nil, fmt.Errorf("%w: invite has expired", ErrConflict)
+	}
+	switch invite.Status {
+	case model.InviteStatusPending:
+	case model.InviteStatusExpired:
+		return nil, fmt.Errorf("%w: invite has been revoked", ErrConflict)
+	default:
+		return nil, fmt.Errorf("%w: invite has already been answered", ErrConflict)
+	}
+
+	// Direct invites can only be used by their invitee
+	if invite.InviteeID != nil && *invite.InviteeID != userID {
+		return nil, fmt.Errorf("%w: invite is for another user", ErrForbidden)
 	}
 
 	if invite.MaxUses > 0 && invite.UsedCount >= invite.MaxUses {
-		return nil, fmt.Errorf("invite has reached maximum usage")
+		return nil, fmt.Errorf("%w: invite has reached maximum usage", ErrConflict)
 	}
 
 	// Check if user is already a member
@@ -701,7 +1952,11 @@ func (s *roomService) AcceptInvite(ctx context.Context, inviteCode string, userI
 		return nil, fmt.Errorf("failed to check room membership: %w", err)
 	}
 	if isMember {
-		return nil, fmt.Errorf("user is already a member of this room")
+		return nil, fmt.Errorf("%w: user is already a member of this room", ErrConflict)
+	}
+
+	if err := s.checkNotBanned(ctx, invite.RoomID, userID); err != nil {
+		return nil, err
 	}
 
 	// Add user as member
@@ -713,13 +1968,14 @@ func (s *roomService) AcceptInvite(ctx context.Context, inviteCode string, userI
 		InvitedBy: &invite.InviterID,
 	}
 
-	if err := s.roomRepo.AddMember(ctx, member); err != nil {
-		return nil, fmt.Errorf("failed to add member: %w", err)
+	// Count the use and add the member together, so concurrent accepts can't
+	// go past MaxUses
+	accepted, err := s.roomRepo.AcceptInvite(ctx, invite, member)
+	if err != nil {
+		return nil, addMemberError(err)
 	}
-
-	// Update invite usage
-	if err := s.roomRepo.AcceptInvite(ctx, invite.ID); err != nil {
-		logger.Warn("Failed to update invite usage", logger.WithField("error", err.Error()))
+	if !accepted {
+		return nil, fmt.Errorf("%w: invite is no longer valid", ErrConflict)
 	}
 
 	// Cache room membership
@@ -736,77 +1992,132 @@ func (s *roomService) AcceptInvite(ctx context.Context, inviteCode string, userI
 	return room, nil
 }
 
-func (s *roomService) RejectInvite(ctx context.Context, inviteCode string, userID uuid.UUID) error {
+func (s *roomService) RejectInvite(ctx context.Context, inviteCode string, userID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.room.RejectInvite", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
 	invite, err := s.roomRepo.GetInviteByCode(ctx, inviteCode)
 	if err != nil {
 		return fmt.Errorf("failed to get invite: %w", err)
 	}
 	if invite == nil {
-		return fmt.Errorf("invalid invite")
+		return fmt.Errorf("%w: invalid invite", ErrNotFound)
 	}
 
-	if err := s.roomRepo.RejectInvite(ctx, invite.ID); err != nil {
+	// Shareable invites have no single invitee to decline them
+	if invite.InviteeID == nil {
+		return fmt.Errorf("%w: only direct invites can be rejected", ErrInvalidArgument)
+	}
+	if *invite.InviteeID != userID {
+		return fmt.Errorf("%w: invite is for another user", ErrForbidden)
+	}
+
+	rejected, err := s.roomRepo.RejectInvite(ctx, invite.ID)
+	if err != nil {
 		return fmt.Errorf("failed to reject invite: %w", err)
 	}
+	if !rejected {
+		return fmt.Errorf("%w: invite is no longer pending", ErrConflict)
+	}
 
 	return nil
 }
 
-// CreateOrGetDirectRoom creates a direct room between two users or returns existing one
-func (s *roomService) CreateOrGetDirectRoom(ctx context.Context, user1ID, user2ID uuid.UUID) (*model.Room, error) {
-	// Check if direct room already exists between these users
-	user1Rooms, err := s.roomRepo.GetUserRooms(ctx, user1ID)
+// GetRoomInvites lists the invites of a room with their status and usage
+// for its admins
+func (s *roomService) GetRoomInvites(ctx context.Context, roomID, adminID uuid.UUID) (_ []model.RoomInvite, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.GetRoomInvites", tracing.ID("room_id", roomID), tracing.ID("admin_id", adminID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkRoomAdmin(ctx, roomID, adminID); err != nil {
+		return nil, err
+	}
+	return s.roomRepo.GetRoomInvites(ctx, roomID)
+}
+
+// RevokeInvite expires a pending invite so its code can no longer be used
+func (s *roomService) RevokeInvite(ctx context.Context, roomID, inviteID, adminID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.room.RevokeInvite", tracing.ID("room_id", roomID), tracing.ID("invite_id", inviteID), tracing.ID("admin_id", adminID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkRoomAdmin(ctx, roomID, adminID); err != nil {
+		return err
+	}
+
+	revoked, err := s.roomRepo.RevokeInvite(ctx, roomID, inviteID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user rooms: %w", err)
+		return err
+	}
+	if !revoked {
+		return fmt.Errorf("%w: no pending invite with this ID", ErrNotFound)
 	}
+	return nil
+}
 
-	// Look for existing direct room
-	for _, room := range user1Rooms {
-		if room.Type == "direct" {
-			members, err := s.roomRepo.GetRoomMembers(ctx, room.ID)
-			if err != nil {
-				continue
-			}
+// CreateOrGetDirectRoom creates a direct room between two users or returns existing one
+func (s *roomService) CreateOrGetDirectRoom(ctx context.Context, user1ID, user2ID uuid.UUID) (_ *model.Room, err error) {
+	ctx, span := tracing.Start(ctx, "service.room.CreateOrGetDirectRoom", tracing.ID("user1_id", user1ID), tracing.ID("user2_id", user2ID))
+	defer func() { tracing.End(span, err) }()
 
-			// Check if this room has exactly 2 members and includes both users
-			if len(members) == 2 {
-				memberUserIDs := make(map[uuid.UUID]bool)
-				for _, member := range members {
-					memberUserIDs[member.UserID] = true
-				}
+	if user1ID == user2ID {
+		return nil, fmt.Errorf("%w: cannot create a direct room with yourself", ErrInvalidArgument)
+	}
 
-				if memberUserIDs[user1ID] && memberUserIDs[user2ID] {
-					return &room, nil
-				}
-			}
-		}
+	// A block on either side keeps the users from opening a direct room
+	blocked, err := isBlockedBetween(ctx, s.userRepo, s.redis, user1ID, user2ID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrUserUnavailable
+	}
+	if err := s.checkAcceptsDirectMessages(ctx, user1ID, user2ID); err != nil {
+		return nil, err
+	}
+
+	// Check if direct room already exists between these users
+	existing, err := s.roomRepo.GetDirectRoomBetween(ctx, user1ID, user2ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get direct room: %w", err)
+	}
+	if existing != nil {
+		return existing, nil
 	}
 
 	// Create new direct room if none exists
-	isPublic := false
-	createReq := &model.CreateRoomRequest{
+	directKey := directRoomKey(user1ID, user2ID)
+	now := time.Now()
+	room := &model.Room{
 		Name:        "", // Direct rooms typically don't have names
 		Description: "Direct message",
 		Type:        "direct",
-		IsPublic:    &isPublic,
+		IsPublic:    false,
+		CreatedBy:   user1ID,
+		DirectKey:   &directKey,
+
+		// Settings
+		AllowFileUpload:    true,
+		AllowVoiceMessages: true,
+		AllowVideoMessages: true,
 	}
 
-	room, err := s.CreateRoom(ctx, createReq, user1ID)
+	members := []model.RoomMember{
+		{UserID: user1ID, Role: "admin", JoinedAt: now},
+		{UserID: user2ID, Role: "member", JoinedAt: now, InvitedBy: &user1ID},
+	}
+
+	room, created, err := s.roomRepo.CreateDirectRoom(ctx, room, members)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create direct room: %w", err)
 	}
+	if !created {
+		// A concurrent request created the room first
+		return room, nil
+	}
 
-	// Add the second user to the room
-	err = s.AddMember(ctx, room.ID, user2ID, user1ID)
-	if err != nil {
-		// If adding member fails, try to clean up the room
-		if deleteErr := s.DeleteRoom(ctx, room.ID, user1ID); deleteErr != nil {
-			logger.Error("Failed to cleanup room after member addition failure", logger.WithFields(map[string]interface{}{
-				"room_id": room.ID,
-				"error":   deleteErr.Error(),
-			}))
-		}
-		return nil, fmt.Errorf("failed to add second user to direct room: %w", err)
+	// Cache room membership
+	if err := s.redis.AddUsersToRoom(ctx, room.ID.String(), []string{user1ID.String(), user2ID.String()}); err != nil {
+		logger.Warn("Failed to cache room membership", logger.WithField("error", err.Error()))
 	}
 
 	// Publish direct room created event using existing event system
@@ -824,3 +2135,50 @@ func (s *roomService) CreateOrGetDirectRoom(ctx context.Context, user1ID, user2I
 
 	return room, nil
 }
+
+// directRoomKey returns an order-independent key identifying the direct room of two users
+func directRoomKey(user1ID, user2ID uuid.UUID) string {
+	a, b := user1ID.String(), user2ID.String()
+	if a > b {
+		a, b = b, a
+	}
+	return a + ":" + b
+}
+
+// checkAcceptsDirectMessages fails when recipientID turned direct messages off,
+// unless senderID is one of their contacts
+func (s *roomService) checkAcceptsDirectMessages(ctx context.Context, senderID, recipientID uuid.UUID) error {
+	recipient, err := s.userRepo.GetByID(ctx, recipientID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if recipient == nil {
+		return ErrUserNotFound
+	}
+	if recipient.AllowDirectMessages {
+		return nil
+	}
+
+	contact, err := s.userRepo.GetContact(ctx, recipientID, senderID)
+	if err != nil {
+		return err
+	}
+	if contact != nil && contact.Status == model.ContactStatusAccepted {
+		return nil
+	}
+	return fmt.Errorf("%w: this user doesn't accept direct messages", ErrForbidden)
+}
+
+// directRoomPeer returns the other user of a direct room userID belongs to
+func directRoomPeer(room *model.Room, userID uuid.UUID) (uuid.UUID, bool) {
+	if room.Type != "direct" || room.DirectKey == nil {
+		return uuid.Nil, false
+	}
+
+	for _, part := range strings.Split(*room.DirectKey, ":") {
+		if id, err := uuid.Parse(part); err == nil && id != userID {
+			return id, true
+		}
+	}
+	return uuid.Nil, false
+}
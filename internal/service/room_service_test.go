@@ -0,0 +1,1110 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"realtime-api/internal/config"
+	"realtime-api/internal/database"
+	"realtime-api/internal/events"
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+	"realtime-api/internal/redis"
+	"realtime-api/internal/repository"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/rueidis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDatabase opens a migrated SQLite database in a temporary directory
+// and installs it as the global database used by the repositories
+func newTestDatabase(t testing.TB, models ...interface{}) *database.Database {
+	t.Helper()
+	logger.Init("fatal", "json", "stdout", "")
+
+	db, err := database.Init(&config.DatabaseConfig{
+		Driver:   "sqlite",
+		Database: filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=5000",
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	require.NoError(t, db.Migrate(models...))
+	return db
+}
+
+// newTestRedis starts an in-memory Redis server. miniredis has no support
+// for client side caching, so it is disabled on the client.
+func newTestRedis(t testing.TB) *redis.Redis {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client, err := rueidis.NewClient(rueidis.ClientOption{
+		InitAddress:  []string{server.Addr()},
+		DisableCache: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	return redis.New(client)
+}
+
+func newTestRoomService(t *testing.T) (RoomService, repository.RoomRepository, *database.Database) {
+	t.Helper()
+
+	db := newTestDatabase(t, &model.User{}, &model.UserProfile{}, &model.Room{}, &model.RoomMember{}, &model.RoomTag{}, &model.MessageDraft{}, &model.RoomJoinRequest{}, &model.RoomBan{}, &model.RoomInvite{}, &model.Message{}, &model.MessageReaction{}, &model.RoomWebhook{}, &model.UserBlock{}, &model.UserContact{})
+	roomRepo := repository.NewRoomRepository()
+	return NewRoomService(roomRepo, repository.NewUserRepository(), newTestRedis(t)), roomRepo, db
+}
+
+func countDirectRooms(t *testing.T, db *database.Database) int64 {
+	t.Helper()
+
+	var count int64
+	require.NoError(t, db.DB.Model(&model.Room{}).Where("type = ?", "direct").Count(&count).Error)
+	return count
+}
+
+// createTestUsers stores count users with the default settings
+func createTestUsers(t *testing.T, db *database.Database, count int) []uuid.UUID {
+	t.Helper()
+
+	userIDs := make([]uuid.UUID, count)
+	for i := range userIDs {
+		user := &model.User{Username: fmt.Sprintf("user%d", i), Email: fmt.Sprintf("user%d@example.com", i), Password: "secret"}
+		require.NoError(t, db.DB.Create(user).Error)
+		userIDs[i] = user.ID
+	}
+	return userIDs
+}
+
+func TestCreateOrGetDirectRoomConcurrent(t *testing.T) {
+	svc, _, db := newTestRoomService(t)
+
+	users := createTestUsers(t, db, 2)
+	user1, user2 := users[0], users[1]
+
+	var wg sync.WaitGroup
+	results := make([]*model.Room, 2)
+	errs := make([]error, 2)
+
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Alternate the caller to make sure the pair key is order independent
+			if i == 0 {
+				results[i], errs[i] = svc.CreateOrGetDirectRoom(context.Background(), user1, user2)
+			} else {
+				results[i], errs[i] = svc.CreateOrGetDirectRoom(context.Background(), user2, user1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	require.NoError(t, errs[0])
+	require.NoError(t, errs[1])
+	assert.Equal(t, results[0].ID, results[1].ID)
+	assert.Equal(t, int64(1), countDirectRooms(t, db))
+}
+
+func TestCreateOrGetDirectRoomRejectsSelf(t *testing.T) {
+	svc, _, db := newTestRoomService(t)
+
+	user := uuid.New()
+	_, err := svc.CreateOrGetDirectRoom(context.Background(), user, user)
+
+	assert.Error(t, err)
+	assert.Equal(t, int64(0), countDirectRooms(t, db))
+}
+
+func TestCreateOrGetDirectRoomBlocked(t *testing.T) {
+	svc, _, db := newTestRoomService(t)
+	ctx := context.Background()
+
+	blocker, blocked := uuid.New(), uuid.New()
+	directKey := directRoomKey(blocker, blocked)
+	room := &model.Room{Type: "direct", CreatedBy: blocker, DirectKey: &directKey}
+	require.NoError(t, db.DB.Create(room).Error)
+	for _, userID := range []uuid.UUID{blocker, blocked} {
+		require.NoError(t, db.DB.Create(&model.RoomMember{RoomID: room.ID, UserID: userID, Role: "member"}).Error)
+	}
+	require.NoError(t, db.DB.Create(&model.UserBlock{BlockerID: blocker, BlockedID: blocked}).Error)
+
+	// Both sides get the same error, so the blocked user can't tell
+	_, err := svc.CreateOrGetDirectRoom(ctx, blocked, blocker)
+	assert.ErrorIs(t, err, ErrUserUnavailable)
+	_, err = svc.CreateOrGetDirectRoom(ctx, blocker, blocked)
+	assert.ErrorIs(t, err, ErrUserUnavailable)
+
+	// Existing direct rooms are closed to messages as well
+	msgSvc := NewMessageService(repository.NewMessageRepository(), repository.NewRoomRepository(), repository.NewUserRepository(), nil, newTestRedis(t))
+	_, err = msgSvc.SendMessage(ctx, &model.SendMessageRequest{RoomID: room.ID, Content: "hello"}, blocked)
+	assert.ErrorIs(t, err, ErrUserUnavailable)
+}
+
+func TestCreateOrGetDirectRoomDirectMessagesOff(t *testing.T) {
+	svc, _, db := newTestRoomService(t)
+	ctx := context.Background()
+
+	users := createTestUsers(t, db, 3)
+	sender, recipient, contact := users[0], users[1], users[2]
+	require.NoError(t, db.DB.Model(&model.User{}).Where("id = ?", recipient).Update("allow_direct_messages", false).Error)
+	require.NoError(t, db.DB.Create(&model.UserContact{UserID: recipient, ContactID: contact, Status: model.ContactStatusAccepted}).Error)
+
+	_, err := svc.CreateOrGetDirectRoom(ctx, sender, recipient)
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.Equal(t, int64(0), countDirectRooms(t, db))
+
+	// Contacts can still reach the user
+	_, err = svc.CreateOrGetDirectRoom(ctx, contact, recipient)
+	require.NoError(t, err)
+
+	// Only the recipient's setting matters
+	_, err = svc.CreateOrGetDirectRoom(ctx, recipient, sender)
+	require.NoError(t, err)
+}
+
+func TestCreateOrGetDirectRoomAfterDelete(t *testing.T) {
+	svc, roomRepo, db := newTestRoomService(t)
+	ctx := context.Background()
+
+	users := createTestUsers(t, db, 2)
+	user1, user2 := users[0], users[1]
+
+	first, err := svc.CreateOrGetDirectRoom(ctx, user1, user2)
+	require.NoError(t, err)
+	require.NoError(t, roomRepo.Delete(ctx, first.ID))
+
+	second, err := svc.CreateOrGetDirectRoom(ctx, user2, user1)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID, second.ID)
+}
+
+func TestCreateOrGetDirectRoomAfterMemberLeft(t *testing.T) {
+	svc, roomRepo, db := newTestRoomService(t)
+	ctx := context.Background()
+
+	users := createTestUsers(t, db, 2)
+	user1, user2 := users[0], users[1]
+
+	first, err := svc.CreateOrGetDirectRoom(ctx, user1, user2)
+	require.NoError(t, err)
+	require.NoError(t, roomRepo.RemoveMember(ctx, first.ID, user2))
+
+	second, err := svc.CreateOrGetDirectRoom(ctx, user1, user2)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, second.ID)
+
+	for _, userID := range []uuid.UUID{user1, user2} {
+		isMember, err := roomRepo.IsUserInRoom(ctx, second.ID, userID)
+		require.NoError(t, err)
+		assert.True(t, isMember)
+	}
+}
+
+func TestListUserChatRoomsNamesDirectRooms(t *testing.T) {
+	svc, roomRepo, db := newTestRoomService(t)
+	ctx := context.Background()
+
+	users := createTestUsers(t, db, 3)
+	require.NoError(t, db.DB.Model(&model.User{}).Where("id = ?", users[1]).Update("avatar", "https://example.com/user1.png").Error)
+
+	_, err := svc.CreateOrGetDirectRoom(ctx, users[0], users[1])
+	require.NoError(t, err)
+
+	// Rooms created before membership was cached are read from the database
+	directKey := directRoomKey(users[0], users[2])
+	_, _, err = roomRepo.CreateDirectRoom(ctx, &model.Room{Type: "direct", CreatedBy: users[0], DirectKey: &directKey}, []model.RoomMember{
+		{UserID: users[0], Role: "admin", JoinedAt: time.Now()},
+		{UserID: users[2], Role: "member", JoinedAt: time.Now()},
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		rooms, _, err := svc.ListUserChatRooms(ctx, users[0], false, 1, 20)
+		require.NoError(t, err)
+
+		names := map[string]string{}
+		for _, room := range rooms {
+			names[room.Name] = room.Avatar
+		}
+		assert.Equal(t, map[string]string{"user1": "https://example.com/user1.png", "user2": ""}, names)
+	}
+}
+
+func TestArchiveRoomHidesItFromChatList(t *testing.T) {
+	svc, roomRepo, _ := newTestRoomService(t)
+	ctx := context.Background()
+
+	userID := uuid.New()
+	var roomIDs []uuid.UUID
+	for _, name := range []string{"general", "random"} {
+		room := &model.Room{Name: name, Type: "group", CreatedBy: userID}
+		require.NoError(t, roomRepo.Create(ctx, room))
+		require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: userID, Role: "admin"}))
+		roomIDs = append(roomIDs, room.ID)
+	}
+
+	require.NoError(t, svc.ArchiveRoom(ctx, roomIDs[0], userID, model.ArchiveForMe))
+
+	rooms, meta, err := svc.ListUserChatRooms(ctx, userID, false, 1, 20)
+	require.NoError(t, err)
+	require.Len(t, rooms, 1)
+	assert.Equal(t, roomIDs[1], rooms[0].ID)
+	assert.Equal(t, 1, meta.Total)
+
+	rooms, _, err = svc.ListUserChatRooms(ctx, userID, true, 1, 20)
+	require.NoError(t, err)
+	assert.Len(t, rooms, 2)
+
+	rooms, _, err = svc.ListArchivedRooms(ctx, userID, 1, 20)
+	require.NoError(t, err)
+	require.Len(t, rooms, 1)
+	assert.Equal(t, roomIDs[0], rooms[0].ID)
+
+	require.NoError(t, svc.UnarchiveRoom(ctx, roomIDs[0], userID, model.ArchiveForMe))
+	rooms, _, err = svc.ListArchivedRooms(ctx, userID, 1, 20)
+	require.NoError(t, err)
+	assert.Empty(t, rooms)
+
+	assert.ErrorIs(t, svc.ArchiveRoom(ctx, roomIDs[0], uuid.New(), model.ArchiveForMe), ErrForbidden)
+}
+
+func TestArchiveRoomForEveryone(t *testing.T) {
+	svc, roomRepo, _ := newTestRoomService(t)
+	ctx := context.Background()
+
+	creator := uuid.New()
+	member := uuid.New()
+	room := &model.Room{Name: "general", Type: "group", CreatedBy: creator}
+	require.NoError(t, roomRepo.Create(ctx, room))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: creator, Role: "admin"}))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: member, Role: "member"}))
+
+	assert.ErrorIs(t, svc.ArchiveRoom(ctx, room.ID, member, model.ArchiveForEveryone), ErrForbidden)
+	assert.ErrorIs(t, svc.ArchiveRoom(ctx, room.ID, creator, "sideways"), ErrInvalidArgument)
+	require.NoError(t, svc.ArchiveRoom(ctx, room.ID, creator, model.ArchiveForEveryone))
+
+	// Hidden from every member's chat list and closed for posting, even for admins
+	rooms, _, err := svc.ListUserChatRooms(ctx, member, false, 1, 20)
+	require.NoError(t, err)
+	assert.Empty(t, rooms)
+	rooms, _, err = svc.ListArchivedRooms(ctx, member, 1, 20)
+	require.NoError(t, err)
+	assert.Len(t, rooms, 1)
+	assert.ErrorIs(t, svc.CanPost(ctx, room.ID, creator), ErrRoomArchived)
+
+	require.NoError(t, svc.UnarchiveRoom(ctx, room.ID, creator, model.ArchiveForEveryone))
+	rooms, _, err = svc.ListUserChatRooms(ctx, member, false, 1, 20)
+	require.NoError(t, err)
+	assert.Len(t, rooms, 1)
+	assert.NoError(t, svc.CanPost(ctx, room.ID, member))
+}
+
+func TestLeaveRoomAsOwner(t *testing.T) {
+	svc, roomRepo, _ := newTestRoomService(t)
+	ctx := context.Background()
+
+	owner := uuid.New()
+	member := uuid.New()
+	room := &model.Room{Name: "general", Type: "group", CreatedBy: owner}
+	require.NoError(t, roomRepo.Create(ctx, room))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: owner, Role: "owner", JoinedAt: time.Now().Add(-time.Hour)}))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: member, Role: "member", JoinedAt: time.Now()}))
+
+	// Nobody could take over the room yet
+	assert.ErrorIs(t, svc.LeaveRoom(ctx, room.ID, owner), ErrInvalidArgument)
+
+	newer := uuid.New()
+	older := uuid.New()
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: newer, Role: "admin", JoinedAt: time.Now().Add(-time.Minute)}))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: older, Role: "admin", JoinedAt: time.Now().Add(-30 * time.Minute)}))
+
+	require.NoError(t, svc.LeaveRoom(ctx, room.ID, owner))
+
+	members, err := roomRepo.GetRoomMembers(ctx, room.ID)
+	require.NoError(t, err)
+	roles := map[uuid.UUID]string{}
+	for _, m := range members {
+		roles[m.UserID] = m.Role
+	}
+	assert.NotContains(t, roles, owner)
+	assert.Equal(t, "owner", roles[older])
+	assert.Equal(t, "admin", roles[newer])
+}
+
+func TestTransferOwnership(t *testing.T) {
+	svc, roomRepo, _ := newTestRoomService(t)
+	ctx := context.Background()
+
+	owner := uuid.New()
+	member := uuid.New()
+	room := &model.Room{Name: "general", Type: "group", CreatedBy: owner}
+	require.NoError(t, roomRepo.Create(ctx, room))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: owner, Role: "owner"}))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: member, Role: "member"}))
+
+	assert.ErrorIs(t, svc.TransferOwnership(ctx, room.ID, member, member), ErrForbidden)
+	assert.ErrorIs(t, svc.TransferOwnership(ctx, room.ID, owner, uuid.New()), ErrInvalidArgument)
+	assert.ErrorIs(t, svc.TransferOwnership(ctx, uuid.New(), owner, member), ErrRoomNotFound)
+
+	require.NoError(t, svc.TransferOwnership(ctx, room.ID, owner, member))
+
+	updated, err := roomRepo.GetByID(ctx, room.ID)
+	require.NoError(t, err)
+	assert.Equal(t, member, updated.CreatedBy)
+
+	members, err := roomRepo.GetRoomMembers(ctx, room.ID)
+	require.NoError(t, err)
+	roles := map[uuid.UUID]string{}
+	for _, m := range members {
+		roles[m.UserID] = m.Role
+	}
+	assert.Equal(t, "admin", roles[owner])
+	assert.Equal(t, "owner", roles[member])
+
+	// The old owner can no longer delete the room
+	assert.Error(t, svc.DeleteRoom(ctx, room.ID, owner))
+}
+
+func TestUpdateNotificationLevel(t *testing.T) {
+	svc, roomRepo, _ := newTestRoomService(t)
+	ctx := context.Background()
+
+	userID := uuid.New()
+	room := &model.Room{Name: "general", Type: "group", CreatedBy: userID}
+	require.NoError(t, roomRepo.Create(ctx, room))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: userID, Role: "member"}))
+
+	rooms, _, err := svc.ListUserChatRooms(ctx, userID, false, 1, 20)
+	require.NoError(t, err)
+	require.Len(t, rooms, 1)
+	assert.Equal(t, model.NotificationLevelAll, rooms[0].NotificationLevel)
+
+	require.NoError(t, svc.UpdateNotificationLevel(ctx, room.ID, userID, model.NotificationLevelMentions))
+	assert.ErrorIs(t, svc.UpdateNotificationLevel(ctx, room.ID, userID, "loud"), ErrInvalidArgument)
+	assert.ErrorIs(t, svc.UpdateNotificationLevel(ctx, room.ID, uuid.New(), model.NotificationLevelNone), ErrForbidden)
+
+	rooms, _, err = svc.ListUserChatRooms(ctx, userID, false, 1, 20)
+	require.NoError(t, err)
+	require.Len(t, rooms, 1)
+	assert.Equal(t, model.NotificationLevelMentions, rooms[0].NotificationLevel)
+
+	// Muting notifications doesn't stop the member from posting
+	assert.NoError(t, svc.CanPost(ctx, room.ID, userID))
+
+	// Aliases are stored as the level they stand for
+	require.NoError(t, svc.UpdateNotificationLevel(ctx, room.ID, userID, model.NotificationLevelNothing))
+	rooms, _, err = svc.ListUserChatRooms(ctx, userID, false, 1, 20)
+	require.NoError(t, err)
+	require.Len(t, rooms, 1)
+	assert.Equal(t, model.NotificationLevelNone, rooms[0].NotificationLevel)
+}
+
+func TestUpdateMemberRoleKeepsAnAdmin(t *testing.T) {
+	svc, roomRepo, _ := newTestRoomService(t)
+	ctx := context.Background()
+
+	admin := uuid.New()
+	member := uuid.New()
+	room := &model.Room{Name: "general", Type: "group", CreatedBy: admin}
+	require.NoError(t, roomRepo.Create(ctx, room))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: admin, Role: "admin"}))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: member, Role: "member"}))
+
+	assert.ErrorIs(t, svc.UpdateMemberRole(ctx, room.ID, admin, member, "member"), ErrForbidden)
+	assert.ErrorIs(t, svc.UpdateMemberRole(ctx, room.ID, admin, admin, "member"), ErrInvalidArgument)
+	assert.ErrorIs(t, svc.UpdateMemberRole(ctx, room.ID, uuid.New(), admin, "moderator"), ErrNotFound)
+
+	// Once there is a second admin the first one can step down
+	require.NoError(t, svc.UpdateMemberRole(ctx, room.ID, member, admin, "admin"))
+	require.NoError(t, svc.UpdateMemberRole(ctx, room.ID, admin, admin, "member"))
+
+	members, err := roomRepo.GetRoomMembers(ctx, room.ID)
+	require.NoError(t, err)
+	roles := map[uuid.UUID]string{}
+	for _, m := range members {
+		roles[m.UserID] = m.Role
+	}
+	assert.Equal(t, "member", roles[admin])
+	assert.Equal(t, "admin", roles[member])
+}
+
+func TestGetMemberRoleHierarchy(t *testing.T) {
+	svc, roomRepo, _ := newTestRoomService(t)
+	ctx := context.Background()
+
+	owner := uuid.New()
+	moderator := uuid.New()
+	room := &model.Room{Name: "general", Type: "group", CreatedBy: owner}
+	require.NoError(t, roomRepo.Create(ctx, room))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: owner, Role: "owner"}))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: moderator, Role: "moderator"}))
+
+	member, err := svc.GetMember(ctx, room.ID, owner)
+	require.NoError(t, err)
+	assert.True(t, member.HasRole(model.RoomRoleOwner))
+	assert.True(t, member.HasRole(model.RoomRoleMember))
+
+	member, err = svc.GetMember(ctx, room.ID, moderator)
+	require.NoError(t, err)
+	assert.True(t, member.HasRole(model.RoomRoleModerator))
+	assert.True(t, member.HasRole(model.RoomRoleMember))
+	assert.False(t, member.HasRole(model.RoomRoleAdmin))
+	assert.False(t, member.HasRole("superuser"))
+
+	_, err = svc.GetMember(ctx, room.ID, uuid.New())
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = svc.GetMember(ctx, uuid.New(), owner)
+	assert.ErrorIs(t, err, ErrRoomNotFound)
+
+	// Only the owner deletes the room
+	assert.ErrorIs(t, svc.DeleteRoom(ctx, room.ID, moderator), ErrForbidden)
+	assert.ErrorIs(t, svc.DeleteRoom(ctx, uuid.New(), owner), ErrRoomNotFound)
+	require.NoError(t, svc.DeleteRoom(ctx, room.ID, owner))
+}
+
+func TestJoinRequestApproval(t *testing.T) {
+	svc, roomRepo, _ := newTestRoomService(t)
+	ctx := context.Background()
+
+	admin := uuid.New()
+	applicant := uuid.New()
+	room := &model.Room{Name: "private", Type: "group", CreatedBy: admin, RequireApproval: true}
+	require.NoError(t, roomRepo.Create(ctx, room))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: admin, Role: "admin"}))
+
+	request, err := svc.JoinRoom(ctx, room.ID, applicant)
+	require.NoError(t, err)
+	require.NotNil(t, request)
+	assert.Equal(t, model.JoinRequestPending, request.Status)
+
+	// Asking again returns the same pending request
+	again, err := svc.JoinRoom(ctx, room.ID, applicant)
+	require.NoError(t, err)
+	assert.Equal(t, request.ID, again.ID)
+
+	isMember, err := roomRepo.IsUserInRoom(ctx, room.ID, applicant)
+	require.NoError(t, err)
+	assert.False(t, isMember)
+
+	_, err = svc.GetJoinRequests(ctx, room.ID, applicant)
+	assert.ErrorIs(t, err, ErrForbidden)
+	requests, err := svc.GetJoinRequests(ctx, room.ID, admin)
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	assert.Equal(t, applicant, requests[0].UserID)
+
+	// Requests can be looked up by ID within their room
+	byID, err := svc.GetJoinRequest(ctx, room.ID, request.ID, admin)
+	require.NoError(t, err)
+	assert.Equal(t, applicant, byID.UserID)
+	_, err = svc.GetJoinRequest(ctx, room.ID, request.ID, applicant)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = svc.GetJoinRequest(ctx, room.ID, uuid.New(), admin)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// A rejected user can ask again
+	require.NoError(t, svc.RejectJoinRequest(ctx, room.ID, applicant, admin))
+	assert.ErrorIs(t, svc.ApproveJoinRequest(ctx, room.ID, applicant, admin), ErrNotFound)
+
+	reopened, err := svc.JoinRoom(ctx, room.ID, applicant)
+	require.NoError(t, err)
+	assert.Equal(t, request.ID, reopened.ID)
+	assert.Equal(t, model.JoinRequestPending, reopened.Status)
+	assert.Nil(t, reopened.RespondedBy)
+
+	assert.ErrorIs(t, svc.ApproveJoinRequest(ctx, room.ID, applicant, applicant), ErrForbidden)
+	require.NoError(t, svc.ApproveJoinRequest(ctx, room.ID, applicant, admin))
+
+	isMember, err = roomRepo.IsUserInRoom(ctx, room.ID, applicant)
+	require.NoError(t, err)
+	assert.True(t, isMember)
+
+	stored, err := roomRepo.GetJoinRequest(ctx, room.ID, applicant)
+	require.NoError(t, err)
+	assert.Equal(t, model.JoinRequestApproved, stored.Status)
+	require.NotNil(t, stored.RespondedBy)
+	assert.Equal(t, admin, *stored.RespondedBy)
+
+	requests, err = svc.GetJoinRequests(ctx, room.ID, admin)
+	require.NoError(t, err)
+	assert.Empty(t, requests)
+
+	_, err = svc.JoinRoom(ctx, room.ID, applicant)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+}
+
+func TestMuteMemberBlocksPosting(t *testing.T) {
+	svc, roomRepo, _ := newTestRoomService(t)
+	ctx := context.Background()
+
+	admin, member := uuid.New(), uuid.New()
+	room := &model.Room{Name: "muted", Type: "group", CreatedBy: admin}
+	require.NoError(t, roomRepo.Create(ctx, room))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: admin, Role: "admin"}))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: member, Role: "member"}))
+
+	require.NoError(t, svc.CanPost(ctx, room.ID, member))
+	assert.ErrorIs(t, svc.CanPost(ctx, room.ID, uuid.New()), ErrForbidden)
+
+	_, err := svc.MuteMember(ctx, room.ID, admin, member, &model.MuteMemberRequest{Muted: true})
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = svc.MuteMember(ctx, room.ID, admin, admin, &model.MuteMemberRequest{Muted: true})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	muted, err := svc.MuteMember(ctx, room.ID, member, admin, &model.MuteMemberRequest{Muted: true})
+	require.NoError(t, err)
+	assert.True(t, muted.IsMuted)
+	assert.Nil(t, muted.MutedUntil)
+	err = svc.CanPost(ctx, room.ID, member)
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.Contains(t, err.Error(), "you are muted")
+
+	// Timed mutes name their end and lift by themselves
+	muted, err = svc.MuteMember(ctx, room.ID, member, admin, &model.MuteMemberRequest{Muted: true, Duration: 60})
+	require.NoError(t, err)
+	require.NotNil(t, muted.MutedUntil)
+	assert.Contains(t, svc.CanPost(ctx, room.ID, member).Error(), "until")
+	past := time.Now().Add(-time.Minute)
+	require.NoError(t, roomRepo.SetMemberMuted(ctx, room.ID, member, true, &past))
+	assert.NoError(t, svc.CanPost(ctx, room.ID, member))
+
+	_, err = svc.MuteMember(ctx, room.ID, member, admin, &model.MuteMemberRequest{Muted: false})
+	require.NoError(t, err)
+	require.NoError(t, svc.CanPost(ctx, room.ID, member))
+
+	// Muting the whole room leaves admins able to post
+	room.MuteAllMembers = true
+	require.NoError(t, roomRepo.Update(ctx, room))
+	assert.Contains(t, svc.CanPost(ctx, room.ID, member).Error(), "all members are muted")
+	assert.NoError(t, svc.CanPost(ctx, room.ID, admin))
+}
+
+func TestMaxMembersLimit(t *testing.T) {
+	svc, roomRepo, _ := newTestRoomService(t)
+	ctx := context.Background()
+
+	admin := uuid.New()
+	room := &model.Room{Name: "limited", Type: "group", CreatedBy: admin, MaxMembers: 2}
+	require.NoError(t, roomRepo.Create(ctx, room))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: admin, Role: "admin"}))
+
+	_, err := svc.JoinRoom(ctx, room.ID, uuid.New())
+	require.NoError(t, err)
+
+	_, err = svc.JoinRoom(ctx, room.ID, uuid.New())
+	assert.ErrorIs(t, err, ErrRoomFull)
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.ErrorIs(t, svc.AddMember(ctx, room.ID, uuid.New(), admin), ErrRoomFull)
+
+	_, err = svc.UpdateRoom(ctx, room.ID, &model.UpdateRoomRequest{MaxMembers: 1}, admin)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	// Approving a request for a full room leaves it pending
+	applicant := uuid.New()
+	room.RequireApproval = true
+	require.NoError(t, roomRepo.Update(ctx, room))
+	_, err = svc.JoinRoom(ctx, room.ID, applicant)
+	require.NoError(t, err)
+	assert.ErrorIs(t, svc.ApproveJoinRequest(ctx, room.ID, applicant, admin), ErrRoomFull)
+
+	request, err := roomRepo.GetJoinRequest(ctx, room.ID, applicant)
+	require.NoError(t, err)
+	assert.Equal(t, model.JoinRequestPending, request.Status)
+
+	_, err = svc.UpdateRoom(ctx, room.ID, &model.UpdateRoomRequest{MaxMembers: 3}, admin)
+	require.NoError(t, err)
+	require.NoError(t, svc.ApproveJoinRequest(ctx, room.ID, applicant, admin))
+
+	members, err := roomRepo.GetRoomMembers(ctx, room.ID)
+	require.NoError(t, err)
+	assert.Len(t, members, 3)
+}
+
+func TestUpdateRoomSettings(t *testing.T) {
+	svc, roomRepo, _ := newTestRoomService(t)
+	ctx := context.Background()
+
+	admin, member := uuid.New(), uuid.New()
+	room := &model.Room{Name: "settings", Description: "about", Type: "group", CreatedBy: admin}
+	require.NoError(t, roomRepo.Create(ctx, room))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: admin, Role: "admin"}))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: member, Role: "member"}))
+
+	on, empty, retention := true, "", 30
+	updated, err := svc.UpdateRoom(ctx, room.ID, &model.UpdateRoomRequest{
+		Description:          &empty,
+		MessageRetentionDays: &retention,
+		RequireApproval:      &on,
+		OnlyAdminCanPost:     &on,
+	}, admin)
+	require.NoError(t, err)
+	assert.Equal(t, "settings", updated.Name)
+	assert.Empty(t, updated.Description)
+	assert.Equal(t, 30, updated.MessageRetentionDays)
+	assert.True(t, updated.RequireApproval)
+	assert.True(t, updated.OnlyAdminCanPost)
+	assert.ErrorIs(t, svc.CanPost(ctx, room.ID, member), ErrForbidden)
+
+	_, err = svc.UpdateRoom(ctx, room.ID, &model.UpdateRoomRequest{MuteAllMembers: &on}, member)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	retention = 3651
+	_, err = svc.UpdateRoom(ctx, room.ID, &model.UpdateRoomRequest{MessageRetentionDays: &retention}, admin)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	blank := "  "
+	_, err = svc.UpdateRoom(ctx, room.ID, &model.UpdateRoomRequest{Name: &blank}, admin)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+}
+
+func TestRoomTags(t *testing.T) {
+	svc, _, db := newTestRoomService(t)
+	ctx := context.Background()
+
+	userIDs := createTestUsers(t, db, 1)
+	public := true
+	golang, err := svc.CreateRoom(ctx, &model.CreateRoomRequest{Name: "gophers", Type: "public", IsPublic: &public, Tags: []string{"#Go", "music", " go "}}, userIDs[0])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "music"}, golang.Tags)
+	_, err = svc.CreateRoom(ctx, &model.CreateRoomRequest{Name: "tour", Type: "public", IsPublic: &public, Tags: []string{"go"}}, userIDs[0])
+	require.NoError(t, err)
+	// Tags of private rooms aren't listed
+	secret, err := svc.CreateRoom(ctx, &model.CreateRoomRequest{Name: "secret", Type: "group", Tags: []string{"go", "secret"}}, userIDs[0])
+	require.NoError(t, err)
+	require.NoError(t, db.DB.Model(&model.Room{}).Where("id = ?", secret.ID).Update("is_public", false).Error)
+
+	tooMany := make([]string, maxRoomTags+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("tag%d", i)
+	}
+	_, err = svc.CreateRoom(ctx, &model.CreateRoomRequest{Name: "noisy", Type: "group", Tags: tooMany}, userIDs[0])
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	tags, err := svc.ListRoomTags(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []model.RoomTagCount{{Tag: "go", Count: 2}, {Tag: "music", Count: 1}}, tags)
+
+	rooms, meta, err := svc.SearchRooms(ctx, "", []string{"MUSIC", "jazz"}, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, rooms, 1)
+	assert.Equal(t, golang.ID, rooms[0].ID)
+	assert.Equal(t, []string{"go", "music"}, rooms[0].Tags)
+	assert.Equal(t, 1, meta.Total)
+
+	// An empty list clears the tags, leaving them out alone keeps them
+	name := "gophers!"
+	updated, err := svc.UpdateRoom(ctx, golang.ID, &model.UpdateRoomRequest{Name: &name}, userIDs[0])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "music"}, updated.Tags)
+	updated, err = svc.UpdateRoom(ctx, golang.ID, &model.UpdateRoomRequest{Tags: []string{}}, userIDs[0])
+	require.NoError(t, err)
+	assert.Empty(t, updated.Tags)
+
+	rooms, _, err = svc.SearchRooms(ctx, "", []string{"music"}, 1, 10)
+	require.NoError(t, err)
+	assert.Empty(t, rooms)
+}
+
+func TestBroadcastRoomRestrictsPosting(t *testing.T) {
+	svc, roomRepo, _ := newTestRoomService(t)
+	ctx := context.Background()
+
+	admin, member := uuid.New(), uuid.New()
+	room, err := svc.CreateRoom(ctx, &model.CreateRoomRequest{Name: "announcements", Type: "broadcast"}, admin)
+	require.NoError(t, err)
+	assert.True(t, room.OnlyAdminCanPost)
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: member, Role: "member"}))
+
+	assert.NoError(t, svc.CanPost(ctx, room.ID, admin))
+	assert.ErrorIs(t, svc.CanPost(ctx, room.ID, member), ErrForbidden)
+
+	off := false
+	_, err = svc.UpdateRoom(ctx, room.ID, &model.UpdateRoomRequest{OnlyAdminCanPost: &off}, admin)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	loaded, err := roomRepo.GetByID(ctx, room.ID)
+	require.NoError(t, err)
+	assert.True(t, loaded.OnlyAdminCanPost)
+}
+
+func TestGetRoomMembersPaginated(t *testing.T) {
+	svc, roomRepo, _ := newTestRoomService(t)
+	ctx := context.Background()
+
+	owner := uuid.New()
+	room := &model.Room{Name: "crowd", Type: "group", CreatedBy: owner}
+	require.NoError(t, roomRepo.Create(ctx, room))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: owner, Role: "owner", JoinedAt: time.Now().Add(-time.Hour)}))
+	for i := 0; i < 4; i++ {
+		require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: uuid.New(), Role: "member", JoinedAt: time.Now().Add(time.Duration(i) * time.Minute)}))
+	}
+
+	// Rooms come with a member count instead of their members
+	loaded, err := roomRepo.GetByID(ctx, room.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), loaded.MemberCount)
+	assert.Empty(t, loaded.Members)
+
+	members, meta, err := svc.GetRoomMembers(ctx, room.ID, owner, "", "", 1, 2)
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+	assert.Equal(t, owner, members[0].UserID)
+	assert.Equal(t, 5, meta.Total)
+	assert.True(t, meta.HasMore)
+
+	members, meta, err = svc.GetRoomMembers(ctx, room.ID, owner, "", "", 3, 2)
+	require.NoError(t, err)
+	assert.Len(t, members, 1)
+	assert.False(t, meta.HasMore)
+
+	members, meta, err = svc.GetRoomMembers(ctx, room.ID, owner, "member", "", 1, 20)
+	require.NoError(t, err)
+	assert.Len(t, members, 4)
+	assert.Equal(t, 4, meta.Total)
+
+	room.IsPublic = false
+	require.NoError(t, roomRepo.Update(ctx, room))
+	_, _, err = svc.GetRoomMembers(ctx, room.ID, uuid.New(), "", "", 1, 20)
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestSuggestMembers(t *testing.T) {
+	svc, roomRepo, db := newTestRoomService(t)
+	ctx := context.Background()
+
+	users := createTestUsers(t, db, 5)
+	for i, username := range []string{"alice", "Alfred", "al_x", "bob", "outsider"} {
+		require.NoError(t, db.DB.Model(&model.User{}).Where("id = ?", users[i]).Updates(map[string]interface{}{
+			"username": username, "first_name": "First", "last_name": "Last",
+		}).Error)
+	}
+	require.NoError(t, db.DB.Create(&model.UserProfile{UserID: users[0], DisplayName: "Alice L."}).Error)
+
+	room := &model.Room{Name: "crowd", Type: "group", CreatedBy: users[0]}
+	require.NoError(t, roomRepo.Create(ctx, room))
+	for _, userID := range users[:4] {
+		require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: userID, Role: "member"}))
+	}
+
+	suggestions, err := svc.SuggestMembers(ctx, room.ID, users[3], "@AL")
+	require.NoError(t, err)
+	require.Len(t, suggestions, 3)
+	assert.Equal(t, model.MemberSuggestion{UserID: users[0], Username: "alice", DisplayName: "Alice L."}, suggestions[2])
+	assert.Equal(t, []string{"al_x", "Alfred", "alice"}, []string{suggestions[0].Username, suggestions[1].Username, suggestions[2].Username})
+	assert.Equal(t, "First Last", suggestions[0].DisplayName)
+
+	// Wildcards match literally
+	suggestions, err = svc.SuggestMembers(ctx, room.ID, users[3], "al_")
+	require.NoError(t, err)
+	require.Len(t, suggestions, 1)
+	assert.Equal(t, "al_x", suggestions[0].Username)
+
+	// Suggestions are cached for a minute
+	require.NoError(t, roomRepo.RemoveMember(ctx, room.ID, users[2]))
+	suggestions, err = svc.SuggestMembers(ctx, room.ID, users[3], "al_")
+	require.NoError(t, err)
+	assert.Len(t, suggestions, 1)
+
+	_, err = svc.SuggestMembers(ctx, room.ID, users[4], "al")
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestRoomWebhooks(t *testing.T) {
+	svc, roomRepo, _ := newTestRoomService(t)
+	ctx := context.Background()
+
+	previousDelay := webhookRetryDelay
+	webhookRetryDelay = time.Millisecond
+	t.Cleanup(func() { webhookRetryDelay = previousDelay })
+
+	type delivery struct {
+		event     string
+		signature string
+		body      []byte
+	}
+	deliveries := make(chan delivery, 10)
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt fails so the delivery is retried
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{r.Header.Get(WebhookEventHeader), r.Header.Get(WebhookSignatureHeader), body}
+	}))
+	t.Cleanup(server.Close)
+
+	admin, member := uuid.New(), uuid.New()
+	room := &model.Room{Name: "hooks", Type: "group", CreatedBy: admin}
+	require.NoError(t, roomRepo.Create(ctx, room))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: admin, Role: "admin"}))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: member, Role: "member"}))
+
+	req := &model.CreateWebhookRequest{URL: server.URL, Events: []string{events.MessageSend}}
+	_, err := svc.CreateWebhook(ctx, room.ID, member, req)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = svc.CreateWebhook(ctx, room.ID, admin, &model.CreateWebhookRequest{URL: server.URL, Events: []string{events.UserOnline}})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	webhook, err := svc.CreateWebhook(ctx, room.ID, admin, req)
+	require.NoError(t, err)
+	assert.Len(t, webhook.Secret, 64)
+
+	webhooks, err := svc.ListWebhooks(ctx, room.ID, admin)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	assert.Equal(t, []string{events.MessageSend}, webhooks[0].Events)
+	assert.Empty(t, webhooks[0].Secret)
+
+	// Events the webhook doesn't subscribe to aren't delivered
+	require.NoError(t, svc.DeliverWebhooks(ctx, &events.Event{Type: events.RoomUpdate, RoomID: &room.ID}))
+	require.NoError(t, svc.DeliverWebhooks(ctx, &events.Event{ID: "evt-1", Type: events.MessageSend, RoomID: &room.ID}))
+
+	select {
+	case got := <-deliveries:
+		assert.Equal(t, events.MessageSend, got.event)
+		assert.Equal(t, WebhookSignature(webhook.Secret, got.body), got.signature)
+		assert.Contains(t, string(got.body), `"id":"evt-1"`)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+	assert.Equal(t, int32(2), attempts.Load())
+
+	require.NoError(t, svc.DeleteWebhook(ctx, room.ID, webhook.ID, admin))
+	assert.ErrorIs(t, svc.DeleteWebhook(ctx, room.ID, webhook.ID, admin), ErrNotFound)
+}
+
+func TestAdminOnlyRoomActions(t *testing.T) {
+	logger.Init("fatal", "json", "stdout", "")
+	ctx := context.Background()
+
+	name := "renamed"
+	actions := []struct {
+		name string
+		run  func(svc RoomService, roomID, target, caller uuid.UUID) error
+	}{
+		{"update room", func(svc RoomService, roomID, _, caller uuid.UUID) error {
+			_, err := svc.UpdateRoom(ctx, roomID, &model.UpdateRoomRequest{Name: &name}, caller)
+			return err
+		}},
+		{"add member", func(svc RoomService, roomID, _, caller uuid.UUID) error {
+			return svc.AddMember(ctx, roomID, uuid.New(), caller)
+		}},
+		{"remove member", func(svc RoomService, roomID, target, caller uuid.UUID) error {
+			return svc.RemoveMember(ctx, roomID, target, caller)
+		}},
+		{"update member role", func(svc RoomService, roomID, target, caller uuid.UUID) error {
+			return svc.UpdateMemberRole(ctx, roomID, target, caller, "moderator")
+		}},
+		{"ban member", func(svc RoomService, roomID, target, caller uuid.UUID) error {
+			_, err := svc.BanMember(ctx, roomID, target, caller, &model.BanMemberRequest{})
+			return err
+		}},
+		{"mute member", func(svc RoomService, roomID, target, caller uuid.UUID) error {
+			_, err := svc.MuteMember(ctx, roomID, target, caller, &model.MuteMemberRequest{Muted: true})
+			return err
+		}},
+	}
+	callers := []struct {
+		role    string
+		allowed bool
+	}{
+		{"owner", true},
+		{"admin", true},
+		{"moderator", false},
+		{"member", false},
+		{"", false},
+	}
+
+	for _, action := range actions {
+		for _, caller := range callers {
+			name := action.name + " as " + caller.role
+			if caller.role == "" {
+				name = action.name + " as non-member"
+			}
+			t.Run(name, func(t *testing.T) {
+				roomRepo := newMockRoomRepository()
+				svc := NewRoomService(roomRepo, nil, newTestRedis(t))
+
+				callerID, target := uuid.New(), uuid.New()
+				roles := map[uuid.UUID]string{uuid.New(): "owner", target: "member"}
+				if caller.role != "" {
+					roles[callerID] = caller.role
+				}
+				room := &model.Room{Name: "permissions", Type: "group"}
+				roomRepo.addRoom(room, roles)
+
+				err := action.run(svc, room.ID, target, callerID)
+				if caller.allowed {
+					assert.NoError(t, err)
+					assert.Equal(t, 1, roomRepo.writes)
+				} else {
+					assert.ErrorIs(t, err, ErrForbidden)
+					assert.Zero(t, roomRepo.writes)
+				}
+			})
+		}
+	}
+}
+
+func TestBannedUserCannotRejoin(t *testing.T) {
+	svc, roomRepo, _ := newTestRoomService(t)
+	ctx := context.Background()
+
+	admin, member := uuid.New(), uuid.New()
+	room := &model.Room{Name: "public", Type: "group", CreatedBy: admin, IsPublic: true}
+	require.NoError(t, roomRepo.Create(ctx, room))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: admin, Role: "admin"}))
+	_, err := svc.JoinRoom(ctx, room.ID, member)
+	require.NoError(t, err)
+
+	_, err = svc.BanMember(ctx, room.ID, admin, member, &model.BanMemberRequest{})
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = svc.BanMember(ctx, room.ID, admin, admin, &model.BanMemberRequest{})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	ban, err := svc.BanMember(ctx, room.ID, member, admin, &model.BanMemberRequest{Reason: "spam"})
+	require.NoError(t, err)
+	assert.Nil(t, ban.ExpiresAt)
+
+	isMember, err := roomRepo.IsUserInRoom(ctx, room.ID, member)
+	require.NoError(t, err)
+	assert.False(t, isMember)
+
+	_, err = svc.JoinRoom(ctx, room.ID, member)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	// Banning again replaces the ban
+	again, err := svc.BanMember(ctx, room.ID, member, admin, &model.BanMemberRequest{Duration: 60})
+	require.NoError(t, err)
+	assert.Equal(t, ban.ID, again.ID)
+	require.NotNil(t, again.ExpiresAt)
+
+	bans, err := svc.GetRoomBans(ctx, room.ID, admin)
+	require.NoError(t, err)
+	require.Len(t, bans, 1)
+	assert.Equal(t, member, bans[0].UserID)
+	_, err = svc.GetRoomBans(ctx, room.ID, member)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	// Expired bans are ignored
+	past := time.Now().Add(-time.Minute)
+	require.NoError(t, roomRepo.BanUser(ctx, &model.RoomBan{RoomID: room.ID, UserID: member, BannedBy: admin, ExpiresAt: &past}))
+	bans, err = svc.GetRoomBans(ctx, room.ID, admin)
+	require.NoError(t, err)
+	assert.Empty(t, bans)
+	_, err = svc.JoinRoom(ctx, room.ID, member)
+	require.NoError(t, err)
+
+	// Lifting a ban lets the user back in
+	_, err = svc.BanMember(ctx, room.ID, member, admin, &model.BanMemberRequest{})
+	require.NoError(t, err)
+	require.NoError(t, svc.UnbanMember(ctx, room.ID, member, admin))
+	assert.ErrorIs(t, svc.UnbanMember(ctx, room.ID, member, admin), ErrNotFound)
+	_, err = svc.JoinRoom(ctx, room.ID, member)
+	require.NoError(t, err)
+}
+
+func TestRoomInvites(t *testing.T) {
+	svc, roomRepo, _ := newTestRoomService(t)
+	ctx := context.Background()
+
+	admin, invitee, other := uuid.New(), uuid.New(), uuid.New()
+	room := &model.Room{Name: "private", Type: "group", CreatedBy: admin}
+	require.NoError(t, roomRepo.Create(ctx, room))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: admin, Role: "admin"}))
+
+	// Direct invites can only be used by their invitee
+	direct, err := svc.CreateInvite(ctx, room.ID, admin, &model.CreateInviteRequest{InviteeID: &invitee})
+	require.NoError(t, err)
+	_, err = svc.AcceptInvite(ctx, direct.InviteCode, other)
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.ErrorIs(t, svc.RejectInvite(ctx, direct.InviteCode, other), ErrForbidden)
+	_, err = svc.AcceptInvite(ctx, direct.InviteCode, invitee)
+	require.NoError(t, err)
+
+	// Shareable invites count their uses up to MaxUses
+	shared, err := svc.CreateInvite(ctx, room.ID, admin, &model.CreateInviteRequest{MaxUses: 1})
+	require.NoError(t, err)
+	_, err = svc.AcceptInvite(ctx, shared.InviteCode, other)
+	require.NoError(t, err)
+	_, err = svc.AcceptInvite(ctx, shared.InviteCode, uuid.New())
+	assert.ErrorIs(t, err, ErrConflict)
+
+	invites, err := svc.GetRoomInvites(ctx, room.ID, admin)
+	require.NoError(t, err)
+	require.Len(t, invites, 2)
+	byID := map[uuid.UUID]model.RoomInvite{}
+	for _, invite := range invites {
+		byID[invite.ID] = invite
+	}
+	assert.Equal(t, model.InviteStatusAccepted, byID[direct.ID].Status)
+	assert.Equal(t, 1, byID[direct.ID].UsedCount)
+	assert.Equal(t, model.InviteStatusPending, byID[shared.ID].Status)
+	assert.Equal(t, 1, byID[shared.ID].UsedCount)
+	_, err = svc.GetRoomInvites(ctx, room.ID, other)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	// Revoked invites can't be used
+	leaked, err := svc.CreateInvite(ctx, room.ID, admin, &model.CreateInviteRequest{})
+	require.NoError(t, err)
+	assert.ErrorIs(t, svc.RevokeInvite(ctx, room.ID, leaked.ID, other), ErrForbidden)
+	require.NoError(t, svc.RevokeInvite(ctx, room.ID, leaked.ID, admin))
+	assert.ErrorIs(t, svc.RevokeInvite(ctx, room.ID, leaked.ID, admin), ErrNotFound)
+	_, err = svc.AcceptInvite(ctx, leaked.InviteCode, uuid.New())
+	assert.ErrorIs(t, err, ErrConflict)
+}
+
+func TestRoomStats(t *testing.T) {
+	svc, roomRepo, db := newTestRoomService(t)
+	ctx := context.Background()
+
+	admin, member := uuid.New(), uuid.New()
+	room := &model.Room{Name: "stats", Type: "group", CreatedBy: admin}
+	require.NoError(t, roomRepo.Create(ctx, room))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: admin, Role: "owner"}))
+	require.NoError(t, roomRepo.AddMember(ctx, &model.RoomMember{RoomID: room.ID, UserID: member, Role: "member"}))
+
+	now := time.Now()
+	messages := []model.Message{
+		{BaseModel: model.BaseModel{ID: uuid.New(), CreatedAt: now.Add(-time.Hour)}, RoomID: room.ID, SenderID: admin, Type: "text"},
+		{BaseModel: model.BaseModel{ID: uuid.New(), CreatedAt: now.Add(-3 * 24 * time.Hour)}, RoomID: room.ID, SenderID: member, Type: "text"},
+		{BaseModel: model.BaseModel{ID: uuid.New(), CreatedAt: now.Add(-20 * 24 * time.Hour)}, RoomID: room.ID, SenderID: member, Type: "text"},
+		{BaseModel: model.BaseModel{ID: uuid.New(), CreatedAt: now.Add(-60 * 24 * time.Hour)}, RoomID: room.ID, SenderID: admin, Type: "text"},
+	}
+	require.NoError(t, db.DB.Create(&messages).Error)
+	require.NoError(t, db.DB.Create(&[]model.MessageReaction{
+		{MessageID: messages[0].ID, UserID: admin, Emoji: "👍"},
+		{MessageID: messages[0].ID, UserID: member, Emoji: "👍"},
+		{MessageID: messages[1].ID, UserID: admin, Emoji: "🎉"},
+	}).Error)
+
+	_, err := svc.GetRoomStats(ctx, room.ID, member)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	stats, err := svc.GetRoomStats(ctx, room.ID, admin)
+	require.NoError(t, err)
+	assert.Equal(t, model.RoomMessageCounts{Total: 4, Last24h: 1, Last7d: 2, Last30d: 3, ActiveSenders7d: 2}, stats.Messages)
+	assert.Equal(t, map[string]int64{"owner": 1, "member": 1}, stats.MembersByRole)
+	assert.Equal(t, []model.ReactionCount{{Emoji: "👍", Count: 2}, {Emoji: "🎉", Count: 1}}, stats.TopReactions)
+
+	// Message counts are served from the cache until it expires
+	require.NoError(t, db.DB.Create(&model.Message{RoomID: room.ID, SenderID: admin, Type: "text"}).Error)
+	stats, err = svc.GetRoomStats(ctx, room.ID, admin)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), stats.Messages.Total)
+}
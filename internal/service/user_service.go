@@ -1,19 +1,32 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
+	"image/png"
 	"strings"
+	"time"
 
+	"realtime-api/internal/email"
+	"realtime-api/internal/events"
+	"realtime-api/internal/jwt"
 	"realtime-api/internal/logger"
 	"realtime-api/internal/model"
+	"realtime-api/internal/redis"
 	"realtime-api/internal/repository"
+	"realtime-api/internal/tracing"
 
 	"github.com/google/uuid"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
 	"golang.org/x/crypto/argon2"
 )
 
@@ -21,26 +34,99 @@ type UserService interface {
 	CreateUser(ctx context.Context, req *model.CreateUserRequest) (*model.User, error)
 	GetUserByID(ctx context.Context, id uuid.UUID) (*model.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
-	UpdateUser(ctx context.Context, user *model.User) error
+	UpdateUser(ctx context.Context, actorID, userID uuid.UUID, req *model.UpdateUserRequest) (*model.User, error)
 	DeleteUser(ctx context.Context, id uuid.UUID) error
+	SetUserActive(ctx context.Context, id uuid.UUID, active bool) error
 	ListUsers(ctx context.Context, page, limit int) ([]*model.User, *model.PaginationMeta, error)
-	AuthenticateUser(ctx context.Context, req *model.LoginRequest) (*model.User, error)
+	SearchUsers(ctx context.Context, query string, filters model.UserSearchFilter, page, limit int) ([]*model.User, *model.PaginationMeta, error)
+	AuthenticateUser(ctx context.Context, req *model.LoginRequest) (*model.LoginResponse, error)
+	RefreshSession(ctx context.Context, refreshToken string) (string, time.Time, *jwt.Claims, error)
+	ListSessions(ctx context.Context, userID uuid.UUID) ([]model.UserSession, error)
+	RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error
+	RegisterFCMToken(ctx context.Context, userID, sessionID uuid.UUID, token string) error
+	Logout(ctx context.Context, token string) error
+	ChangePassword(ctx context.Context, userID, sessionID uuid.UUID, req *model.ChangePasswordRequest) error
+	ForgotPassword(ctx context.Context, email, ip string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	EnableTOTP(ctx context.Context, userID uuid.UUID) (*model.TOTPSetupResponse, error)
+	VerifyTOTP(ctx context.Context, userID uuid.UUID, code string) error
+	DisableTOTP(ctx context.Context, userID uuid.UUID, code string) error
+	ValidateTwoFactorLogin(ctx context.Context, req *model.TwoFactorLoginRequest) (*model.LoginResponse, error)
 	UpdateUserStatus(ctx context.Context, userID uuid.UUID, status model.UserStatus) error
+	SetUserStatus(ctx context.Context, userID uuid.UUID, status model.UserStatus) (*model.User, error)
 	GetUserProfile(ctx context.Context, userID uuid.UUID) (*model.UserProfile, error)
-	UpdateUserProfile(ctx context.Context, profile *model.UserProfile) error
+	GetUserSettings(ctx context.Context, userID uuid.UUID) (*model.UserSettings, error)
+	UpdateUserSettings(ctx context.Context, userID uuid.UUID, req *model.UpdateUserSettingsRequest) (*model.UserSettings, error)
+	GetPublicProfile(ctx context.Context, viewerID, userID uuid.UUID) (*model.PublicUserProfile, error)
+	UpdateUserProfile(ctx context.Context, userID uuid.UUID, req *model.UpdateProfileRequest) (*model.UserProfile, error)
+	SendContactRequest(ctx context.Context, userID, contactID uuid.UUID) (*model.UserContact, error)
+	AcceptContactRequest(ctx context.Context, userID, requestID uuid.UUID) (*model.UserContact, error)
+	RejectContactRequest(ctx context.Context, userID, requestID uuid.UUID) error
+	GetPendingRequests(ctx context.Context, userID uuid.UUID) ([]model.UserContact, error)
+	ListContacts(ctx context.Context, userID uuid.UUID, status model.ContactStatus) ([]model.UserContact, error)
+	UpdateContact(ctx context.Context, userID, id uuid.UUID, req *model.UpdateContactRequest) (*model.UserContact, error)
+	RemoveContact(ctx context.Context, userID, id uuid.UUID) error
+	BlockUser(ctx context.Context, userID, blockedID uuid.UUID, reason string) (*model.UserBlock, error)
+	UnblockUser(ctx context.Context, userID, blockedID uuid.UUID) error
+	ListBlockedUsers(ctx context.Context, userID uuid.UUID) ([]model.UserBlock, error)
+	BlockedUserIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
 }
 
+const (
+	// passwordResetTTL is how long a password reset token stays valid
+	passwordResetTTL = time.Hour
+	// passwordResetWindow is the window the reset requests are limited over
+	passwordResetWindow = time.Hour
+	// maxPasswordResetsPerEmail is how many resets an email may request per
+	// window
+	maxPasswordResetsPerEmail = 3
+	// maxPasswordResetsPerIP is how many resets an IP address may request per
+	// window
+	maxPasswordResetsPerIP = 10
+)
+
+const (
+	// totpIssuer names the service in authenticator apps
+	totpIssuer = "realtime-api"
+	// totpPeriod is how long a two-factor code is valid, in seconds
+	totpPeriod = 30
+	// totpQRCodeSize is the width and height of the setup QR code in pixels
+	totpQRCodeSize = 256
+	// twoFactorLoginTTL is how long a login waits for its two-factor code
+	twoFactorLoginTTL = 5 * time.Minute
+	// maxTwoFactorAttempts is how many wrong codes end a two-factor login
+	maxTwoFactorAttempts = 5
+)
+
 type userService struct {
 	userRepo repository.UserRepository
+	// credentials reads users from the database for the password hash and
+	// two-factor secret, which the user cache leaves out
+	credentials    repository.UserRepository
+	sessionRepo    repository.SessionRepository
+	redis          *redis.Redis
+	mailer         email.Sender
+	eventPublisher *events.EventPublisher
+	// now is the clock two-factor codes are checked against
+	now func() time.Time
 }
 
-func NewUserService(userRepo repository.UserRepository) UserService {
+func NewUserService(userRepo repository.UserRepository, sessionRepo repository.SessionRepository, redis *redis.Redis, mailer email.Sender) UserService {
 	return &userService{
-		userRepo: userRepo,
+		userRepo:       userRepo,
+		credentials:    repository.Uncached(userRepo),
+		sessionRepo:    sessionRepo,
+		redis:          redis,
+		mailer:         mailer,
+		eventPublisher: events.NewEventPublisher(redis),
+		now:            time.Now,
 	}
 }
 
-func (s *userService) CreateUser(ctx context.Context, req *model.CreateUserRequest) (*model.User, error) {
+func (s *userService) CreateUser(ctx context.Context, req *model.CreateUserRequest) (_ *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.CreateUser")
+	defer func() { tracing.End(span, err) }()
+
 	// Check if user already exists
 	existingUser, err := s.userRepo.GetByEmail(ctx, req.Email)
 	if err != nil {
@@ -101,7 +187,10 @@ func (s *userService) CreateUser(ctx context.Context, req *model.CreateUserReque
 	return user, nil
 }
 
-func (s *userService) GetUserByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
+func (s *userService) GetUserByID(ctx context.Context, id uuid.UUID) (_ *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.GetUserByID", tracing.ID("id", id))
+	defer func() { tracing.End(span, err) }()
+
 	user, err := s.userRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
@@ -112,7 +201,10 @@ func (s *userService) GetUserByID(ctx context.Context, id uuid.UUID) (*model.Use
 	return user, nil
 }
 
-func (s *userService) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+func (s *userService) GetUserByEmail(ctx context.Context, email string) (_ *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.GetUserByEmail")
+	defer func() { tracing.End(span, err) }()
+
 	user, err := s.userRepo.GetByEmail(ctx, email)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
@@ -123,16 +215,88 @@ func (s *userService) GetUserByEmail(ctx context.Context, email string) (*model.
 	return user, nil
 }
 
-func (s *userService) UpdateUser(ctx context.Context, user *model.User) error {
+// UpdateUser changes the fields set in req on the account of userID. Users
+// can only change their own account, except for admins who can also
+// (de)activate accounts. Changing the email address has to be verified again.
+func (s *userService) UpdateUser(ctx context.Context, actorID, userID uuid.UUID, req *model.UpdateUserRequest) (_ *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.UpdateUser", tracing.ID("actor_id", actorID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	actor, err := s.userRepo.GetByID(ctx, actorID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	isAdmin := actor != nil && actor.IsActive && actor.IsAdmin
+	if actorID != userID && !isAdmin {
+		return nil, fmt.Errorf("%w: cannot update another user", ErrForbidden)
+	}
+	if req.IsActive != nil && !isAdmin {
+		return nil, fmt.Errorf("%w: only admins can change whether an account is active", ErrForbidden)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	if req.Username != nil && *req.Username != user.Username {
+		existing, err := s.userRepo.GetByUsername(ctx, *req.Username)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check existing username: %w", err)
+		}
+		if existing != nil {
+			return nil, ErrUsernameTaken
+		}
+		user.Username = *req.Username
+	}
+	if req.Email != nil && !strings.EqualFold(*req.Email, user.Email) {
+		existing, err := s.userRepo.GetByEmail(ctx, *req.Email)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check existing user: %w", err)
+		}
+		if existing != nil {
+			return nil, ErrEmailTaken
+		}
+		user.Email = *req.Email
+		user.IsVerified = false
+	}
+	if req.FirstName != nil {
+		user.FirstName = *req.FirstName
+	}
+	if req.LastName != nil {
+		user.LastName = *req.LastName
+	}
+	if req.Bio != nil {
+		user.Bio = *req.Bio
+	}
+	if req.Avatar != nil {
+		user.Avatar = *req.Avatar
+	}
+	if req.PhoneNumber != nil {
+		user.PhoneNumber = *req.PhoneNumber
+	}
+	if req.IsActive != nil {
+		user.IsActive = *req.IsActive
+	}
+
 	if err := s.userRepo.Update(ctx, user); err != nil {
-		return fmt.Errorf("failed to update user: %w", err)
+		return nil, fmt.Errorf("failed to update user: %w", err)
 	}
 
-	logger.Info("User updated successfully", logger.WithField("user_id", user.ID))
-	return nil
+	logger.Info("User updated successfully", logger.WithFields(map[string]interface{}{
+		"user_id":  user.ID,
+		"actor_id": actorID,
+	}))
+	return user, nil
 }
 
-func (s *userService) DeleteUser(ctx context.Context, id uuid.UUID) error {
+func (s *userService) DeleteUser(ctx context.Context, id uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.user.DeleteUser", tracing.ID("id", id))
+	defer func() { tracing.End(span, err) }()
+
 	if err := s.userRepo.Delete(ctx, id); err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
@@ -141,7 +305,50 @@ func (s *userService) DeleteUser(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-func (s *userService) ListUsers(ctx context.Context, page, limit int) ([]*model.User, *model.PaginationMeta, error) {
+// SetUserActive activates or deactivates an account. Deactivated users can't
+// log in and lose their sessions.
+func (s *userService) SetUserActive(ctx context.Context, id uuid.UUID, active bool) (err error) {
+	ctx, span := tracing.Start(ctx, "service.user.SetUserActive", tracing.ID("id", id))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	if user.IsActive == active {
+		return nil
+	}
+
+	if err := s.userRepo.UpdateActive(ctx, id, active); err != nil {
+		return err
+	}
+
+	if !active {
+		sessions, err := s.sessionRepo.GetActiveByUserID(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to list sessions: %w", err)
+		}
+		for _, session := range sessions {
+			if err := s.RevokeSession(ctx, id, session.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	logger.Info("User active state changed", logger.WithFields(map[string]interface{}{
+		"user_id":   id,
+		"is_active": active,
+	}))
+	return nil
+}
+
+func (s *userService) ListUsers(ctx context.Context, page, limit int) (_ []*model.User, _ *model.PaginationMeta, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.ListUsers")
+	defer func() { tracing.End(span, err) }()
+
 	if page < 1 {
 		page = 1
 	}
@@ -158,21 +365,51 @@ func (s *userService) ListUsers(ctx context.Context, page, limit int) ([]*model.
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to list users: %w", err)
 	}
+	for _, user := range users {
+		user.Status = user.VisibleStatus()
+	}
+
+	return users, newPaginationMeta(page, limit, total), nil
+}
+
+func (s *userService) SearchUsers(ctx context.Context, query string, filters model.UserSearchFilter, page, limit int) (_ []*model.User, _ *model.PaginationMeta, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.SearchUsers")
+	defer func() { tracing.End(span, err) }()
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, nil, fmt.Errorf("%w: search query is required", ErrInvalidArgument)
+	}
+
+	if filters.Status != "" {
+		switch model.UserStatus(filters.Status) {
+		case model.UserStatusOnline, model.UserStatusOffline, model.UserStatusAway, model.UserStatusBusy:
+		default:
+			return nil, nil, fmt.Errorf("%w: invalid status filter: %s", ErrInvalidArgument, filters.Status)
+		}
+	}
+
+	page, limit = normalizePage(page, limit)
+	offset := (page - 1) * limit
 
-	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+	users, total, err := s.userRepo.Search(ctx, query, filters, offset, limit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to search users: %w", err)
+	}
 
-	meta := &model.PaginationMeta{
-		Page:       page,
-		Limit:      limit,
-		Total:      int(total),
-		TotalPages: totalPages,
+	// Invisible users appear offline to everyone else
+	for _, user := range users {
+		user.Status = user.VisibleStatus()
 	}
 
-	return users, meta, nil
+	return users, newPaginationMeta(page, limit, total), nil
 }
 
-func (s *userService) AuthenticateUser(ctx context.Context, req *model.LoginRequest) (*model.User, error) {
-	user, err := s.userRepo.GetByEmail(ctx, req.Email)
+func (s *userService) AuthenticateUser(ctx context.Context, req *model.LoginRequest) (_ *model.LoginResponse, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.AuthenticateUser")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := s.credentials.GetByEmail(ctx, req.Email)
 	if err != nil {
 		return nil, fmt.Errorf("authentication failed: %w", err)
 	}
@@ -192,6 +429,15 @@ func (s *userService) AuthenticateUser(ctx context.Context, req *model.LoginRequ
 		return nil, fmt.Errorf("invalid credentials")
 	}
 
+	if user.TOTPEnabled {
+		return s.startTwoFactorLogin(ctx, user, req)
+	}
+
+	return s.loggedIn(ctx, user, req)
+}
+
+// loggedIn starts the session of a user who passed authentication
+func (s *userService) loggedIn(ctx context.Context, user *model.User, req *model.LoginRequest) (*model.LoginResponse, error) {
 	// Update last seen
 	if err := s.userRepo.UpdateLastSeen(ctx, user.ID); err != nil {
 		logger.Warn("Failed to update last seen", logger.WithField("user_id", user.ID))
@@ -202,75 +448,1328 @@ func (s *userService) AuthenticateUser(ctx context.Context, req *model.LoginRequ
 		"email":   user.Email,
 	}))
 
-	return user, nil
+	return s.createSession(ctx, user, req)
 }
 
-func (s *userService) UpdateUserStatus(ctx context.Context, userID uuid.UUID, status model.UserStatus) error {
-	if err := s.userRepo.UpdateStatus(ctx, userID, status); err != nil {
-		return fmt.Errorf("failed to update user status: %w", err)
+// twoFactorLogin is a login awaiting its two-factor code
+type twoFactorLogin struct {
+	UserID     uuid.UUID `json:"user_id"`
+	DeviceID   string    `json:"device_id"`
+	DeviceType string    `json:"device_type"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+}
+
+// startTwoFactorLogin holds a login with a correct password until the user
+// sends a code of their authenticator app along with the returned token
+func (s *userService) startTwoFactorLogin(ctx context.Context, user *model.User, req *model.LoginRequest) (*model.LoginResponse, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate two-factor token: %w", err)
 	}
+	token := hex.EncodeToString(tokenBytes)
 
-	logger.Info("User status updated", logger.WithFields(map[string]interface{}{
-		"user_id": userID,
-		"status":  status,
-	}))
+	login, err := json.Marshal(twoFactorLogin{
+		UserID:     user.ID,
+		DeviceID:   req.DeviceID,
+		DeviceType: req.DeviceType,
+		IPAddress:  req.IPAddress,
+		UserAgent:  req.UserAgent,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode two-factor login: %w", err)
+	}
+	if err := s.redis.SetTwoFactorChallenge(ctx, token, string(login), twoFactorLoginTTL); err != nil {
+		return nil, fmt.Errorf("failed to store two-factor login: %w", err)
+	}
+
+	return &model.LoginResponse{
+		User:           *user,
+		ExpiresAt:      time.Now().Add(twoFactorLoginTTL),
+		Requires2FA:    true,
+		TwoFactorToken: token,
+	}, nil
+}
+
+// ValidateTwoFactorLogin completes a login with the code of the user's
+// authenticator app. Too many wrong codes end the login.
+func (s *userService) ValidateTwoFactorLogin(ctx context.Context, req *model.TwoFactorLoginRequest) (_ *model.LoginResponse, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.ValidateTwoFactorLogin")
+	defer func() { tracing.End(span, err) }()
+
+	stored, err := s.redis.GetTwoFactorChallenge(ctx, req.TwoFactorToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get two-factor login: %w", err)
+	}
+	if stored == "" {
+		return nil, fmt.Errorf("%w: invalid or expired two-factor token", ErrUnauthorized)
+	}
+	var login twoFactorLogin
+	if err := json.Unmarshal([]byte(stored), &login); err != nil {
+		return nil, fmt.Errorf("failed to decode two-factor login: %w", err)
+	}
+
+	user, err := s.credentials.GetByID(ctx, login.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil || !user.IsActive || !user.TOTPEnabled {
+		return nil, fmt.Errorf("%w: invalid or expired two-factor token", ErrUnauthorized)
+	}
+
+	valid, err := s.useTOTPCode(ctx, user, req.Code)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		attempts, err := s.redis.AddTwoFactorAttempt(ctx, req.TwoFactorToken, twoFactorLoginTTL)
+		if err == nil && attempts >= maxTwoFactorAttempts {
+			if err := s.redis.DeleteTwoFactorChallenge(ctx, req.TwoFactorToken); err != nil {
+				logger.Warn("Failed to end two-factor login", logger.WithField("error", err.Error()))
+			}
+		}
+		logger.Warn("Failed two-factor login attempt", logger.WithFields(map[string]interface{}{
+			"user_id": user.ID,
+			"ip":      login.IPAddress,
+		}))
+		return nil, fmt.Errorf("%w: invalid two-factor code", ErrUnauthorized)
+	}
+
+	if err := s.redis.DeleteTwoFactorChallenge(ctx, req.TwoFactorToken); err != nil {
+		return nil, fmt.Errorf("failed to end two-factor login: %w", err)
+	}
+
+	return s.loggedIn(ctx, user, &model.LoginRequest{
+		Email:      user.Email,
+		DeviceID:   login.DeviceID,
+		DeviceType: login.DeviceType,
+		IPAddress:  login.IPAddress,
+		UserAgent:  login.UserAgent,
+	})
+}
+
+// createSession issues a token pair for the user and records it as a session
+// for the device in the login request
+func (s *userService) createSession(ctx context.Context, user *model.User, req *model.LoginRequest) (*model.LoginResponse, error) {
+	jwtService := jwt.GetService()
+	if jwtService == nil {
+		return nil, fmt.Errorf("JWT service not initialized")
+	}
+
+	sessionID := uuid.New()
+	accessToken, refreshToken, expiresAt, err := jwtService.GenerateTokens(user, sessionID, req.DeviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate tokens: %w", err)
+	}
+
+	session := &model.UserSession{
+		UserID:       user.ID,
+		DeviceID:     req.DeviceID,
+		DeviceType:   req.DeviceType,
+		IPAddress:    req.IPAddress,
+		UserAgent:    req.UserAgent,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    time.Now().Add(jwtService.RefreshTokenTTL()),
+		IsActive:     true,
+	}
+	session.ID = sessionID
+
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	recordActivity(&model.ActivityLog{
+		UserID:       &user.ID,
+		ActivityType: ActivityLogin,
+		Description:  "Logged in",
+		IPAddress:    req.IPAddress,
+		UserAgent:    req.UserAgent,
+	}, map[string]interface{}{"session_id": sessionID, "device_type": req.DeviceType})
+
+	return &model.LoginResponse{
+		User:         *user,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+		SessionID:    sessionID,
+	}, nil
+}
+
+// RefreshSession issues a new access token for the session the refresh token
+// belongs to, as long as that session hasn't been revoked
+func (s *userService) RefreshSession(ctx context.Context, refreshToken string) (_ string, _ time.Time, _ *jwt.Claims, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.RefreshSession")
+	defer func() { tracing.End(span, err) }()
+
+	jwtService := jwt.GetService()
+	if jwtService == nil {
+		return "", time.Time{}, nil, fmt.Errorf("JWT service not initialized")
+	}
+
+	claims, err := jwtService.ValidateToken(refreshToken)
+	if err != nil {
+		return "", time.Time{}, nil, fmt.Errorf("%w: invalid refresh token", ErrInvalidArgument)
+	}
+
+	session, err := s.sessionRepo.GetByID(ctx, claims.SessionID)
+	if err != nil {
+		return "", time.Time{}, nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	if session == nil || !session.IsActive || session.UserID != claims.UserID {
+		return "", time.Time{}, nil, fmt.Errorf("%w: session has been revoked", ErrForbidden)
+	}
+
+	accessToken, expiresAt, err := jwtService.RefreshAccessToken(refreshToken)
+	if err != nil {
+		return "", time.Time{}, nil, fmt.Errorf("%w: %s", ErrInvalidArgument, err.Error())
+	}
+
+	// Keep the current access token on the session so revoking it blocks this one
+	if err := s.sessionRepo.UpdateAccessToken(ctx, session.ID, accessToken); err != nil {
+		return "", time.Time{}, nil, err
+	}
+
+	return accessToken, expiresAt, claims, nil
+}
+
+func (s *userService) ListSessions(ctx context.Context, userID uuid.UUID) (_ []model.UserSession, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.ListSessions", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	sessions, err := s.sessionRepo.GetActiveByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession deactivates one of the user's sessions and blacklists its
+// tokens until they expire on their own
+func (s *userService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.user.RevokeSession", tracing.ID("user_id", userID), tracing.ID("session_id", sessionID))
+	defer func() { tracing.End(span, err) }()
+
+	session, err := s.sessionRepo.GetByID(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+	if session == nil || session.UserID != userID {
+		return fmt.Errorf("%w: session not found", ErrNotFound)
+	}
+	if !session.IsActive {
+		return nil
+	}
+
+	if err := s.sessionRepo.Deactivate(ctx, session.ID); err != nil {
+		return err
+	}
 
+	if err := s.blacklistTokens(ctx, session.AccessToken, session.RefreshToken); err != nil {
+		return err
+	}
+
+	logger.Info("Session revoked", logger.WithFields(map[string]interface{}{
+		"user_id":    userID,
+		"session_id": sessionID,
+	}))
 	return nil
 }
 
-func (s *userService) GetUserProfile(ctx context.Context, userID uuid.UUID) (*model.UserProfile, error) {
-	profile, err := s.userRepo.GetUserProfile(ctx, userID)
+// RegisterFCMToken stores the push notification token of the device of a
+// session
+func (s *userService) RegisterFCMToken(ctx context.Context, userID, sessionID uuid.UUID, token string) (err error) {
+	ctx, span := tracing.Start(ctx, "service.user.RegisterFCMToken", tracing.ID("user_id", userID), tracing.ID("session_id", sessionID))
+	defer func() { tracing.End(span, err) }()
+
+	session, err := s.sessionRepo.GetByID(ctx, sessionID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user profile: %w", err)
+		return fmt.Errorf("failed to get session: %w", err)
 	}
-	if profile == nil {
-		return nil, fmt.Errorf("user profile not found")
+	if session == nil || session.UserID != userID || !session.IsActive {
+		return fmt.Errorf("%w: session not found", ErrNotFound)
 	}
-	return profile, nil
+
+	return s.sessionRepo.UpdateFCMToken(ctx, sessionID, token)
 }
 
-func (s *userService) UpdateUserProfile(ctx context.Context, profile *model.UserProfile) error {
-	if err := s.userRepo.CreateOrUpdateProfile(ctx, profile); err != nil {
-		return fmt.Errorf("failed to update user profile: %w", err)
+// Logout ends the session of the given access token
+func (s *userService) Logout(ctx context.Context, token string) (err error) {
+	ctx, span := tracing.Start(ctx, "service.user.Logout")
+	defer func() { tracing.End(span, err) }()
+
+	claims, err := jwt.GetService().ValidateToken(token)
+	if err != nil {
+		return fmt.Errorf("%w: invalid token", ErrInvalidArgument)
 	}
 
-	logger.Info("User profile updated", logger.WithField("user_id", profile.UserID))
+	// Tokens without a stored session are still blocked
+	err = s.RevokeSession(ctx, claims.UserID, claims.SessionID)
+	if errors.Is(err, ErrNotFound) {
+		err = s.blacklistTokens(ctx, token)
+	}
+	if err != nil {
+		return err
+	}
+
+	recordActivity(&model.ActivityLog{
+		UserID:       &claims.UserID,
+		ActivityType: ActivityLogout,
+		Description:  "Logged out",
+	}, map[string]interface{}{"session_id": claims.SessionID})
 	return nil
 }
 
-// Password hashing using Argon2
-func hashPassword(password string) (string, error) {
-	salt := make([]byte, 16)
-	if _, err := rand.Read(salt); err != nil {
-		return "", err
+// blacklistTokens blocks the IDs of tokens for the rest of their lifetime.
+// The tokens of a session share its ID, so the entry lasts until the last of
+// them expires. Tokens that already expired are rejected by validation and
+// need no entry.
+func (s *userService) blacklistTokens(ctx context.Context, tokens ...string) error {
+	expiries := make(map[string]time.Time)
+	for _, token := range tokens {
+		claims, err := jwt.GetService().ValidateToken(token)
+		if err != nil || claims.ExpiresAt == nil || claims.ID == "" {
+			continue
+		}
+		if claims.ExpiresAt.Time.After(expiries[claims.ID]) {
+			expiries[claims.ID] = claims.ExpiresAt.Time
+		}
 	}
 
-	hash := argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, 32)
+	for tokenID, expiresAt := range expiries {
+		ttl := time.Until(expiresAt).Round(time.Second) + time.Second
+		if err := s.redis.BlacklistToken(ctx, tokenID, ttl); err != nil {
+			return fmt.Errorf("failed to blacklist token: %w", err)
+		}
+	}
+	return nil
+}
 
-	// Encode salt and hash as base64
-	saltB64 := base64.StdEncoding.EncodeToString(salt)
-	hashB64 := base64.StdEncoding.EncodeToString(hash)
+// ChangePassword replaces the password of a user who knows their current
+// one. Their other sessions are signed out; sessionID is kept.
+func (s *userService) ChangePassword(ctx context.Context, userID, sessionID uuid.UUID, req *model.ChangePasswordRequest) (err error) {
+	ctx, span := tracing.Start(ctx, "service.user.ChangePassword", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
 
-	return fmt.Sprintf("%s:%s", saltB64, hashB64), nil
+	user, err := s.credentials.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+
+	if !verifyPassword(req.CurrentPassword, user.Password) {
+		return fmt.Errorf("%w: current password is incorrect", ErrForbidden)
+	}
+	if req.NewPassword == req.CurrentPassword {
+		return fmt.Errorf("%w: new password must differ from the current one", ErrInvalidArgument)
+	}
+
+	hashedPassword, err := hashPassword(req.NewPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := s.userRepo.UpdatePassword(ctx, userID, hashedPassword); err != nil {
+		return err
+	}
+
+	// A pending reset would let the old password's owner take over again
+	if _, err := s.redis.DeletePasswordResetToken(ctx, userID.String()); err != nil {
+		return fmt.Errorf("failed to delete reset token: %w", err)
+	}
+
+	revoked, err := s.revokeSessions(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Password changed", logger.WithFields(map[string]interface{}{
+		"user_id":          userID,
+		"revoked_sessions": revoked,
+	}))
+	recordActivity(&model.ActivityLog{
+		UserID:       &userID,
+		ActivityType: ActivityPasswordChange,
+		Description:  "Changed password",
+	}, map[string]interface{}{"revoked_sessions": revoked})
+	return nil
 }
 
-func verifyPassword(password, hashedPassword string) bool {
-	parts := strings.Split(hashedPassword, ":")
-	if len(parts) != 2 {
-		return false
+// ForgotPassword emails a password reset token to the user with the given
+// email. Unknown emails succeed too, so the endpoint can't be used to find
+// out who has an account. Requests are limited per email and per IP address.
+func (s *userService) ForgotPassword(ctx context.Context, emailAddress, ip string) (err error) {
+	ctx, span := tracing.Start(ctx, "service.user.ForgotPassword")
+	defer func() { tracing.End(span, err) }()
+
+	emailAddress = strings.ToLower(strings.TrimSpace(emailAddress))
+	if err := s.limitPasswordResets(ctx, "ip:"+ip, maxPasswordResetsPerIP); err != nil {
+		return err
+	}
+	if err := s.limitPasswordResets(ctx, "email:"+emailAddress, maxPasswordResetsPerEmail); err != nil {
+		return err
 	}
 
-	salt, err := base64.StdEncoding.DecodeString(parts[0])
+	user, err := s.userRepo.GetByEmail(ctx, emailAddress)
 	if err != nil {
-		return false
+		return fmt.Errorf("failed to get user by email: %w", err)
+	}
+	if user == nil || !user.IsActive {
+		return nil
 	}
 
-	hash, err := base64.StdEncoding.DecodeString(parts[1])
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("failed to generate reset token: %w", err)
+	}
+	token := user.ID.String() + "." + hex.EncodeToString(secret)
+
+	if err := s.redis.SetPasswordResetToken(ctx, user.ID.String(), hashResetSecret(secret), passwordResetTTL); err != nil {
+		return fmt.Errorf("failed to store reset token: %w", err)
+	}
+
+	// Sending in the background keeps the response time the same for
+	// unknown emails
+	body := fmt.Sprintf("Someone asked to reset the password of your account.\n\n"+
+		"Use this token to choose a new password within %d minutes:\n\n%s\n\n"+
+		"If it wasn't you, you can ignore this email.", int(passwordResetTTL.Minutes()), token)
+	go func() {
+		if err := s.mailer.Send(user.Email, "Reset your password", body); err != nil {
+			logger.Error("Failed to send password reset email", logger.WithFields(map[string]interface{}{
+				"user_id": user.ID,
+				"error":   err.Error(),
+			}))
+		}
+	}()
+
+	logger.Info("Password reset requested", logger.WithField("user_id", user.ID))
+	return nil
+}
+
+// limitPasswordResets counts a reset request under key, failing with a
+// RateLimitError once it made more than limit requests in the window
+func (s *userService) limitPasswordResets(ctx context.Context, key string, limit int64) error {
+	count, retryAfter, err := s.redis.AddPasswordResetRequest(ctx, key, passwordResetWindow)
 	if err != nil {
-		return false
+		return fmt.Errorf("failed to check reset limit: %w", err)
 	}
+	if count > limit {
+		return &RateLimitError{RetryAfter: retryAfter}
+	}
+	return nil
+}
 
-	testHash := argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, 32)
+// ResetPassword sets a new password for the user a reset token was issued
+// to and signs them out everywhere
+func (s *userService) ResetPassword(ctx context.Context, token, newPassword string) (err error) {
+	ctx, span := tracing.Start(ctx, "service.user.ResetPassword")
+	defer func() { tracing.End(span, err) }()
 
-	return subtle.ConstantTimeCompare(hash, testHash) == 1
+	invalid := fmt.Errorf("%w: invalid or expired reset token", ErrInvalidArgument)
+
+	userIDStr, secretHex, ok := strings.Cut(token, ".")
+	if !ok {
+		return invalid
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return invalid
+	}
+	secret, err := hex.DecodeString(secretHex)
+	if err != nil {
+		return invalid
+	}
+
+	stored, err := s.redis.GetPasswordResetToken(ctx, userID.String())
+	if err != nil {
+		return fmt.Errorf("failed to get reset token: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(stored), []byte(hashResetSecret(secret))) != 1 {
+		return invalid
+	}
+
+	// Only the request that deletes the token may use it
+	deleted, err := s.redis.DeletePasswordResetToken(ctx, userID.String())
+	if err != nil {
+		return fmt.Errorf("failed to delete reset token: %w", err)
+	}
+	if !deleted {
+		return invalid
+	}
+
+	hashedPassword, err := hashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := s.userRepo.UpdatePassword(ctx, userID, hashedPassword); err != nil {
+		return err
+	}
+
+	revoked, err := s.revokeSessions(ctx, userID, uuid.Nil)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Password reset", logger.WithFields(map[string]interface{}{
+		"user_id":          userID,
+		"revoked_sessions": revoked,
+	}))
+	recordActivity(&model.ActivityLog{
+		UserID:       &userID,
+		ActivityType: ActivityPasswordReset,
+		Description:  "Reset password",
+	}, map[string]interface{}{"revoked_sessions": revoked})
+	return nil
+}
+
+// revokeSessions signs the user out of all their sessions but keep,
+// returning how many were revoked
+func (s *userService) revokeSessions(ctx context.Context, userID, keep uuid.UUID) (int, error) {
+	sessions, err := s.sessionRepo.GetActiveByUserID(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	revoked := 0
+	for _, session := range sessions {
+		if session.ID == keep {
+			continue
+		}
+		if err := s.RevokeSession(ctx, userID, session.ID); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+// hashResetSecret hashes the secret of a reset token for storage, so a leak
+// of Redis doesn't leak usable tokens
+func hashResetSecret(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:])
+}
+
+// EnableTOTP generates a new two-factor secret for the user. Two-factor
+// authentication is enabled once VerifyTOTP accepts a code of the secret.
+func (s *userService) EnableTOTP(ctx context.Context, userID uuid.UUID) (_ *model.TOTPSetupResponse, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.EnableTOTP", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("%w: two-factor authentication is already enabled", ErrConflict)
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate two-factor secret: %w", err)
+	}
+	image, err := key.Image(totpQRCodeSize, totpQRCodeSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate QR code: %w", err)
+	}
+	var qrCode bytes.Buffer
+	if err := png.Encode(&qrCode, image); err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+
+	if err := s.userRepo.UpdateTOTP(ctx, userID, key.Secret(), false); err != nil {
+		return nil, err
+	}
+
+	return &model.TOTPSetupResponse{
+		Secret:          key.Secret(),
+		ProvisioningURI: key.URL(),
+		QRCode:          "data:image/png;base64," + base64.StdEncoding.EncodeToString(qrCode.Bytes()),
+	}, nil
+}
+
+// VerifyTOTP checks a code of the user's two-factor secret, enabling
+// two-factor authentication on the first correct code after EnableTOTP
+func (s *userService) VerifyTOTP(ctx context.Context, userID uuid.UUID, code string) (err error) {
+	ctx, span := tracing.Start(ctx, "service.user.VerifyTOTP", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := s.checkTOTP(ctx, userID, code)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabled {
+		return nil
+	}
+
+	if err := s.userRepo.UpdateTOTP(ctx, userID, user.TOTPSecret, true); err != nil {
+		return err
+	}
+	logger.Info("Two-factor authentication enabled", logger.WithField("user_id", userID))
+	return nil
+}
+
+// DisableTOTP turns two-factor authentication off, which takes a current code
+func (s *userService) DisableTOTP(ctx context.Context, userID uuid.UUID, code string) (err error) {
+	ctx, span := tracing.Start(ctx, "service.user.DisableTOTP", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := s.checkTOTP(ctx, userID, code)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return fmt.Errorf("%w: two-factor authentication is not enabled", ErrInvalidArgument)
+	}
+
+	if err := s.userRepo.UpdateTOTP(ctx, userID, "", false); err != nil {
+		return err
+	}
+	logger.Info("Two-factor authentication disabled", logger.WithField("user_id", userID))
+	return nil
+}
+
+// checkTOTP returns the user when code is a current code of their secret
+func (s *userService) checkTOTP(ctx context.Context, userID uuid.UUID, code string) (*model.User, error) {
+	user, err := s.credentials.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if user.TOTPSecret == "" {
+		return nil, fmt.Errorf("%w: two-factor authentication is not set up", ErrInvalidArgument)
+	}
+	valid, err := s.useTOTPCode(ctx, user, code)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, fmt.Errorf("%w: invalid two-factor code", ErrInvalidArgument)
+	}
+	return user, nil
+}
+
+// useTOTPCode reports whether code is a code of the user's secret for the
+// current time step or the one before or after it, allowing for clock drift.
+// A code is accepted once: the step of the last accepted code is recorded,
+// and codes for it or an earlier step are rejected.
+func (s *userService) useTOTPCode(ctx context.Context, user *model.User, code string) (bool, error) {
+	now := s.now()
+	for _, skew := range []int64{0, -1, 1} {
+		at := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+		valid, err := totp.ValidateCustom(code, user.TOTPSecret, at, totp.ValidateOpts{
+			Period:    totpPeriod,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil || !valid {
+			continue
+		}
+		return s.userRepo.UseTOTPStep(ctx, user.ID, at.Unix()/totpPeriod)
+	}
+	return false, nil
+}
+
+func (s *userService) UpdateUserStatus(ctx context.Context, userID uuid.UUID, status model.UserStatus) (err error) {
+	ctx, span := tracing.Start(ctx, "service.user.UpdateUserStatus", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.userRepo.UpdateStatus(ctx, userID, status); err != nil {
+		return fmt.Errorf("failed to update user status: %w", err)
+	}
+
+	logger.Info("User status updated", logger.WithFields(map[string]interface{}{
+		"user_id": userID,
+		"status":  status,
+	}))
+
+	return nil
+}
+
+// SetUserStatus saves the status userID picked and announces it. The
+// presence key tracks whether the user is around, so only going offline
+// clears it; the presence event carries the status everyone else sees.
+func (s *userService) SetUserStatus(ctx context.Context, userID uuid.UUID, status model.UserStatus) (_ *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.SetUserStatus", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	switch status {
+	case model.UserStatusOnline, model.UserStatusOffline, model.UserStatusAway, model.UserStatusBusy, model.UserStatusInvisible:
+	default:
+		return nil, fmt.Errorf("%w: invalid status: %s", ErrInvalidArgument, status)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	if err := s.UpdateUserStatus(ctx, userID, status); err != nil {
+		return nil, err
+	}
+	user.Status = string(status)
+
+	if status == model.UserStatusOffline {
+		err = s.redis.SetUserOffline(ctx, userID.String())
+	} else {
+		err = s.redis.SetUserOnline(ctx, userID.String())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update presence: %w", err)
+	}
+
+	s.publishPresence(ctx, user)
+	return user, nil
+}
+
+// publishPresence announces the status of user as others see it, so
+// invisible users and users hiding their online status go offline
+func (s *userService) publishPresence(ctx context.Context, user *model.User) {
+	metadata := map[string]interface{}{
+		"username": user.Username,
+	}
+	if err := s.eventPublisher.PublishPresenceEvent(ctx, user.ID, user.VisibleStatus(), metadata); err != nil {
+		logger.Error("Failed to publish presence event", logger.WithFields(map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		}))
+	}
+}
+
+// GetUserProfile returns the profile of userID, empty for users registered
+// before profiles were kept
+func (s *userService) GetUserProfile(ctx context.Context, userID uuid.UUID) (_ *model.UserProfile, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.GetUserProfile", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	profile, err := s.userRepo.GetUserProfile(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user profile: %w", err)
+	}
+	if profile == nil {
+		profile = &model.UserProfile{UserID: userID, FirstName: user.FirstName, LastName: user.LastName}
+	}
+	return profile, nil
+}
+
+// GetPublicProfile returns what viewerID may see of the profile of userID
+func (s *userService) GetPublicProfile(ctx context.Context, viewerID, userID uuid.UUID) (_ *model.PublicUserProfile, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.GetPublicProfile", tracing.ID("viewer_id", viewerID), tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	if viewerID != userID {
+		blocked, err := isBlockedBetween(ctx, s.userRepo, s.redis, viewerID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if blocked {
+			return nil, ErrUserNotFound
+		}
+	}
+
+	profile, err := s.GetUserProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &model.PublicUserProfile{
+		UserID:      profile.UserID,
+		DisplayName: profile.DisplayName,
+		Bio:         profile.Bio,
+		Location:    profile.Location,
+		Website:     profile.Website,
+		Company:     profile.Company,
+		JobTitle:    profile.JobTitle,
+	}, nil
+}
+
+// UpdateUserProfile applies the fields set in req to the profile of userID
+// and lets the user's contacts know so they can refresh the display name
+func (s *userService) UpdateUserProfile(ctx context.Context, userID uuid.UUID, req *model.UpdateProfileRequest) (_ *model.UserProfile, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.UpdateUserProfile", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	profile, err := s.GetUserProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	setProfileField(&profile.DisplayName, req.DisplayName)
+	setProfileField(&profile.Bio, req.Bio)
+	setProfileField(&profile.Location, req.Location)
+	setProfileField(&profile.Website, req.Website)
+	setProfileField(&profile.Company, req.Company)
+	setProfileField(&profile.JobTitle, req.JobTitle)
+	setProfileField(&profile.Gender, req.Gender)
+	if req.DateOfBirth != nil {
+		profile.DateOfBirth = nil
+		if *req.DateOfBirth != "" {
+			dateOfBirth, err := time.Parse("2006-01-02", *req.DateOfBirth)
+			if err != nil {
+				return nil, fmt.Errorf("%w: date_of_birth must be formatted as YYYY-MM-DD", ErrInvalidArgument)
+			}
+			if dateOfBirth.After(time.Now()) {
+				return nil, fmt.Errorf("%w: date_of_birth can't be in the future", ErrInvalidArgument)
+			}
+			profile.DateOfBirth = &dateOfBirth
+		}
+	}
+
+	if err := s.userRepo.CreateOrUpdateProfile(ctx, profile); err != nil {
+		return nil, fmt.Errorf("failed to update user profile: %w", err)
+	}
+
+	s.publishProfileUpdate(ctx, profile)
+
+	logger.Info("User profile updated", logger.WithField("user_id", profile.UserID))
+	return profile, nil
+}
+
+// GetUserSettings returns the account settings of userID
+func (s *userService) GetUserSettings(ctx context.Context, userID uuid.UUID) (_ *model.UserSettings, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.GetUserSettings", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user.Settings(), nil
+}
+
+// UpdateUserSettings changes the settings set in req
+func (s *userService) UpdateUserSettings(ctx context.Context, userID uuid.UUID, req *model.UpdateUserSettingsRequest) (_ *model.UserSettings, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.UpdateUserSettings", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	settings, err := s.GetUserSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Language != "" {
+		settings.Language = req.Language
+	}
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalidArgument, req.Timezone)
+		}
+		settings.Timezone = req.Timezone
+	}
+	if req.NotificationSound != nil {
+		settings.NotificationSound = *req.NotificationSound
+	}
+	if req.EmailNotifications != nil {
+		settings.EmailNotifications = *req.EmailNotifications
+	}
+	if req.PushNotifications != nil {
+		settings.PushNotifications = *req.PushNotifications
+	}
+	showedOnlineStatus := settings.ShowOnlineStatus
+	if req.ShowOnlineStatus != nil {
+		settings.ShowOnlineStatus = *req.ShowOnlineStatus
+	}
+	if req.ShowReadReceipts != nil {
+		settings.ShowReadReceipts = *req.ShowReadReceipts
+	}
+	if req.AllowDirectMessages != nil {
+		settings.AllowDirectMessages = *req.AllowDirectMessages
+	}
+	if req.AutoJoinPublicRooms != nil {
+		settings.AutoJoinPublicRooms = *req.AutoJoinPublicRooms
+	}
+
+	if err := s.userRepo.UpdateSettings(ctx, userID, settings); err != nil {
+		return nil, err
+	}
+
+	logger.Info("User settings updated", logger.WithField("user_id", userID))
+
+	// Hiding or showing the online status changes what others see
+	if settings.ShowOnlineStatus != showedOnlineStatus {
+		if user, err := s.userRepo.GetByID(ctx, userID); err == nil && user != nil {
+			s.publishPresence(ctx, user)
+		}
+	}
+	return settings, nil
+}
+
+// setProfileField overwrites field when the request set a value for it
+func setProfileField(field *string, value *string) {
+	if value != nil {
+		*field = strings.TrimSpace(*value)
+	}
+}
+
+// publishProfileUpdate sends the public profile of a user to their accepted
+// contacts
+func (s *userService) publishProfileUpdate(ctx context.Context, profile *model.UserProfile) {
+	contacts, err := s.userRepo.GetUserContacts(ctx, profile.UserID, model.ContactStatusAccepted)
+	if err != nil {
+		logger.Error("Failed to list contacts for profile update", logger.WithFields(map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": profile.UserID,
+		}))
+		return
+	}
+
+	contactIDs := make([]string, len(contacts))
+	for i, contact := range contacts {
+		contactIDs[i] = contact.ContactID.String()
+	}
+	eventData := events.UserEventData(profile.UserID, map[string]interface{}{
+		"display_name": profile.DisplayName,
+		"contact_ids":  contactIDs,
+	})
+	if err := s.eventPublisher.PublishUserEvent(ctx, events.UserProfileUpdate, profile.UserID, eventData); err != nil {
+		logger.Error("Failed to publish profile update event", logger.WithFields(map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": profile.UserID,
+		}))
+	}
+}
+
+// Password hashing using Argon2
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	hash := argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, 32)
+
+	// Encode salt and hash as base64
+	saltB64 := base64.StdEncoding.EncodeToString(salt)
+	hashB64 := base64.StdEncoding.EncodeToString(hash)
+
+	return fmt.Sprintf("%s:%s", saltB64, hashB64), nil
+}
+
+func verifyPassword(password, hashedPassword string) bool {
+	parts := strings.Split(hashedPassword, ":")
+	if len(parts) != 2 {
+		return false
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+
+	hash, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+
+	testHash := argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, 32)
+
+	return subtle.ConstantTimeCompare(hash, testHash) == 1
+}
+
+// SendContactRequest asks contactID to become a contact of userID. A request
+// that was rejected before can be sent again.
+func (s *userService) SendContactRequest(ctx context.Context, userID, contactID uuid.UUID) (_ *model.UserContact, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.SendContactRequest", tracing.ID("user_id", userID), tracing.ID("contact_id", contactID))
+	defer func() { tracing.End(span, err) }()
+
+	if userID == contactID {
+		return nil, fmt.Errorf("%w: cannot add yourself as a contact", ErrInvalidArgument)
+	}
+
+	target, err := s.userRepo.GetByID(ctx, contactID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if target == nil {
+		return nil, ErrUserNotFound
+	}
+
+	// A block on either side stops the request without revealing who blocked whom
+	blocked, err := isBlockedBetween(ctx, s.userRepo, s.redis, userID, contactID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrUserUnavailable
+	}
+
+	reverse, err := s.userRepo.GetContact(ctx, contactID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if reverse != nil {
+		switch reverse.Status {
+		case model.ContactStatusBlocked:
+			return nil, ErrUserUnavailable
+		case model.ContactStatusPending:
+			return nil, fmt.Errorf("%w: this user already sent you a contact request", ErrInvalidArgument)
+		}
+	}
+
+	existing, err := s.userRepo.GetContact(ctx, userID, contactID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		switch existing.Status {
+		case model.ContactStatusAccepted:
+			return nil, fmt.Errorf("%w: user is already a contact", ErrInvalidArgument)
+		case model.ContactStatusPending:
+			return nil, fmt.Errorf("%w: contact request already sent", ErrInvalidArgument)
+		case model.ContactStatusBlocked:
+			return nil, fmt.Errorf("%w: cannot send a contact request to a blocked user", ErrInvalidArgument)
+		}
+
+		if err := s.userRepo.UpdateContactStatus(ctx, userID, contactID, model.ContactStatusPending); err != nil {
+			return nil, err
+		}
+		existing.Status = model.ContactStatusPending
+	}
+
+	contact := existing
+	if contact == nil {
+		contact = &model.UserContact{
+			UserID:    userID,
+			ContactID: contactID,
+			Status:    model.ContactStatusPending,
+		}
+		if err := s.userRepo.AddContact(ctx, contact); err != nil {
+			return nil, err
+		}
+	}
+
+	// The recipient is notified through the event
+	eventData := events.UserEventData(userID, map[string]interface{}{
+		"contact_id": contactID,
+		"request_id": contact.ID,
+	})
+	if err := s.eventPublisher.PublishUserEvent(ctx, events.UserContactRequest, userID, eventData); err != nil {
+		logger.Error("Failed to publish contact request event", logger.WithFields(map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": contact.ID,
+		}))
+	}
+
+	logger.Info("Contact request sent", logger.WithFields(map[string]interface{}{
+		"user_id":    userID,
+		"contact_id": contactID,
+	}))
+	return contact, nil
+}
+
+// AcceptContactRequest accepts a request sent to userID and publishes the
+// event that opens a direct room between the two users
+func (s *userService) AcceptContactRequest(ctx context.Context, userID, requestID uuid.UUID) (_ *model.UserContact, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.AcceptContactRequest", tracing.ID("user_id", userID), tracing.ID("request_id", requestID))
+	defer func() { tracing.End(span, err) }()
+
+	request, err := s.getPendingRequest(ctx, userID, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.userRepo.AcceptContact(ctx, request); err != nil {
+		return nil, err
+	}
+
+	eventData := events.UserEventData(userID, map[string]interface{}{
+		"contact_id": request.UserID,
+		"request_id": request.ID,
+	})
+	if err := s.eventPublisher.PublishUserEvent(ctx, events.UserContactAccepted, userID, eventData); err != nil {
+		logger.Error("Failed to publish contact accepted event", logger.WithFields(map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": request.ID,
+		}))
+	}
+
+	logger.Info("Contact request accepted", logger.WithFields(map[string]interface{}{
+		"user_id":    userID,
+		"contact_id": request.UserID,
+	}))
+	return request, nil
+}
+
+// RejectContactRequest declines a request sent to userID
+func (s *userService) RejectContactRequest(ctx context.Context, userID, requestID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.user.RejectContactRequest", tracing.ID("user_id", userID), tracing.ID("request_id", requestID))
+	defer func() { tracing.End(span, err) }()
+
+	request, err := s.getPendingRequest(ctx, userID, requestID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.UpdateContactStatus(ctx, request.UserID, request.ContactID, model.ContactStatusRejected); err != nil {
+		return err
+	}
+
+	logger.Info("Contact request rejected", logger.WithFields(map[string]interface{}{
+		"user_id":    userID,
+		"contact_id": request.UserID,
+	}))
+	return nil
+}
+
+// GetPendingRequests lists the contact requests waiting for userID to answer
+func (s *userService) GetPendingRequests(ctx context.Context, userID uuid.UUID) (_ []model.UserContact, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.GetPendingRequests", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	return s.userRepo.GetPendingContactRequests(ctx, userID)
+}
+
+// ListContacts lists the contacts of userID, optionally only those with the
+// given status
+func (s *userService) ListContacts(ctx context.Context, userID uuid.UUID, status model.ContactStatus) (_ []model.UserContact, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.ListContacts", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	switch status {
+	case "", model.ContactStatusPending, model.ContactStatusAccepted, model.ContactStatusBlocked, model.ContactStatusRejected:
+	default:
+		return nil, fmt.Errorf("%w: invalid contact status %q", ErrInvalidArgument, status)
+	}
+
+	return s.userRepo.GetUserContacts(ctx, userID, status)
+}
+
+// UpdateContact changes the nickname and notes userID keeps about a contact
+func (s *userService) UpdateContact(ctx context.Context, userID, id uuid.UUID, req *model.UpdateContactRequest) (_ *model.UserContact, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.UpdateContact", tracing.ID("user_id", userID), tracing.ID("id", id))
+	defer func() { tracing.End(span, err) }()
+
+	contact, err := s.getOwnContact(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{}
+	if req.NickName != nil {
+		fields["nick_name"] = *req.NickName
+		contact.NickName = *req.NickName
+	}
+	if req.Notes != nil {
+		fields["notes"] = *req.Notes
+		contact.Notes = *req.Notes
+	}
+	if len(fields) == 0 {
+		return contact, nil
+	}
+
+	if err := s.userRepo.UpdateContactDetails(ctx, id, fields); err != nil {
+		return nil, err
+	}
+	return contact, nil
+}
+
+// RemoveContact deletes a contact of userID. Removing an accepted contact
+// removes userID from the other user's contacts as well; removing a block
+// unblocks the user.
+func (s *userService) RemoveContact(ctx context.Context, userID, id uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.user.RemoveContact", tracing.ID("user_id", userID), tracing.ID("id", id))
+	defer func() { tracing.End(span, err) }()
+
+	contact, err := s.getOwnContact(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	if contact.Status == model.ContactStatusBlocked {
+		return s.UnblockUser(ctx, userID, contact.ContactID)
+	}
+
+	if err := s.userRepo.RemoveContact(ctx, userID, contact.ContactID); err != nil {
+		return err
+	}
+
+	if contact.Status == model.ContactStatusAccepted {
+		reverse, err := s.userRepo.GetContact(ctx, contact.ContactID, userID)
+		if err != nil {
+			return err
+		}
+		if reverse != nil && reverse.Status == model.ContactStatusAccepted {
+			if err := s.userRepo.RemoveContact(ctx, contact.ContactID, userID); err != nil {
+				return err
+			}
+		}
+	}
+
+	logger.Info("Contact removed", logger.WithFields(map[string]interface{}{
+		"user_id":    userID,
+		"contact_id": contact.ContactID,
+	}))
+	return nil
+}
+
+// BlockUser blocks blockedID for userID. Blocked users can't send contact
+// requests to userID, open a direct room or send messages to them, and don't
+// see their typing or presence; the same holds the other way around. A
+// contact entry for blockedID is marked blocked and a request they already
+// sent is rejected.
+func (s *userService) BlockUser(ctx context.Context, userID, blockedID uuid.UUID, reason string) (_ *model.UserBlock, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.BlockUser", tracing.ID("user_id", userID), tracing.ID("blocked_id", blockedID))
+	defer func() { tracing.End(span, err) }()
+
+	if userID == blockedID {
+		return nil, fmt.Errorf("%w: cannot block yourself", ErrInvalidArgument)
+	}
+
+	target, err := s.userRepo.GetByID(ctx, blockedID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if target == nil {
+		return nil, ErrUserNotFound
+	}
+
+	block := &model.UserBlock{
+		BlockerID: userID,
+		BlockedID: blockedID,
+		Reason:    reason,
+	}
+	created, err := s.userRepo.CreateBlock(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+	invalidateBlockSets(ctx, s.redis, userID, blockedID)
+
+	contact, err := s.userRepo.GetContact(ctx, userID, blockedID)
+	if err != nil {
+		return nil, err
+	}
+	if contact != nil && contact.Status != model.ContactStatusBlocked {
+		if err := s.userRepo.UpdateContactStatus(ctx, userID, blockedID, model.ContactStatusBlocked); err != nil {
+			return nil, err
+		}
+	}
+
+	reverse, err := s.userRepo.GetContact(ctx, blockedID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if reverse != nil && reverse.Status == model.ContactStatusPending {
+		if err := s.userRepo.UpdateContactStatus(ctx, blockedID, userID, model.ContactStatusRejected); err != nil {
+			return nil, err
+		}
+	}
+
+	if created {
+		recordActivity(&model.ActivityLog{
+			UserID:       &userID,
+			ActivityType: ActivityUserBlock,
+			Description:  "Blocked a user",
+		}, map[string]interface{}{"blocked_id": blockedID})
+	}
+
+	logger.Info("User blocked", logger.WithFields(map[string]interface{}{
+		"user_id":    userID,
+		"blocked_id": blockedID,
+	}))
+	return block, nil
+}
+
+// UnblockUser lifts a block userID put on blockedID. The contact entry that
+// was marked blocked is removed; the users have to send a new request to
+// become contacts again.
+func (s *userService) UnblockUser(ctx context.Context, userID, blockedID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "service.user.UnblockUser", tracing.ID("user_id", userID), tracing.ID("blocked_id", blockedID))
+	defer func() { tracing.End(span, err) }()
+
+	deleted, err := s.userRepo.DeleteBlock(ctx, userID, blockedID)
+	if err != nil {
+		return err
+	}
+
+	contact, err := s.userRepo.GetContact(ctx, userID, blockedID)
+	if err != nil {
+		return err
+	}
+	if contact != nil && contact.Status == model.ContactStatusBlocked {
+		if err := s.userRepo.RemoveContact(ctx, userID, blockedID); err != nil {
+			return err
+		}
+		deleted = true
+	}
+	if !deleted {
+		return fmt.Errorf("%w: user is not blocked", ErrNotFound)
+	}
+	invalidateBlockSets(ctx, s.redis, userID, blockedID)
+
+	recordActivity(&model.ActivityLog{
+		UserID:       &userID,
+		ActivityType: ActivityUserUnblock,
+		Description:  "Unblocked a user",
+	}, map[string]interface{}{"blocked_id": blockedID})
+
+	logger.Info("User unblocked", logger.WithFields(map[string]interface{}{
+		"user_id":    userID,
+		"blocked_id": blockedID,
+	}))
+	return nil
+}
+
+// ListBlockedUsers lists the users userID blocked, newest first
+func (s *userService) ListBlockedUsers(ctx context.Context, userID uuid.UUID) (_ []model.UserBlock, err error) {
+	ctx, span := tracing.Start(ctx, "service.user.ListBlockedUsers", tracing.ID("user_id", userID))
+	defer func() { tracing.End(span, err) }()
+
+	return s.userRepo.GetBlocks(ctx, userID)
+}
+
+// BlockedUserIDs returns the users userID blocked or was blocked by
+func (s *userService) BlockedUserIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	return blockedUserIDs(ctx, s.userRepo, s.redis, userID)
+}
+
+// getOwnContact loads a contact entry of userID. Entries of other users are
+// reported as missing.
+func (s *userService) getOwnContact(ctx context.Context, userID, id uuid.UUID) (*model.UserContact, error) {
+	contact, err := s.userRepo.GetContactByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if contact == nil || contact.UserID != userID {
+		return nil, fmt.Errorf("%w: contact not found", ErrNotFound)
+	}
+	return contact, nil
+}
+
+// getPendingRequest loads a request addressed to userID that has not been
+// answered yet. Requests addressed to someone else are reported as missing.
+func (s *userService) getPendingRequest(ctx context.Context, userID, requestID uuid.UUID) (*model.UserContact, error) {
+	request, err := s.userRepo.GetContactByID(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil || request.ContactID != userID {
+		return nil, fmt.Errorf("%w: contact request not found", ErrNotFound)
+	}
+	if request.Status != model.ContactStatusPending {
+		return nil, fmt.Errorf("%w: contact request was already answered", ErrInvalidArgument)
+	}
+	return request, nil
 }
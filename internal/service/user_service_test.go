@@ -0,0 +1,800 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"realtime-api/internal/config"
+	"realtime-api/internal/database"
+	"realtime-api/internal/jwt"
+	"realtime-api/internal/model"
+	"realtime-api/internal/redis"
+	"realtime-api/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestUserService(t *testing.T) (UserService, *redis.Redis) {
+	t.Helper()
+	return newTestUserServiceWithMailer(t, &testMailer{sent: make(chan testEmail, 10)})
+}
+
+func newTestUserServiceWithMailer(t *testing.T, mailer *testMailer) (UserService, *redis.Redis) {
+	t.Helper()
+
+	newTestDatabase(t, &model.User{}, &model.UserProfile{}, &model.UserSession{}, &model.UserContact{}, &model.UserBlock{})
+	jwt.Init(&config.JWTConfig{SecretKey: "test-secret", AccessTokenTTL: 15, RefreshTokenTTL: 24})
+
+	redisClient := newTestRedis(t)
+	svc := NewUserService(repository.NewCachedUserRepository(repository.NewUserRepository(), redisClient), repository.NewSessionRepository(), redisClient, mailer)
+	return svc, redisClient
+}
+
+type testEmail struct {
+	to, subject, body string
+}
+
+// testMailer collects the emails the services send
+type testMailer struct {
+	sent chan testEmail
+}
+
+func (m *testMailer) Send(to, subject, body string) error {
+	m.sent <- testEmail{to: to, subject: subject, body: body}
+	return nil
+}
+
+// next waits for the next email
+func (m *testMailer) next(t *testing.T) testEmail {
+	t.Helper()
+	select {
+	case sent := <-m.sent:
+		return sent
+	case <-time.After(time.Second):
+		t.Fatal("no email was sent")
+		return testEmail{}
+	}
+}
+
+func createTestUser(t *testing.T, svc UserService, username string) *model.User {
+	t.Helper()
+
+	user, err := svc.CreateUser(context.Background(), &model.CreateUserRequest{
+		Username:  username,
+		Email:     username + "@example.com",
+		Password:  "secret-password",
+		FirstName: "Test",
+		LastName:  "User",
+	})
+	require.NoError(t, err)
+	return user
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	svc, redisClient := newTestUserService(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, svc, "alice")
+
+	var logins []*model.LoginResponse
+	for _, device := range []string{"phone", "laptop"} {
+		login, err := svc.AuthenticateUser(ctx, &model.LoginRequest{
+			Email:    "alice@example.com",
+			Password: "secret-password",
+			DeviceID: device,
+		})
+		require.NoError(t, err)
+		logins = append(logins, login)
+	}
+
+	sessions, err := svc.ListSessions(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 2)
+
+	revoked := logins[0]
+	require.NoError(t, svc.RevokeSession(ctx, user.ID, revoked.SessionID))
+
+	sessions, err = svc.ListSessions(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, logins[1].SessionID, sessions[0].ID)
+
+	// Both tokens of the session carry its ID
+	blacklisted, err := redisClient.IsTokenBlacklisted(ctx, revoked.SessionID.String())
+	require.NoError(t, err)
+	assert.True(t, blacklisted)
+
+	blacklisted, err = redisClient.IsTokenBlacklisted(ctx, logins[1].SessionID.String())
+	require.NoError(t, err)
+	assert.False(t, blacklisted)
+
+	// The refresh token of a revoked session can't mint new access tokens
+	_, _, _, err = svc.RefreshSession(ctx, revoked.RefreshToken)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, _, _, err = svc.RefreshSession(ctx, logins[1].RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestRevokeSessionOfAnotherUser(t *testing.T) {
+	svc, _ := newTestUserService(t)
+	ctx := context.Background()
+
+	createTestUser(t, svc, "alice")
+	login, err := svc.AuthenticateUser(ctx, &model.LoginRequest{
+		Email:    "alice@example.com",
+		Password: "secret-password",
+		DeviceID: "phone",
+	})
+	require.NoError(t, err)
+
+	err = svc.RevokeSession(ctx, uuid.New(), login.SessionID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestLogout(t *testing.T) {
+	svc, redisClient := newTestUserService(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, svc, "alice")
+	login, err := svc.AuthenticateUser(ctx, &model.LoginRequest{
+		Email:    "alice@example.com",
+		Password: "secret-password",
+		DeviceID: "phone",
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, svc.Logout(ctx, login.AccessToken))
+
+	claims, err := jwt.GetService().ValidateToken(login.AccessToken)
+	require.NoError(t, err)
+	blacklisted, err := redisClient.IsTokenBlacklisted(ctx, claims.ID)
+	require.NoError(t, err)
+	assert.True(t, blacklisted)
+
+	sessions, err := svc.ListSessions(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	// Logging out twice is harmless
+	assert.NoError(t, svc.Logout(ctx, login.AccessToken))
+	assert.ErrorIs(t, svc.Logout(ctx, "not-a-token"), ErrInvalidArgument)
+}
+
+func TestContactRequests(t *testing.T) {
+	svc, _ := newTestUserService(t)
+	ctx := context.Background()
+
+	alice := createTestUser(t, svc, "alice")
+	bob := createTestUser(t, svc, "bob")
+	carol := createTestUser(t, svc, "carol")
+
+	_, err := svc.SendContactRequest(ctx, alice.ID, alice.ID)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+	_, err = svc.SendContactRequest(ctx, alice.ID, uuid.New())
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	request, err := svc.SendContactRequest(ctx, alice.ID, bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.ContactStatusPending, request.Status)
+
+	_, err = svc.SendContactRequest(ctx, alice.ID, bob.ID)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+	_, err = svc.SendContactRequest(ctx, bob.ID, alice.ID)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	pending, err := svc.GetPendingRequests(ctx, bob.ID)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, request.ID, pending[0].ID)
+	assert.Equal(t, "alice", pending[0].User.Username)
+
+	// Only the recipient can answer
+	_, err = svc.AcceptContactRequest(ctx, carol.ID, request.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	accepted, err := svc.AcceptContactRequest(ctx, bob.ID, request.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.ContactStatusAccepted, accepted.Status)
+
+	_, err = svc.AcceptContactRequest(ctx, bob.ID, request.ID)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	// Both users list each other
+	repo := repository.NewUserRepository()
+	for _, pair := range [][2]uuid.UUID{{alice.ID, bob.ID}, {bob.ID, alice.ID}} {
+		contact, err := repo.GetContact(ctx, pair[0], pair[1])
+		require.NoError(t, err)
+		require.NotNil(t, contact)
+		assert.Equal(t, model.ContactStatusAccepted, contact.Status)
+	}
+
+	// Rejected requests can be sent again
+	request, err = svc.SendContactRequest(ctx, carol.ID, bob.ID)
+	require.NoError(t, err)
+	require.NoError(t, svc.RejectContactRequest(ctx, bob.ID, request.ID))
+
+	pending, err = svc.GetPendingRequests(ctx, bob.ID)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	again, err := svc.SendContactRequest(ctx, carol.ID, bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, request.ID, again.ID)
+	assert.Equal(t, model.ContactStatusPending, again.Status)
+}
+
+func TestManageContacts(t *testing.T) {
+	svc, _ := newTestUserService(t)
+	ctx := context.Background()
+
+	alice := createTestUser(t, svc, "alice")
+	bob := createTestUser(t, svc, "bob")
+	carol := createTestUser(t, svc, "carol")
+
+	request, err := svc.SendContactRequest(ctx, alice.ID, bob.ID)
+	require.NoError(t, err)
+	_, err = svc.AcceptContactRequest(ctx, bob.ID, request.ID)
+	require.NoError(t, err)
+	_, err = svc.SendContactRequest(ctx, alice.ID, carol.ID)
+	require.NoError(t, err)
+
+	contacts, err := svc.ListContacts(ctx, alice.ID, "")
+	require.NoError(t, err)
+	assert.Len(t, contacts, 2)
+
+	contacts, err = svc.ListContacts(ctx, alice.ID, model.ContactStatusAccepted)
+	require.NoError(t, err)
+	require.Len(t, contacts, 1)
+	assert.Equal(t, "bob", contacts[0].Contact.Username)
+
+	_, err = svc.ListContacts(ctx, alice.ID, "friends")
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	// Details are private to the owner of the entry
+	nickname := "Bobby"
+	updated, err := svc.UpdateContact(ctx, alice.ID, request.ID, &model.UpdateContactRequest{NickName: &nickname})
+	require.NoError(t, err)
+	assert.Equal(t, "Bobby", updated.NickName)
+	_, err = svc.UpdateContact(ctx, bob.ID, request.ID, &model.UpdateContactRequest{NickName: &nickname})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Removing an accepted contact removes it on both sides
+	require.NoError(t, svc.RemoveContact(ctx, alice.ID, request.ID))
+	contacts, err = svc.ListContacts(ctx, bob.ID, "")
+	require.NoError(t, err)
+	assert.Empty(t, contacts)
+
+	// Blocking rejects a pending request and stops new ones
+	pending, err := svc.GetPendingRequests(ctx, carol.ID)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+
+	_, err = svc.BlockUser(ctx, carol.ID, alice.ID, "")
+	require.NoError(t, err)
+
+	pending, err = svc.GetPendingRequests(ctx, carol.ID)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	_, err = svc.SendContactRequest(ctx, alice.ID, carol.ID)
+	assert.ErrorIs(t, err, ErrUserUnavailable)
+
+	// Unblocking lets requests through again
+	require.NoError(t, svc.UnblockUser(ctx, carol.ID, alice.ID))
+	_, err = svc.SendContactRequest(ctx, alice.ID, carol.ID)
+	assert.NoError(t, err)
+}
+
+func TestBlockUser(t *testing.T) {
+	svc, _ := newTestUserService(t)
+	ctx := context.Background()
+
+	alice := createTestUser(t, svc, "alice")
+	bob := createTestUser(t, svc, "bob")
+
+	request, err := svc.SendContactRequest(ctx, alice.ID, bob.ID)
+	require.NoError(t, err)
+	_, err = svc.AcceptContactRequest(ctx, bob.ID, request.ID)
+	require.NoError(t, err)
+
+	_, err = svc.BlockUser(ctx, alice.ID, alice.ID, "")
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+	_, err = svc.BlockUser(ctx, alice.ID, uuid.New(), "")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	// Look the set up first so blocking has to refresh the cache
+	blockedIDs, err := svc.BlockedUserIDs(ctx, bob.ID)
+	require.NoError(t, err)
+	assert.Empty(t, blockedIDs)
+
+	block, err := svc.BlockUser(ctx, alice.ID, bob.ID, "spam")
+	require.NoError(t, err)
+	again, err := svc.BlockUser(ctx, alice.ID, bob.ID, "")
+	require.NoError(t, err)
+	assert.Equal(t, block.ID, again.ID)
+
+	blocks, err := svc.ListBlockedUsers(ctx, alice.ID)
+	require.NoError(t, err)
+	require.Len(t, blocks, 1)
+	assert.Equal(t, "bob", blocks[0].Blocked.Username)
+	assert.Equal(t, "spam", blocks[0].Reason)
+
+	// Both sides see the block
+	for _, pair := range [][2]uuid.UUID{{alice.ID, bob.ID}, {bob.ID, alice.ID}} {
+		blockedIDs, err := svc.BlockedUserIDs(ctx, pair[0])
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{pair[1]}, blockedIDs)
+	}
+
+	contacts, err := svc.ListContacts(ctx, alice.ID, model.ContactStatusBlocked)
+	require.NoError(t, err)
+	assert.Len(t, contacts, 1)
+
+	require.NoError(t, svc.UnblockUser(ctx, alice.ID, bob.ID))
+	assert.ErrorIs(t, svc.UnblockUser(ctx, alice.ID, bob.ID), ErrNotFound)
+
+	blockedIDs, err = svc.BlockedUserIDs(ctx, bob.ID)
+	require.NoError(t, err)
+	assert.Empty(t, blockedIDs)
+}
+
+func TestResetPassword(t *testing.T) {
+	mailer := &testMailer{sent: make(chan testEmail, 10)}
+	svc, redisClient := newTestUserServiceWithMailer(t, mailer)
+	ctx := context.Background()
+
+	user := createTestUser(t, svc, "alice")
+	login, err := svc.AuthenticateUser(ctx, &model.LoginRequest{
+		Email:    "alice@example.com",
+		Password: "secret-password",
+		DeviceID: "phone",
+	})
+	require.NoError(t, err)
+
+	// Unknown emails look the same as known ones
+	require.NoError(t, svc.ForgotPassword(ctx, "nobody@example.com", "10.0.0.1"))
+	require.NoError(t, svc.ForgotPassword(ctx, "Alice@example.com", "10.0.0.1"))
+
+	sent := mailer.next(t)
+	assert.Equal(t, "alice@example.com", sent.to)
+	token := sent.body[strings.Index(sent.body, user.ID.String()):]
+	token = token[:strings.Index(token, "\n")]
+
+	// A wrong secret doesn't use up the token
+	wrong := user.ID.String() + "." + strings.Repeat("0", 64)
+	assert.ErrorIs(t, svc.ResetPassword(ctx, wrong, "other-password"), ErrInvalidArgument)
+	assert.ErrorIs(t, svc.ResetPassword(ctx, "not-a-token", "other-password"), ErrInvalidArgument)
+
+	require.NoError(t, svc.ResetPassword(ctx, token, "new-password"))
+
+	// Tokens work once
+	assert.ErrorIs(t, svc.ResetPassword(ctx, token, "other-password"), ErrInvalidArgument)
+
+	_, err = svc.AuthenticateUser(ctx, &model.LoginRequest{Email: "alice@example.com", Password: "secret-password", DeviceID: "phone"})
+	assert.Error(t, err)
+	_, err = svc.AuthenticateUser(ctx, &model.LoginRequest{Email: "alice@example.com", Password: "new-password", DeviceID: "phone"})
+	assert.NoError(t, err)
+
+	// Sessions from before the reset are signed out
+	blacklisted, err := redisClient.IsTokenBlacklisted(ctx, login.SessionID.String())
+	require.NoError(t, err)
+	assert.True(t, blacklisted)
+}
+
+func TestForgotPasswordRateLimit(t *testing.T) {
+	svc, _ := newTestUserService(t)
+	ctx := context.Background()
+
+	createTestUser(t, svc, "alice")
+
+	for i := 0; i < maxPasswordResetsPerEmail; i++ {
+		require.NoError(t, svc.ForgotPassword(ctx, "alice@example.com", "10.0.0.1"))
+	}
+	var rateLimited *RateLimitError
+	require.ErrorAs(t, svc.ForgotPassword(ctx, "alice@example.com", "10.0.0.2"), &rateLimited)
+	assert.Equal(t, passwordResetWindow, rateLimited.RetryAfter)
+
+	// The IP limit covers all emails
+	for i := maxPasswordResetsPerEmail; i < maxPasswordResetsPerIP; i++ {
+		require.NoError(t, svc.ForgotPassword(ctx, fmt.Sprintf("nobody%d@example.com", i), "10.0.0.1"))
+	}
+	assert.ErrorIs(t, svc.ForgotPassword(ctx, "someone@example.com", "10.0.0.1"), ErrRateLimited)
+}
+
+func TestChangePassword(t *testing.T) {
+	svc, redisClient := newTestUserService(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, svc, "alice")
+	var logins []*model.LoginResponse
+	for _, device := range []string{"phone", "laptop"} {
+		login, err := svc.AuthenticateUser(ctx, &model.LoginRequest{
+			Email:    "alice@example.com",
+			Password: "secret-password",
+			DeviceID: device,
+		})
+		require.NoError(t, err)
+		logins = append(logins, login)
+	}
+	current := logins[0].SessionID
+
+	err := svc.ChangePassword(ctx, user.ID, current, &model.ChangePasswordRequest{CurrentPassword: "wrong-password", NewPassword: "new-password"})
+	assert.ErrorIs(t, err, ErrForbidden)
+	err = svc.ChangePassword(ctx, user.ID, current, &model.ChangePasswordRequest{CurrentPassword: "secret-password", NewPassword: "secret-password"})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	require.NoError(t, svc.ChangePassword(ctx, user.ID, current, &model.ChangePasswordRequest{CurrentPassword: "secret-password", NewPassword: "new-password"}))
+
+	_, err = svc.AuthenticateUser(ctx, &model.LoginRequest{Email: "alice@example.com", Password: "secret-password", DeviceID: "tablet"})
+	assert.Error(t, err)
+	_, err = svc.AuthenticateUser(ctx, &model.LoginRequest{Email: "alice@example.com", Password: "new-password", DeviceID: "tablet"})
+	assert.NoError(t, err)
+
+	// Only the other sessions are signed out
+	blacklisted, err := redisClient.IsTokenBlacklisted(ctx, current.String())
+	require.NoError(t, err)
+	assert.False(t, blacklisted)
+	blacklisted, err = redisClient.IsTokenBlacklisted(ctx, logins[1].SessionID.String())
+	require.NoError(t, err)
+	assert.True(t, blacklisted)
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	svc, _ := newTestUserService(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, svc, "carol")
+	login := &model.LoginRequest{Email: "carol@example.com", Password: "secret-password", DeviceID: "phone"}
+	now := time.Now()
+	svc.(*userService).now = func() time.Time { return now }
+
+	setup, err := svc.EnableTOTP(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Contains(t, setup.ProvisioningURI, "secret="+setup.Secret)
+	assert.True(t, strings.HasPrefix(setup.QRCode, "data:image/png;base64,"))
+
+	// Not required until a code was verified
+	response, err := svc.AuthenticateUser(ctx, login)
+	require.NoError(t, err)
+	assert.False(t, response.Requires2FA)
+	assert.NotEmpty(t, response.AccessToken)
+
+	assert.ErrorIs(t, svc.VerifyTOTP(ctx, user.ID, "000000"), ErrInvalidArgument)
+	code, err := totp.GenerateCode(setup.Secret, now)
+	require.NoError(t, err)
+	require.NoError(t, svc.VerifyTOTP(ctx, user.ID, code))
+
+	_, err = svc.EnableTOTP(ctx, user.ID)
+	assert.ErrorIs(t, err, ErrConflict)
+
+	response, err = svc.AuthenticateUser(ctx, login)
+	require.NoError(t, err)
+	assert.True(t, response.Requires2FA)
+	assert.Empty(t, response.AccessToken)
+	require.NotEmpty(t, response.TwoFactorToken)
+
+	_, err = svc.ValidateTwoFactorLogin(ctx, &model.TwoFactorLoginRequest{TwoFactorToken: response.TwoFactorToken, Code: "000000"})
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	// A code is accepted once
+	_, err = svc.ValidateTwoFactorLogin(ctx, &model.TwoFactorLoginRequest{TwoFactorToken: response.TwoFactorToken, Code: code})
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	now = now.Add(30 * time.Second)
+	code, err = totp.GenerateCode(setup.Secret, now)
+	require.NoError(t, err)
+	completed, err := svc.ValidateTwoFactorLogin(ctx, &model.TwoFactorLoginRequest{TwoFactorToken: response.TwoFactorToken, Code: code})
+	require.NoError(t, err)
+	assert.NotEmpty(t, completed.AccessToken)
+	assert.Equal(t, user.ID, completed.User.ID)
+
+	// The token works once
+	_, err = svc.ValidateTwoFactorLogin(ctx, &model.TwoFactorLoginRequest{TwoFactorToken: response.TwoFactorToken, Code: code})
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	// Too many wrong codes end the login
+	response, err = svc.AuthenticateUser(ctx, login)
+	require.NoError(t, err)
+	for i := 0; i < maxTwoFactorAttempts; i++ {
+		_, err = svc.ValidateTwoFactorLogin(ctx, &model.TwoFactorLoginRequest{TwoFactorToken: response.TwoFactorToken, Code: "000000"})
+		assert.ErrorIs(t, err, ErrUnauthorized)
+	}
+	_, err = svc.ValidateTwoFactorLogin(ctx, &model.TwoFactorLoginRequest{TwoFactorToken: response.TwoFactorToken, Code: code})
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	assert.ErrorIs(t, svc.DisableTOTP(ctx, user.ID, code), ErrInvalidArgument)
+	now = now.Add(30 * time.Second)
+	code, err = totp.GenerateCode(setup.Secret, now)
+	require.NoError(t, err)
+	require.NoError(t, svc.DisableTOTP(ctx, user.ID, code))
+	response, err = svc.AuthenticateUser(ctx, login)
+	require.NoError(t, err)
+	assert.False(t, response.Requires2FA)
+}
+
+func TestSetUserActive(t *testing.T) {
+	svc, _ := newTestUserService(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, svc, "alice")
+	login := &model.LoginRequest{Email: "alice@example.com", Password: "secret-password"}
+	_, err := svc.AuthenticateUser(ctx, login)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, svc.SetUserActive(ctx, uuid.New(), false), ErrUserNotFound)
+
+	// Deactivating ends every session and blocks new logins
+	require.NoError(t, svc.SetUserActive(ctx, user.ID, false))
+	sessions, err := svc.ListSessions(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	_, err = svc.AuthenticateUser(ctx, login)
+	assert.Error(t, err)
+
+	require.NoError(t, svc.SetUserActive(ctx, user.ID, true))
+	_, err = svc.AuthenticateUser(ctx, login)
+	assert.NoError(t, err)
+}
+
+func TestUpdateUserProfile(t *testing.T) {
+	svc, _ := newTestUserService(t)
+	ctx := context.Background()
+
+	alice := createTestUser(t, svc, "alice")
+	bob := createTestUser(t, svc, "bob")
+
+	profile, err := svc.GetUserProfile(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Test User", profile.DisplayName)
+
+	displayName, bio, dateOfBirth := "  Alice  ", "Hello", "1990-05-17"
+	profile, err = svc.UpdateUserProfile(ctx, alice.ID, &model.UpdateProfileRequest{
+		DisplayName: &displayName,
+		Bio:         &bio,
+		DateOfBirth: &dateOfBirth,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", profile.DisplayName)
+	require.NotNil(t, profile.DateOfBirth)
+	assert.Equal(t, dateOfBirth, profile.DateOfBirth.Format("2006-01-02"))
+
+	// Fields left out are kept, an empty date of birth clears it
+	location, noDate := "Berlin", ""
+	profile, err = svc.UpdateUserProfile(ctx, alice.ID, &model.UpdateProfileRequest{Location: &location, DateOfBirth: &noDate})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello", profile.Bio)
+	assert.Nil(t, profile.DateOfBirth)
+
+	future := time.Now().AddDate(1, 0, 0).Format("2006-01-02")
+	_, err = svc.UpdateUserProfile(ctx, alice.ID, &model.UpdateProfileRequest{DateOfBirth: &future})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	public, err := svc.GetPublicProfile(ctx, bob.ID, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", public.DisplayName)
+	assert.Equal(t, "Berlin", public.Location)
+
+	// Blocked users can't see the profile
+	_, err = svc.BlockUser(ctx, alice.ID, bob.ID, "")
+	require.NoError(t, err)
+	_, err = svc.GetPublicProfile(ctx, bob.ID, alice.ID)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	_, err = svc.GetUserProfile(ctx, uuid.New())
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestUpdateUserSettings(t *testing.T) {
+	svc, _ := newTestUserService(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, svc, "alice")
+	settings, err := svc.GetUserSettings(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, settings.AllowDirectMessages)
+	assert.Equal(t, "UTC", settings.Timezone)
+
+	allowDirectMessages := false
+	settings, err = svc.UpdateUserSettings(ctx, user.ID, &model.UpdateUserSettingsRequest{
+		Timezone:            "Europe/Berlin",
+		AllowDirectMessages: &allowDirectMessages,
+	})
+	require.NoError(t, err)
+	assert.False(t, settings.AllowDirectMessages)
+	assert.True(t, settings.ShowReadReceipts)
+
+	_, err = svc.UpdateUserSettings(ctx, user.ID, &model.UpdateUserSettingsRequest{Timezone: "Mars/Olympus"})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	// Only the settings are written, the password still works
+	stored, err := svc.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Europe/Berlin", stored.Timezone)
+	assert.False(t, stored.AllowDirectMessages)
+	_, err = svc.AuthenticateUser(ctx, &model.LoginRequest{Email: "alice@example.com", Password: "secret-password"})
+	assert.NoError(t, err)
+}
+
+func TestSetUserStatus(t *testing.T) {
+	svc, redisClient := newTestUserService(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, svc, "alice")
+
+	_, err := svc.SetUserStatus(ctx, user.ID, model.UserStatus("sleeping"))
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	// listedStatus is the status others see in the user list
+	listedStatus := func() string {
+		users, _, err := svc.ListUsers(ctx, 1, 10)
+		require.NoError(t, err)
+		require.Len(t, users, 1)
+		return users[0].Status
+	}
+	isOnline := func() bool {
+		online, err := redisClient.IsUserOnline(ctx, user.ID.String())
+		require.NoError(t, err)
+		return online
+	}
+
+	updated, err := svc.SetUserStatus(ctx, user.ID, model.UserStatusBusy)
+	require.NoError(t, err)
+	assert.Equal(t, string(model.UserStatusBusy), updated.VisibleStatus())
+	assert.True(t, isOnline())
+	assert.Equal(t, string(model.UserStatusBusy), listedStatus())
+
+	// Invisible users stay connected but show as offline
+	updated, err = svc.SetUserStatus(ctx, user.ID, model.UserStatusInvisible)
+	require.NoError(t, err)
+	assert.Equal(t, string(model.UserStatusOffline), updated.VisibleStatus())
+	assert.True(t, isOnline())
+	assert.Equal(t, string(model.UserStatusOffline), listedStatus())
+	stored, err := svc.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, string(model.UserStatusInvisible), stored.Status)
+
+	// So do users hiding their online status
+	_, err = svc.SetUserStatus(ctx, user.ID, model.UserStatusOnline)
+	require.NoError(t, err)
+	assert.Equal(t, string(model.UserStatusOnline), listedStatus())
+	showOnlineStatus := false
+	_, err = svc.UpdateUserSettings(ctx, user.ID, &model.UpdateUserSettingsRequest{ShowOnlineStatus: &showOnlineStatus})
+	require.NoError(t, err)
+	assert.Equal(t, string(model.UserStatusOffline), listedStatus())
+
+	_, err = svc.SetUserStatus(ctx, user.ID, model.UserStatusOffline)
+	require.NoError(t, err)
+	assert.False(t, isOnline())
+}
+
+func TestUpdateUser(t *testing.T) {
+	svc, _ := newTestUserService(t)
+	ctx := context.Background()
+
+	alice := createTestUser(t, svc, "alice")
+	bob := createTestUser(t, svc, "bob")
+	admin := createTestUser(t, svc, "admin")
+	require.NoError(t, database.GetDB().Model(&model.User{}).Where("id = ?", admin.ID).Update("is_admin", true).Error)
+	require.NoError(t, database.GetDB().Model(&model.User{}).Where("id = ?", alice.ID).Update("is_verified", true).Error)
+
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name  string
+		req   model.UpdateUserRequest
+		check func(t *testing.T, user *model.User)
+	}{
+		{"username", model.UpdateUserRequest{Username: str("alice2")}, func(t *testing.T, user *model.User) {
+			assert.Equal(t, "alice2", user.Username)
+		}},
+		{"first name", model.UpdateUserRequest{FirstName: str("Alice")}, func(t *testing.T, user *model.User) {
+			assert.Equal(t, "Alice", user.FirstName)
+		}},
+		{"last name", model.UpdateUserRequest{LastName: str("Liddell")}, func(t *testing.T, user *model.User) {
+			assert.Equal(t, "Liddell", user.LastName)
+		}},
+		{"bio", model.UpdateUserRequest{Bio: str("Curious")}, func(t *testing.T, user *model.User) {
+			assert.Equal(t, "Curious", user.Bio)
+		}},
+		{"avatar", model.UpdateUserRequest{Avatar: str("https://example.com/alice.png")}, func(t *testing.T, user *model.User) {
+			assert.Equal(t, "https://example.com/alice.png", user.Avatar)
+		}},
+		{"phone number", model.UpdateUserRequest{PhoneNumber: str("+4912345")}, func(t *testing.T, user *model.User) {
+			assert.Equal(t, "+4912345", user.PhoneNumber)
+		}},
+		{"email resets verification", model.UpdateUserRequest{Email: str("alice@example.org")}, func(t *testing.T, user *model.User) {
+			assert.Equal(t, "alice@example.org", user.Email)
+			assert.False(t, user.IsVerified)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.UpdateUser(ctx, alice.ID, alice.ID, &tt.req)
+			require.NoError(t, err)
+
+			stored, err := svc.GetUserByID(ctx, alice.ID)
+			require.NoError(t, err)
+			tt.check(t, stored)
+		})
+	}
+
+	// The password is left alone
+	_, err := svc.AuthenticateUser(ctx, &model.LoginRequest{Email: "alice@example.org", Password: "secret-password"})
+	assert.NoError(t, err)
+
+	_, err = svc.UpdateUser(ctx, alice.ID, alice.ID, &model.UpdateUserRequest{Username: str("bob")})
+	assert.ErrorIs(t, err, ErrUsernameTaken)
+	_, err = svc.UpdateUser(ctx, alice.ID, alice.ID, &model.UpdateUserRequest{Email: str("bob@example.com")})
+	assert.ErrorIs(t, err, ErrEmailTaken)
+
+	// Users can't change other users or their own active state
+	_, err = svc.UpdateUser(ctx, bob.ID, alice.ID, &model.UpdateUserRequest{Bio: str("hacked")})
+	assert.ErrorIs(t, err, ErrForbidden)
+	active := false
+	_, err = svc.UpdateUser(ctx, alice.ID, alice.ID, &model.UpdateUserRequest{IsActive: &active})
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	// Admins can
+	updated, err := svc.UpdateUser(ctx, admin.ID, bob.ID, &model.UpdateUserRequest{Bio: str("Moderated"), IsActive: &active})
+	require.NoError(t, err)
+	assert.Equal(t, "Moderated", updated.Bio)
+	assert.False(t, updated.IsActive)
+}
+
+func TestCachedUserLookups(t *testing.T) {
+	svc, redisClient := newTestUserService(t)
+	ctx := context.Background()
+
+	alice := createTestUser(t, svc, "alice")
+
+	// Lookups fill the cache and are then served from it
+	_, err := svc.GetUserByID(ctx, alice.ID)
+	require.NoError(t, err)
+	cached, err := redisClient.Exists(ctx, "user:"+alice.ID.String())
+	require.NoError(t, err)
+	assert.True(t, cached)
+
+	require.NoError(t, database.GetDB().Model(&model.User{}).Where("id = ?", alice.ID).Update("bio", "stale").Error)
+	user, err := svc.GetUserByID(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Empty(t, user.Bio)
+
+	// Writes drop the cached user
+	bio := "Curious"
+	_, err = svc.UpdateUser(ctx, alice.ID, alice.ID, &model.UpdateUserRequest{Bio: &bio})
+	require.NoError(t, err)
+	user, err = svc.GetUserByID(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Curious", user.Bio)
+
+	// Secrets are never cached, logins read them from the database
+	user, err = svc.GetUserByEmail(ctx, "alice@example.com")
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	entry, ok, err := redisClient.GetEx(ctx, "user:"+alice.ID.String(), time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	var stored model.User
+	require.NoError(t, database.GetDB().Select("password").First(&stored, "id = ?", alice.ID).Error)
+	require.NotEmpty(t, stored.Password)
+	assert.NotContains(t, entry, stored.Password)
+	assert.NotContains(t, entry, "password")
+	_, err = svc.AuthenticateUser(ctx, &model.LoginRequest{Email: "alice@example.com", Password: "secret-password"})
+	require.NoError(t, err)
+
+	email := "alice@example.org"
+	_, err = svc.UpdateUser(ctx, alice.ID, alice.ID, &model.UpdateUserRequest{Email: &email})
+	require.NoError(t, err)
+	_, err = svc.AuthenticateUser(ctx, &model.LoginRequest{Email: "alice@example.com", Password: "secret-password"})
+	assert.Error(t, err)
+	_, err = svc.AuthenticateUser(ctx, &model.LoginRequest{Email: "alice@example.org", Password: "secret-password"})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// maxWebhookAttempts is how many times a webhook delivery is attempted. The
+// wait between attempts starts at webhookRetryDelay and doubles each time.
+const maxWebhookAttempts = 3
+
+var (
+	webhookRetryDelay = time.Second
+	webhookClient     = &http.Client{Timeout: 10 * time.Second}
+)
+
+// Webhook request headers. The signature is the hex HMAC-SHA256 of the body
+// keyed with the webhook secret, prefixed with "sha256=".
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// WebhookSignature signs a webhook payload with the webhook secret
+func WebhookSignature(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookDelivery posts a signed event payload to a webhook URL. Requests
+// failing or answered with a non-2xx status are retried with exponential
+// backoff; the last error is returned once every attempt failed.
+func WebhookDelivery(ctx context.Context, url, secret, eventType string, payload []byte) error {
+	signature := WebhookSignature(secret, payload)
+	delay := webhookRetryDelay
+
+	var err error
+	for attempt := 1; attempt <= maxWebhookAttempts; attempt++ {
+		if err = postWebhook(ctx, url, signature, eventType, payload); err == nil {
+			return nil
+		}
+		if attempt == maxWebhookAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	return fmt.Errorf("webhook delivery failed after %d attempts: %w", maxWebhookAttempts, err)
+}
+
+func postWebhook(ctx context.Context, url, signature, eventType string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, eventType)
+	req.Header.Set(WebhookSignatureHeader, signature)
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
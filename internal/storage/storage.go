@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"realtime-api/internal/config"
+)
+
+// Storage drivers
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+)
+
+// ErrNotFound is returned by Get for keys that don't exist
+var ErrNotFound = errors.New("object not found")
+
+// Storage keeps uploaded files. Keys are slash separated paths relative to
+// the storage root, like "thumbs/<file name>".
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes an object; missing objects are not an error
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL granting access to the object until expiry
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+
+	// URL is the public URL of an object
+	URL(key string) string
+	// Location describes where an object is stored, for the upload records
+	Location(key string) string
+}
+
+// New returns the storage selected by cfg.StorageDriver
+func New(cfg *config.UploadConfig) (Storage, error) {
+	switch cfg.StorageDriver {
+	case "", DriverLocal:
+		return NewLocal(cfg.StoragePath, cfg.BaseURL), nil
+	case DriverS3:
+		return NewS3(&cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.StorageDriver)
+	}
+}
@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// GormPlugin wraps every query in a span named
+// repository.<table>.<operation>, child of the span in the query context
+type GormPlugin struct{}
+
+func (GormPlugin) Name() string {
+	return "tracing"
+}
+
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	processors := []struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", callbacks.Create().Before("gorm:create").Register, callbacks.Create().After("gorm:create").Register},
+		{"query", callbacks.Query().Before("gorm:query").Register, callbacks.Query().After("gorm:query").Register},
+		{"update", callbacks.Update().Before("gorm:update").Register, callbacks.Update().After("gorm:update").Register},
+		{"delete", callbacks.Delete().Before("gorm:delete").Register, callbacks.Delete().After("gorm:delete").Register},
+		{"row", callbacks.Row().Before("gorm:row").Register, callbacks.Row().After("gorm:row").Register},
+		{"raw", callbacks.Raw().Before("gorm:raw").Register, callbacks.Raw().After("gorm:raw").Register},
+	}
+
+	for _, p := range processors {
+		if err := p.before("tracing:before_"+p.operation, startQuerySpan(p.operation)); err != nil {
+			return fmt.Errorf("failed to register %s tracing callback: %w", p.operation, err)
+		}
+		if err := p.after("tracing:after_"+p.operation, endQuerySpan); err != nil {
+			return fmt.Errorf("failed to register %s tracing callback: %w", p.operation, err)
+		}
+	}
+	return nil
+}
+
+func startQuerySpan(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Statement.Context == nil {
+			return
+		}
+
+		table := db.Statement.Table
+		if table == "" {
+			table = "sql"
+		}
+		ctx, _ := Start(db.Statement.Context, fmt.Sprintf("repository.%s.%s", table, operation),
+			attribute.String("db.system", db.Dialector.Name()),
+			attribute.String("db.sql.table", db.Statement.Table),
+		)
+		db.Statement.Context = ctx
+	}
+}
+
+func endQuerySpan(db *gorm.DB) {
+	if db.Statement.Context == nil {
+		return
+	}
+
+	span := trace.SpanFromContext(db.Statement.Context)
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttributes(
+		attribute.String("db.statement", db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.Statement.RowsAffected),
+	)
+	if db.Error == gorm.ErrRecordNotFound {
+		span.End()
+		return
+	}
+	End(span, db.Error)
+}
@@ -0,0 +1,176 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// ackRetryInterval is how long a chat message waits for its ack before
+	// it is written again
+	ackRetryInterval = 2 * time.Second
+	// maxAckRetries is how many times an unacknowledged chat message is
+	// written again before the client is left to fetch it on reconnect
+	maxAckRetries = 3
+	// ackTTL is how long acks and pending messages are kept in Redis
+	ackTTL = 24 * time.Hour
+	// pendingLimit caps the pending messages sent on connect
+	pendingLimit = 200
+)
+
+// unackedFrame is a chat message written to a client that hasn't
+// acknowledged it yet
+type unackedFrame struct {
+	frame   frame
+	sentAt  time.Time
+	retries int
+}
+
+// needsAck reports whether the client must acknowledge a written frame. Only
+// chat messages of other users are acknowledged, never presence or other
+// events.
+func (c *Client) needsAck(f frame) bool {
+	return f.messageID != uuid.Nil && f.senderID != c.userID
+}
+
+// trackUnacked starts waiting for the acks of the chat messages in frames
+// just written, and records them as pending until they are acknowledged
+func (c *Client) trackUnacked(frames []frame) {
+	now := time.Now()
+	pending := make(map[string]string)
+
+	c.ackMutex.Lock()
+	for _, f := range frames {
+		if !c.needsAck(f) {
+			continue
+		}
+		if _, tracked := c.unacked[f.messageID]; tracked {
+			continue
+		}
+		c.unacked[f.messageID] = &unackedFrame{frame: f, sentAt: now}
+		pending[f.messageID.String()] = string(f.payload)
+	}
+	c.ackMutex.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), writeWait)
+		defer cancel()
+		if err := c.hub.redis.AddPendingMessages(ctx, c.userID.String(), pending, ackTTL); err != nil {
+			logger.Warn("Failed to record pending messages", logger.WithFields(map[string]interface{}{
+				"user_id": c.userID.String(),
+				"error":   err.Error(),
+			}))
+		}
+	}()
+}
+
+// retryUnacked writes the chat messages that weren't acknowledged in time
+// again, giving up on those retried maxAckRetries times. Called by the write
+// pump, the only writer of the connection.
+func (c *Client) retryUnacked() error {
+	now := time.Now()
+	var due [][]byte
+
+	c.ackMutex.Lock()
+	for messageID, unacked := range c.unacked {
+		if now.Sub(unacked.sentAt) < ackRetryInterval {
+			continue
+		}
+		if unacked.retries >= maxAckRetries {
+			// Still pending, so it is sent again on reconnect
+			delete(c.unacked, messageID)
+			continue
+		}
+		unacked.retries++
+		unacked.sentAt = now
+		due = append(due, unacked.frame.payload)
+	}
+	c.ackMutex.Unlock()
+
+	for _, payload := range due {
+		c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := c.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleAck records the client's acknowledgement of a chat message
+func (c *Client) handleAck(data interface{}) {
+	dataMap, ok := data.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	messageIDStr, ok := dataMap["message_id"].(string)
+	if !ok {
+		return
+	}
+
+	messageID, err := uuid.Parse(messageIDStr)
+	if err != nil {
+		return
+	}
+
+	c.ackMutex.Lock()
+	delete(c.unacked, messageID)
+	c.ackMutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), writeWait)
+	defer cancel()
+	if err := c.hub.redis.AckMessage(ctx, c.userID.String(), messageID.String(), ackTTL); err != nil {
+		logger.Warn("Failed to record message ack", logger.WithFields(map[string]interface{}{
+			"user_id":    c.userID.String(),
+			"message_id": messageID.String(),
+			"error":      err.Error(),
+		}))
+	}
+}
+
+// pendingMessages returns the chat messages a connecting user hasn't
+// acknowledged as one frame, oldest first, or nil when there are none
+func (h *Hub) pendingMessages(ctx context.Context, userID uuid.UUID) []frame {
+	pending, err := h.redis.GetPendingMessages(ctx, userID.String())
+	if err != nil {
+		logger.Warn("Failed to load pending messages", logger.WithFields(map[string]interface{}{
+			"user_id": userID.String(),
+			"error":   err.Error(),
+		}))
+		return nil
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	messages := make([]Message, 0, len(pending))
+	for _, payload := range pending {
+		var message Message
+		if err := json.Unmarshal([]byte(payload), &message); err != nil {
+			continue
+		}
+		messages = append(messages, message)
+	}
+
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Timestamp.Before(messages[j].Timestamp)
+	})
+	if len(messages) > pendingLimit {
+		messages = messages[len(messages)-pendingLimit:]
+	}
+
+	return []frame{{payload: h.createMessage(model.WSTypePendingMessages, map[string]interface{}{
+		"messages": messages,
+	})}}
+}
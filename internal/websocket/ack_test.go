@@ -0,0 +1,141 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+	"realtime-api/internal/redis"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/redis/rueidis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// The hub logs from its own goroutines, so the logger is set up once
+	logger.Init("fatal", "json", "stdout", "")
+	os.Exit(m.Run())
+}
+
+func newTestRedis(t testing.TB) *redis.Redis {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client, err := rueidis.NewClient(rueidis.ClientOption{
+		InitAddress:  []string{server.Addr()},
+		DisableCache: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	return redis.New(client)
+}
+
+// connectTestClient serves one websocket connection for a client of hub,
+// returning the server side client and the dialed connection
+func connectTestClient(t *testing.T, hub *Hub, userID uuid.UUID) (*Client, *websocket.Conn) {
+	t.Helper()
+
+	clients := make(chan *Client, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+
+		client := &Client{
+			hub:     hub,
+			conn:    conn,
+			send:    make(chan frame, 256),
+			userID:  userID,
+			rooms:   make(map[uuid.UUID]bool),
+			unacked: make(map[uuid.UUID]*unackedFrame),
+		}
+		client.startPumps()
+		clients <- client
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return <-clients, conn
+}
+
+func readTestMessage(t *testing.T, conn *websocket.Conn, timeout time.Duration) Message {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	_, payload, err := conn.ReadMessage()
+	require.NoError(t, err)
+
+	var message Message
+	require.NoError(t, json.Unmarshal(payload, &message))
+	return message
+}
+
+func TestMessageAcknowledgement(t *testing.T) {
+	hub := NewHub(newTestRedis(t))
+	go hub.Run()
+
+	userID := uuid.New()
+	messageID := uuid.New()
+	client, conn := connectTestClient(t, hub, userID)
+
+	data := map[string]interface{}{
+		"message_id": messageID.String(),
+		"user_id":    uuid.New().String(),
+	}
+	client.send <- newFrame(hub.createMessage(model.WSTypeMessage, data), model.WSTypeMessage, data)
+
+	first := readTestMessage(t, conn, time.Second)
+	assert.Equal(t, model.WSTypeMessage, first.Type)
+
+	// Left unacknowledged, the message is written again and kept pending
+	retried := readTestMessage(t, conn, 2*ackRetryInterval)
+	assert.Equal(t, model.WSTypeMessage, retried.Type)
+
+	pending := hub.pendingMessages(context.Background(), userID)
+	require.Len(t, pending, 1)
+
+	require.NoError(t, conn.WriteJSON(model.WSMessage{
+		Type: model.WSTypeAck,
+		Data: map[string]interface{}{"message_id": messageID.String()},
+	}))
+
+	assert.Eventually(t, func() bool {
+		client.ackMutex.Lock()
+		defer client.ackMutex.Unlock()
+		return len(client.unacked) == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return hub.pendingMessages(context.Background(), userID) == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestOwnMessagesNeedNoAck(t *testing.T) {
+	hub := NewHub(newTestRedis(t))
+	go hub.Run()
+
+	userID := uuid.New()
+	client, conn := connectTestClient(t, hub, userID)
+
+	data := map[string]interface{}{
+		"message_id": uuid.New().String(),
+		"user_id":    userID.String(),
+	}
+	client.send <- newFrame(hub.createMessage(model.WSTypeMessage, data), model.WSTypeMessage, data)
+	readTestMessage(t, conn, time.Second)
+
+	client.ackMutex.Lock()
+	defer client.ackMutex.Unlock()
+	assert.Empty(t, client.unacked)
+}
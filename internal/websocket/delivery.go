@@ -0,0 +1,160 @@
+package websocket
+
+import (
+	"context"
+	"time"
+
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// deliveryBatchSize is how many receipts are stored in one write
+	deliveryBatchSize = 200
+	// deliveryFlushInterval bounds how long a receipt waits to be stored
+	deliveryFlushInterval = time.Second
+	// deliveryQueueSize is how many receipts can wait before new ones are dropped
+	deliveryQueueSize = 4096
+)
+
+// DeliveryRecorder stores the delivery receipts collected by the hub
+type DeliveryRecorder func(ctx context.Context, deliveries []model.MessageDelivery) error
+
+// deliveryBatcher collects receipts from the write pumps and stores them in
+// batches, so writing to a client never waits on the database
+type deliveryBatcher struct {
+	record DeliveryRecorder
+	queue  chan model.MessageDelivery
+}
+
+func newDeliveryBatcher(record DeliveryRecorder) *deliveryBatcher {
+	return &deliveryBatcher{
+		record: record,
+		queue:  make(chan model.MessageDelivery, deliveryQueueSize),
+	}
+}
+
+// add queues a receipt. Receipts are dropped rather than blocking the
+// caller when the queue is full; clients can still acknowledge them over HTTP.
+func (b *deliveryBatcher) add(delivery model.MessageDelivery) {
+	select {
+	case b.queue <- delivery:
+	default:
+		logger.Warn("Delivery receipt queue full, dropping receipt", logger.WithFields(map[string]interface{}{
+			"message_id": delivery.MessageID,
+			"user_id":    delivery.UserID,
+		}))
+	}
+}
+
+// run stores queued receipts until ctx is cancelled, then flushes what is left
+func (b *deliveryBatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(deliveryFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]model.MessageDelivery, 0, deliveryBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := b.record(context.Background(), batch); err != nil {
+			logger.Error("Failed to record message deliveries", logger.WithFields(map[string]interface{}{
+				"error": err.Error(),
+				"count": len(batch),
+			}))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case delivery := <-b.queue:
+					batch = append(batch, delivery)
+				default:
+					flush()
+					return
+				}
+			}
+		case delivery := <-b.queue:
+			batch = append(batch, delivery)
+			if len(batch) >= deliveryBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// frame is a serialized message waiting in a client's send queue
+type frame struct {
+	payload []byte
+
+	// Set on chat message frames so their delivery can be recorded once written
+	messageID uuid.UUID
+	senderID  uuid.UUID
+}
+
+// newFrame wraps a serialized message, keeping the IDs needed to record the
+// delivery of chat messages
+func newFrame(payload []byte, msgType model.WSMessageType, data interface{}) frame {
+	f := frame{payload: payload}
+	if msgType != model.WSTypeMessage {
+		return f
+	}
+
+	fields, ok := data.(map[string]interface{})
+	if !ok {
+		return f
+	}
+	f.messageID = uuidField(fields, "message_id")
+	f.senderID = uuidField(fields, "user_id")
+	return f
+}
+
+// uuidField reads an ID from event data, which holds strings once it has
+// passed through Redis
+func uuidField(fields map[string]interface{}, key string) uuid.UUID {
+	switch value := fields[key].(type) {
+	case uuid.UUID:
+		return value
+	case string:
+		id, _ := uuid.Parse(value)
+		return id
+	}
+	return uuid.Nil
+}
+
+// StartDeliveryRecording makes the hub record a delivery receipt whenever a
+// chat message is written to a client other than its sender
+func (h *Hub) StartDeliveryRecording(ctx context.Context, record DeliveryRecorder) {
+	batcher := newDeliveryBatcher(record)
+	h.deliveries.Store(batcher)
+	go batcher.run(ctx)
+}
+
+// recordDelivered queues receipts for the chat messages in frames written to
+// a client of userID
+func (h *Hub) recordDelivered(userID uuid.UUID, frames []frame) {
+	batcher := h.deliveries.Load()
+	if batcher == nil {
+		return
+	}
+
+	now := time.Now()
+	for _, f := range frames {
+		if f.messageID == uuid.Nil || f.senderID == userID {
+			continue
+		}
+		batcher.add(model.MessageDelivery{
+			MessageID:   f.messageID,
+			UserID:      userID,
+			DeliveredAt: now,
+		})
+	}
+}
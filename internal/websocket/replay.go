@@ -0,0 +1,150 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"realtime-api/internal/events"
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// replayLimit caps the events replayed on reconnect so they fit in the send
+// queue next to the auth confirmation
+const replayLimit = 200
+
+// RoomLister returns the rooms a user belongs to
+type RoomLister func(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+
+// SetRoomLister makes the hub join new connections to the user's rooms, and
+// lets reconnecting clients replay the room events they missed
+func (h *Hub) SetRoomLister(list RoomLister) {
+	h.roomLister.Store(&list)
+}
+
+// userRoomIDs returns the rooms of a user, falling back to the rooms the hub
+// has seen them join when no lister is set
+func (h *Hub) userRoomIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	if list := h.roomLister.Load(); list != nil {
+		return (*list)(ctx, userID)
+	}
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return append([]uuid.UUID(nil), h.userRooms[userID]...), nil
+}
+
+// missedEvents returns the events of the rooms published since lastEventID,
+// oldest first. Events published in the same millisecond as lastEventID may
+// be sent again, so clients should ignore IDs they have already seen.
+func (h *Hub) missedEvents(ctx context.Context, roomIDs []uuid.UUID, lastEventID string) ([]frame, error) {
+	since, ok, err := h.redis.GetEventTime(ctx, lastEventID)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	var missed []events.Event
+	for _, roomID := range roomIDs {
+		payloads, err := h.redis.GetRoomEventsSince(ctx, roomID.String(), since, replayLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, payload := range payloads {
+			var event events.Event
+			if err := json.Unmarshal([]byte(payload), &event); err != nil {
+				logger.Warn("Skipping malformed room event", logger.WithField("room_id", roomID.String()))
+				continue
+			}
+			if event.ID != lastEventID {
+				missed = append(missed, event)
+			}
+		}
+	}
+
+	sort.SliceStable(missed, func(i, j int) bool {
+		return missed[i].Timestamp.Before(missed[j].Timestamp)
+	})
+	if len(missed) > replayLimit {
+		missed = missed[len(missed)-replayLimit:]
+	}
+
+	frames := make([]frame, 0, len(missed))
+	for i := range missed {
+		msgBytes, _ := json.Marshal(Message{
+			Type:      model.WSTypeReplay,
+			Data:      missed[i],
+			Timestamp: time.Now(),
+			ID:        missed[i].ID,
+		})
+		frames = append(frames, frame{payload: msgBytes})
+	}
+	return frames, nil
+}
+
+// prepareConnection loads the rooms a new client joins once registered and,
+// when it reconnects with the ID of the last event it saw, what it missed
+func (h *Hub) prepareConnection(ctx context.Context, client *Client, lastEventID string) {
+	if h.roomLister.Load() == nil && lastEventID == "" {
+		return
+	}
+
+	roomIDs, err := h.userRoomIDs(ctx, client.userID)
+	if err != nil {
+		logger.Warn("Failed to load rooms of connecting user", logger.WithFields(map[string]interface{}{
+			"user_id": client.userID.String(),
+			"error":   err.Error(),
+		}))
+		return
+	}
+	if h.roomLister.Load() != nil {
+		client.joinRooms = roomIDs
+	}
+
+	if lastEventID == "" {
+		return
+	}
+	if _, err := uuid.Parse(lastEventID); err != nil {
+		return
+	}
+	client.replay, err = h.missedEvents(ctx, roomIDs, lastEventID)
+	if err != nil {
+		logger.Warn("Failed to load missed room events", logger.WithFields(map[string]interface{}{
+			"user_id":       client.userID.String(),
+			"last_event_id": lastEventID,
+			"error":         err.Error(),
+		}))
+	}
+}
+
+// startStream queues the replayed events of a newly registered client and
+// joins it to its rooms, so live room events follow the replay. Callers hold
+// the hub mutex.
+func (h *Hub) startStream(client *Client) {
+replay:
+	for _, f := range client.replay {
+		select {
+		case client.send <- f:
+		default:
+			logger.Warn("Replay exceeded send queue", logger.WithField("user_id", client.userID.String()))
+			break replay
+		}
+	}
+	client.replay = nil
+
+	for _, roomID := range client.joinRooms {
+		if _, exists := h.rooms[roomID]; !exists {
+			h.rooms[roomID] = make(map[*Client]bool)
+		}
+		h.rooms[roomID][client] = true
+		client.mutex.Lock()
+		client.rooms[roomID] = true
+		client.mutex.Unlock()
+		h.addUserRoom(client.userID, roomID)
+	}
+	h.recordRoomPeaks(client.joinRooms)
+	client.joinRooms = nil
+}
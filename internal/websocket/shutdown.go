@@ -0,0 +1,105 @@
+package websocket
+
+import (
+	"context"
+	"time"
+
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// shutdownRetryAfter is the number of seconds clients are told to wait
+	// before reconnecting to a restarting server
+	shutdownRetryAfter = 5
+	// drainPollInterval is how often Shutdown checks the send queues
+	drainPollInterval = 50 * time.Millisecond
+)
+
+// ShuttingDown reports whether Shutdown was called; new connections are
+// refused from then on
+func (h *Hub) ShuttingDown() bool {
+	return h.shuttingDown.Load()
+}
+
+// Shutdown tells every connected client the server is going away, waits for
+// their send queues to drain and then closes the connections. It returns the
+// context error when ctx ends first; the connections are closed either way.
+// The read pumps keep handling frames until their connection closes; they
+// answer through Client.reply, which drops replies to closed queues.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.shuttingDown.Store(true)
+
+	notice := frame{payload: h.createMessage(model.WSTypeError, map[string]interface{}{
+		"code":        "SERVER_SHUTDOWN",
+		"retry_after": shutdownRetryAfter,
+	})}
+	h.mutex.Lock()
+	clients := len(h.clients)
+	for client := range h.clients {
+		client.closeMessage = websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server shutdown")
+		select {
+		case client.send <- notice:
+		default:
+		}
+	}
+	h.mutex.Unlock()
+
+	logger.Info("Draining WebSocket connections", logger.WithField("clients", clients))
+
+	err := h.waitForDrain(ctx)
+
+	h.mutex.Lock()
+	for client := range h.clients {
+		h.dropClient(client)
+	}
+	h.mutex.Unlock()
+
+	// The write pumps finish once they wrote the close frame
+	done := make(chan struct{})
+	go func() {
+		h.pumps.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		logger.Warn("WebSocket connections closed before draining", logger.WithField("error", err.Error()))
+	} else {
+		logger.Info("WebSocket connections closed")
+	}
+	return err
+}
+
+// waitForDrain waits until no client has frames left to write
+func (h *Hub) waitForDrain(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for !h.drained() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+func (h *Hub) drained() bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	for client := range h.clients {
+		if len(client.send) > 0 {
+			return false
+		}
+	}
+	return true
+}
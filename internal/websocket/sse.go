@@ -0,0 +1,155 @@
+package websocket
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"realtime-api/internal/jwt"
+	"realtime-api/internal/logger"
+	"realtime-api/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// sseClient is a Server-Sent Events connection. SSE only pushes from the
+// server, so these clients send typing indicators over the REST endpoints.
+type sseClient struct {
+	id       uuid.UUID
+	userID   uuid.UUID
+	username string
+	send     chan frame
+	rooms    map[uuid.UUID]bool
+
+	// done is closed when the hub drops the client for falling behind
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// drop tells the stream handler to end the connection. It is safe to call
+// more than once and while the hub mutex is only read locked.
+func (s *sseClient) drop() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+// push queues a frame, dropping the client when its queue is full. Callers
+// hold the hub mutex.
+func (s *sseClient) push(f frame) {
+	select {
+	case s.send <- f:
+	default:
+		s.drop()
+	}
+}
+
+// registerSSE adds an SSE client in the rooms the user is known to be in
+func (h *Hub) registerSSE(claims *jwt.Claims) *sseClient {
+	client := &sseClient{
+		id:       uuid.New(),
+		userID:   claims.UserID,
+		username: claims.Username,
+		send:     make(chan frame, 256),
+		rooms:    make(map[uuid.UUID]bool),
+		done:     make(chan struct{}),
+	}
+
+	h.mutex.Lock()
+	for _, roomID := range h.userRooms[client.userID] {
+		client.rooms[roomID] = true
+	}
+	h.sseClients[client.id] = client
+	h.recordRoomPeaks(h.userRooms[client.userID])
+	h.mutex.Unlock()
+
+	logger.Info("SSE client connected", logger.WithFields(map[string]interface{}{
+		"user_id":  client.userID.String(),
+		"username": client.username,
+	}))
+	return client
+}
+
+func (h *Hub) unregisterSSE(client *sseClient) {
+	h.mutex.Lock()
+	delete(h.sseClients, client.id)
+	h.mutex.Unlock()
+
+	logger.Info("SSE client disconnected", logger.WithFields(map[string]interface{}{
+		"user_id":  client.userID.String(),
+		"username": client.username,
+	}))
+}
+
+// SSEConnectionCount returns the number of connected SSE clients
+func (h *Hub) SSEConnectionCount() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.sseClients)
+}
+
+// HandleSSE streams the events of the user's rooms as Server-Sent Events,
+// for clients such as the browser EventSource API that can't use WebSocket.
+// It authenticates like HandleWebSocket, with the token query parameter or
+// the Authorization header.
+func HandleSSE(c echo.Context) error {
+	claims, err := authenticate(c)
+	if err != nil {
+		return err
+	}
+
+	flusher, ok := c.Response().Writer.(http.Flusher)
+	if !ok {
+		return echo.NewHTTPError(http.StatusInternalServerError, "streaming is not supported")
+	}
+
+	// The stream outlives the server write timeout
+	if err := http.NewResponseController(c.Response()).SetWriteDeadline(time.Time{}); err != nil {
+		logger.Debug("Failed to clear SSE write deadline", logger.WithField("error", err.Error()))
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.Response().WriteHeader(http.StatusOK)
+
+	hub := GlobalHub
+	client := hub.registerSSE(claims)
+	defer hub.unregisterSSE(client)
+
+	client.push(frame{payload: hub.createMessage(model.WSTypeAuth, map[string]interface{}{
+		"status":  "connected",
+		"user_id": client.userID,
+	})})
+
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	w := c.Response()
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+
+		case <-client.done:
+			logger.Warn("SSE client fell behind, closing stream", logger.WithField("user_id", client.userID.String()))
+			return nil
+
+		case message := <-client.send:
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", message.payload); err != nil {
+				return nil
+			}
+			flusher.Flush()
+			hub.recordDelivered(client.userID, []frame{message})
+
+		case <-ticker.C:
+			// Comments keep proxies from closing an idle stream
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return nil
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"realtime-api/internal/config"
 	"realtime-api/internal/events"
+	"realtime-api/internal/health"
 	"realtime-api/internal/jwt"
 	"realtime-api/internal/logger"
 	"realtime-api/internal/model"
@@ -19,26 +22,55 @@ import (
 )
 
 type Hub struct {
-	clients        map[*Client]bool
-	rooms          map[uuid.UUID]map[*Client]bool
-	userRooms      map[uuid.UUID][]uuid.UUID // user_id -> room_ids
-	register       chan *Client
-	unregister     chan *Client
-	broadcast      chan []byte
-	mutex          sync.RWMutex
-	eventPublisher *events.EventPublisher
-	redis          *redis.Redis
+	clients             map[*Client]bool
+	rooms               map[uuid.UUID]map[*Client]bool
+	userRooms           map[uuid.UUID][]uuid.UUID // user_id -> room_ids
+	userConnectionCount map[uuid.UUID]int
+	sseClients          map[uuid.UUID]*sseClient // connection id -> SSE client
+	register            chan *Client
+	unregister          chan *Client
+	broadcast           chan []byte
+	mutex               sync.RWMutex
+	eventPublisher      *events.EventPublisher
+	redis               *redis.Redis
+	deliveries          atomic.Pointer[deliveryBatcher]
+	postChecker         atomic.Pointer[PostChecker]
+	roomLister          atomic.Pointer[RoomLister]
+	blockLister         atomic.Pointer[BlockLister]
+	statusSetter        atomic.Pointer[StatusSetter]
+
+	// pumps tracks the running write pumps so Shutdown can wait for them
+	pumps        sync.WaitGroup
+	shuttingDown atomic.Bool
+
+	// maxConnectionsPerUser caps the concurrent connections of one user
+	maxConnectionsPerUser int
 }
 
 type Client struct {
 	hub      *Hub
 	conn     *websocket.Conn
-	send     chan []byte
+	send     chan frame
 	userID   uuid.UUID
 	username string
 	deviceID string
 	rooms    map[uuid.UUID]bool
 	mutex    sync.RWMutex
+
+	connectedAt time.Time
+	// replay and joinRooms are set before registration: the missed events
+	// to send, then the rooms to join for live events
+	replay    []frame
+	joinRooms []uuid.UUID
+	// closeMessage is sent as the close frame when the hub drops the client
+	closeMessage []byte
+	// sendClosed is set once send is closed, see closeSend and reply
+	sendClosed bool
+	sendMutex  sync.Mutex
+
+	// unacked holds the chat messages written but not yet acknowledged
+	unacked  map[uuid.UUID]*unackedFrame
+	ackMutex sync.Mutex
 }
 
 type Message struct {
@@ -90,16 +122,31 @@ const (
 	maxMessageSize = 512
 )
 
+// CloseTooManyConnections is the close code sent to a connection dropped
+// because its user opened more than the allowed number of connections
+const CloseTooManyConnections = 4008
+
+// defaultMaxConnectionsPerUser applies when no limit is configured
+const defaultMaxConnectionsPerUser = 5
+
 func NewHub(redis *redis.Redis) *Hub {
+	maxConnections := defaultMaxConnectionsPerUser
+	if cfg := config.GetConfig(); cfg != nil && cfg.WebSocket.MaxConnectionsPerUser > 0 {
+		maxConnections = cfg.WebSocket.MaxConnectionsPerUser
+	}
+
 	return &Hub{
-		clients:        make(map[*Client]bool),
-		rooms:          make(map[uuid.UUID]map[*Client]bool),
-		userRooms:      make(map[uuid.UUID][]uuid.UUID),
-		register:       make(chan *Client),
-		unregister:     make(chan *Client),
-		broadcast:      make(chan []byte, 256),
-		eventPublisher: events.NewEventPublisher(redis),
-		redis:          redis,
+		clients:               make(map[*Client]bool),
+		rooms:                 make(map[uuid.UUID]map[*Client]bool),
+		userRooms:             make(map[uuid.UUID][]uuid.UUID),
+		userConnectionCount:   make(map[uuid.UUID]int),
+		sseClients:            make(map[uuid.UUID]*sseClient),
+		register:              make(chan *Client),
+		unregister:            make(chan *Client),
+		broadcast:             make(chan []byte, 256),
+		eventPublisher:        events.NewEventPublisher(redis),
+		redis:                 redis,
+		maxConnectionsPerUser: maxConnections,
 	}
 }
 
@@ -108,7 +155,36 @@ func (h *Hub) Run() {
 		select {
 		case client := <-h.register:
 			h.mutex.Lock()
+			// Connections that raced with Shutdown are closed right away
+			if h.shuttingDown.Load() {
+				client.closeMessage = websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server shutdown")
+				client.closeSend()
+				h.mutex.Unlock()
+				continue
+			}
+			if h.userConnectionCount[client.userID] >= h.maxConnectionsPerUser {
+				if oldest := h.oldestClient(client.userID); oldest != nil {
+					oldest.closeMessage = websocket.FormatCloseMessage(CloseTooManyConnections, "too many connections")
+					h.dropClient(oldest)
+
+					logger.Warn("Connection limit reached, closing oldest connection", logger.WithFields(map[string]interface{}{
+						"user_id":   client.userID.String(),
+						"device_id": oldest.deviceID,
+						"limit":     h.maxConnectionsPerUser,
+					}))
+				}
+			}
 			h.clients[client] = true
+			h.userConnectionCount[client.userID]++
+
+			// Send confirmation message, then any missed events before the
+			// client joins its rooms' live stream
+			client.send <- frame{payload: h.createMessage(model.WSTypeAuth, map[string]interface{}{
+				"status":  "connected",
+				"user_id": client.userID,
+			})}
+			h.startStream(client)
+			h.updateGauges()
 			h.mutex.Unlock()
 
 			logger.Info("Client connected", logger.WithFields(map[string]interface{}{
@@ -117,19 +193,12 @@ func (h *Hub) Run() {
 				"device_id": client.deviceID,
 			}))
 
-			// Send confirmation message
-			client.send <- h.createMessage(model.WSTypeAuth, map[string]interface{}{
-				"status":  "connected",
-				"user_id": client.userID,
-			})
-
 		case client := <-h.unregister:
 			h.mutex.Lock()
 			if _, ok := h.clients[client]; ok {
-				h.removeClientFromAllRooms(client)
-				delete(h.clients, client)
-				close(client.send)
+				h.dropClient(client)
 			}
+			h.updateGauges()
 			h.mutex.Unlock()
 
 			logger.Info("Client disconnected", logger.WithFields(map[string]interface{}{
@@ -139,21 +208,141 @@ func (h *Hub) Run() {
 			}))
 
 		case message := <-h.broadcast:
+			// Slow clients are collected under the read lock and dropped
+			// under the write lock once it is released
+			var slow []*Client
 			h.mutex.RLock()
 			for client := range h.clients {
 				select {
-				case client.send <- message:
+				case client.send <- frame{payload: message}:
 				default:
-					h.removeClientFromAllRooms(client)
-					delete(h.clients, client)
-					close(client.send)
+					slow = append(slow, client)
 				}
 			}
 			h.mutex.RUnlock()
+
+			h.dropClients(slow)
 		}
 	}
 }
 
+// updateGauges exports the number of connections and rooms. Callers hold the
+// hub mutex.
+func (h *Hub) updateGauges() {
+	health.ActiveWebSocketConnections.Set(float64(len(h.clients)))
+	health.ActiveRooms.Set(float64(len(h.rooms)))
+}
+
+// dropClient forgets a registered client and closes its send queue, which
+// makes the write pump close the connection. Clients are only ever removed
+// here, so dropping one twice does nothing. Callers hold the hub mutex for
+// writing.
+func (h *Hub) dropClient(client *Client) {
+	if !h.clients[client] {
+		return
+	}
+	delete(h.clients, client)
+	h.removeClientFromAllRooms(client)
+	client.closeSend()
+
+	if h.userConnectionCount[client.userID] <= 1 {
+		delete(h.userConnectionCount, client.userID)
+	} else {
+		h.userConnectionCount[client.userID]--
+	}
+}
+
+// dropClients drops the clients a broadcast found too slow, once the
+// broadcast released the hub mutex
+func (h *Hub) dropClients(clients []*Client) {
+	if len(clients) == 0 {
+		return
+	}
+
+	h.mutex.Lock()
+	for _, client := range clients {
+		h.dropClient(client)
+	}
+	h.updateGauges()
+	h.mutex.Unlock()
+}
+
+// closeSend closes the send queue of the client; later calls do nothing
+func (c *Client) closeSend() {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+
+	if !c.sendClosed {
+		c.sendClosed = true
+		close(c.send)
+	}
+}
+
+// reply queues a frame answering a message of the client. The read pump
+// keeps running after the hub dropped the client, so replies to a closed
+// queue are dropped, as are replies to a full one rather than stalling the
+// read loop.
+func (c *Client) reply(f frame) {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+
+	if c.sendClosed {
+		return
+	}
+	select {
+	case c.send <- f:
+	default:
+		logger.Warn("Send queue full, dropping reply", logger.WithField("user_id", c.userID.String()))
+	}
+}
+
+// oldestClient returns the longest connected client of a user
+func (h *Hub) oldestClient(userID uuid.UUID) *Client {
+	var oldest *Client
+	for client := range h.clients {
+		if client.userID == userID && (oldest == nil || client.connectedAt.Before(oldest.connectedAt)) {
+			oldest = client
+		}
+	}
+	return oldest
+}
+
+// ConnectionCount returns the number of connected clients
+func (h *Hub) ConnectionCount() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.clients)
+}
+
+// HubStats is a snapshot of the hub's connections
+type HubStats struct {
+	Connections    int `json:"connections"`
+	SSEConnections int `json:"sse_connections"`
+	// RoomClients counts the connected clients of each room with any
+	RoomClients map[uuid.UUID]int `json:"room_clients"`
+}
+
+// Stats returns the hub's connection counts
+func (h *Hub) Stats() HubStats {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	stats := HubStats{
+		Connections:    len(h.clients),
+		SSEConnections: len(h.sseClients),
+		RoomClients:    make(map[uuid.UUID]int, len(h.rooms)),
+	}
+	for roomID, clients := range h.rooms {
+		stats.RoomClients[roomID] = len(clients)
+	}
+	return stats
+}
+
+// MaxConnectionsPerUser returns how many connections one user may keep open
+func (h *Hub) MaxConnectionsPerUser() int {
+	return h.maxConnectionsPerUser
+}
+
 func (h *Hub) removeClientFromAllRooms(client *Client) {
 	client.mutex.RLock()
 	for roomID := range client.rooms {
@@ -166,24 +355,33 @@ func (h *Hub) removeClientFromAllRooms(client *Client) {
 	}
 	client.mutex.RUnlock()
 
-	// Clear user rooms mapping
+	// Clear user rooms mapping. The hub mutex is held already, so the
+	// clients too slow for the notice are dropped right here.
 	if rooms, exists := h.userRooms[client.userID]; exists {
+		data := map[string]interface{}{
+			"user_id":  client.userID,
+			"username": client.username,
+		}
 		for _, roomID := range rooms {
-			h.broadcastToRoom(roomID, model.WSTypeUserLeave, map[string]interface{}{
-				"user_id":  client.userID,
-				"username": client.username,
-			})
+			message := newFrame(h.createMessageWithID(uuid.New().String(), model.WSTypeUserLeave, data), model.WSTypeUserLeave, data)
+			for _, slow := range h.sendToRoom(roomID, message, nil) {
+				h.dropClient(slow)
+			}
 		}
 		delete(h.userRooms, client.userID)
 	}
 }
 
 func (h *Hub) createMessage(msgType model.WSMessageType, data interface{}) []byte {
+	return h.createMessageWithID(uuid.New().String(), msgType, data)
+}
+
+func (h *Hub) createMessageWithID(id string, msgType model.WSMessageType, data interface{}) []byte {
 	msg := Message{
 		Type:      msgType,
 		Data:      data,
 		Timestamp: time.Now(),
-		ID:        uuid.New().String(),
+		ID:        id,
 	}
 
 	msgBytes, _ := json.Marshal(msg)
@@ -193,6 +391,7 @@ func (h *Hub) createMessage(msgType model.WSMessageType, data interface{}) []byt
 func (h *Hub) JoinRoom(userID, roomID uuid.UUID) {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
+	defer h.updateGauges()
 
 	if _, exists := h.rooms[roomID]; !exists {
 		h.rooms[roomID] = make(map[*Client]bool)
@@ -207,8 +406,58 @@ func (h *Hub) JoinRoom(userID, roomID uuid.UUID) {
 			client.mutex.Unlock()
 		}
 	}
+	for _, client := range h.sseClients {
+		if client.userID == userID {
+			client.rooms[roomID] = true
+		}
+	}
 
-	// Update user rooms mapping
+	h.addUserRoom(userID, roomID)
+	h.recordRoomPeaks([]uuid.UUID{roomID})
+}
+
+// roomConnections counts the connections receiving the events of a room.
+// Callers hold the hub mutex.
+func (h *Hub) roomConnections(roomID uuid.UUID) int64 {
+	connections := int64(len(h.rooms[roomID]))
+	for _, client := range h.sseClients {
+		if client.rooms[roomID] {
+			connections++
+		}
+	}
+	return connections
+}
+
+// recordRoomPeaks stores the connection counts of rooms that just gained
+// connections, keeping the peak of each room for its stats. Callers hold the
+// hub mutex.
+func (h *Hub) recordRoomPeaks(roomIDs []uuid.UUID) {
+	if len(roomIDs) == 0 {
+		return
+	}
+
+	counts := make(map[uuid.UUID]int64, len(roomIDs))
+	for _, roomID := range roomIDs {
+		counts[roomID] = h.roomConnections(roomID)
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), writeWait)
+		defer cancel()
+		for roomID, connections := range counts {
+			if err := h.redis.RecordRoomConnections(ctx, roomID.String(), connections); err != nil {
+				logger.Warn("Failed to record room connections", logger.WithFields(map[string]interface{}{
+					"room_id": roomID.String(),
+					"error":   err.Error(),
+				}))
+			}
+		}
+	}()
+}
+
+// addUserRoom records that the user is in the room. Callers hold the hub
+// mutex.
+func (h *Hub) addUserRoom(userID, roomID uuid.UUID) {
 	if rooms, exists := h.userRooms[userID]; exists {
 		// Check if room already exists in user's rooms
 		found := false
@@ -229,6 +478,7 @@ func (h *Hub) JoinRoom(userID, roomID uuid.UUID) {
 func (h *Hub) LeaveRoom(userID, roomID uuid.UUID) {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
+	defer h.updateGauges()
 
 	if room, exists := h.rooms[roomID]; exists {
 		// Remove user from room for all their clients
@@ -245,6 +495,11 @@ func (h *Hub) LeaveRoom(userID, roomID uuid.UUID) {
 			delete(h.rooms, roomID)
 		}
 	}
+	for _, client := range h.sseClients {
+		if client.userID == userID {
+			delete(client.rooms, roomID)
+		}
+	}
 
 	// Update user rooms mapping
 	if rooms, exists := h.userRooms[userID]; exists {
@@ -262,54 +517,126 @@ func (h *Hub) LeaveRoom(userID, roomID uuid.UUID) {
 	}
 }
 
-func (h *Hub) broadcastToRoom(roomID uuid.UUID, msgType model.WSMessageType, data interface{}) {
-	message := h.createMessage(msgType, data)
+func (h *Hub) broadcastToRoom(roomID uuid.UUID, id string, msgType model.WSMessageType, data interface{}) {
+	message := newFrame(h.createMessageWithID(id, msgType, data), msgType, data)
+	hidden := h.hiddenFrom(msgType, data)
 
 	h.mutex.RLock()
-	if room, exists := h.rooms[roomID]; exists {
-		for client := range room {
-			select {
-			case client.send <- message:
-			default:
-				delete(room, client)
-				close(client.send)
-			}
+	slow := h.sendToRoom(roomID, message, hidden)
+	h.mutex.RUnlock()
+
+	h.dropClients(slow)
+}
+
+// sendToRoom queues message for the connections in the room, skipping the
+// hidden users, and returns the clients whose send queue is full. Callers
+// hold the hub mutex.
+func (h *Hub) sendToRoom(roomID uuid.UUID, message frame, hidden map[uuid.UUID]bool) []*Client {
+	var slow []*Client
+	for client := range h.rooms[roomID] {
+		if hidden[client.userID] {
+			continue
+		}
+		select {
+		case client.send <- message:
+		default:
+			slow = append(slow, client)
 		}
 	}
-	h.mutex.RUnlock()
+	for _, client := range h.sseClients {
+		if client.rooms[roomID] && !hidden[client.userID] {
+			client.push(message)
+		}
+	}
+	return slow
 }
 
 // BroadcastToRoom is the public method for broadcasting to a room
 func (h *Hub) BroadcastToRoom(roomID uuid.UUID, msgType model.WSMessageType, data interface{}) {
-	h.broadcastToRoom(roomID, msgType, data)
+	h.broadcastToRoom(roomID, uuid.New().String(), msgType, data)
+}
+
+// BroadcastEventToRoom broadcasts a recorded room event, using its ID as the
+// message ID so clients can pass it as last_event_id when they reconnect
+func (h *Hub) BroadcastEventToRoom(roomID uuid.UUID, eventID string, msgType model.WSMessageType, data interface{}) {
+	h.broadcastToRoom(roomID, eventID, msgType, data)
 }
 
 func (h *Hub) BroadcastToUser(userID uuid.UUID, msgType model.WSMessageType, data interface{}) {
-	message := h.createMessage(msgType, data)
+	message := newFrame(h.createMessage(msgType, data), msgType, data)
 
+	var slow []*Client
 	h.mutex.RLock()
 	for client := range h.clients {
 		if client.userID == userID {
 			select {
 			case client.send <- message:
 			default:
-				h.removeClientFromAllRooms(client)
-				delete(h.clients, client)
-				close(client.send)
+				slow = append(slow, client)
 			}
 		}
 	}
+	for _, client := range h.sseClients {
+		if client.userID == userID {
+			client.push(message)
+		}
+	}
 	h.mutex.RUnlock()
+
+	h.dropClients(slow)
 }
 
 func HandleWebSocket(c echo.Context) error {
+	if GlobalHub.ShuttingDown() {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "server is shutting down")
+	}
+
 	conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
 	if err != nil {
 		logger.Error("WebSocket upgrade failed", logger.WithField("error", err.Error()))
 		return err
 	}
 
-	// Extract token from query parameter or header
+	claims, err := authenticate(c)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	client := &Client{
+		hub:      GlobalHub,
+		conn:     conn,
+		send:     make(chan frame, 256),
+		userID:   claims.UserID,
+		username: claims.Username,
+		deviceID: claims.DeviceID,
+		rooms:    make(map[uuid.UUID]bool),
+		unacked:  make(map[uuid.UUID]*unackedFrame),
+
+		connectedAt: time.Now(),
+	}
+
+	// A reconnecting client passes the ID of the last event it received to
+	// have the room events it missed replayed
+	client.hub.prepareConnection(c.Request().Context(), client, c.QueryParam("last_event_id"))
+	// Chat messages left unacknowledged by earlier connections follow the replay
+	client.replay = append(client.replay, client.hub.pendingMessages(c.Request().Context(), client.userID)...)
+	client.hub.register <- client
+
+	client.startPumps()
+	return nil
+}
+
+// startPumps starts the goroutines reading from and writing to the connection
+func (c *Client) startPumps() {
+	c.hub.pumps.Add(1)
+	go c.writePump()
+	go c.readPump()
+}
+
+// authenticate validates the token of a streaming connection, taken from the
+// token query parameter or the Authorization header
+func authenticate(c echo.Context) (*jwt.Claims, error) {
 	token := c.QueryParam("token")
 	if token == "" {
 		token = c.Request().Header.Get("Authorization")
@@ -319,34 +646,20 @@ func HandleWebSocket(c echo.Context) error {
 	}
 
 	if token == "" {
-		conn.Close()
-		return echo.NewHTTPError(http.StatusUnauthorized, "missing authentication token")
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "missing authentication token")
 	}
 
 	// Validate JWT token
 	claims, err := jwt.GetService().ValidateToken(token)
 	if err != nil {
-		conn.Close()
-		return echo.NewHTTPError(http.StatusUnauthorized, "invalid token")
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "invalid token")
 	}
 
-	client := &Client{
-		hub:      GlobalHub,
-		conn:     conn,
-		send:     make(chan []byte, 256),
-		userID:   claims.UserID,
-		username: claims.Username,
-		deviceID: claims.DeviceID,
-		rooms:    make(map[uuid.UUID]bool),
+	// Reject tokens of revoked sessions
+	if revoked, err := redis.GetClient().IsTokenBlacklisted(c.Request().Context(), claims.ID); err != nil || revoked {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "invalid token")
 	}
-
-	client.hub.register <- client
-
-	// Start goroutines for reading and writing
-	go client.writePump()
-	go client.readPump()
-
-	return nil
+	return claims, nil
 }
 
 func (c *Client) readPump() {
@@ -383,9 +696,12 @@ func (c *Client) readPump() {
 
 func (c *Client) writePump() {
 	ticker := time.NewTicker(pingPeriod)
+	retryTicker := time.NewTicker(ackRetryInterval / 2)
 	defer func() {
 		ticker.Stop()
+		retryTicker.Stop()
 		c.conn.Close()
+		c.hub.pumps.Done()
 	}()
 
 	for {
@@ -393,7 +709,7 @@ func (c *Client) writePump() {
 		case message, ok := <-c.send:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				c.conn.WriteMessage(websocket.CloseMessage, c.closeMessage)
 				return
 			}
 
@@ -401,18 +717,28 @@ func (c *Client) writePump() {
 			if err != nil {
 				return
 			}
-			w.Write(message)
+			w.Write(message.payload)
+			written := []frame{message}
 
 			// Add queued chat messages to the current websocket message
 			n := len(c.send)
 			for i := 0; i < n; i++ {
+				queued := <-c.send
 				w.Write([]byte("\n"))
-				w.Write(<-c.send)
+				w.Write(queued.payload)
+				written = append(written, queued)
 			}
 
 			if err := w.Close(); err != nil {
 				return
 			}
+			c.hub.recordDelivered(c.userID, written)
+			c.trackUnacked(written)
+
+		case <-retryTicker.C:
+			if err := c.retryUnacked(); err != nil {
+				return
+			}
 
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
@@ -426,7 +752,7 @@ func (c *Client) writePump() {
 func (c *Client) handleMessage(wsMsg *model.WSMessage) {
 	switch wsMsg.Type {
 	case model.WSTypePing:
-		c.send <- c.hub.createMessage(model.WSTypePong, nil)
+		c.reply(frame{payload: c.hub.createMessage(model.WSTypePong, nil)})
 
 	case model.WSTypeTypingStart:
 		c.handleTypingStart(wsMsg.Data)
@@ -437,6 +763,9 @@ func (c *Client) handleMessage(wsMsg *model.WSMessage) {
 	case model.WSTypeUserStatusChange:
 		c.handleUserStatusChange(wsMsg.Data)
 
+	case model.WSTypeAck:
+		c.handleAck(wsMsg.Data)
+
 	default:
 		logger.Warn("Unknown WebSocket message type", logger.WithField("type", wsMsg.Type))
 	}
@@ -458,6 +787,17 @@ func (c *Client) handleTypingStart(data interface{}) {
 		return
 	}
 
+	// Members who can't post don't get to show as typing
+	if checker := c.hub.postChecker.Load(); checker != nil {
+		if err := (*checker)(context.Background(), roomID, c.userID); err != nil {
+			c.reply(frame{payload: c.hub.createMessage(model.WSTypeError, map[string]interface{}{
+				"room_id": roomID,
+				"message": err.Error(),
+			})})
+			return
+		}
+	}
+
 	// Publish typing event using event system
 	if c.hub.eventPublisher != nil {
 		ctx := context.Background()
@@ -465,7 +805,7 @@ func (c *Client) handleTypingStart(data interface{}) {
 	}
 
 	// Broadcast to room members
-	c.hub.broadcastToRoom(roomID, model.WSTypeTypingStart, map[string]interface{}{
+	c.hub.broadcastToRoom(roomID, uuid.New().String(), model.WSTypeTypingStart, map[string]interface{}{
 		"room_id":  roomID,
 		"user_id":  c.userID,
 		"username": c.username,
@@ -488,6 +828,13 @@ func (c *Client) handleTypingStop(data interface{}) {
 		return
 	}
 
+	// Members who can't post never started typing, so there's nothing to stop
+	if checker := c.hub.postChecker.Load(); checker != nil {
+		if err := (*checker)(context.Background(), roomID, c.userID); err != nil {
+			return
+		}
+	}
+
 	// Publish typing event using event system
 	if c.hub.eventPublisher != nil {
 		ctx := context.Background()
@@ -495,7 +842,7 @@ func (c *Client) handleTypingStop(data interface{}) {
 	}
 
 	// Broadcast to room members
-	c.hub.broadcastToRoom(roomID, model.WSTypeTypingStop, map[string]interface{}{
+	c.hub.broadcastToRoom(roomID, uuid.New().String(), model.WSTypeTypingStop, map[string]interface{}{
 		"room_id":  roomID,
 		"user_id":  c.userID,
 		"username": c.username,
@@ -513,24 +860,38 @@ func (c *Client) handleUserStatusChange(data interface{}) {
 		return
 	}
 
-	// Publish user status change using event system
-	if c.hub.eventPublisher != nil {
-		ctx := context.Background()
-		c.hub.eventPublisher.PublishUserEvent(ctx, events.UserStatusChange, c.userID, map[string]interface{}{
-			"status": status,
-		})
+	// The status is saved and announced like one set over REST; the
+	// presence event that follows reaches the user's rooms
+	setter := c.hub.statusSetter.Load()
+	if setter == nil {
+		return
+	}
+	if err := (*setter)(context.Background(), c.userID, model.UserStatus(status)); err != nil {
+		c.reply(frame{payload: c.hub.createMessage(model.WSTypeError, map[string]interface{}{
+			"status":  status,
+			"message": err.Error(),
+		})})
 	}
+}
 
-	// Broadcast status change to user's rooms
-	c.mutex.RLock()
-	for roomID := range c.rooms {
-		c.hub.broadcastToRoom(roomID, model.WSTypeUserStatusChange, map[string]interface{}{
-			"user_id":  c.userID,
-			"username": c.username,
-			"status":   status,
-		})
+// BroadcastPresence sends a presence update of userID to every room they
+// belong to. data carries the status the other members may see.
+func (h *Hub) BroadcastPresence(ctx context.Context, userID uuid.UUID, data map[string]interface{}) error {
+	roomIDs, err := h.userRoomIDs(ctx, userID)
+	if err != nil {
+		return err
 	}
-	c.mutex.RUnlock()
+
+	payload := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		payload[k] = v
+	}
+	payload["user_id"] = userID
+
+	for _, roomID := range roomIDs {
+		h.broadcastToRoom(roomID, uuid.New().String(), model.WSTypeUserStatusChange, payload)
+	}
+	return nil
 }
 
 func Init(redis *redis.Redis) {
@@ -540,6 +901,79 @@ func Init(redis *redis.Redis) {
 	logger.Info("WebSocket hub initialized")
 }
 
+// PostChecker reports why a user can't post in a room, or nil if they can
+type PostChecker func(ctx context.Context, roomID, userID uuid.UUID) error
+
+// SetPostChecker makes the hub check typing indicators against the room's
+// posting rules
+func (h *Hub) SetPostChecker(check PostChecker) {
+	h.postChecker.Store(&check)
+}
+
+// StatusSetter saves and announces the status a user picked
+type StatusSetter func(ctx context.Context, userID uuid.UUID, status model.UserStatus) error
+
+// SetStatusSetter handles the status changes clients send over the socket
+func (h *Hub) SetStatusSetter(set StatusSetter) {
+	h.statusSetter.Store(&set)
+}
+
+// BlockLister returns the users a user blocked or was blocked by
+type BlockLister func(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+
+// SetBlockLister keeps the typing and presence updates of a user from the
+// users they blocked or were blocked by
+func (h *Hub) SetBlockLister(list BlockLister) {
+	h.blockLister.Store(&list)
+}
+
+// hiddenFrom returns the users who must not see a typing or presence update
+// because of a block with the user it is about. Other messages go to everyone.
+func (h *Hub) hiddenFrom(msgType model.WSMessageType, data interface{}) map[uuid.UUID]bool {
+	switch msgType {
+	case model.WSTypeTypingStart, model.WSTypeTypingStop, model.WSTypeUserStatusChange:
+	default:
+		return nil
+	}
+
+	list := h.blockLister.Load()
+	if list == nil {
+		return nil
+	}
+	fields, ok := data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	var userID uuid.UUID
+	switch value := fields["user_id"].(type) {
+	case uuid.UUID:
+		userID = value
+	case *uuid.UUID:
+		if value == nil {
+			return nil
+		}
+		userID = *value
+	default:
+		return nil
+	}
+
+	blocked, err := (*list)(context.Background(), userID)
+	if err != nil {
+		logger.Warn("Failed to list blocked users", logger.WithField("error", err.Error()))
+		return nil
+	}
+	if len(blocked) == 0 {
+		return nil
+	}
+
+	hidden := make(map[uuid.UUID]bool, len(blocked))
+	for _, id := range blocked {
+		hidden[id] = true
+	}
+	return hidden
+}
+
 func GetHub() *Hub {
 	return GlobalHub
 }
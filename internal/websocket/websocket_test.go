@@ -0,0 +1,247 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"realtime-api/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroadcastHidesTypingAcrossBlocks(t *testing.T) {
+	hub := NewHub(newTestRedis(t))
+
+	roomID := uuid.New()
+	typist, blocked, other := uuid.New(), uuid.New(), uuid.New()
+	clients := map[uuid.UUID]*Client{}
+	hub.rooms[roomID] = map[*Client]bool{}
+	for _, userID := range []uuid.UUID{typist, blocked, other} {
+		client := &Client{hub: hub, send: make(chan frame, 4), userID: userID}
+		clients[userID] = client
+		hub.rooms[roomID][client] = true
+	}
+
+	hub.SetBlockLister(func(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+		if userID == typist {
+			return []uuid.UUID{blocked}, nil
+		}
+		return nil, nil
+	})
+
+	received := func(userID uuid.UUID) bool {
+		select {
+		case <-clients[userID].send:
+			return true
+		default:
+			return false
+		}
+	}
+
+	hub.BroadcastToRoom(roomID, model.WSTypeTypingStart, map[string]interface{}{"room_id": roomID, "user_id": &typist})
+	assert.True(t, received(typist))
+	assert.False(t, received(blocked))
+	assert.True(t, received(other))
+
+	// Only typing and presence are filtered
+	hub.BroadcastToRoom(roomID, model.WSTypeNotification, map[string]interface{}{"room_id": roomID, "user_id": typist})
+	for _, userID := range []uuid.UUID{typist, blocked, other} {
+		assert.True(t, received(userID))
+	}
+}
+
+func TestBroadcastPresence(t *testing.T) {
+	hub := NewHub(newTestRedis(t))
+
+	user, member := uuid.New(), uuid.New()
+	rooms := []uuid.UUID{uuid.New(), uuid.New()}
+	client := &Client{hub: hub, send: make(chan frame, 4), userID: member}
+	for _, roomID := range rooms {
+		hub.rooms[roomID] = map[*Client]bool{client: true}
+	}
+	hub.SetRoomLister(func(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+		assert.Equal(t, user, userID)
+		return rooms[:1], nil
+	})
+
+	require.NoError(t, hub.BroadcastPresence(context.Background(), user, map[string]interface{}{"status": "offline"}))
+	require.Len(t, client.send, 1)
+	update := <-client.send
+	assert.Contains(t, string(update.payload), `"status":"offline"`)
+	assert.Contains(t, string(update.payload), user.String())
+}
+
+func TestShutdownDrainsClients(t *testing.T) {
+	hub := NewHub(newTestRedis(t))
+	go hub.Run()
+
+	client, conn := connectTestClient(t, hub, uuid.New())
+	hub.register <- client
+	connected := readTestMessage(t, conn, time.Second)
+	assert.Equal(t, model.WSTypeAuth, connected.Type)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, hub.Shutdown(ctx))
+	assert.True(t, hub.ShuttingDown())
+	assert.Equal(t, 0, hub.ConnectionCount())
+
+	notice := readTestMessage(t, conn, time.Second)
+	assert.Equal(t, model.WSTypeError, notice.Type)
+	assert.Equal(t, map[string]interface{}{"code": "SERVER_SHUTDOWN", "retry_after": float64(shutdownRetryAfter)}, notice.Data)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseServiceRestart), "unexpected error: %v", err)
+}
+
+func TestShutdownWhileClientsPing(t *testing.T) {
+	hub := NewHub(newTestRedis(t))
+	go hub.Run()
+
+	client, conn := connectTestClient(t, hub, uuid.New())
+	hub.register <- client
+	assert.Equal(t, model.WSTypeAuth, readTestMessage(t, conn, time.Second).Type)
+
+	// Keep the read pump answering pings while the queues are closed
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if err := conn.WriteJSON(model.WSMessage{Type: model.WSTypePing}); err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, hub.Shutdown(ctx))
+	conn.Close()
+	<-done
+}
+
+func TestShutdownGivesUpOnStuckClients(t *testing.T) {
+	hub := NewHub(newTestRedis(t))
+
+	// Without a write pump the queue never drains
+	client := &Client{hub: hub, send: make(chan frame, 4), userID: uuid.New()}
+	hub.clients[client] = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, hub.Shutdown(ctx), context.DeadlineExceeded)
+	assert.Equal(t, 0, hub.ConnectionCount())
+}
+
+func TestSlowRoomClientIsDroppedOnce(t *testing.T) {
+	hub := NewHub(newTestRedis(t))
+
+	roomID := uuid.New()
+	slow := &Client{hub: hub, send: make(chan frame, 1), userID: uuid.New(), rooms: map[uuid.UUID]bool{roomID: true}}
+	hub.clients[slow] = true
+	hub.userConnectionCount[slow.userID] = 1
+	hub.rooms[roomID] = map[*Client]bool{slow: true}
+	slow.send <- frame{}
+
+	hub.BroadcastToRoom(roomID, model.WSTypeNotification, map[string]interface{}{"room_id": roomID})
+	assert.Equal(t, 0, hub.ConnectionCount())
+	assert.NotContains(t, hub.rooms, roomID)
+	<-slow.send
+	_, open := <-slow.send
+	assert.False(t, open)
+
+	// Removing it again must not close the queue a second time
+	go hub.Run()
+	hub.unregister <- slow
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NotPanics(t, func() { hub.Shutdown(ctx) })
+}
+
+// TestBroadcastDropsSlowClients broadcasts to a client that never reads while
+// other goroutines use the hub; run it with -race
+func TestBroadcastDropsSlowClients(t *testing.T) {
+	hub := NewHub(newTestRedis(t))
+
+	slow := &Client{hub: hub, send: make(chan frame, 1), userID: uuid.New(), rooms: make(map[uuid.UUID]bool)}
+	slow.send <- frame{}
+	hub.clients[slow] = true
+	hub.userConnectionCount[slow.userID] = 1
+	go hub.Run()
+
+	fast, conn := connectTestClient(t, hub, uuid.New())
+	hub.register <- fast
+	assert.Equal(t, model.WSTypeAuth, readTestMessage(t, conn, time.Second).Type)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				hub.broadcast <- hub.createMessage(model.WSTypeNotification, map[string]interface{}{"n": j})
+				hub.BroadcastToUser(slow.userID, model.WSTypeNotification, map[string]interface{}{"n": j})
+				hub.Stats()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Eventually(t, func() bool { return hub.ConnectionCount() == 1 }, time.Second, 10*time.Millisecond)
+	hub.mutex.RLock()
+	assert.True(t, hub.clients[fast])
+	assert.Equal(t, map[uuid.UUID]int{fast.userID: 1}, hub.userConnectionCount)
+	hub.mutex.RUnlock()
+
+	// Queued frames may be batched into one websocket message
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, payload, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Contains(t, string(payload), `"type":"notification"`)
+}
+
+func TestRepliesToDroppedClients(t *testing.T) {
+	hub := NewHub(newTestRedis(t))
+	client := &Client{hub: hub, send: make(chan frame, 1), userID: uuid.New(), rooms: make(map[uuid.UUID]bool)}
+	hub.clients[client] = true
+	hub.userConnectionCount[client.userID] = 1
+
+	// A full queue drops the reply instead of blocking the read pump
+	client.handleMessage(&model.WSMessage{Type: model.WSTypePing})
+	client.handleMessage(&model.WSMessage{Type: model.WSTypePing})
+	assert.Len(t, client.send, 1)
+
+	// The read pump of an evicted client keeps handling frames
+	hub.mutex.Lock()
+	hub.dropClient(client)
+	hub.mutex.Unlock()
+	assert.NotPanics(t, func() { client.handleMessage(&model.WSMessage{Type: model.WSTypePing}) })
+
+	// Muted members are told they can't type
+	hub.SetPostChecker(func(ctx context.Context, roomID, userID uuid.UUID) error {
+		return errors.New("you are muted in this room")
+	})
+	typing := &model.WSMessage{Type: model.WSTypeTypingStart, Data: map[string]interface{}{"room_id": uuid.NewString()}}
+	assert.NotPanics(t, func() { client.handleMessage(typing) })
+
+	// So are users picking a status they can't set
+	hub.SetStatusSetter(func(ctx context.Context, userID uuid.UUID, status model.UserStatus) error {
+		return errors.New("invalid status")
+	})
+	status := &model.WSMessage{Type: model.WSTypeUserStatusChange, Data: map[string]interface{}{"status": "sleeping"}}
+	assert.NotPanics(t, func() { client.handleMessage(status) })
+}
@@ -0,0 +1,29 @@
+BEGIN;
+
+DROP TABLE IF EXISTS "user_preferences";
+DROP TABLE IF EXISTS "activity_logs";
+DROP TABLE IF EXISTS "file_uploads";
+DROP TABLE IF EXISTS "notifications";
+DROP TABLE IF EXISTS "scheduled_messages";
+DROP TABLE IF EXISTS "message_drafts";
+DROP TABLE IF EXISTS "room_pinned_messages";
+DROP TABLE IF EXISTS "message_edits";
+DROP TABLE IF EXISTS "message_hiddens";
+DROP TABLE IF EXISTS "message_deliveries";
+DROP TABLE IF EXISTS "message_reads";
+DROP TABLE IF EXISTS "message_reactions";
+DROP TABLE IF EXISTS "message_attachments";
+DROP TABLE IF EXISTS "messages";
+DROP TABLE IF EXISTS "room_webhooks";
+DROP TABLE IF EXISTS "room_bans";
+DROP TABLE IF EXISTS "room_join_requests";
+DROP TABLE IF EXISTS "room_invites";
+DROP TABLE IF EXISTS "room_members";
+DROP TABLE IF EXISTS "rooms";
+DROP TABLE IF EXISTS "user_blocks";
+DROP TABLE IF EXISTS "user_sessions";
+DROP TABLE IF EXISTS "user_contacts";
+DROP TABLE IF EXISTS "user_profiles";
+DROP TABLE IF EXISTS "users";
+
+COMMIT;
@@ -0,0 +1,542 @@
+-- Initial schema. Statements are idempotent so databases created by the
+-- AutoMigrate based releases are adopted as version 1 without changes.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS "users" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "username" varchar(50) NOT NULL,
+    "email" varchar(255) NOT NULL,
+    "password" text NOT NULL,
+    "first_name" varchar(100),
+    "last_name" varchar(100),
+    "avatar" varchar(500),
+    "phone_number" varchar(20),
+    "bio" text,
+    "status" varchar(20) DEFAULT 'offline',
+    "last_seen" timestamptz,
+    "is_active" boolean DEFAULT true,
+    "is_verified" boolean DEFAULT false,
+    "is_admin" boolean DEFAULT false,
+    "totp_secret" varchar(64),
+    "totp_enabled" boolean DEFAULT false,
+    "language" varchar(10) DEFAULT 'en',
+    "timezone" varchar(50) DEFAULT 'UTC',
+    "notification_sound" boolean DEFAULT true,
+    "email_notifications" boolean DEFAULT true,
+    "push_notifications" boolean DEFAULT true,
+    "show_online_status" boolean DEFAULT true,
+    "show_read_receipts" boolean DEFAULT true,
+    "allow_direct_messages" boolean DEFAULT true,
+    "auto_join_public_rooms" boolean DEFAULT false,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_email" ON "users" ("email");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_username" ON "users" ("username");
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "user_profiles" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "user_id" uuid NOT NULL,
+    "first_name" varchar(100),
+    "last_name" varchar(100),
+    "display_name" varchar(200),
+    "bio" text,
+    "location" varchar(255),
+    "website" varchar(500),
+    "company" varchar(255),
+    "job_title" varchar(255),
+    "date_of_birth" timestamptz,
+    "gender" varchar(20),
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_users_profile" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_user_profiles_user_id" ON "user_profiles" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_user_profiles_deleted_at" ON "user_profiles" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "user_contacts" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "user_id" uuid NOT NULL,
+    "contact_id" uuid NOT NULL,
+    "status" varchar(20) NOT NULL DEFAULT 'pending',
+    "nick_name" varchar(255),
+    "notes" text,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_user_contacts_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"),
+    CONSTRAINT "fk_user_contacts_contact" FOREIGN KEY ("contact_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_user_contacts_contact_id" ON "user_contacts" ("contact_id");
+CREATE INDEX IF NOT EXISTS "idx_user_contacts_user_id" ON "user_contacts" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_user_contacts_deleted_at" ON "user_contacts" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "user_sessions" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "user_id" uuid NOT NULL,
+    "device_id" varchar(255) NOT NULL,
+    "device_type" varchar(50),
+    "ip_address" varchar(45),
+    "user_agent" varchar(500),
+    "access_token" varchar(500) NOT NULL,
+    "refresh_token" varchar(500) NOT NULL,
+    "expires_at" timestamptz NOT NULL,
+    "is_active" boolean DEFAULT true,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_users_sessions" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_user_sessions_deleted_at" ON "user_sessions" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_user_sessions_expires_at" ON "user_sessions" ("expires_at");
+CREATE INDEX IF NOT EXISTS "idx_user_sessions_access_token" ON "user_sessions" ("access_token");
+CREATE INDEX IF NOT EXISTS "idx_user_sessions_device_id" ON "user_sessions" ("device_id");
+CREATE INDEX IF NOT EXISTS "idx_user_sessions_user_id" ON "user_sessions" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "user_blocks" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "blocker_id" uuid NOT NULL,
+    "blocked_id" uuid NOT NULL,
+    "reason" text,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_user_blocks_blocker" FOREIGN KEY ("blocker_id") REFERENCES "users"("id"),
+    CONSTRAINT "fk_user_blocks_blocked" FOREIGN KEY ("blocked_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_user_blocks_blocked_id" ON "user_blocks" ("blocked_id");
+CREATE INDEX IF NOT EXISTS "idx_user_blocks_blocker_id" ON "user_blocks" ("blocker_id");
+CREATE INDEX IF NOT EXISTS "idx_user_blocks_deleted_at" ON "user_blocks" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "rooms" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "name" varchar(255) NOT NULL,
+    "description" text,
+    "type" varchar(20) NOT NULL,
+    "avatar" varchar(500),
+    "is_public" boolean DEFAULT true,
+    "max_members" bigint,
+    "allow_file_upload" boolean DEFAULT true,
+    "allow_voice_messages" boolean DEFAULT true,
+    "allow_video_messages" boolean DEFAULT true,
+    "message_retention_days" bigint DEFAULT 0,
+    "require_approval" boolean DEFAULT false,
+    "mute_all_members" boolean DEFAULT false,
+    "only_admin_can_post" boolean DEFAULT false,
+    "slow_mode_seconds" bigint DEFAULT 0,
+    "is_archived" boolean DEFAULT false,
+    "created_by" uuid NOT NULL,
+    "direct_key" varchar(80),
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_rooms_created_by_user" FOREIGN KEY ("created_by") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_rooms_created_by" ON "rooms" ("created_by");
+CREATE INDEX IF NOT EXISTS "idx_rooms_is_archived" ON "rooms" ("is_archived");
+CREATE INDEX IF NOT EXISTS "idx_rooms_is_public" ON "rooms" ("is_public");
+CREATE INDEX IF NOT EXISTS "idx_rooms_type" ON "rooms" ("type");
+CREATE INDEX IF NOT EXISTS "idx_rooms_deleted_at" ON "rooms" ("deleted_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_rooms_direct_key" ON "rooms" ("direct_key");
+
+CREATE TABLE IF NOT EXISTS "room_members" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "room_id" uuid NOT NULL,
+    "user_id" uuid NOT NULL,
+    "role" varchar(20) DEFAULT 'member',
+    "joined_at" timestamptz DEFAULT now(),
+    "last_read_at" timestamptz,
+    "is_muted" boolean DEFAULT false,
+    "muted_until" timestamptz,
+    "is_archived" boolean DEFAULT false,
+    "notification_level" varchar(20) DEFAULT 'all',
+    "is_active" boolean DEFAULT true,
+    "invited_by" uuid,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_rooms_members" FOREIGN KEY ("room_id") REFERENCES "rooms"("id"),
+    CONSTRAINT "fk_room_members_invited_by_user" FOREIGN KEY ("invited_by") REFERENCES "users"("id"),
+    CONSTRAINT "fk_users_room_members" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_room_members_room_id" ON "room_members" ("room_id");
+CREATE INDEX IF NOT EXISTS "idx_room_members_deleted_at" ON "room_members" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_room_members_invited_by" ON "room_members" ("invited_by");
+CREATE INDEX IF NOT EXISTS "idx_room_members_user_id" ON "room_members" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "room_invites" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "room_id" uuid NOT NULL,
+    "inviter_id" uuid NOT NULL,
+    "invitee_id" uuid,
+    "invite_code" varchar(50) UNIQUE,
+    "status" varchar(20) DEFAULT 'pending',
+    "message" text,
+    "expires_at" timestamptz,
+    "max_uses" bigint DEFAULT 0,
+    "used_count" bigint DEFAULT 0,
+    "responded_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_rooms_invites" FOREIGN KEY ("room_id") REFERENCES "rooms"("id"),
+    CONSTRAINT "fk_room_invites_inviter" FOREIGN KEY ("inviter_id") REFERENCES "users"("id"),
+    CONSTRAINT "fk_room_invites_invitee" FOREIGN KEY ("invitee_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_room_invites_expires_at" ON "room_invites" ("expires_at");
+CREATE INDEX IF NOT EXISTS "idx_room_invites_status" ON "room_invites" ("status");
+CREATE INDEX IF NOT EXISTS "idx_room_invites_invite_code" ON "room_invites" ("invite_code");
+CREATE INDEX IF NOT EXISTS "idx_room_invites_invitee_id" ON "room_invites" ("invitee_id");
+CREATE INDEX IF NOT EXISTS "idx_room_invites_inviter_id" ON "room_invites" ("inviter_id");
+CREATE INDEX IF NOT EXISTS "idx_room_invites_room_id" ON "room_invites" ("room_id");
+CREATE INDEX IF NOT EXISTS "idx_room_invites_deleted_at" ON "room_invites" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "room_join_requests" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "room_id" uuid NOT NULL,
+    "user_id" uuid NOT NULL,
+    "status" varchar(20) NOT NULL DEFAULT 'pending',
+    "requested_at" timestamptz NOT NULL,
+    "responded_at" timestamptz,
+    "responded_by" uuid,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_room_join_requests_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_room_join_requests_room_user" ON "room_join_requests" ("room_id","user_id");
+CREATE INDEX IF NOT EXISTS "idx_room_join_requests_deleted_at" ON "room_join_requests" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_room_join_requests_status" ON "room_join_requests" ("status");
+CREATE INDEX IF NOT EXISTS "idx_room_join_requests_user_id" ON "room_join_requests" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "room_bans" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "room_id" uuid NOT NULL,
+    "user_id" uuid NOT NULL,
+    "banned_by" uuid NOT NULL,
+    "reason" varchar(500),
+    "expires_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_room_bans_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_room_bans_user_id" ON "room_bans" ("user_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_room_bans_room_user" ON "room_bans" ("room_id","user_id");
+CREATE INDEX IF NOT EXISTS "idx_room_bans_deleted_at" ON "room_bans" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "room_webhooks" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "room_id" uuid NOT NULL,
+    "url" varchar(2048) NOT NULL,
+    "secret" varchar(128) NOT NULL,
+    "events" jsonb,
+    "is_active" boolean DEFAULT true,
+    "created_by" uuid NOT NULL,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_room_webhooks_room_id" ON "room_webhooks" ("room_id");
+CREATE INDEX IF NOT EXISTS "idx_room_webhooks_deleted_at" ON "room_webhooks" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "messages" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "room_id" uuid NOT NULL,
+    "sender_id" uuid NOT NULL,
+    "reply_to_id" uuid,
+    "type" varchar(20) NOT NULL,
+    "content" text,
+    "metadata" jsonb,
+    "is_edited" boolean DEFAULT false,
+    "edited_at" timestamptz,
+    "is_deleted" boolean DEFAULT false,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_rooms_messages" FOREIGN KEY ("room_id") REFERENCES "rooms"("id"),
+    CONSTRAINT "fk_users_messages" FOREIGN KEY ("sender_id") REFERENCES "users"("id"),
+    CONSTRAINT "fk_messages_reply_to" FOREIGN KEY ("reply_to_id") REFERENCES "messages"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_messages_type" ON "messages" ("type");
+CREATE INDEX IF NOT EXISTS "idx_messages_reply_to_id" ON "messages" ("reply_to_id");
+CREATE INDEX IF NOT EXISTS "idx_messages_sender_id" ON "messages" ("sender_id");
+CREATE INDEX IF NOT EXISTS "idx_messages_room_id" ON "messages" ("room_id");
+CREATE INDEX IF NOT EXISTS "idx_messages_deleted_at" ON "messages" ("deleted_at");
+-- Backs cursor pagination of room history
+CREATE INDEX IF NOT EXISTS "idx_messages_room_created_at_id" ON "messages" ("room_id","created_at","id");
+-- Backs the lookup of messages mentioning a user
+CREATE INDEX IF NOT EXISTS "idx_messages_mentioned_users" ON "messages" USING GIN ((metadata -> 'mentioned_users') jsonb_path_ops);
+
+CREATE TABLE IF NOT EXISTS "message_attachments" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "message_id" uuid NOT NULL,
+    "file_name" varchar(255) NOT NULL,
+    "file_size" bigint NOT NULL,
+    "file_type" varchar(100) NOT NULL,
+    "mime_type" varchar(100) NOT NULL,
+    "url" varchar(500) NOT NULL,
+    "thumbnail_url" varchar(500),
+    "width" bigint,
+    "height" bigint,
+    "duration" bigint,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_messages_attachments" FOREIGN KEY ("message_id") REFERENCES "messages"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_message_attachments_mime_type" ON "message_attachments" ("mime_type");
+CREATE INDEX IF NOT EXISTS "idx_message_attachments_file_type" ON "message_attachments" ("file_type");
+CREATE INDEX IF NOT EXISTS "idx_message_attachments_message_id" ON "message_attachments" ("message_id");
+CREATE INDEX IF NOT EXISTS "idx_message_attachments_deleted_at" ON "message_attachments" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "message_reactions" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "message_id" uuid NOT NULL,
+    "user_id" uuid NOT NULL,
+    "emoji" varchar(50) NOT NULL,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_message_reactions_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"),
+    CONSTRAINT "fk_messages_reactions" FOREIGN KEY ("message_id") REFERENCES "messages"("id")
+);
+
+-- Reactions are unique per user and emoji; older versions stored repeats
+DELETE FROM "message_reactions" WHERE "deleted_at" IS NOT NULL;
+DELETE FROM "message_reactions" WHERE EXISTS (
+    SELECT 1 FROM "message_reactions" older
+    WHERE older."message_id" = "message_reactions"."message_id"
+      AND older."user_id" = "message_reactions"."user_id"
+      AND older."emoji" = "message_reactions"."emoji"
+      AND (older."created_at" < "message_reactions"."created_at"
+        OR (older."created_at" = "message_reactions"."created_at" AND older."id" < "message_reactions"."id"))
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_message_reactions_message_user_emoji" ON "message_reactions" ("message_id","user_id","emoji");
+CREATE INDEX IF NOT EXISTS "idx_message_reactions_deleted_at" ON "message_reactions" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_message_reactions_emoji" ON "message_reactions" ("emoji");
+CREATE INDEX IF NOT EXISTS "idx_message_reactions_user_id" ON "message_reactions" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "message_reads" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "message_id" uuid NOT NULL,
+    "user_id" uuid NOT NULL,
+    "read_at" timestamptz DEFAULT now(),
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_message_reads_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"),
+    CONSTRAINT "fk_messages_reads" FOREIGN KEY ("message_id") REFERENCES "messages"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_message_reads_read_at" ON "message_reads" ("read_at");
+CREATE INDEX IF NOT EXISTS "idx_message_reads_user_id" ON "message_reads" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_message_reads_message_id" ON "message_reads" ("message_id");
+CREATE INDEX IF NOT EXISTS "idx_message_reads_deleted_at" ON "message_reads" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "message_deliveries" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "message_id" uuid NOT NULL,
+    "user_id" uuid NOT NULL,
+    "delivered_at" timestamptz NOT NULL,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_message_deliveries_user_id" ON "message_deliveries" ("user_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_message_deliveries_message_user" ON "message_deliveries" ("message_id","user_id");
+CREATE INDEX IF NOT EXISTS "idx_message_deliveries_deleted_at" ON "message_deliveries" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "message_hiddens" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "message_id" uuid NOT NULL,
+    "user_id" uuid NOT NULL,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_message_hiddens_deleted_at" ON "message_hiddens" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_message_hiddens_user_id" ON "message_hiddens" ("user_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_message_hidden_message_user" ON "message_hiddens" ("message_id","user_id");
+
+CREATE TABLE IF NOT EXISTS "message_edits" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "message_id" uuid NOT NULL,
+    "revision" bigint NOT NULL,
+    "previous_content" text,
+    "previous_metadata" text,
+    "edited_by" uuid NOT NULL,
+    "edited_at" timestamptz NOT NULL,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_message_edits_message_revision" ON "message_edits" ("message_id","revision");
+CREATE INDEX IF NOT EXISTS "idx_message_edits_deleted_at" ON "message_edits" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "room_pinned_messages" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "room_id" uuid NOT NULL,
+    "message_id" uuid NOT NULL,
+    "pinned_by" uuid NOT NULL,
+    "pinned_at" timestamptz NOT NULL,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_room_pinned_messages_message" FOREIGN KEY ("message_id") REFERENCES "messages"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_room_pinned_room_message" ON "room_pinned_messages" ("room_id","message_id");
+CREATE INDEX IF NOT EXISTS "idx_room_pinned_messages_deleted_at" ON "room_pinned_messages" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "message_drafts" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "user_id" uuid NOT NULL,
+    "room_id" uuid NOT NULL,
+    "content" text NOT NULL,
+    "reply_to_id" uuid,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_message_drafts_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"),
+    CONSTRAINT "fk_message_drafts_room" FOREIGN KEY ("room_id") REFERENCES "rooms"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_message_drafts_room_id" ON "message_drafts" ("room_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_message_drafts_user_room" ON "message_drafts" ("user_id","room_id");
+CREATE INDEX IF NOT EXISTS "idx_message_drafts_deleted_at" ON "message_drafts" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "scheduled_messages" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "room_id" uuid NOT NULL,
+    "sender_id" uuid NOT NULL,
+    "reply_to_id" uuid,
+    "type" varchar(20) NOT NULL,
+    "content" text,
+    "metadata" text,
+    "file_ids" text,
+    "scheduled_at" timestamptz NOT NULL,
+    "status" varchar(20) NOT NULL DEFAULT 'pending',
+    "message_id" uuid,
+    "error" text,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_scheduled_messages_room_id" ON "scheduled_messages" ("room_id");
+CREATE INDEX IF NOT EXISTS "idx_scheduled_messages_deleted_at" ON "scheduled_messages" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_scheduled_messages_status" ON "scheduled_messages" ("status");
+CREATE INDEX IF NOT EXISTS "idx_scheduled_messages_scheduled_at" ON "scheduled_messages" ("scheduled_at");
+CREATE INDEX IF NOT EXISTS "idx_scheduled_messages_sender_id" ON "scheduled_messages" ("sender_id");
+
+CREATE TABLE IF NOT EXISTS "notifications" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "user_id" uuid NOT NULL,
+    "type" varchar(50) NOT NULL,
+    "title" varchar(255) NOT NULL,
+    "message" text NOT NULL,
+    "data" jsonb,
+    "is_read" boolean DEFAULT false,
+    "read_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_users_notifications" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_notifications_is_read" ON "notifications" ("is_read");
+CREATE INDEX IF NOT EXISTS "idx_notifications_type" ON "notifications" ("type");
+CREATE INDEX IF NOT EXISTS "idx_notifications_user_id" ON "notifications" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_notifications_deleted_at" ON "notifications" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "file_uploads" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "user_id" uuid NOT NULL,
+    "original_name" varchar(255) NOT NULL,
+    "file_name" varchar(255) NOT NULL,
+    "file_path" varchar(500) NOT NULL,
+    "file_size" bigint NOT NULL,
+    "file_type" varchar(100) NOT NULL,
+    "mime_type" varchar(100) NOT NULL,
+    "thumbnail_path" varchar(500),
+    "upload_status" varchar(20) DEFAULT 'uploading',
+    "is_temporary" boolean DEFAULT true,
+    "expires_at" timestamptz,
+    "width" bigint,
+    "height" bigint,
+    "duration" bigint,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_file_uploads_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_file_uploads_deleted_at" ON "file_uploads" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_file_uploads_expires_at" ON "file_uploads" ("expires_at");
+CREATE INDEX IF NOT EXISTS "idx_file_uploads_is_temporary" ON "file_uploads" ("is_temporary");
+CREATE INDEX IF NOT EXISTS "idx_file_uploads_upload_status" ON "file_uploads" ("upload_status");
+CREATE INDEX IF NOT EXISTS "idx_file_uploads_file_type" ON "file_uploads" ("file_type");
+CREATE INDEX IF NOT EXISTS "idx_file_uploads_file_name" ON "file_uploads" ("file_name");
+CREATE INDEX IF NOT EXISTS "idx_file_uploads_user_id" ON "file_uploads" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "activity_logs" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "user_id" uuid,
+    "activity_type" varchar(50) NOT NULL,
+    "description" text,
+    "metadata" jsonb,
+    "ip_address" varchar(45),
+    "user_agent" varchar(500),
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_activity_logs_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_activity_logs_activity_type" ON "activity_logs" ("activity_type");
+CREATE INDEX IF NOT EXISTS "idx_activity_logs_user_id" ON "activity_logs" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_activity_logs_deleted_at" ON "activity_logs" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "user_preferences" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "user_id" uuid NOT NULL,
+    "theme" varchar(20) DEFAULT 'light',
+    "font_size" varchar(10) DEFAULT 'medium',
+    "chat_wallpaper" varchar(500),
+    "auto_download_media" boolean DEFAULT true,
+    "compress_images" boolean DEFAULT true,
+    "keyboard_shortcuts" boolean DEFAULT true,
+    "show_typing_indicators" boolean DEFAULT true,
+    "group_notifications" boolean DEFAULT true,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_user_preferences_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_user_preferences_user_id" ON "user_preferences" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_user_preferences_deleted_at" ON "user_preferences" ("deleted_at");
+
+COMMIT;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS "idx_user_sessions_fcm_token";
+ALTER TABLE "user_sessions" DROP COLUMN IF EXISTS "fcm_token";
@@ -0,0 +1,2 @@
+ALTER TABLE "user_sessions" ADD COLUMN IF NOT EXISTS "fcm_token" varchar(255);
+CREATE INDEX IF NOT EXISTS "idx_user_sessions_fcm_token" ON "user_sessions" ("fcm_token");
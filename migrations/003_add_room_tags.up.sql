@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS "room_tags" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "room_id" uuid NOT NULL,
+    "tag" varchar(50) NOT NULL,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_room_tags_room" FOREIGN KEY ("room_id") REFERENCES "rooms"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_room_tags_room_tag" ON "room_tags" ("room_id","tag");
+CREATE INDEX IF NOT EXISTS "idx_room_tags_tag" ON "room_tags" ("tag");
+CREATE INDEX IF NOT EXISTS "idx_room_tags_deleted_at" ON "room_tags" ("deleted_at");
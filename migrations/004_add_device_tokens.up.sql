@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS "device_tokens" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "created_at" timestamptz DEFAULT now(),
+    "updated_at" timestamptz DEFAULT now(),
+    "deleted_at" timestamptz,
+    "user_id" uuid NOT NULL,
+    "platform" varchar(20) NOT NULL,
+    "token" varchar(255) NOT NULL,
+    "last_seen" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_device_tokens_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_device_tokens_token" ON "device_tokens" ("token");
+CREATE INDEX IF NOT EXISTS "idx_device_tokens_user_id" ON "device_tokens" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_device_tokens_deleted_at" ON "device_tokens" ("deleted_at");
@@ -0,0 +1,12 @@
+// Package migrations holds the versioned SQL migrations of the database
+// schema. Files follow the golang-migrate naming scheme,
+// NNN_description.up.sql and NNN_description.down.sql, so the migrate CLI
+// can apply and roll them back as well.
+package migrations
+
+import "embed"
+
+// FS contains the migration files
+//
+//go:embed *.sql
+var FS embed.FS